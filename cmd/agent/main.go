@@ -27,6 +27,7 @@
 	"github.com/rancher/rancher/pkg/agent/clean"
 	"github.com/rancher/rancher/pkg/agent/clean/adunmigration"
 	"github.com/rancher/rancher/pkg/agent/cluster"
+	"github.com/rancher/rancher/pkg/agent/etcdsnapshot"
 	"github.com/rancher/rancher/pkg/agent/node"
 	"github.com/rancher/rancher/pkg/agent/rancher"
 	"github.com/rancher/rancher/pkg/controllers/managementuser/cavalidator"
@@ -90,6 +91,8 @@ func runArgs(ctx context.Context) error {
 	switch os.Args[1] {
 	case "clean":
 		return clean.Run(ctx, os.Args)
+	case "etcd-snapshot":
+		return etcdsnapshot.Run(ctx, os.Args)
 	default:
 		return run(ctx)
 	}
@@ -11,6 +11,7 @@
 	"github.com/ehazlett/simplelog"
 	_ "github.com/rancher/norman/controller"
 	"github.com/rancher/norman/pkg/kwrapper/k8s"
+	"github.com/rancher/rancher/pkg/auth/audit"
 	"github.com/rancher/rancher/pkg/data/management"
 	"github.com/rancher/rancher/pkg/logserver"
 	"github.com/rancher/rancher/pkg/rancher"
@@ -28,6 +29,7 @@
 func main() {
 	management.RegisterPasswordResetCommand()
 	management.RegisterEnsureDefaultAdminCommand()
+	audit.RegisterVerifyCommand()
 	if reexec.Init() {
 		return
 	}
@@ -140,6 +142,84 @@ func main() {
 			Usage:       "Audit log level: 0 - disable audit log, 1 - log event metadata, 2 - log event metadata and request body, 3 - log event metadata, request body and response body",
 			Destination: &config.AuditLevel,
 		},
+		cli.IntFlag{
+			Name:        "audit-log-stdout-level",
+			Value:       0,
+			EnvVar:      "AUDIT_LOG_STDOUT_LEVEL",
+			Usage:       "Audit log level for entries written to stdout, uses the same values as audit-level. 0 disables the stdout sink",
+			Destination: &config.AuditLogStdoutLevel,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-syslog-address",
+			EnvVar:      "AUDIT_LOG_SYSLOG_ADDRESS",
+			Usage:       "Address (host:port) of a syslog server to send RFC 5424 audit log entries to over TCP",
+			Destination: &config.AuditLogSyslogAddress,
+		},
+		cli.IntFlag{
+			Name:        "audit-log-syslog-level",
+			Value:       0,
+			EnvVar:      "AUDIT_LOG_SYSLOG_LEVEL",
+			Usage:       "Audit log level for entries sent to syslog, uses the same values as audit-level. 0 disables the syslog sink",
+			Destination: &config.AuditLogSyslogLevel,
+		},
+		cli.BoolFlag{
+			Name:        "audit-log-syslog-tls",
+			EnvVar:      "AUDIT_LOG_SYSLOG_TLS",
+			Usage:       "Use TLS when connecting to the audit log syslog server",
+			Destination: &config.AuditLogSyslogTLS,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-syslog-ca-file",
+			EnvVar:      "AUDIT_LOG_SYSLOG_CA_FILE",
+			Usage:       "Path to a PEM encoded CA bundle used to verify the audit log syslog server, defaults to the system roots",
+			Destination: &config.AuditLogSyslogCAFile,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-webhook-url",
+			EnvVar:      "AUDIT_LOG_WEBHOOK_URL",
+			Usage:       "URL that batches of audit log entries are posted to as a JSON array",
+			Destination: &config.AuditLogWebhookURL,
+		},
+		cli.IntFlag{
+			Name:        "audit-log-webhook-level",
+			Value:       0,
+			EnvVar:      "AUDIT_LOG_WEBHOOK_LEVEL",
+			Usage:       "Audit log level for entries sent to the webhook, uses the same values as audit-level. 0 disables the webhook sink",
+			Destination: &config.AuditLogWebhookLevel,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-webhook-spool-path",
+			EnvVar:      "AUDIT_LOG_WEBHOOK_SPOOL_PATH",
+			Value:       "/var/log/auditlog/rancher-api-audit-webhook.spool",
+			Usage:       "File that audit log entries are spooled to while the webhook is unreachable",
+			Destination: &config.AuditLogWebhookSpoolPath,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-signing-secret",
+			EnvVar:      "AUDIT_LOG_SIGNING_SECRET",
+			Usage:       "Name of a secret in the cattle-system namespace holding the key used to sign the audit log hash chain. The secret is created with a random key if it doesn't exist. Hash chaining is disabled if empty",
+			Destination: &config.AuditLogSigningSecret,
+		},
+		cli.IntFlag{
+			Name:        "audit-log-signing-interval",
+			Value:       audit.DefaultSigningInterval,
+			EnvVar:      "AUDIT_LOG_SIGNING_INTERVAL",
+			Usage:       "Number of audit log records between two signatures of the hash chain",
+			Destination: &config.AuditLogSigningInterval,
+		},
+		cli.StringFlag{
+			Name:        "tracing-endpoint",
+			EnvVar:      "CATTLE_TRACING_ENDPOINT",
+			Usage:       "URL of the OTLP gRPC collector to export traces to, e.g. http://localhost:4317. TLS is used for https URLs. Tracing is disabled if empty",
+			Destination: &config.TracingEndpoint,
+		},
+		cli.Float64Flag{
+			Name:        "tracing-sampling-ratio",
+			Value:       1,
+			EnvVar:      "CATTLE_TRACING_SAMPLING_RATIO",
+			Usage:       "Ratio of the requests traced, between 0 and 1, unless the client already sampled the request",
+			Destination: &config.TracingSamplingRatio,
+		},
 		cli.StringFlag{
 			Name:        "profile-listen-address",
 			Value:       "127.0.0.1:6060",
@@ -0,0 +1,383 @@
+// Package etcdsnapshot implements the etcd-snapshot subcommand of the agent. Rancher runs it on the etcd nodes of
+// provisioned clusters whose etcd snapshots are encrypted, to encrypt the snapshots before uploading them to S3, and to
+// download and decrypt a snapshot before it is restored.
+package etcdsnapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rancher/rancher/pkg/capr/snapshotcrypt"
+	"github.com/sirupsen/logrus"
+)
+
+func usage() string {
+	return `agent etcd-snapshot upload|download [flags]
+
+upload encrypts the etcd snapshots of the node that are not in S3 yet and uploads them, removes the encrypted
+snapshots of the node that exceed the retention, and prints the encrypted snapshots of the cluster in S3 as JSON.
+
+download downloads an encrypted etcd snapshot from S3 and decrypts it.
+
+The S3 target is configured with the --s3-* flags of the etcd-snapshot command of RKE2 and K3s, the secret key is
+read from the AWS_SECRET_ACCESS_KEY environment variable.`
+}
+
+func Run(ctx context.Context, args []string) error {
+	if len(args) < 3 {
+		fmt.Println(usage())
+		return nil
+	}
+
+	switch args[2] {
+	case "upload":
+		return upload(ctx, args[3:])
+	case "download":
+		return download(ctx, args[3:])
+	default:
+		return fmt.Errorf("unknown subcommand %q\n\n%s", args[2], usage())
+	}
+}
+
+type s3Flags struct {
+	bucket        string
+	accessKey     string
+	region        string
+	folder        string
+	endpoint      string
+	endpointCA    string
+	skipSSLVerify bool
+	insecure      bool
+}
+
+func (s *s3Flags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.bucket, "s3-bucket", "", "S3 bucket")
+	fs.StringVar(&s.accessKey, "s3-access-key", "", "S3 access key")
+	fs.StringVar(&s.region, "s3-region", "", "S3 region")
+	fs.StringVar(&s.folder, "s3-folder", "", "S3 folder")
+	fs.StringVar(&s.endpoint, "s3-endpoint", "s3.amazonaws.com", "S3 endpoint")
+	fs.StringVar(&s.endpointCA, "s3-endpoint-ca", "", "path of the CA of the S3 endpoint")
+	fs.BoolVar(&s.skipSSLVerify, "s3-skip-ssl-verify", false, "skip the verification of the certificate of the S3 endpoint")
+	fs.BoolVar(&s.insecure, "s3-insecure", false, "disable HTTPS to the S3 endpoint")
+	// set by Rancher along with the other S3 flags, S3 is always used
+	fs.Bool("s3", true, "")
+}
+
+func (s *s3Flags) client() (*minio.Client, error) {
+	if s.bucket == "" {
+		return nil, errors.New("--s3-bucket is required")
+	}
+
+	// no access credentials, we assume IAM roles
+	creds := credentials.NewIAM("")
+	if secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY"); s.accessKey != "" && secretKey != "" {
+		creds = credentials.NewStaticV4(s.accessKey, secretKey, "")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: s.skipSSLVerify,
+	}
+	if s.endpointCA != "" {
+		ca, err := os.ReadFile(s.endpointCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse CA of S3 endpoint from %s", s.endpointCA)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if strings.Contains(s.endpoint, "aliyun") {
+		bucketLookup = minio.BucketLookupDNS
+	}
+
+	return minio.New(s.endpoint, &minio.Options{
+		Creds:        creds,
+		Region:       s.region,
+		Secure:       !s.insecure,
+		BucketLookup: bucketLookup,
+		Transport:    transport,
+	})
+}
+
+// location returns the URL of the object with the given key.
+func (s *s3Flags) location(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
+
+func readKeys(keyFile string) ([][]byte, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotcrypt.ParseKeyFile(data)
+}
+
+func upload(ctx context.Context, args []string) error {
+	var (
+		s3                                      s3Flags
+		snapshotDir, keyFile, cluster, nodeName string
+		retention                               int
+		minAge                                  time.Duration
+	)
+	fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+	s3.register(fs)
+	fs.StringVar(&snapshotDir, "snapshot-dir", "", "directory of the local etcd snapshots")
+	fs.StringVar(&keyFile, "key-file", "", "file holding the encryption keys, one base64 encoded key per line")
+	fs.StringVar(&cluster, "cluster", "", "namespace/name of the cluster in Rancher")
+	fs.StringVar(&nodeName, "node-name", "", "name of the node")
+	fs.IntVar(&retention, "retention", 0, "number of encrypted snapshots of the node to keep in S3, all are kept if not positive")
+	fs.DurationVar(&minAge, "min-age", time.Minute, "minimum age of local snapshots to upload, so that snapshots that are still being written are not uploaded")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if snapshotDir == "" || keyFile == "" || cluster == "" || nodeName == "" {
+		return errors.New("--snapshot-dir, --key-file, --cluster and --node-name are required")
+	}
+
+	keys, err := readKeys(keyFile)
+	if err != nil {
+		return err
+	}
+	client, err := s3.client()
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := list(ctx, client, &s3, cluster)
+	if err != nil {
+		return err
+	}
+	uploaded := map[string]bool{}
+	for _, snapshot := range snapshots {
+		uploaded[snapshot.Name] = true
+	}
+
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		return err
+	}
+	var candidates []snapshotcrypt.Snapshot
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), ".part") ||
+			uploaded[entry.Name()+snapshotcrypt.Extension] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) < minAge {
+			continue
+		}
+		candidates = append(candidates, snapshotcrypt.Snapshot{
+			Name:      entry.Name() + snapshotcrypt.Extension,
+			NodeName:  nodeName,
+			CreatedAt: info.ModTime(),
+			KeyID:     snapshotcrypt.KeyID(keys[0]),
+		})
+	}
+
+	// local snapshots that would be removed by the retention right away are not uploaded, otherwise they would be
+	// uploaded and removed again on every run for as long as they are kept locally
+	keep := retained(append(nodeSnapshots(snapshots, nodeName), candidates...), retention)
+	for _, candidate := range candidates {
+		if !keep[candidate.Name] {
+			continue
+		}
+		size, checksum, err := put(ctx, client, &s3, filepath.Join(snapshotDir, strings.TrimSuffix(candidate.Name, snapshotcrypt.Extension)), candidate, cluster, keys[0])
+		if err != nil {
+			return fmt.Errorf("failed to upload encrypted etcd snapshot %s: %w", candidate.Name, err)
+		}
+		logrus.Infof("Uploaded encrypted etcd snapshot %s", candidate.Name)
+		candidate.Size = size
+		candidate.Checksum = checksum
+		candidate.Location = s3.location(path.Join(s3.folder, candidate.Name))
+		snapshots = append(snapshots, candidate)
+	}
+
+	var result []snapshotcrypt.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.NodeName == nodeName && !keep[snapshot.Name] {
+			if err := client.RemoveObject(ctx, s3.bucket, path.Join(s3.folder, snapshot.Name), minio.RemoveObjectOptions{}); err != nil {
+				return fmt.Errorf("failed to remove encrypted etcd snapshot %s: %w", snapshot.Name, err)
+			}
+			logrus.Infof("Removed encrypted etcd snapshot %s by retention", snapshot.Name)
+			continue
+		}
+		result = append(result, snapshot)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return json.NewEncoder(os.Stdout).Encode(result)
+}
+
+// list returns the encrypted etcd snapshots of the cluster in S3.
+func list(ctx context.Context, client *minio.Client, s3 *s3Flags, cluster string) ([]snapshotcrypt.Snapshot, error) {
+	prefix := s3.folder
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var snapshots []snapshotcrypt.Snapshot
+	for info := range client.ListObjects(ctx, s3.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		if !strings.HasSuffix(info.Key, snapshotcrypt.Extension) {
+			continue
+		}
+		stat, err := client.StatObject(ctx, s3.bucket, info.Key, minio.StatObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if snapshot, ok := snapshotcrypt.SnapshotFromMetadata(path.Base(info.Key), s3.location(info.Key), stat.Size, stat.LastModified, stat.UserMetadata, cluster); ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// put encrypts the local etcd snapshot and uploads it to S3, it returns the size and the SHA-256 checksum of the
+// encrypted snapshot.
+func put(ctx context.Context, client *minio.Client, s3 *s3Flags, file string, snapshot snapshotcrypt.Snapshot, cluster string, key []byte) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+
+	// the ciphertext is hashed before it is written to the pipe, so that it is hashed in full once it was uploaded
+	hash := sha256.New()
+	reader, writer := io.Pipe()
+	go func() {
+		w, err := snapshotcrypt.NewWriter(io.MultiWriter(hash, writer), key)
+		if err == nil {
+			_, err = io.Copy(w, f)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	info, err := client.PutObject(ctx, s3.bucket, path.Join(s3.folder, snapshot.Name), reader, snapshotcrypt.EncryptedSize(stat.Size()), minio.PutObjectOptions{
+		UserMetadata: snapshot.Metadata(cluster),
+	})
+	reader.CloseWithError(err)
+	if err != nil {
+		return 0, "", err
+	}
+	return info.Size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func nodeSnapshots(snapshots []snapshotcrypt.Snapshot, nodeName string) []snapshotcrypt.Snapshot {
+	var result []snapshotcrypt.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.NodeName == nodeName {
+			result = append(result, snapshot)
+		}
+	}
+	return result
+}
+
+// retained returns the names of the snapshots that are kept by the retention: the most recent ones, or all if the
+// retention is not positive.
+func retained(snapshots []snapshotcrypt.Snapshot, retention int) map[string]bool {
+	sorted := make([]snapshotcrypt.Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	keep := map[string]bool{}
+	for i, snapshot := range sorted {
+		if retention <= 0 || i < retention {
+			keep[snapshot.Name] = true
+		}
+	}
+	return keep
+}
+
+func download(ctx context.Context, args []string) error {
+	var (
+		s3                    s3Flags
+		keyFile, name, output string
+	)
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	s3.register(fs)
+	fs.StringVar(&keyFile, "key-file", "", "file holding the encryption keys, one base64 encoded key per line")
+	fs.StringVar(&name, "name", "", "name of the encrypted etcd snapshot in the folder of the S3 target")
+	fs.StringVar(&output, "output", "", "path the decrypted etcd snapshot is written to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if keyFile == "" || name == "" || output == "" {
+		return errors.New("--key-file, --name and --output are required")
+	}
+
+	keys, err := readKeys(keyFile)
+	if err != nil {
+		return err
+	}
+	client, err := s3.client()
+	if err != nil {
+		return err
+	}
+
+	object, err := client.GetObject(ctx, s3.bucket, path.Join(s3.folder, name), minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	reader, err := snapshotcrypt.NewReader(object, keys)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt etcd snapshot %s: %w", name, err)
+	}
+
+	tmp := output + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to decrypt etcd snapshot %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	logrus.Infof("Decrypted etcd snapshot %s to %s", name, output)
+	return os.Rename(tmp, output)
+}
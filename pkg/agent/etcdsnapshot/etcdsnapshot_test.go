@@ -0,0 +1,62 @@
+package etcdsnapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher/rancher/pkg/capr/snapshotcrypt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetained(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	snapshots := []snapshotcrypt.Snapshot{
+		{Name: "etcd-snapshot-node-1.enc", CreatedAt: now.Add(-3 * time.Hour)},
+		{Name: "etcd-snapshot-node-2.enc", CreatedAt: now.Add(-1 * time.Hour)},
+		{Name: "etcd-snapshot-node-3.enc", CreatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		name      string
+		retention int
+		expected  map[string]bool
+	}{
+		{
+			name:      "newest",
+			retention: 2,
+			expected: map[string]bool{
+				"etcd-snapshot-node-2.enc": true,
+				"etcd-snapshot-node-3.enc": true,
+			},
+		},
+		{
+			name:      "more than snapshots",
+			retention: 5,
+			expected: map[string]bool{
+				"etcd-snapshot-node-1.enc": true,
+				"etcd-snapshot-node-2.enc": true,
+				"etcd-snapshot-node-3.enc": true,
+			},
+		},
+		{
+			name:      "unlimited",
+			retention: 0,
+			expected: map[string]bool{
+				"etcd-snapshot-node-1.enc": true,
+				"etcd-snapshot-node-2.enc": true,
+				"etcd-snapshot-node-3.enc": true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, retained(snapshots, tt.retention))
+		})
+	}
+}
+
+func TestRunUnknownSubcommand(t *testing.T) {
+	err := Run(context.Background(), []string{"agent", "etcd-snapshot", "uplaod"})
+	assert.ErrorContains(t, err, `unknown subcommand "uplaod"`)
+}
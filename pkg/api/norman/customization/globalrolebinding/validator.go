@@ -5,9 +5,14 @@
 
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/norman/types"
+	"github.com/rancher/rancher/pkg/api/norman/customization/roletemplatebinding"
 )
 
 func Validator(request *types.APIContext, schema *types.Schema, data map[string]interface{}) error {
+	if err := roletemplatebinding.ValidateExpiresAt(data); err != nil {
+		return err
+	}
+
 	if request.Method == http.MethodPut {
 		return nil
 	}
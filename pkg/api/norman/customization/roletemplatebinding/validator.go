@@ -3,9 +3,11 @@
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/norman/types"
+	"github.com/rancher/norman/types/convert"
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/types/config"
@@ -36,6 +38,10 @@ type validator struct {
 }
 
 func (v *validator) validator(request *types.APIContext, schema *types.Schema, data map[string]interface{}) error {
+	if err := ValidateExpiresAt(data); err != nil {
+		return err
+	}
+
 	roleTemplateName := data[v.field]
 	if roleTemplateName == nil && request.Method == http.MethodPut {
 		return nil
@@ -71,6 +77,22 @@ func (v *validator) validator(request *types.APIContext, schema *types.Schema, d
 	return nil
 }
 
+// ValidateExpiresAt returns an error if the binding has an expiry time that is invalid or has already passed.
+func ValidateExpiresAt(data map[string]interface{}) error {
+	value, ok := data["expiresAt"]
+	if !ok || value == nil || value == "" {
+		return nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, convert.ToString(value))
+	if err != nil {
+		return httperror.NewAPIError(httperror.InvalidFormat, fmt.Sprintf("invalid expiresAt: %v", err))
+	}
+	if !expiresAt.After(time.Now()) {
+		return httperror.NewAPIError(httperror.InvalidBodyContent, "expiresAt must be in the future")
+	}
+	return nil
+}
+
 func (v *validator) validateRoleTemplateBinding(obj interface{}) (*v3.RoleTemplate, error) {
 	roleTemplateID, ok := obj.(string)
 	if !ok {
@@ -0,0 +1,388 @@
+// Package accessrequests adds the actions to request access, and to approve or deny access requests, to the
+// Steve API. Users can't create or update AccessRequests directly, these actions record who requested and who
+// reviewed the access.
+package accessrequests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	"github.com/rancher/apiserver/pkg/types"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/controllers/management/accessrequest"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/rbac"
+	"github.com/rancher/rancher/pkg/ref"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/wrangler"
+	schema2 "github.com/rancher/steve/pkg/schema"
+	steve "github.com/rancher/steve/pkg/server"
+	rbaccontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/rbac/v1"
+	"github.com/rancher/wrangler/v3/pkg/schemas"
+	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	rbacvalidation "k8s.io/component-helpers/auth/rbac/validation"
+)
+
+const (
+	requestAction = "request"
+	approveAction = "approve"
+	denyAction    = "deny"
+
+	accessRequestType = "management.cattle.io.accessrequest"
+)
+
+// AccessRequestInput is the input of the request action.
+type AccessRequestInput struct {
+	RoleTemplateName string `json:"roleTemplateName,omitempty"`
+	ClusterName      string `json:"clusterName,omitempty"`
+	ProjectName      string `json:"projectName,omitempty"`
+	Justification    string `json:"justification,omitempty"`
+	// Duration is a duration string such as "2h".
+	Duration string `json:"duration,omitempty"`
+}
+
+// AccessRequestReviewInput is the input of the approve and deny actions.
+type AccessRequestReviewInput struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+type handler struct {
+	accessRequests    mgmtcontrollers.AccessRequestClient
+	grbCache          mgmtcontrollers.GlobalRoleBindingCache
+	grCache           mgmtcontrollers.GlobalRoleCache
+	roleTemplateCache mgmtcontrollers.RoleTemplateCache
+	crtbCache         mgmtcontrollers.ClusterRoleTemplateBindingCache
+	prtbCache         mgmtcontrollers.ProjectRoleTemplateBindingCache
+	projectCache      mgmtcontrollers.ProjectCache
+	clusterRoleCache  rbaccontrollers.ClusterRoleCache
+	now               func() time.Time
+}
+
+// Register adds the access request actions to the Steve API.
+func Register(server *steve.Server, wContext *wrangler.Context) {
+	h := &handler{
+		accessRequests:    wContext.Mgmt.AccessRequest(),
+		grbCache:          wContext.Mgmt.GlobalRoleBinding().Cache(),
+		grCache:           wContext.Mgmt.GlobalRole().Cache(),
+		roleTemplateCache: wContext.Mgmt.RoleTemplate().Cache(),
+		crtbCache:         wContext.Mgmt.ClusterRoleTemplateBinding().Cache(),
+		prtbCache:         wContext.Mgmt.ProjectRoleTemplateBinding().Cache(),
+		projectCache:      wContext.Mgmt.Project().Cache(),
+		clusterRoleCache:  wContext.RBAC.ClusterRole().Cache(),
+		now:               time.Now,
+	}
+
+	// Users can only see the access requests they made, so access is requested through the base schema of the
+	// input, which every user can see, rather than through a collection action of the AccessRequest schema.
+	server.BaseSchemas.MustImportAndCustomize(AccessRequestInput{}, func(schema *types.APISchema) {
+		schema.ActionHandlers = map[string]http.Handler{
+			requestAction: h,
+		}
+		schema.CollectionActions = map[string]schemas.Action{
+			requestAction: {
+				Input:  "accessRequestInput",
+				Output: accessRequestType,
+			},
+		}
+	})
+	server.BaseSchemas.MustImportAndCustomize(AccessRequestReviewInput{}, nil)
+	server.SchemaFactory.AddTemplate(schema2.Template{
+		Group: v3.SchemeGroupVersion.Group,
+		Kind:  "AccessRequest",
+		Customize: func(schema *types.APISchema) {
+			schema.ActionHandlers = map[string]http.Handler{
+				approveAction: h,
+				denyAction:    h,
+			}
+			schema.ResourceActions = map[string]schemas.Action{
+				approveAction: {
+					Input:  "accessRequestReviewInput",
+					Output: accessRequestType,
+				},
+				denyAction: {
+					Input:  "accessRequestReviewInput",
+					Output: accessRequestType,
+				},
+			}
+		},
+	})
+}
+
+func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	apiRequest := types.GetAPIContext(req.Context())
+
+	user, ok := request.UserFrom(req.Context())
+	if !ok {
+		apiRequest.WriteError(validation.Unauthorized)
+		return
+	}
+
+	var (
+		obj *v3.AccessRequest
+		err error
+	)
+	switch apiRequest.Action {
+	case requestAction:
+		obj, err = h.request(user, req.Body)
+	case approveAction:
+		obj, err = h.review(user, apiRequest.Name, req.Body, true)
+	case denyAction:
+		obj, err = h.review(user, apiRequest.Name, req.Body, false)
+	default:
+		err = apierror.NewAPIError(validation.InvalidAction, "invalid action "+apiRequest.Action)
+	}
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	apiRequest.WriteResponse(http.StatusOK, types.APIObject{
+		Type:   accessRequestType,
+		ID:     obj.Name,
+		Object: obj,
+	})
+}
+
+// request creates an access request for the requesting user.
+func (h *handler) request(user user.Info, body io.Reader) (*v3.AccessRequest, error) {
+	var input AccessRequestInput
+	if err := json.NewDecoder(body).Decode(&input); err != nil {
+		return nil, apierror.NewAPIError(validation.InvalidBodyContent, fmt.Sprintf("failed to parse body: %v", err))
+	}
+	duration, err := time.ParseDuration(input.Duration)
+	if err != nil {
+		return nil, apierror.NewAPIError(validation.InvalidFormat, fmt.Sprintf("invalid duration %q: %v", input.Duration, err))
+	}
+
+	obj := &v3.AccessRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "ar-"},
+		Spec: v3.AccessRequestSpec{
+			UserName:         user.GetName(),
+			RoleTemplateName: input.RoleTemplateName,
+			ClusterName:      input.ClusterName,
+			ProjectName:      input.ProjectName,
+			Justification:    input.Justification,
+			Duration:         metav1.Duration{Duration: duration},
+		},
+	}
+	if err := accessrequest.ValidateSpec(&obj.Spec); err != nil {
+		return nil, apierror.NewAPIError(validation.InvalidBodyContent, err.Error())
+	}
+	return h.accessRequests.Create(obj)
+}
+
+// review approves or denies a pending access request.
+func (h *handler) review(user user.Info, name string, body io.Reader, approve bool) (*v3.AccessRequest, error) {
+	var input AccessRequestReviewInput
+	if err := json.NewDecoder(body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		return nil, apierror.NewAPIError(validation.InvalidBodyContent, fmt.Sprintf("failed to parse body: %v", err))
+	}
+
+	approver, err := h.isApprover(user)
+	if err != nil {
+		return nil, err
+	}
+	if !approver {
+		return nil, apierror.NewAPIError(validation.PermissionDenied, "only approvers can review access requests")
+	}
+
+	obj, err := h.accessRequests.Get(name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, apierror.NewAPIError(validation.NotFound, fmt.Sprintf("access request %s not found", name))
+		}
+		return nil, err
+	}
+	if obj.Spec.UserName == user.GetName() {
+		return nil, apierror.NewAPIError(validation.PermissionDenied, "users can't review their own access requests")
+	}
+	if obj.Status.State != v3.AccessRequestStatePending {
+		return nil, apierror.NewAPIError(validation.InvalidState, fmt.Sprintf("access request %s is %s, only pending requests can be reviewed", name, obj.Status.State))
+	}
+
+	if approve {
+		covered, err := h.holdsRequestedAccess(user, obj)
+		if err != nil {
+			return nil, err
+		}
+		if !covered {
+			return nil, apierror.NewAPIError(validation.PermissionDenied,
+				fmt.Sprintf("approvers can only grant access they hold themselves, %s doesn't hold all permissions of role template %s", user.GetName(), obj.Spec.RoleTemplateName))
+		}
+	}
+
+	now := metav1.NewTime(h.now())
+	obj = obj.DeepCopy()
+	obj.Status.ReviewerName = user.GetName()
+	obj.Status.ReviewComment = input.Comment
+	obj.Status.ReviewedAt = &now
+	if approve {
+		obj.Status.State = v3.AccessRequestStateApproved
+		obj.Status.Message = "Approved by " + user.GetName()
+	} else {
+		obj.Status.State = v3.AccessRequestStateDenied
+		obj.Status.Message = "Denied by " + user.GetName()
+	}
+
+	obj, err = h.accessRequests.UpdateStatus(obj)
+	if apierrors.IsConflict(err) {
+		return nil, apierror.NewAPIError(validation.Conflict, fmt.Sprintf("access request %s was modified, try again", name))
+	}
+	return obj, err
+}
+
+// isApprover returns whether the user is bound to an approver global role, directly or through a group, or is a
+// member of an approver group.
+func (h *handler) isApprover(user user.Info) (bool, error) {
+	groups := map[string]bool{}
+	for _, group := range user.GetGroups() {
+		groups[group] = true
+	}
+	for _, group := range splitSetting(settings.AccessRequestApproverGroups.Get()) {
+		if groups[group] {
+			return true, nil
+		}
+	}
+
+	roles := map[string]bool{}
+	for _, role := range splitSetting(settings.AccessRequestApproverGlobalRoles.Get()) {
+		roles[role] = true
+	}
+	if len(roles) == 0 {
+		return false, nil
+	}
+	grbs, err := h.grbCache.List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	for _, grb := range grbs {
+		if !roles[grb.GlobalRoleName] {
+			continue
+		}
+		if grb.UserName == user.GetName() || (grb.GroupPrincipalName != "" && groups[grb.GroupPrincipalName]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// holdsRequestedAccess returns whether the user holds all permissions of the requested role template in the requested
+// cluster or project, through its global roles or its bindings in the cluster or project, so that approving a request
+// can't escalate the access of the approver.
+func (h *handler) holdsRequestedAccess(user user.Info, obj *v3.AccessRequest) (bool, error) {
+	roleTemplate, err := h.roleTemplateCache.Get(obj.Spec.RoleTemplateName)
+	if err != nil {
+		return false, err
+	}
+	requested, err := rbac.RulesFromTemplate(h.clusterRoleCache, h.roleTemplateCache, roleTemplate)
+	if err != nil {
+		return false, err
+	}
+
+	groups := map[string]bool{}
+	for _, group := range user.GetGroups() {
+		groups[group] = true
+	}
+	isSubject := func(userName, groupPrincipalName string) bool {
+		return (userName != "" && userName == user.GetName()) || (groupPrincipalName != "" && groups[groupPrincipalName])
+	}
+
+	var held []rbacv1.PolicyRule
+	addRoleTemplate := func(name string) error {
+		roleTemplate, err := h.roleTemplateCache.Get(name)
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rules, err := rbac.RulesFromTemplate(h.clusterRoleCache, h.roleTemplateCache, roleTemplate)
+		held = append(held, rules...)
+		return err
+	}
+
+	grbs, err := h.grbCache.List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	for _, grb := range grbs {
+		if !isSubject(grb.UserName, grb.GroupPrincipalName) {
+			continue
+		}
+		globalRole, err := h.grCache.Get(grb.GlobalRoleName)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if rbac.IsAdminGlobalRole(globalRole) {
+			return true, nil
+		}
+		for _, name := range globalRole.InheritedClusterRoles {
+			if err := addRoleTemplate(name); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	clusterName := obj.Spec.ClusterName
+	if obj.Spec.ProjectName != "" {
+		var projectName string
+		clusterName, projectName = ref.Parse(obj.Spec.ProjectName)
+		project, err := h.projectCache.Get(clusterName, projectName)
+		if err != nil {
+			return false, err
+		}
+		namespace := project.Name
+		if project.Status.BackingNamespace != "" {
+			namespace = project.Status.BackingNamespace
+		}
+		prtbs, err := h.prtbCache.List(namespace, labels.Everything())
+		if err != nil {
+			return false, err
+		}
+		for _, prtb := range prtbs {
+			if prtb.ProjectName == obj.Spec.ProjectName && isSubject(prtb.UserName, prtb.GroupPrincipalName) {
+				if err := addRoleTemplate(prtb.RoleTemplateName); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+
+	crtbs, err := h.crtbCache.List(clusterName, labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	for _, crtb := range crtbs {
+		if isSubject(crtb.UserName, crtb.GroupPrincipalName) {
+			if err := addRoleTemplate(crtb.RoleTemplateName); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	covered, _ := rbacvalidation.Covers(held, requested)
+	return covered, nil
+}
+
+func splitSetting(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,167 @@
+package accessrequests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func newHandler(t *testing.T) (*handler, *fake.MockNonNamespacedClientInterface[*v3.AccessRequest, *v3.AccessRequestList]) {
+	ctrl := gomock.NewController(t)
+	accessRequests := fake.NewMockNonNamespacedClientInterface[*v3.AccessRequest, *v3.AccessRequestList](ctrl)
+	grbCache := fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRoleBinding](ctrl)
+	grbCache.EXPECT().List(gomock.Any()).Return([]*v3.GlobalRoleBinding{
+		{UserName: "u-admin", GlobalRoleName: "admin"},
+		{UserName: "u-bob", GlobalRoleName: "user"},
+		{UserName: "u-dave", GlobalRoleName: "approver"},
+		{UserName: "u-erin", GlobalRoleName: "approver"},
+		{GroupPrincipalName: "github_team://42", GlobalRoleName: "admin"},
+	}, nil).AnyTimes()
+
+	grCache := fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRole](ctrl)
+	grCache.EXPECT().Get("admin").Return(&v3.GlobalRole{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, Builtin: true}, nil).AnyTimes()
+	grCache.EXPECT().Get("approver").Return(&v3.GlobalRole{ObjectMeta: metav1.ObjectMeta{Name: "approver"}}, nil).AnyTimes()
+	grCache.EXPECT().Get("user").Return(&v3.GlobalRole{ObjectMeta: metav1.ObjectMeta{Name: "user"}, Builtin: true}, nil).AnyTimes()
+	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl)
+	roleTemplateCache.EXPECT().Get("cluster-owner").Return(&v3.RoleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-owner"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+	}, nil).AnyTimes()
+	roleTemplateCache.EXPECT().Get("nodes-view").Return(&v3.RoleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodes-view"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"management.cattle.io"}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch"}}},
+	}, nil).AnyTimes()
+	crtbCache := fake.NewMockCacheInterface[*v3.ClusterRoleTemplateBinding](ctrl)
+	crtbCache.EXPECT().List("c-12345", gomock.Any()).Return([]*v3.ClusterRoleTemplateBinding{
+		{UserName: "u-dave", RoleTemplateName: "nodes-view"},
+		{UserName: "u-erin", RoleTemplateName: "cluster-owner"},
+	}, nil).AnyTimes()
+
+	return &handler{
+		accessRequests:    accessRequests,
+		grbCache:          grbCache,
+		grCache:           grCache,
+		roleTemplateCache: roleTemplateCache,
+		crtbCache:         crtbCache,
+		now:               func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) },
+	}, accessRequests
+}
+
+func assertAPIError(t *testing.T, err error, code validation.ErrorCode) {
+	t.Helper()
+	var apiErr *apierror.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, code, apiErr.Code)
+}
+
+func TestRequest(t *testing.T) {
+	h, accessRequests := newHandler(t)
+
+	accessRequests.EXPECT().Create(gomock.Any()).DoAndReturn(func(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+		return obj, nil
+	})
+	obj, err := h.request(&user.DefaultInfo{Name: "u-alice"}, strings.NewReader(
+		`{"userName":"u-bob","roleTemplateName":"cluster-owner","clusterName":"c-12345","justification":"incident 42","duration":"2h"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "u-alice", obj.Spec.UserName, "expected the request to be made for the requesting user")
+	assert.Equal(t, 2*time.Hour, obj.Spec.Duration.Duration)
+
+	_, err = h.request(&user.DefaultInfo{Name: "u-alice"}, strings.NewReader(`{"roleTemplateName":"cluster-owner","clusterName":"c-12345","duration":"2h"}`))
+	assertAPIError(t, err, validation.InvalidBodyContent)
+
+	_, err = h.request(&user.DefaultInfo{Name: "u-alice"}, strings.NewReader(`{"roleTemplateName":"cluster-owner","clusterName":"c-12345","justification":"x","duration":"soon"}`))
+	assertAPIError(t, err, validation.InvalidFormat)
+}
+
+func TestReview(t *testing.T) {
+	pending := &v3.AccessRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "ar-abcde"},
+		Spec:       v3.AccessRequestSpec{UserName: "u-alice", RoleTemplateName: "cluster-owner", ClusterName: "c-12345"},
+		Status:     v3.AccessRequestStatus{State: v3.AccessRequestStatePending},
+	}
+
+	t.Run("approve", func(t *testing.T) {
+		h, accessRequests := newHandler(t)
+		accessRequests.EXPECT().Get("ar-abcde", gomock.Any()).Return(pending, nil)
+		accessRequests.EXPECT().UpdateStatus(gomock.Any()).DoAndReturn(func(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+			return obj, nil
+		})
+
+		obj, err := h.review(&user.DefaultInfo{Name: "u-admin"}, "ar-abcde", strings.NewReader(`{"comment":"ok"}`), true)
+		require.NoError(t, err)
+		assert.Equal(t, v3.AccessRequestStateApproved, obj.Status.State)
+		assert.Equal(t, "u-admin", obj.Status.ReviewerName)
+		assert.Equal(t, "ok", obj.Status.ReviewComment)
+		assert.NotNil(t, obj.Status.ReviewedAt)
+	})
+
+	t.Run("deny through an approver group", func(t *testing.T) {
+		h, accessRequests := newHandler(t)
+		accessRequests.EXPECT().Get("ar-abcde", gomock.Any()).Return(pending, nil)
+		accessRequests.EXPECT().UpdateStatus(gomock.Any()).DoAndReturn(func(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+			return obj, nil
+		})
+
+		obj, err := h.review(&user.DefaultInfo{Name: "u-carol", Groups: []string{"github_team://42"}}, "ar-abcde", strings.NewReader(""), false)
+		require.NoError(t, err)
+		assert.Equal(t, v3.AccessRequestStateDenied, obj.Status.State)
+	})
+
+	t.Run("non approvers can't review", func(t *testing.T) {
+		h, _ := newHandler(t)
+		_, err := h.review(&user.DefaultInfo{Name: "u-bob"}, "ar-abcde", strings.NewReader(""), true)
+		assertAPIError(t, err, validation.PermissionDenied)
+	})
+
+	t.Run("approvers can only grant access they hold", func(t *testing.T) {
+		settings.AccessRequestApproverGlobalRoles.Set("admin,approver")
+		defer settings.AccessRequestApproverGlobalRoles.Set(settings.AccessRequestApproverGlobalRoles.Default)
+
+		h, accessRequests := newHandler(t)
+		accessRequests.EXPECT().Get("ar-abcde", gomock.Any()).Return(pending, nil).Times(3)
+		accessRequests.EXPECT().UpdateStatus(gomock.Any()).DoAndReturn(func(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+			return obj, nil
+		}).Times(2)
+
+		_, err := h.review(&user.DefaultInfo{Name: "u-dave"}, "ar-abcde", strings.NewReader(""), true)
+		assertAPIError(t, err, validation.PermissionDenied)
+
+		obj, err := h.review(&user.DefaultInfo{Name: "u-dave"}, "ar-abcde", strings.NewReader(""), false)
+		require.NoError(t, err)
+		assert.Equal(t, v3.AccessRequestStateDenied, obj.Status.State, "expected approvers to be able to deny any request")
+
+		obj, err = h.review(&user.DefaultInfo{Name: "u-erin"}, "ar-abcde", strings.NewReader(""), true)
+		require.NoError(t, err)
+		assert.Equal(t, v3.AccessRequestStateApproved, obj.Status.State)
+	})
+
+	t.Run("requesters can't review their own requests", func(t *testing.T) {
+		h, accessRequests := newHandler(t)
+		own := pending.DeepCopy()
+		own.Spec.UserName = "u-admin"
+		accessRequests.EXPECT().Get("ar-abcde", gomock.Any()).Return(own, nil)
+		_, err := h.review(&user.DefaultInfo{Name: "u-admin"}, "ar-abcde", strings.NewReader(""), true)
+		assertAPIError(t, err, validation.PermissionDenied)
+	})
+
+	t.Run("only pending requests can be reviewed", func(t *testing.T) {
+		h, accessRequests := newHandler(t)
+		denied := pending.DeepCopy()
+		denied.Status.State = v3.AccessRequestStateDenied
+		accessRequests.EXPECT().Get("ar-abcde", gomock.Any()).Return(denied, nil)
+		_, err := h.review(&user.DefaultInfo{Name: "u-admin"}, "ar-abcde", strings.NewReader(""), true)
+		assertAPIError(t, err, validation.InvalidState)
+	})
+}
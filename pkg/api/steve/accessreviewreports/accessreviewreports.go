@@ -0,0 +1,89 @@
+// Package accessreviewreports adds the links to download AccessReviewReports as CSV or JSON to the
+// AccessReviewReport schema of the Steve API.
+package accessreviewreports
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	"github.com/rancher/apiserver/pkg/types"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/accessreview"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/wrangler"
+	schema2 "github.com/rancher/steve/pkg/schema"
+	steve "github.com/rancher/steve/pkg/server"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	csvLink  = "csv"
+	jsonLink = "json"
+)
+
+type handler struct {
+	reports mgmtcontrollers.AccessReviewReportClient
+	secrets corecontrollers.SecretClient
+}
+
+// Register adds the download links to the Steve API.
+func Register(server *steve.Server, wContext *wrangler.Context) {
+	h := &handler{
+		reports: wContext.Mgmt.AccessReviewReport(),
+		secrets: wContext.Core.Secret(),
+	}
+
+	server.SchemaFactory.AddTemplate(schema2.Template{
+		Group: v3.SchemeGroupVersion.Group,
+		Kind:  "AccessReviewReport",
+		Customize: func(schema *types.APISchema) {
+			schema.LinkHandlers = map[string]http.Handler{
+				csvLink:  h,
+				jsonLink: h,
+			}
+		},
+	})
+}
+
+// ServeHTTP serves the links of a report. Links are served once the requesting user is allowed to get the report.
+func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	apiRequest := types.GetAPIContext(req.Context())
+
+	report, err := h.reports.Get(apiRequest.Name, metav1.GetOptions{})
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+	content, err := accessreview.LoadContent(h.secrets, report)
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	switch apiRequest.Link {
+	case csvLink:
+		rw.Header().Set("Content-Type", "text/csv")
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Name+".csv"))
+		err = accessreview.WriteCSV(rw, content)
+	case jsonLink:
+		report.ManagedFields = nil
+		report.APIVersion, report.Kind = v3.SchemeGroupVersion.WithKind("AccessReviewReport").ToAPIVersionAndKind()
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Name+".json"))
+		encoder := json.NewEncoder(rw)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(struct {
+			*v3.AccessReviewReport
+			*v3.AccessReviewReportContent
+		}{report, content})
+	default:
+		err = apierror.NewAPIError(validation.NotFound, "invalid link "+apiRequest.Link)
+	}
+	if err != nil {
+		apiRequest.WriteError(err)
+	}
+}
@@ -3,6 +3,7 @@
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	gmux "github.com/gorilla/mux"
 	"github.com/rancher/rancher/pkg/api/steve/aggregation"
@@ -15,6 +16,7 @@
 	"github.com/rancher/rancher/pkg/capr/installer"
 	"github.com/rancher/rancher/pkg/features"
 	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/tunnelserver"
 	"github.com/rancher/rancher/pkg/wrangler"
 	steve "github.com/rancher/steve/pkg/server"
 )
@@ -63,6 +65,13 @@ func AdditionalAPIs(ctx context.Context, config *wrangler.Context, steve *steve.
 	mux.Handle("/v3/connect", Tunnel(config))
 
 	health.Register(mux)
+	health.AddReadyzChecks(
+		health.CacheSyncCheck(config.ControllerFactory),
+		health.PeerCheck(config.PeerManager),
+		health.TunnelCheck(config.TunnelServer, config.Mgmt.Cluster().Cache()),
+		health.CatalogCheck(config.Catalog.ClusterRepo().Cache()),
+		health.WebhookCheck(config.K8s),
+	)
 
 	return func(next http.Handler) http.Handler {
 		mux.NotFoundHandler = clusterAPI(next)
@@ -73,5 +82,19 @@ func AdditionalAPIs(ctx context.Context, config *wrangler.Context, steve *steve.
 func Tunnel(config *wrangler.Context) http.Handler {
 	config.TunnelAuthorizer.Add(proxy.NewAuthorizer(config))
 	config.TunnelAuthorizer.Add(aggregation.New(config))
-	return config.TunnelServer
+	return tunnelserver.NewSessionMetricsHandler(config.TunnelServer, tunnelCluster)
+}
+
+// tunnelCluster returns the name of the cluster of the agent connecting with the client key, which is prefixed when
+// connecting the Steve API of the cluster and suffixed with the node when connecting a node agent. Sessions of
+// aggregated API services don't belong to a cluster.
+func tunnelCluster(clientKey string) string {
+	if cluster, ok := strings.CutPrefix(clientKey, proxy.Prefix); ok {
+		return cluster
+	}
+	if strings.HasPrefix(clientKey, "stv-") {
+		return ""
+	}
+	cluster, _, _ := strings.Cut(clientKey, ":")
+	return cluster
 }
@@ -13,6 +13,7 @@
 	"github.com/rancher/rancher/pkg/clusterrouter"
 	normanv3 "github.com/rancher/rancher/pkg/schemas/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/shellrecording"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/rancher/rancher/pkg/wrangler"
 	"github.com/rancher/steve/pkg/podimpersonation"
@@ -33,6 +34,7 @@ func Register(ctx context.Context, server *steve.Server, wrangler *wrangler.Cont
 		namespace:       "cattle-system",
 		impersonator:    podimpersonation.New("shell", server.ClientFactory, time.Hour, settings.FullShellImage),
 		clusterRegistry: server.ClusterRegistry,
+		recorder:        shellrecording.NewRecorder(wrangler),
 	}
 	sc, err := config.NewScaledContext(*wrangler.RESTConfig, nil)
 	if err != nil {
@@ -7,7 +7,9 @@
 	"strings"
 	"time"
 
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/shellrecording"
 	"github.com/rancher/steve/pkg/podimpersonation"
 	"github.com/rancher/steve/pkg/stores/proxy"
 	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
@@ -25,6 +27,7 @@ type shell struct {
 	impersonator    *podimpersonation.PodImpersonation
 	cg              proxy.ClientGetter
 	clusterRegistry string
+	recorder        *shellrecording.Recorder
 }
 
 func (s *shell) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -53,7 +56,17 @@ func (s *shell) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		defer cancel()
 		_ = client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
 	}()
-	s.proxyRequest(rw, req, pod, client)
+
+	recording, err := s.recorder.Start(req, shellrecording.Options{
+		Type:        v3.ShellRecordingTypeClusterShell,
+		ClusterName: "local",
+	})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer recording.Close()
+	s.proxyRequest(shellrecording.RecordExec(rw, recording), req, pod, client)
 }
 
 func (s *shell) proxyRequest(rw http.ResponseWriter, req *http.Request, pod *v1.Pod, client kubernetes.Interface) {
@@ -0,0 +1,165 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/rancher/pkg/api/steve/proxy"
+	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/peermanager"
+	"github.com/rancher/remotedialer"
+	"github.com/rancher/wrangler/v3/pkg/condition"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	webhookNamespace = "cattle-system"
+	webhookService   = "rancher-webhook"
+	webhookTimeout   = 5 * time.Second
+
+	// defaultRepoRefreshInterval is the refresh interval of ClusterRepos that don't set one.
+	defaultRepoRefreshInterval = time.Hour
+)
+
+// CacheSyncCheck fails until the caches of the controllers have been started and synced.
+func CacheSyncCheck(factory controller.SharedControllerFactory) Check {
+	return NamedCheck("informer-sync", func(req *http.Request) (string, error) {
+		// The context is done so that the sync state is returned without waiting.
+		ctx, cancel := context.WithCancel(req.Context())
+		cancel()
+		synced := factory.SharedCacheFactory().WaitForCacheSync(ctx)
+		if len(synced) == 0 {
+			return "", fmt.Errorf("no caches started")
+		}
+
+		var pending []string
+		for gvk, ok := range synced {
+			if !ok {
+				pending = append(pending, gvk.String())
+			}
+		}
+		if len(pending) > 0 {
+			sort.Strings(pending)
+			return "", fmt.Errorf("%d of %d caches not synced: %s", len(pending), len(synced), strings.Join(pending, ", "))
+		}
+		return fmt.Sprintf("%d caches synced", len(synced)), nil
+	})
+}
+
+// PeerCheck reports whether this replica is the leader and how many peers it has. It never fails,
+// since peers only become ready once they pass their readiness checks.
+func PeerCheck(peers peermanager.PeerManager) Check {
+	return NamedCheck("leader-election", func(_ *http.Request) (string, error) {
+		if peers == nil {
+			return "single server mode", nil
+		}
+		state := peers.Peers()
+		role := "follower"
+		if state.Leader {
+			role = "leader"
+		}
+		return fmt.Sprintf("%s with %d peers", role, len(state.IDs)), nil
+	})
+}
+
+// TunnelCheck reports how many downstream clusters are connected through the tunnel of their agent, to this replica
+// or one of its peers. It never fails, since downstream clusters don't affect the readiness of Rancher.
+func TunnelCheck(server *remotedialer.Server, clusters mgmtcontrollers.ClusterCache) Check {
+	return NamedCheck("tunnel", func(_ *http.Request) (string, error) {
+		list, err := clusters.List(labels.Everything())
+		if err != nil {
+			return "", err
+		}
+		var downstream, connected int
+		for _, cluster := range list {
+			if cluster.Spec.Internal {
+				continue
+			}
+			downstream++
+			if server.HasSession(proxy.Prefix + cluster.Name) {
+				connected++
+			}
+		}
+		return fmt.Sprintf("%d of %d downstream clusters connected", connected, downstream), nil
+	})
+}
+
+// ClusterControllersCheck reports how many clusters have their controllers running in this replica and how many
+// are still starting, as returned by counts. It never fails, since clusters are reassigned if this replica
+// can't start their controllers.
+func ClusterControllersCheck(counts func() (running, starting int)) Check {
+	return NamedCheck("cluster-controllers", func(_ *http.Request) (string, error) {
+		running, starting := counts()
+		return fmt.Sprintf("%d running, %d starting", running, starting), nil
+	})
+}
+
+// CatalogCheck reports the enabled ClusterRepos whose index failed to download or hasn't been refreshed for twice its
+// refresh interval. It never fails, since repositories are often external and unreachable from air-gapped or
+// restricted networks, which doesn't keep Rancher from serving requests.
+func CatalogCheck(repos catalogcontrollers.ClusterRepoCache) Check {
+	return NamedCheck("catalog-index", func(_ *http.Request) (string, error) {
+		list, err := repos.List(labels.Everything())
+		if err != nil {
+			return "", err
+		}
+
+		var enabled int
+		var failed, stale []string
+		for _, repo := range list {
+			if repo.Spec.Enabled != nil && !*repo.Spec.Enabled {
+				continue
+			}
+			enabled++
+			if condition.Cond(catalog.RepoDownloaded).IsFalse(repo) || condition.Cond(catalog.OCIDownloaded).IsFalse(repo) {
+				failed = append(failed, repo.Name)
+				continue
+			}
+			interval := defaultRepoRefreshInterval
+			if repo.Spec.RefreshInterval > 0 {
+				interval = time.Duration(repo.Spec.RefreshInterval) * time.Second
+			}
+			if !repo.Status.DownloadTime.IsZero() && time.Since(repo.Status.DownloadTime.Time) > 2*interval {
+				stale = append(stale, repo.Name)
+			}
+		}
+
+		if len(failed) > 0 || len(stale) > 0 {
+			sort.Strings(failed)
+			sort.Strings(stale)
+			return fmt.Sprintf("%d repositories, failed to download: [%s], stale: [%s]", enabled, strings.Join(failed, ", "), strings.Join(stale, ", ")), nil
+		}
+		return fmt.Sprintf("%d repositories up to date", enabled), nil
+	})
+}
+
+// WebhookCheck reports whether the rancher-webhook is installed and its health endpoint can be reached through its
+// service. It never fails, since Rancher deploys the webhook itself once ready, and the webhook is restarted by its
+// own probes.
+func WebhookCheck(k8s kubernetes.Interface) Check {
+	return NamedCheck("webhook", func(req *http.Request) (string, error) {
+		ctx, cancel := context.WithTimeout(req.Context(), webhookTimeout)
+		defer cancel()
+
+		if _, err := k8s.CoreV1().Services(webhookNamespace).Get(ctx, webhookService, metav1.GetOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "not installed", nil
+			}
+			return fmt.Sprintf("unknown: %v", err), nil
+		}
+		if _, err := k8s.CoreV1().Services(webhookNamespace).ProxyGet("https", webhookService, "443", "/healthz", nil).DoRaw(ctx); err != nil {
+			return fmt.Sprintf("unreachable: %v", err), nil
+		}
+		return "reachable", nil
+	})
+}
@@ -0,0 +1,43 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/rancher/wrangler/v3/pkg/genericcondition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCatalogCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repos := fake.NewMockNonNamespacedCacheInterface[*catalog.ClusterRepo](ctrl)
+	repos.EXPECT().List(gomock.Any()).Return([]*catalog.ClusterRepo{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "rancher-charts"},
+			Status:     catalog.RepoStatus{DownloadTime: metav1.NewTime(time.Now())},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "partner"},
+			Status: catalog.RepoStatus{Conditions: []genericcondition.GenericCondition{
+				{Type: string(catalog.RepoDownloaded), Status: corev1.ConditionFalse},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "stale"},
+			Status:     catalog.RepoStatus{DownloadTime: metav1.NewTime(time.Now().Add(-3 * defaultRepoRefreshInterval))},
+		},
+	}, nil)
+
+	// Unreachable repositories are reported, but don't make Rancher unready.
+	summary, err := CatalogCheck(repos).Check(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "3 repositories, failed to download: [partner], stale: [stale]", summary)
+}
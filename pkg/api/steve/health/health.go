@@ -10,6 +10,8 @@
 func Register(router *mux.Router) {
 	healthz.InstallHandler((*muxWrapper)(router))
 	router.Handle("/ping", Pong())
+	router.HandleFunc("/readyz", readyzHandler)
+	router.HandleFunc("/readyz/{check}", readyzHandler)
 }
 
 func Pong() http.Handler {
@@ -0,0 +1,146 @@
+package health
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Check is a named readiness check of a Rancher subsystem.
+type Check interface {
+	// Name is the name of the check, used in the output of /readyz, to exclude it and as the path of its own endpoint.
+	Name() string
+	// Check returns a short summary of the state of the subsystem shown in verbose output,
+	// or an error if the subsystem isn't ready.
+	Check(req *http.Request) (string, error)
+}
+
+type namedCheck struct {
+	name  string
+	check func(req *http.Request) (string, error)
+}
+
+func (c *namedCheck) Name() string {
+	return c.name
+}
+
+func (c *namedCheck) Check(req *http.Request) (string, error) {
+	return c.check(req)
+}
+
+// NamedCheck returns a Check with the given name running check.
+func NamedCheck(name string, check func(req *http.Request) (string, error)) Check {
+	return &namedCheck{name: name, check: check}
+}
+
+var readyzChecks = &checks{}
+
+type checks struct {
+	sync.RWMutex
+	checks []Check
+}
+
+func (c *checks) add(checks ...Check) {
+	c.Lock()
+	defer c.Unlock()
+	c.checks = append(c.checks, checks...)
+}
+
+func (c *checks) list() []Check {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]Check(nil), c.checks...)
+}
+
+// AddReadyzChecks adds checks to /readyz. Checks can be added once the endpoint is installed,
+// e.g. by subsystems that start later.
+func AddReadyzChecks(checks ...Check) {
+	readyzChecks.add(checks...)
+}
+
+// readyzHandler serves /readyz like the Kubernetes apiserver. All checks must pass for the endpoint to succeed.
+// The verbose query parameter lists the result of every check along with its summary, the exclude query parameter,
+// which can be repeated, skips a check. Reasons of failures are logged rather than returned, except by the
+// endpoint of a single check, /readyz/<name>.
+func readyzHandler(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+
+	checks := readyzChecks.list()
+	if name := mux.Vars(req)["check"]; name != "" {
+		for _, check := range checks {
+			if check.Name() != name {
+				continue
+			}
+			if _, err := check.Check(req); err != nil {
+				http.Error(rw, fmt.Sprintf("internal server error: %v", err), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(rw, "ok")
+			return
+		}
+		http.NotFound(rw, req)
+		return
+	}
+
+	excluded := sets.New[string]()
+	for _, names := range req.URL.Query()["exclude"] {
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				excluded.Insert(name)
+			}
+		}
+	}
+
+	var output bytes.Buffer
+	var failed []string
+	for _, check := range checks {
+		name := check.Name()
+		if excluded.Has(name) {
+			excluded.Delete(name)
+			fmt.Fprintf(&output, "[+]%s excluded: ok\n", name)
+			continue
+		}
+		summary, err := check.Check(req)
+		if err != nil {
+			logrus.Infof("readyz check %s failed: %v", name, err)
+			fmt.Fprintf(&output, "[-]%s failed: reason withheld\n", name)
+			failed = append(failed, name)
+			continue
+		}
+		if summary != "" {
+			fmt.Fprintf(&output, "[+]%s ok: %s\n", name, summary)
+		} else {
+			fmt.Fprintf(&output, "[+]%s ok\n", name)
+		}
+	}
+	if excluded.Len() > 0 {
+		fmt.Fprintf(&output, "warn: some health checks cannot be excluded: no matches for %s\n", formatQuoted(sets.List(excluded)))
+	}
+
+	if len(failed) > 0 {
+		logrus.Infof("readyz check failed: %s", strings.Join(failed, ","))
+		http.Error(rw, output.String()+"readyz check failed", http.StatusInternalServerError)
+		return
+	}
+	if _, verbose := req.URL.Query()["verbose"]; !verbose {
+		fmt.Fprint(rw, "ok")
+		return
+	}
+	output.WriteString("readyz check passed\n")
+	output.WriteTo(rw)
+}
+
+func formatQuoted(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("%q", name))
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func setChecks(t *testing.T, list ...Check) {
+	t.Helper()
+	previous := readyzChecks
+	readyzChecks = &checks{}
+	readyzChecks.add(list...)
+	t.Cleanup(func() {
+		readyzChecks = previous
+	})
+}
+
+func passing(name, summary string) Check {
+	return NamedCheck(name, func(_ *http.Request) (string, error) {
+		return summary, nil
+	})
+}
+
+func failing(name string) Check {
+	return NamedCheck(name, func(_ *http.Request) (string, error) {
+		return "", fmt.Errorf("%s is broken", name)
+	})
+}
+
+func serve(path string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	Register(router)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestReadyz(t *testing.T) {
+	setChecks(t, passing("informer-sync", "12 caches synced"), passing("webhook", ""))
+
+	rec := serve("/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+
+	rec = serve("/readyz?verbose")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[+]informer-sync ok: 12 caches synced\n[+]webhook ok\nreadyz check passed\n", rec.Body.String())
+}
+
+func TestReadyzFailure(t *testing.T) {
+	setChecks(t, passing("informer-sync", "12 caches synced"), failing("catalog-index"))
+
+	rec := serve("/readyz")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "[+]informer-sync ok: 12 caches synced\n[-]catalog-index failed: reason withheld\nreadyz check failed\n", rec.Body.String())
+
+	rec = serve("/readyz?exclude=catalog-index&exclude=tunnel,other&verbose")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[+]informer-sync ok: 12 caches synced\n"+
+		"[+]catalog-index excluded: ok\n"+
+		"warn: some health checks cannot be excluded: no matches for \"other\",\"tunnel\"\n"+
+		"readyz check passed\n", rec.Body.String())
+}
+
+func TestReadyzSingleCheck(t *testing.T) {
+	setChecks(t, passing("informer-sync", "12 caches synced"), failing("catalog-index"))
+
+	rec := serve("/readyz/informer-sync")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+
+	rec = serve("/readyz/catalog-index")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "internal server error: catalog-index is broken\n", rec.Body.String())
+
+	rec = serve("/readyz/unknown")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -5,6 +5,7 @@
 
 	"github.com/rancher/apiserver/pkg/types"
 	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/rancher/pkg/shellrecording"
 	"github.com/rancher/rancher/pkg/wrangler"
 	schema2 "github.com/rancher/steve/pkg/schema"
 	steve "github.com/rancher/steve/pkg/server"
@@ -14,6 +15,7 @@ func Register(server *steve.Server, clients *wrangler.Context) {
 	sshClient := &sshClient{
 		machines: clients.CAPI.Machine(),
 		secrets:  clients.Core.Secret(),
+		recorder: shellrecording.NewRecorder(clients),
 	}
 
 	server.SchemaFactory.AddTemplate(schema2.Template{
@@ -16,8 +16,10 @@
 
 	"github.com/gorilla/websocket"
 	"github.com/rancher/apiserver/pkg/types"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/capr"
 	capicontrollers "github.com/rancher/rancher/pkg/generated/controllers/cluster.x-k8s.io/v1beta1"
+	"github.com/rancher/rancher/pkg/shellrecording"
 	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
 	"golang.org/x/crypto/ssh"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -26,6 +28,7 @@
 type sshClient struct {
 	secrets  corecontrollers.SecretClient
 	machines capicontrollers.MachineClient
+	recorder *shellrecording.Recorder
 }
 
 var upgrader = websocket.Upgrader{
@@ -77,6 +80,18 @@ func (s *sshClient) shell(apiRequest *types.APIRequest) error {
 		return err
 	}
 
+	recording, err := s.recorder.Start(req, shellrecording.Options{
+		Type:        v3.ShellRecordingTypeMachineSSH,
+		ClusterName: machineInfo.ClusterName,
+		Target:      apiRequest.Namespace + "/" + apiRequest.Name,
+		Width:       80,
+		Height:      20,
+	})
+	if err != nil {
+		return err
+	}
+	defer recording.Close()
+
 	signer, err := ssh.ParsePrivateKey(machineInfo.IDRSA)
 	if err != nil {
 		return err
@@ -121,7 +136,7 @@ func (s *sshClient) shell(apiRequest *types.APIRequest) error {
 	go func() {
 		defer cancel()
 		defer conn.Close()
-		io.Copy(&writer{conn: conn}, stdOut)
+		io.Copy(&writer{conn: conn, recording: recording}, stdOut)
 	}()
 
 	for {
@@ -138,6 +153,7 @@ func (s *sshClient) shell(apiRequest *types.APIRequest) error {
 			if err != nil {
 				return err
 			}
+			recording.Input(data)
 			if _, err := stdIn.Write(data); err != nil {
 				return err
 			}
@@ -150,6 +166,7 @@ func (s *sshClient) shell(apiRequest *types.APIRequest) error {
 			if err := json.Unmarshal(data, resize); err != nil {
 				return err
 			}
+			recording.Resize(resize.Width, resize.Height)
 			if err := session.WindowChange(resize.Height, resize.Width); err != nil {
 				return err
 			}
@@ -163,9 +180,10 @@ type resizeRequest struct {
 }
 
 type machineInfo struct {
-	IDRSA    []byte
-	IDRSAPub []byte
-	Driver   machineConfig
+	IDRSA       []byte
+	IDRSAPub    []byte
+	Driver      machineConfig
+	ClusterName string `json:"-"`
 }
 
 type machineConfig struct {
@@ -176,11 +194,11 @@ type machineConfig struct {
 }
 
 func (s *sshClient) getSSHKey(machineNamespace, machineName string) (*machineInfo, error) {
-	result := &machineInfo{}
 	machine, err := s.machines.Get(machineNamespace, machineName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
+	result := &machineInfo{ClusterName: machine.Spec.ClusterName}
 
 	secretName := capr.MachineStateSecretName(machine.Spec.InfrastructureRef.Name)
 	secret, err := s.secrets.Get(machineNamespace, secretName, metav1.GetOptions{})
@@ -224,7 +242,8 @@ func (s *sshClient) getSSHKey(machineNamespace, machineName string) (*machineInf
 }
 
 type writer struct {
-	conn *websocket.Conn
+	conn      *websocket.Conn
+	recording *shellrecording.Session
 }
 
 func (w *writer) Write(buf []byte) (int, error) {
@@ -236,5 +255,6 @@ func (w *writer) Write(buf []byte) (int, error) {
 	if _, err := m.Write(data); err != nil {
 		return 0, err
 	}
+	w.recording.Output(buf)
 	return len(buf), m.Close()
 }
@@ -10,13 +10,17 @@
 
 	gmux "github.com/gorilla/mux"
 	"github.com/rancher/rancher/pkg/api/steve/disallow"
+	apiv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
 	managementv3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/shellrecording"
+	"github.com/rancher/rancher/pkg/tracing"
 	"github.com/rancher/remotedialer"
 	"github.com/rancher/steve/pkg/auth"
 	"github.com/rancher/steve/pkg/proxy"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	authzv1 "k8s.io/api/authorization/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/authentication/user"
@@ -51,7 +55,8 @@ func NewProxyMiddleware(sar v1.AuthorizationV1Interface,
 	dialerFactory ClusterDialerFactory,
 	clusters v3.ClusterCache,
 	localSupport bool,
-	localCluster http.Handler) (func(http.Handler) http.Handler, error) {
+	localCluster http.Handler,
+	recorder *shellrecording.Recorder) (func(http.Handler) http.Handler, error) {
 	cfg := authorizerfactory.DelegatingAuthorizerConfig{
 		SubjectAccessReviewClient: sar,
 		AllowCacheTTL:             time.Second * time.Duration(settings.AuthorizationCacheTTLSeconds.GetInt()),
@@ -69,9 +74,9 @@ func NewProxyMiddleware(sar v1.AuthorizationV1Interface,
 	mux := gmux.NewRouter()
 	mux.UseEncodedPath()
 	mux.PathPrefix("/api").MatcherFunc(proxyHandler.matchManagementCRDs()).HandlerFunc(proxyHandler.authLocalCluster(mux))
-	mux.Path("/v1/management.cattle.io.clusters/{clusterID}").Queries("link", "shell").HandlerFunc(routeToShellProxy("link", "shell", localSupport, localCluster, mux, proxyHandler))
-	mux.Path("/v1/management.cattle.io.clusters/{clusterID}").Queries("action", "apply").HandlerFunc(routeToShellProxy("action", "apply", localSupport, localCluster, mux, proxyHandler))
-	mux.Path("/v3/clusters/{clusterID}").Queries("shell", "true").HandlerFunc(routeToShellProxy("link", "shell", localSupport, localCluster, mux, proxyHandler))
+	mux.Path("/v1/management.cattle.io.clusters/{clusterID}").Queries("link", "shell").HandlerFunc(routeToShellProxy("link", "shell", localSupport, localCluster, mux, proxyHandler, recorder))
+	mux.Path("/v1/management.cattle.io.clusters/{clusterID}").Queries("action", "apply").HandlerFunc(routeToShellProxy("action", "apply", localSupport, localCluster, mux, proxyHandler, nil))
+	mux.Path("/v3/clusters/{clusterID}").Queries("shell", "true").HandlerFunc(routeToShellProxy("link", "shell", localSupport, localCluster, mux, proxyHandler, recorder))
 	mux.Path("/{prefix:k8s/clusters/[^/]+}{suffix:/v1.*}").MatcherFunc(proxyHandler.MatchNonLegacy("/k8s/clusters/")).Handler(proxyHandler)
 
 	return func(handler http.Handler) http.Handler {
@@ -82,7 +87,9 @@ func NewProxyMiddleware(sar v1.AuthorizationV1Interface,
 	}, nil
 }
 
-func routeToShellProxy(key, value string, localSupport bool, localCluster http.Handler, mux *gmux.Router, proxyHandler *Handler) func(rw http.ResponseWriter, r *http.Request) {
+// routeToShellProxy routes shell requests to the cluster. Shells of downstream clusters are recorded by recorder, if
+// not nil, while the local cluster records its own.
+func routeToShellProxy(key, value string, localSupport bool, localCluster http.Handler, mux *gmux.Router, proxyHandler *Handler, recorder *shellrecording.Recorder) func(rw http.ResponseWriter, r *http.Request) {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		vars := gmux.Vars(r)
 		cluster := vars["clusterID"]
@@ -109,7 +116,23 @@ func routeToShellProxy(key, value string, localSupport bool, localCluster http.H
 		q.Set(key, value)
 		r.URL.RawQuery = q.Encode()
 		r.URL.Path = "/k8s/clusters/" + cluster + "/v1/management.cattle.io.clusters/local"
-		proxyHandler.ServeHTTP(rw, r)
+
+		// the access is checked again by the proxy handler, it is checked first so that no recording is started for
+		// requests that are denied
+		if !proxyHandler.userCanAccessCluster(r, cluster) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		recording, err := recorder.Start(r, shellrecording.Options{
+			Type:        apiv3.ShellRecordingTypeClusterShell,
+			ClusterName: cluster,
+		})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer recording.Close()
+		proxyHandler.ServeHTTP(shellrecording.RecordExec(rw, recording), r)
 	}
 }
 
@@ -168,14 +191,17 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	prefix := "/" + gmux.Vars(req)["prefix"]
+	ctx, span := tracing.Start(req.Context(), "route cluster", tracing.ClusterKey.String(clusterID))
 	handler, err := h.next(clusterID, prefix)
 	if err != nil {
+		tracing.End(span, err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		rw.Write([]byte(err.Error()))
 		return
 	}
+	defer span.End()
 
-	handler.ServeHTTP(rw, req)
+	handler.ServeHTTP(rw, req.WithContext(ctx))
 }
 
 func (h *Handler) userCanAccessCluster(req *http.Request, clusterID string) bool {
@@ -218,9 +244,9 @@ func (h *Handler) next(clusterID, prefix string) (http.Handler, error) {
 		// connect
 		Host:      "http://" + clusterID,
 		UserAgent: rest.DefaultKubernetesUserAgent() + " cluster " + clusterID,
-		Transport: &http.Transport{
+		Transport: tracing.Transport(&http.Transport{
 			DialContext: h.dialer,
-		},
+		}, clusterID),
 	}
 
 	next := proxy.ImpersonatingHandler(prefix, cfg)
@@ -236,7 +262,9 @@ func (h *Handler) canAccess(ctx context.Context, user user.Info, clusterID strin
 		extra[k] = v
 	}
 
-	resp, _, err := h.authorizer.Authorize(ctx, authorizer.AttributesRecord{
+	// Decisions are cached by the authorizer, SubjectAccessReviews are only created on cache misses.
+	ctx, span := tracing.Start(ctx, "authorize", tracing.ClusterKey.String(clusterID), tracing.UserKey.String(user.GetName()))
+	resp, reason, err := h.authorizer.Authorize(ctx, authorizer.AttributesRecord{
 		ResourceRequest: true,
 		User:            user,
 		Verb:            "get",
@@ -245,6 +273,8 @@ func (h *Handler) canAccess(ctx context.Context, user user.Info, clusterID strin
 		Resource:        "clusters",
 		Name:            clusterID,
 	})
+	span.SetAttributes(attribute.Bool("rancher.authorized", resp == authorizer.DecisionAllow), attribute.String("rancher.authorization_reason", reason))
+	tracing.End(span, err)
 
 	return err == nil && resp == authorizer.DecisionAllow
 }
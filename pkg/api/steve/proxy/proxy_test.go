@@ -248,7 +248,7 @@ func TestLocalCluster(t *testing.T) {
 			assert.NoError(t, err, "error when creating rest client")
 			sarWrapper := Authv1ClientInterface{Client: client}
 
-			proxyMiddleware, err := proxy.NewProxyMiddleware(&sarWrapper, defaultDialer, nil, true, &localHandler)
+			proxyMiddleware, err := proxy.NewProxyMiddleware(&sarWrapper, defaultDialer, nil, true, &localHandler, nil)
 			assert.NoError(t, err, "unable to construct proxy middleware")
 			// construct the middleware with our default handler
 			testHandler := proxyMiddleware(&responder)
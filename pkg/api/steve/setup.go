@@ -3,12 +3,15 @@
 import (
 	"context"
 
+	"github.com/rancher/rancher/pkg/api/steve/accessrequests"
+	"github.com/rancher/rancher/pkg/api/steve/accessreviewreports"
 	"github.com/rancher/rancher/pkg/api/steve/catalog"
 	"github.com/rancher/rancher/pkg/api/steve/clusters"
 	"github.com/rancher/rancher/pkg/api/steve/disallow"
 	"github.com/rancher/rancher/pkg/api/steve/machine"
 	"github.com/rancher/rancher/pkg/api/steve/navlinks"
 	"github.com/rancher/rancher/pkg/api/steve/settings"
+	"github.com/rancher/rancher/pkg/api/steve/shellrecordings"
 	"github.com/rancher/rancher/pkg/api/steve/userpreferences"
 	"github.com/rancher/rancher/pkg/wrangler"
 	steve "github.com/rancher/steve/pkg/server"
@@ -22,6 +25,9 @@ func Setup(ctx context.Context, server *steve.Server, config *wrangler.Context)
 	machine.Register(server, config)
 	navlinks.Register(ctx, server)
 	settings.Register(server)
+	accessrequests.Register(server, config)
+	accessreviewreports.Register(server, config)
+	shellrecordings.Register(server, config)
 	disallow.Register(server)
 	return catalog.Register(ctx,
 		server,
@@ -0,0 +1,75 @@
+// Package shellrecordings adds the link to replay ShellRecordings to the ShellRecording schema of the Steve API.
+package shellrecordings
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	"github.com/rancher/apiserver/pkg/types"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/shellrecording"
+	"github.com/rancher/rancher/pkg/wrangler"
+	schema2 "github.com/rancher/steve/pkg/schema"
+	steve "github.com/rancher/steve/pkg/server"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const replayLink = "replay"
+
+type handler struct {
+	recordings mgmtcontrollers.ShellRecordingClient
+	secrets    corecontrollers.SecretCache
+}
+
+// Register adds the replay link to the Steve API.
+func Register(server *steve.Server, wContext *wrangler.Context) {
+	h := &handler{
+		recordings: wContext.Mgmt.ShellRecording(),
+		secrets:    wContext.Core.Secret().Cache(),
+	}
+
+	server.SchemaFactory.AddTemplate(schema2.Template{
+		Group: v3.SchemeGroupVersion.Group,
+		Kind:  "ShellRecording",
+		Customize: func(schema *types.APISchema) {
+			schema.LinkHandlers = map[string]http.Handler{
+				replayLink: h,
+			}
+		},
+	})
+}
+
+// ServeHTTP serves the recording in asciicast v2 format, which can be played with asciinema. The link is served once
+// the requesting user is allowed to get the ShellRecording.
+func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	apiRequest := types.GetAPIContext(req.Context())
+	if apiRequest.Link != replayLink {
+		apiRequest.WriteError(apierror.NewAPIError(validation.NotFound, "invalid link "+apiRequest.Link))
+		return
+	}
+
+	recording, err := h.recordings.Get(apiRequest.Name, metav1.GetOptions{})
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	reader, err := shellrecording.Open(req.Context(), h.secrets, recording)
+	if err != nil {
+		apiRequest.WriteError(apierror.NewAPIError(validation.NotFound, fmt.Sprintf("recording of %s is unavailable: %v", recording.Name, err)))
+		return
+	}
+	defer reader.Close()
+
+	rw.Header().Set("Content-Type", "application/x-asciicast")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", recording.Name+".cast"))
+	if _, err := io.Copy(rw, reader); err != nil {
+		logrus.Warnf("Failed to replay shell recording %s: %v", recording.Name, err)
+	}
+}
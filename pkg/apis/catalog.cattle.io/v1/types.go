@@ -110,6 +110,18 @@ type RepoSpec struct {
 	// Defaults to false, which keeps the SameOrigin check enabled. Setting this to true is not recommended
 	// in production environments due to the security implications.
 	DisableSameOriginCheck bool `json:"disableSameOriginCheck,omitempty"`
+
+	// Verification if set requires the charts of the repository to be signed with one of the trusted keys.
+	// Chart versions that can't be verified can't be installed or upgraded to.
+	Verification *RepoVerification `json:"verification,omitempty"`
+}
+
+// RepoVerification is the verification policy of the charts of a Helm repository. Charts of HTTP and git repositories
+// are verified with their Helm provenance (.prov) files and charts of OCI repositories with their cosign signatures.
+type RepoVerification struct {
+	// KeysSecret is the secret holding the trusted keys. Every entry of the secret must hold either a PGP public keyring,
+	// armored or binary, to verify provenance files or PEM encoded public keys to verify cosign signatures.
+	KeysSecret SecretReference `json:"keysSecret"`
 }
 
 type RepoCondition string
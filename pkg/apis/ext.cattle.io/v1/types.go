@@ -1,24 +1,261 @@
 // +kubebuilder:skip
 package v1
 
-// This file should contain type definitions for the ext.cattle.io/v1 API group.
-// Below is an example of what it could look like. This comment can be removed once
-// types have been added to this package.
-//
-//	import (
-// 		metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-// 	)
-//
-// 	// +genclient
-// 	// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
-//
-// 	type TestType struct {
-// 		metav1.TypeMeta   `json:",inline"`
-// 		metav1.ObjectMeta `json:"metadata,omitempty"`
-//
-// 		Spec TestTypeSpec `json:"ok"`
-// 	}
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Token is a Rancher API token. It is backed by a management.cattle.io Token and can be
+// used to authenticate against Rancher and the downstream clusters it manages.
+type Token struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the desired state of the token.
+	Spec TokenSpec `json:"spec"`
+	// Status is the observed state of the token.
+	// +optional
+	Status TokenStatus `json:"status,omitempty"`
+}
+
+// TokenSpec contains the user settable fields of a token.
+type TokenSpec struct {
+	// UserID is the name of the user the token belongs to.
+	// It defaults to the user creating the token and can't be changed.
+	// +optional
+	UserID string `json:"userID,omitempty"`
+	// Description is a human readable description of the token.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// TTL is the time to live of the token in milliseconds. 0 means the token doesn't expire,
+	// unless a maximum is enforced by the auth-token-max-ttl-minutes setting.
+	// It can't be changed after the token is created.
+	// +optional
+	TTL int64 `json:"ttl,omitempty"`
+	// ClusterName is the name of the cluster the token is scoped to. An empty value means
+	// the token can be used for all clusters. It can't be changed after the token is created.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+	// Enabled indicates whether the token can be used. It defaults to true.
+	// A token disabled by an administrator can't be enabled again by its owner.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// TokenStatus contains the fields of a token computed by Rancher.
+type TokenStatus struct {
+	// Value is the bearer token. It is only returned when the token is created.
+	// +optional
+	Value string `json:"value,omitempty"`
+	// AuthProvider is the auth provider of the principal the token belongs to.
+	// +optional
+	AuthProvider string `json:"authProvider,omitempty"`
+	// UserPrincipal is the ID of the principal the token belongs to.
+	// +optional
+	UserPrincipal string `json:"userPrincipal,omitempty"`
+	// IsDerived is false for tokens created by logging in and true otherwise.
+	IsDerived bool `json:"isDerived"`
+	// Expired indicates whether the token has expired.
+	Expired bool `json:"expired"`
+	// ExpiresAt is the RFC3339 time the token expires at, empty if it doesn't expire.
+	// +optional
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// LastUsedAt is the last time the token was used to authenticate.
+	// +optional
+	LastUsedAt *metav1.Time `json:"lastUsedAt,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:onlyVerbs=create
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PermissionReview answers who can do what, where. Like a SubjectAccessReview, it is only created:
+// Rancher fills in its status and doesn't store it.
 //
-// 	type TestTypeSpec struct {
-// 		Enabled bool `json:"enabled"`
-// 	}
+// A review of a user or group principal returns the effective global roles, role templates and
+// policy rules of the principal in every cluster and project. A review of resource attributes returns
+// the principals that can perform the verb on the resource in the cluster.
+type PermissionReview struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is what is reviewed.
+	Spec PermissionReviewSpec `json:"spec"`
+	// Status is the result of the review.
+	// +optional
+	Status PermissionReviewStatus `json:"status,omitempty"`
+}
+
+// PermissionReviewSpec is what a PermissionReview reviews. Exactly one of User, GroupPrincipal
+// and ResourceAttributes must be set.
+type PermissionReviewSpec struct {
+	// User is the name of the user whose effective permissions are reviewed. They include the
+	// permissions granted to the groups the user is a member of.
+	// +optional
+	User string `json:"user,omitempty"`
+	// GroupPrincipal is the ID of the group principal whose effective permissions are reviewed,
+	// e.g. github_team://1234.
+	// +optional
+	GroupPrincipal string `json:"groupPrincipal,omitempty"`
+	// ClusterName restricts the review to a cluster. It is required for reviews of resource attributes.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+	// ResourceAttributes is the action whose principals are reviewed.
+	// +optional
+	ResourceAttributes *PermissionReviewResourceAttributes `json:"resourceAttributes,omitempty"`
+}
+
+// PermissionReviewResourceAttributes is an action on a resource of a cluster.
+type PermissionReviewResourceAttributes struct {
+	// Verb is the verb of the action, e.g. get or delete.
+	Verb string `json:"verb"`
+	// APIGroup is the API group of the resource, empty for the core group.
+	// +optional
+	APIGroup string `json:"apiGroup,omitempty"`
+	// Resource is the resource the action is performed on, e.g. pods.
+	Resource string `json:"resource"`
+	// Subresource is the subresource the action is performed on, e.g. log.
+	// +optional
+	Subresource string `json:"subresource,omitempty"`
+	// Name is the name of the resource. An empty name means all resources.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// ProjectName is the name of the project of the namespace of the resource, without the cluster
+	// prefix. The permissions granted in the project are only considered if it is set.
+	// +optional
+	ProjectName string `json:"projectName,omitempty"`
+}
+
+// PermissionReviewStatus is the result of a PermissionReview.
+type PermissionReviewStatus struct {
+	// GlobalRoles are the global roles of the reviewed principal.
+	// +optional
+	GlobalRoles []GlobalRolePermissions `json:"globalRoles,omitempty"`
+	// Clusters are the permissions of the reviewed principal per cluster.
+	// +optional
+	Clusters []ClusterPermissions `json:"clusters,omitempty"`
+	// Principals are the principals allowed to perform the reviewed action.
+	// +optional
+	Principals []PrincipalPermissions `json:"principals,omitempty"`
+}
+
+// GlobalRolePermissions is a global role granted to a principal.
+type GlobalRolePermissions struct {
+	// Name is the name of the global role.
+	Name string `json:"name"`
+	// Binding is the name of the GlobalRoleBinding granting the role.
+	Binding string `json:"binding"`
+	// Subject is the user or group principal the role is granted to.
+	Subject string `json:"subject"`
+	// Admin is true if the role grants full access to all clusters.
+	Admin bool `json:"admin"`
+	// Rules are the policy rules the role grants in the local cluster.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+	// InheritedClusterRoles are the role templates the role grants in all downstream clusters.
+	// +optional
+	InheritedClusterRoles []string `json:"inheritedClusterRoles,omitempty"`
+}
+
+// ClusterPermissions are the permissions of a principal in a cluster.
+type ClusterPermissions struct {
+	// ClusterName is the name of the cluster.
+	ClusterName string `json:"clusterName"`
+	// RoleTemplates are the role templates granted in the cluster.
+	// +optional
+	RoleTemplates []RoleTemplatePermissions `json:"roleTemplates,omitempty"`
+	// Rules are the policy rules the role templates grant in the cluster.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+	// Projects are the permissions of the principal in the projects of the cluster.
+	// +optional
+	Projects []ProjectPermissions `json:"projects,omitempty"`
+}
+
+// ProjectPermissions are the permissions of a principal in a project.
+type ProjectPermissions struct {
+	// ProjectName is the name of the project, without the cluster prefix.
+	ProjectName string `json:"projectName"`
+	// RoleTemplates are the role templates granted in the project.
+	// +optional
+	RoleTemplates []RoleTemplatePermissions `json:"roleTemplates,omitempty"`
+	// Rules are the policy rules the role templates grant in the namespaces of the project.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+// RoleTemplatePermissions is a role template granted to a principal.
+type RoleTemplatePermissions struct {
+	// Name is the name of the role template.
+	Name string `json:"name"`
+	// Binding is the namespace and name of the ClusterRoleTemplateBinding or ProjectRoleTemplateBinding
+	// granting the role template.
+	Binding string `json:"binding"`
+	// Subject is the user or group principal the role template is granted to.
+	Subject string `json:"subject"`
+	// InheritedRoleTemplates are the role templates the role template inherits from, recursively.
+	// +optional
+	InheritedRoleTemplates []string `json:"inheritedRoleTemplates,omitempty"`
+}
+
+// PrincipalPermissions is a principal allowed to perform an action.
+type PrincipalPermissions struct {
+	// Kind is User, Group or ServiceAccount.
+	Kind string `json:"kind"`
+	// Name is the name or principal ID of the user, the ID of the group principal, or the namespace:name of the
+	// service account.
+	Name string `json:"name"`
+	// Bindings are the bindings allowing the principal to perform the action, prefixed with their kind,
+	// e.g. ClusterRoleTemplateBinding/c-m-abcde/crtb-xyz.
+	Bindings []string `json:"bindings"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:onlyVerbs=get,list,watch,delete
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Session is an active login session of a user. It is backed by the management.cattle.io Token
+// created when the user logged in and has the same name. Deleting a session logs the user out of it.
+type Session struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Status is the observed state of the session.
+	// +optional
+	Status SessionStatus `json:"status,omitempty"`
+}
+
+// SessionStatus contains the fields of a session computed by Rancher.
+type SessionStatus struct {
+	// UserID is the name of the user the session belongs to.
+	UserID string `json:"userID"`
+	// UserPrincipal is the ID of the principal the user logged in as.
+	// +optional
+	UserPrincipal string `json:"userPrincipal,omitempty"`
+	// AuthProvider is the auth provider the user logged in with.
+	// +optional
+	AuthProvider string `json:"authProvider,omitempty"`
+	// ClientIP is the IP address of the client that logged in, if known.
+	// +optional
+	ClientIP string `json:"clientIP,omitempty"`
+	// UserAgent is the user agent of the client that logged in, if known.
+	// +optional
+	UserAgent string `json:"userAgent,omitempty"`
+	// LastUsedAt is the last time the session was used to authenticate.
+	// +optional
+	LastUsedAt *metav1.Time `json:"lastUsedAt,omitempty"`
+	// ExpiresAt is the RFC3339 time the session expires at, empty if it doesn't expire.
+	// +optional
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// IdleExpiresAt is the RFC3339 time the session expires at if it remains unused, empty if
+	// sessions don't expire due to inactivity. See the auth-user-session-idle-timeout-minutes setting.
+	// +optional
+	IdleExpiresAt string `json:"idleExpiresAt,omitempty"`
+}
@@ -0,0 +1,109 @@
+package v3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AccessRequestStatePending is the state of requests waiting for a decision of an approver.
+	AccessRequestStatePending = "Pending"
+	// AccessRequestStateApproved is the state of approved requests whose binding is being created.
+	AccessRequestStateApproved = "Approved"
+	// AccessRequestStateActive is the state of approved requests whose binding grants access.
+	AccessRequestStateActive = "Active"
+	// AccessRequestStateDenied is the state of requests denied by an approver.
+	AccessRequestStateDenied = "Denied"
+	// AccessRequestStateExpired is the state of approved requests whose access window has closed.
+	AccessRequestStateExpired = "Expired"
+	// AccessRequestStateFailed is the state of requests that can't be granted, e.g. because the role template doesn't exist.
+	AccessRequestStateFailed = "Failed"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="USER",type="string",JSONPath=".spec.userName"
+// +kubebuilder:printcolumn:name="ROLE",type="string",JSONPath=".spec.roleTemplateName"
+// +kubebuilder:printcolumn:name="STATE",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AccessRequest is a request of a user for a RoleTemplate on a cluster or project for a limited time.
+// Once approved, a ClusterRoleTemplateBinding or ProjectRoleTemplateBinding is created for the user and
+// deleted when the requested duration has passed.
+type AccessRequest struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Standard object metadata; More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata.
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the requested access.
+	Spec AccessRequestSpec `json:"spec"`
+
+	// Status is the most recently observed status of the request.
+	// +optional
+	Status AccessRequestStatus `json:"status,omitempty"`
+}
+
+// AccessRequestSpec is the access requested by a user.
+type AccessRequestSpec struct {
+	// UserName is the name of the user requesting access. It is set to the requesting user by the Rancher API. Immutable.
+	// +optional
+	UserName string `json:"userName,omitempty"`
+
+	// RoleTemplateName is the name of the requested role template. Immutable.
+	// +kubebuilder:validation:Required
+	RoleTemplateName string `json:"roleTemplateName"`
+
+	// ClusterName is the name of the cluster access is requested for. Exactly one of ClusterName and ProjectName
+	// must be set. Immutable.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// ProjectName is the name of the project access is requested for, in the format "clusterName:projectName".
+	// Exactly one of ClusterName and ProjectName must be set. Immutable.
+	// +optional
+	ProjectName string `json:"projectName,omitempty"`
+
+	// Justification explains why the access is needed.
+	// +kubebuilder:validation:Required
+	Justification string `json:"justification"`
+
+	// Duration is how long the access is granted for once approved. It can't exceed the
+	// access-request-max-duration-minutes setting. Immutable.
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+}
+
+// AccessRequestStatus is the observed state of an access request.
+type AccessRequestStatus struct {
+	// State is one of "Pending", "Approved", "Active", "Denied", "Expired" or "Failed".
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// Message is a human-readable explanation of the state.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// ReviewerName is the name of the user that approved or denied the request.
+	// +optional
+	ReviewerName string `json:"reviewerName,omitempty"`
+
+	// ReviewComment is the comment left by the reviewer.
+	// +optional
+	ReviewComment string `json:"reviewComment,omitempty"`
+
+	// ReviewedAt is the time at which the request was approved or denied.
+	// +optional
+	ReviewedAt *metav1.Time `json:"reviewedAt,omitempty"`
+
+	// BindingName is the name of the binding granting the access, in the format "namespace:name".
+	// +optional
+	BindingName string `json:"bindingName,omitempty"`
+
+	// ExpiresAt is the time at which the granted access expires.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,188 @@
+package v3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AccessReviewChangeAdded is the type of changes for records that weren't in the previous report.
+	AccessReviewChangeAdded = "Added"
+	// AccessReviewChangeRemoved is the type of changes for records that are no longer in the report.
+	AccessReviewChangeRemoved = "Removed"
+	// AccessReviewChangeModified is the type of changes for records whose reviewed attributes changed.
+	AccessReviewChangeModified = "Modified"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="USERS",type="integer",JSONPath=".summary.users"
+// +kubebuilder:printcolumn:name="BINDINGS",type="integer",JSONPath=".summary.bindings"
+// +kubebuilder:printcolumn:name="TOKENS",type="integer",JSONPath=".summary.tokens"
+// +kubebuilder:printcolumn:name="CHANGES",type="integer",JSONPath=".summary.changes"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AccessReviewReport is a snapshot of the users, role bindings and tokens of Rancher, taken periodically as
+// configured by the access-review-cron setting so that the access granted can be re-certified. Reports are created
+// by Rancher and record the changes since the previous report. The content of a report can exceed the size limit
+// of resources, it is stored in secrets and downloaded through the csv and json links of the report.
+type AccessReviewReport struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Standard object metadata; More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata.
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// PreviousReportName is the name of the report the changes are computed against. It is empty for the first report.
+	// +optional
+	PreviousReportName string `json:"previousReportName,omitempty"`
+
+	// Summary counts the records and changes of the report.
+	// +optional
+	Summary AccessReviewSummary `json:"summary,omitempty"`
+
+	// ContentSecretNames are the names of the secrets of the cattle-system namespace holding the content of the report,
+	// in order. The content is JSON encoded, gzip compressed and split across the secrets. The secrets are owned by the
+	// report and deleted along with it.
+	// +optional
+	ContentSecretNames []string `json:"contentSecretNames,omitempty"`
+}
+
+// AccessReviewReportContent is the content of an access review report.
+type AccessReviewReportContent struct {
+	// Users are the users of Rancher along with their last login.
+	// +optional
+	Users []AccessReviewUser `json:"users,omitempty"`
+
+	// Bindings are the GlobalRoleBindings, ClusterRoleTemplateBindings and ProjectRoleTemplateBindings.
+	// +optional
+	Bindings []AccessReviewBinding `json:"bindings,omitempty"`
+
+	// Tokens are the tokens of the users.
+	// +optional
+	Tokens []AccessReviewToken `json:"tokens,omitempty"`
+
+	// Changes are the records added, removed or modified since the previous report.
+	// +optional
+	Changes []AccessReviewChange `json:"changes,omitempty"`
+}
+
+// AccessReviewSummary counts the records and changes of an access review report.
+type AccessReviewSummary struct {
+	// Users is the number of users.
+	Users int `json:"users"`
+
+	// Bindings is the number of role bindings.
+	Bindings int `json:"bindings"`
+
+	// Tokens is the number of tokens.
+	Tokens int `json:"tokens"`
+
+	// Changes is the number of changes since the previous report.
+	Changes int `json:"changes"`
+}
+
+// AccessReviewUser is a user in an access review report.
+type AccessReviewUser struct {
+	// Name is the name of the User resource.
+	Name string `json:"name"`
+
+	// Username is the username of local users.
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// DisplayName is the display name of the user.
+	// +optional
+	DisplayName string `json:"displayName,omitempty"`
+
+	// PrincipalIDs are the principals of the user.
+	// +optional
+	PrincipalIDs []string `json:"principalIds,omitempty"`
+
+	// GroupPrincipals are the group principals the user was a member of at their last login.
+	// +optional
+	GroupPrincipals []string `json:"groupPrincipals,omitempty"`
+
+	// Enabled is false for disabled users.
+	Enabled bool `json:"enabled"`
+
+	// LastLogin is the last time the user logged in, if known.
+	// +optional
+	LastLogin *metav1.Time `json:"lastLogin,omitempty"`
+}
+
+// AccessReviewBinding is a role binding in an access review report.
+type AccessReviewBinding struct {
+	// Kind is GlobalRoleBinding, ClusterRoleTemplateBinding or ProjectRoleTemplateBinding.
+	Kind string `json:"kind"`
+
+	// Name is the name of the binding, prefixed with its namespace for namespaced bindings, e.g. c-m-abcde/crtb-xyz.
+	Name string `json:"name"`
+
+	// SubjectKind is User, Group or ServiceAccount.
+	SubjectKind string `json:"subjectKind"`
+
+	// Subject is the name or principal ID of the user, the group principal, or the namespace:name of the
+	// service account bound.
+	Subject string `json:"subject"`
+
+	// RoleName is the name of the GlobalRole or RoleTemplate granted.
+	RoleName string `json:"roleName"`
+
+	// ClusterName is the name of the cluster of ClusterRoleTemplateBindings and ProjectRoleTemplateBindings.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// ProjectName is the name of the project of ProjectRoleTemplateBindings.
+	// +optional
+	ProjectName string `json:"projectName,omitempty"`
+
+	// ExpiresAt is the time at which the binding expires, if any.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// AccessReviewToken is a token in an access review report. Token values are never included.
+type AccessReviewToken struct {
+	// Name is the name of the token.
+	Name string `json:"name"`
+
+	// UserID is the name of the user the token belongs to.
+	UserID string `json:"userId"`
+
+	// Description is the description of the token.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// ClusterName is the name of the cluster the token is scoped to, if any.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// Enabled is false for disabled tokens.
+	Enabled bool `json:"enabled"`
+
+	// ExpiresAt is the time at which the token expires. It is empty for tokens that don't expire.
+	// +optional
+	ExpiresAt string `json:"expiresAt,omitempty"`
+
+	// LastUsedAt is the last time the token was used, if known.
+	// +optional
+	LastUsedAt *metav1.Time `json:"lastUsedAt,omitempty"`
+}
+
+// AccessReviewChange is a change of a record since the previous access review report.
+type AccessReviewChange struct {
+	// Type is one of "Added", "Removed" or "Modified".
+	Type string `json:"type"`
+
+	// Kind is User, Token, or the kind of the binding.
+	Kind string `json:"kind"`
+
+	// Name is the name of the record.
+	Name string `json:"name"`
+
+	// Details describe the modified attributes.
+	// +optional
+	Details []string `json:"details,omitempty"`
+}
@@ -192,6 +192,25 @@ type SetPasswordInput struct {
 	NewPassword string `json:"newPassword" norman:"type=string,required"`
 }
 
+// MFAEnrollOutput holds the TOTP secret of a pending multi-factor authentication enrollment.
+type MFAEnrollOutput struct {
+	TOTPSecret          string `json:"totpSecret"`
+	TOTPProvisioningURI string `json:"totpProvisioningUri"`
+}
+
+type MFAConfirmInput struct {
+	MFACode string `json:"mfaCode" norman:"type=string,required"`
+}
+
+// MFAConfirmOutput holds the recovery codes issued when an enrollment is confirmed. They are only shown once.
+type MFAConfirmOutput struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MFADisableInput struct {
+	MFACode string `json:"mfaCode" norman:"type=string,required"`
+}
+
 // +genclient
 // +kubebuilder:skipversion
 // +genclient:nonNamespaced
@@ -235,6 +235,11 @@ type GlobalRoleBinding struct {
 	// GlobalRoleName is the name of the Global Role that the subject will be bound to. Immutable.
 	// +kubebuilder:validation:Required
 	GlobalRoleName string `json:"globalRoleName" norman:"required,noupdate,type=reference[globalRole]"`
+
+	// ExpiresAt is the time at which the binding expires. Expired bindings are deleted along with the
+	// permissions they grant. Bindings without it don't expire.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
 }
 
 // +genclient
@@ -354,6 +359,11 @@ type ProjectRoleTemplateBinding struct {
 	// Deprecated.
 	// +optional
 	ServiceAccount string `json:"serviceAccount,omitempty" norman:"nocreate,noupdate"`
+
+	// ExpiresAt is the time at which the binding expires. Expired bindings are deleted along with the
+	// permissions they grant. Bindings without it don't expire.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
 }
 
 func (p *ProjectRoleTemplateBinding) ObjClusterName() string {
@@ -400,6 +410,11 @@ type ClusterRoleTemplateBinding struct {
 	// RoleTemplateName is the name of the role template that defines permissions to perform actions on resources in the cluster. Immutable.
 	// +kubebuilder:validation:Required
 	RoleTemplateName string `json:"roleTemplateName" norman:"required,noupdate,type=reference[roleTemplate]"`
+
+	// ExpiresAt is the time at which the binding expires. Expired bindings are deleted along with the
+	// permissions they grant. Bindings without it don't expire.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
 }
 
 func (c *ClusterRoleTemplateBinding) ObjClusterName() string {
@@ -61,6 +61,8 @@ type BasicLogin struct {
 	GenericLogin `json:",inline"`
 	Username     string `json:"username" norman:"type=string,required"`
 	Password     string `json:"password" norman:"type=string,required"`
+	// MFACode is the TOTP or recovery code of local users enrolled in multi-factor authentication.
+	MFACode string `json:"mfaCode,omitempty"`
 }
 
 // +genclient
@@ -0,0 +1,75 @@
+package v3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ShellRecordingTypeClusterShell is the type of recordings of cluster shells opened from the dashboard.
+	ShellRecordingTypeClusterShell = "ClusterShell"
+	// ShellRecordingTypeMachineSSH is the type of recordings of SSH sessions to machines.
+	ShellRecordingTypeMachineSSH = "MachineSSH"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="TYPE",type="string",JSONPath=".type"
+// +kubebuilder:printcolumn:name="USER",type="string",JSONPath=".userId"
+// +kubebuilder:printcolumn:name="CLUSTER",type="string",JSONPath=".clusterName"
+// +kubebuilder:printcolumn:name="TARGET",type="string",JSONPath=".target"
+// +kubebuilder:printcolumn:name="ENDED",type="date",JSONPath=".endedAt"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ShellRecording is the record of an interactive shell session, a cluster shell or an SSH session to a machine,
+// captured while the shell-recording-backend setting is set. The terminal streams are stored in asciicast v2 format
+// in the configured backend and can be replayed through the replay link of the Steve API.
+type ShellRecording struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Standard object metadata; More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata.
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Type is the kind of session, ClusterShell or MachineSSH.
+	// +kubebuilder:validation:Enum=ClusterShell;MachineSSH
+	Type string `json:"type"`
+
+	// UserID is the ID of the user who opened the session.
+	UserID string `json:"userId"`
+
+	// AuditID is the ID of the audit log entry of the request that opened the session.
+	// +optional
+	AuditID string `json:"auditId,omitempty"`
+
+	// ClusterName is the name of the cluster the session was opened on.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// Target is the namespace/name of the machine for MachineSSH sessions.
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// Backend is the storage backend the recording was written to, pvc or s3.
+	Backend string `json:"backend"`
+
+	// Location is the path of the recording for the pvc backend, or its object key in the bucket for the s3 backend.
+	Location string `json:"location"`
+
+	// StartedAt is the time the session was opened.
+	StartedAt metav1.Time `json:"startedAt"`
+
+	// EndedAt is the time the session was closed. It is unset while the session is open.
+	// +optional
+	EndedAt *metav1.Time `json:"endedAt,omitempty"`
+
+	// Size is the size of the recording in bytes once the session is closed.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// Error is the error that kept the recording from being stored in full, e.g. a failed upload. The recording is
+	// incomplete or missing if set.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
@@ -43,6 +43,40 @@ func NewAPIService(namespace, name string, obj APIService) *APIService {
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// AccessRequestList is a list of AccessRequest resources
+type AccessRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []AccessRequest `json:"items"`
+}
+
+func NewAccessRequest(namespace, name string, obj AccessRequest) *AccessRequest {
+	obj.APIVersion, obj.Kind = SchemeGroupVersion.WithKind("AccessRequest").ToAPIVersionAndKind()
+	obj.Name = name
+	obj.Namespace = namespace
+	return &obj
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AccessReviewReportList is a list of AccessReviewReport resources
+type AccessReviewReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []AccessReviewReport `json:"items"`
+}
+
+func NewAccessReviewReport(namespace, name string, obj AccessReviewReport) *AccessReviewReport {
+	obj.APIVersion, obj.Kind = SchemeGroupVersion.WithKind("AccessReviewReport").ToAPIVersionAndKind()
+	obj.Name = name
+	obj.Namespace = namespace
+	return &obj
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // ActiveDirectoryProviderList is a list of ActiveDirectoryProvider resources
 type ActiveDirectoryProviderList struct {
 	metav1.TypeMeta `json:",inline"`
@@ -978,6 +1012,23 @@ func NewSetting(namespace, name string, obj Setting) *Setting {
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// ShellRecordingList is a list of ShellRecording resources
+type ShellRecordingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ShellRecording `json:"items"`
+}
+
+func NewShellRecording(namespace, name string, obj ShellRecording) *ShellRecording {
+	obj.APIVersion, obj.Kind = SchemeGroupVersion.WithKind("ShellRecording").ToAPIVersionAndKind()
+	obj.Name = name
+	obj.Namespace = namespace
+	return &obj
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // TemplateList is a list of Template resources
 type TemplateList struct {
 	metav1.TypeMeta `json:",inline"`
@@ -29,6 +29,8 @@
 
 var (
 	APIServiceResourceName                                = "apiservices"
+	AccessRequestResourceName                             = "accessrequests"
+	AccessReviewReportResourceName                        = "accessreviewreports"
 	ActiveDirectoryProviderResourceName                   = "activedirectoryproviders"
 	AuthConfigResourceName                                = "authconfigs"
 	AuthProviderResourceName                              = "authproviders"
@@ -86,6 +88,7 @@
 	SamlProviderResourceName                              = "samlproviders"
 	SamlTokenResourceName                                 = "samltokens"
 	SettingResourceName                                   = "settings"
+	ShellRecordingResourceName                            = "shellrecordings"
 	TemplateResourceName                                  = "templates"
 	TemplateContentResourceName                           = "templatecontents"
 	TemplateVersionResourceName                           = "templateversions"
@@ -117,6 +120,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&APIService{},
 		&APIServiceList{},
+		&AccessRequest{},
+		&AccessRequestList{},
+		&AccessReviewReport{},
+		&AccessReviewReportList{},
 		&ActiveDirectoryProvider{},
 		&ActiveDirectoryProviderList{},
 		&AuthConfig{},
@@ -231,6 +238,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&SamlTokenList{},
 		&Setting{},
 		&SettingList{},
+		&ShellRecording{},
+		&ShellRecordingList{},
 		&Template{},
 		&TemplateList{},
 		&TemplateContent{},
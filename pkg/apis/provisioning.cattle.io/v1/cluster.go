@@ -34,6 +34,9 @@ type ClusterSpec struct {
 	FleetAgentDeploymentCustomization                    *AgentDeploymentCustomization `json:"fleetAgentDeploymentCustomization,omitempty"`
 
 	RedeploySystemAgentGeneration int64 `json:"redeploySystemAgentGeneration,omitempty"`
+
+	// MaintenanceWindows restricts when disruptive changes are rolled out to the machines of the cluster.
+	MaintenanceWindows *rkev1.MaintenanceWindows `json:"maintenanceWindows,omitempty"`
 }
 
 type AgentDeploymentCustomization struct {
@@ -73,10 +73,11 @@ type RKEMachinePoolRollingUpdate struct {
 type RKEConfig struct {
 	rkev1.RKEClusterSpecCommon
 
-	ETCDSnapshotCreate   *rkev1.ETCDSnapshotCreate   `json:"etcdSnapshotCreate,omitempty"`
-	ETCDSnapshotRestore  *rkev1.ETCDSnapshotRestore  `json:"etcdSnapshotRestore,omitempty"`
-	RotateCertificates   *rkev1.RotateCertificates   `json:"rotateCertificates,omitempty"`
-	RotateEncryptionKeys *rkev1.RotateEncryptionKeys `json:"rotateEncryptionKeys,omitempty"`
+	ETCDSnapshotCreate      *rkev1.ETCDSnapshotCreate      `json:"etcdSnapshotCreate,omitempty"`
+	ETCDSnapshotRestore     *rkev1.ETCDSnapshotRestore     `json:"etcdSnapshotRestore,omitempty"`
+	ETCDSnapshotTestRestore *rkev1.ETCDSnapshotTestRestore `json:"etcdSnapshotTestRestore,omitempty"`
+	RotateCertificates      *rkev1.RotateCertificates      `json:"rotateCertificates,omitempty"`
+	RotateEncryptionKeys    *rkev1.RotateEncryptionKeys    `json:"rotateEncryptionKeys,omitempty"`
 
 	MachinePools        []RKEMachinePool        `json:"machinePools,omitempty"`
 	MachinePoolDefaults RKEMachinePoolDefaults  `json:"machinePoolDefaults,omitempty"`
@@ -174,6 +174,11 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 		*out = new(AgentDeploymentCustomization)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = new(rkecattleiov1.MaintenanceWindows)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -238,6 +243,11 @@ func (in *RKEConfig) DeepCopyInto(out *RKEConfig) {
 		*out = new(rkecattleiov1.ETCDSnapshotRestore)
 		**out = **in
 	}
+	if in.ETCDSnapshotTestRestore != nil {
+		in, out := &in.ETCDSnapshotTestRestore, &out.ETCDSnapshotTestRestore
+		*out = new(rkecattleiov1.ETCDSnapshotTestRestore)
+		**out = **in
+	}
 	if in.RotateCertificates != nil {
 		in, out := &in.RotateCertificates, &out.RotateCertificates
 		*out = new(rkecattleiov1.RotateCertificates)
@@ -113,6 +113,9 @@ type ClusterUpgradeStrategy struct {
 	// How many workers should be upgraded at a time
 	WorkerConcurrency  string       `json:"workerConcurrency,omitempty"`
 	WorkerDrainOptions DrainOptions `json:"workerDrainOptions,omitempty"`
+
+	// HealthGates are checked before each machine is upgraded, the upgrade is paused while any of them fails
+	HealthGates *UpgradeHealthGates `json:"healthGates,omitempty"`
 }
 
 type DrainOptions struct {
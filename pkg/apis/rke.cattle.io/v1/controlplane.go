@@ -28,8 +28,10 @@ type RKEControlPlaneSpec struct {
 	LocalClusterAuthEndpoint LocalClusterAuthEndpoint `json:"localClusterAuthEndpoint"`
 	ETCDSnapshotCreate       *ETCDSnapshotCreate      `json:"etcdSnapshotCreate,omitempty"`
 	ETCDSnapshotRestore      *ETCDSnapshotRestore     `json:"etcdSnapshotRestore,omitempty"`
+	ETCDSnapshotTestRestore  *ETCDSnapshotTestRestore `json:"etcdSnapshotTestRestore,omitempty"`
 	RotateCertificates       *RotateCertificates      `json:"rotateCertificates,omitempty"`
 	RotateEncryptionKeys     *RotateEncryptionKeys    `json:"rotateEncryptionKeys,omitempty"`
+	MaintenanceWindows       *MaintenanceWindows      `json:"maintenanceWindows,omitempty"`
 	KubernetesVersion        string                   `json:"kubernetesVersion,omitempty"`
 	ClusterName              string                   `json:"clusterName,omitempty" wrangler:"required"`
 	ManagementClusterName    string                   `json:"managementClusterName,omitempty" wrangler:"required"`
@@ -49,6 +51,9 @@ type RKEControlPlaneStatus struct {
 	ETCDSnapshotRestorePhase      ETCDSnapshotPhase                   `json:"etcdSnapshotRestorePhase,omitempty"`
 	ETCDSnapshotCreate            *ETCDSnapshotCreate                 `json:"etcdSnapshotCreate,omitempty"`
 	ETCDSnapshotCreatePhase       ETCDSnapshotPhase                   `json:"etcdSnapshotCreatePhase,omitempty"`
+	ETCDSnapshotTestRestore       *ETCDSnapshotTestRestore            `json:"etcdSnapshotTestRestore,omitempty"`
+	ETCDSnapshotTestRestorePhase  ETCDSnapshotPhase                   `json:"etcdSnapshotTestRestorePhase,omitempty"`
+	ETCDSnapshotTestRestoreResult *ETCDSnapshotTestRestoreResult      `json:"etcdSnapshotTestRestoreResult,omitempty"`
 	ConfigGeneration              int64                               `json:"configGeneration,omitempty"`
 	Initialized                   bool                                `json:"initialized,omitempty"`
 	AgentConnected                bool                                `json:"agentConnected,omitempty"`
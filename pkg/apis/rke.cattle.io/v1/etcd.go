@@ -17,15 +17,56 @@
 )
 
 type ETCDSnapshotS3 struct {
-	Endpoint            string `json:"endpoint,omitempty"`
-	EndpointCA          string `json:"endpointCA,omitempty"`
-	SkipSSLVerify       bool   `json:"skipSSLVerify,omitempty"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	EndpointCA    string `json:"endpointCA,omitempty"`
+	SkipSSLVerify bool   `json:"skipSSLVerify,omitempty"`
+	// Insecure disables HTTPS, e.g. for S3 compatible endpoints only served over HTTP.
+	Insecure            bool   `json:"insecure,omitempty"`
 	Bucket              string `json:"bucket,omitempty"`
 	Region              string `json:"region,omitempty"`
 	CloudCredentialName string `json:"cloudCredentialName,omitempty"`
 	Folder              string `json:"folder,omitempty"`
 }
 
+// ETCDSnapshotTarget is an additional S3 compatible target that etcd snapshots are replicated to by Rancher from the S3
+// target of the etcd configuration, e.g. an off-site copy. Snapshots are stored in the folder <namespace>/<cluster name>
+// of the folder of the target.
+type ETCDSnapshotTarget struct {
+	// Name identifies the target in the status of etcd snapshots.
+	Name string          `json:"name"`
+	S3   *ETCDSnapshotS3 `json:"s3,omitempty"`
+	// Retention of the snapshots in the target. All snapshots are kept if it is not set.
+	Retention *ETCDSnapshotRetention `json:"retention,omitempty"`
+}
+
+// ETCDSnapshotRetention is the retention of etcd snapshots in a target. A snapshot is kept if any of the rules keeps it,
+// the most recent snapshot is always kept.
+type ETCDSnapshotRetention struct {
+	// Count is the number of most recent snapshots to keep.
+	Count int `json:"count,omitempty"`
+	// Daily is the number of days for which the most recent snapshot of each day is kept.
+	Daily int `json:"daily,omitempty"`
+	// Weekly is the number of weeks for which the most recent snapshot of each week is kept.
+	Weekly int `json:"weekly,omitempty"`
+}
+
+// ETCDSnapshotEncryption configures the encryption of etcd snapshots with AES-256-GCM on the nodes before they are
+// uploaded to S3. Local snapshots are not encrypted.
+type ETCDSnapshotEncryption struct {
+	// SecretName is the name of the secret in the namespace of the cluster holding the keys. Every entry of the secret
+	// is a key of 32 bytes, either raw or base64 encoded.
+	SecretName string `json:"secretName"`
+	// KeyName is the entry of the secret holding the key snapshots are encrypted with, the other entries are only used
+	// to decrypt snapshots. To rotate the key, add an entry to the secret and set KeyName to it: snapshots encrypted with
+	// another key are re-encrypted with it, along with their copies in the Targets. Copies that remain in a target after
+	// their snapshot was removed from the S3 target are not re-encrypted. Defaults to "key".
+	KeyName string `json:"keyName,omitempty"`
+	// Disabled stops the encryption of new snapshots, which are then uploaded to S3 by RKE2 or K3s, and the re-encryption
+	// of rotated keys. The keys of the secret are still used to restore the snapshots that were encrypted, unlike
+	// removing SnapshotEncryption.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
 type ETCDSnapshotCreate struct {
 	// Changing the Generation is the only thing required to initiate a snapshot creation.
 	Generation int `json:"generation,omitempty"`
@@ -41,6 +82,33 @@ type ETCDSnapshotRestore struct {
 	RestoreRKEConfig string `json:"restoreRKEConfig,omitempty"`
 }
 
+// ETCDSnapshotTestRestore restores an etcd snapshot into a throwaway etcd data directory on a node of the cluster to
+// check that it is restorable, without touching the etcd of the cluster.
+type ETCDSnapshotTestRestore struct {
+	// Name refers to the name of the associated etcdsnapshot object
+	Name string `json:"name,omitempty"`
+
+	// Changing the Generation is the only thing required to initiate a test restore.
+	Generation int `json:"generation,omitempty"`
+}
+
+// ETCDSnapshotTestRestoreResult is the result of the last test restore of an etcd snapshot.
+type ETCDSnapshotTestRestoreResult struct {
+	// Name refers to the name of the etcdsnapshot object that was restored.
+	Name string `json:"name,omitempty"`
+	// NodeName is the name of the node the snapshot was restored on.
+	NodeName    string       `json:"nodeName,omitempty"`
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+	Succeeded   bool         `json:"succeeded"`
+	// Revision is the revision of the restored etcd.
+	Revision int64 `json:"revision,omitempty"`
+	// TotalKeys is the number of keys of the restored etcd.
+	TotalKeys int64 `json:"totalKeys,omitempty"`
+	// TotalSize is the size of the restored etcd database in bytes.
+	TotalSize int64  `json:"totalSize,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
 // +genclient
 // +kubebuilder:skipversion
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -67,10 +135,37 @@ type ETCDSnapshotFile struct {
 	S3        *ETCDSnapshotS3 `json:"s3,omitempty"`
 	Status    string          `json:"status,omitempty"`
 	Message   string          `json:"message,omitempty"`
+	// Checksum is the SHA-256 checksum of the snapshot file, recorded when the snapshot was created. The checksums of
+	// scheduled snapshots are recorded by the first verification of the local snapshots after they were created.
+	Checksum string `json:"checksum,omitempty"`
+	// EncryptionKeyID is the ID of the key the snapshot file is encrypted with, if it is encrypted.
+	EncryptionKeyID string `json:"encryptionKeyID,omitempty"`
 }
 
 type ETCDSnapshotStatus struct {
 	Missing bool `json:"missing"`
+	// Verification is the result of the last verification of the snapshot file against its checksum.
+	Verification *ETCDSnapshotVerification `json:"verification,omitempty"`
+	// Targets is the status of the replication of the snapshot to the additional targets of the etcd configuration.
+	Targets []ETCDSnapshotTargetStatus `json:"targets,omitempty"`
+}
+
+// ETCDSnapshotTargetStatus is the status of the replication of an etcd snapshot to an additional target.
+type ETCDSnapshotTargetStatus struct {
+	Name         string       `json:"name"`
+	Replicated   bool         `json:"replicated"`
+	ReplicatedAt *metav1.Time `json:"replicatedAt,omitempty"`
+	// Pruned is whether the snapshot was removed from the target by its retention.
+	Pruned  bool   `json:"pruned,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ETCDSnapshotVerification is the result of a verification of an etcd snapshot file against its checksum.
+type ETCDSnapshotVerification struct {
+	VerifiedAt *metav1.Time `json:"verifiedAt,omitempty"`
+	// Valid is whether the checksum of the snapshot file matched the checksum recorded when it was created.
+	Valid   bool   `json:"valid"`
+	Message string `json:"message,omitempty"`
 }
 
 type ETCD struct {
@@ -78,4 +173,20 @@ type ETCD struct {
 	SnapshotScheduleCron string          `json:"snapshotScheduleCron,omitempty"`
 	SnapshotRetention    int             `json:"snapshotRetention,omitempty"`
 	S3                   *ETCDSnapshotS3 `json:"s3,omitempty"`
+	// SnapshotVerificationIntervalSeconds is how often the nodes verify their local snapshots against their checksums.
+	// Defaults to 3600, a negative value disables the verification, and the recording of the checksums of scheduled
+	// snapshots along with it.
+	SnapshotVerificationIntervalSeconds int `json:"snapshotVerificationIntervalSeconds,omitempty"`
+	// S3SnapshotVerificationIntervalSeconds is how often Rancher downloads the S3 snapshots to verify them against their
+	// checksums. As every S3 snapshot is downloaded, S3 snapshots are only verified if set.
+	S3SnapshotVerificationIntervalSeconds int `json:"s3SnapshotVerificationIntervalSeconds,omitempty"`
+	// S3Retention is the retention of the snapshots in the S3 target, applied by Rancher. If set, the nodes no longer
+	// remove snapshots from the S3 target and SnapshotRetention only applies to local snapshots, which requires an RKE2 or
+	// K3s version supporting etcd-s3-retention. Snapshots are only removed once replicated to all Targets.
+	S3Retention *ETCDSnapshotRetention `json:"s3Retention,omitempty"`
+	// Targets are additional S3 compatible targets that snapshots are replicated to from the S3 target, each with its own
+	// retention.
+	Targets []ETCDSnapshotTarget `json:"targets,omitempty"`
+	// SnapshotEncryption encrypts snapshots before they are uploaded to S3.
+	SnapshotEncryption *ETCDSnapshotEncryption `json:"snapshotEncryption,omitempty"`
 }
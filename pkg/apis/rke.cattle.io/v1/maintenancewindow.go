@@ -0,0 +1,30 @@
+package v1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// MaintenanceWindows restricts when disruptive changes, such as Kubernetes version upgrades, configuration changes
+// that restart the nodes, and certificate or encryption key rotations, are rolled out to the machines of a cluster.
+// Non-disruptive changes, such as adding machines, are always rolled out.
+type MaintenanceWindows struct {
+	// Windows are the recurring windows in which disruptive changes are rolled out. Disruptive changes are held
+	// outside of them. Disruptive changes aren't restricted if no windows are defined.
+	Windows []MaintenanceWindow `json:"windows,omitempty"`
+
+	// OverrideUntil rolls out disruptive changes outside of the windows until the given time, e.g. to apply an
+	// emergency fix.
+	OverrideUntil *metav1.Time `json:"overrideUntil,omitempty"`
+}
+
+// MaintenanceWindow is a recurring maintenance window.
+type MaintenanceWindow struct {
+	// Schedule is the cron expression of the starts of the window, e.g. "0 2 * * 6" for Saturdays at 2 AM.
+	Schedule string `json:"schedule"`
+
+	// TimeZone is the IANA time zone the schedule is evaluated in, e.g. "Europe/Berlin". Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Duration is the maximum duration of the window. A rollout of disruptive plan changes that was started within the
+	// window is completed once it elapsed, including changes made to the cluster during the rollout, but no new rollouts
+	// or certificate and encryption key rotations are started.
+	Duration metav1.Duration `json:"duration"`
+}
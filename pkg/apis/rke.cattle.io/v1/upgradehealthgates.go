@@ -0,0 +1,47 @@
+package v1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// UpgradeHealthGates are checks of the health of a cluster that must pass before a disruptive plan change, such as a
+// Kubernetes version upgrade, is rolled out to a machine. They are checked before the first machine is changed and
+// between machines. While any of them fails, the rollout is paused and no further machines are drained or changed.
+type UpgradeHealthGates struct {
+	// Etcd requires all etcd members to be healthy and the API server to reach the etcd quorum.
+	Etcd bool `json:"etcd,omitempty"`
+
+	// PodDisruptionBudgets requires all PodDisruptionBudgets of the cluster to have their desired number of healthy
+	// pods.
+	PodDisruptionBudgets bool `json:"podDisruptionBudgets,omitempty"`
+
+	// APIServerLatency is the maximum duration of a readiness check of the API server.
+	APIServerLatency *metav1.Duration `json:"apiServerLatency,omitempty"`
+
+	// Prometheus are the queries answered by a Prometheus running in the cluster.
+	Prometheus *PrometheusHealthGates `json:"prometheus,omitempty"`
+}
+
+// PrometheusHealthGates are health gates evaluated by a Prometheus running in the cluster, which is reached through
+// the service proxy of the API server.
+type PrometheusHealthGates struct {
+	// Namespace of the Prometheus service. Defaults to cattle-monitoring-system.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Service is the name of the Prometheus service. Defaults to rancher-monitoring-prometheus.
+	Service string `json:"service,omitempty"`
+
+	// Port of the Prometheus service. Defaults to 9090.
+	Port string `json:"port,omitempty"`
+
+	// Queries must not return any series for the rollout to continue.
+	Queries []PrometheusHealthGateQuery `json:"queries,omitempty"`
+}
+
+// PrometheusHealthGateQuery is a PromQL query that fails the health gates if it returns any series, like the expression
+// of an alerting rule.
+type PrometheusHealthGateQuery struct {
+	// Name identifies the query in the conditions of the cluster.
+	Name string `json:"name"`
+
+	// Query is the PromQL expression, e.g. `ALERTS{alertstate="firing",severity="critical"}`.
+	Query string `json:"query"`
+}
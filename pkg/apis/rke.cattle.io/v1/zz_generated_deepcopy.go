@@ -50,6 +50,11 @@ func (in *ClusterUpgradeStrategy) DeepCopyInto(out *ClusterUpgradeStrategy) {
 	*out = *in
 	in.ControlPlaneDrainOptions.DeepCopyInto(&out.ControlPlaneDrainOptions)
 	in.WorkerDrainOptions.DeepCopyInto(&out.WorkerDrainOptions)
+	if in.HealthGates != nil {
+		in, out := &in.HealthGates, &out.HealthGates
+		*out = new(UpgradeHealthGates)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -237,6 +242,23 @@ func (in *ETCD) DeepCopyInto(out *ETCD) {
 		*out = new(ETCDSnapshotS3)
 		**out = **in
 	}
+	if in.S3Retention != nil {
+		in, out := &in.S3Retention, &out.S3Retention
+		*out = new(ETCDSnapshotRetention)
+		**out = **in
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]ETCDSnapshotTarget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SnapshotEncryption != nil {
+		in, out := &in.SnapshotEncryption, &out.SnapshotEncryption
+		*out = new(ETCDSnapshotEncryption)
+		**out = **in
+	}
 	return
 }
 
@@ -257,7 +279,7 @@ func (in *ETCDSnapshot) DeepCopyInto(out *ETCDSnapshot) {
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
 	in.SnapshotFile.DeepCopyInto(&out.SnapshotFile)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -295,6 +317,22 @@ func (in *ETCDSnapshotCreate) DeepCopy() *ETCDSnapshotCreate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotEncryption) DeepCopyInto(out *ETCDSnapshotEncryption) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotEncryption.
+func (in *ETCDSnapshotEncryption) DeepCopy() *ETCDSnapshotEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotFile) DeepCopyInto(out *ETCDSnapshotFile) {
 	*out = *in
@@ -353,6 +391,22 @@ func (in *ETCDSnapshotList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotRetention) DeepCopyInto(out *ETCDSnapshotRetention) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotRetention.
+func (in *ETCDSnapshotRetention) DeepCopy() *ETCDSnapshotRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotRestore) DeepCopyInto(out *ETCDSnapshotRestore) {
 	*out = *in
@@ -404,6 +458,18 @@ func (in *ETCDSnapshotSpec) DeepCopy() *ETCDSnapshotSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotStatus) DeepCopyInto(out *ETCDSnapshotStatus) {
 	*out = *in
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(ETCDSnapshotVerification)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]ETCDSnapshotTargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -417,6 +483,108 @@ func (in *ETCDSnapshotStatus) DeepCopy() *ETCDSnapshotStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotTarget) DeepCopyInto(out *ETCDSnapshotTarget) {
+	*out = *in
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(ETCDSnapshotS3)
+		**out = **in
+	}
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(ETCDSnapshotRetention)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotTarget.
+func (in *ETCDSnapshotTarget) DeepCopy() *ETCDSnapshotTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotTargetStatus) DeepCopyInto(out *ETCDSnapshotTargetStatus) {
+	*out = *in
+	if in.ReplicatedAt != nil {
+		in, out := &in.ReplicatedAt, &out.ReplicatedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotTargetStatus.
+func (in *ETCDSnapshotTargetStatus) DeepCopy() *ETCDSnapshotTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotTestRestore) DeepCopyInto(out *ETCDSnapshotTestRestore) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotTestRestore.
+func (in *ETCDSnapshotTestRestore) DeepCopy() *ETCDSnapshotTestRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotTestRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotTestRestoreResult) DeepCopyInto(out *ETCDSnapshotTestRestoreResult) {
+	*out = *in
+	if in.CompletedAt != nil {
+		in, out := &in.CompletedAt, &out.CompletedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotTestRestoreResult.
+func (in *ETCDSnapshotTestRestoreResult) DeepCopy() *ETCDSnapshotTestRestoreResult {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotTestRestoreResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotVerification) DeepCopyInto(out *ETCDSnapshotVerification) {
+	*out = *in
+	if in.VerifiedAt != nil {
+		in, out := &in.VerifiedAt, &out.VerifiedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotVerification.
+func (in *ETCDSnapshotVerification) DeepCopy() *ETCDSnapshotVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvVar) DeepCopyInto(out *EnvVar) {
 	*out = *in
@@ -496,6 +664,48 @@ func (in *LocalClusterAuthEndpoint) DeepCopy() *LocalClusterAuthEndpoint {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindows) DeepCopyInto(out *MaintenanceWindows) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.OverrideUntil != nil {
+		in, out := &in.OverrideUntil, &out.OverrideUntil
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindows.
+func (in *MaintenanceWindows) DeepCopy() *MaintenanceWindows {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindows)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Mirror) DeepCopyInto(out *Mirror) {
 	*out = *in
@@ -540,6 +750,43 @@ func (in *Networking) DeepCopy() *Networking {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusHealthGateQuery) DeepCopyInto(out *PrometheusHealthGateQuery) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusHealthGateQuery.
+func (in *PrometheusHealthGateQuery) DeepCopy() *PrometheusHealthGateQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusHealthGateQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusHealthGates) DeepCopyInto(out *PrometheusHealthGates) {
+	*out = *in
+	if in.Queries != nil {
+		in, out := &in.Queries, &out.Queries
+		*out = make([]PrometheusHealthGateQuery, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusHealthGates.
+func (in *PrometheusHealthGates) DeepCopy() *PrometheusHealthGates {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusHealthGates)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProvisioningFileSource) DeepCopyInto(out *ProvisioningFileSource) {
 	*out = *in
@@ -996,6 +1243,11 @@ func (in *RKEControlPlaneSpec) DeepCopyInto(out *RKEControlPlaneSpec) {
 		*out = new(ETCDSnapshotRestore)
 		**out = **in
 	}
+	if in.ETCDSnapshotTestRestore != nil {
+		in, out := &in.ETCDSnapshotTestRestore, &out.ETCDSnapshotTestRestore
+		*out = new(ETCDSnapshotTestRestore)
+		**out = **in
+	}
 	if in.RotateCertificates != nil {
 		in, out := &in.RotateCertificates, &out.RotateCertificates
 		*out = new(RotateCertificates)
@@ -1006,6 +1258,11 @@ func (in *RKEControlPlaneSpec) DeepCopyInto(out *RKEControlPlaneSpec) {
 		*out = new(RotateEncryptionKeys)
 		**out = **in
 	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = new(MaintenanceWindows)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1047,6 +1304,16 @@ func (in *RKEControlPlaneStatus) DeepCopyInto(out *RKEControlPlaneStatus) {
 		*out = new(ETCDSnapshotCreate)
 		**out = **in
 	}
+	if in.ETCDSnapshotTestRestore != nil {
+		in, out := &in.ETCDSnapshotTestRestore, &out.ETCDSnapshotTestRestore
+		*out = new(ETCDSnapshotTestRestore)
+		**out = **in
+	}
+	if in.ETCDSnapshotTestRestoreResult != nil {
+		in, out := &in.ETCDSnapshotTestRestoreResult, &out.ETCDSnapshotTestRestoreResult
+		*out = new(ETCDSnapshotTestRestoreResult)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1223,3 +1490,29 @@ func (in *RotateEncryptionKeys) DeepCopy() *RotateEncryptionKeys {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeHealthGates) DeepCopyInto(out *UpgradeHealthGates) {
+	*out = *in
+	if in.APIServerLatency != nil {
+		in, out := &in.APIServerLatency, &out.APIServerLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PrometheusHealthGates)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeHealthGates.
+func (in *UpgradeHealthGates) DeepCopy() *UpgradeHealthGates {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeHealthGates)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,114 @@
+package accessreview
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/namespace"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ReportLabel is set on the secrets holding the content of a report and holds the name of the report.
+	ReportLabel = "management.cattle.io/access-review-report"
+
+	contentSecretType = "management.cattle.io/access-review-report-content"
+	contentKey        = "content"
+
+	// contentSecretSize is the most compressed content stored in a secret, well below the size limit of resources.
+	contentSecretSize = 512 * 1024
+)
+
+// encodeContent returns the JSON encoded and gzip compressed content of a report, split in chunks that each fit in a secret.
+func encodeContent(content *v3.AccessReviewReportContent) ([][]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(content); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	data := buf.Bytes()
+	var chunks [][]byte
+	for len(data) > contentSecretSize {
+		chunks = append(chunks, data[:contentSecretSize])
+		data = data[contentSecretSize:]
+	}
+	return append(chunks, data), nil
+}
+
+// contentSecretNames returns the names of the secrets the chunks of the content of a report are stored in.
+func contentSecretNames(reportName string, chunks int) []string {
+	names := make([]string, chunks)
+	for i := range names {
+		names[i] = reportName + "-" + strconv.Itoa(i)
+	}
+	return names
+}
+
+// storeContent creates the secrets holding the chunks of the content of a report. The secrets are owned by the report.
+func storeContent(secrets corecontrollers.SecretClient, report *v3.AccessReviewReport, chunks [][]byte) error {
+	if len(chunks) != len(report.ContentSecretNames) {
+		return fmt.Errorf("report %s has %d content secrets for %d chunks", report.Name, len(report.ContentSecretNames), len(chunks))
+	}
+	for i, name := range report.ContentSecretNames {
+		_, err := secrets.Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace.System,
+				Labels:    map[string]string{ReportLabel: report.Name},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: v3.SchemeGroupVersion.String(),
+					Kind:       "AccessReviewReport",
+					Name:       report.Name,
+					UID:        report.UID,
+				}},
+			},
+			Type: contentSecretType,
+			Data: map[string][]byte{contentKey: chunks[i]},
+		})
+		if err != nil {
+			return fmt.Errorf("error creating content secret %s of access review report %s: %w", name, report.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadContent returns the content of a report from the secrets it is stored in.
+func LoadContent(secrets corecontrollers.SecretClient, report *v3.AccessReviewReport) (*v3.AccessReviewReportContent, error) {
+	content := &v3.AccessReviewReportContent{}
+	if len(report.ContentSecretNames) == 0 {
+		return content, nil
+	}
+
+	var readers []io.Reader
+	for _, name := range report.ContentSecretNames {
+		secret, err := secrets.Get(namespace.System, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting content secret %s of access review report %s: %w", name, report.Name, err)
+		}
+		if secret.Labels[ReportLabel] != report.Name {
+			return nil, fmt.Errorf("secret %s doesn't hold content of access review report %s", name, report.Name)
+		}
+		readers = append(readers, bytes.NewReader(secret.Data[contentKey]))
+	}
+
+	gz, err := gzip.NewReader(io.MultiReader(readers...))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the content of access review report %s: %w", report.Name, err)
+	}
+	defer gz.Close()
+	if err := json.NewDecoder(gz).Decode(content); err != nil {
+		return nil, fmt.Errorf("error decoding the content of access review report %s: %w", report.Name, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,86 @@
+package accessreview
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+)
+
+var csvHeader = []string{
+	"Record", "Name", "Subject Kind", "Subject", "Username", "Display Name", "Enabled", "Last Login",
+	"Role", "Cluster", "Project", "Expires At", "Last Used At", "Change", "Change Details",
+}
+
+// WriteCSV writes the content of a report as CSV, with a row per user, binding and token, and a row per record removed since
+// the previous content. Rows of bindings and tokens include the attributes of the user they belong to, if any.
+func WriteCSV(w io.Writer, content *v3.AccessReviewReportContent) error {
+	users := map[string]*v3.AccessReviewUser{}
+	for i := range content.Users {
+		user := &content.Users[i]
+		users[user.Name] = user
+		for _, principalID := range user.PrincipalIDs {
+			users[principalID] = user
+		}
+	}
+	changes := map[string]*v3.AccessReviewChange{}
+	for i := range content.Changes {
+		change := &content.Changes[i]
+		changes[change.Kind+"/"+change.Name] = change
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	row := func(kind, name, subjectKind, subject, enabled, role, cluster, project, expiresAt, lastUsedAt string) error {
+		var username, displayName, lastLogin string
+		if user := users[subject]; subjectKind == userKind && user != nil {
+			username, displayName, lastLogin = user.Username, user.DisplayName, formatTime(user.LastLogin)
+		}
+		var changeType, changeDetails string
+		if change := changes[kind+"/"+name]; change != nil {
+			changeType, changeDetails = change.Type, strings.Join(change.Details, "; ")
+		}
+		return writer.Write([]string{
+			kind, name, subjectKind, subject, username, displayName, enabled, lastLogin,
+			role, cluster, project, expiresAt, lastUsedAt, changeType, changeDetails,
+		})
+	}
+
+	for _, user := range content.Users {
+		if err := row(userKind, user.Name, userKind, user.Name, strconv.FormatBool(user.Enabled), "", "", "", "", ""); err != nil {
+			return err
+		}
+	}
+	for _, binding := range content.Bindings {
+		enabled := ""
+		if user := users[binding.Subject]; binding.SubjectKind == userKind && user != nil {
+			enabled = strconv.FormatBool(user.Enabled)
+		}
+		if err := row(binding.Kind, binding.Name, binding.SubjectKind, binding.Subject, enabled, binding.RoleName,
+			binding.ClusterName, binding.ProjectName, formatTime(binding.ExpiresAt), ""); err != nil {
+			return err
+		}
+	}
+	for _, token := range content.Tokens {
+		if err := row(tokenKind, token.Name, userKind, token.UserID, strconv.FormatBool(token.Enabled), "",
+			token.ClusterName, "", token.ExpiresAt, formatTime(token.LastUsedAt)); err != nil {
+			return err
+		}
+	}
+	for _, change := range content.Changes {
+		if change.Type != v3.AccessReviewChangeRemoved {
+			continue
+		}
+		if err := writer.Write([]string{change.Kind, change.Name, "", "", "", "", "", "", "", "", "", "", "", change.Type, ""}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,371 @@
+// Package accessreview creates the access review reports that periodically snapshot the users, role bindings and
+// tokens of Rancher, so that the access granted can be re-certified.
+package accessreview
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/ref"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/wrangler"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// ReportNamePrefix is the prefix of the names of access review reports, followed by the time of the report.
+	ReportNamePrefix = "access-review-"
+
+	globalRoleBindingKind          = "GlobalRoleBinding"
+	clusterRoleTemplateBindingKind = "ClusterRoleTemplateBinding"
+	projectRoleTemplateBindingKind = "ProjectRoleTemplateBinding"
+	userKind                       = "User"
+	groupKind                      = "Group"
+	serviceAccountKind             = "ServiceAccount"
+	tokenKind                      = "Token"
+)
+
+// Reporter creates access review reports.
+type Reporter struct {
+	userCache          mgmtcontrollers.UserCache
+	userAttributeCache mgmtcontrollers.UserAttributeCache
+	grbCache           mgmtcontrollers.GlobalRoleBindingCache
+	crtbCache          mgmtcontrollers.ClusterRoleTemplateBindingCache
+	prtbCache          mgmtcontrollers.ProjectRoleTemplateBindingCache
+	tokenCache         mgmtcontrollers.TokenCache
+	reports            mgmtcontrollers.AccessReviewReportClient
+	secrets            corecontrollers.SecretClient
+	retention          func() int
+	now                func() time.Time
+}
+
+// New creates a new instance of Reporter.
+func New(wContext *wrangler.Context) *Reporter {
+	return &Reporter{
+		userCache:          wContext.Mgmt.User().Cache(),
+		userAttributeCache: wContext.Mgmt.UserAttribute().Cache(),
+		grbCache:           wContext.Mgmt.GlobalRoleBinding().Cache(),
+		crtbCache:          wContext.Mgmt.ClusterRoleTemplateBinding().Cache(),
+		prtbCache:          wContext.Mgmt.ProjectRoleTemplateBinding().Cache(),
+		tokenCache:         wContext.Mgmt.Token().Cache(),
+		// Reports aren't cached as they can be large and are only read when a report is created or downloaded.
+		reports:   wContext.Mgmt.AccessReviewReport(),
+		secrets:   wContext.Core.Secret(),
+		retention: settings.AccessReviewReportRetention.GetInt,
+		now:       time.Now,
+	}
+}
+
+// Run creates an access review report with the changes since the latest report, and deletes the oldest
+// reports beyond the access-review-report-retention setting.
+func (r *Reporter) Run(ctx context.Context) error {
+	if ctx.Err() != nil {
+		logrus.Info("accessreview: context canceled, quitting")
+		return nil
+	}
+
+	report, content, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+
+	list, err := r.reports.List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing access review reports: %w", err)
+	}
+	reports := list.Items
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].CreationTimestamp.Equal(&reports[j].CreationTimestamp) {
+			return reports[i].CreationTimestamp.Before(&reports[j].CreationTimestamp)
+		}
+		return reports[i].Name < reports[j].Name
+	})
+	if len(reports) > 0 {
+		previous := &reports[len(reports)-1]
+		previousContent, err := LoadContent(r.secrets, previous)
+		if err != nil {
+			// Still report the current access, without the changes, rather than failing until the previous report is pruned.
+			logrus.Warnf("accessreview: not reporting changes since report %s: %v", previous.Name, err)
+		} else {
+			report.PreviousReportName = previous.Name
+			content.Changes = Diff(previousContent, content)
+		}
+	}
+	report.Summary = v3.AccessReviewSummary{
+		Users:    len(content.Users),
+		Bindings: len(content.Bindings),
+		Tokens:   len(content.Tokens),
+		Changes:  len(content.Changes),
+	}
+
+	chunks, err := encodeContent(content)
+	if err != nil {
+		return fmt.Errorf("error encoding access review report content: %w", err)
+	}
+	report.ContentSecretNames = contentSecretNames(report.Name, len(chunks))
+
+	created, err := r.reports.Create(report)
+	if err != nil {
+		return fmt.Errorf("error creating access review report: %w", err)
+	}
+	if err := storeContent(r.secrets, created, chunks); err != nil {
+		// The secrets already created are garbage collected along with the report.
+		if deleteErr := r.reports.Delete(created.Name, &metav1.DeleteOptions{}); deleteErr != nil && !apierrors.IsNotFound(deleteErr) {
+			logrus.Errorf("accessreview: error deleting incomplete report %s: %v", created.Name, deleteErr)
+		}
+		return err
+	}
+	logrus.Infof("accessreview: created report %s (users %d, bindings %d, tokens %d, changes %d)",
+		created.Name, created.Summary.Users, created.Summary.Bindings, created.Summary.Tokens, created.Summary.Changes)
+
+	return r.prune(append(reports, *created))
+}
+
+// prune deletes the oldest reports beyond the retention. reports must be sorted from the oldest to the newest.
+func (r *Reporter) prune(reports []v3.AccessReviewReport) error {
+	retention := r.retention()
+	if retention <= 0 || len(reports) <= retention {
+		return nil
+	}
+	for _, report := range reports[:len(reports)-retention] {
+		if err := r.reports.Delete(report.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting access review report %s: %w", report.Name, err)
+		}
+		logrus.Infof("accessreview: deleted report %s", report.Name)
+	}
+	return nil
+}
+
+// snapshot returns a report and its content of the current users, role bindings and tokens.
+func (r *Reporter) snapshot() (*v3.AccessReviewReport, *v3.AccessReviewReportContent, error) {
+	now := r.now().UTC()
+	report := &v3.AccessReviewReport{
+		ObjectMeta: metav1.ObjectMeta{Name: ReportNamePrefix + now.Format("20060102-150405")},
+	}
+	content := &v3.AccessReviewReportContent{}
+
+	users, err := r.userCache.List(labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing users: %w", err)
+	}
+	for _, user := range users {
+		reviewed := v3.AccessReviewUser{
+			Name:         user.Name,
+			Username:     user.Username,
+			DisplayName:  user.DisplayName,
+			PrincipalIDs: user.PrincipalIDs,
+			Enabled:      user.Enabled == nil || *user.Enabled,
+		}
+		attribs, err := r.userAttributeCache.Get(user.Name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("error getting user attributes for %s: %w", user.Name, err)
+		}
+		if attribs != nil {
+			if attribs.LastLogin != nil && !attribs.LastLogin.IsZero() {
+				reviewed.LastLogin = attribs.LastLogin
+			}
+			for _, principals := range attribs.GroupPrincipals {
+				for _, principal := range principals.Items {
+					reviewed.GroupPrincipals = append(reviewed.GroupPrincipals, principal.Name)
+				}
+			}
+			sort.Strings(reviewed.GroupPrincipals)
+		}
+		content.Users = append(content.Users, reviewed)
+	}
+	sort.Slice(content.Users, func(i, j int) bool { return content.Users[i].Name < content.Users[j].Name })
+
+	grbs, err := r.grbCache.List(labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing global role bindings: %w", err)
+	}
+	for _, grb := range grbs {
+		subjectKind, subject := subjectOf(grb.UserName, "", grb.GroupPrincipalName, "", "")
+		content.Bindings = append(content.Bindings, v3.AccessReviewBinding{
+			Kind:        globalRoleBindingKind,
+			Name:        grb.Name,
+			SubjectKind: subjectKind,
+			Subject:     subject,
+			RoleName:    grb.GlobalRoleName,
+			ExpiresAt:   grb.ExpiresAt,
+		})
+	}
+
+	crtbs, err := r.crtbCache.List("", labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing cluster role template bindings: %w", err)
+	}
+	for _, crtb := range crtbs {
+		subjectKind, subject := subjectOf(crtb.UserName, crtb.UserPrincipalName, crtb.GroupPrincipalName, crtb.GroupName, "")
+		content.Bindings = append(content.Bindings, v3.AccessReviewBinding{
+			Kind:        clusterRoleTemplateBindingKind,
+			Name:        crtb.Namespace + "/" + crtb.Name,
+			SubjectKind: subjectKind,
+			Subject:     subject,
+			RoleName:    crtb.RoleTemplateName,
+			ClusterName: crtb.ClusterName,
+			ExpiresAt:   crtb.ExpiresAt,
+		})
+	}
+
+	prtbs, err := r.prtbCache.List("", labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing project role template bindings: %w", err)
+	}
+	for _, prtb := range prtbs {
+		subjectKind, subject := subjectOf(prtb.UserName, prtb.UserPrincipalName, prtb.GroupPrincipalName, prtb.GroupName, prtb.ServiceAccount)
+		clusterName, projectName := ref.Parse(prtb.ProjectName)
+		content.Bindings = append(content.Bindings, v3.AccessReviewBinding{
+			Kind:        projectRoleTemplateBindingKind,
+			Name:        prtb.Namespace + "/" + prtb.Name,
+			SubjectKind: subjectKind,
+			Subject:     subject,
+			RoleName:    prtb.RoleTemplateName,
+			ClusterName: clusterName,
+			ProjectName: projectName,
+			ExpiresAt:   prtb.ExpiresAt,
+		})
+	}
+	sort.Slice(content.Bindings, func(i, j int) bool {
+		if content.Bindings[i].Kind != content.Bindings[j].Kind {
+			return content.Bindings[i].Kind < content.Bindings[j].Kind
+		}
+		return content.Bindings[i].Name < content.Bindings[j].Name
+	})
+
+	tokens, err := r.tokenCache.List(labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing tokens: %w", err)
+	}
+	for _, token := range tokens {
+		content.Tokens = append(content.Tokens, v3.AccessReviewToken{
+			Name:        token.Name,
+			UserID:      token.UserID,
+			Description: token.Description,
+			ClusterName: token.ClusterName,
+			Enabled:     token.Enabled == nil || *token.Enabled,
+			ExpiresAt:   token.ExpiresAt,
+			LastUsedAt:  token.LastUsedAt,
+		})
+	}
+	sort.Slice(content.Tokens, func(i, j int) bool { return content.Tokens[i].Name < content.Tokens[j].Name })
+
+	return report, content, nil
+}
+
+// subjectOf returns the kind and name of the subject of a binding.
+func subjectOf(userName, userPrincipalName, groupPrincipalName, groupName, serviceAccount string) (string, string) {
+	switch {
+	case userName != "":
+		return userKind, userName
+	case userPrincipalName != "":
+		return userKind, userPrincipalName
+	case groupPrincipalName != "":
+		return groupKind, groupPrincipalName
+	case serviceAccount != "":
+		return serviceAccountKind, serviceAccount
+	default:
+		return groupKind, groupName
+	}
+}
+
+// record is a reviewed record along with the attributes whose changes are reported. Attributes that change without
+// the access changing, like the last login of users or the last use of tokens, aren't compared.
+type record struct {
+	kind  string
+	name  string
+	attrs map[string]string
+}
+
+func (r record) key() string {
+	return r.kind + "/" + r.name
+}
+
+func records(content *v3.AccessReviewReportContent) []record {
+	var result []record
+	for _, user := range content.Users {
+		result = append(result, record{kind: userKind, name: user.Name, attrs: map[string]string{
+			"username":        user.Username,
+			"displayName":     user.DisplayName,
+			"principalIds":    strings.Join(user.PrincipalIDs, ","),
+			"groupPrincipals": strings.Join(user.GroupPrincipals, ","),
+			"enabled":         strconv.FormatBool(user.Enabled),
+		}})
+	}
+	for _, binding := range content.Bindings {
+		result = append(result, record{kind: binding.Kind, name: binding.Name, attrs: map[string]string{
+			"subject":     binding.SubjectKind + " " + binding.Subject,
+			"roleName":    binding.RoleName,
+			"clusterName": binding.ClusterName,
+			"projectName": binding.ProjectName,
+			"expiresAt":   formatTime(binding.ExpiresAt),
+		}})
+	}
+	for _, token := range content.Tokens {
+		result = append(result, record{kind: tokenKind, name: token.Name, attrs: map[string]string{
+			"userId":      token.UserID,
+			"clusterName": token.ClusterName,
+			"enabled":     strconv.FormatBool(token.Enabled),
+			"expiresAt":   token.ExpiresAt,
+		}})
+	}
+	return result
+}
+
+// Diff returns the records of the current report content that were added or modified since the previous report,
+// and the records of the previous report that were removed.
+func Diff(previous, current *v3.AccessReviewReportContent) []v3.AccessReviewChange {
+	previousRecords := map[string]record{}
+	for _, rec := range records(previous) {
+		previousRecords[rec.key()] = rec
+	}
+
+	var changes []v3.AccessReviewChange
+	for _, rec := range records(current) {
+		old, ok := previousRecords[rec.key()]
+		delete(previousRecords, rec.key())
+		if !ok {
+			changes = append(changes, v3.AccessReviewChange{Type: v3.AccessReviewChangeAdded, Kind: rec.kind, Name: rec.name})
+			continue
+		}
+
+		var details []string
+		for attr, value := range rec.attrs {
+			if old.attrs[attr] != value {
+				details = append(details, fmt.Sprintf("%s: %q -> %q", attr, old.attrs[attr], value))
+			}
+		}
+		if len(details) > 0 {
+			sort.Strings(details)
+			changes = append(changes, v3.AccessReviewChange{Type: v3.AccessReviewChangeModified, Kind: rec.kind, Name: rec.name, Details: details})
+		}
+	}
+	for _, rec := range previousRecords {
+		changes = append(changes, v3.AccessReviewChange{Type: v3.AccessReviewChangeRemoved, Kind: rec.kind, Name: rec.name})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func formatTime(t *metav1.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
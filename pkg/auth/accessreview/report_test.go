@@ -0,0 +1,265 @@
+package accessreview
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/namespace"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+type fakes struct {
+	reports       *fake.MockNonNamespacedClientInterface[*v3.AccessReviewReport, *v3.AccessReviewReportList]
+	users         []*v3.User
+	bindings      []*v3.GlobalRoleBinding
+	crtbs         []*v3.ClusterRoleTemplateBinding
+	prtbs         []*v3.ProjectRoleTemplateBinding
+	tokens        []*v3.Token
+	lastLogin     *metav1.Time
+	secrets       *fake.MockClientInterface[*corev1.Secret, *corev1.SecretList]
+	stored        []v3.AccessReviewReport
+	storedSecrets map[string]*corev1.Secret
+	deleted       []string
+	snapshotAt    time.Time
+	retentionSize int
+}
+
+func newReporter(t *testing.T, f *fakes) *Reporter {
+	ctrl := gomock.NewController(t)
+
+	userCache := fake.NewMockNonNamespacedCacheInterface[*v3.User](ctrl)
+	userCache.EXPECT().List(gomock.Any()).DoAndReturn(func(_ any) ([]*v3.User, error) { return f.users, nil }).AnyTimes()
+
+	userAttributeCache := fake.NewMockNonNamespacedCacheInterface[*v3.UserAttribute](ctrl)
+	userAttributeCache.EXPECT().Get(gomock.Any()).DoAndReturn(func(name string) (*v3.UserAttribute, error) {
+		if name != "u-alice" {
+			return nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+		}
+		return &v3.UserAttribute{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			LastLogin:  f.lastLogin,
+			GroupPrincipals: map[string]v3.Principals{
+				"github": {Items: []v3.Principal{{ObjectMeta: metav1.ObjectMeta{Name: "github_org://devs"}}}},
+			},
+		}, nil
+	}).AnyTimes()
+
+	grbCache := fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRoleBinding](ctrl)
+	grbCache.EXPECT().List(gomock.Any()).DoAndReturn(func(_ any) ([]*v3.GlobalRoleBinding, error) { return f.bindings, nil }).AnyTimes()
+	crtbCache := fake.NewMockCacheInterface[*v3.ClusterRoleTemplateBinding](ctrl)
+	crtbCache.EXPECT().List("", gomock.Any()).DoAndReturn(func(_ string, _ any) ([]*v3.ClusterRoleTemplateBinding, error) { return f.crtbs, nil }).AnyTimes()
+	prtbCache := fake.NewMockCacheInterface[*v3.ProjectRoleTemplateBinding](ctrl)
+	prtbCache.EXPECT().List("", gomock.Any()).DoAndReturn(func(_ string, _ any) ([]*v3.ProjectRoleTemplateBinding, error) { return f.prtbs, nil }).AnyTimes()
+	tokenCache := fake.NewMockNonNamespacedCacheInterface[*v3.Token](ctrl)
+	tokenCache.EXPECT().List(gomock.Any()).DoAndReturn(func(_ any) ([]*v3.Token, error) { return f.tokens, nil }).AnyTimes()
+
+	f.reports = fake.NewMockNonNamespacedClientInterface[*v3.AccessReviewReport, *v3.AccessReviewReportList](ctrl)
+	f.reports.EXPECT().List(gomock.Any()).DoAndReturn(func(_ metav1.ListOptions) (*v3.AccessReviewReportList, error) {
+		return &v3.AccessReviewReportList{Items: append([]v3.AccessReviewReport{}, f.stored...)}, nil
+	}).AnyTimes()
+	f.reports.EXPECT().Create(gomock.Any()).DoAndReturn(func(report *v3.AccessReviewReport) (*v3.AccessReviewReport, error) {
+		report = report.DeepCopy()
+		report.CreationTimestamp = metav1.NewTime(f.snapshotAt)
+		f.stored = append(f.stored, *report)
+		return report, nil
+	}).AnyTimes()
+	f.reports.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(func(name string, _ *metav1.DeleteOptions) error {
+		f.deleted = append(f.deleted, name)
+		for i := range f.stored {
+			if f.stored[i].Name == name {
+				f.stored = append(f.stored[:i], f.stored[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}).AnyTimes()
+
+	f.storedSecrets = map[string]*corev1.Secret{}
+	f.secrets = fake.NewMockClientInterface[*corev1.Secret, *corev1.SecretList](ctrl)
+	f.secrets.EXPECT().Create(gomock.Any()).DoAndReturn(func(secret *corev1.Secret) (*corev1.Secret, error) {
+		f.storedSecrets[secret.Namespace+"/"+secret.Name] = secret.DeepCopy()
+		return secret, nil
+	}).AnyTimes()
+	f.secrets.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ns, name string, _ metav1.GetOptions) (*corev1.Secret, error) {
+		secret, ok := f.storedSecrets[ns+"/"+name]
+		if !ok {
+			return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+		}
+		return secret, nil
+	}).AnyTimes()
+
+	return &Reporter{
+		userCache:          userCache,
+		userAttributeCache: userAttributeCache,
+		grbCache:           grbCache,
+		crtbCache:          crtbCache,
+		prtbCache:          prtbCache,
+		tokenCache:         tokenCache,
+		reports:            f.reports,
+		secrets:            f.secrets,
+		retention:          func() int { return f.retentionSize },
+		now:                func() time.Time { return f.snapshotAt },
+	}
+}
+
+func TestRun(t *testing.T) {
+	lastLogin := metav1.NewTime(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	f := &fakes{
+		users: []*v3.User{
+			{ObjectMeta: metav1.ObjectMeta{Name: "u-bob"}, Username: "bob", Enabled: pointer.Bool(false)},
+			{ObjectMeta: metav1.ObjectMeta{Name: "u-alice"}, DisplayName: "Alice", PrincipalIDs: []string{"github_user://1", "local://u-alice"}},
+		},
+		bindings: []*v3.GlobalRoleBinding{
+			{ObjectMeta: metav1.ObjectMeta{Name: "grb-devs"}, GroupPrincipalName: "github_org://devs", GlobalRoleName: "user"},
+		},
+		crtbs: []*v3.ClusterRoleTemplateBinding{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "c-1", Name: "crtb-alice"}, ClusterName: "c-1", UserPrincipalName: "github_user://1", RoleTemplateName: "cluster-owner"},
+		},
+		prtbs: []*v3.ProjectRoleTemplateBinding{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "p-1", Name: "prtb-sa"}, ProjectName: "c-1:p-1", ServiceAccount: "ns:deployer", RoleTemplateName: "project-member"},
+		},
+		tokens: []*v3.Token{
+			{ObjectMeta: metav1.ObjectMeta{Name: "token-1"}, Token: "secret", UserID: "u-alice", ClusterName: "c-1", ExpiresAt: "2024-06-01T00:00:00Z"},
+		},
+		lastLogin:     &lastLogin,
+		snapshotAt:    time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		retentionSize: 2,
+	}
+	reporter := newReporter(t, f)
+
+	require.NoError(t, reporter.Run(context.Background()))
+	require.Len(t, f.stored, 1)
+	first := f.stored[0]
+	assert.Equal(t, "access-review-20240401-000000", first.Name)
+	assert.Empty(t, first.PreviousReportName)
+	assert.Equal(t, v3.AccessReviewSummary{Users: 2, Bindings: 3, Tokens: 1}, first.Summary)
+
+	// The content is stored in secrets owned by the report.
+	require.Equal(t, []string{"access-review-20240401-000000-0"}, first.ContentSecretNames)
+	secret := f.storedSecrets[namespace.System+"/"+first.ContentSecretNames[0]]
+	require.NotNil(t, secret)
+	assert.Equal(t, first.Name, secret.Labels[ReportLabel])
+	require.Len(t, secret.OwnerReferences, 1)
+	assert.Equal(t, first.Name, secret.OwnerReferences[0].Name)
+
+	firstContent, err := LoadContent(f.secrets, &first)
+	require.NoError(t, err)
+	// Times are decoded in the local time zone.
+	storedLogin := metav1.NewTime(lastLogin.Local())
+	assert.Empty(t, firstContent.Changes, "expected no changes without a previous report")
+	assert.Equal(t, []v3.AccessReviewUser{
+		{Name: "u-alice", DisplayName: "Alice", PrincipalIDs: []string{"github_user://1", "local://u-alice"}, GroupPrincipals: []string{"github_org://devs"}, Enabled: true, LastLogin: &storedLogin},
+		{Name: "u-bob", Username: "bob"},
+	}, firstContent.Users)
+	assert.Equal(t, []v3.AccessReviewBinding{
+		{Kind: "ClusterRoleTemplateBinding", Name: "c-1/crtb-alice", SubjectKind: "User", Subject: "github_user://1", RoleName: "cluster-owner", ClusterName: "c-1"},
+		{Kind: "GlobalRoleBinding", Name: "grb-devs", SubjectKind: "Group", Subject: "github_org://devs", RoleName: "user"},
+		{Kind: "ProjectRoleTemplateBinding", Name: "p-1/prtb-sa", SubjectKind: "ServiceAccount", Subject: "ns:deployer", RoleName: "project-member", ClusterName: "c-1", ProjectName: "p-1"},
+	}, firstContent.Bindings)
+	assert.Equal(t, []v3.AccessReviewToken{
+		{Name: "token-1", UserID: "u-alice", ClusterName: "c-1", Enabled: true, ExpiresAt: "2024-06-01T00:00:00Z"},
+	}, firstContent.Tokens)
+
+	// The last login changing isn't a change of access.
+	newLogin := metav1.NewTime(lastLogin.Add(time.Hour))
+	f.lastLogin = &newLogin
+	f.users[0] = &v3.User{ObjectMeta: metav1.ObjectMeta{Name: "u-bob"}, Username: "bob", Enabled: pointer.Bool(true)}
+	f.crtbs = nil
+	f.tokens = append(f.tokens, &v3.Token{ObjectMeta: metav1.ObjectMeta{Name: "token-2"}, UserID: "u-bob"})
+	f.snapshotAt = f.snapshotAt.AddDate(0, 3, 0)
+
+	require.NoError(t, reporter.Run(context.Background()))
+	require.Len(t, f.stored, 2)
+	second := f.stored[1]
+	assert.Equal(t, first.Name, second.PreviousReportName)
+	secondContent, err := LoadContent(f.secrets, &second)
+	require.NoError(t, err)
+	assert.Equal(t, []v3.AccessReviewChange{
+		{Type: "Removed", Kind: "ClusterRoleTemplateBinding", Name: "c-1/crtb-alice"},
+		{Type: "Added", Kind: "Token", Name: "token-2"},
+		{Type: "Modified", Kind: "User", Name: "u-bob", Details: []string{`enabled: "false" -> "true"`}},
+	}, secondContent.Changes)
+	assert.Equal(t, 3, second.Summary.Changes)
+	assert.Empty(t, f.deleted)
+
+	// Reports beyond the retention are deleted, oldest first.
+	f.snapshotAt = f.snapshotAt.AddDate(0, 3, 0)
+	require.NoError(t, reporter.Run(context.Background()))
+	assert.Equal(t, []string{first.Name}, f.deleted)
+	require.Len(t, f.stored, 2)
+	assert.Equal(t, second.Name, f.stored[1].PreviousReportName)
+}
+
+func TestWriteCSV(t *testing.T) {
+	lastLogin := metav1.NewTime(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	content := &v3.AccessReviewReportContent{
+		Users: []v3.AccessReviewUser{
+			{Name: "u-alice", DisplayName: "Alice", PrincipalIDs: []string{"github_user://1"}, Enabled: true, LastLogin: &lastLogin},
+		},
+		Bindings: []v3.AccessReviewBinding{
+			{Kind: "ClusterRoleTemplateBinding", Name: "c-1/crtb-alice", SubjectKind: "User", Subject: "github_user://1", RoleName: "cluster-owner", ClusterName: "c-1"},
+			{Kind: "GlobalRoleBinding", Name: "grb-devs", SubjectKind: "Group", Subject: "github_org://devs", RoleName: "user"},
+		},
+		Tokens: []v3.AccessReviewToken{
+			{Name: "token-1", UserID: "u-alice", Enabled: false},
+		},
+		Changes: []v3.AccessReviewChange{
+			{Type: "Modified", Kind: "User", Name: "u-alice", Details: []string{`enabled: "false" -> "true"`}},
+			{Type: "Removed", Kind: "GlobalRoleBinding", Name: "grb-old"},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, content))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{"User", "u-alice", "User", "u-alice", "", "Alice", "true", "2024-03-01T10:00:00Z", "", "", "", "", "", "Modified", `enabled: "false" -> "true"`},
+		{"ClusterRoleTemplateBinding", "c-1/crtb-alice", "User", "github_user://1", "", "Alice", "true", "2024-03-01T10:00:00Z", "cluster-owner", "c-1", "", "", "", "", ""},
+		{"GlobalRoleBinding", "grb-devs", "Group", "github_org://devs", "", "", "", "", "user", "", "", "", "", "", ""},
+		{"Token", "token-1", "User", "u-alice", "", "Alice", "false", "2024-03-01T10:00:00Z", "", "", "", "", "", "", ""},
+		{"GlobalRoleBinding", "grb-old", "", "", "", "", "", "", "", "", "", "", "", "Removed", ""},
+	}, rows)
+}
+
+func TestContentChunks(t *testing.T) {
+	content := &v3.AccessReviewReportContent{}
+	// Random-looking names don't compress, so that the content needs more than one secret.
+	for i := 0; i < 30000; i++ {
+		content.Users = append(content.Users, v3.AccessReviewUser{Name: fmt.Sprintf("u-%x", sha256.Sum256([]byte(strconv.Itoa(i))))})
+	}
+
+	chunks, err := encodeContent(content)
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), contentSecretSize)
+	}
+
+	f := &fakes{}
+	newReporter(t, f)
+	report := &v3.AccessReviewReport{ObjectMeta: metav1.ObjectMeta{Name: "access-review-20240401-000000", UID: "uid"}}
+	report.ContentSecretNames = contentSecretNames(report.Name, len(chunks))
+	require.NoError(t, storeContent(f.secrets, report, chunks))
+
+	loaded, err := LoadContent(f.secrets, report)
+	require.NoError(t, err)
+	assert.Equal(t, content, loaded)
+}
@@ -3,6 +3,7 @@
 import (
 	"net/http"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/pkg/errors"
@@ -10,6 +11,8 @@
 	"github.com/rancher/norman/parse"
 	"github.com/rancher/norman/types"
 	"github.com/rancher/rancher/pkg/auth/providerrefresh"
+	"github.com/rancher/rancher/pkg/auth/providers/common"
+	"github.com/rancher/rancher/pkg/auth/providers/local"
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
@@ -23,10 +26,21 @@ func (h *Handler) UserFormatter(apiContext *types.APIContext, resource *types.Ra
 	if canRefresh := h.userCanRefresh(apiContext); canRefresh {
 		resource.AddAction(apiContext, "refreshauthprovideraccess")
 	}
+
+	if isLockedOut(resource) && h.userCanUnlock(apiContext) {
+		resource.AddAction(apiContext, "unlock")
+	}
+
+	if isMFAEnabled(resource) && h.userCanUnlock(apiContext) {
+		resource.AddAction(apiContext, "resetmfa")
+	}
 }
 
 func (h *Handler) CollectionFormatter(apiContext *types.APIContext, collection *types.GenericCollection) {
 	collection.AddAction(apiContext, "changepassword")
+	collection.AddAction(apiContext, "enrollmfa")
+	collection.AddAction(apiContext, "confirmmfa")
+	collection.AddAction(apiContext, "disablemfa")
 	if canRefresh := h.userCanRefresh(apiContext); canRefresh {
 		collection.AddAction(apiContext, "refreshauthprovideraccess")
 	}
@@ -36,6 +50,8 @@ type Handler struct {
 	UserClient               v3.UserInterface
 	GlobalRoleBindingsClient v3.GlobalRoleBindingInterface
 	UserAuthRefresher        providerrefresh.UserAuthRefresher
+	MFA                      *local.MFAManager
+	PasswordHistory          *common.PasswordHistory
 }
 
 func (h *Handler) Actions(actionName string, action *types.Action, apiContext *types.APIContext) error {
@@ -52,6 +68,26 @@ func (h *Handler) Actions(actionName string, action *types.Action, apiContext *t
 		if err := h.refreshAttributes(apiContext); err != nil {
 			return err
 		}
+	case "unlock":
+		if err := h.unlock(apiContext); err != nil {
+			return err
+		}
+	case "enrollmfa":
+		if err := h.enrollMFA(apiContext); err != nil {
+			return err
+		}
+	case "confirmmfa":
+		if err := h.confirmMFA(apiContext); err != nil {
+			return err
+		}
+	case "disablemfa":
+		if err := h.disableMFA(apiContext); err != nil {
+			return err
+		}
+	case "resetmfa":
+		if err := h.resetMFA(apiContext); err != nil {
+			return err
+		}
 	default:
 		return errors.Errorf("bad action %v", actionName)
 	}
@@ -103,13 +139,29 @@ func (h *Handler) changePassword(request *types.APIContext) error {
 		return httperror.NewAPIError(httperror.InvalidBodyContent, "invalid current password")
 	}
 
+	policy := common.GetPasswordPolicy()
+	if err := policy.Validate(newPass); err != nil {
+		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
+	}
+	if err := h.PasswordHistory.Check(user, newPass, policy); err != nil {
+		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
+	}
+
 	newPassHash, err := HashPasswordString(newPass)
 	if err != nil {
 		return err
 	}
 
+	if err := h.PasswordHistory.Record(user, policy); err != nil {
+		return err
+	}
+
 	user.Password = newPassHash
 	user.MustChangePassword = false
+	if user.Annotations == nil {
+		user.Annotations = map[string]string{}
+	}
+	user.Annotations[common.PasswordChangedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
 	user, err = h.UserClient.Update(user)
 	if err != nil {
 		return err
@@ -151,11 +203,28 @@ func (h *Handler) setPassword(request *types.APIContext) error {
 		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
 	}
 
+	policy := common.GetPasswordPolicy()
+	if err := policy.Validate(newPass); err != nil {
+		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
+	}
+
+	user, err := h.UserClient.Get(request.ID, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := h.PasswordHistory.Check(user, newPass, policy); err != nil {
+		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
+	}
+	if err := h.PasswordHistory.Record(user, policy); err != nil {
+		return err
+	}
+
 	userData[client.UserFieldPassword] = newPass
 	if err := hashPassword(userData); err != nil {
 		return err
 	}
 	userData[client.UserFieldMustChangePassword] = false
+	setPasswordChangedAt(userData, time.Now())
 	delete(userData, "me")
 
 	userData, err = store.Update(request, request.Schema, userData, request.ID)
@@ -184,6 +253,183 @@ func (h *Handler) refreshAttributes(request *types.APIContext) error {
 	return nil
 }
 
+// unlock lifts the lockout of a local user caused by too many failed logins.
+func (h *Handler) unlock(request *types.APIContext) error {
+	if !h.userCanUnlock(request) {
+		return httperror.NewAPIError(httperror.PermissionDenied, "not allowed to unlock users")
+	}
+
+	user, err := h.UserClient.Get(request.ID, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := user.Annotations[local.LockedUntilAnnotation]; ok {
+		user = user.DeepCopy()
+		delete(user.Annotations, local.LockedUntilAnnotation)
+		if _, err := h.UserClient.Update(user); err != nil {
+			return err
+		}
+	}
+
+	store := request.Schema.Store
+	if store == nil {
+		return errors.New("no user store available")
+	}
+	userData, err := store.ByID(request, request.Schema, request.ID)
+	if err != nil {
+		return err
+	}
+
+	request.WriteResponse(http.StatusOK, userData)
+	return nil
+}
+
+// enrollMFA starts the enrollment of the current user in multi-factor authentication.
+func (h *Handler) enrollMFA(request *types.APIContext) error {
+	user, err := h.currentLocalUser(request)
+	if err != nil {
+		return err
+	}
+
+	secret, uri, err := h.MFA.Enroll(user)
+	if err != nil {
+		return err
+	}
+
+	request.WriteResponse(http.StatusOK, map[string]interface{}{
+		"type":                                client.MFAEnrollOutputType,
+		client.MFAEnrollOutputFieldTOTPSecret: secret,
+		client.MFAEnrollOutputFieldTOTPProvisioningURI: uri,
+	})
+	return nil
+}
+
+// confirmMFA completes the enrollment of the current user with a code generated from the new TOTP secret.
+func (h *Handler) confirmMFA(request *types.APIContext) error {
+	user, err := h.currentLocalUser(request)
+	if err != nil {
+		return err
+	}
+
+	code, err := readMFACode(request)
+	if err != nil {
+		return err
+	}
+
+	recoveryCodes, err := h.MFA.Confirm(user, code)
+	if err != nil {
+		return err
+	}
+
+	request.WriteResponse(http.StatusOK, map[string]interface{}{
+		"type": client.MFAConfirmOutputType,
+		client.MFAConfirmOutputFieldRecoveryCodes: recoveryCodes,
+	})
+	return nil
+}
+
+// disableMFA turns off multi-factor authentication for the current user, which requires a valid code.
+func (h *Handler) disableMFA(request *types.APIContext) error {
+	user, err := h.currentLocalUser(request)
+	if err != nil {
+		return err
+	}
+
+	code, err := readMFACode(request)
+	if err != nil {
+		return err
+	}
+
+	if err := h.MFA.Verify(user, code); err != nil {
+		return err
+	}
+	if err := h.MFA.Disable(user); err != nil {
+		return err
+	}
+
+	request.WriteResponse(http.StatusOK, nil)
+	return nil
+}
+
+// resetMFA turns off multi-factor authentication for a user that lost access to their authenticator and recovery codes.
+func (h *Handler) resetMFA(request *types.APIContext) error {
+	if !h.userCanUnlock(request) {
+		return httperror.NewAPIError(httperror.PermissionDenied, "not allowed to reset multi-factor authentication")
+	}
+
+	user, err := h.UserClient.Get(request.ID, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := h.MFA.Disable(user); err != nil {
+		return err
+	}
+
+	store := request.Schema.Store
+	if store == nil {
+		return errors.New("no user store available")
+	}
+	userData, err := store.ByID(request, request.Schema, request.ID)
+	if err != nil {
+		return err
+	}
+
+	request.WriteResponse(http.StatusOK, userData)
+	return nil
+}
+
+// currentLocalUser returns the user making the request, multi-factor authentication is only available to local users.
+func (h *Handler) currentLocalUser(request *types.APIContext) (*v3.User, error) {
+	userID := request.Request.Header.Get("Impersonate-User")
+	if userID == "" {
+		return nil, errors.New("can't find user")
+	}
+
+	user, err := h.UserClient.Get(userID, v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if user.Username == "" || user.Password == "" {
+		return nil, httperror.NewAPIError(httperror.InvalidAction, "multi-factor authentication is only available to local users")
+	}
+	return user, nil
+}
+
+func readMFACode(request *types.APIContext) (string, error) {
+	actionInput, err := parse.ReadBody(request.Request)
+	if err != nil {
+		return "", err
+	}
+	code, ok := actionInput[client.MFAConfirmInputFieldMFACode].(string)
+	if !ok || len(code) == 0 {
+		return "", httperror.NewAPIError(httperror.InvalidBodyContent, "must specify the multi-factor authentication code")
+	}
+	return code, nil
+}
+
+// isMFAEnabled returns true if the user resource is enrolled in multi-factor authentication.
+func isMFAEnabled(resource *types.RawResource) bool {
+	annotations, _ := resource.Values["annotations"].(map[string]interface{})
+	_, ok := annotations[local.MFAEnabledAnnotation]
+	return ok
+}
+
+func (h *Handler) userCanUnlock(request *types.APIContext) bool {
+	return request.AccessControl.CanDo(v3.UserGroupVersionKind.Group, v3.UserResource.Name, "update", request, nil, request.Schema) == nil
+}
+
+// isLockedOut returns true if the user resource carries an active lockout.
+func isLockedOut(resource *types.RawResource) bool {
+	annotations, _ := resource.Values["annotations"].(map[string]interface{})
+	value, _ := annotations[local.LockedUntilAnnotation].(string)
+	if value == "" {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	return err == nil && time.Now().Before(until)
+}
+
 func (h *Handler) userCanRefresh(request *types.APIContext) bool {
 	return request.AccessControl.CanDo(v3.UserGroupVersionKind.Group, v3.UserResource.Name, "create", request, nil, request.Schema) == nil
 }
@@ -9,6 +9,7 @@
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/norman/store/transform"
 	"github.com/rancher/norman/types"
+	"github.com/rancher/rancher/pkg/auth/providers/common"
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
@@ -99,6 +100,16 @@ func hashPassword(data map[string]interface{}) error {
 	return nil
 }
 
+// setPasswordChangedAt records the time the password was set in the annotations of the user data.
+func setPasswordChangedAt(data map[string]interface{}, now time.Time) {
+	annotations, _ := data["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+	}
+	annotations[common.PasswordChangedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	data["annotations"] = annotations
+}
+
 func HashPasswordString(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -122,9 +133,14 @@ func (s *userStore) Create(apiContext *types.APIContext, schema *types.Schema, d
 		return nil, httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
 	}
 
+	if err := common.GetPasswordPolicy().Validate(password); err != nil {
+		return nil, httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
+	}
+
 	if err := hashPassword(data); err != nil {
 		return nil, err
 	}
+	setPasswordChangedAt(data, time.Now())
 
 	created, err := s.create(apiContext, schema, data)
 	if err != nil {
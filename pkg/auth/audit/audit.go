@@ -17,6 +17,7 @@
 
 	"github.com/pborman/uuid"
 	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/util"
 	"github.com/sirupsen/logrus"
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apiserver/pkg/endpoints/request"
@@ -64,24 +65,27 @@
 type auditLog struct {
 	log               *log
 	writer            *LogWriter
+	limit             Level
+	annotations       *util.AuditAnnotations
 	reqBody           []byte
 	keysToRedactRegex *regexp.Regexp
 }
 
 type log struct {
-	AuditID           k8stypes.UID `json:"auditID,omitempty"`
-	RequestURI        string       `json:"requestURI,omitempty"`
-	User              *User        `json:"user,omitempty"`
-	Method            string       `json:"method,omitempty"`
-	RemoteAddr        string       `json:"remoteAddr,omitempty"`
-	RequestTimestamp  string       `json:"requestTimestamp,omitempty"`
-	ResponseTimestamp string       `json:"responseTimestamp,omitempty"`
-	ResponseCode      int          `json:"responseCode,omitempty"`
-	RequestHeader     http.Header  `json:"requestHeader,omitempty"`
-	ResponseHeader    http.Header  `json:"responseHeader,omitempty"`
-	RequestBody       []byte       `json:"requestBody,omitempty"`
-	ResponseBody      []byte       `json:"responseBody,omitempty"`
-	UserLoginName     string       `json:"userLoginName,omitempty"`
+	AuditID           k8stypes.UID      `json:"auditID,omitempty"`
+	RequestURI        string            `json:"requestURI,omitempty"`
+	User              *User             `json:"user,omitempty"`
+	Method            string            `json:"method,omitempty"`
+	RemoteAddr        string            `json:"remoteAddr,omitempty"`
+	RequestTimestamp  string            `json:"requestTimestamp,omitempty"`
+	ResponseTimestamp string            `json:"responseTimestamp,omitempty"`
+	ResponseCode      int               `json:"responseCode,omitempty"`
+	RequestHeader     http.Header       `json:"requestHeader,omitempty"`
+	ResponseHeader    http.Header       `json:"responseHeader,omitempty"`
+	RequestBody       []byte            `json:"requestBody,omitempty"`
+	ResponseBody      []byte            `json:"responseBody,omitempty"`
+	UserLoginName     string            `json:"userLoginName,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
 }
 
 var userKey struct{}
@@ -122,9 +126,12 @@ func FromContext(ctx context.Context) (*User, bool) {
 	return u, ok
 }
 
-func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp.Regexp) (*auditLog, error) {
+// newAuditLog creates the audit log for the request. Entries will not contain more information than
+// limit allows, regardless of the levels configured for the log file and sinks.
+func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp.Regexp, limit Level) (*auditLog, error) {
 	auditLog := &auditLog{
 		writer: writer,
+		limit:  limit,
 		log: &log{
 			AuditID:          k8stypes.UID(uuid.NewRandom().String()),
 			RequestURI:       req.RequestURI,
@@ -137,7 +144,8 @@ func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp
 
 	contentType := req.Header.Get("Content-Type")
 	loginReq := isLoginRequest(req.RequestURI)
-	if writer.Level >= LevelRequest || loginReq {
+	captureLevel := auditLog.levelFor(writer.captureLevel())
+	if captureLevel >= LevelRequest || loginReq {
 		if bodyMethods[req.Method] && strings.HasPrefix(contentType, contentTypeJSON) {
 			reqBody, err := readBodyWithoutLosingContent(req)
 			if err != nil {
@@ -149,7 +157,7 @@ func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp
 					auditLog.log.UserLoginName = loginName
 				}
 			}
-			if writer.Level >= LevelRequest {
+			if captureLevel >= LevelRequest {
 				auditLog.reqBody = reqBody
 			}
 		}
@@ -163,6 +171,7 @@ func (a *auditLog) write(userInfo *User, reqHeaders, resHeaders http.Header, res
 	a.log.RequestHeader = filterOutHeaders(reqHeaders, sensitiveRequestHeader)
 	a.log.ResponseHeader = filterOutHeaders(resHeaders, sensitiveResponseHeader)
 	a.log.ResponseCode = resCode
+	a.log.Annotations = a.annotations.Get()
 
 	if a.log.UserLoginName != "" {
 		if a.log.User.Extra == nil {
@@ -172,18 +181,72 @@ func (a *auditLog) write(userInfo *User, reqHeaders, resHeaders http.Header, res
 		logrus.Debugf("Added username for login request to audit log %v", a.log.UserLoginName)
 	}
 
+	// Entries are rendered once per level since the log file and each sink may be configured with different levels.
+	entries := map[Level][]byte{}
+	render := func(level Level) ([]byte, error) {
+		if entry, ok := entries[level]; ok {
+			return entry, nil
+		}
+		entry, err := a.render(level, resHeaders, resBody)
+		if err != nil {
+			return nil, err
+		}
+		entries[level] = entry
+		return entry, nil
+	}
+
+	for _, s := range a.writer.sinks {
+		level := a.levelFor(s.sink.Level())
+		if level == LevelNull {
+			continue
+		}
+		entry, err := render(level)
+		if err != nil {
+			return err
+		}
+		s.enqueue(entry)
+	}
+
+	level := a.levelFor(a.writer.Level)
+	if a.writer.Output == nil || level == LevelNull {
+		return nil
+	}
+
+	entry, err := render(level)
+	if err != nil {
+		return err
+	}
+
+	err = a.writer.writeFile(entry)
+	if err != nil {
+		return fmt.Errorf("failed to write log to output: %w", err)
+	}
+
+	return nil
+}
+
+// levelFor returns the level used for a destination configured with level, capped at the limit of the audit log.
+func (a *auditLog) levelFor(level Level) Level {
+	if level > a.limit {
+		return a.limit
+	}
+	return level
+}
+
+// render marshals the log message including the request and response bodies permitted by level.
+func (a *auditLog) render(level Level, resHeaders http.Header, resBody []byte) ([]byte, error) {
 	var buffer bytes.Buffer
 
 	alByte, err := json.Marshal(a.log)
 	if err != nil {
-		return fmt.Errorf("failed to marshal log message: %w", err)
+		return nil, fmt.Errorf("failed to marshal log message: %w", err)
 	}
 
 	buffer.Write(bytes.TrimSuffix(alByte, []byte("}")))
-	a.writeRequest(&buffer)
+	a.writeRequest(&buffer, level)
 
-	if err = a.writeResponse(&buffer, resHeaders, resBody); err != nil {
-		return err
+	if err = a.writeResponse(&buffer, level, resHeaders, resBody); err != nil {
+		return nil, err
 	}
 
 	buffer.WriteString("}")
@@ -191,22 +254,17 @@ func (a *auditLog) write(userInfo *User, reqHeaders, resHeaders http.Header, res
 	var compactBuffer bytes.Buffer
 	err = json.Compact(&compactBuffer, buffer.Bytes())
 	if err != nil {
-		return fmt.Errorf("failed to compact audit log: %w", err)
+		return nil, fmt.Errorf("failed to compact audit log: %w", err)
 	}
 
 	compactBuffer.WriteString("\n")
 
-	_, err = a.writer.Output.Write(compactBuffer.Bytes())
-	if err != nil {
-		return fmt.Errorf("failed to write log to output: %w", err)
-	}
-
-	return nil
+	return compactBuffer.Bytes(), nil
 }
 
 // writeRequest attempts to write the API request to the log message.
-func (a *auditLog) writeRequest(buf *bytes.Buffer) {
-	if a.writer.Level < LevelRequest || len(a.reqBody) == 0 {
+func (a *auditLog) writeRequest(buf *bytes.Buffer, level Level) {
+	if level < LevelRequest || len(a.reqBody) == 0 {
 		return
 	}
 
@@ -215,8 +273,8 @@ func (a *auditLog) writeRequest(buf *bytes.Buffer) {
 }
 
 // writeResponse attempt to write the API response to the log message.
-func (a *auditLog) writeResponse(buf *bytes.Buffer, resHeaders http.Header, resBody []byte) (err error) {
-	if a.writer.Level < LevelRequestResponse || resHeaders.Get("Content-Type") != contentTypeJSON || len(resBody) == 0 {
+func (a *auditLog) writeResponse(buf *bytes.Buffer, level Level, resHeaders http.Header, resBody []byte) (err error) {
+	if level < LevelRequestResponse || resHeaders.Get("Content-Type") != contentTypeJSON || len(resBody) == 0 {
 		return nil
 	}
 
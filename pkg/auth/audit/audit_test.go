@@ -247,7 +247,7 @@ func (a *AuditTest) TestCompression() {
 	req, err := http.NewRequest(http.MethodGet, "/test", nil)
 	a.Require().NoErrorf(err, "Failed to create request: %v", err)
 
-	auditLog, err := newAuditLog(writer, req, sensitiveRegex)
+	auditLog, err := newAuditLog(writer, req, sensitiveRegex, LevelRequestResponse)
 	a.Require().NoErrorf(err, "Failed to create AuditLog: %v", err)
 
 	const testString = "{\"test\":\"response\"}"
@@ -412,7 +412,7 @@ func (a *AuditTest) TestFilterSensitiveHeader() {
 	req, err := http.NewRequest(http.MethodGet, "/test", nil)
 	a.Require().NoErrorf(err, "Failed to create request: %v", err)
 
-	auditLog, err := newAuditLog(writer, req, sensitiveRegex)
+	auditLog, err := newAuditLog(writer, req, sensitiveRegex, LevelRequestResponse)
 	a.Require().NoErrorf(err, "Failed to create AuditLog: %v", err)
 
 	tests := []struct {
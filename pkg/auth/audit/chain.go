@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSigningInterval is the number of records between two signatures in the hash chain.
+	DefaultSigningInterval = 100
+
+	// lumberjackBackupTimeFormat is the timestamp lumberjack adds to the names of rotated log files.
+	lumberjackBackupTimeFormat = "2006-01-02T15-04-05.000"
+	maxRecordSize              = 64 * 1024 * 1024
+)
+
+// chainFields are the fields added to every record written to the audit log file when hash chaining is enabled.
+type chainFields struct {
+	Seq       *uint64 `json:"seq"`
+	PrevHash  string  `json:"prevHash"`
+	Signature string  `json:"signature"`
+}
+
+// hashChain links audit records by adding a sequence number and the SHA-256 hash of the previous record
+// to each record. Every signingInterval records, and on the first record after a restart, an HMAC-SHA256
+// signature of the sequence number and previous hash is added, which authenticates all prior records.
+type hashChain struct {
+	lock            sync.Mutex
+	key             []byte
+	signingInterval uint64
+	seq             uint64
+	prevHash        string
+	sinceSignature  uint64
+}
+
+// newHashChain creates a hash chain that continues from the last record found in the audit log at path.
+func newHashChain(path string, key []byte, signingInterval int) (*hashChain, error) {
+	if signingInterval <= 0 {
+		signingInterval = DefaultSigningInterval
+	}
+	chain := &hashChain{
+		key:             key,
+		signingInterval: uint64(signingInterval),
+	}
+
+	files, err := logFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	// Walk from the newest file backwards since the current file may be empty right after a rotation.
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastRecord(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			continue
+		}
+		var fields chainFields
+		if err := json.Unmarshal(last, &fields); err != nil || fields.Seq == nil {
+			// The log predates hash chaining or ends with a corrupt record, start a new chain.
+			break
+		}
+		chain.seq = *fields.Seq
+		chain.prevHash = hashRecord(last)
+		break
+	}
+
+	return chain, nil
+}
+
+// link adds the chain fields to entry, a newline terminated JSON object, and advances the chain.
+// The caller must hold the lock until the returned entry has been written.
+func (c *hashChain) link(entry []byte) []byte {
+	entry = bytes.TrimSuffix(entry, []byte("\n"))
+	entry = bytes.TrimSuffix(entry, []byte("}"))
+
+	c.seq++
+	var buf bytes.Buffer
+	buf.Grow(len(entry) + 192)
+	buf.Write(entry)
+	buf.WriteString(`,"seq":`)
+	buf.WriteString(strconv.FormatUint(c.seq, 10))
+	buf.WriteString(`,"prevHash":"`)
+	buf.WriteString(c.prevHash)
+	buf.WriteByte('"')
+
+	// Sign the first record after start up so restarts can't be used to splice records into the chain.
+	if c.sinceSignature == 0 || c.sinceSignature >= c.signingInterval {
+		buf.WriteString(`,"signature":"`)
+		buf.WriteString(signRecord(c.key, c.seq, c.prevHash))
+		buf.WriteByte('"')
+		c.sinceSignature = 0
+	}
+	c.sinceSignature++
+	buf.WriteByte('}')
+
+	c.prevHash = hashRecord(buf.Bytes())
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+func hashRecord(record []byte) string {
+	sum := sha256.Sum256(bytes.TrimSuffix(record, []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func signRecord(key []byte, seq uint64, prevHash string) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d:%s", seq, prevHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// logFiles returns the audit log at path and its rotated backups ordered from oldest to newest.
+// Rotated files are named <name>-<timestamp><ext>, optionally with a .gz suffix, by lumberjack.
+func logFiles(path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list audit log directory: %w", err)
+	}
+
+	type backup struct {
+		name string
+		time time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		t, err := time.Parse(lumberjackBackupTimeFormat, ts)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: name, time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.Before(backups[j].time)
+	})
+
+	files := make([]string, 0, len(backups)+1)
+	for _, b := range backups {
+		files = append(files, filepath.Join(dir, b.name))
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+func openLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open compressed audit log %s: %w", path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+func newRecordScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	return scanner
+}
+
+// lastRecord returns the last non-empty line of the file, or nil if there is none.
+func lastRecord(path string) ([]byte, error) {
+	f, err := openLogFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last []byte
+	scanner := newRecordScanner(f)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	return last, nil
+}
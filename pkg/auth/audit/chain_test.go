@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSigningKey = []byte("0123456789abcdef0123456789abcdef")
+
+func writeChainedRecords(t *testing.T, path string, from, count, signingInterval int) {
+	t.Helper()
+	writer := NewLogWriter(path, LevelMetadata, 0, 0, 100)
+	require.NotNil(t, writer)
+	require.NoError(t, writer.EnableHashChain(testSigningKey, signingInterval))
+	for i := from; i < from+count; i++ {
+		require.NoError(t, writer.writeFile([]byte(fmt.Sprintf(`{"auditID":"%d"}`+"\n", i))))
+	}
+	require.NoError(t, writer.Output.Close())
+}
+
+func TestHashChainVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeChainedRecords(t, path, 0, 10, 4)
+
+	report, err := Verify(path, testSigningKey)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "unexpected problems: %v", report.Problems)
+	assert.Equal(t, 10, report.Records)
+	assert.Equal(t, uint64(1), report.FirstSeq)
+	assert.Equal(t, uint64(10), report.LastSeq)
+	// Signatures on records 1, 5 and 9.
+	assert.Equal(t, 3, report.Signatures)
+	assert.Equal(t, 2, report.UnsignedTail)
+
+	report, err = Verify(path, []byte("wrong key"))
+	require.NoError(t, err)
+	assert.Len(t, report.Problems, 3)
+}
+
+func TestHashChainResumesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeChainedRecords(t, path, 0, 3, 100)
+	writeChainedRecords(t, path, 3, 3, 100)
+
+	report, err := Verify(path, testSigningKey)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "unexpected problems: %v", report.Problems)
+	assert.Equal(t, uint64(6), report.LastSeq)
+	// The first record after each start is signed.
+	assert.Equal(t, 2, report.Signatures)
+}
+
+func TestHashChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines []string) []string
+		problem string
+	}{
+		{
+			name: "modified record",
+			tamper: func(lines []string) []string {
+				lines[2] = strings.Replace(lines[2], `"auditID":"2"`, `"auditID":"X"`, 1)
+				return lines
+			},
+			problem: "seq 4: previous hash does not match",
+		},
+		{
+			name: "deleted record",
+			tamper: func(lines []string) []string {
+				return append(lines[:2], lines[3:]...)
+			},
+			problem: "seq 4: expected seq 3",
+		},
+		{
+			name: "inserted record",
+			tamper: func(lines []string) []string {
+				return append(lines[:2], append([]string{`{"auditID":"injected"}`}, lines[2:]...)...)
+			},
+			problem: "record is missing from the hash chain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeChainedRecords(t, path, 0, 5, 100)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			require.NoError(t, os.WriteFile(path, []byte(strings.Join(tt.tamper(lines), "\n")+"\n"), 0600))
+
+			report, err := Verify(path, testSigningKey)
+			require.NoError(t, err)
+			require.False(t, report.OK())
+			assert.Contains(t, report.Problems[0].String(), tt.problem)
+		})
+	}
+}
+
+func TestHashChainAcrossRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	writeChainedRecords(t, path, 0, 3, 100)
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "audit-2024-01-01T00-00-00.000.log")))
+	writeChainedRecords(t, path, 3, 3, 100)
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "audit-2024-01-02T00-00-00.000.log")))
+	// An empty current file, as left behind right after a rotation.
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	writeChainedRecords(t, path, 6, 3, 100)
+
+	files, err := logFiles(path)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	assert.Equal(t, path, files[2])
+
+	report, err := Verify(path, testSigningKey)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "unexpected problems: %v", report.Problems)
+	assert.Equal(t, uint64(9), report.LastSeq)
+}
+
+func TestHashChainLinkFormat(t *testing.T) {
+	chain := &hashChain{key: testSigningKey, signingInterval: 2}
+	first := chain.link([]byte(`{"auditID":"1"}` + "\n"))
+	second := chain.link([]byte(`{"auditID":"2"}` + "\n"))
+
+	assert.True(t, bytes.HasPrefix(first, []byte(`{"auditID":"1","seq":1,"prevHash":"","signature":"`)), string(first))
+	assert.Equal(t, fmt.Sprintf(`{"auditID":"2","seq":2,"prevHash":"%s"}`+"\n", hashRecord(first)), string(second))
+}
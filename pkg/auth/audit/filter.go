@@ -15,6 +15,7 @@
 
 	"github.com/rancher/rancher/pkg/auth/util"
 	"github.com/rancher/rancher/pkg/data/management"
+	"github.com/rancher/rancher/pkg/tracing"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,12 +23,17 @@
 	errorDebounceTime = time.Second * 30
 )
 
-func NewAuditLogMiddleware(auditWriter *LogWriter) (func(http.Handler) http.Handler, error) {
+// NewAuditLogMiddleware returns a middleware writing audit logs for every request to auditWriter.
+// The audit policy returned by policySource is reloaded whenever its value changes, a nil policySource
+// audits every request at the configured levels.
+func NewAuditLogMiddleware(auditWriter *LogWriter, policySource func() string) (func(http.Handler) http.Handler, error) {
 	sensitiveRegex, err := constructKeyRedactRegex()
+	policy := newPolicyLoader(policySource)
 	return func(next http.Handler) http.Handler {
 		return &auditHandler{
 			next:            next,
 			auditWriter:     auditWriter,
+			policy:          policy,
 			sanitizingRegex: sensitiveRegex,
 			errMap:          make(map[string]time.Time),
 			errLock:         &sync.Mutex{},
@@ -49,7 +55,7 @@ func constructKeyRedactRegex() (*regexp.Regexp, error) {
 			}
 		}
 	}
-	s.WriteString(`[pP]assword|[tT]oken|[kK]ube[cC]onfig)`)
+	s.WriteString(`[pP]assword|[tT]oken|[kK]ube[cC]onfig|[mM]fa[cC]ode|[tT]otp|[rR]ecovery[cC]odes)`)
 
 	return regexp.Compile(s.String())
 }
@@ -57,6 +63,7 @@ func constructKeyRedactRegex() (*regexp.Regexp, error) {
 type auditHandler struct {
 	next            http.Handler
 	auditWriter     *LogWriter
+	policy          *policyLoader
 	sanitizingRegex *regexp.Regexp
 	errMap          map[string]time.Time
 	errLock         *sync.Mutex
@@ -70,14 +77,26 @@ func (h auditHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	user := getUserInfo(req)
 
-	context := context.WithValue(req.Context(), userKey, user)
-	req = req.WithContext(context)
+	ctx, annotations := util.WithAuditAnnotations(context.WithValue(req.Context(), userKey, user))
+	req = req.WithContext(ctx)
 
-	auditLog, err := newAuditLog(h.auditWriter, req, h.sanitizingRegex)
+	limit := LevelRequestResponse
+	if level, ok := h.policy.get().LevelFor(req, user); ok {
+		if level == LevelNull {
+			h.next.ServeHTTP(rw, req)
+			return
+		}
+		limit = level
+	}
+
+	auditLog, err := newAuditLog(h.auditWriter, req, h.sanitizingRegex, limit)
 	if err != nil {
 		util.ReturnHTTPError(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	auditLog.annotations = annotations
+	req = req.WithContext(util.WithAuditID(req.Context(), string(auditLog.log.AuditID)))
+	tracing.SetAttributes(req.Context(), tracing.AuditIDKey.String(string(auditLog.log.AuditID)))
 
 	wr := &wrapWriter{ResponseWriter: rw, auditWriter: h.auditWriter, statusCode: http.StatusOK}
 	h.next.ServeHTTP(wr, req)
@@ -2,37 +2,154 @@
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/pborman/uuid"
+	"github.com/rancher/rancher/pkg/auth/util"
+	"github.com/sirupsen/logrus"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 )
 
+// LogWriter writes audit entries to the local log file and fans them out to any additional sinks.
+// Level applies to the log file, each sink filters entries according to its own level.
 type LogWriter struct {
 	Level  Level
 	Output *lumberjack.Logger
+
+	sinks []*queuedSink
+	chain *hashChain
 }
 
 func (l *LogWriter) Start(ctx context.Context) {
 	if l == nil {
 		return
 	}
+	for _, s := range l.sinks {
+		go s.run(ctx)
+	}
 	go func() {
 		<-ctx.Done()
-		l.Output.Close()
+		if l.Output != nil {
+			l.Output.Close()
+		}
 	}()
 }
 
-func NewLogWriter(path string, level Level, maxAge, maxBackup, maxSize int) *LogWriter {
-	if path == "" || level == LevelNull {
+// EnableHashChain makes every record written to the log file carry a sequence number and the hash of the
+// previous record, with an HMAC signature using key added every signingInterval records. The chain
+// continues from the last record of the existing log file. Sinks don't receive the chain fields.
+func (l *LogWriter) EnableHashChain(key []byte, signingInterval int) error {
+	if l == nil || l.Output == nil {
 		return nil
 	}
+	if len(key) == 0 {
+		return fmt.Errorf("audit log signing key must not be empty")
+	}
+	chain, err := newHashChain(l.Output.Filename, key, signingInterval)
+	if err != nil {
+		return fmt.Errorf("failed to resume audit log hash chain: %w", err)
+	}
+	l.chain = chain
+	return nil
+}
+
+// writeFile writes the entry to the log file, linking it to the hash chain if enabled.
+func (l *LogWriter) writeFile(entry []byte) error {
+	if l.chain == nil {
+		_, err := l.Output.Write(entry)
+		return err
+	}
+
+	// Records must be written in the order they are linked.
+	l.chain.lock.Lock()
+	defer l.chain.lock.Unlock()
+
+	// Don't advance the chain if the record couldn't be written, otherwise the next record would leave a gap.
+	seq, prevHash, sinceSignature := l.chain.seq, l.chain.prevHash, l.chain.sinceSignature
+	if _, err := l.Output.Write(l.chain.link(entry)); err != nil {
+		l.chain.seq, l.chain.prevHash, l.chain.sinceSignature = seq, prevHash, sinceSignature
+		return err
+	}
+	return nil
+}
+
+// addSink registers an additional destination for audit entries. Entries are queued for the sink and
+// dropped if more than bufferSize of them are waiting to be written.
+func (l *LogWriter) addSink(sink Sink, bufferSize int) {
+	if sink == nil || sink.Level() == LevelNull {
+		return
+	}
+	l.sinks = append(l.sinks, newQueuedSink(sink, bufferSize))
+}
+
+// captureLevel returns the most verbose level required by the log file or any of the sinks.
+func (l *LogWriter) captureLevel() Level {
+	level := LevelNull
+	if l.Output != nil {
+		level = l.Level
+	}
+	for _, s := range l.sinks {
+		if s.sink.Level() > level {
+			level = s.sink.Level()
+		}
+	}
+	return level
+}
 
-	return &LogWriter{
+// NewLogWriter returns a LogWriter for the given log file and sinks. The log file is skipped if path is
+// empty or level is LevelNull, and nil is returned if there is nowhere to write audit entries to.
+func NewLogWriter(path string, level Level, maxAge, maxBackup, maxSize int, sinks ...Sink) *LogWriter {
+	writer := &LogWriter{
 		Level: level,
-		Output: &lumberjack.Logger{
+	}
+	if path != "" && level != LevelNull {
+		writer.Output = &lumberjack.Logger{
 			Filename:   path,
 			MaxAge:     maxAge,
 			MaxBackups: maxBackup,
 			MaxSize:    maxSize,
+		}
+	}
+	for _, s := range sinks {
+		writer.addSink(s, DefaultSinkBufferSize)
+	}
+
+	if writer.Output == nil && len(writer.sinks) == 0 {
+		return nil
+	}
+	return writer
+}
+
+// SystemUserName is the user recorded in the audit entries of actions Rancher takes on its own.
+const SystemUserName = "system:rancher"
+
+// WriteSystemAction writes a metadata level audit entry for an action Rancher took on its own, e.g. from a
+// controller, on the resource at uri. It implements util.SystemAuditFunc.
+func (l *LogWriter) WriteSystemAction(method, uri string, annotations map[string]string) {
+	if l == nil {
+		return
+	}
+
+	ctx, auditAnnotations := util.WithAuditAnnotations(context.Background())
+	for key, value := range annotations {
+		util.AddAuditAnnotation(ctx, key, value)
+	}
+	now := time.Now().Format(time.RFC3339)
+	auditLog := &auditLog{
+		writer:      l,
+		limit:       LevelMetadata,
+		annotations: auditAnnotations,
+		log: &log{
+			AuditID:          k8stypes.UID(uuid.NewRandom().String()),
+			RequestURI:       uri,
+			Method:           method,
+			RequestTimestamp: now,
 		},
 	}
+	if err := auditLog.write(&User{Name: SystemUserName}, nil, nil, http.StatusOK, nil); err != nil {
+		logrus.Errorf("Failed to write audit log for %s %s: %v", method, uri, err)
+	}
 }
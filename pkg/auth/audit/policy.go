@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Policy levels as they appear in a serialized audit policy.
+const (
+	PolicyLevelNone            = "None"
+	PolicyLevelMetadata        = "Metadata"
+	PolicyLevelRequest         = "Request"
+	PolicyLevelRequestResponse = "RequestResponse"
+)
+
+var policyLevels = map[string]Level{
+	PolicyLevelNone:            LevelNull,
+	PolicyLevelMetadata:        LevelMetadata,
+	PolicyLevelRequest:         LevelRequest,
+	PolicyLevelRequestResponse: LevelRequestResponse,
+}
+
+// Policy is an ordered list of rules selecting the audit level of a request. The first matching rule wins,
+// requests that don't match any rule are audited at the levels configured for the log file and sinks.
+// The level chosen by the policy is an upper bound, sinks never receive more than their own level.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule matches requests on all of its non-empty fields.
+type PolicyRule struct {
+	// Level is one of None, Metadata, Request or RequestResponse.
+	Level string `json:"level"`
+	// URIPrefixes matches if the request URI starts with any of the prefixes.
+	URIPrefixes []string `json:"uriPrefixes,omitempty"`
+	// Methods matches the HTTP method of the request, e.g. GET or POST.
+	Methods []string `json:"methods,omitempty"`
+	// Users matches the name of the authenticated user.
+	Users []string `json:"users,omitempty"`
+	// Groups matches if the authenticated user is a member of any of the groups.
+	Groups []string `json:"groups,omitempty"`
+	// Resources matches the resource type addressed by the request, e.g. globalrolebindings or secrets.
+	Resources []string `json:"resources,omitempty"`
+
+	level Level
+}
+
+// ParsePolicy decodes and validates a JSON encoded audit policy.
+func ParsePolicy(data string) (*Policy, error) {
+	policy := &Policy{}
+	if strings.TrimSpace(data) == "" {
+		return policy, nil
+	}
+
+	if err := json.Unmarshal([]byte(data), policy); err != nil {
+		return nil, fmt.Errorf("failed to parse audit policy: %w", err)
+	}
+
+	for i := range policy.Rules {
+		level, ok := policyLevels[policy.Rules[i].Level]
+		if !ok {
+			return nil, fmt.Errorf("audit policy rule %d has invalid level %q", i, policy.Rules[i].Level)
+		}
+		policy.Rules[i].level = level
+	}
+
+	return policy, nil
+}
+
+// LevelFor returns the level of the first rule matching the request and true, or false if no rule matches.
+func (p *Policy) LevelFor(req *http.Request, user *User) (Level, bool) {
+	if p == nil || len(p.Rules) == 0 {
+		return LevelNull, false
+	}
+
+	resource := resourceFromURI(req.URL.Path)
+	for _, rule := range p.Rules {
+		if rule.matches(req, user, resource) {
+			return rule.level, true
+		}
+	}
+	return LevelNull, false
+}
+
+func (r *PolicyRule) matches(req *http.Request, user *User, resource string) bool {
+	if len(r.Methods) > 0 && !containsFold(r.Methods, req.Method) {
+		return false
+	}
+
+	if len(r.URIPrefixes) > 0 {
+		uri := req.RequestURI
+		if uri == "" {
+			uri = req.URL.RequestURI()
+		}
+		var found bool
+		for _, prefix := range r.URIPrefixes {
+			if strings.HasPrefix(uri, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Users) > 0 && (user == nil || !isExist(r.Users, user.Name)) {
+		return false
+	}
+
+	if len(r.Groups) > 0 {
+		if user == nil {
+			return false
+		}
+		var found bool
+		for _, group := range user.Group {
+			if isExist(r.Groups, group) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Resources) > 0 && (resource == "" || !containsFold(r.Resources, resource)) {
+		return false
+	}
+
+	return true
+}
+
+// resourceFromURI returns the plural resource type addressed by a Rancher or Kubernetes API path.
+// It understands the norman (/v3), steve (/v1) and Kubernetes (/api, /apis) layouts, including
+// requests proxied to downstream clusters through /k8s/clusters/<cluster>.
+func resourceFromURI(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 3 && parts[0] == "k8s" && parts[1] == "clusters" {
+		parts = parts[3:]
+	}
+	if len(parts) < 2 {
+		return ""
+	}
+
+	var rest []string
+	switch parts[0] {
+	case "v3":
+		// Project and cluster scoped norman types are nested, e.g. /v3/project/<project>/workloads.
+		if (parts[1] == "project" || parts[1] == "cluster") && len(parts) >= 4 {
+			return parts[3]
+		}
+		return parts[1]
+	case "v1":
+		// Steve types are qualified with their group, e.g. management.cattle.io.globalrolebindings.
+		return parts[1][strings.LastIndex(parts[1], ".")+1:]
+	case "api":
+		// /api/<version>/...
+		rest = parts[2:]
+	case "apis":
+		// /apis/<group>/<version>/...
+		if len(parts) < 3 {
+			return ""
+		}
+		rest = parts[3:]
+	default:
+		return ""
+	}
+
+	if len(rest) >= 3 && rest[0] == "namespaces" {
+		rest = rest[2:]
+	}
+	if len(rest) == 0 {
+		return ""
+	}
+	return rest[0]
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyLoader parses the policy returned by source whenever its value changes. Invalid policies are
+// logged and the previous policy stays in effect.
+type policyLoader struct {
+	source func() string
+
+	lock   sync.Mutex
+	raw    string
+	policy *Policy
+}
+
+func newPolicyLoader(source func() string) *policyLoader {
+	return &policyLoader{source: source}
+}
+
+func (l *policyLoader) get() *Policy {
+	if l == nil || l.source == nil {
+		return nil
+	}
+
+	raw := l.source()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if raw == l.raw {
+		return l.policy
+	}
+
+	policy, err := ParsePolicy(raw)
+	if err != nil {
+		logrus.Errorf("Ignoring invalid audit log policy, keeping the previous policy: %v", err)
+	} else {
+		l.policy = policy
+	}
+	l.raw = raw
+
+	return l.policy
+}
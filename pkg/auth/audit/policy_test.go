@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("")
+	require.NoError(t, err)
+	assert.Empty(t, policy.Rules)
+
+	_, err = ParsePolicy(`{"rules":[{"level":"Everything"}]}`)
+	assert.Error(t, err)
+
+	_, err = ParsePolicy(`{"rules":`)
+	assert.Error(t, err)
+}
+
+func TestPolicyLevelFor(t *testing.T) {
+	policy, err := ParsePolicy(`{"rules":[
+		{"level":"None","methods":["GET"],"uriPrefixes":["/v3/settings","/v1/counts"]},
+		{"level":"RequestResponse","resources":["globalrolebindings","clusterroletemplatebindings","rolebindings"]},
+		{"level":"Request","groups":["system:masters"]},
+		{"level":"Metadata","users":["u-noisy"],"methods":["get"]}
+	]}`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		method    string
+		uri       string
+		user      *User
+		wantLevel Level
+		wantMatch bool
+	}{
+		{
+			name:      "read of settings is dropped",
+			method:    http.MethodGet,
+			uri:       "/v3/settings/server-url",
+			wantLevel: LevelNull,
+			wantMatch: true,
+		},
+		{
+			name:      "write of settings falls through to the configured level",
+			method:    http.MethodPut,
+			uri:       "/v3/settings/server-url",
+			user:      &User{Name: "u-admin"},
+			wantMatch: false,
+		},
+		{
+			name:      "norman global role binding",
+			method:    http.MethodPost,
+			uri:       "/v3/globalrolebindings",
+			wantLevel: LevelRequestResponse,
+			wantMatch: true,
+		},
+		{
+			name:      "steve cluster role template binding",
+			method:    http.MethodDelete,
+			uri:       "/v1/management.cattle.io.clusterroletemplatebindings/c-abc/crtb-xyz",
+			wantLevel: LevelRequestResponse,
+			wantMatch: true,
+		},
+		{
+			name:      "downstream namespaced role binding",
+			method:    http.MethodPost,
+			uri:       "/k8s/clusters/c-abc/apis/rbac.authorization.k8s.io/v1/namespaces/default/rolebindings",
+			wantLevel: LevelRequestResponse,
+			wantMatch: true,
+		},
+		{
+			name:      "group match",
+			method:    http.MethodGet,
+			uri:       "/v3/clusters",
+			user:      &User{Name: "u-admin", Group: []string{"system:authenticated", "system:masters"}},
+			wantLevel: LevelRequest,
+			wantMatch: true,
+		},
+		{
+			name:      "user and method match",
+			method:    http.MethodGet,
+			uri:       "/v3/clusters",
+			user:      &User{Name: "u-noisy"},
+			wantLevel: LevelMetadata,
+			wantMatch: true,
+		},
+		{
+			name:      "user matches but method does not",
+			method:    http.MethodPost,
+			uri:       "/v3/clusters",
+			user:      &User{Name: "u-noisy"},
+			wantMatch: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.uri, nil)
+			require.NoError(t, err)
+
+			level, ok := policy.LevelFor(req, tt.user)
+			assert.Equal(t, tt.wantMatch, ok)
+			if tt.wantMatch {
+				assert.Equal(t, tt.wantLevel, level)
+			}
+		})
+	}
+}
+
+func TestResourceFromURI(t *testing.T) {
+	tests := map[string]string{
+		"/v3/tokens":                             "tokens",
+		"/v3/project/c-abc:p-xyz/workloads":      "workloads",
+		"/v1/management.cattle.io.settings/foo":  "settings",
+		"/v1/secrets/default/foo":                "secrets",
+		"/api/v1/namespaces":                     "namespaces",
+		"/api/v1/namespaces/default":             "namespaces",
+		"/api/v1/namespaces/default/secrets/foo": "secrets",
+		"/apis/apps/v1/deployments":              "deployments",
+		"/k8s/clusters/local/api/v1/nodes":       "nodes",
+		"/healthz":                               "",
+		"/apis":                                  "",
+	}
+	for uri, want := range tests {
+		assert.Equal(t, want, resourceFromURI(uri), uri)
+	}
+}
+
+func TestPolicyLoaderKeepsPreviousPolicyOnError(t *testing.T) {
+	raw := `{"rules":[{"level":"None"}]}`
+	loader := newPolicyLoader(func() string { return raw })
+
+	policy := loader.get()
+	require.NotNil(t, policy)
+	require.Len(t, policy.Rules, 1)
+
+	raw = `{"rules":[{"level":"bogus"}]}`
+	assert.Same(t, policy, loader.get())
+
+	raw = ""
+	assert.Empty(t, loader.get().Rules)
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSinkBufferSize is the number of entries a sink can fall behind before entries are dropped.
+	DefaultSinkBufferSize = 1000
+
+	sinkFlushInterval = time.Second * 5
+)
+
+// Sink is a destination for audit log entries in addition to the local log file.
+type Sink interface {
+	// Name identifies the sink in log messages.
+	Name() string
+	// Level is the most verbose level of audit data the sink should receive.
+	Level() Level
+	// Write delivers a single newline terminated JSON audit entry.
+	Write(entry []byte) error
+	// Close flushes any buffered entries and releases the resources held by the sink.
+	Close() error
+}
+
+// Flusher is implemented by sinks that buffer entries and need to be flushed periodically.
+type Flusher interface {
+	Flush() error
+}
+
+// queuedSink decouples a Sink from the request path. Entries are handed off through a bounded
+// queue and written by a single goroutine, when the queue is full new entries are dropped so a slow
+// or unreachable sink can never block an API request.
+type queuedSink struct {
+	sink    Sink
+	entries chan []byte
+
+	dropLock sync.Mutex
+	dropped  int
+	lastWarn time.Time
+}
+
+func newQueuedSink(sink Sink, bufferSize int) *queuedSink {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSinkBufferSize
+	}
+	return &queuedSink{
+		sink:    sink,
+		entries: make(chan []byte, bufferSize),
+	}
+}
+
+// enqueue queues the entry for delivery without blocking. It returns false if the entry was dropped.
+func (q *queuedSink) enqueue(entry []byte) bool {
+	select {
+	case q.entries <- entry:
+		return true
+	default:
+	}
+
+	q.dropLock.Lock()
+	defer q.dropLock.Unlock()
+
+	q.dropped++
+	if time.Since(q.lastWarn) > errorDebounceTime {
+		logrus.Warnf("Audit log sink %s is not keeping up, dropped %d entries", q.sink.Name(), q.dropped)
+		q.lastWarn = time.Now()
+		q.dropped = 0
+	}
+	return false
+}
+
+// run writes queued entries to the sink until the context is canceled, at which point the remaining
+// entries are drained and the sink is closed.
+func (q *queuedSink) run(ctx context.Context) {
+	ticker := time.NewTicker(sinkFlushInterval)
+	defer ticker.Stop()
+
+	var lastErr time.Time
+	logErr := func(msg string, err error) {
+		if err != nil && time.Since(lastErr) > errorDebounceTime {
+			logrus.Warnf("%s %s: %v", msg, q.sink.Name(), err)
+			lastErr = time.Now()
+		}
+	}
+	write := func(entry []byte) {
+		logErr("Failed to write audit log to sink", q.sink.Write(entry))
+	}
+
+	for {
+		select {
+		case entry := <-q.entries:
+			write(entry)
+		case <-ticker.C:
+			if f, ok := q.sink.(Flusher); ok {
+				logErr("Failed to flush audit log sink", f.Flush())
+			}
+		case <-ctx.Done():
+			q.drain(write)
+			if err := q.sink.Close(); err != nil {
+				logrus.Warnf("Failed to close audit log sink %s: %v", q.sink.Name(), err)
+			}
+			return
+		}
+	}
+}
+
+func (q *queuedSink) drain(write func([]byte)) {
+	for {
+		select {
+		case entry := <-q.entries:
+			write(entry)
+		default:
+			return
+		}
+	}
+}
+
+// WriterSink writes audit entries to an io.Writer such as os.Stdout.
+type WriterSink struct {
+	name  string
+	level Level
+	lock  sync.Mutex
+	out   io.Writer
+}
+
+// NewWriterSink returns a sink that writes entries at the given level to out.
+func NewWriterSink(name string, level Level, out io.Writer) *WriterSink {
+	return &WriterSink{
+		name:  name,
+		level: level,
+		out:   out,
+	}
+}
+
+func (w *WriterSink) Name() string {
+	return w.name
+}
+
+func (w *WriterSink) Level() Level {
+	return w.level
+}
+
+func (w *WriterSink) Write(entry []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err := w.out.Write(entry)
+	return err
+}
+
+func (w *WriterSink) Close() error {
+	return nil
+}
@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	level   Level
+	lock    sync.Mutex
+	entries []string
+}
+
+func (m *memorySink) Name() string { return "memory" }
+
+func (m *memorySink) Level() Level { return m.level }
+
+func (m *memorySink) Write(entry []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.entries = append(m.entries, string(entry))
+	return nil
+}
+
+func (m *memorySink) Close() error { return nil }
+
+func (m *memorySink) written() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]string(nil), m.entries...)
+}
+
+func TestQueuedSinkDropsWhenFull(t *testing.T) {
+	sink := &memorySink{level: LevelMetadata}
+	q := newQueuedSink(sink, 2)
+
+	assert.True(t, q.enqueue([]byte("1")))
+	assert.True(t, q.enqueue([]byte("2")))
+	assert.False(t, q.enqueue([]byte("3")), "expected entry to be dropped when the queue is full")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.run(ctx)
+
+	assert.Equal(t, []string{"1", "2"}, sink.written())
+}
+
+func TestLogWriterPerSinkLevel(t *testing.T) {
+	metadataSink := &memorySink{level: LevelMetadata}
+	requestSink := &memorySink{level: LevelRequest}
+	writer := NewLogWriter("", LevelNull, 0, 0, 0, metadataSink, requestSink)
+	require.NotNil(t, writer)
+	assert.Nil(t, writer.Output)
+	assert.Equal(t, LevelRequest, writer.captureLevel())
+
+	req, err := http.NewRequest(http.MethodPost, "/v3/test", strings.NewReader(`{"name":"test"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	auditLog, err := newAuditLog(writer, req, regexp.MustCompile(`[pP]assword`), LevelRequestResponse)
+	require.NoError(t, err)
+	require.NoError(t, auditLog.write(&User{Name: "u-test"}, req.Header, http.Header{}, http.StatusOK, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, s := range writer.sinks {
+		s.run(ctx)
+	}
+
+	require.Len(t, metadataSink.written(), 1)
+	require.Len(t, requestSink.written(), 1)
+	assert.NotContains(t, metadataSink.written()[0], "requestBody")
+	assert.Contains(t, requestSink.written()[0], `"requestBody":{"name":"test"}`)
+}
+
+func TestWriteSystemAction(t *testing.T) {
+	sink := &memorySink{level: LevelRequestResponse}
+	writer := NewLogWriter("", LevelNull, 0, 0, 0, sink)
+	require.NotNil(t, writer)
+
+	writer.WriteSystemAction(http.MethodDelete, "/apis/management.cattle.io/v3/globalrolebindings/grb-test", map[string]string{"reason": "expired"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, s := range writer.sinks {
+		s.run(ctx)
+	}
+
+	require.Len(t, sink.written(), 1)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(sink.written()[0]), &entry))
+	assert.Equal(t, http.MethodDelete, entry["method"])
+	assert.Equal(t, "/apis/management.cattle.io/v3/globalrolebindings/grb-test", entry["requestURI"])
+	assert.Equal(t, map[string]interface{}{"name": SystemUserName}, entry["user"])
+	assert.Equal(t, map[string]interface{}{"reason": "expired"}, entry["annotations"])
+
+	// A nil writer, used when audit logging is disabled, does nothing.
+	(*LogWriter)(nil).WriteSystemAction(http.MethodDelete, "/", nil)
+}
+
+func TestNewLogWriterNothingToWrite(t *testing.T) {
+	assert.Nil(t, NewLogWriter("", LevelMetadata, 0, 0, 0))
+	assert.Nil(t, NewLogWriter("/tmp/audit.log", LevelNull, 0, 0, 0))
+	assert.Nil(t, NewLogWriter("", LevelNull, 0, 0, 0, &memorySink{level: LevelNull}))
+}
+
+func TestSyslogSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	sink := NewSyslogSink(listener.Addr().String(), LevelMetadata, nil)
+	sink.hostname = "rancher-0"
+	sink.procID = "1"
+	sink.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	require.NoError(t, sink.Write([]byte(`{"auditID":"1"}`+"\n")))
+	require.NoError(t, sink.Close())
+
+	msg := `<110>1 2024-01-02T03:04:05Z rancher-0 rancher 1 audit - {"auditID":"1"}`
+	select {
+	case got := <-received:
+		assert.Equal(t, "71 "+msg, got)
+		assert.Len(t, msg, 71)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for syslog message")
+	}
+}
+
+func TestWebhookSinkBatchesAndSpools(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		failing  = true
+		received [][]map[string]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, batch)
+	}))
+	defer server.Close()
+
+	spoolPath := filepath.Join(t.TempDir(), "audit.spool")
+	sink := NewWebhookSink(server.URL, LevelMetadata, server.Client(), 2, spoolPath)
+	sink.backoff = time.Millisecond
+
+	require.NoError(t, sink.Write([]byte(`{"auditID":"1"}`+"\n")))
+	assert.Error(t, sink.Write([]byte(`{"auditID":"2"}`+"\n")), "expected full batch to fail while the webhook is unavailable")
+
+	spooled, err := os.ReadFile(spoolPath)
+	require.NoError(t, err)
+	assert.Equal(t, `{"auditID":"1"}`+"\n"+`{"auditID":"2"}`+"\n", string(spooled))
+
+	lock.Lock()
+	failing = false
+	lock.Unlock()
+
+	require.NoError(t, sink.Write([]byte(`{"auditID":"3"}`+"\n")))
+	require.NoError(t, sink.Close())
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, received, 2)
+	assert.Equal(t, []map[string]string{{"auditID": "3"}}, received[0])
+	assert.Equal(t, []map[string]string{{"auditID": "1"}, {"auditID": "2"}}, received[1])
+
+	_, err = os.Stat(spoolPath)
+	assert.True(t, os.IsNotExist(err), "expected spool file to be removed after resending")
+}
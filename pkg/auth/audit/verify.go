@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+)
+
+// VerifyProblem describes a record that breaks the hash chain.
+type VerifyProblem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Seq     uint64 `json:"seq,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p VerifyProblem) String() string {
+	if p.Seq == 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: seq %d: %s", p.File, p.Line, p.Seq, p.Message)
+}
+
+// VerifyReport summarizes the verification of an audit log and its rotated backups.
+type VerifyReport struct {
+	Files      []string `json:"files"`
+	Records    int      `json:"records"`
+	Unchained  int      `json:"unchained"`
+	Signatures int      `json:"signatures"`
+	FirstSeq   uint64   `json:"firstSeq"`
+	LastSeq    uint64   `json:"lastSeq"`
+	// UnsignedTail is the number of records not covered by a valid signature yet. They are linked to
+	// the chain but can't be authenticated until the next signature is written.
+	UnsignedTail int             `json:"unsignedTail"`
+	Problems     []VerifyProblem `json:"problems,omitempty"`
+}
+
+// OK returns true if no problems were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify walks the audit log at path and its rotated backups from oldest to newest and checks that the
+// records form an unbroken hash chain. Sequence gaps, records whose predecessor hash doesn't match and
+// invalid signatures are reported as problems. If key is empty signatures are not checked.
+func Verify(path string, key []byte) (*VerifyReport, error) {
+	files, err := logFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audit log found at %s", path)
+	}
+
+	v := &verifier{report: &VerifyReport{Files: files}, key: key}
+	for _, file := range files {
+		if err := v.verifyFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return v.report, nil
+}
+
+type verifier struct {
+	report   *VerifyReport
+	key      []byte
+	started  bool
+	seq      uint64
+	prevHash string
+}
+
+func (v *verifier) verifyFile(file string) error {
+	f, err := openLogFile(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := newRecordScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := bytes.TrimSpace(scanner.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+		v.verifyRecord(file, line, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log %s: %w", file, err)
+	}
+	return nil
+}
+
+func (v *verifier) verifyRecord(file string, line int, record []byte) {
+	report := v.report
+	report.Records++
+
+	problem := func(seq uint64, format string, args ...interface{}) {
+		report.Problems = append(report.Problems, VerifyProblem{File: file, Line: line, Seq: seq, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var fields chainFields
+	if err := json.Unmarshal(record, &fields); err != nil {
+		problem(0, "malformed record: %v", err)
+		// The next record can't be linked to a record that failed to parse.
+		v.prevHash = hashRecord(record)
+		v.seq++
+		return
+	}
+
+	if fields.Seq == nil {
+		if v.started {
+			problem(0, "record is missing from the hash chain")
+		} else {
+			report.Unchained++
+		}
+		return
+	}
+
+	seq := *fields.Seq
+	switch {
+	case !v.started:
+		// Older records may have been removed by log rotation, so the chain can start at any sequence number.
+		report.FirstSeq = seq
+	case seq == 1 && fields.PrevHash == "":
+		problem(seq, "hash chain restarted after seq %d", v.seq)
+	case seq != v.seq+1:
+		problem(seq, "expected seq %d, records are missing or were reordered", v.seq+1)
+	case fields.PrevHash != v.prevHash:
+		problem(seq, "previous hash does not match, this record or the one before it was modified")
+	}
+
+	if fields.Signature != "" && len(v.key) > 0 {
+		expected := signRecord(v.key, seq, fields.PrevHash)
+		if hmac.Equal([]byte(expected), []byte(fields.Signature)) {
+			// The signature covers every record before this one, the record itself is covered by the next signature.
+			report.Signatures++
+			report.UnsignedTail = 1
+		} else {
+			problem(seq, "invalid signature")
+			report.UnsignedTail++
+		}
+	} else {
+		report.UnsignedTail++
+	}
+
+	v.started = true
+	v.seq = seq
+	v.prevHash = hashRecord(record)
+	report.LastSeq = seq
+}
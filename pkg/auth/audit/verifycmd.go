@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/urfave/cli"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// SigningKeySecretField is the field of the signing secret holding the HMAC key for the audit log hash chain.
+	SigningKeySecretField = "key"
+
+	defaultAuditLogPath = "/var/log/auditlog/rancher-api-audit.log"
+)
+
+// RegisterVerifyCommand registers the verify-audit-log command, which checks the hash chain of the audit log.
+func RegisterVerifyCommand() {
+	reexec.Register("/usr/bin/verify-audit-log", verifyAuditLog)
+	reexec.Register("verify-audit-log", verifyAuditLog)
+}
+
+// SigningKeyFromSecret returns the audit log signing key stored in secret.
+func SigningKeyFromSecret(secret *corev1.Secret) ([]byte, error) {
+	key := secret.Data[SigningKeySecretField]
+	if len(key) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has no %s field", secret.Namespace, secret.Name, SigningKeySecretField)
+	}
+	return key, nil
+}
+
+func verifyAuditLog() {
+	app := cli.NewApp()
+	app.Usage = "Verify the hash chain of the Rancher API audit log and its rotated backups"
+	app.ArgsUsage = "[path]"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "key-file",
+			Usage: "File containing the audit log signing key",
+		},
+		cli.StringFlag{
+			Name:  "secret-namespace",
+			Value: "cattle-system",
+			Usage: "Namespace of the secret holding the audit log signing key",
+		},
+		cli.StringFlag{
+			Name:  "secret-name",
+			Usage: "Name of the secret holding the audit log signing key, signatures are not checked if neither this nor key-file is set",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the report as JSON",
+		},
+	}
+
+	app.Action = func(c *cli.Context) error {
+		path := c.Args().First()
+		if path == "" {
+			path = defaultAuditLogPath
+		}
+
+		key, err := verifyKey(c)
+		if err != nil {
+			return err
+		}
+
+		report, err := Verify(path, key)
+		if err != nil {
+			return err
+		}
+
+		if c.Bool("json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+		} else {
+			printReport(report, len(key) > 0)
+		}
+
+		if !report.OK() {
+			return fmt.Errorf("audit log verification failed with %d problems", len(report.Problems))
+		}
+		return nil
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func verifyKey(c *cli.Context) ([]byte, error) {
+	if keyFile := c.String("key-file"); keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		return key, nil
+	}
+
+	name := c.String("secret-name")
+	if name == "" {
+		return nil, nil
+	}
+
+	kubeConfigPath := os.ExpandEnv("$HOME/.kube/config")
+	if _, err := os.Stat(kubeConfigPath); err != nil {
+		kubeConfigPath = ""
+	}
+	conf, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get kubeconfig: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get kubernetes client: %w", err)
+	}
+
+	secret, err := client.CoreV1().Secrets(c.String("secret-namespace")).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing key secret: %w", err)
+	}
+	return SigningKeyFromSecret(secret)
+}
+
+func printReport(report *VerifyReport, signaturesChecked bool) {
+	fmt.Printf("Files checked: %d\n", len(report.Files))
+	fmt.Printf("Records: %d (seq %d to %d)\n", report.Records, report.FirstSeq, report.LastSeq)
+	if report.Unchained > 0 {
+		fmt.Printf("Records written before hash chaining was enabled: %d\n", report.Unchained)
+	}
+	if signaturesChecked {
+		fmt.Printf("Valid signatures: %d\n", report.Signatures)
+		fmt.Printf("Records not yet covered by a signature: %d\n", report.UnsignedTail)
+	} else {
+		fmt.Println("Signatures were not checked, no signing key was given")
+	}
+	for _, p := range report.Problems {
+		fmt.Println(p.String())
+	}
+	if report.OK() {
+		fmt.Println("OK")
+	}
+}
@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWebhookBatchSize is the maximum number of entries sent in a single webhook request.
+	DefaultWebhookBatchSize = 100
+	// DefaultWebhookSpoolMaxSize is the maximum size in bytes of the local spool file.
+	DefaultWebhookSpoolMaxSize = 100 * 1024 * 1024
+
+	webhookRetries      = 3
+	webhookRetryBackoff = time.Second
+	webhookTimeout      = time.Second * 30
+)
+
+// WebhookSink posts audit entries in batches to an HTTP endpoint. Each request carries a JSON array
+// of entries. Batches that cannot be delivered after retrying are appended to a local spool file and
+// resent once the endpoint is reachable again.
+type WebhookSink struct {
+	level        Level
+	url          string
+	client       *http.Client
+	batchSize    int
+	spoolPath    string
+	spoolMaxSize int64
+	backoff      time.Duration
+
+	batch [][]byte
+}
+
+// NewWebhookSink returns a sink that posts entries at the given level to url. If spoolPath is empty,
+// undeliverable batches are dropped.
+func NewWebhookSink(url string, level Level, client *http.Client, batchSize int, spoolPath string) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultWebhookBatchSize
+	}
+	return &WebhookSink{
+		level:        level,
+		url:          url,
+		client:       client,
+		batchSize:    batchSize,
+		spoolPath:    spoolPath,
+		spoolMaxSize: DefaultWebhookSpoolMaxSize,
+		backoff:      webhookRetryBackoff,
+	}
+}
+
+func (w *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookSink) Level() Level {
+	return w.level
+}
+
+// Write adds the entry to the current batch and sends the batch once it is full.
+func (w *WebhookSink) Write(entry []byte) error {
+	w.batch = append(w.batch, bytes.TrimSuffix(entry, []byte("\n")))
+	if len(w.batch) < w.batchSize {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush sends the current batch. On success any previously spooled entries are resent as well.
+func (w *WebhookSink) Flush() error {
+	if len(w.batch) == 0 {
+		return w.resendSpool()
+	}
+
+	batch := w.batch
+	w.batch = nil
+	if err := w.send(batch); err != nil {
+		if spoolErr := w.spool(batch); spoolErr != nil {
+			return fmt.Errorf("%w; failed to spool %d entries: %v", err, len(batch), spoolErr)
+		}
+		return err
+	}
+
+	return w.resendSpool()
+}
+
+func (w *WebhookSink) Close() error {
+	return w.Flush()
+}
+
+// send posts the batch, retrying with an exponential backoff on connection errors and 5xx responses.
+func (w *WebhookSink) send(batch [][]byte) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	buf.Write(bytes.Join(batch, []byte(",")))
+	buf.WriteByte(']')
+	body := buf.Bytes()
+
+	backoff := w.backoff
+	var err error
+	for attempt := 0; attempt < webhookRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = w.post(body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (w *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send audit logs to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return true, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return false, fmt.Errorf("webhook rejected audit logs with status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// spool appends the batch to the spool file, one entry per line.
+func (w *WebhookSink) spool(batch [][]byte) error {
+	if w.spoolPath == "" {
+		return errors.New("no spool file configured")
+	}
+
+	if info, err := os.Stat(w.spoolPath); err == nil && info.Size() >= w.spoolMaxSize {
+		return fmt.Errorf("spool file %s exceeds %d bytes", w.spoolPath, w.spoolMaxSize)
+	}
+
+	f, err := os.OpenFile(w.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	for _, entry := range batch {
+		if _, err := f.Write(append(entry, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// resendSpool delivers spooled entries in batches and removes the spool file once all of them were sent.
+func (w *WebhookSink) resendSpool() error {
+	if w.spoolPath == "" {
+		return nil
+	}
+
+	f, err := os.Open(w.spoolPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open spool file: %w", err)
+	}
+
+	var (
+		sent    int
+		pending [][]byte
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		pending = append(pending, bytes.Clone(scanner.Bytes()))
+		if len(pending) < w.batchSize {
+			continue
+		}
+		if err := w.send(pending); err != nil {
+			f.Close()
+			return w.rewriteSpool(sent, err)
+		}
+		sent += len(pending)
+		pending = nil
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read spool file: %w", err)
+	}
+	f.Close()
+
+	if len(pending) > 0 {
+		if err := w.send(pending); err != nil {
+			return w.rewriteSpool(sent, err)
+		}
+		sent += len(pending)
+	}
+
+	logrus.Debugf("Resent %d spooled audit log entries to webhook", sent)
+	return os.Remove(w.spoolPath)
+}
+
+// rewriteSpool drops the first sent entries from the spool file after a partial resend.
+func (w *WebhookSink) rewriteSpool(sent int, sendErr error) error {
+	if sent == 0 {
+		return sendErr
+	}
+
+	data, err := os.ReadFile(w.spoolPath)
+	if err != nil {
+		return fmt.Errorf("%w; failed to read spool file: %v", sendErr, err)
+	}
+	lines := bytes.SplitAfterN(data, []byte("\n"), sent+1)
+	if len(lines) <= sent {
+		return fmt.Errorf("%w; spool file is shorter than expected", sendErr)
+	}
+	if err := os.WriteFile(w.spoolPath, lines[sent], 0600); err != nil {
+		return fmt.Errorf("%w; failed to rewrite spool file: %v", sendErr, err)
+	}
+	return sendErr
+}
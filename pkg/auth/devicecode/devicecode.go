@@ -0,0 +1,579 @@
+// Package devicecode implements the OAuth 2.0 device authorization grant (RFC 8628) for clients such as
+// client.authentication.k8s.io exec credential plugins. A client requests a device code, asks the user to approve its
+// user code in a browser where they are logged in to Rancher, and polls for a short-lived kubeconfig token once
+// approved. The kubeconfigs generated by Rancher don't use it, their exec credential plugin still runs rancher token.
+//
+// Pending authorizations are stored as secrets so that any Rancher replica can serve the polling requests.
+// Only the SHA-256 hash of the device code is stored, as the name of the secret.
+package devicecode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/tokens"
+	"github.com/rancher/rancher/pkg/auth/util"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/types/config"
+	"github.com/rancher/rancher/pkg/user"
+	wcorev1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/randomtoken"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	// Endpoint is the path prefix of the device authorization endpoints.
+	Endpoint = "/v1-device-auth"
+	// CodePath is the unauthenticated device authorization endpoint the plugin requests a device code from.
+	CodePath = Endpoint + "/code"
+	// TokenPath is the unauthenticated token endpoint the plugin polls with the device code.
+	TokenPath = Endpoint + "/token"
+	// VerifyPath is the authenticated verification endpoint users look up and approve user codes with.
+	VerifyPath = Endpoint + "/verify"
+
+	// GrantType is the grant type of token requests.
+	GrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// SecretKind is the value of the tokens.TokenKindLabel of the secrets of pending authorizations.
+	SecretKind = "device-authorization"
+	// UserCodeLabel is the label holding the normalized user code of a pending authorization.
+	UserCodeLabel = "authn.management.cattle.io/device-user-code"
+
+	secretNamePrefix = "device-auth-"
+
+	keyClusterID  = "clusterID"
+	keyClientIP   = "clientIP"
+	keyUserAgent  = "userAgent"
+	keyExpiresAt  = "expiresAt"
+	keyState      = "state"
+	keyUserID     = "userID"
+	keyTokenName  = "tokenName"
+	statePending  = "pending"
+	stateApproved = "approved"
+	stateDenied   = "denied"
+
+	// userCodeAlphabet leaves out vowels and easily confused characters, as recommended by RFC 8628 section 6.1.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// expiresIn is kept short, as device codes are requested without authentication and expired authorizations
+	// are deleted.
+	expiresIn    = 5 * time.Minute
+	pollInterval = 5 // seconds
+
+	// maxCodesPerClient caps the device codes a client can request per expiresIn from each replica, as device codes
+	// are requested without authentication.
+	maxCodesPerClient = 10
+	// pruneInterval is the minimum interval between deletions of expired authorizations.
+	pruneInterval = time.Minute
+)
+
+// OAuth 2.0 error codes of token responses, see RFC 8628 section 3.5.
+const (
+	errAuthorizationPending = "authorization_pending"
+	errAccessDenied         = "access_denied"
+	errExpiredToken         = "expired_token"
+	errInvalidRequest       = "invalid_request"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errSlowDown             = "slow_down"
+	errServerError          = "server_error"
+)
+
+// kubeconfigTokenFunc returns a new kubeconfig token of a user for the cluster, or all clusters if empty.
+type kubeconfigTokenFunc func(userID, clusterID string, userPrincipal v3.Principal) (*v3.Token, string, error)
+
+// Handler serves the device authorization endpoints.
+type Handler struct {
+	secrets         wcorev1.SecretClient
+	tokenCache      mgmtcontrollers.TokenCache
+	kubeconfigToken kubeconfigTokenFunc
+	router          *mux.Router
+	limiter         *clientLimiter
+
+	pruneLock  sync.Mutex
+	lastPruned time.Time
+}
+
+// NewHandler returns a handler serving the device authorization endpoints.
+func NewHandler(scaledContext *config.ScaledContext) *Handler {
+	userManager := scaledContext.UserManager
+	return newHandler(
+		scaledContext.Wrangler.Core.Secret(),
+		scaledContext.Wrangler.Mgmt.Token().Cache(),
+		func(userID, clusterID string, userPrincipal v3.Principal) (*v3.Token, string, error) {
+			ttl, err := tokens.GetKubeconfigExecTokenTTLInMilliSeconds()
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to get exec token TTL: %w", err)
+			}
+			name := "kubeconfig-" + userID
+			if clusterID != "" {
+				name = fmt.Sprintf("kubeconfig-%s.%s", userID, clusterID)
+			}
+			fullToken, err := userManager.EnsureClusterToken(clusterID, user.TokenInput{
+				TokenName:     name,
+				Description:   "Kubeconfig token",
+				Kind:          "kubeconfig",
+				UserName:      userID,
+				AuthProvider:  userPrincipal.Provider,
+				TTL:           ttl,
+				Randomize:     true,
+				UserPrincipal: userPrincipal,
+			})
+			if err != nil {
+				return nil, "", err
+			}
+			tokenName, value := tokens.SplitTokenParts(fullToken)
+			return &v3.Token{ObjectMeta: metav1.ObjectMeta{Name: tokenName}, TTLMillis: *ttl}, value, nil
+		},
+	)
+}
+
+func newHandler(secrets wcorev1.SecretClient, tokenCache mgmtcontrollers.TokenCache, kubeconfigToken kubeconfigTokenFunc) *Handler {
+	h := &Handler{
+		secrets:         secrets,
+		tokenCache:      tokenCache,
+		kubeconfigToken: kubeconfigToken,
+		limiter:         newClientLimiter(maxCodesPerClient, expiresIn),
+	}
+
+	r := mux.NewRouter()
+	r.UseEncodedPath()
+	r.Path(CodePath).Methods(http.MethodPost).HandlerFunc(h.deviceAuthorization)
+	r.Path(TokenPath).Methods(http.MethodPost).HandlerFunc(h.token)
+	r.Path(VerifyPath).Methods(http.MethodGet).HandlerFunc(h.lookup)
+	r.Path(VerifyPath).Methods(http.MethodPost).HandlerFunc(h.verify)
+	h.router = r
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	h.router.ServeHTTP(rw, req)
+}
+
+// DeviceAuthorizationResponse is the response of the device authorization endpoint, see RFC 8628 section 3.2.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// TokenResponse is the successful response of the token endpoint, see RFC 6749 section 5.1.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+}
+
+// PendingAuthorization describes an authorization waiting for the approval of a user.
+type PendingAuthorization struct {
+	UserCode  string `json:"userCode"`
+	ClusterID string `json:"clusterID,omitempty"`
+	ClientIP  string `json:"clientIP,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// VerifyInput approves or denies the authorization of a user code.
+type VerifyInput struct {
+	UserCode string `json:"userCode"`
+	Approved bool   `json:"approved"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// deviceAuthorization creates a pending authorization. The optional cluster_id form parameter scopes the token to a cluster.
+func (h *Handler) deviceAuthorization(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(rw, http.StatusBadRequest, errInvalidRequest, "failed to parse form")
+		return
+	}
+
+	clientIP := util.ClientIP(req)
+	if !h.limiter.allow(clientKey(req)) {
+		writeError(rw, http.StatusTooManyRequests, errSlowDown, "too many device codes requested")
+		return
+	}
+	h.pruneExpired()
+
+	deviceCode, err := randomtoken.Generate()
+	if err != nil {
+		logrus.Errorf("[devicecode] Failed to generate device code: %v", err)
+		writeError(rw, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		logrus.Errorf("[devicecode] Failed to generate user code: %v", err)
+		writeError(rw, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	userAgent := req.UserAgent()
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName(deviceCode),
+			Namespace: tokens.SecretNamespace,
+			Labels: map[string]string{
+				tokens.TokenKindLabel: SecretKind,
+				UserCodeLabel:         userCode,
+			},
+		},
+		StringData: map[string]string{
+			keyClusterID: req.PostForm.Get("cluster_id"),
+			keyClientIP:  clientIP,
+			keyUserAgent: userAgent,
+			keyExpiresAt: time.Now().Add(expiresIn).UTC().Format(time.RFC3339),
+			keyState:     statePending,
+		},
+	}
+	if _, err := h.secrets.Create(secret); err != nil {
+		logrus.Errorf("[devicecode] Failed to create pending authorization: %v", err)
+		writeError(rw, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	verificationURI := serverURL(req) + VerifyPath
+	writeJSON(rw, http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + formatUserCode(userCode),
+		ExpiresIn:               int(expiresIn.Seconds()),
+		Interval:                pollInterval,
+	})
+}
+
+// token exchanges an approved device code for a kubeconfig token. The device code can only be exchanged once.
+func (h *Handler) token(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(rw, http.StatusBadRequest, errInvalidRequest, "failed to parse form")
+		return
+	}
+	if grantType := req.PostForm.Get("grant_type"); grantType != GrantType {
+		writeError(rw, http.StatusBadRequest, errUnsupportedGrantType, "")
+		return
+	}
+	deviceCode := req.PostForm.Get("device_code")
+	if deviceCode == "" {
+		writeError(rw, http.StatusBadRequest, errInvalidRequest, "device_code is required")
+		return
+	}
+
+	secret, err := h.secrets.Get(tokens.SecretNamespace, secretName(deviceCode), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		writeError(rw, http.StatusBadRequest, errExpiredToken, "")
+		return
+	} else if err != nil {
+		logrus.Errorf("[devicecode] Failed to get authorization: %v", err)
+		writeError(rw, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+	if isExpired(secret) {
+		h.delete(secret)
+		writeError(rw, http.StatusBadRequest, errExpiredToken, "")
+		return
+	}
+
+	switch string(secret.Data[keyState]) {
+	case statePending:
+		writeError(rw, http.StatusBadRequest, errAuthorizationPending, "")
+		return
+	case stateApproved:
+	default:
+		h.delete(secret)
+		writeError(rw, http.StatusBadRequest, errAccessDenied, "")
+		return
+	}
+
+	// Deleting the authorization first ensures the device code can't be exchanged twice, even by concurrent requests.
+	if err := h.secrets.Delete(secret.Namespace, secret.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &secret.UID},
+	}); err != nil {
+		writeError(rw, http.StatusBadRequest, errExpiredToken, "")
+		return
+	}
+
+	approvingToken, err := h.tokenCache.Get(string(secret.Data[keyTokenName]))
+	if err != nil || approvingToken.UserID != string(secret.Data[keyUserID]) ||
+		tokens.IsExpired(*approvingToken) || tokens.IsIdle(*approvingToken) {
+		// The user logged out since approving the authorization.
+		writeError(rw, http.StatusBadRequest, errAccessDenied, "")
+		return
+	}
+
+	token, value, err := h.kubeconfigToken(approvingToken.UserID, string(secret.Data[keyClusterID]), approvingToken.UserPrincipal)
+	if err != nil {
+		logrus.Errorf("[devicecode] Failed to create kubeconfig token for user %s: %v", approvingToken.UserID, err)
+		writeError(rw, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, TokenResponse{
+		AccessToken: token.Name + ":" + value,
+		TokenType:   "Bearer",
+		ExpiresIn:   token.TTLMillis / 1000,
+	})
+}
+
+// lookup returns the pending authorization of the user_code query parameter, for users to check what they approve.
+func (h *Handler) lookup(rw http.ResponseWriter, req *http.Request) {
+	if _, ok := request.UserFrom(req.Context()); !ok {
+		writeError(rw, http.StatusUnauthorized, errAccessDenied, "")
+		return
+	}
+
+	secret, status, err := h.pendingByUserCode(req.URL.Query().Get("user_code"))
+	if err != nil {
+		writeError(rw, status, errInvalidRequest, err.Error())
+		return
+	}
+	writeJSON(rw, http.StatusOK, PendingAuthorization{
+		UserCode:  formatUserCode(secret.Labels[UserCodeLabel]),
+		ClusterID: string(secret.Data[keyClusterID]),
+		ClientIP:  string(secret.Data[keyClientIP]),
+		UserAgent: string(secret.Data[keyUserAgent]),
+		ExpiresAt: string(secret.Data[keyExpiresAt]),
+	})
+}
+
+// verify approves or denies a pending authorization on behalf of the requesting user. Only JSON requests are accepted,
+// which browsers don't send cross-site without a CORS preflight, so that other sites can't approve authorizations.
+func (h *Handler) verify(rw http.ResponseWriter, req *http.Request) {
+	userInfo, ok := request.UserFrom(req.Context())
+	if !ok {
+		writeError(rw, http.StatusUnauthorized, errAccessDenied, "")
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(rw, http.StatusUnsupportedMediaType, errInvalidRequest, "content type must be application/json")
+		return
+	}
+
+	var input VerifyInput
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+		writeError(rw, http.StatusBadRequest, errInvalidRequest, "failed to parse body")
+		return
+	}
+
+	// The kubeconfig token is created for the principal of the token the user approved the authorization with.
+	tokenName, _ := tokens.SplitTokenParts(tokens.GetTokenAuthFromRequest(req))
+	approvingToken, err := h.tokenCache.Get(tokenName)
+	if err != nil || approvingToken.UserID != userInfo.GetName() {
+		writeError(rw, http.StatusForbidden, errAccessDenied, "authorizations can only be approved with a Rancher token")
+		return
+	}
+
+	secret, status, err := h.pendingByUserCode(input.UserCode)
+	if err != nil {
+		writeError(rw, status, errInvalidRequest, err.Error())
+		return
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[keyUserID] = []byte(userInfo.GetName())
+	secret.Data[keyTokenName] = []byte(approvingToken.Name)
+	secret.Data[keyState] = []byte(stateDenied)
+	if input.Approved {
+		secret.Data[keyState] = []byte(stateApproved)
+	}
+	if _, err := h.secrets.Update(secret); err != nil {
+		if apierrors.IsConflict(err) {
+			writeError(rw, http.StatusConflict, errInvalidRequest, "the authorization was changed concurrently")
+			return
+		}
+		logrus.Errorf("[devicecode] Failed to update authorization: %v", err)
+		writeError(rw, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	logrus.Infof("[devicecode] User %s %s device authorization for cluster %q", userInfo.GetName(), secret.Data[keyState], secret.Data[keyClusterID])
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// pendingByUserCode returns the pending authorization of a user code along with the HTTP status of the error, if any.
+func (h *Handler) pendingByUserCode(userCode string) (*corev1.Secret, int, error) {
+	userCode = normalizeUserCode(userCode)
+	if len(userCode) != userCodeLength {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid user code")
+	}
+
+	selector := labels.Set{tokens.TokenKindLabel: SecretKind, UserCodeLabel: userCode}.AsSelector().String()
+	secrets, err := h.secrets.List(tokens.SecretNamespace, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logrus.Errorf("[devicecode] Failed to list authorizations: %v", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to get the authorization")
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if string(secret.Data[keyState]) == statePending && !isExpired(secret) {
+			return secret, http.StatusOK, nil
+		}
+	}
+	return nil, http.StatusNotFound, fmt.Errorf("no pending authorization for user code %s", formatUserCode(userCode))
+}
+
+// pruneExpired deletes expired authorizations, at most once per pruneInterval.
+func (h *Handler) pruneExpired() {
+	h.pruneLock.Lock()
+	if time.Since(h.lastPruned) < pruneInterval {
+		h.pruneLock.Unlock()
+		return
+	}
+	h.lastPruned = time.Now()
+	h.pruneLock.Unlock()
+
+	selector := labels.Set{tokens.TokenKindLabel: SecretKind}.AsSelector().String()
+	secrets, err := h.secrets.List(tokens.SecretNamespace, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logrus.Warnf("[devicecode] Failed to list authorizations: %v", err)
+		return
+	}
+	for i := range secrets.Items {
+		if isExpired(&secrets.Items[i]) {
+			h.delete(&secrets.Items[i])
+		}
+	}
+}
+
+// clientKey returns the key device code requests are limited by: the client_id form parameter and, if trusted proxies
+// are configured, the address of the client. Without trusted proxies, the remote address is a proxy or load balancer
+// shared by all clients, which an attacker could exhaust for everyone, and X-Forwarded-For can be forged.
+func clientKey(req *http.Request) string {
+	return req.PostForm.Get("client_id") + "/" + util.DistinctClientIP(req)
+}
+
+// clientLimiter limits the requests of each client to a number per window. The requests are counted in memory, so the
+// limit applies per Rancher replica.
+type clientLimiter struct {
+	limit  int
+	window time.Duration
+
+	lock    sync.Mutex
+	clients map[string]*clientWindow
+}
+
+type clientWindow struct {
+	start    time.Time
+	requests int
+}
+
+func newClientLimiter(limit int, window time.Duration) *clientLimiter {
+	return &clientLimiter{
+		limit:   limit,
+		window:  window,
+		clients: map[string]*clientWindow{},
+	}
+}
+
+// allow records a request of the client and returns whether it is within the limit.
+func (l *clientLimiter) allow(client string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	for key, w := range l.clients {
+		if now.Sub(w.start) >= l.window {
+			delete(l.clients, key)
+		}
+	}
+
+	w := l.clients[client]
+	if w == nil {
+		w = &clientWindow{start: now}
+		l.clients[client] = w
+	}
+	if w.requests >= l.limit {
+		return false
+	}
+	w.requests++
+	return true
+}
+
+func (h *Handler) delete(secret *corev1.Secret) {
+	if err := h.secrets.Delete(secret.Namespace, secret.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		logrus.Warnf("[devicecode] Failed to delete authorization %s: %v", secret.Name, err)
+	}
+}
+
+func isExpired(secret *corev1.Secret) bool {
+	expiresAt, err := time.Parse(time.RFC3339, string(secret.Data[keyExpiresAt]))
+	return err != nil || !time.Now().Before(expiresAt)
+}
+
+func secretName(deviceCode string) string {
+	hash := sha256.Sum256([]byte(deviceCode))
+	return secretNamePrefix + hex.EncodeToString(hash[:])
+}
+
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode removes the separators users may type and upper-cases the user code.
+func normalizeUserCode(userCode string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+}
+
+// formatUserCode splits a normalized user code in two halves to make it easier to type.
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+func serverURL(req *http.Request) string {
+	if serverURL := settings.ServerURL.Get(); serverURL != "" {
+		return strings.TrimSuffix(serverURL, "/")
+	}
+	return "https://" + util.GetHost(req)
+}
+
+func writeError(rw http.ResponseWriter, status int, code, description string) {
+	writeJSON(rw, status, errorResponse{Error: code, ErrorDescription: description})
+}
+
+func writeJSON(rw http.ResponseWriter, status int, obj any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		logrus.Errorf("[devicecode] Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package devicecode
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/tokens"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+type testHandler struct {
+	*Handler
+	secrets    *fake.MockClientInterface[*corev1.Secret, *corev1.SecretList]
+	tokenCache *fake.MockNonNamespacedCacheInterface[*v3.Token]
+	minted     []string
+}
+
+func newTestHandler(t *testing.T) *testHandler {
+	ctrl := gomock.NewController(t)
+	th := &testHandler{
+		secrets:    fake.NewMockClientInterface[*corev1.Secret, *corev1.SecretList](ctrl),
+		tokenCache: fake.NewMockNonNamespacedCacheInterface[*v3.Token](ctrl),
+	}
+	th.Handler = newHandler(th.secrets, th.tokenCache, func(userID, clusterID string, userPrincipal v3.Principal) (*v3.Token, string, error) {
+		th.minted = append(th.minted, userID+"/"+clusterID+"/"+userPrincipal.Name)
+		return &v3.Token{ObjectMeta: metav1.ObjectMeta{Name: "kubeconfig-u-alice"}, TTLMillis: time.Hour.Milliseconds()}, "secret", nil
+	})
+	return th
+}
+
+func (th *testHandler) do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, req)
+	return rec
+}
+
+func postForm(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func verifyRequest(userName, userCode string, approved bool) *http.Request {
+	body, _ := json.Marshal(VerifyInput{UserCode: userCode, Approved: approved})
+	req := httptest.NewRequest(http.MethodPost, VerifyPath, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token-alice:key")
+	return req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: userName}))
+}
+
+func pendingSecret(deviceCode, userCode, state string, expiresAt time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName(deviceCode),
+			Namespace: tokens.SecretNamespace,
+			UID:       "uid",
+			Labels:    map[string]string{tokens.TokenKindLabel: SecretKind, UserCodeLabel: userCode},
+		},
+		Data: map[string][]byte{
+			keyClusterID: []byte("c-12345"),
+			keyExpiresAt: []byte(expiresAt.UTC().Format(time.RFC3339)),
+			keyState:     []byte(state),
+			keyUserID:    []byte("u-alice"),
+			keyTokenName: []byte("token-alice"),
+		},
+	}
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Error
+}
+
+func TestDeviceAuthorization(t *testing.T) {
+	th := newTestHandler(t)
+
+	expired := pendingSecret("expired", "BCDFGHJK", statePending, time.Now().Add(-time.Minute))
+	th.secrets.EXPECT().List(tokens.SecretNamespace, gomock.Any()).Return(&corev1.SecretList{Items: []corev1.Secret{*expired}}, nil)
+	th.secrets.EXPECT().Delete(tokens.SecretNamespace, expired.Name, gomock.Any()).Return(nil)
+	var created *corev1.Secret
+	th.secrets.EXPECT().Create(gomock.Any()).DoAndReturn(func(secret *corev1.Secret) (*corev1.Secret, error) {
+		created = secret
+		return secret, nil
+	})
+
+	req := postForm(CodePath, url.Values{"cluster_id": {"c-12345"}})
+	req.Host = "rancher.example.com"
+	rec := th.do(req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp DeviceAuthorizationResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.DeviceCode)
+	assert.Regexp(t, "^["+userCodeAlphabet+"]{4}-["+userCodeAlphabet+"]{4}$", resp.UserCode)
+	assert.Equal(t, "https://rancher.example.com"+VerifyPath, resp.VerificationURI)
+	assert.Equal(t, pollInterval, resp.Interval)
+
+	require.NotNil(t, created)
+	assert.Equal(t, secretName(resp.DeviceCode), created.Name, "expected the secret to be named after the hash of the device code")
+	assert.NotContains(t, created.Name, resp.DeviceCode)
+	assert.Equal(t, normalizeUserCode(resp.UserCode), created.Labels[UserCodeLabel])
+	assert.Equal(t, "c-12345", created.StringData[keyClusterID])
+	assert.Equal(t, statePending, created.StringData[keyState])
+}
+
+func TestDeviceAuthorizationRateLimit(t *testing.T) {
+	require.NoError(t, settings.AuthTrustedProxies.Set("10.0.0.0/24"))
+	defer func() {
+		_ = settings.AuthTrustedProxies.Set(settings.AuthTrustedProxies.Default)
+	}()
+	th := newTestHandler(t)
+
+	// Expired authorizations are only pruned once per interval.
+	th.secrets.EXPECT().List(tokens.SecretNamespace, gomock.Any()).Return(&corev1.SecretList{}, nil).Times(1)
+	th.secrets.EXPECT().Create(gomock.Any()).DoAndReturn(func(secret *corev1.Secret) (*corev1.Secret, error) {
+		return secret, nil
+	}).Times(maxCodesPerClient + 2)
+
+	request := func(clientID, clientIP string) *httptest.ResponseRecorder {
+		req := postForm(CodePath, url.Values{"client_id": {clientID}})
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", clientIP)
+		return th.do(req)
+	}
+	for i := 0; i < maxCodesPerClient; i++ {
+		rec := request("rancher", "192.168.1.5")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec := request("rancher", "192.168.1.5")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, errSlowDown, errorCode(t, rec))
+
+	// Other clients aren't limited.
+	rec = request("rancher", "192.168.1.6")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = request("other", "192.168.1.5")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestClientKey(t *testing.T) {
+	req := postForm(CodePath, url.Values{"client_id": {"rancher"}})
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "192.168.1.5")
+	require.NoError(t, req.ParseForm())
+
+	// Without trusted proxies, the remote address may be shared by all clients and X-Forwarded-For forged.
+	assert.Equal(t, "rancher/", clientKey(req))
+
+	require.NoError(t, settings.AuthTrustedProxies.Set("10.0.0.0/24"))
+	defer func() {
+		_ = settings.AuthTrustedProxies.Set(settings.AuthTrustedProxies.Default)
+	}()
+	assert.Equal(t, "rancher/192.168.1.5", clientKey(req))
+}
+
+func TestToken(t *testing.T) {
+	tokenForm := url.Values{"grant_type": {GrantType}, "device_code": {"device-code"}}
+	name := secretName("device-code")
+
+	t.Run("unsupported grant type", func(t *testing.T) {
+		th := newTestHandler(t)
+		rec := th.do(postForm(TokenPath, url.Values{"grant_type": {"password"}}))
+		assert.Equal(t, errUnsupportedGrantType, errorCode(t, rec))
+	})
+
+	t.Run("unknown device code", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.secrets.EXPECT().Get(tokens.SecretNamespace, name, gomock.Any()).Return(nil, apierrors.NewNotFound(schema.GroupResource{}, name))
+		rec := th.do(postForm(TokenPath, tokenForm))
+		assert.Equal(t, errExpiredToken, errorCode(t, rec))
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.secrets.EXPECT().Get(tokens.SecretNamespace, name, gomock.Any()).Return(pendingSecret("device-code", "BCDFGHJK", statePending, time.Now().Add(time.Minute)), nil)
+		rec := th.do(postForm(TokenPath, tokenForm))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, errAuthorizationPending, errorCode(t, rec))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.secrets.EXPECT().Get(tokens.SecretNamespace, name, gomock.Any()).Return(pendingSecret("device-code", "BCDFGHJK", stateApproved, time.Now().Add(-time.Minute)), nil)
+		th.secrets.EXPECT().Delete(tokens.SecretNamespace, name, gomock.Any()).Return(nil)
+		rec := th.do(postForm(TokenPath, tokenForm))
+		assert.Equal(t, errExpiredToken, errorCode(t, rec))
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.secrets.EXPECT().Get(tokens.SecretNamespace, name, gomock.Any()).Return(pendingSecret("device-code", "BCDFGHJK", stateDenied, time.Now().Add(time.Minute)), nil)
+		th.secrets.EXPECT().Delete(tokens.SecretNamespace, name, gomock.Any()).Return(nil)
+		rec := th.do(postForm(TokenPath, tokenForm))
+		assert.Equal(t, errAccessDenied, errorCode(t, rec))
+		assert.Empty(t, th.minted)
+	})
+
+	t.Run("approved", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.secrets.EXPECT().Get(tokens.SecretNamespace, name, gomock.Any()).Return(pendingSecret("device-code", "BCDFGHJK", stateApproved, time.Now().Add(time.Minute)), nil)
+		th.secrets.EXPECT().Delete(tokens.SecretNamespace, name, gomock.Any()).DoAndReturn(func(_, _ string, opts *metav1.DeleteOptions) error {
+			require.NotNil(t, opts.Preconditions)
+			return nil
+		})
+		th.tokenCache.EXPECT().Get("token-alice").Return(&v3.Token{
+			ObjectMeta:    metav1.ObjectMeta{Name: "token-alice"},
+			UserID:        "u-alice",
+			UserPrincipal: v3.Principal{ObjectMeta: metav1.ObjectMeta{Name: "github_user://1234"}},
+		}, nil)
+
+		rec := th.do(postForm(TokenPath, tokenForm))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp TokenResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "kubeconfig-u-alice:secret", resp.AccessToken)
+		assert.Equal(t, "Bearer", resp.TokenType)
+		assert.Equal(t, int64(3600), resp.ExpiresIn)
+		assert.Equal(t, []string{"u-alice/c-12345/github_user://1234"}, th.minted)
+	})
+
+	t.Run("approving session revoked", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.secrets.EXPECT().Get(tokens.SecretNamespace, name, gomock.Any()).Return(pendingSecret("device-code", "BCDFGHJK", stateApproved, time.Now().Add(time.Minute)), nil)
+		th.secrets.EXPECT().Delete(tokens.SecretNamespace, name, gomock.Any()).Return(nil)
+		th.tokenCache.EXPECT().Get("token-alice").Return(nil, apierrors.NewNotFound(schema.GroupResource{}, "token-alice"))
+
+		rec := th.do(postForm(TokenPath, tokenForm))
+		assert.Equal(t, errAccessDenied, errorCode(t, rec))
+		assert.Empty(t, th.minted)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	aliceToken := &v3.Token{ObjectMeta: metav1.ObjectMeta{Name: "token-alice"}, UserID: "u-alice"}
+
+	t.Run("approve", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.tokenCache.EXPECT().Get("token-alice").Return(aliceToken, nil)
+		pending := pendingSecret("device-code", "BCDFGHJK", statePending, time.Now().Add(time.Minute))
+		delete(pending.Data, keyUserID)
+		delete(pending.Data, keyTokenName)
+		th.secrets.EXPECT().List(tokens.SecretNamespace, metav1.ListOptions{
+			LabelSelector: UserCodeLabel + "=BCDFGHJK," + tokens.TokenKindLabel + "=" + SecretKind,
+		}).Return(&corev1.SecretList{Items: []corev1.Secret{*pending}}, nil)
+		var updated *corev1.Secret
+		th.secrets.EXPECT().Update(gomock.Any()).DoAndReturn(func(secret *corev1.Secret) (*corev1.Secret, error) {
+			updated = secret
+			return secret, nil
+		})
+
+		rec := th.do(verifyRequest("u-alice", "bcdf-ghjk", true))
+		require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+		require.NotNil(t, updated)
+		assert.Equal(t, stateApproved, string(updated.Data[keyState]))
+		assert.Equal(t, "u-alice", string(updated.Data[keyUserID]))
+		assert.Equal(t, "token-alice", string(updated.Data[keyTokenName]))
+	})
+
+	t.Run("token of another user", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.tokenCache.EXPECT().Get("token-alice").Return(aliceToken, nil)
+
+		rec := th.do(verifyRequest("u-bob", "BCDF-GHJK", true))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("not json", func(t *testing.T) {
+		th := newTestHandler(t)
+		req := verifyRequest("u-alice", "BCDF-GHJK", true)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := th.do(req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("unknown user code", func(t *testing.T) {
+		th := newTestHandler(t)
+		th.tokenCache.EXPECT().Get("token-alice").Return(aliceToken, nil)
+		th.secrets.EXPECT().List(tokens.SecretNamespace, gomock.Any()).Return(&corev1.SecretList{}, nil)
+
+		rec := th.do(verifyRequest("u-alice", "BCDF-GHJK", true))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,290 @@
+package common
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	corev1 "github.com/rancher/rancher/pkg/generated/norman/core/v1"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/namespace"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PasswordChangedAtAnnotation holds the RFC3339 time the password of a local user was last set.
+	PasswordChangedAtAnnotation = "auth.cattle.io/password-changed-at"
+
+	passwordHistorySecretPrefix = "password-history-"
+	passwordHistoryField        = "hashes"
+)
+
+// CharacterClass is a class of characters a password can be required to contain.
+type CharacterClass string
+
+const (
+	CharacterClassUpper  CharacterClass = "upper"
+	CharacterClassLower  CharacterClass = "lower"
+	CharacterClassDigit  CharacterClass = "digit"
+	CharacterClassSymbol CharacterClass = "symbol"
+)
+
+var characterClassDescriptions = map[CharacterClass]string{
+	CharacterClassUpper:  "an uppercase letter",
+	CharacterClassLower:  "a lowercase letter",
+	CharacterClassDigit:  "a digit",
+	CharacterClassSymbol: "a symbol",
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var commonPasswords = func() map[string]bool {
+	passwords := map[string]bool{}
+	for _, p := range strings.Split(commonPasswordsList, "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			passwords[p] = true
+		}
+	}
+	return passwords
+}()
+
+// PasswordPolicy describes the requirements for passwords of local users.
+type PasswordPolicy struct {
+	MinLength       int
+	RequiredClasses []CharacterClass
+	DenyCommon      bool
+	// HistorySize is the number of most recent passwords, including the current one, that can't be reused.
+	HistorySize int
+	// MaxAge is the age after which a password must be changed, 0 disables expiry.
+	MaxAge time.Duration
+}
+
+// GetPasswordPolicy returns the password policy configured by the password settings.
+func GetPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:   settings.PasswordMinLength.GetInt(),
+		DenyCommon:  settings.PasswordDenyCommon.Get() == "true",
+		HistorySize: settings.PasswordHistorySize.GetInt(),
+		MaxAge:      time.Duration(settings.PasswordMaxAgeDays.GetInt()) * 24 * time.Hour,
+	}
+	for _, class := range strings.Split(settings.PasswordRequiredCharacterClasses.Get(), ",") {
+		class := CharacterClass(strings.ToLower(strings.TrimSpace(class)))
+		if class == "" {
+			continue
+		}
+		if _, ok := characterClassDescriptions[class]; !ok {
+			logrus.Warnf("Ignoring unknown character class %q in setting %s", class, settings.PasswordRequiredCharacterClasses.Name)
+			continue
+		}
+		policy.RequiredClasses = append(policy.RequiredClasses, class)
+	}
+	return policy
+}
+
+// Validate checks the password against the length, character class and common password requirements.
+// Reuse of previous passwords is checked by PasswordHistory.
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("Password must be at least %v characters", p.MinLength)
+	}
+
+	found := map[CharacterClass]bool{}
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			found[CharacterClassUpper] = true
+		case unicode.IsLower(r):
+			found[CharacterClassLower] = true
+		case unicode.IsDigit(r):
+			found[CharacterClassDigit] = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			found[CharacterClassSymbol] = true
+		}
+	}
+	for _, class := range p.RequiredClasses {
+		if !found[class] {
+			return fmt.Errorf("Password must contain %s", characterClassDescriptions[class])
+		}
+	}
+
+	if p.DenyCommon && commonPasswords[strings.ToLower(password)] {
+		return fmt.Errorf("Password is too common")
+	}
+	return nil
+}
+
+// Description returns a human readable description of the policy.
+func (p PasswordPolicy) Description() string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("Passwords must be at least %d characters long", p.MinLength))
+	if len(p.RequiredClasses) > 0 {
+		classes := make([]string, 0, len(p.RequiredClasses))
+		for _, class := range p.RequiredClasses {
+			classes = append(classes, characterClassDescriptions[class])
+		}
+		parts = append(parts, "contain "+joinWithAnd(classes))
+	}
+	if p.DenyCommon {
+		parts = append(parts, "not be a commonly used password")
+	}
+	if p.HistorySize > 1 {
+		parts = append(parts, fmt.Sprintf("not be one of the last %d passwords", p.HistorySize))
+	} else if p.HistorySize == 1 {
+		parts = append(parts, "not be the current password")
+	}
+	description := joinWithAnd(parts) + "."
+	if p.MaxAge > 0 {
+		description += fmt.Sprintf(" Passwords expire after %d days.", int(p.MaxAge.Hours()/24))
+	}
+	return description
+}
+
+func joinWithAnd(items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+// Expired returns true if the password of the user is older than the maximum age.
+func (p PasswordPolicy) Expired(user *v3.User, now time.Time) bool {
+	if p.MaxAge <= 0 {
+		return false
+	}
+	return now.Sub(PasswordChangedAt(user)) > p.MaxAge
+}
+
+// PasswordChangedAt returns the time the password of the user was last set. Users created before the
+// time was recorded fall back to their creation time.
+func PasswordChangedAt(user *v3.User) time.Time {
+	if value, ok := user.Annotations[PasswordChangedAtAnnotation]; ok {
+		if changedAt, err := time.Parse(time.RFC3339, value); err == nil {
+			return changedAt
+		}
+	}
+	return user.CreationTimestamp.Time
+}
+
+// PasswordHistory keeps the hashes of the previous passwords of local users in a secret owned by the user.
+type PasswordHistory struct {
+	secrets corev1.SecretInterface
+}
+
+func NewPasswordHistory(secrets corev1.SecretInterface) *PasswordHistory {
+	return &PasswordHistory{secrets: secrets}
+}
+
+func passwordHistorySecretName(user *v3.User) string {
+	return passwordHistorySecretPrefix + user.Name
+}
+
+// Check returns an error if password matches the current password of the user or one of the previous
+// passwords kept by the policy.
+func (h *PasswordHistory) Check(user *v3.User, password string, policy PasswordPolicy) error {
+	if h == nil || policy.HistorySize <= 0 {
+		return nil
+	}
+
+	hashes := []string{user.Password}
+	previous, err := h.get(user)
+	if err != nil {
+		return err
+	}
+	hashes = append(hashes, lastN(previous, policy.HistorySize-1)...)
+
+	for _, hash := range hashes {
+		if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return fmt.Errorf("Password was used recently and can't be reused")
+		}
+	}
+	return nil
+}
+
+// Record adds the current password hash of the user to its history. It must be called before the password is replaced.
+func (h *PasswordHistory) Record(user *v3.User, policy PasswordPolicy) error {
+	if h == nil || policy.HistorySize <= 1 || user.Password == "" {
+		return nil
+	}
+
+	secret, err := h.secrets.GetNamespaced(namespace.System, passwordHistorySecretName(user), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get password history: %w", err)
+	}
+	exists := err == nil
+
+	var hashes []string
+	if exists {
+		if err := json.Unmarshal(secret.Data[passwordHistoryField], &hashes); err != nil {
+			logrus.Warnf("Discarding unreadable password history of user %s: %v", user.Name, err)
+			hashes = nil
+		}
+	}
+	hashes = lastN(append(hashes, user.Password), policy.HistorySize-1)
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		_, err = h.secrets.Create(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      passwordHistorySecretName(user),
+				Namespace: namespace.System,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: v3.UserGroupVersionKind.GroupVersion().String(),
+					Kind:       v3.UserGroupVersionKind.Kind,
+					Name:       user.Name,
+					UID:        user.UID,
+				}},
+			},
+			Type: v1.SecretTypeOpaque,
+			Data: map[string][]byte{passwordHistoryField: data},
+		})
+	} else {
+		secret = secret.DeepCopy()
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[passwordHistoryField] = data
+		_, err = h.secrets.Update(secret)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update password history: %w", err)
+	}
+	return nil
+}
+
+func (h *PasswordHistory) get(user *v3.User) ([]string, error) {
+	secret, err := h.secrets.GetNamespaced(namespace.System, passwordHistorySecretName(user), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+	var hashes []string
+	if err := json.Unmarshal(secret.Data[passwordHistoryField], &hashes); err != nil {
+		logrus.Warnf("Ignoring unreadable password history of user %s: %v", user.Name, err)
+		return nil, nil
+	}
+	return hashes, nil
+}
+
+func lastN(items []string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	if len(items) > n {
+		return items[len(items)-n:]
+	}
+	return items
+}
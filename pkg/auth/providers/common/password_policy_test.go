@@ -0,0 +1,140 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/rancher/rancher/pkg/generated/norman/core/v1/fakes"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:       12,
+		RequiredClasses: []CharacterClass{CharacterClassUpper, CharacterClassLower, CharacterClassDigit, CharacterClassSymbol},
+		DenyCommon:      true,
+	}
+
+	tests := []struct {
+		password string
+		wantErr  string
+	}{
+		{password: "Sh0rt!", wantErr: "at least 12 characters"},
+		{password: "all-lowercase-1", wantErr: "an uppercase letter"},
+		{password: "ALL-UPPERCASE-1", wantErr: "a lowercase letter"},
+		{password: "No-Digits-Here", wantErr: "a digit"},
+		{password: "NoSymbols12345", wantErr: "a symbol"},
+		{password: "Correct-Horse-B4ttery", wantErr: ""},
+		{password: "Correct Horse B4ttery", wantErr: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := policy.Validate(tt.password)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	policy = PasswordPolicy{MinLength: 12, DenyCommon: true}
+	assert.ErrorContains(t, policy.Validate("Password1234"), "too common")
+	policy.DenyCommon = false
+	assert.NoError(t, policy.Validate("Password1234"))
+}
+
+func TestGetPasswordPolicy(t *testing.T) {
+	require.NoError(t, settings.PasswordRequiredCharacterClasses.Set("Upper, digit,unknown"))
+	require.NoError(t, settings.PasswordMaxAgeDays.Set("90"))
+	defer func() {
+		_ = settings.PasswordRequiredCharacterClasses.Set(settings.PasswordRequiredCharacterClasses.Default)
+		_ = settings.PasswordMaxAgeDays.Set(settings.PasswordMaxAgeDays.Default)
+	}()
+
+	policy := GetPasswordPolicy()
+	assert.Equal(t, []CharacterClass{CharacterClassUpper, CharacterClassDigit}, policy.RequiredClasses)
+	assert.Equal(t, 90*24*time.Hour, policy.MaxAge)
+	assert.False(t, policy.DenyCommon)
+}
+
+func TestPasswordPolicyDescription(t *testing.T) {
+	assert.Equal(t, "Passwords must be at least 12 characters long.", PasswordPolicy{MinLength: 12}.Description())
+
+	policy := PasswordPolicy{
+		MinLength:       12,
+		RequiredClasses: []CharacterClass{CharacterClassUpper, CharacterClassDigit},
+		DenyCommon:      true,
+		HistorySize:     5,
+		MaxAge:          90 * 24 * time.Hour,
+	}
+	assert.Equal(t, "Passwords must be at least 12 characters long, contain an uppercase letter and a digit, "+
+		"not be a commonly used password and not be one of the last 5 passwords. Passwords expire after 90 days.", policy.Description())
+}
+
+func TestPasswordPolicyExpired(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-100 * 24 * time.Hour))}}
+
+	assert.False(t, PasswordPolicy{}.Expired(user, now), "expected no expiry without a maximum age")
+
+	policy := PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	assert.True(t, policy.Expired(user, now), "expected the creation time to be used without annotation")
+
+	user.Annotations = map[string]string{PasswordChangedAtAnnotation: now.Add(-10 * 24 * time.Hour).Format(time.RFC3339)}
+	assert.False(t, policy.Expired(user, now))
+}
+
+func TestPasswordHistory(t *testing.T) {
+	var stored *corev1.Secret
+	history := NewPasswordHistory(&fakes.SecretInterfaceMock{
+		GetNamespacedFunc: func(namespace, name string, opts metav1.GetOptions) (*corev1.Secret, error) {
+			if stored == nil {
+				return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+			}
+			return stored, nil
+		},
+		CreateFunc: func(secret *corev1.Secret) (*corev1.Secret, error) {
+			stored = secret
+			return secret, nil
+		},
+		UpdateFunc: func(secret *corev1.Secret) (*corev1.Secret, error) {
+			stored = secret
+			return secret, nil
+		},
+	})
+	policy := PasswordPolicy{HistorySize: 3}
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{Name: "u-test"}}
+
+	setPassword := func(password string) {
+		require.NoError(t, history.Check(user, password, policy))
+		require.NoError(t, history.Record(user, policy))
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		user.Password = string(hash)
+	}
+
+	setPassword("first-password")
+	setPassword("second-password")
+	setPassword("third-password")
+
+	assert.Error(t, history.Check(user, "third-password", policy), "expected the current password to be rejected")
+	assert.Error(t, history.Check(user, "second-password", policy))
+	assert.Error(t, history.Check(user, "first-password", policy))
+
+	setPassword("fourth-password")
+	assert.NoError(t, history.Check(user, "first-password", policy), "expected passwords older than the history to be accepted")
+
+	// A nil history or a disabled policy never rejects passwords.
+	assert.NoError(t, (*PasswordHistory)(nil).Check(user, "fourth-password", policy))
+	assert.NoError(t, history.Check(user, "fourth-password", PasswordPolicy{}))
+}
@@ -4,6 +4,7 @@
 	"context"
 	"fmt"
 	"strings"
+	"time"
 	"unicode"
 
 	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
@@ -39,11 +40,15 @@
 
 type Provider struct {
 	userLister   v3.UserLister
+	userClient   v3.UserInterface
 	groupLister  v3.GroupLister
 	userIndexer  cache.Indexer
 	gmIndexer    cache.Indexer
 	groupIndexer cache.Indexer
+	grbLister    v3.GlobalRoleBindingLister
 	tokenMGR     *tokens.Manager
+	lockout      *lockoutTracker
+	mfa          *MFAManager
 }
 
 func Configure(ctx context.Context, mgmtCtx *config.ScaledContext, tokenMGR *tokens.Manager) common.AuthProvider {
@@ -65,7 +70,11 @@ func Configure(ctx context.Context, mgmtCtx *config.ScaledContext, tokenMGR *tok
 		groupLister:  mgmtCtx.Management.Groups("").Controller().Lister(),
 		groupIndexer: gInformer.GetIndexer(),
 		userLister:   mgmtCtx.Management.Users("").Controller().Lister(),
+		userClient:   mgmtCtx.Management.Users(""),
+		grbLister:    mgmtCtx.Management.GlobalRoleBindings("").Controller().Lister(),
 		tokenMGR:     tokenMGR,
+		lockout:      newLockoutTracker(),
+		mfa:          NewMFAManager(mgmtCtx.Core.Secrets(""), mgmtCtx.Management.Users("")),
 	}
 	return l
 }
@@ -121,32 +130,69 @@ func (l *Provider) AuthenticateUser(ctx context.Context, input interface{}) (v3.
 	pwd := localInput.Password
 
 	authFailedError := httperror.NewAPIError(httperror.Unauthorized, "authentication failed")
+	ip := sourceIP(ctx)
 	user, err := l.getUser(username)
 	if err != nil {
 		// If the user don't exist the password is evaluated
 		// to avoid user enumeration via timing attack (time based side-channel).
 		bcrypt.CompareHashAndPassword(invalidHash, []byte(pwd))
 		logrus.Debugf("Get User [%s] failed during Authentication: %v", username, err)
+		if !l.checkLockout(ctx, username, ip, nil) {
+			l.loginFailed(ctx, username, ip, nil)
+		}
+		return v3.Principal{}, nil, "", authFailedError
+	}
+
+	// Locked out users are rejected with the same error as wrong credentials, the password is
+	// still evaluated so the response time doesn't reveal the lockout.
+	if l.checkLockout(ctx, username, ip, user) {
+		bcrypt.CompareHashAndPassword(invalidHash, []byte(pwd))
 		return v3.Principal{}, nil, "", authFailedError
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(pwd)); err != nil {
 		logrus.Debugf("Authentication failed for User [%s]: %v", username, err)
+		l.loginFailed(ctx, username, ip, user)
 		return v3.Principal{}, nil, "", authFailedError
 	}
 
+	groupPrincipals, err := l.getGroupPrincipals(user)
+	if err != nil {
+		return v3.Principal{}, nil, "", errors.Wrapf(err, "failed to get groups for %v", user.Name)
+	}
+
 	principalID := getLocalPrincipalID(user)
 	userPrincipal := l.toPrincipal("user", user.DisplayName, user.Username, principalID, nil)
 	userPrincipal.Me = true
 
-	groupPrincipals, err := l.getGroupPrincipals(user)
-	if err != nil {
-		return v3.Principal{}, nil, "", errors.Wrapf(err, "failed to get groups for %v", user.Name)
+	if err := l.checkMFA(ctx, user, groupPrincipals, localInput.MFACode, ip); IsMFAEnrollmentRequired(err) {
+		// The credentials are valid, the principals are returned along with the error so that a session
+		// restricted to the enrollment can be created.
+		l.loginSucceeded(username, ip)
+		return userPrincipal, groupPrincipals, "", err
+	} else if err != nil {
+		return v3.Principal{}, nil, "", err
+	}
+	l.loginSucceeded(username, ip)
+
+	if common.GetPasswordPolicy().Expired(user, time.Now()) && !user.MustChangePassword {
+		// The user can still log in, but must change the password before using Rancher.
+		if err := l.expirePassword(user); err != nil {
+			return v3.Principal{}, nil, "", errors.Wrapf(err, "failed to expire password of %v", user.Name)
+		}
 	}
 
 	return userPrincipal, groupPrincipals, "", nil
 }
 
+func (l *Provider) expirePassword(user *v3.User) error {
+	logrus.Infof("Password of local user [%s] expired, it must be changed on the next login", user.Username)
+	user = user.DeepCopy()
+	user.MustChangePassword = true
+	_, err := l.userClient.Update(user)
+	return err
+}
+
 func getLocalPrincipalID(user *v3.User) string {
 	// TODO error condition handling: no principal, more than one that would match
 	var principalID string
@@ -0,0 +1,302 @@
+package local
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rancher/rancher/pkg/auth/util"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LockedUntilAnnotation is set on a local user that is locked out after too many failed logins.
+	// The value is the RFC3339 time at which the lockout ends, removing it unlocks the user.
+	LockedUntilAnnotation = "auth.cattle.io/locked-until"
+
+	auditLockoutAnnotation = "auth.cattle.io/lockout"
+
+	failedLoginBaseDelay = 200 * time.Millisecond
+	failedLoginMaxDelay  = 5 * time.Second
+	// attemptsGCThreshold is the number of tracked keys after which expired entries are removed.
+	attemptsGCThreshold = 10000
+)
+
+// failedAttempts counts consecutive failed logins for a username or a source IP.
+type failedAttempts struct {
+	count       int
+	last        time.Time
+	lockedAt    time.Time
+	lockedUntil time.Time
+}
+
+// lockoutTracker keeps the failed login counters of this server in memory. Lockouts of existing users are
+// persisted on the user object so they apply to every server and can be lifted by an administrator.
+// Source IPs and unknown usernames are only locked out on the server that saw the failed attempts, an
+// administrator lifts them on every server with the auth-local-lockout-reset setting.
+type lockoutTracker struct {
+	lock     sync.Mutex
+	attempts map[string]*failedAttempts
+	now      func() time.Time
+}
+
+func newLockoutTracker() *lockoutTracker {
+	return &lockoutTracker{
+		attempts: map[string]*failedAttempts{},
+		now:      time.Now,
+	}
+}
+
+func userKey(username string) string {
+	return "user/" + username
+}
+
+func ipKey(ip string) string {
+	return "ip/" + ip
+}
+
+// mfaKey counts the invalid multi-factor authentication codes of a user.
+func mfaKey(username string) string {
+	return "mfa/" + username
+}
+
+// lockedUntil returns the end of the lockout for key, or the zero time if key is not locked out.
+func (t *lockoutTracker) lockedUntil(key string) time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	a, ok := t.attempts[key]
+	if !ok || !t.now().Before(a.lockedUntil) {
+		return time.Time{}
+	}
+	if reset := lockoutReset(); !reset.IsZero() && !a.lockedAt.After(reset) {
+		delete(t.attempts, key)
+		return time.Time{}
+	}
+	return a.lockedUntil
+}
+
+// fail records a failed attempt for key and returns the number of consecutive failures. Once maxAttempts is
+// reached the key is locked out for duration, locked is true only for the attempt causing the lockout.
+func (t *lockoutTracker) fail(key string, maxAttempts int, duration time.Duration) (count int, locked bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	if len(t.attempts) > attemptsGCThreshold {
+		t.gc(now, duration)
+	}
+
+	a, ok := t.attempts[key]
+	// Failures are forgotten once a lockout period passed since the last one.
+	if !ok || now.Sub(a.last) > duration {
+		a = &failedAttempts{}
+		t.attempts[key] = a
+	}
+	a.count++
+	a.last = now
+	count = a.count
+
+	if maxAttempts > 0 && a.count >= maxAttempts {
+		a.lockedAt = now
+		a.lockedUntil = now.Add(duration)
+		a.count = 0
+		locked = true
+	}
+	return count, locked
+}
+
+// reset forgets the failed attempts for key.
+func (t *lockoutTracker) reset(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.attempts, key)
+}
+
+func (t *lockoutTracker) gc(now time.Time, duration time.Duration) {
+	for key, a := range t.attempts {
+		if now.Sub(a.last) > duration && !now.Before(a.lockedUntil) {
+			delete(t.attempts, key)
+		}
+	}
+}
+
+// failedLoginDelay returns the delay applied before answering the given consecutive failed attempt.
+// The delay doubles with every failure up to failedLoginMaxDelay.
+func failedLoginDelay(count int) time.Duration {
+	if count <= 1 {
+		return 0
+	}
+	delay := failedLoginBaseDelay
+	for i := 2; i < count && delay < failedLoginMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > failedLoginMaxDelay {
+		return failedLoginMaxDelay
+	}
+	return delay
+}
+
+func lockoutSettings() (int, time.Duration) {
+	maxAttempts := settings.AuthLocalLockoutMaxAttempts.GetInt()
+	duration, err := time.ParseDuration(settings.AuthLocalLockoutDuration.Get())
+	if err != nil || duration <= 0 {
+		logrus.Warnf("Invalid value for setting %s, using the default: %v", settings.AuthLocalLockoutDuration.Name, err)
+		duration, _ = time.ParseDuration(settings.AuthLocalLockoutDuration.Default)
+	}
+	return maxAttempts, duration
+}
+
+// lockoutReset returns the time set by the auth-local-lockout-reset setting, or the zero time if it is not set.
+func lockoutReset() time.Time {
+	value := settings.AuthLocalLockoutReset.Get()
+	if value == "" {
+		return time.Time{}
+	}
+	reset, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logrus.Warnf("Invalid value for setting %s, expected an RFC3339 time: %v", settings.AuthLocalLockoutReset.Name, err)
+		return time.Time{}
+	}
+	return reset
+}
+
+// UserLockedUntil returns the end of the lockout of the user, or the zero time if the user is not locked out.
+func UserLockedUntil(user *v3.User, now time.Time) time.Time {
+	value, ok := user.Annotations[LockedUntilAnnotation]
+	if !ok {
+		return time.Time{}
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil || !now.Before(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// checkLockout returns true if logins for the user or from the source IP of the request are locked out. Administrators
+// are not locked out by source IP, as they are never locked out by username their password is still checked.
+func (l *Provider) checkLockout(ctx context.Context, username, ip string, user *v3.User) bool {
+	var until time.Time
+	reason := "source IP " + ip
+	if ip != "" {
+		until = l.lockout.lockedUntil(ipKey(ip))
+		if !until.IsZero() && user != nil && l.exemptFromLockout(user) {
+			logrus.Debugf("Not rejecting login for local user [%s] with administrative privileges from locked out source IP [%s]", username, ip)
+			until = time.Time{}
+		}
+	}
+	if user != nil {
+		if userUntil := UserLockedUntil(user, l.lockout.now()); userUntil.After(until) {
+			until = userUntil
+			reason = "user " + username
+		}
+	} else if userUntil := l.lockout.lockedUntil(userKey(username)); userUntil.After(until) {
+		until = userUntil
+		reason = "user " + username
+	}
+
+	if until.IsZero() {
+		return false
+	}
+
+	logrus.Debugf("Rejecting login for user [%s] from [%s]: %s is locked out until %s", username, ip, reason, until.Format(time.RFC3339))
+	util.AddAuditAnnotation(ctx, auditLockoutAnnotation, reason+" is locked out until "+until.Format(time.RFC3339))
+	return true
+}
+
+// loginFailed records the failed login, locks out the user or source IP once the configured number of
+// attempts is reached and delays the response progressively.
+func (l *Provider) loginFailed(ctx context.Context, username, ip string, user *v3.User) {
+	maxAttempts, duration := lockoutSettings()
+
+	userCount, userLocked := l.lockout.fail(userKey(username), maxAttempts, duration)
+	var ipCount int
+	var ipLocked bool
+	// The source IP is unknown if the login didn't come through the API, it is not counted then.
+	if ip != "" {
+		ipCount, ipLocked = l.lockout.fail(ipKey(ip), maxAttempts, duration)
+	}
+
+	if userLocked && user != nil && l.exemptFromLockout(user) {
+		// Anyone knowing the username could otherwise lock administrators out of Rancher, their failed
+		// logins are only delayed.
+		logrus.Warnf("Not locking out local user [%s] with administrative privileges after %d failed login attempts", username, maxAttempts)
+		userLocked = false
+	}
+	if userLocked {
+		until := l.lockout.now().Add(duration).UTC()
+		logrus.Warnf("Locking out local user [%s] until %s after %d failed login attempts", username, until.Format(time.RFC3339), maxAttempts)
+		util.AddAuditAnnotation(ctx, auditLockoutAnnotation, "user "+username+" locked out until "+until.Format(time.RFC3339))
+		if user != nil {
+			if err := l.lockUser(user, until); err != nil {
+				logrus.Errorf("Failed to lock out local user [%s]: %v", username, err)
+			}
+		}
+	}
+	if ipLocked {
+		until := l.lockout.now().Add(duration).UTC()
+		logrus.Warnf("Locking out local logins from [%s] until %s after %d failed login attempts", ip, until.Format(time.RFC3339), maxAttempts)
+		util.AddAuditAnnotation(ctx, auditLockoutAnnotation+"-ip", "source IP "+ip+" locked out until "+until.Format(time.RFC3339))
+	}
+
+	count := userCount
+	if ipCount > count {
+		count = ipCount
+	}
+	if delay := failedLoginDelay(count); delay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
+
+// exemptFromLockout returns true if the user is an administrator, who is never locked out by username.
+func (l *Provider) exemptFromLockout(user *v3.User) bool {
+	if l.grbLister == nil {
+		return false
+	}
+	groupPrincipals, err := l.getGroupPrincipals(user)
+	if err != nil {
+		logrus.Errorf("Failed to get groups of local user [%s]: %v", user.Username, err)
+	}
+	isAdmin, err := l.isAdmin(user, groupPrincipals)
+	if err != nil {
+		logrus.Errorf("Failed to check whether local user [%s] is an administrator: %v", user.Username, err)
+	}
+	return isAdmin
+}
+
+// loginSucceeded clears the failed attempts of the user and source IP.
+func (l *Provider) loginSucceeded(username, ip string) {
+	l.lockout.reset(userKey(username))
+	l.lockout.reset(ipKey(ip))
+}
+
+func (l *Provider) lockUser(user *v3.User, until time.Time) error {
+	if l.userClient == nil {
+		return nil
+	}
+	user = user.DeepCopy()
+	if user.Annotations == nil {
+		user.Annotations = map[string]string{}
+	}
+	user.Annotations[LockedUntilAnnotation] = until.Format(time.RFC3339)
+	_, err := l.userClient.Update(user)
+	return err
+}
+
+// sourceIP returns the IP address of the client that sent the login request stored in ctx. It is empty if the address
+// doesn't tell clients apart, e.g. the address of the ingress shared by all clients, logins are not locked out by source
+// IP then.
+func sourceIP(ctx context.Context) string {
+	req, ok := ctx.Value(util.RequestKey).(*http.Request)
+	if !ok || req == nil {
+		return ""
+	}
+	return util.DistinctClientIP(req)
+}
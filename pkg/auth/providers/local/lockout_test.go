@@ -0,0 +1,222 @@
+package local
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/util"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestLockoutTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newLockoutTracker()
+	tracker.now = func() time.Time { return now }
+
+	for i := 1; i < 3; i++ {
+		count, locked := tracker.fail("user/admin", 3, time.Minute)
+		assert.Equal(t, i, count)
+		assert.False(t, locked)
+	}
+	_, locked := tracker.fail("user/admin", 3, time.Minute)
+	assert.True(t, locked)
+	assert.Equal(t, now.Add(time.Minute), tracker.lockedUntil("user/admin"))
+
+	now = now.Add(time.Minute)
+	assert.True(t, tracker.lockedUntil("user/admin").IsZero(), "expected lockout to expire")
+
+	// Failures older than the lockout duration are forgotten.
+	tracker.fail("ip/10.0.0.1", 3, time.Minute)
+	now = now.Add(2 * time.Minute)
+	count, _ := tracker.fail("ip/10.0.0.1", 3, time.Minute)
+	assert.Equal(t, 1, count)
+
+	tracker.reset("ip/10.0.0.1")
+	count, _ = tracker.fail("ip/10.0.0.1", 3, time.Minute)
+	assert.Equal(t, 1, count)
+
+	// A maximum of 0 never locks out.
+	for i := 0; i < 20; i++ {
+		_, locked = tracker.fail("user/other", 0, time.Minute)
+		assert.False(t, locked)
+	}
+}
+
+func TestFailedLoginDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), failedLoginDelay(1))
+	assert.Equal(t, failedLoginBaseDelay, failedLoginDelay(2))
+	assert.Equal(t, 2*failedLoginBaseDelay, failedLoginDelay(3))
+	assert.Equal(t, 4*failedLoginBaseDelay, failedLoginDelay(4))
+	assert.Equal(t, failedLoginMaxDelay, failedLoginDelay(50))
+}
+
+func TestSourceIP(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/v3-public/localProviders/local?action=login", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "10.0.0.1:51234"
+	ctx := context.WithValue(context.Background(), util.RequestKey, req)
+	// Without trusted proxies the address may be the one of the ingress, which is shared by all clients.
+	assert.Equal(t, "", sourceIP(ctx))
+
+	require.NoError(t, settings.AuthTrustedProxies.Set("10.0.0.0/24"))
+	defer func() {
+		_ = settings.AuthTrustedProxies.Set(settings.AuthTrustedProxies.Default)
+	}()
+	assert.Equal(t, "10.0.0.1", sourceIP(ctx))
+
+	req.Header.Set("X-Forwarded-For", "192.168.1.5, 10.0.0.2")
+	assert.Equal(t, "192.168.1.5", sourceIP(ctx))
+
+	// Forwarding headers of untrusted peers are ignored.
+	req.RemoteAddr = "172.16.0.1:51234"
+	assert.Equal(t, "172.16.0.1", sourceIP(ctx))
+	req.RemoteAddr = "10.0.0.1:51234"
+
+	// Addresses prepended by the client can't hide its actual address.
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 192.168.1.5, 10.0.0.2")
+	assert.Equal(t, "192.168.1.5", sourceIP(ctx))
+
+	assert.Equal(t, "", sourceIP(context.Background()))
+}
+
+func TestLockoutReset(t *testing.T) {
+	now := time.Now()
+	tracker := newLockoutTracker()
+	tracker.now = func() time.Time { return now }
+
+	_, locked := tracker.fail("ip/10.0.0.1", 1, time.Hour)
+	require.True(t, locked)
+	assert.False(t, tracker.lockedUntil("ip/10.0.0.1").IsZero())
+
+	require.NoError(t, settings.AuthLocalLockoutReset.Set(now.Add(time.Second).Format(time.RFC3339)))
+	defer func() {
+		_ = settings.AuthLocalLockoutReset.Set(settings.AuthLocalLockoutReset.Default)
+	}()
+	assert.True(t, tracker.lockedUntil("ip/10.0.0.1").IsZero(), "expected lockout to be lifted")
+
+	// Lockouts after the reset apply.
+	now = now.Add(time.Minute)
+	_, locked = tracker.fail("ip/10.0.0.1", 1, time.Hour)
+	require.True(t, locked)
+	assert.False(t, tracker.lockedUntil("ip/10.0.0.1").IsZero())
+}
+
+func TestAuthenticateUserLockout(t *testing.T) {
+	require.NoError(t, settings.AuthLocalLockoutMaxAttempts.Set("3"))
+	require.NoError(t, settings.AuthLocalLockoutDuration.Set("1h"))
+	defer func() {
+		_ = settings.AuthLocalLockoutMaxAttempts.Set(settings.AuthLocalLockoutMaxAttempts.Default)
+		_ = settings.AuthLocalLockoutDuration.Set(settings.AuthLocalLockoutDuration.Default)
+	}()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &v3.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "u-admin"},
+		Username:   "admin",
+		Password:   string(hash),
+	}
+	userIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{userNameIndex: userNameIndexer})
+	require.NoError(t, userIndexer.Add(user))
+
+	var updated *v3.User
+	provider := &Provider{
+		userIndexer: userIndexer,
+		gmIndexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{gmPrincipalIndex: gmPIdIndexer}),
+		userClient: &fakes.UserInterfaceMock{
+			UpdateFunc: func(in *v3.User) (*v3.User, error) {
+				updated = in
+				return in, nil
+			},
+		},
+		lockout: newLockoutTracker(),
+	}
+	// Skip the progressive delays.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	login := func(password string) error {
+		_, _, _, err := provider.AuthenticateUser(ctx, &v32.BasicLogin{Username: "admin", Password: password})
+		return err
+	}
+
+	require.Error(t, login("wrong"))
+	require.Error(t, login("wrong"))
+	assert.Nil(t, updated)
+	require.Error(t, login("wrong"))
+	require.NotNil(t, updated, "expected the user to be locked out")
+	assert.NotEmpty(t, updated.Annotations[LockedUntilAnnotation])
+
+	// The lockout is read from the user object.
+	require.NoError(t, userIndexer.Update(updated))
+	assert.Error(t, login("correct-password"), "expected login of a locked out user to fail")
+
+	// Removing the annotation unlocks the user.
+	unlocked := updated.DeepCopy()
+	delete(unlocked.Annotations, LockedUntilAnnotation)
+	require.NoError(t, userIndexer.Update(unlocked))
+	assert.NoError(t, login("correct-password"))
+}
+
+func TestAuthenticateUserLockoutAdmin(t *testing.T) {
+	require.NoError(t, settings.AuthLocalLockoutMaxAttempts.Set("2"))
+	require.NoError(t, settings.AuthTrustedProxies.Set("10.0.0.0/24"))
+	defer func() {
+		_ = settings.AuthLocalLockoutMaxAttempts.Set(settings.AuthLocalLockoutMaxAttempts.Default)
+		_ = settings.AuthTrustedProxies.Set(settings.AuthTrustedProxies.Default)
+	}()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &v3.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "u-admin"},
+		Username:   "admin",
+		Password:   string(hash),
+	}
+	userIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{userNameIndex: userNameIndexer})
+	require.NoError(t, userIndexer.Add(user))
+
+	provider := &Provider{
+		userIndexer: userIndexer,
+		gmIndexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{gmPrincipalIndex: gmPIdIndexer}),
+		grbLister: &fakes.GlobalRoleBindingListerMock{
+			ListFunc: func(namespace string, selector labels.Selector) ([]*v3.GlobalRoleBinding, error) {
+				return []*v3.GlobalRoleBinding{{UserName: "u-admin", GlobalRoleName: "admin"}}, nil
+			},
+		},
+		userClient: &fakes.UserInterfaceMock{
+			UpdateFunc: func(in *v3.User) (*v3.User, error) {
+				t.Fatal("administrators must not be locked out")
+				return in, nil
+			},
+		},
+		lockout: newLockoutTracker(),
+	}
+	req, err := http.NewRequest(http.MethodPost, "/v3-public/localProviders/local?action=login", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "10.0.0.1:51234"
+	req.Header.Set("X-Forwarded-For", "192.168.1.5")
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), util.RequestKey, req))
+	cancel()
+
+	for i := 0; i < 5; i++ {
+		_, _, _, err := provider.AuthenticateUser(ctx, &v32.BasicLogin{Username: "admin", Password: "wrong"})
+		require.Error(t, err)
+	}
+	require.False(t, provider.lockout.lockedUntil(ipKey("192.168.1.5")).IsZero(), "expected the source IP to be locked out")
+
+	// Administrators presenting valid credentials are not locked out by source IP.
+	_, _, _, err = provider.AuthenticateUser(ctx, &v32.BasicLogin{Username: "admin", Password: "correct-password"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,438 @@
+package local
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/norman/httperror"
+	"github.com/rancher/rancher/pkg/auth/tokens/hashers"
+	"github.com/rancher/rancher/pkg/auth/util"
+	corev1 "github.com/rancher/rancher/pkg/generated/norman/core/v1"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/namespace"
+	"github.com/rancher/rancher/pkg/rbac"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// MFAEnabledAnnotation is set on local users that completed the enrollment in multi-factor authentication.
+	MFAEnabledAnnotation = "auth.cattle.io/mfa-enabled"
+
+	mfaSecretPrefix       = "mfa-"
+	mfaTOTPSecretField    = "totpSecret"
+	mfaRecoveryCodesField = "recoveryCodes"
+	mfaLastStepField      = "lastStep"
+	mfaConfirmedField     = "confirmed"
+	mfaIssuer             = "Rancher"
+	auditMFAAnnotation    = "auth.cattle.io/mfa"
+	totpPeriod            = 30
+	totpDigits            = 6
+	totpSecretSize        = 20
+	recoveryCodeCount     = 10
+	recoveryCodeSize      = 10
+	totpSkew              = 1
+	// mfaMaxAttempts is the number of consecutive invalid codes sent with the valid password of a user after which the
+	// user is locked out, administrators included.
+	mfaMaxAttempts = 5
+)
+
+var (
+	// ErrMFARequired is returned by a login of an enrolled user that didn't include a code.
+	ErrMFARequired = httperror.ErrorCode{Code: "MFARequired", Status: 401}
+	// ErrMFAEnrollmentRequired is returned by a login of a user that must enroll in multi-factor authentication first.
+	// The credentials of the user are valid, the login only grants a session restricted to the enrollment.
+	ErrMFAEnrollmentRequired = httperror.ErrorCode{Code: "MFAEnrollmentRequired", Status: 401}
+
+	errMFANotEnrolled = httperror.NewAPIError(httperror.InvalidState, "multi-factor authentication is not enabled")
+	errInvalidMFACode = httperror.NewAPIError(httperror.InvalidBodyContent, "invalid multi-factor authentication code")
+
+	totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// MFAManager enrolls local users in TOTP multi-factor authentication and verifies their codes.
+// The TOTP secret and the hashed recovery codes of a user are kept in a secret owned by the user.
+type MFAManager struct {
+	secrets corev1.SecretInterface
+	users   v3.UserInterface
+	now     func() time.Time
+}
+
+func NewMFAManager(secrets corev1.SecretInterface, users v3.UserInterface) *MFAManager {
+	return &MFAManager{
+		secrets: secrets,
+		users:   users,
+		now:     time.Now,
+	}
+}
+
+func mfaSecretName(user *v3.User) string {
+	return mfaSecretPrefix + user.Name
+}
+
+// Enrolled returns true if the user completed the enrollment in multi-factor authentication.
+func (m *MFAManager) Enrolled(user *v3.User) (bool, error) {
+	secret, err := m.getSecret(user)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return string(secret.Data[mfaConfirmedField]) == "true", nil
+}
+
+// Enroll starts the enrollment of the user and returns the TOTP secret and its provisioning URI, which
+// authenticator apps read from a QR code. The enrollment is pending until it is confirmed with a valid code.
+func (m *MFAManager) Enroll(user *v3.User) (string, string, error) {
+	secret, err := m.getSecret(user)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", "", err
+	}
+	exists := err == nil
+	if exists && string(secret.Data[mfaConfirmedField]) == "true" {
+		return "", "", httperror.NewAPIError(httperror.InvalidState, "multi-factor authentication is already enabled, disable it first")
+	}
+
+	key := make([]byte, totpSecretSize)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	totpSecret := totpEncoding.EncodeToString(key)
+
+	data := map[string][]byte{
+		mfaTOTPSecretField: []byte(totpSecret),
+		mfaConfirmedField:  []byte("false"),
+	}
+	if !exists {
+		_, err = m.secrets.Create(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      mfaSecretName(user),
+				Namespace: namespace.System,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: v3.UserGroupVersionKind.GroupVersion().String(),
+					Kind:       v3.UserGroupVersionKind.Kind,
+					Name:       user.Name,
+					UID:        user.UID,
+				}},
+			},
+			Type: v1.SecretTypeOpaque,
+			Data: data,
+		})
+	} else {
+		secret = secret.DeepCopy()
+		secret.Data = data
+		_, err = m.secrets.Update(secret)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	return totpSecret, provisioningURI(user.Username, totpSecret), nil
+}
+
+// Confirm completes a pending enrollment if code is valid for the TOTP secret and returns the recovery codes.
+// Only hashes of the recovery codes are stored, they can't be shown again.
+func (m *MFAManager) Confirm(user *v3.User, code string) ([]string, error) {
+	secret, err := m.getSecret(user)
+	if apierrors.IsNotFound(err) {
+		return nil, httperror.NewAPIError(httperror.InvalidState, "no pending multi-factor authentication enrollment")
+	} else if err != nil {
+		return nil, err
+	}
+	if string(secret.Data[mfaConfirmedField]) == "true" {
+		return nil, httperror.NewAPIError(httperror.InvalidState, "multi-factor authentication is already enabled")
+	}
+
+	step, ok := validateTOTP(string(secret.Data[mfaTOTPSecretField]), code, m.now())
+	if !ok {
+		return nil, errInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashesJSON, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[mfaConfirmedField] = []byte("true")
+	secret.Data[mfaRecoveryCodesField] = hashesJSON
+	secret.Data[mfaLastStepField] = []byte(strconv.FormatUint(step, 10))
+	if _, err := m.secrets.Update(secret); err != nil {
+		return nil, fmt.Errorf("failed to enable multi-factor authentication: %w", err)
+	}
+
+	if err := m.setEnabledAnnotation(user, true); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code of an enrolled user. Each TOTP code and recovery code is only accepted once.
+func (m *MFAManager) Verify(user *v3.User, code string) error {
+	secret, err := m.getSecret(user)
+	if apierrors.IsNotFound(err) {
+		return errMFANotEnrolled
+	} else if err != nil {
+		return err
+	}
+	if string(secret.Data[mfaConfirmedField]) != "true" {
+		return errMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	secret = secret.DeepCopy()
+
+	if step, ok := validateTOTP(string(secret.Data[mfaTOTPSecretField]), code, m.now()); ok {
+		lastStep, _ := strconv.ParseUint(string(secret.Data[mfaLastStepField]), 10, 64)
+		if step <= lastStep {
+			// The code was already used, it may have been observed by someone else.
+			return errInvalidMFACode
+		}
+		secret.Data[mfaLastStepField] = []byte(strconv.FormatUint(step, 10))
+		_, err := m.secrets.Update(secret)
+		return err
+	}
+
+	var hashes []string
+	if err := json.Unmarshal(secret.Data[mfaRecoveryCodesField], &hashes); err != nil {
+		return fmt.Errorf("failed to read recovery codes: %w", err)
+	}
+	for i, hash := range hashes {
+		hasher, err := hashers.GetHasherForHash(hash)
+		if err != nil {
+			continue
+		}
+		if hasher.VerifyHash(hash, normalizeRecoveryCode(code)) != nil {
+			continue
+		}
+		hashesJSON, err := json.Marshal(append(hashes[:i:i], hashes[i+1:]...))
+		if err != nil {
+			return err
+		}
+		secret.Data[mfaRecoveryCodesField] = hashesJSON
+		_, err = m.secrets.Update(secret)
+		return err
+	}
+	return errInvalidMFACode
+}
+
+// Disable removes the TOTP secret and recovery codes of the user.
+func (m *MFAManager) Disable(user *v3.User) error {
+	err := m.secrets.DeleteNamespaced(namespace.System, mfaSecretName(user), &metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to disable multi-factor authentication: %w", err)
+	}
+	return m.setEnabledAnnotation(user, false)
+}
+
+func (m *MFAManager) getSecret(user *v3.User) (*v1.Secret, error) {
+	return m.secrets.GetNamespaced(namespace.System, mfaSecretName(user), metav1.GetOptions{})
+}
+
+func (m *MFAManager) setEnabledAnnotation(user *v3.User, enabled bool) error {
+	_, ok := user.Annotations[MFAEnabledAnnotation]
+	if ok == enabled {
+		return nil
+	}
+	user = user.DeepCopy()
+	if enabled {
+		if user.Annotations == nil {
+			user.Annotations = map[string]string{}
+		}
+		user.Annotations[MFAEnabledAnnotation] = "true"
+	} else {
+		delete(user.Annotations, MFAEnabledAnnotation)
+	}
+	if _, err := m.users.Update(user); err != nil {
+		return fmt.Errorf("failed to update user %s: %w", user.Name, err)
+	}
+	return nil
+}
+
+// provisioningURI returns the otpauth URI of a TOTP secret as defined by the Key Uri Format of Google Authenticator.
+func provisioningURI(username, totpSecret string) string {
+	values := url.Values{}
+	values.Set("secret", totpSecret)
+	values.Set("issuer", mfaIssuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", strconv.Itoa(totpDigits))
+	values.Set("period", strconv.Itoa(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + mfaIssuer + ":" + username,
+		RawQuery: values.Encode(),
+	}
+	return u.String()
+}
+
+// totpCode returns the RFC 6238 code of the secret for the given time step.
+func totpCode(key []byte, step uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], step)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// validateTOTP checks code against the steps around now to allow for clock drift of the authenticator and
+// returns the matching time step.
+func validateTOTP(totpSecret, code string, now time.Time) (uint64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(totpSecret))
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for skew := int64(-totpSkew); skew <= totpSkew; skew++ {
+		step := uint64(current + skew)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	hasher := hashers.GetHasher()
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))[:recoveryCodeSize]
+		hash, err := hasher.CreateHash(code)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to hash recovery code: %w", err)
+		}
+		codes = append(codes, code[:recoveryCodeSize/2]+"-"+code[recoveryCodeSize/2:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
+
+// IsMFAEnrollmentRequired returns true if err is returned by the login of a user that must enroll in multi-factor
+// authentication first. AuthenticateUser returns the principals of the user along with it.
+func IsMFAEnrollmentRequired(err error) bool {
+	var apiErr *httperror.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == ErrMFAEnrollmentRequired
+}
+
+// checkMFA is the second login step of local users. Users enrolled in multi-factor authentication must send a
+// TOTP or recovery code with their credentials, admins must be enrolled if auth-local-mfa-required-for-admins is set.
+func (l *Provider) checkMFA(ctx context.Context, user *v3.User, groupPrincipals []v3.Principal, code, ip string) error {
+	if l.mfa == nil {
+		return nil
+	}
+
+	enrolled, err := l.mfa.Enrolled(user)
+	if err != nil {
+		return fmt.Errorf("failed to get multi-factor authentication status of user %s: %w", user.Name, err)
+	}
+	if !enrolled {
+		if settings.AuthLocalMFARequiredForAdmins.Get() != "true" {
+			return nil
+		}
+		isAdmin, err := l.isAdmin(user, groupPrincipals)
+		if err != nil {
+			return err
+		}
+		if !isAdmin {
+			return nil
+		}
+		util.AddAuditAnnotation(ctx, auditMFAAnnotation, "enrollment required")
+		return httperror.NewAPIError(ErrMFAEnrollmentRequired, "multi-factor authentication must be enabled for this user")
+	}
+
+	if code == "" {
+		return httperror.NewAPIError(ErrMFARequired, "multi-factor authentication code required")
+	}
+	if err := l.mfa.Verify(user, code); err != nil {
+		if err != errInvalidMFACode {
+			return fmt.Errorf("failed to verify multi-factor authentication code of user %s: %w", user.Name, err)
+		}
+		logrus.Debugf("Invalid multi-factor authentication code for User [%s]", user.Username)
+		util.AddAuditAnnotation(ctx, auditMFAAnnotation, "invalid code")
+		l.loginFailed(ctx, user.Username, ip, user)
+		l.mfaFailed(ctx, user)
+		return httperror.NewAPIError(httperror.Unauthorized, "authentication failed")
+	}
+	l.lockout.reset(mfaKey(user.Username))
+	util.AddAuditAnnotation(ctx, auditMFAAnnotation, "verified")
+	return nil
+}
+
+// mfaFailed records an invalid code sent with the valid password of the user. Administrators are not locked out by
+// failed logins, anyone knowing their password could then guess their codes without limit. Once mfaMaxAttempts invalid
+// codes were sent, the user is locked out whatever its role, until the lockout expires or an administrator lifts it.
+func (l *Provider) mfaFailed(ctx context.Context, user *v3.User) {
+	_, duration := lockoutSettings()
+	if _, locked := l.lockout.fail(mfaKey(user.Username), mfaMaxAttempts, duration); !locked {
+		return
+	}
+	until := l.lockout.now().Add(duration).UTC()
+	logrus.Warnf("Locking out local user [%s] until %s after %d invalid multi-factor authentication codes", user.Username, until.Format(time.RFC3339), mfaMaxAttempts)
+	util.AddAuditAnnotation(ctx, auditLockoutAnnotation, "user "+user.Username+" locked out until "+until.Format(time.RFC3339)+" after invalid multi-factor authentication codes")
+	if err := l.lockUser(user, until); err != nil {
+		logrus.Errorf("Failed to lock out local user [%s]: %v", user.Username, err)
+	}
+}
+
+// isAdmin returns true if the user or one of its groups is bound to the admin or restricted-admin global role.
+func (l *Provider) isAdmin(user *v3.User, groupPrincipals []v3.Principal) (bool, error) {
+	groups := make(map[string]bool, len(groupPrincipals))
+	for _, group := range groupPrincipals {
+		groups[group.Name] = true
+	}
+
+	grbs, err := l.grbLister.List("", labels.Everything())
+	if err != nil {
+		return false, fmt.Errorf("failed to list global role bindings: %w", err)
+	}
+	for _, grb := range grbs {
+		if grb.GlobalRoleName != rbac.GlobalAdmin && grb.GlobalRoleName != rbac.GlobalRestrictedAdmin {
+			continue
+		}
+		if grb.UserName == user.Name || (grb.GroupPrincipalName != "" && groups[grb.GroupPrincipalName]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
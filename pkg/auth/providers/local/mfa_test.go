@@ -0,0 +1,263 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher/norman/httperror"
+	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	corefakes "github.com/rancher/rancher/pkg/generated/norman/core/v1/fakes"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA1, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, totpCode(key, uint64(tt.unix/totpPeriod)))
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111109, 0)
+	step := uint64(now.Unix() / totpPeriod)
+
+	got, ok := validateTOTP(secret, totpCode(key, step), now)
+	assert.True(t, ok)
+	assert.Equal(t, step, got)
+
+	_, ok = validateTOTP(secret, totpCode(key, step-1), now)
+	assert.True(t, ok, "expected the previous code to be accepted")
+	_, ok = validateTOTP(secret, totpCode(key, step+2), now)
+	assert.False(t, ok)
+	_, ok = validateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func newFakeMFAManager(now *time.Time) (*MFAManager, map[string]*v1.Secret) {
+	secrets := map[string]*v1.Secret{}
+	secretClient := &corefakes.SecretInterfaceMock{
+		GetNamespacedFunc: func(namespace, name string, opts metav1.GetOptions) (*v1.Secret, error) {
+			secret, ok := secrets[name]
+			if !ok {
+				return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+			}
+			return secret, nil
+		},
+		CreateFunc: func(secret *v1.Secret) (*v1.Secret, error) {
+			secrets[secret.Name] = secret
+			return secret, nil
+		},
+		UpdateFunc: func(secret *v1.Secret) (*v1.Secret, error) {
+			secrets[secret.Name] = secret
+			return secret, nil
+		},
+		DeleteNamespacedFunc: func(namespace, name string, options *metav1.DeleteOptions) error {
+			delete(secrets, name)
+			return nil
+		},
+	}
+	userClient := &fakes.UserInterfaceMock{
+		UpdateFunc: func(user *v3.User) (*v3.User, error) {
+			return user, nil
+		},
+	}
+	m := NewMFAManager(secretClient, userClient)
+	m.now = func() time.Time { return *now }
+	return m, secrets
+}
+
+func currentCode(t *testing.T, secret string, now time.Time) string {
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+	return totpCode(key, uint64(now.Unix()/totpPeriod))
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, secrets := newFakeMFAManager(&now)
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{Name: "u-test"}, Username: "test"}
+
+	totpSecret, uri, err := m.Enroll(user)
+	require.NoError(t, err)
+	assert.Contains(t, uri, "otpauth://totp/Rancher:test?")
+	assert.Contains(t, uri, "secret="+totpSecret)
+
+	enrolled, err := m.Enrolled(user)
+	require.NoError(t, err)
+	assert.False(t, enrolled, "expected a pending enrollment")
+
+	_, err = m.Confirm(user, "000000")
+	assert.Error(t, err)
+
+	recoveryCodes, err := m.Confirm(user, currentCode(t, totpSecret, now))
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+	enrolled, err = m.Enrolled(user)
+	require.NoError(t, err)
+	assert.True(t, enrolled)
+	assert.NotContains(t, string(secrets[mfaSecretName(user)].Data[mfaRecoveryCodesField]), recoveryCodes[0], "recovery codes must be stored hashed")
+
+	// The code used for the confirmation can't be replayed.
+	assert.Equal(t, errInvalidMFACode, m.Verify(user, currentCode(t, totpSecret, now)))
+	now = now.Add(totpPeriod * time.Second)
+	assert.NoError(t, m.Verify(user, currentCode(t, totpSecret, now)))
+
+	// Recovery codes can be used once.
+	assert.NoError(t, m.Verify(user, recoveryCodes[3]))
+	assert.Equal(t, errInvalidMFACode, m.Verify(user, recoveryCodes[3]))
+	assert.NoError(t, m.Verify(user, "  "+recoveryCodes[4]))
+
+	_, _, err = m.Enroll(user)
+	assert.Error(t, err, "expected enrolling twice to fail")
+
+	require.NoError(t, m.Disable(user))
+	enrolled, err = m.Enrolled(user)
+	require.NoError(t, err)
+	assert.False(t, enrolled)
+}
+
+func TestAuthenticateUserMFA(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, _ := newFakeMFAManager(&now)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &v3.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "u-admin"},
+		Username:   "admin",
+		Password:   string(hash),
+	}
+	userIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{userNameIndex: userNameIndexer})
+	require.NoError(t, userIndexer.Add(user))
+
+	provider := &Provider{
+		userIndexer: userIndexer,
+		gmIndexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{gmPrincipalIndex: gmPIdIndexer}),
+		grbLister: &fakes.GlobalRoleBindingListerMock{
+			ListFunc: func(namespace string, selector labels.Selector) ([]*v3.GlobalRoleBinding, error) {
+				return []*v3.GlobalRoleBinding{{UserName: "u-admin", GlobalRoleName: "admin"}}, nil
+			},
+		},
+		userClient: &fakes.UserInterfaceMock{
+			UpdateFunc: func(in *v3.User) (*v3.User, error) { return in, nil },
+		},
+		lockout: newLockoutTracker(),
+		mfa:     m,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	login := func(code string) error {
+		_, _, _, err := provider.AuthenticateUser(ctx, &v32.BasicLogin{Username: "admin", Password: "correct-password", MFACode: code})
+		return err
+	}
+
+	// Not enrolled and not required.
+	require.NoError(t, login(""))
+
+	require.NoError(t, settings.AuthLocalMFARequiredForAdmins.Set("true"))
+	defer func() {
+		_ = settings.AuthLocalMFARequiredForAdmins.Set(settings.AuthLocalMFARequiredForAdmins.Default)
+	}()
+	// The credentials are valid, the principal is returned to create a session restricted to the enrollment.
+	principal, _, _, err := provider.AuthenticateUser(ctx, &v32.BasicLogin{Username: "admin", Password: "correct-password"})
+	require.Error(t, err)
+	assert.True(t, IsMFAEnrollmentRequired(err))
+	assert.Equal(t, "local://u-admin", principal.Name)
+
+	totpSecret, _, err := m.Enroll(user)
+	require.NoError(t, err)
+	_, err = m.Confirm(user, currentCode(t, totpSecret, now))
+	require.NoError(t, err)
+	now = now.Add(totpPeriod * time.Second)
+
+	err = login("")
+	require.Error(t, err)
+	assert.Equal(t, ErrMFARequired, err.(*httperror.APIError).Code)
+
+	err = login("000000")
+	require.Error(t, err)
+	assert.Equal(t, httperror.Unauthorized, err.(*httperror.APIError).Code)
+
+	assert.NoError(t, login(currentCode(t, totpSecret, now)))
+}
+
+func TestAuthenticateUserMFALockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, _ := newFakeMFAManager(&now)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &v3.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "u-admin"},
+		Username:   "admin",
+		Password:   string(hash),
+	}
+	userIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{userNameIndex: userNameIndexer})
+	require.NoError(t, userIndexer.Add(user))
+
+	var updated *v3.User
+	provider := &Provider{
+		userIndexer: userIndexer,
+		gmIndexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{gmPrincipalIndex: gmPIdIndexer}),
+		grbLister: &fakes.GlobalRoleBindingListerMock{
+			ListFunc: func(namespace string, selector labels.Selector) ([]*v3.GlobalRoleBinding, error) {
+				return []*v3.GlobalRoleBinding{{UserName: "u-admin", GlobalRoleName: "admin"}}, nil
+			},
+		},
+		userClient: &fakes.UserInterfaceMock{
+			UpdateFunc: func(in *v3.User) (*v3.User, error) {
+				updated = in
+				return in, nil
+			},
+		},
+		lockout: newLockoutTracker(),
+		mfa:     m,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	login := func(code string) error {
+		_, _, _, err := provider.AuthenticateUser(ctx, &v32.BasicLogin{Username: "admin", Password: "correct-password", MFACode: code})
+		return err
+	}
+
+	totpSecret, _, err := m.Enroll(user)
+	require.NoError(t, err)
+	_, err = m.Confirm(user, currentCode(t, totpSecret, now))
+	require.NoError(t, err)
+	now = now.Add(totpPeriod * time.Second)
+
+	for i := 0; i < mfaMaxAttempts-1; i++ {
+		require.Error(t, login("000000"))
+	}
+	assert.Nil(t, updated)
+	require.Error(t, login("000000"))
+	require.NotNil(t, updated, "expected the administrator to be locked out after invalid codes")
+	assert.NotEmpty(t, updated.Annotations[LockedUntilAnnotation])
+
+	require.NoError(t, userIndexer.Update(updated))
+	assert.Error(t, login(currentCode(t, totpSecret, now)), "expected login of a locked out user to fail")
+}
@@ -22,6 +22,7 @@
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	publicclient "github.com/rancher/rancher/pkg/client/generated/management/v3public"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	"github.com/rancher/rancher/pkg/types/config"
 )
 
@@ -196,7 +197,9 @@ func IsValidUserExtraAttribute(key string) bool {
 }
 
 func AuthenticateUser(ctx context.Context, input interface{}, providerName string) (v3.Principal, []v3.Principal, string, error) {
-	return Providers[providerName].AuthenticateUser(ctx, input)
+	userPrincipal, groupPrincipals, providerToken, err := Providers[providerName].AuthenticateUser(ctx, input)
+	collectors.ObserveLogin(providerName, err)
+	return userPrincipal, groupPrincipals, providerToken, err
 }
 
 func GetPrincipal(principalID string, myToken v3.Token) (v3.Principal, error) {
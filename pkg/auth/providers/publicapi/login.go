@@ -30,6 +30,7 @@
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3public"
 	v1 "github.com/rancher/rancher/pkg/generated/norman/core/v1"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	schema "github.com/rancher/rancher/pkg/schemas/management.cattle.io/v3public"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/rancher/rancher/pkg/user"
@@ -68,6 +69,26 @@ func (h *loginHandler) login(actionName string, action *types.Action, request *t
 	w := request.Response
 
 	token, unhashedTokenKey, responseType, err := h.createLoginToken(request)
+	if local.IsMFAEnrollmentRequired(err) && token.Name != "" {
+		// The session is restricted to the enrollment, the error tells the client to enroll before logging in again.
+		if responseType == "cookie" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    token.ObjectMeta.Name + ":" + unhashedTokenKey,
+				Secure:   true,
+				Path:     "/",
+				HttpOnly: true,
+			})
+			return err
+		}
+		tokenData, convertErr := tokens.ConvertTokenResource(request.Schemas.Schema(&schema.PublicVersion, client.TokenType), token)
+		if convertErr != nil {
+			return httperror.WrapAPIError(convertErr, httperror.ServerError, "Server error while authenticating")
+		}
+		tokenData["token"] = token.ObjectMeta.Name + ":" + unhashedTokenKey
+		request.WriteResponse(http.StatusCreated, tokenData)
+		return nil
+	}
 	if err != nil {
 		// if user fails to authenticate, hide the details of the exact error. bad credentials will already be APIErrors
 		// otherwise, return a generic error message
@@ -193,12 +214,16 @@ func (h *loginHandler) createLoginToken(request *types.APIContext) (v3.Token, st
 	if providerName == saml.PingName || providerName == saml.ADFSName || providerName == saml.KeyCloakName ||
 		providerName == saml.OKTAName || providerName == saml.ShibbolethName {
 		err = saml.PerformSamlLogin(providerName, request, input)
+		// The login completes when the identity provider posts the assertion, only starting it is recorded here.
+		collectors.ObserveLogin(providerName, err)
 		return v3.Token{}, "", "saml", err
 	}
 
 	ctx := context.WithValue(request.Request.Context(), util.RequestKey, request.Request)
 	userPrincipal, groupPrincipals, providerToken, err = providers.AuthenticateUser(ctx, input, providerName)
-	if err != nil {
+	// Users that must enroll in multi-factor authentication get a session restricted to the enrollment.
+	mfaEnrollment := local.IsMFAEnrollmentRequired(err) && !strings.HasPrefix(responseType, tokens.KubeconfigResponseType)
+	if err != nil && !mfaEnrollment {
 		return v3.Token{}, "", "", err
 	}
 
@@ -259,6 +284,14 @@ func (h *loginHandler) createLoginToken(request *types.APIContext) (v3.Token, st
 		return *token, tokenValue, responseType, nil
 	}
 
-	rToken, unhashedTokenKey, err := h.tokenMGR.NewLoginToken(currUser.Name, userPrincipal, groupPrincipals, providerToken, ttl, description)
+	if mfaEnrollment {
+		rToken, unhashedTokenKey, err := h.tokenMGR.NewMFAEnrollmentToken(currUser.Name, userPrincipal, groupPrincipals, description, request.Request)
+		if err != nil {
+			return v3.Token{}, "", "", err
+		}
+		return rToken, unhashedTokenKey, responseType, httperror.NewAPIError(local.ErrMFAEnrollmentRequired, "multi-factor authentication must be enabled for this user")
+	}
+
+	rToken, unhashedTokenKey, err := h.tokenMGR.NewLoginToken(currUser.Name, userPrincipal, groupPrincipals, providerToken, ttl, description, request.Request)
 	return rToken, unhashedTokenKey, responseType, err
 }
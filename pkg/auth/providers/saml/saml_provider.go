@@ -132,6 +132,12 @@ func (s *Provider) LogoutAll(apiContext *types.APIContext, token *v3.Token) erro
 
 	logrus.Debugf("SAML [logout-all]: triggered by provider %s", providerName)
 
+	if apiContext == nil {
+		// The session was revoked outside of the logoutAll action, there is no browser to redirect to the IdP.
+		logrus.Debugf("SAML [logout-all]: skipping single logout of session %s revoked without a request", token.Name)
+		return nil
+	}
+
 	provider, ok := SamlProviders[providerName]
 	if !ok {
 		logrus.Debugf("SAML [logout-all]: Rancher provider resource `%v` not configured at all", providerName)
@@ -15,6 +15,8 @@
 	"github.com/rancher/rancher/pkg/auth/tokens"
 	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
+	"github.com/rancher/rancher/pkg/tracing"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/rancher/steve/pkg/auth"
 	"github.com/sirupsen/logrus"
@@ -62,7 +64,17 @@ type tokenAuthenticator struct {
 // ToAuthMiddleware converts an Authenticator to an auth.Middleware.
 func ToAuthMiddleware(a Authenticator) auth.Middleware {
 	f := func(req *http.Request) (user.Info, bool, error) {
-		authResp, err := a.Authenticate(req)
+		ctx, span := tracing.Start(req.Context(), "authenticate")
+		authResp, err := a.Authenticate(req.WithContext(ctx))
+		if err == nil {
+			span.SetAttributes(tracing.UserKey.String(authResp.User))
+		}
+		if errors.Is(err, ErrMustAuthenticate) {
+			// Anonymous requests aren't failures of the authentication.
+			tracing.End(span, nil)
+		} else {
+			tracing.End(span, err)
+		}
 		if err != nil {
 			return nil, false, err
 		}
@@ -122,6 +134,9 @@ func (a *tokenAuthenticator) Authenticate(req *http.Request) (*AuthenticatorResp
 	if token.ClusterName != "" && token.ClusterName != a.clusterRouter(req) {
 		return nil, errors.Wrapf(ErrMustAuthenticate, "clusterID does not match")
 	}
+	if tokens.IsMFAEnrollment(token) && !tokens.IsMFAEnrollmentRequest(req) {
+		return nil, errors.Wrapf(ErrMustAuthenticate, "token is restricted to the enrollment in multi-factor authentication")
+	}
 
 	// If the auth provider is specified make sure it exists and enabled.
 	if token.AuthProvider != "" {
@@ -274,6 +289,8 @@ func (a *tokenAuthenticator) TokenFromRequest(req *http.Request) (*v3.Token, err
 		lookupUsingClient = true
 	}
 
+	collectors.ObserveTokenCache(!lookupUsingClient)
+
 	var storedToken *v3.Token
 	if lookupUsingClient {
 		storedToken, err = a.tokenClient.Get(tokenName, metav1.GetOptions{})
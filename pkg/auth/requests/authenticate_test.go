@@ -12,6 +12,7 @@
 	apiv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/auth/providers"
 	"github.com/rancher/rancher/pkg/auth/providers/common"
+	"github.com/rancher/rancher/pkg/auth/tokens"
 	"github.com/rancher/rancher/pkg/clusterrouter"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	mgmtFakes "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
@@ -514,6 +515,24 @@ func TestTokenAuthenticatorAuthenticate(t *testing.T) {
 		require.Nil(t, resp)
 	})
 
+	t.Run("token restricted to the enrollment in multi-factor authentication", func(t *testing.T) {
+		oldLabels := token.Labels
+		defer func() { token.Labels = oldLabels }()
+		token.Labels = map[string]string{tokens.TokenKindLabel: tokens.MFAEnrollmentTokenKind}
+
+		userRefresher.reset()
+
+		resp, err := authenticator.Authenticate(req)
+		require.ErrorIs(t, err, ErrMustAuthenticate)
+		require.Nil(t, resp)
+
+		enrollReq := httptest.NewRequest(http.MethodPost, "/v3/users?action=enrollmfa", nil)
+		enrollReq.Header.Set("Authorization", "Bearer "+token.Name+":"+token.Token)
+		resp, err = authenticator.Authenticate(enrollReq)
+		require.NoError(t, err)
+		assert.True(t, resp.IsAuthed)
+	})
+
 	t.Run("user doesn't exist", func(t *testing.T) {
 		oldGetUserFunc := userLister.GetFunc
 		defer func() { userLister.GetFunc = oldGetUserFunc }()
@@ -0,0 +1,513 @@
+package scim
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// groupPrincipalPrefix returns the prefix of the group principals of the SCIM auth provider.
+func groupPrincipalPrefix() string {
+	return provider() + "_group://"
+}
+
+// groupPrincipal returns the ID of the principal of a SCIM group, which is derived from the attribute of the group
+// configured by the scim-group-principal-attribute setting.
+func groupPrincipal(group *Group) (string, error) {
+	value := group.DisplayName
+	attribute := "displayName"
+	if strings.EqualFold(settings.SCIMGroupPrincipalAttribute.Get(), "externalId") {
+		value = group.ExternalID
+		attribute = "externalId"
+	}
+	if value == "" {
+		return "", badRequest(scimTypeValue, "%s is required", attribute)
+	}
+	return groupPrincipalPrefix() + value, nil
+}
+
+// groupID returns the SCIM ID of the group with the given principal. Principal IDs hold characters that aren't
+// allowed in URL paths, so they are encoded.
+func groupID(principalID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(principalID))
+}
+
+// principalOfGroup returns the ID of the principal of the SCIM group with the given ID.
+func principalOfGroup(id string) (string, error) {
+	principalID, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil || !strings.HasPrefix(string(principalID), groupPrincipalPrefix()) {
+		return "", notFound("group %s not found", id)
+	}
+	return string(principalID), nil
+}
+
+// group is a group principal of the SCIM auth provider along with the users holding it.
+type group struct {
+	principal v3.Principal
+	members   []string
+}
+
+// groups returns the group principals of the SCIM auth provider held by at least one user.
+func (h *Handler) groups() (map[string]*group, error) {
+	attributes, err := h.attributeCache.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*group{}
+	for _, attribs := range attributes {
+		for _, principal := range attribs.GroupPrincipals[provider()].Items {
+			g, ok := groups[principal.Name]
+			if !ok {
+				g = &group{principal: principal}
+				groups[principal.Name] = g
+			}
+			g.members = append(g.members, attribs.Name)
+		}
+	}
+	for _, g := range groups {
+		sort.Strings(g.members)
+	}
+	return groups, nil
+}
+
+// group returns the group with the given principal. Groups are implicit, so a group without members is returned
+// as long as the principal is one of the SCIM auth provider.
+func (h *Handler) group(principalID string) (*group, error) {
+	groups, err := h.groups()
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := groups[principalID]; ok {
+		return g, nil
+	}
+	return &group{principal: newGroupPrincipal(principalID, "")}, nil
+}
+
+func newGroupPrincipal(principalID, displayName string) v3.Principal {
+	if displayName == "" {
+		displayName = strings.TrimPrefix(principalID, groupPrincipalPrefix())
+	}
+	return v3.Principal{
+		ObjectMeta:    metav1.ObjectMeta{Name: principalID},
+		DisplayName:   displayName,
+		PrincipalType: "group",
+		Provider:      provider(),
+		MemberOf:      true,
+	}
+}
+
+func (h *Handler) listGroups(rw http.ResponseWriter, req *http.Request) {
+	attribute, value, err := parseFilter(req.URL.Query().Get("filter"))
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	switch attribute {
+	case "", "displayname", "externalid", "id":
+	default:
+		handleError(rw, badRequest(scimTypeFilter, "filtering groups by %s is not supported", attribute))
+		return
+	}
+
+	groups, err := h.groups()
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	principalIDs := make([]string, 0, len(groups))
+	for principalID := range groups {
+		principalIDs = append(principalIDs, principalID)
+	}
+	sort.Strings(principalIDs)
+
+	var resources []Group
+	for _, principalID := range principalIDs {
+		scimGroup := toSCIMGroup(groups[principalID], req.URL.Query().Get("excludedAttributes") == "members")
+		switch {
+		case attribute == "displayname" && !strings.EqualFold(scimGroup.DisplayName, value),
+			attribute == "externalid" && scimGroup.ExternalID != value,
+			attribute == "id" && scimGroup.ID != value:
+			continue
+		}
+		resources = append(resources, scimGroup)
+	}
+
+	list, err := page(req, resources)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, list)
+}
+
+func (h *Handler) getGroup(rw http.ResponseWriter, req *http.Request) {
+	principalID, err := principalOfGroup(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	g, err := h.group(principalID)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, toSCIMGroup(g, req.URL.Query().Get("excludedAttributes") == "members"))
+}
+
+func (h *Handler) createGroup(rw http.ResponseWriter, req *http.Request) {
+	var scimGroup Group
+	if err := readJSON(req, &scimGroup); err != nil {
+		handleError(rw, err)
+		return
+	}
+	principalID, err := groupPrincipal(&scimGroup)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+
+	groups, err := h.groups()
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	if _, ok := groups[principalID]; ok {
+		handleError(rw, conflict("group %s already exists", principalID))
+		return
+	}
+
+	g := &group{principal: newGroupPrincipal(principalID, scimGroup.DisplayName)}
+	if err := h.setMembers(g, references(scimGroup.Members)); err != nil {
+		handleError(rw, err)
+		return
+	}
+	logrus.Infof("[scim] Provisioned group %s with %d members", principalID, len(g.members))
+	writeJSON(rw, http.StatusCreated, toSCIMGroup(g, false))
+}
+
+func (h *Handler) replaceGroup(rw http.ResponseWriter, req *http.Request) {
+	principalID, err := principalOfGroup(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	var scimGroup Group
+	if err := readJSON(req, &scimGroup); err != nil {
+		handleError(rw, err)
+		return
+	}
+	g, err := h.group(principalID)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	if err := h.updateGroup(g, &scimGroup); err != nil {
+		handleError(rw, err)
+		return
+	}
+	if err := h.setMembers(g, references(scimGroup.Members)); err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, toSCIMGroup(g, false))
+}
+
+func (h *Handler) patchGroup(rw http.ResponseWriter, req *http.Request) {
+	principalID, err := principalOfGroup(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	var patch PatchRequest
+	if err := readJSON(req, &patch); err != nil {
+		handleError(rw, err)
+		return
+	}
+
+	g, err := h.group(principalID)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	for _, op := range patch.Operations {
+		if g, err = h.patchGroupOperation(g, op); err != nil {
+			handleError(rw, err)
+			return
+		}
+	}
+	writeJSON(rw, http.StatusOK, toSCIMGroup(g, false))
+}
+
+func (h *Handler) deleteGroup(rw http.ResponseWriter, req *http.Request) {
+	principalID, err := principalOfGroup(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	g, err := h.group(principalID)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	if err := h.setMembers(g, nil); err != nil {
+		handleError(rw, err)
+		return
+	}
+	logrus.Infof("[scim] Deleted group %s", principalID)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// patchGroupOperation applies a PATCH operation to a group. Only the members and the display name of groups can be changed.
+func (h *Handler) patchGroupOperation(g *group, op PatchOperation) (*group, error) {
+	path := strings.ToLower(op.Path)
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		if path == "" {
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return nil, badRequest(scimTypeValue, "invalid value of %s operation: %v", op.Op, err)
+			}
+			for attribute, value := range values {
+				var err error
+				if g, err = h.patchGroupOperation(g, PatchOperation{Op: op.Op, Path: attribute, Value: value}); err != nil {
+					return nil, err
+				}
+			}
+			return g, nil
+		}
+
+		switch path {
+		case "members":
+			var members []Reference
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return nil, badRequest(scimTypeValue, "invalid value of members: %v", err)
+			}
+			if strings.EqualFold(op.Op, "replace") {
+				return g, h.setMembers(g, references(members))
+			}
+			return g, h.setMembers(g, append(g.members, references(members)...))
+		case "displayname":
+			var displayName string
+			if err := json.Unmarshal(op.Value, &displayName); err != nil {
+				return nil, badRequest(scimTypeValue, "invalid value of displayName: %v", err)
+			}
+			scimGroup := toSCIMGroup(g, true)
+			scimGroup.DisplayName = displayName
+			return g, h.updateGroup(g, &scimGroup)
+		}
+		return g, nil
+	case "remove":
+		switch {
+		case path == "members":
+			if len(op.Value) == 0 {
+				return g, h.setMembers(g, nil)
+			}
+			var members []Reference
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return nil, badRequest(scimTypeValue, "invalid value of members: %v", err)
+			}
+			return g, h.setMembers(g, without(g.members, references(members)))
+		case strings.HasPrefix(path, "members["):
+			member, err := memberOfPath(op.Path)
+			if err != nil {
+				return nil, err
+			}
+			return g, h.setMembers(g, without(g.members, []string{member}))
+		}
+		return g, nil
+	default:
+		return nil, badRequest(scimTypeInvalidOp, "unsupported operation %s", op.Op)
+	}
+}
+
+// memberOfPath returns the member a value filter path like members[value eq "u-abcde"] selects.
+func memberOfPath(path string) (string, error) {
+	filter := strings.TrimSuffix(path[strings.Index(path, "[")+1:], "]")
+	attribute, value, err := parseFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	if attribute != "value" {
+		return "", badRequest(scimTypeFilter, "unsupported member filter %s", filter)
+	}
+	return value, nil
+}
+
+// updateGroup applies the display name of a SCIM group to the principal copies held by the members of the group.
+func (h *Handler) updateGroup(g *group, scimGroup *Group) error {
+	principalID, err := groupPrincipal(scimGroup)
+	if err != nil {
+		return err
+	}
+	if principalID != g.principal.Name {
+		return badRequest(scimTypeMutable, "the principal of group %s can't be changed to %s", g.principal.Name, principalID)
+	}
+
+	if scimGroup.DisplayName == "" || scimGroup.DisplayName == g.principal.DisplayName {
+		return nil
+	}
+	g.principal.DisplayName = scimGroup.DisplayName
+	for _, member := range g.members {
+		if err := h.setMembership(member, g.principal, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMembers makes the given users the members of a group.
+func (h *Handler) setMembers(g *group, members []string) error {
+	desired := map[string]bool{}
+	for _, member := range members {
+		desired[member] = true
+	}
+	for member := range desired {
+		if _, err := h.userCache.Get(member); err != nil {
+			if apierrors.IsNotFound(err) {
+				return badRequest(scimTypeValue, "member %s is not a user", member)
+			}
+			return err
+		}
+	}
+
+	for _, member := range g.members {
+		if desired[member] {
+			continue
+		}
+		if err := h.setMembership(member, g.principal, false); err != nil {
+			return err
+		}
+	}
+	for member := range desired {
+		if err := h.setMembership(member, g.principal, true); err != nil {
+			return err
+		}
+	}
+
+	g.members = make([]string, 0, len(desired))
+	for member := range desired {
+		g.members = append(g.members, member)
+	}
+	sort.Strings(g.members)
+	return nil
+}
+
+// setMembership adds or removes a group principal to or from the group principals of the SCIM auth provider
+// held by the UserAttribute of a user. The UserAttribute is created if the user has none yet.
+func (h *Handler) setMembership(userID string, principal v3.Principal, member bool) error {
+	// The UserAttribute is read from the API server, as a request can change it several times.
+	attribs, err := h.userAttributes.Get(userID, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if !member {
+			return nil
+		}
+		user, err := h.userCache.Get(userID)
+		if err != nil {
+			return err
+		}
+		_, err = h.userAttributes.Create(&v3.UserAttribute{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: userID,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: user.APIVersion,
+					Kind:       user.Kind,
+					UID:        user.UID,
+					Name:       user.Name,
+				}},
+			},
+			GroupPrincipals: map[string]v3.Principals{provider(): {Items: []v3.Principal{principal}}},
+			ExtraByProvider: map[string]map[string][]string{},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if attribs.GroupPrincipals == nil {
+		attribs.GroupPrincipals = map[string]v3.Principals{}
+	}
+	items := attribs.GroupPrincipals[provider()].Items
+	index := -1
+	for i, p := range items {
+		if p.Name == principal.Name {
+			index = i
+			break
+		}
+	}
+
+	switch {
+	case member && index < 0:
+		items = append(items, principal)
+	case member && items[index].DisplayName != principal.DisplayName:
+		items[index] = principal
+	case !member && index >= 0:
+		items = append(items[:index], items[index+1:]...)
+	default:
+		return nil
+	}
+	attribs.GroupPrincipals[provider()] = v3.Principals{Items: items}
+	_, err = h.userAttributes.Update(attribs)
+	return err
+}
+
+// toSCIMGroup returns the SCIM representation of a group.
+func toSCIMGroup(g *group, excludeMembers bool) Group {
+	value := strings.TrimPrefix(g.principal.Name, groupPrincipalPrefix())
+	scimGroup := Group{
+		Schemas:     []string{groupSchema},
+		ID:          groupID(g.principal.Name),
+		DisplayName: g.principal.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Location:     Endpoint + "/Groups/" + groupID(g.principal.Name),
+		},
+	}
+	if scimGroup.DisplayName == "" {
+		scimGroup.DisplayName = value
+	}
+	if strings.EqualFold(settings.SCIMGroupPrincipalAttribute.Get(), "externalId") {
+		scimGroup.ExternalID = value
+	}
+	if excludeMembers {
+		return scimGroup
+	}
+	for _, member := range g.members {
+		scimGroup.Members = append(scimGroup.Members, Reference{
+			Value: member,
+			Ref:   Endpoint + "/Users/" + member,
+		})
+	}
+	return scimGroup
+}
+
+func references(refs []Reference) []string {
+	values := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		values = append(values, ref.Value)
+	}
+	return values
+}
+
+// without returns the members that aren't removed.
+func without(members, removed []string) []string {
+	var result []string
+	for _, member := range members {
+		if !slices.Contains(removed, member) {
+			result = append(result, member)
+		}
+	}
+	return result
+}
@@ -0,0 +1,292 @@
+// Package scim serves a SCIM 2.0 (RFC 7643, RFC 7644) provisioning endpoint, allowing identity providers to
+// pre-provision Rancher users, push group memberships and deactivate users who left the organization.
+//
+// SCIM users are Rancher users with a principal of the configured auth provider. SCIM groups are group principals of
+// that provider: their members are the users whose UserAttribute holds the group principal, the same way group
+// memberships are recorded when users log in. Logins and group refreshes replace them with the groups the provider returns.
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rancher/rancher/pkg/apis/management.cattle.io"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/tokens"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/types/config"
+	"github.com/sirupsen/logrus"
+	authv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// Endpoint is the path prefix of the SCIM endpoint.
+const Endpoint = "/v1-scim/v2"
+
+const (
+	// UserNameAnnotation holds the SCIM userName of users provisioned through SCIM.
+	UserNameAnnotation = "management.cattle.io/scim-user-name"
+	// ExternalIDAnnotation holds the SCIM externalId of users provisioned through SCIM.
+	ExternalIDAnnotation = "management.cattle.io/scim-external-id"
+)
+
+// userManager creates Rancher users for principals.
+type userManager interface {
+	EnsureUser(principalName, displayName string) (*v3.User, error)
+	GetUserByPrincipalID(principalName string) (*v3.User, error)
+}
+
+// tokenRevoker revokes the tokens of deactivated users.
+type tokenRevoker interface {
+	RevokeUserTokens(userID string) error
+}
+
+// Handler serves the SCIM endpoint.
+type Handler struct {
+	users          mgmtcontrollers.UserClient
+	userCache      mgmtcontrollers.UserCache
+	userAttributes mgmtcontrollers.UserAttributeClient
+	attributeCache mgmtcontrollers.UserAttributeCache
+	userManager    userManager
+	tokens         tokenRevoker
+	sar            authorizationv1client.SubjectAccessReviewInterface
+	router         *mux.Router
+}
+
+// NewHandler returns a handler serving the SCIM endpoint.
+func NewHandler(ctx context.Context, scaledContext *config.ScaledContext) *Handler {
+	return newHandler(
+		scaledContext.Wrangler.Mgmt.User(),
+		scaledContext.Wrangler.Mgmt.UserAttribute(),
+		scaledContext.UserManager,
+		tokens.NewManager(ctx, scaledContext),
+		scaledContext.K8sClient.AuthorizationV1().SubjectAccessReviews(),
+	)
+}
+
+func newHandler(users mgmtcontrollers.UserController, userAttributes mgmtcontrollers.UserAttributeController, userManager userManager, tokens tokenRevoker, sar authorizationv1client.SubjectAccessReviewInterface) *Handler {
+	h := &Handler{
+		users:          users,
+		userCache:      users.Cache(),
+		userAttributes: userAttributes,
+		attributeCache: userAttributes.Cache(),
+		userManager:    userManager,
+		tokens:         tokens,
+		sar:            sar,
+	}
+
+	r := mux.NewRouter()
+	r.UseEncodedPath()
+	r.Path(Endpoint + "/ServiceProviderConfig").Methods(http.MethodGet).HandlerFunc(h.serviceProviderConfig)
+	r.Path(Endpoint + "/Users").Methods(http.MethodGet).HandlerFunc(h.authorized("users", "list", h.listUsers))
+	r.Path(Endpoint + "/Users").Methods(http.MethodPost).HandlerFunc(h.authorized("users", "create", h.createUser))
+	r.Path(Endpoint + "/Users/{id}").Methods(http.MethodGet).HandlerFunc(h.authorized("users", "get", h.getUser))
+	r.Path(Endpoint + "/Users/{id}").Methods(http.MethodPut).HandlerFunc(h.authorized("users", "update", h.replaceUser))
+	r.Path(Endpoint + "/Users/{id}").Methods(http.MethodPatch).HandlerFunc(h.authorized("users", "update", h.patchUser))
+	r.Path(Endpoint + "/Users/{id}").Methods(http.MethodDelete).HandlerFunc(h.authorized("users", "delete", h.deleteUser))
+	r.Path(Endpoint + "/Groups").Methods(http.MethodGet).HandlerFunc(h.authorized("userattributes", "list", h.listGroups))
+	r.Path(Endpoint + "/Groups").Methods(http.MethodPost).HandlerFunc(h.authorized("userattributes", "update", h.createGroup))
+	r.Path(Endpoint + "/Groups/{id}").Methods(http.MethodGet).HandlerFunc(h.authorized("userattributes", "get", h.getGroup))
+	r.Path(Endpoint + "/Groups/{id}").Methods(http.MethodPut).HandlerFunc(h.authorized("userattributes", "update", h.replaceGroup))
+	r.Path(Endpoint + "/Groups/{id}").Methods(http.MethodPatch).HandlerFunc(h.authorized("userattributes", "update", h.patchGroup))
+	r.Path(Endpoint + "/Groups/{id}").Methods(http.MethodDelete).HandlerFunc(h.authorized("userattributes", "update", h.deleteGroup))
+	r.NotFoundHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeError(rw, http.StatusNotFound, "", "resource not found")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeError(rw, http.StatusMethodNotAllowed, "", "method not allowed")
+	})
+	h.router = r
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if provider() == "" {
+		writeError(rw, http.StatusNotImplemented, "", "SCIM provisioning is not configured: setting "+settings.SCIMAuthProvider.Name+" is empty")
+		return
+	}
+	h.router.ServeHTTP(rw, req)
+}
+
+// authorized only calls next if the caller is allowed to perform verb on the resource of the management.cattle.io group.
+func (h *Handler) authorized(resource, verb string, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		userInfo, ok := request.UserFrom(req.Context())
+		if !ok {
+			writeError(rw, http.StatusUnauthorized, "", "unable to extract user info from context")
+			return
+		}
+		extra := map[string]authv1.ExtraValue{}
+		for k, v := range userInfo.GetExtra() {
+			extra[k] = v
+		}
+		review := authv1.SubjectAccessReview{
+			Spec: authv1.SubjectAccessReviewSpec{
+				User:   userInfo.GetName(),
+				Groups: userInfo.GetGroups(),
+				Extra:  extra,
+				UID:    userInfo.GetUID(),
+				ResourceAttributes: &authv1.ResourceAttributes{
+					Verb:     verb,
+					Group:    management.GroupName,
+					Resource: resource,
+				},
+			},
+		}
+		result, err := h.sar.Create(req.Context(), &review, metav1.CreateOptions{})
+		if err != nil {
+			writeError(rw, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		if !result.Status.Allowed {
+			writeError(rw, http.StatusForbidden, "", fmt.Sprintf("%s %s is not allowed", verb, resource))
+			return
+		}
+		next(rw, req)
+	}
+}
+
+func (h *Handler) serviceProviderConfig(rw http.ResponseWriter, _ *http.Request) {
+	supported := func(supported bool) map[string]any { return map[string]any{"supported": supported} }
+	writeJSON(rw, http.StatusOK, map[string]any{
+		"schemas":        []string{spConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxPageSize},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Rancher API token",
+			"description": "Authentication with a Rancher API token sent as bearer token",
+		}},
+	})
+}
+
+// provider returns the auth provider whose principals SCIM users and groups are.
+func provider() string {
+	return settings.SCIMAuthProvider.Get()
+}
+
+// errStatus is an error with the HTTP status and SCIM error type of its response.
+type errStatus struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *errStatus) Error() string {
+	return e.detail
+}
+
+func badRequest(scimType, format string, args ...any) error {
+	return &errStatus{status: http.StatusBadRequest, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &errStatus{status: http.StatusNotFound, detail: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...any) error {
+	return &errStatus{status: http.StatusConflict, scimType: scimTypeUnique, detail: fmt.Sprintf(format, args...)}
+}
+
+// handleError writes the response of err.
+func handleError(rw http.ResponseWriter, err error) {
+	var e *errStatus
+	switch {
+	case errors.As(err, &e):
+		writeError(rw, e.status, e.scimType, e.detail)
+	case apierrors.IsNotFound(err):
+		writeError(rw, http.StatusNotFound, "", err.Error())
+	case apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err):
+		writeError(rw, http.StatusConflict, "", err.Error())
+	default:
+		logrus.Errorf("[scim] %v", err)
+		writeError(rw, http.StatusInternalServerError, "", err.Error())
+	}
+}
+
+func writeError(rw http.ResponseWriter, status int, scimType, detail string) {
+	writeJSON(rw, status, Error{
+		Schemas:  []string{errorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, status int, obj any) {
+	rw.Header().Set("Content-Type", scimContentType)
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		logrus.Errorf("[scim] failed to write response: %v", err)
+	}
+}
+
+func readJSON(req *http.Request, obj any) error {
+	if err := json.NewDecoder(req.Body).Decode(obj); err != nil {
+		return badRequest(scimTypeSyntax, "failed to parse request body: %v", err)
+	}
+	return nil
+}
+
+// parseFilter parses the filters supported by the endpoint, which are equality filters on a single attribute,
+// e.g. userName eq "john". It returns the lowercase attribute and the value.
+func parseFilter(filter string) (string, string, error) {
+	if filter == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(strings.TrimSpace(filter), " ", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[1], "eq") {
+		return "", "", badRequest(scimTypeFilter, "unsupported filter %q: only equality filters are supported", filter)
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(parts[2]))
+	if err != nil {
+		return "", "", badRequest(scimTypeFilter, "invalid filter value %s", parts[2])
+	}
+	return strings.ToLower(parts[0]), value, nil
+}
+
+// page returns the SCIM list response of the page requested by the startIndex and count query parameters.
+func page[T any](req *http.Request, resources []T) (ListResponse, error) {
+	startIndex, count := 1, defaultPageSize
+	var err error
+	if s := req.URL.Query().Get("startIndex"); s != "" {
+		if startIndex, err = strconv.Atoi(s); err != nil {
+			return ListResponse{}, badRequest(scimTypeValue, "invalid startIndex %s", s)
+		}
+		startIndex = max(startIndex, 1)
+	}
+	if s := req.URL.Query().Get("count"); s != "" {
+		if count, err = strconv.Atoi(s); err != nil {
+			return ListResponse{}, badRequest(scimTypeValue, "invalid count %s", s)
+		}
+		count = min(max(count, 0), maxPageSize)
+	}
+
+	list := ListResponse{
+		Schemas:      []string{listSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		Resources:    []any{},
+	}
+	for i := startIndex - 1; i < len(resources) && len(list.Resources) < count; i++ {
+		list.Resources = append(list.Resources, resources[i])
+	}
+	list.ItemsPerPage = len(list.Resources)
+	return list, nil
+}
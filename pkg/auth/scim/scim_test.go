@@ -0,0 +1,411 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	authv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeUserManager creates users named after their principal.
+type fakeUserManager struct {
+	users map[string]*v3.User
+}
+
+func (m *fakeUserManager) EnsureUser(principalName, displayName string) (*v3.User, error) {
+	user := &v3.User{
+		ObjectMeta:   metav1.ObjectMeta{Name: "u-" + strings.TrimPrefix(principalName, "okta_user://")},
+		DisplayName:  displayName,
+		PrincipalIDs: []string{principalName},
+	}
+	m.users[user.Name] = user
+	return user.DeepCopy(), nil
+}
+
+func (m *fakeUserManager) GetUserByPrincipalID(principalName string) (*v3.User, error) {
+	for _, user := range m.users {
+		for _, principalID := range user.PrincipalIDs {
+			if principalID == principalName {
+				return user.DeepCopy(), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+type fakeTokenRevoker struct {
+	revoked []string
+}
+
+func (r *fakeTokenRevoker) RevokeUserTokens(userID string) error {
+	r.revoked = append(r.revoked, userID)
+	return nil
+}
+
+type testHandler struct {
+	*Handler
+	users      map[string]*v3.User
+	attributes map[string]*v3.UserAttribute
+	revoker    *fakeTokenRevoker
+}
+
+func newTestHandler(t *testing.T, users ...*v3.User) *testHandler {
+	t.Helper()
+	require.NoError(t, settings.SCIMAuthProvider.Set("okta"))
+	t.Cleanup(func() { settings.SCIMAuthProvider.Set("") })
+
+	th := &testHandler{
+		users:      map[string]*v3.User{},
+		attributes: map[string]*v3.UserAttribute{},
+		revoker:    &fakeTokenRevoker{},
+	}
+	for _, u := range users {
+		th.users[u.Name] = u
+	}
+
+	ctrl := gomock.NewController(t)
+	userController := fake.NewMockNonNamespacedControllerInterface[*v3.User, *v3.UserList](ctrl)
+	userCache := fake.NewMockNonNamespacedCacheInterface[*v3.User](ctrl)
+	userController.EXPECT().Cache().Return(userCache)
+	userCache.EXPECT().Get(gomock.Any()).DoAndReturn(func(name string) (*v3.User, error) {
+		if u, ok := th.users[name]; ok {
+			return u.DeepCopy(), nil
+		}
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "users"}, name)
+	}).AnyTimes()
+	userCache.EXPECT().List(labels.Everything()).DoAndReturn(func(labels.Selector) ([]*v3.User, error) {
+		var list []*v3.User
+		for _, u := range th.users {
+			list = append(list, u.DeepCopy())
+		}
+		return list, nil
+	}).AnyTimes()
+	userController.EXPECT().Update(gomock.Any()).DoAndReturn(func(u *v3.User) (*v3.User, error) {
+		th.users[u.Name] = u.DeepCopy()
+		return u, nil
+	}).AnyTimes()
+	userController.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(func(name string, _ *metav1.DeleteOptions) error {
+		delete(th.users, name)
+		return nil
+	}).AnyTimes()
+
+	attributeController := fake.NewMockNonNamespacedControllerInterface[*v3.UserAttribute, *v3.UserAttributeList](ctrl)
+	attributeCache := fake.NewMockNonNamespacedCacheInterface[*v3.UserAttribute](ctrl)
+	attributeController.EXPECT().Cache().Return(attributeCache)
+	getAttribute := func(name string) (*v3.UserAttribute, error) {
+		if a, ok := th.attributes[name]; ok {
+			return a.DeepCopy(), nil
+		}
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "userattributes"}, name)
+	}
+	attributeCache.EXPECT().Get(gomock.Any()).DoAndReturn(getAttribute).AnyTimes()
+	attributeController.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(name string, _ metav1.GetOptions) (*v3.UserAttribute, error) {
+		return getAttribute(name)
+	}).AnyTimes()
+	attributeCache.EXPECT().List(labels.Everything()).DoAndReturn(func(labels.Selector) ([]*v3.UserAttribute, error) {
+		var list []*v3.UserAttribute
+		for _, a := range th.attributes {
+			list = append(list, a.DeepCopy())
+		}
+		return list, nil
+	}).AnyTimes()
+	storeAttribute := func(a *v3.UserAttribute) (*v3.UserAttribute, error) {
+		th.attributes[a.Name] = a.DeepCopy()
+		return a, nil
+	}
+	attributeController.EXPECT().Create(gomock.Any()).DoAndReturn(storeAttribute).AnyTimes()
+	attributeController.EXPECT().Update(gomock.Any()).DoAndReturn(storeAttribute).AnyTimes()
+
+	k8sClient := k8sfake.NewSimpleClientset()
+	k8sClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "admin"
+		return true, review, nil
+	})
+
+	th.Handler = newHandler(userController, attributeController, &fakeUserManager{users: th.users}, th.revoker, k8sClient.AuthorizationV1().SubjectAccessReviews())
+	return th
+}
+
+func (th *testHandler) do(t *testing.T, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+	return th.doAs(t, "admin", method, path, body)
+}
+
+func (th *testHandler) doAs(t *testing.T, userName, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+	var reqBody string
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reqBody = string(data)
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(reqBody))
+	req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: userName}))
+	rr := httptest.NewRecorder()
+	th.ServeHTTP(rr, req)
+
+	var resp map[string]any
+	if rr.Body.Len() > 0 {
+		assert.Equal(t, scimContentType, rr.Header().Get("Content-Type"))
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	}
+	return rr.Code, resp
+}
+
+func TestNotConfigured(t *testing.T) {
+	th := newTestHandler(t)
+	require.NoError(t, settings.SCIMAuthProvider.Set(""))
+
+	code, resp := th.do(t, http.MethodGet, Endpoint+"/Users", nil)
+	assert.Equal(t, http.StatusNotImplemented, code)
+	assert.Equal(t, []any{errorSchema}, resp["schemas"])
+	assert.Equal(t, "501", resp["status"])
+}
+
+func TestForbidden(t *testing.T) {
+	th := newTestHandler(t)
+
+	code, resp := th.doAs(t, "u-viewer", http.MethodGet, Endpoint+"/Users", nil)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "list users is not allowed", resp["detail"])
+}
+
+func TestUsers(t *testing.T) {
+	th := newTestHandler(t, &v3.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-local"},
+		Username:   "admin",
+	})
+
+	code, resp := th.do(t, http.MethodPost, Endpoint+"/Users", map[string]any{
+		"schemas":    []string{userSchema},
+		"userName":   "john@example.com",
+		"externalId": "00u1",
+		"name":       map[string]any{"givenName": "John", "familyName": "Doe"},
+		"active":     true,
+	})
+	require.Equal(t, http.StatusCreated, code, resp)
+	assert.Equal(t, "u-john@example.com", resp["id"])
+	assert.Equal(t, "john@example.com", resp["userName"])
+	assert.Equal(t, "00u1", resp["externalId"])
+	assert.Equal(t, true, resp["active"])
+	user := th.users["u-john@example.com"]
+	assert.Equal(t, []string{"okta_user://john@example.com"}, user.PrincipalIDs)
+	assert.Equal(t, "John Doe", user.DisplayName)
+	assert.Equal(t, "00u1", user.Annotations[ExternalIDAnnotation])
+
+	code, resp = th.do(t, http.MethodPost, Endpoint+"/Users", map[string]any{"userName": "john@example.com"})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, scimTypeUnique, resp["scimType"])
+
+	// Only users with a principal of the SCIM auth provider are listed.
+	code, resp = th.do(t, http.MethodGet, Endpoint+"/Users", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), resp["totalResults"])
+
+	code, resp = th.do(t, http.MethodGet, Endpoint+`/Users?filter=userName+eq+"JOHN@example.com"`, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), resp["totalResults"])
+	code, resp = th.do(t, http.MethodGet, Endpoint+`/Users?filter=externalId+eq+"00u2"`, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(0), resp["totalResults"])
+	assert.Equal(t, []any{}, resp["Resources"])
+
+	code, _ = th.do(t, http.MethodGet, Endpoint+"/Users/user-local", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Deactivation with a string value, as sent by some identity providers.
+	code, resp = th.do(t, http.MethodPatch, Endpoint+"/Users/u-john@example.com", map[string]any{
+		"schemas":    []string{patchOpSchema},
+		"Operations": []map[string]any{{"op": "Replace", "value": map[string]any{"active": "False"}}},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, false, resp["active"])
+	assert.False(t, *th.users["u-john@example.com"].Enabled)
+	assert.Equal(t, []string{"u-john@example.com"}, th.revoker.revoked)
+
+	code, resp = th.do(t, http.MethodPatch, Endpoint+"/Users/u-john@example.com", map[string]any{
+		"Operations": []map[string]any{
+			{"op": "replace", "path": "active", "value": true},
+			{"op": "replace", "path": "displayName", "value": "Johnny"},
+			{"op": "add", "path": "emails", "value": []any{map[string]any{"value": "john@example.com"}}},
+		},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, true, resp["active"])
+	assert.Equal(t, "Johnny", th.users["u-john@example.com"].DisplayName)
+	assert.Len(t, th.revoker.revoked, 1)
+
+	code, resp = th.do(t, http.MethodPut, Endpoint+"/Users/u-john@example.com", map[string]any{"userName": "jane@example.com"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, scimTypeMutable, resp["scimType"])
+
+	code, _ = th.do(t, http.MethodDelete, Endpoint+"/Users/u-john@example.com", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.NotContains(t, th.users, "u-john@example.com")
+}
+
+func TestGroups(t *testing.T) {
+	newUser := func(name string) *v3.User {
+		return &v3.User{
+			ObjectMeta:   metav1.ObjectMeta{Name: name},
+			PrincipalIDs: []string{"okta_user://" + name},
+		}
+	}
+	th := newTestHandler(t, newUser("u-1"), newUser("u-2"))
+	th.attributes["u-2"] = &v3.UserAttribute{
+		ObjectMeta: metav1.ObjectMeta{Name: "u-2"},
+		GroupPrincipals: map[string]v3.Principals{
+			"github": {Items: []v3.Principal{{ObjectMeta: metav1.ObjectMeta{Name: "github_team://1"}}}},
+		},
+	}
+	principalID := "okta_group://Engineers"
+	id := groupID(principalID)
+	members := func() []string {
+		var members []string
+		for name, a := range th.attributes {
+			for _, p := range a.GroupPrincipals["okta"].Items {
+				if p.Name == principalID {
+					members = append(members, name)
+				}
+			}
+		}
+		sort.Strings(members)
+		return members
+	}
+
+	code, resp := th.do(t, http.MethodPost, Endpoint+"/Groups", map[string]any{
+		"schemas":     []string{groupSchema},
+		"displayName": "Engineers",
+		"members":     []map[string]any{{"value": "u-1"}},
+	})
+	require.Equal(t, http.StatusCreated, code, resp)
+	assert.Equal(t, id, resp["id"])
+	assert.Equal(t, []string{"u-1"}, members())
+	assert.Equal(t, metav1.OwnerReference{Name: "u-1"}, th.attributes["u-1"].OwnerReferences[0])
+
+	code, _ = th.do(t, http.MethodPost, Endpoint+"/Groups", map[string]any{"displayName": "Engineers"})
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, resp = th.do(t, http.MethodPatch, Endpoint+"/Groups/"+id, map[string]any{
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]any{{"value": "u-2"}}}},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, []string{"u-1", "u-2"}, members())
+	// Group principals of other providers are kept.
+	assert.Len(t, th.attributes["u-2"].GroupPrincipals["github"].Items, 1)
+
+	code, resp = th.do(t, http.MethodGet, Endpoint+"/Users/u-2", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []any{map[string]any{"value": id, "display": "Engineers", "$ref": Endpoint + "/Groups/" + id}}, resp["groups"])
+
+	code, resp = th.do(t, http.MethodPatch, Endpoint+"/Groups/"+id, map[string]any{
+		"Operations": []map[string]any{{"op": "remove", "path": `members[value eq "u-1"]`}},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, []string{"u-2"}, members())
+
+	code, resp = th.do(t, http.MethodPatch, Endpoint+"/Groups/"+id, map[string]any{
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]any{{"value": "u-3"}}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "member u-3 is not a user", resp["detail"])
+
+	code, resp = th.do(t, http.MethodGet, Endpoint+`/Groups?filter=displayName+eq+"engineers"`, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), resp["totalResults"])
+	group := resp["Resources"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Engineers", group["displayName"])
+	assert.Equal(t, []any{map[string]any{"value": "u-2", "$ref": Endpoint + "/Users/u-2"}}, group["members"])
+
+	code, resp = th.do(t, http.MethodPut, Endpoint+"/Groups/"+id, map[string]any{
+		"displayName": "Engineers",
+		"members":     []map[string]any{{"value": "u-1"}},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, []string{"u-1"}, members())
+
+	code, _ = th.do(t, http.MethodDelete, Endpoint+"/Groups/"+id, nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Empty(t, members())
+
+	// Groups without members still exist, as groups are principals of the auth provider.
+	code, resp = th.do(t, http.MethodGet, Endpoint+"/Groups/"+id, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Engineers", resp["displayName"])
+	code, _ = th.do(t, http.MethodGet, Endpoint+"/Groups/"+groupID("github_team://1"), nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter    string
+		attribute string
+		value     string
+		wantErr   bool
+	}{
+		{filter: `userName eq "john@example.com"`, attribute: "username", value: "john@example.com"},
+		{filter: `externalId EQ "a b"`, attribute: "externalid", value: "a b"},
+		{filter: `userName sw "john"`, wantErr: true},
+		{filter: `userName eq john`, wantErr: true},
+		{filter: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			attribute, value, err := parseFilter(tt.filter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.attribute, attribute)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	resources := make([]int, 5)
+	for i := range resources {
+		resources[i] = i + 1
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []any
+	}{
+		{query: "", want: []any{1, 2, 3, 4, 5}},
+		{query: "?startIndex=2&count=2", want: []any{2, 3}},
+		{query: "?startIndex=5&count=10", want: []any{5}},
+		{query: "?startIndex=6", want: []any{}},
+		{query: "?count=0", want: []any{}},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			list, err := page(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/Users%s", tt.query), nil), resources)
+			require.NoError(t, err)
+			assert.Equal(t, 5, list.TotalResults)
+			assert.Equal(t, tt.want, list.Resources)
+			assert.Equal(t, len(tt.want), list.ItemsPerPage)
+		})
+	}
+}
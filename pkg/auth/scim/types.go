@@ -0,0 +1,118 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	userSchema        = "urn:ietf:params:scim:schemas:core:2.0:User"
+	groupSchema       = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	listSchema        = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	patchOpSchema     = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	errorSchema       = "urn:ietf:params:scim:api:messages:2.0:Error"
+	spConfigSchema    = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType   = "application/scim+json"
+	defaultPageSize   = 100
+	maxPageSize       = 1000
+	scimTypeFilter    = "invalidFilter"
+	scimTypeValue     = "invalidValue"
+	scimTypeUnique    = "uniqueness"
+	scimTypeMutable   = "mutability"
+	scimTypeSyntax    = "invalidSyntax"
+	scimTypeInvalidOp = "invalidPath"
+)
+
+// Meta is the meta attribute of SCIM resources.
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// Name is the name attribute of SCIM users.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Reference is a reference to a user or a group, used for group members and user groups.
+type Reference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is a SCIM user.
+type User struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *Name       `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Active      *Bool       `json:"active,omitempty"`
+	Groups      []Reference `json:"groups,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// Group is a SCIM group.
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []Reference `json:"members,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// ListResponse is the response of queries.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// PatchRequest is the body of PATCH requests.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single operation of a PATCH request.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error is the body of error responses.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// Bool is a boolean that also accepts the strings "true" and "false", which some identity providers send.
+type Bool bool
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b = Bool(v)
+	return nil
+}
+
+func newBool(v bool) *Bool {
+	b := Bool(v)
+	return &b
+}
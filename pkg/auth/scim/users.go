@@ -0,0 +1,387 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// userPrincipalPrefix returns the prefix of the user principals of the SCIM auth provider.
+func userPrincipalPrefix() string {
+	return provider() + "_user://"
+}
+
+// userPrincipal returns the ID of the principal of a SCIM user, which is derived from the attribute of the user
+// configured by the scim-user-principal-attribute setting.
+func userPrincipal(user *User) (string, error) {
+	value := user.UserName
+	attribute := "userName"
+	if strings.EqualFold(settings.SCIMUserPrincipalAttribute.Get(), "externalId") {
+		value = user.ExternalID
+		attribute = "externalId"
+	}
+	if value == "" {
+		return "", badRequest(scimTypeValue, "%s is required", attribute)
+	}
+	return userPrincipalPrefix() + value, nil
+}
+
+// principalOf returns the principal of the SCIM auth provider of a Rancher user, if any.
+func principalOf(user *v3.User) string {
+	for _, principalID := range user.PrincipalIDs {
+		if strings.HasPrefix(principalID, userPrincipalPrefix()) {
+			return principalID
+		}
+	}
+	return ""
+}
+
+func (h *Handler) listUsers(rw http.ResponseWriter, req *http.Request) {
+	attribute, value, err := parseFilter(req.URL.Query().Get("filter"))
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	switch attribute {
+	case "", "username", "externalid", "id":
+	default:
+		handleError(rw, badRequest(scimTypeFilter, "filtering users by %s is not supported", attribute))
+		return
+	}
+
+	users, err := h.userCache.List(labels.Everything())
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+	var resources []User
+	for _, user := range users {
+		if principalOf(user) == "" {
+			continue
+		}
+		scimUser := h.toSCIMUser(user)
+		switch {
+		case attribute == "username" && !strings.EqualFold(scimUser.UserName, value),
+			attribute == "externalid" && scimUser.ExternalID != value,
+			attribute == "id" && scimUser.ID != value:
+			continue
+		}
+		resources = append(resources, scimUser)
+	}
+
+	list, err := page(req, resources)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, list)
+}
+
+func (h *Handler) getUser(rw http.ResponseWriter, req *http.Request) {
+	user, err := h.user(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, h.toSCIMUser(user))
+}
+
+func (h *Handler) createUser(rw http.ResponseWriter, req *http.Request) {
+	var scimUser User
+	if err := readJSON(req, &scimUser); err != nil {
+		handleError(rw, err)
+		return
+	}
+	if scimUser.UserName == "" {
+		handleError(rw, badRequest(scimTypeValue, "userName is required"))
+		return
+	}
+	principal, err := userPrincipal(&scimUser)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+
+	existing, err := h.userManager.GetUserByPrincipalID(principal)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	if existing != nil {
+		handleError(rw, conflict("user %s already exists for principal %s", existing.Name, principal))
+		return
+	}
+
+	user, err := h.userManager.EnsureUser(principal, displayName(&scimUser))
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	user, err = h.updateUser(user, &scimUser)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	logrus.Infof("[scim] Provisioned user %s for principal %s", user.Name, principal)
+	writeJSON(rw, http.StatusCreated, h.toSCIMUser(user))
+}
+
+func (h *Handler) replaceUser(rw http.ResponseWriter, req *http.Request) {
+	user, err := h.user(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	var scimUser User
+	if err := readJSON(req, &scimUser); err != nil {
+		handleError(rw, err)
+		return
+	}
+	if scimUser.Active == nil {
+		scimUser.Active = h.toSCIMUser(user).Active
+	}
+
+	user, err = h.updateUser(user, &scimUser)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, h.toSCIMUser(user))
+}
+
+func (h *Handler) patchUser(rw http.ResponseWriter, req *http.Request) {
+	user, err := h.user(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	var patch PatchRequest
+	if err := readJSON(req, &patch); err != nil {
+		handleError(rw, err)
+		return
+	}
+
+	scimUser := h.toSCIMUser(user)
+	for _, op := range patch.Operations {
+		if err := patchUserAttributes(&scimUser, op); err != nil {
+			handleError(rw, err)
+			return
+		}
+	}
+
+	user, err = h.updateUser(user, &scimUser)
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, h.toSCIMUser(user))
+}
+
+func (h *Handler) deleteUser(rw http.ResponseWriter, req *http.Request) {
+	user, err := h.user(mux.Vars(req)["id"])
+	if err != nil {
+		handleError(rw, err)
+		return
+	}
+	if err := h.users.Delete(user.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		handleError(rw, err)
+		return
+	}
+	logrus.Infof("[scim] Deleted user %s", user.Name)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// user returns the Rancher user with the given ID, which must have a principal of the SCIM auth provider.
+func (h *Handler) user(id string) (*v3.User, error) {
+	user, err := h.userCache.Get(id)
+	if apierrors.IsNotFound(err) || (err == nil && principalOf(user) == "") {
+		return nil, notFound("user %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// updateUser applies the attributes of a SCIM user to a Rancher user. Deactivating a user disables it and revokes its tokens.
+func (h *Handler) updateUser(user *v3.User, scimUser *User) (*v3.User, error) {
+	principal, err := userPrincipal(scimUser)
+	if err != nil {
+		return nil, err
+	}
+	if principal != principalOf(user) {
+		return nil, badRequest(scimTypeMutable, "the principal of user %s can't be changed from %s to %s", user.Name, principalOf(user), principal)
+	}
+
+	user = user.DeepCopy()
+	if user.Annotations == nil {
+		user.Annotations = map[string]string{}
+	}
+	user.Annotations[UserNameAnnotation] = scimUser.UserName
+	if scimUser.ExternalID != "" {
+		user.Annotations[ExternalIDAnnotation] = scimUser.ExternalID
+	} else {
+		delete(user.Annotations, ExternalIDAnnotation)
+	}
+	if name := displayName(scimUser); name != "" {
+		user.DisplayName = name
+	}
+
+	wasEnabled := user.Enabled == nil || *user.Enabled
+	deactivate := scimUser.Active != nil && !bool(*scimUser.Active)
+	enabled := !deactivate
+	user.Enabled = &enabled
+
+	user, err = h.users.Update(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if deactivate {
+		if wasEnabled {
+			logrus.Infof("[scim] Deactivated user %s", user.Name)
+		}
+		// Tokens are revoked even if the user was already disabled, so that a failed revocation is retried by the identity provider.
+		if err := h.tokens.RevokeUserTokens(user.Name); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// toSCIMUser returns the SCIM representation of a Rancher user with a principal of the SCIM auth provider.
+func (h *Handler) toSCIMUser(user *v3.User) User {
+	value := strings.TrimPrefix(principalOf(user), userPrincipalPrefix())
+	userName := user.Annotations[UserNameAnnotation]
+	externalID := user.Annotations[ExternalIDAnnotation]
+	if strings.EqualFold(settings.SCIMUserPrincipalAttribute.Get(), "externalId") {
+		if externalID == "" {
+			externalID = value
+		}
+		if userName == "" {
+			userName = user.Username
+		}
+	}
+	if userName == "" {
+		userName = value
+	}
+
+	scimUser := User{
+		Schemas:     []string{userSchema},
+		ID:          user.Name,
+		ExternalID:  externalID,
+		UserName:    userName,
+		DisplayName: user.DisplayName,
+		Active:      newBool(user.Enabled == nil || *user.Enabled),
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      user.CreationTimestamp.UTC().Format(time.RFC3339),
+			Location:     Endpoint + "/Users/" + user.Name,
+		},
+	}
+	if user.DisplayName != "" {
+		scimUser.Name = &Name{Formatted: user.DisplayName}
+	}
+
+	attribs, err := h.attributeCache.Get(user.Name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			logrus.Errorf("[scim] failed to get the groups of user %s: %v", user.Name, err)
+		}
+		return scimUser
+	}
+	for _, group := range attribs.GroupPrincipals[provider()].Items {
+		scimUser.Groups = append(scimUser.Groups, Reference{
+			Value:   groupID(group.Name),
+			Display: group.DisplayName,
+			Ref:     Endpoint + "/Groups/" + groupID(group.Name),
+		})
+	}
+	return scimUser
+}
+
+// displayName returns the display name of a SCIM user.
+func displayName(user *User) string {
+	switch {
+	case user.DisplayName != "":
+		return user.DisplayName
+	case user.Name == nil:
+		return ""
+	case user.Name.Formatted != "":
+		return user.Name.Formatted
+	default:
+		return strings.TrimSpace(user.Name.GivenName + " " + user.Name.FamilyName)
+	}
+}
+
+// patchUserAttributes applies a PATCH operation to a SCIM user. Operations on attributes without a Rancher
+// counterpart, like emails or phone numbers, are ignored.
+func patchUserAttributes(user *User, op PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		switch strings.ToLower(op.Path) {
+		case "externalid":
+			user.ExternalID = ""
+		case "displayname":
+			user.DisplayName = ""
+			user.Name = nil
+		}
+		return nil
+	default:
+		return badRequest(scimTypeInvalidOp, "unsupported operation %s", op.Op)
+	}
+
+	if op.Path != "" {
+		return setUserAttribute(user, op.Path, op.Value)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &values); err != nil {
+		return badRequest(scimTypeValue, "invalid value of %s operation: %v", op.Op, err)
+	}
+	for attribute, value := range values {
+		if err := setUserAttribute(user, attribute, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setUserAttribute(user *User, attribute string, value json.RawMessage) error {
+	var target any
+	switch strings.ToLower(attribute) {
+	case "active":
+		target = &user.Active
+	case "username":
+		target = &user.UserName
+	case "externalid":
+		target = &user.ExternalID
+	case "displayname":
+		target = &user.DisplayName
+	case "name":
+		target = &user.Name
+	case "name.formatted":
+		if user.Name == nil {
+			user.Name = &Name{}
+		}
+		target = &user.Name.Formatted
+	default:
+		return nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return badRequest(scimTypeValue, "invalid value of %s: %v", attribute, err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@
 	"github.com/rancher/rancher/pkg/api/norman"
 	"github.com/rancher/rancher/pkg/auth/api"
 	"github.com/rancher/rancher/pkg/auth/data"
+	"github.com/rancher/rancher/pkg/auth/devicecode"
 	"github.com/rancher/rancher/pkg/auth/providerrefresh"
 	"github.com/rancher/rancher/pkg/auth/providers/common"
 	"github.com/rancher/rancher/pkg/auth/providers/publicapi"
@@ -82,7 +83,8 @@ func NewServer(ctx context.Context, cfg *rest.Config, wContext *wrangler.Context
 }
 
 func newAPIManagement(ctx context.Context, scaledContext *config.ScaledContext) (steveauth.Middleware, error) {
-	privateAPI, err := newPrivateAPI(ctx, scaledContext)
+	deviceCode := devicecode.NewHandler(scaledContext)
+	privateAPI, err := newPrivateAPI(ctx, scaledContext, deviceCode)
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +100,8 @@ func newAPIManagement(ctx context.Context, scaledContext *config.ScaledContext)
 	root.UseEncodedPath()
 	root.PathPrefix("/v3-public").Handler(publicAPI)
 	root.PathPrefix("/v1-saml").Handler(saml)
+	root.Path(devicecode.CodePath).Handler(deviceCode)
+	root.Path(devicecode.TokenPath).Handler(deviceCode)
 	root.NotFoundHandler = privateAPI
 
 	return func(next http.Handler) http.Handler {
@@ -106,7 +110,7 @@ func newAPIManagement(ctx context.Context, scaledContext *config.ScaledContext)
 	}, nil
 }
 
-func newPrivateAPI(ctx context.Context, scaledContext *config.ScaledContext) (*mux.Router, error) {
+func newPrivateAPI(ctx context.Context, scaledContext *config.ScaledContext, deviceCode http.Handler) (*mux.Router, error) {
 	tokenAPI, err := tokens.NewAPIHandler(ctx, scaledContext, norman.ConfigureAPIUI)
 	if err != nil {
 		return nil, err
@@ -127,6 +131,7 @@ func newPrivateAPI(ctx context.Context, scaledContext *config.ScaledContext) (*m
 	root.PathPrefix("/v3/user").Handler(otherAPIs)
 	root.PathPrefix("/v3/schema").Handler(otherAPIs)
 	root.PathPrefix("/v3/subscribe").Handler(otherAPIs)
+	root.Path(devicecode.VerifyPath).Handler(deviceCode)
 	return root, nil
 }
 
@@ -3,7 +3,6 @@
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -22,7 +21,6 @@
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
 	"github.com/rancher/rancher/pkg/types/config"
-	"github.com/rancher/wrangler/v3/pkg/randomtoken"
 	"github.com/sirupsen/logrus"
 	apicorev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -98,11 +96,13 @@ type Manager struct {
 
 type (
 	// LogoutAllFunc is the signature of the callback function to invoke when
-	// processing the norman action `logoutAll`.
+	// processing the norman action `logoutAll`. The API context is nil when
+	// all the sessions of a user are revoked outside of the action.
 	LogoutAllFunc func(apiContext *types.APIContext, token *v3.Token) error
 
 	// LogoutFunc is the signature of the callback function to invoke when
-	// processing the norman action `logout`.
+	// processing the norman action `logout`. The API context is nil when
+	// a session is revoked outside of the action.
 	LogoutFunc func(apiContext *types.APIContext, token *v3.Token) error
 
 	// Note: We use callback functions to link the token manager to the SAML
@@ -152,21 +152,7 @@ func (m *Manager) createDerivedToken(jsonInput clientv3.Token, tokenAuthValue st
 
 // createToken returns the token object and it's unhashed token key, which is stored hashed
 func (m *Manager) createToken(k8sToken *v3.Token) (v3.Token, string, error) {
-	key, err := randomtoken.Generate()
-	if err != nil {
-		logrus.Errorf("Failed to generate token key: %v", err)
-		return v3.Token{}, "", errors.New("failed to generate token key")
-	}
-
-	if k8sToken.ObjectMeta.Labels == nil {
-		k8sToken.ObjectMeta.Labels = make(map[string]string)
-	}
-	k8sToken.APIVersion = "management.cattle.io/v3"
-	k8sToken.Kind = "Token"
-	k8sToken.Token = key
-	k8sToken.ObjectMeta.Labels[UserIDLabel] = k8sToken.UserID
-	k8sToken.ObjectMeta.GenerateName = "token-"
-	err = ConvertTokenKeyToHash(k8sToken)
+	key, err := PrepareToken(k8sToken)
 	if err != nil {
 		return v3.Token{}, "", err
 	}
@@ -242,6 +228,25 @@ func (m *Manager) getTokens(tokenAuthValue string) ([]v3.Token, int, error) {
 	return tokens, 0, nil
 }
 
+// RevokeUserTokens deletes all the tokens of a user, so that they can no longer be used to authenticate.
+// The logoutAll callback is invoked for each login session.
+func (m *Manager) RevokeUserTokens(userID string) error {
+	set := labels.Set(map[string]string{UserIDLabel: userID})
+	tokenList, err := m.tokensClient.List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+	if err != nil {
+		return fmt.Errorf("error getting tokens for user %s: %w", userID, err)
+	}
+
+	for _, token := range tokenList.Items {
+		runLogoutCallback(&token, true)
+		if err := m.tokensClient.Delete(token.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting token %s of user %s: %w", token.Name, userID, err)
+		}
+	}
+	logrus.Infof("Revoked %d tokens of user %s", len(tokenList.Items), userID)
+	return nil
+}
+
 func (m *Manager) deleteTokenByName(tokenName string) (int, error) {
 	err := m.tokensClient.Delete(tokenName, &metav1.DeleteOptions{})
 	if err != nil {
@@ -685,7 +690,8 @@ func (m *Manager) userAttributeChanged(attribs *v32.UserAttribute, provider stri
 // PerUserCacheProviders is a set of provider names for which the token manager creates a per-user login token.
 var PerUserCacheProviders = []string{"github", "azuread", "googleoauth", "oidc", "keycloakoidc", "genericoidc"}
 
-func (m *Manager) NewLoginToken(userID string, userPrincipal v3.Principal, groupPrincipals []v3.Principal, providerToken string, ttl int64, description string) (v3.Token, string, error) {
+// NewLoginToken creates the token of a login session. The client that sent req, if any, is recorded on the token.
+func (m *Manager) NewLoginToken(userID string, userPrincipal v3.Principal, groupPrincipals []v3.Principal, providerToken string, ttl int64, description string, req *http.Request) (v3.Token, string, error) {
 	provider := userPrincipal.Provider
 	// Providers that use oauth need to create a secret for storing the access token.
 	if utils.Contains(PerUserCacheProviders, provider) && providerToken != "" {
@@ -704,10 +710,32 @@ func (m *Manager) NewLoginToken(userID string, userPrincipal v3.Principal, group
 		Description:   description,
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
-				TokenKindLabel: "session",
+				TokenKindLabel: SessionTokenKind,
+			},
+		},
+	}
+	setSessionOrigin(token, req)
+
+	return m.createToken(token)
+}
+
+// NewMFAEnrollmentToken creates a short-lived token for a user that logged in with valid credentials but must enroll
+// in multi-factor authentication first. The token only authenticates the enrollment, see IsMFAEnrollmentRequest.
+func (m *Manager) NewMFAEnrollmentToken(userID string, userPrincipal v3.Principal, groupPrincipals []v3.Principal, description string, req *http.Request) (v3.Token, string, error) {
+	token := &v3.Token{
+		UserPrincipal: userPrincipal,
+		IsDerived:     false,
+		TTLMillis:     mfaEnrollmentTokenTTL.Milliseconds(),
+		UserID:        userID,
+		AuthProvider:  userPrincipal.Provider,
+		Description:   description,
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				TokenKindLabel: MFAEnrollmentTokenKind,
 			},
 		},
 	}
+	setSessionOrigin(token, req)
 
 	return m.createToken(token)
 }
@@ -773,7 +801,7 @@ func (m *Manager) IsMemberOf(token v3.Token, group v3.Principal) bool {
 }
 
 func (m *Manager) CreateTokenAndSetCookie(userID string, userPrincipal v3.Principal, groupPrincipals []v3.Principal, providerToken string, ttl int, description string, request *types.APIContext) error {
-	token, unhashedTokenKey, err := m.NewLoginToken(userID, userPrincipal, groupPrincipals, providerToken, 0, description)
+	token, unhashedTokenKey, err := m.NewLoginToken(userID, userPrincipal, groupPrincipals, providerToken, 0, description, request.Request)
 	if err != nil {
 		logrus.Errorf("Failed creating token with error: %v", err)
 		return httperror.NewAPIErrorLong(500, "", fmt.Sprintf("Failed creating token with error: %v", err))
@@ -857,12 +885,21 @@ func ClampToMaxTTL(ttl time.Duration) (time.Duration, error) {
 
 // GetKubeconfigDefaultTokenTTLInMilliSeconds will return the default TTL for kubeconfig tokens
 func GetKubeconfigDefaultTokenTTLInMilliSeconds() (*int64, error) {
-	defaultTokenTTL, err := ParseTokenTTL(settings.KubeconfigDefaultTokenTTLMinutes.Get())
+	return getTokenTTLSettingInMilliSeconds(settings.KubeconfigDefaultTokenTTLMinutes)
+}
+
+// GetKubeconfigExecTokenTTLInMilliSeconds returns the TTL of the kubeconfig tokens obtained through a device code login.
+func GetKubeconfigExecTokenTTLInMilliSeconds() (*int64, error) {
+	return getTokenTTLSettingInMilliSeconds(settings.KubeconfigExecTokenTTLMinutes)
+}
+
+func getTokenTTLSettingInMilliSeconds(setting settings.Setting) (*int64, error) {
+	ttl, err := ParseTokenTTL(setting.Get())
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse setting '%s': %w", settings.KubeconfigDefaultTokenTTLMinutes.Name, err)
+		return nil, fmt.Errorf("failed to parse setting '%s': %w", setting.Name, err)
 	}
 
-	tokenTTL, err := ClampToMaxTTL(defaultTokenTTL)
+	tokenTTL, err := ClampToMaxTTL(ttl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to validate token ttl: %w", err)
 	}
@@ -8,6 +8,7 @@
 	"time"
 
 	"github.com/rancher/norman/types"
+	apiv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/auth/tokens/hashers"
 	"github.com/rancher/rancher/pkg/features"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
@@ -15,7 +16,9 @@
 	"github.com/rancher/wrangler/v3/pkg/randomtoken"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/pointer"
 )
@@ -296,3 +299,32 @@ func TestUserAttributeCreateOrUpdateUpdatesGroups(t *testing.T) {
 	require.Len(t, principals.Items, 1)
 	assert.Equal(t, principals.Items[0].Name, "group1")
 }
+
+func TestRevokeUserTokens(t *testing.T) {
+	var (
+		selector string
+		deleted  []string
+	)
+	manager := Manager{
+		tokensClient: &mgmtFakes.TokenInterfaceMock{
+			ListFunc: func(opts v1.ListOptions) (*apiv3.TokenList, error) {
+				selector = opts.LabelSelector
+				return &apiv3.TokenList{Items: []v3.Token{
+					{ObjectMeta: v1.ObjectMeta{Name: "token-abcde"}},
+					{ObjectMeta: v1.ObjectMeta{Name: "token-fghij"}},
+				}}, nil
+			},
+			DeleteFunc: func(name string, opts *v1.DeleteOptions) error {
+				deleted = append(deleted, name)
+				if name == "token-fghij" {
+					return apierrors.NewNotFound(schema.GroupResource{}, name)
+				}
+				return nil
+			},
+		},
+	}
+
+	require.NoError(t, manager.RevokeUserTokens("u-abcdef"))
+	assert.Equal(t, UserIDLabel+"=u-abcdef", selector)
+	assert.Equal(t, []string{"token-abcde", "token-fghij"}, deleted)
+}
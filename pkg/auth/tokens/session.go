@@ -0,0 +1,140 @@
+package tokens
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/rancher/pkg/auth/util"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SessionTokenKind is the value of the TokenKindLabel of tokens created for login sessions.
+	SessionTokenKind = "session"
+	// MFAEnrollmentTokenKind is the value of the TokenKindLabel of tokens created for users that must enroll in
+	// multi-factor authentication before they can log in. They only authenticate the enrollment requests.
+	MFAEnrollmentTokenKind = "mfa-enrollment"
+	// ClientIPAnnotation is the annotation recording the IP address of the client that created a login session.
+	ClientIPAnnotation = "authn.management.cattle.io/client-ip"
+	// UserAgentAnnotation is the annotation recording the user agent of the client that created a login session.
+	UserAgentAnnotation = "authn.management.cattle.io/user-agent"
+
+	// mfaEnrollmentTokenTTL is how long users have to enroll in multi-factor authentication after logging in.
+	mfaEnrollmentTokenTTL = 10 * time.Minute
+
+	// maxUserAgentLength caps the length of the recorded user agent, which is set by the client.
+	maxUserAgentLength = 256
+)
+
+type tokenDeleter interface {
+	Delete(name string, options *metav1.DeleteOptions) error
+}
+
+// IsSession returns true if the token was created for a login session.
+func IsSession(token *v3.Token) bool {
+	return token.Labels[TokenKindLabel] == SessionTokenKind
+}
+
+// IsMFAEnrollment returns true if the token only authenticates the enrollment of its user in multi-factor authentication.
+func IsMFAEnrollment(token *v3.Token) bool {
+	return token.Labels[TokenKindLabel] == MFAEnrollmentTokenKind
+}
+
+// IsMFAEnrollmentRequest returns true if req is one of the requests authenticated by tokens restricted to the
+// enrollment in multi-factor authentication: starting and confirming the enrollment, and logging out.
+func IsMFAEnrollmentRequest(req *http.Request) bool {
+	action := req.URL.Query().Get("action")
+	switch strings.TrimSuffix(req.URL.Path, "/") {
+	case "/v3/users":
+		return req.Method == http.MethodPost && (action == "enrollmfa" || action == "confirmmfa")
+	case "/v3/tokens":
+		return req.Method == http.MethodPost && action == "logout"
+	}
+	return false
+}
+
+// SessionIdleTimeout returns the time a login session can go unused before it expires,
+// or zero if sessions don't expire due to inactivity.
+func SessionIdleTimeout() time.Duration {
+	minutes, err := strconv.ParseInt(settings.AuthUserSessionIdleTimeoutMinutes.Get(), 10, 64)
+	if err != nil || minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// IdleExpiresAt returns the time a login session expires if it remains unused,
+// or the zero time if the token isn't a session or idle sessions don't expire.
+func IdleExpiresAt(token *v3.Token) time.Time {
+	timeout := SessionIdleTimeout()
+	if timeout == 0 || !IsSession(token) {
+		return time.Time{}
+	}
+
+	lastActive := token.CreationTimestamp.Time
+	if token.LastUsedAt != nil && token.LastUsedAt.After(lastActive) {
+		lastActive = token.LastUsedAt.Time
+	}
+	return lastActive.Add(timeout)
+}
+
+// IsIdle returns true if the token is a login session that has not been used within the idle timeout.
+func IsIdle(token v3.Token) bool {
+	expiresAt := IdleExpiresAt(&token)
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+// setSessionOrigin records the client that created a login session on its token.
+func setSessionOrigin(token *v3.Token, req *http.Request) {
+	if req == nil {
+		return
+	}
+	if token.Annotations == nil {
+		token.Annotations = map[string]string{}
+	}
+	if ip := util.ClientIP(req); ip != "" {
+		token.Annotations[ClientIPAnnotation] = ip
+	}
+	if userAgent := req.UserAgent(); userAgent != "" {
+		if len(userAgent) > maxUserAgentLength {
+			userAgent = userAgent[:maxUserAgentLength]
+		}
+		token.Annotations[UserAgentAnnotation] = userAgent
+	}
+}
+
+// RevokeSession deletes the token of a login session on behalf of an administrator or the user itself, outside of
+// the logout actions. The logout callbacks are invoked with a nil API context, as logoutAll if all is true.
+// Callback errors are logged and don't prevent the revocation.
+func RevokeSession(tokens tokenDeleter, token *v3.Token, all bool) error {
+	runLogoutCallback(token, all)
+
+	if err := tokens.Delete(token.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	logrus.Infof("Revoked session %s of user %s", token.Name, token.UserID)
+	return nil
+}
+
+func runLogoutCallback(token *v3.Token, all bool) {
+	if !IsSession(token) {
+		return
+	}
+
+	callback, action := onLogout, "logout"
+	if all {
+		callback, action = LogoutFunc(onLogoutAll), "logoutAll"
+	}
+	if callback == nil {
+		return
+	}
+	if err := callback(nil, token); err != nil {
+		logrus.Warnf("Error running the %s callback for session %s of user %s: %v", action, token.Name, token.UserID, err)
+	}
+}
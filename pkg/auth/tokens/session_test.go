@@ -0,0 +1,200 @@
+package tokens
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/norman/types"
+	apiv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	mgmtFakes "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func setIdleTimeout(t *testing.T, value string) {
+	t.Helper()
+	require.NoError(t, settings.AuthUserSessionIdleTimeoutMinutes.Set(value))
+	t.Cleanup(func() {
+		_ = settings.AuthUserSessionIdleTimeoutMinutes.Set(settings.AuthUserSessionIdleTimeoutMinutes.Default)
+	})
+}
+
+func sessionToken(name string, created time.Time, lastUsedAt *time.Time) v3.Token {
+	token := v3.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{TokenKindLabel: SessionTokenKind},
+		},
+		UserID: "u-abcdef",
+	}
+	if lastUsedAt != nil {
+		used := metav1.NewTime(*lastUsedAt)
+		token.LastUsedAt = &used
+	}
+	return token
+}
+
+func TestIsIdle(t *testing.T) {
+	now := time.Now()
+	recently := now.Add(-5 * time.Minute)
+	longAgo := now.Add(-2 * time.Hour)
+
+	derived := sessionToken("token-derived", longAgo, nil)
+	derived.Labels = nil
+
+	tests := []struct {
+		name    string
+		timeout string
+		token   v3.Token
+		want    bool
+	}{
+		{
+			name:    "disabled",
+			timeout: "0",
+			token:   sessionToken("token-abcde", longAgo, nil),
+		},
+		{
+			name:    "invalid timeout",
+			timeout: "soon",
+			token:   sessionToken("token-abcde", longAgo, nil),
+		},
+		{
+			name:    "unused since creation",
+			timeout: "30",
+			token:   sessionToken("token-abcde", longAgo, nil),
+			want:    true,
+		},
+		{
+			name:    "recently created",
+			timeout: "30",
+			token:   sessionToken("token-abcde", recently, nil),
+		},
+		{
+			name:    "recently used",
+			timeout: "30",
+			token:   sessionToken("token-abcde", longAgo, &recently),
+		},
+		{
+			name:    "not used recently",
+			timeout: "30",
+			token:   sessionToken("token-abcde", longAgo, &longAgo),
+			want:    true,
+		},
+		{
+			name:    "not a session",
+			timeout: "30",
+			token:   derived,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setIdleTimeout(t, tt.timeout)
+			assert.Equal(t, tt.want, IsIdle(tt.token))
+		})
+	}
+}
+
+func TestVerifyTokenIdleSession(t *testing.T) {
+	setIdleTimeout(t, "30")
+
+	token := sessionToken("token-abcde", time.Now().Add(-time.Hour), nil)
+	token.Token = "dddddddddddddddddddddddddddddddddddddddddddddddddddddd"
+
+	status, err := VerifyToken(&token, token.Name, token.Token)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusGone, status)
+}
+
+func TestSetSessionOrigin(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://rancher.example.com/v3-public/localProviders/local?action=login", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "10.0.0.1:51234"
+	req.Header.Set("X-Forwarded-For", "192.0.2.10, 10.0.0.1")
+	req.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength+10))
+	require.NoError(t, settings.AuthTrustedProxies.Set("10.0.0.0/8"))
+	defer func() {
+		_ = settings.AuthTrustedProxies.Set(settings.AuthTrustedProxies.Default)
+	}()
+
+	token := &v3.Token{}
+	setSessionOrigin(token, req)
+	assert.Equal(t, "192.0.2.10", token.Annotations[ClientIPAnnotation])
+	assert.Len(t, token.Annotations[UserAgentAnnotation], maxUserAgentLength)
+
+	token = &v3.Token{}
+	setSessionOrigin(token, nil)
+	assert.Empty(t, token.Annotations)
+}
+
+func TestRevokeSession(t *testing.T) {
+	prevLogout, prevLogoutAll := onLogout, onLogoutAll
+	t.Cleanup(func() { onLogout, onLogoutAll = prevLogout, prevLogoutAll })
+
+	var logouts, logoutAlls []string
+	OnLogout(func(apiContext *types.APIContext, token *v3.Token) error {
+		assert.Nil(t, apiContext)
+		logouts = append(logouts, token.Name)
+		return errors.New("single logout is forced")
+	})
+	OnLogoutAll(func(apiContext *types.APIContext, token *v3.Token) error {
+		assert.Nil(t, apiContext)
+		logoutAlls = append(logoutAlls, token.Name)
+		return nil
+	})
+
+	var deleted []string
+	tokenClient := &mgmtFakes.TokenInterfaceMock{
+		DeleteFunc: func(name string, opts *metav1.DeleteOptions) error {
+			deleted = append(deleted, name)
+			return nil
+		},
+	}
+
+	token := sessionToken("token-abcde", time.Now(), nil)
+	require.NoError(t, RevokeSession(tokenClient, &token, false))
+	assert.Equal(t, []string{"token-abcde"}, logouts)
+	assert.Empty(t, logoutAlls)
+	assert.Equal(t, []string{"token-abcde"}, deleted)
+
+	derived := v3.Token{ObjectMeta: metav1.ObjectMeta{Name: "token-fghij"}}
+	require.NoError(t, RevokeSession(tokenClient, &derived, true))
+	assert.Empty(t, logoutAlls)
+	assert.Equal(t, []string{"token-abcde", "token-fghij"}, deleted)
+}
+
+func TestRevokeUserTokensInvokesLogoutAll(t *testing.T) {
+	prevLogoutAll := onLogoutAll
+	t.Cleanup(func() { onLogoutAll = prevLogoutAll })
+
+	var logoutAlls []string
+	OnLogoutAll(func(apiContext *types.APIContext, token *v3.Token) error {
+		logoutAlls = append(logoutAlls, token.Name)
+		return nil
+	})
+
+	manager := Manager{
+		tokensClient: &mgmtFakes.TokenInterfaceMock{
+			ListFunc: func(opts metav1.ListOptions) (*apiv3.TokenList, error) {
+				return &apiv3.TokenList{Items: []v3.Token{
+					sessionToken("token-abcde", time.Now(), nil),
+					{ObjectMeta: metav1.ObjectMeta{Name: "token-fghij"}},
+				}}, nil
+			},
+			DeleteFunc: func(name string, opts *metav1.DeleteOptions) error {
+				return apierrors.NewNotFound(schema.GroupResource{}, name)
+			},
+		},
+	}
+
+	require.NoError(t, manager.RevokeUserTokens("u-abcdef"))
+	assert.Equal(t, []string{"token-abcde"}, logoutAlls)
+}
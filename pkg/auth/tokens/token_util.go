@@ -14,10 +14,13 @@
 	"github.com/rancher/rancher/pkg/features"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/user"
+	"github.com/rancher/wrangler/v3/pkg/randomtoken"
 	"github.com/sirupsen/logrus"
 )
 
-func getAuthProviderName(principalID string) string {
+// GetAuthProviderName returns the name of the auth provider a principal ID belongs to,
+// e.g. "github" for "github_user://1234".
+func GetAuthProviderName(principalID string) string {
 	parts := strings.Split(principalID, "://")
 	externalType := parts[0]
 
@@ -151,12 +154,35 @@ func VerifyToken(storedToken *v3.Token, tokenName, tokenKey string) (int, error)
 			return http.StatusUnprocessableEntity, invalidAuthTokenErr
 		}
 	}
-	if IsExpired(*storedToken) {
+	if IsExpired(*storedToken) || IsIdle(*storedToken) {
 		return http.StatusGone, errors.New("must authenticate")
 	}
 	return http.StatusOK, nil
 }
 
+// PrepareToken generates a new key for the token, labels it with the ID of its user and hashes the key
+// if token hashing is enabled. It returns the unhashed key which can't be retrieved after the token is created.
+func PrepareToken(token *v3.Token) (string, error) {
+	key, err := randomtoken.Generate()
+	if err != nil {
+		logrus.Errorf("Failed to generate token key: %v", err)
+		return "", errors.New("failed to generate token key")
+	}
+
+	if token.ObjectMeta.Labels == nil {
+		token.ObjectMeta.Labels = make(map[string]string)
+	}
+	token.APIVersion = "management.cattle.io/v3"
+	token.Kind = "Token"
+	token.Token = key
+	token.ObjectMeta.Labels[UserIDLabel] = token.UserID
+	token.ObjectMeta.GenerateName = "token-"
+	if err := ConvertTokenKeyToHash(token); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
 // ConvertTokenKeyToHash takes a token with an un-hashed key and converts it to a hashed key
 func ConvertTokenKeyToHash(token *v3.Token) error {
 	if !features.TokenHashing.Enabled() {
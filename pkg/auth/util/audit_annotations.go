@@ -0,0 +1,85 @@
+package util
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type auditAnnotationsKey struct{}
+
+type auditIDKey struct{}
+
+// WithAuditID returns a context carrying the ID of the audit log entry of a request.
+func WithAuditID(ctx context.Context, auditID string) context.Context {
+	return context.WithValue(ctx, auditIDKey{}, auditID)
+}
+
+// AuditIDFrom returns the ID of the audit log entry of the request the context belongs to,
+// or an empty string if the request is not being audited.
+func AuditIDFrom(ctx context.Context) string {
+	auditID, _ := ctx.Value(auditIDKey{}).(string)
+	return auditID
+}
+
+// AuditAnnotations are key value pairs added to the audit log entry of a request by its handlers.
+type AuditAnnotations struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+// WithAuditAnnotations returns a context collecting the annotations added to the audit log entry of a request.
+func WithAuditAnnotations(ctx context.Context) (context.Context, *AuditAnnotations) {
+	a := &AuditAnnotations{}
+	return context.WithValue(ctx, auditAnnotationsKey{}, a), a
+}
+
+// AddAuditAnnotation adds a key value pair to the audit log entry of the request the context belongs to.
+// It does nothing if the request is not being audited.
+func AddAuditAnnotation(ctx context.Context, key, value string) {
+	a, ok := ctx.Value(auditAnnotationsKey{}).(*AuditAnnotations)
+	if !ok {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.values == nil {
+		a.values = map[string]string{}
+	}
+	a.values[key] = value
+}
+
+// Get returns a copy of the annotations, or nil if there are none.
+func (a *AuditAnnotations) Get() map[string]string {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.values) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(a.values))
+	for k, v := range a.values {
+		values[k] = v
+	}
+	return values
+}
+
+// SystemAuditFunc writes an audit entry for an action Rancher took on its own rather than on behalf of a request.
+type SystemAuditFunc func(method, uri string, annotations map[string]string)
+
+var systemAudit atomic.Value
+
+// SetSystemAuditFunc sets the function writing the audit entries of actions Rancher takes on its own.
+func SetSystemAuditFunc(f SystemAuditFunc) {
+	systemAudit.Store(f)
+}
+
+// AuditSystemAction writes an audit entry for an action Rancher took on its own, e.g. from a controller,
+// on the resource at uri. It does nothing if audit logging isn't enabled.
+func AuditSystemAction(method, uri string, annotations map[string]string) {
+	if f, ok := systemAudit.Load().(SystemAuditFunc); ok && f != nil {
+		f(method, uri, annotations)
+	}
+}
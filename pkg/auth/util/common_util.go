@@ -2,8 +2,12 @@
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/rancher/rancher/pkg/settings"
 )
 
 var (
@@ -59,6 +63,81 @@ func GetHost(req *http.Request) string {
 	return host
 }
 
+// ClientIP returns the IP address of the client that sent req. The forwarding headers can be set by any
+// client, so they are only used if the request was sent by one of the proxies of the auth-trusted-proxies
+// setting, e.g. the ingress or load balancer Rancher is exposed through. X-Forwarded-For is then read from
+// the right, the client IP is the first address that is not a trusted proxy.
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	host = strings.TrimSpace(host)
+
+	trusted := trustedProxies()
+	if !isTrustedProxy(trusted, host) {
+		return host
+	}
+	if forwarded := req.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop != "" && (i == 0 || !isTrustedProxy(trusted, hop)) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(req.Header.Get("X-Real-Ip")); realIP != "" {
+		return realIP
+	}
+	return host
+}
+
+// DistinctClientIP returns the IP address of the client that sent req if it tells the client apart from other clients,
+// or "" otherwise. Unless the auth-trusted-proxies setting is set, requests may all come from the ingress or load
+// balancer Rancher is exposed through, whose address is shared by every client.
+func DistinctClientIP(req *http.Request) string {
+	if len(trustedProxies()) == 0 {
+		return ""
+	}
+	return ClientIP(req)
+}
+
+// trustedProxies parses the auth-trusted-proxies setting, invalid entries are ignored.
+func trustedProxies() []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, value := range strings.Split(settings.AuthTrustedProxies.Get(), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		if _, cidr, err := net.ParseCIDR(value); err == nil {
+			proxies = append(proxies, cidr)
+		}
+	}
+	return proxies
+}
+
+func isTrustedProxy(proxies []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // AuthError structure contains the error resource definition
 type AuthError struct {
 	Type    string `json:"type"`
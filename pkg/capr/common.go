@@ -112,6 +112,9 @@
 	InfrastructureReady          = condition.Cond(capi.InfrastructureReadyCondition)
 	SystemUpgradeControllerReady = condition.Cond("SystemUpgradeControllerReady")
 	Bootstrapped                 = condition.Cond("Bootstrapped")
+	WaitingForMaintenanceWindow  = condition.Cond("WaitingForMaintenanceWindow")
+	MaintenanceWindowRollout     = condition.Cond("MaintenanceWindowRollout")
+	UpgradePaused                = condition.Cond("UpgradePaused")
 
 	RuntimeK3S  = "k3s"
 	RuntimeRKE2 = "rke2"
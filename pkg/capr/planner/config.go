@@ -44,11 +44,16 @@ func (p *Planner) addETCD(config map[string]interface{}, controlPlane *rkev1.RKE
 	if controlPlane.Spec.ETCD.SnapshotRetention > 0 {
 		config["etcd-snapshot-retention"] = controlPlane.Spec.ETCD.SnapshotRetention
 	}
+	if controlPlane.Spec.ETCD.S3Retention != nil {
+		// the retention of the S3 target is applied by Rancher, see the etcdsnapshottarget controller
+		config["etcd-s3-retention"] = 0
+	}
 	if controlPlane.Spec.ETCD.SnapshotScheduleCron != "" {
 		config["etcd-snapshot-schedule-cron"] = controlPlane.Spec.ETCD.SnapshotScheduleCron
 	}
 
-	if renderS3 {
+	// encrypted snapshots are uploaded by the agent, see addEtcdSnapshotEncryptUploadPeriodicInstruction
+	if renderS3 && !SnapshotEncryptionEnabled(controlPlane) {
 		args, _, files, err := p.etcdS3Args.ToArgs(controlPlane.Spec.ETCD.S3, controlPlane, "etcd-", false)
 		if err != nil {
 			return nil, err
@@ -67,7 +67,7 @@ func (p *Planner) runEtcdSnapshotManagementServiceStart(controlPlane *rkev1.RKEC
 	// Generate and deliver desired plan for the bootstrap/init node first.
 	if err := p.reconcile(controlPlane, tokensSecret, clusterPlan, true, bootstrapTier, isEtcd, isNotInitNodeOrIsDeleting,
 		"1", "", controlPlane.Spec.UpgradeStrategy.ControlPlaneDrainOptions,
-		-1, 1, false, true); err != nil {
+		-1, 1, false, true, nil, nil); err != nil {
 		return err
 	}
 
@@ -117,7 +117,23 @@ func (p *Planner) generateEtcdSnapshotCreatePlan(controlPlane *rkev1.RKEControlP
 			Name:    "create",
 			Command: capr.GetRuntimeCommand(controlPlane.Spec.KubernetesVersion),
 			Args:    args,
+		},
+		plan.OneTimeInstruction{
+			Name:       EtcdSnapshotChecksumInstructionName,
+			Command:    "sh",
+			Args:       []string{"-c", etcdSnapshotCreatedChecksumScript(controlPlane)},
+			SaveOutput: true,
 		})
+	if err == nil && SnapshotEncryptionEnabled(controlPlane) {
+		// upload the snapshot right away rather than with the next run of the periodic instruction, the snapshot was
+		// written by the previous instruction
+		instruction, files, uploadErr := p.generateEtcdSnapshotEncryptUploadInstruction(controlPlane, entry, "--min-age=0s")
+		if uploadErr != nil {
+			return createPlan, joinedServer, uploadErr
+		}
+		createPlan.Files = append(createPlan.Files, files...)
+		createPlan.Instructions = append(createPlan.Instructions, instruction)
+	}
 	return createPlan, joinedServer, err
 }
 
@@ -327,12 +327,24 @@ func (p *Planner) generateEtcdSnapshotRestorePlan(controlPlane *rkev1.RKEControl
 	}
 
 	var env []string
+	var decryptInstructions []plan.OneTimeInstruction
 
 	if snapshot == nil {
 		// If the snapshot is nil, then we will assume the passed in snapshot name is a local snapshot.
 		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=db/snapshots/%s", snapshotName), "--etcd-s3=false")
 	} else if snapshot.SnapshotFile.S3 == nil {
 		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=db/snapshots/%s", snapshot.SnapshotFile.Name), "--etcd-s3=false")
+	} else if isEncryptedEtcdSnapshot(snapshot) {
+		// encrypted snapshots are downloaded and decrypted by the agent into the local snapshot directory, like RKE2 and K3s
+		// download S3 snapshots, and restored from there
+		decrypted := path.Join(etcdSnapshotDir(controlPlane), decryptedEtcdSnapshotName(snapshot))
+		instruction, files, err := p.generateEtcdSnapshotDecryptInstruction(controlPlane, snapshot, decrypted)
+		if err != nil {
+			return plan.NodePlan{}, "", err
+		}
+		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=%s", decrypted), "--etcd-s3=false")
+		nodePlan.Files = append(nodePlan.Files, files...)
+		decryptInstructions = append(decryptInstructions, instruction)
 	} else {
 		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=%s", snapshot.SnapshotFile.Name))
 		s3, s3Env, s3Files, err := p.etcdS3Args.ToArgs(snapshot.SnapshotFile.S3, controlPlane, "etcd-", true)
@@ -346,6 +358,7 @@ func (p *Planner) generateEtcdSnapshotRestorePlan(controlPlane *rkev1.RKEControl
 
 	runtime := capr.GetRuntime(controlPlane.Spec.KubernetesVersion)
 
+	nodePlan.Instructions = append(nodePlan.Instructions, decryptInstructions...)
 	nodePlan.Instructions = append(nodePlan.Instructions, convertToIdempotentInstruction(
 		controlPlane,
 		"etcd-restore/restore-kill-all",
@@ -840,7 +853,7 @@ func (p *Planner) restoreEtcdSnapshot(cp *rkev1.RKEControlPlane, status rkev1.RK
 		}
 		logrus.Infof("[planner] rkecluster %s/%s: running full reconcile during etcd restore to initially restart cluster", cp.Namespace, cp.Name)
 		// Run a full reconcile of the cluster at this point, ignoring drain and concurrency.
-		if status, err := p.fullReconcile(cp, status, tokensSecret, clusterPlan, true); err != nil {
+		if status, err := p.fullReconcile(cp, status, tokensSecret, clusterPlan, true, nil, nil); err != nil {
 			return status, err
 		}
 		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhasePostRestoreNodeCleanup)
@@ -855,7 +868,7 @@ func (p *Planner) restoreEtcdSnapshot(cp *rkev1.RKEControlPlane, status rkev1.RK
 		}
 		logrus.Infof("[planner] rkecluster %s/%s: running full reconcile during etcd restore to restart cluster", cp.Namespace, cp.Name)
 		// Run a full reconcile of the cluster at this point, ignoring drain and concurrency.
-		if status, err := p.fullReconcile(cp, status, tokensSecret, clusterPlan, true); err != nil {
+		if status, err := p.fullReconcile(cp, status, tokensSecret, clusterPlan, true, nil, nil); err != nil {
 			return status, err
 		}
 		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhaseFinished)
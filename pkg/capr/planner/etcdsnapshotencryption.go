@@ -0,0 +1,188 @@
+package planner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/rancher/pkg/capr/snapshotcrypt"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+)
+
+const (
+	EtcdSnapshotEncryptUploadInstructionName = "etcd-snapshot-encrypt-upload"
+	etcdSnapshotDecryptInstructionName       = "etcd-snapshot-decrypt"
+
+	defaultSnapshotEncryptionKeyName = "key"
+	// defaultSnapshotRetention is the default number of etcd snapshots RKE2 and K3s keep per node.
+	defaultSnapshotRetention = 5
+)
+
+// etcdSnapshotAgentScript runs the etcd-snapshot subcommand of the agent binary of the image of the instruction with the
+// arguments passed to the script.
+const etcdSnapshotAgentScript = `agent=$(command -v agent || find "$PWD" -type f -name agent | head -n 1)
+if [ -z "$agent" ]; then
+	echo "agent not found in image" >&2
+	exit 1
+fi
+exec "$agent" etcd-snapshot "$@"
+`
+
+// SnapshotEncryptionEnabled returns whether the etcd snapshots of the control plane are encrypted before they are
+// uploaded to S3. If they are, RKE2 and K3s only take local snapshots, which are encrypted and uploaded by the agent.
+func SnapshotEncryptionEnabled(controlPlane *rkev1.RKEControlPlane) bool {
+	return controlPlane != nil && controlPlane.Spec.ETCD != nil && S3Enabled(controlPlane.Spec.ETCD.S3) &&
+		controlPlane.Spec.ETCD.SnapshotEncryption != nil && controlPlane.Spec.ETCD.SnapshotEncryption.SecretName != "" &&
+		!controlPlane.Spec.ETCD.SnapshotEncryption.Disabled
+}
+
+// SnapshotEncryptionKeys returns the keys of the etcd snapshot encryption of the control plane. The first key is the one
+// snapshots are encrypted with, the others are sorted by the name of their entries in the secret. The keys are returned
+// even if the encryption is disabled, so that the snapshots that were encrypted can be restored.
+func SnapshotEncryptionKeys(secretCache corecontrollers.SecretCache, controlPlane *rkev1.RKEControlPlane) ([][]byte, error) {
+	if controlPlane.Spec.ETCD == nil || controlPlane.Spec.ETCD.SnapshotEncryption == nil || controlPlane.Spec.ETCD.SnapshotEncryption.SecretName == "" {
+		return nil, fmt.Errorf("no etcd snapshot encryption secret is configured for rkecontrolplane %s/%s, set it with encryption disabled to restore encrypted snapshots", controlPlane.Namespace, controlPlane.Name)
+	}
+	encryption := controlPlane.Spec.ETCD.SnapshotEncryption
+	keyName := first(encryption.KeyName, defaultSnapshotEncryptionKeyName)
+
+	secret, err := secretCache.Get(controlPlane.Namespace, encryption.SecretName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get etcd snapshot encryption secret %s/%s: %w", controlPlane.Namespace, encryption.SecretName, err)
+	}
+	if _, ok := secret.Data[keyName]; !ok {
+		return nil, fmt.Errorf("etcd snapshot encryption secret %s/%s has no entry %s", secret.Namespace, secret.Name, keyName)
+	}
+
+	names := []string{keyName}
+	for name := range secret.Data {
+		if name != keyName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+
+	var keys [][]byte
+	for _, name := range names {
+		key, err := snapshotcrypt.ParseKey(secret.Data[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %s of etcd snapshot encryption secret %s/%s: %w", name, secret.Namespace, secret.Name, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// etcdSnapshotDir returns the directory of the local etcd snapshots of the control plane.
+func etcdSnapshotDir(controlPlane *rkev1.RKEControlPlane) string {
+	if dir, ok := controlPlane.Spec.MachineGlobalConfig.Data["etcd-snapshot-dir"].(string); ok && dir != "" {
+		return dir
+	}
+	return path.Join(capr.GetDistroDataDir(controlPlane), "server/db/snapshots")
+}
+
+// generateEtcdSnapshotAgentInstruction generates an instruction running the etcd-snapshot subcommand of the agent against
+// the S3 target, along with the files it requires: the encryption keys and the CA of the S3 endpoint.
+func (p *Planner) generateEtcdSnapshotAgentInstruction(controlPlane *rkev1.RKEControlPlane, s3 *rkev1.ETCDSnapshotS3, name, subcommand string, args ...string) (plan.OneTimeInstruction, []plan.File, error) {
+	if p.retrievalFunctions.AgentImage == nil || p.retrievalFunctions.AgentImage() == "" {
+		return plan.OneTimeInstruction{}, nil, fmt.Errorf("no agent image configured for the encryption of etcd snapshots")
+	}
+
+	keys, err := SnapshotEncryptionKeys(p.etcdS3Args.secretCache, controlPlane)
+	if err != nil {
+		return plan.OneTimeInstruction{}, nil, err
+	}
+	s3Args, env, files, err := p.etcdS3Args.ToArgs(s3, controlPlane, "", true)
+	if err != nil {
+		return plan.OneTimeInstruction{}, nil, err
+	}
+
+	keyFile := configFile(controlPlane, "etcd-snapshot-encryption-keys")
+	files = append(files, plan.File{
+		Content:     base64.StdEncoding.EncodeToString(snapshotcrypt.KeyFile(keys)),
+		Path:        keyFile,
+		Permissions: "0600",
+		Minor:       true,
+	})
+
+	instructionArgs := append([]string{"-c", etcdSnapshotAgentScript, "agent", subcommand, "--key-file=" + keyFile}, args...)
+	return plan.OneTimeInstruction{
+		Name:    name,
+		Image:   p.retrievalFunctions.ImageResolver(p.retrievalFunctions.AgentImage(), controlPlane),
+		Command: "sh",
+		Args:    append(instructionArgs, s3Args...),
+		Env:     env,
+	}, files, nil
+}
+
+// generateEtcdSnapshotEncryptUploadInstruction generates the instruction that encrypts the local etcd snapshots of the
+// node that are not in S3 yet, uploads them, and prints the encrypted snapshots of the cluster in S3.
+func (p *Planner) generateEtcdSnapshotEncryptUploadInstruction(controlPlane *rkev1.RKEControlPlane, entry *planEntry, args ...string) (plan.OneTimeInstruction, []plan.File, error) {
+	retention := controlPlane.Spec.ETCD.SnapshotRetention
+	if retention <= 0 {
+		retention = defaultSnapshotRetention
+	}
+	if controlPlane.Spec.ETCD.S3Retention != nil {
+		// the retention of the S3 target is applied by Rancher
+		retention = 0
+	}
+	args = append([]string{
+		"--snapshot-dir=" + etcdSnapshotDir(controlPlane),
+		"--cluster=" + controlPlane.Namespace + "/" + controlPlane.Spec.ClusterName,
+		"--node-name=" + entry.Machine.Name,
+		"--retention=" + strconv.Itoa(retention),
+	}, args...)
+	instruction, files, err := p.generateEtcdSnapshotAgentInstruction(controlPlane, controlPlane.Spec.ETCD.S3, EtcdSnapshotEncryptUploadInstructionName, "upload", args...)
+	instruction.SaveOutput = true
+	return instruction, files, err
+}
+
+// addEtcdSnapshotEncryptUploadPeriodicInstruction adds the periodic instruction that encrypts and uploads the local etcd
+// snapshots of the node, if the etcd snapshots of the control plane are encrypted.
+func (p *Planner) addEtcdSnapshotEncryptUploadPeriodicInstruction(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane, entry *planEntry) (plan.NodePlan, error) {
+	if !SnapshotEncryptionEnabled(controlPlane) {
+		return nodePlan, nil
+	}
+	instruction, files, err := p.generateEtcdSnapshotEncryptUploadInstruction(controlPlane, entry)
+	if err != nil {
+		return nodePlan, err
+	}
+	nodePlan.Files = append(nodePlan.Files, files...)
+	nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+		Name:          instruction.Name,
+		Image:         instruction.Image,
+		Command:       instruction.Command,
+		Args:          instruction.Args,
+		Env:           instruction.Env,
+		PeriodSeconds: 600,
+	})
+	return nodePlan, nil
+}
+
+// generateEtcdSnapshotDecryptInstruction generates the instruction that downloads an encrypted S3 etcd snapshot and
+// decrypts it to output on the node.
+func (p *Planner) generateEtcdSnapshotDecryptInstruction(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot, output string) (plan.OneTimeInstruction, []plan.File, error) {
+	instruction, files, err := p.generateEtcdSnapshotAgentInstruction(controlPlane, snapshot.SnapshotFile.S3, etcdSnapshotDecryptInstructionName, "download",
+		"--name="+snapshot.SnapshotFile.Name,
+		"--output="+output)
+	if err != nil {
+		return instruction, files, fmt.Errorf("failed to decrypt etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+	}
+	return instruction, files, nil
+}
+
+// decryptedEtcdSnapshotName returns the name of the decrypted file of an encrypted etcd snapshot.
+func decryptedEtcdSnapshotName(snapshot *rkev1.ETCDSnapshot) string {
+	return strings.TrimSuffix(snapshot.SnapshotFile.Name, snapshotcrypt.Extension)
+}
+
+// isEncryptedEtcdSnapshot returns whether the etcd snapshot is an encrypted S3 snapshot.
+func isEncryptedEtcdSnapshot(snapshot *rkev1.ETCDSnapshot) bool {
+	return snapshot != nil && snapshot.SnapshotFile.S3 != nil && snapshot.SnapshotFile.EncryptionKeyID != ""
+}
@@ -0,0 +1,52 @@
+package planner
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr/snapshotcrypt"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSnapshotEncryptionDisabled(t *testing.T) {
+	key := make([]byte, snapshotcrypt.KeySize)
+	previous := make([]byte, snapshotcrypt.KeySize)
+	previous[0] = 1
+
+	ctrl := gomock.NewController(t)
+	secretCache := fake.NewMockCacheInterface[*corev1.Secret](ctrl)
+	secretCache.EXPECT().Get("fleet-default", "snapshot-keys").Return(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "snapshot-keys"},
+		Data:       map[string][]byte{"key": key, "previous": previous},
+	}, nil)
+
+	controlPlane := &rkev1.RKEControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"},
+		Spec: rkev1.RKEControlPlaneSpec{
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{
+					S3:                 &rkev1.ETCDSnapshotS3{Bucket: "snapshots"},
+					SnapshotEncryption: &rkev1.ETCDSnapshotEncryption{SecretName: "snapshot-keys", Disabled: true},
+				},
+			},
+		},
+	}
+	assert.False(t, SnapshotEncryptionEnabled(controlPlane))
+	controlPlane.Spec.ETCD.SnapshotEncryption.Disabled = false
+	assert.True(t, SnapshotEncryptionEnabled(controlPlane))
+	controlPlane.Spec.ETCD.SnapshotEncryption.Disabled = true
+
+	// the snapshots that were encrypted can still be restored
+	keys, err := SnapshotEncryptionKeys(secretCache, controlPlane)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{key, previous}, keys)
+
+	controlPlane.Spec.ETCD.SnapshotEncryption = nil
+	_, err = SnapshotEncryptionKeys(secretCache, controlPlane)
+	assert.Error(t, err)
+}
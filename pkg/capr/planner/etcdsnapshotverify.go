@@ -0,0 +1,59 @@
+package planner
+
+import (
+	"fmt"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultSnapshotVerificationInterval = time.Hour
+
+// etcdSnapshotChecksumScript returns a script printing the SHA-256 checksum of every local etcd snapshot of the node in
+// the format of sha256sum.
+func etcdSnapshotChecksumScript(controlPlane *rkev1.RKEControlPlane) string {
+	return fmt.Sprintf(`%s etcd-snapshot list --etcd-s3=false 2>/dev/null | awk 'NR>1 {sub("^file://", "", $2); print $2}' | xargs -r sha256sum`,
+		capr.GetRuntime(controlPlane.Spec.KubernetesVersion))
+}
+
+// etcdSnapshotCreatedChecksumScript returns a script printing the SHA-256 checksum of the latest local etcd snapshot of
+// the node, which is the snapshot that was just created, in the format of sha256sum.
+func etcdSnapshotCreatedChecksumScript(controlPlane *rkev1.RKEControlPlane) string {
+	return fmt.Sprintf(`%s etcd-snapshot list --etcd-s3=false 2>/dev/null | awk 'NR>1 {sub("^file://", "", $2); print $2}' | xargs -r ls -t | head -n 1 | xargs -r sha256sum`,
+		capr.GetRuntime(controlPlane.Spec.KubernetesVersion))
+}
+
+// SnapshotVerificationInterval returns how often the local etcd snapshots of the control plane are verified against
+// their checksums, or 0 if they are not verified.
+func SnapshotVerificationInterval(controlPlane *rkev1.RKEControlPlane) time.Duration {
+	if controlPlane == nil || controlPlane.Spec.ETCD == nil || controlPlane.Spec.ETCD.SnapshotVerificationIntervalSeconds == 0 {
+		return defaultSnapshotVerificationInterval
+	}
+	if controlPlane.Spec.ETCD.SnapshotVerificationIntervalSeconds < 0 {
+		return 0
+	}
+	return time.Duration(controlPlane.Spec.ETCD.SnapshotVerificationIntervalSeconds) * time.Second
+}
+
+// S3SnapshotVerificationInterval returns how often the S3 etcd snapshots of the control plane are downloaded to verify
+// them against their checksums, or 0 if they are not verified.
+func S3SnapshotVerificationInterval(controlPlane *rkev1.RKEControlPlane) time.Duration {
+	if controlPlane == nil || controlPlane.Spec.ETCD == nil || controlPlane.Spec.ETCD.S3SnapshotVerificationIntervalSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(controlPlane.Spec.ETCD.S3SnapshotVerificationIntervalSeconds) * time.Second
+}
+
+// VerifyEtcdSnapshotChecksum returns the verification of an etcd snapshot whose file has the given checksum.
+func VerifyEtcdSnapshotChecksum(snapshot *rkev1.ETCDSnapshot, checksum string, verifiedAt time.Time) *rkev1.ETCDSnapshotVerification {
+	verification := &rkev1.ETCDSnapshotVerification{
+		VerifiedAt: &metav1.Time{Time: verifiedAt},
+		Valid:      checksum == snapshot.SnapshotFile.Checksum,
+	}
+	if !verification.Valid {
+		verification.Message = fmt.Sprintf("checksum %s does not match checksum %s recorded when the snapshot was created", checksum, snapshot.SnapshotFile.Checksum)
+	}
+	return verification
+}
@@ -0,0 +1,343 @@
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/wrangler/v3/pkg/name"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	etcdSnapshotTestRestoreInstructionName = "etcd-snapshot-test-restore"
+	etcdSnapshotTestRestoreEnv             = "ETCD_SNAPSHOT_TEST_RESTORE"
+
+	// etcdSnapshotTestRestoreURLExpiry is how long the URL an S3 snapshot is downloaded from during a test restore is
+	// valid.
+	etcdSnapshotTestRestoreURLExpiry = 12 * time.Hour
+)
+
+// etcdSnapshotTestRestoreScript restores an etcd snapshot into a temporary data directory with etcdutl, and prints the
+// status of the restored database as JSON. The temporary data directory is removed afterward, the etcd of the cluster is
+// not touched.
+const etcdSnapshotTestRestoreScript = `set -e
+etcdutl=$(command -v etcdutl || find "$PWD" -type f -name etcdutl | head -n 1)
+if [ -z "$etcdutl" ]; then
+	echo "etcdutl not found in image" >&2
+	exit 1
+fi
+dir=$(mktemp -d "$DATA_DIR/etcd-snapshot-test-restore.XXXXXX")
+trap 'rm -rf "$dir" ${SNAPSHOT_REMOVE:+"$SNAPSHOT_FILE"}' EXIT
+if [ -n "$SNAPSHOT_URL" ]; then
+	curl -fsSL ${SNAPSHOT_CACERT:+--cacert "$SNAPSHOT_CACERT"} ${SNAPSHOT_INSECURE:+-k} -o "$dir/snapshot" "$SNAPSHOT_URL"
+else
+	cp "$SNAPSHOT_FILE" "$dir/snapshot"
+fi
+case "$SNAPSHOT_NAME" in
+*.zip) unzip -p "$dir/snapshot" > "$dir/db" ;;
+*) mv "$dir/snapshot" "$dir/db" ;;
+esac
+"$etcdutl" snapshot restore "$dir/db" --data-dir "$dir/data" >&2
+"$etcdutl" snapshot status "$dir/data/member/snap/db" -w json
+`
+
+func (p *Planner) setEtcdSnapshotTestRestoreState(status rkev1.RKEControlPlaneStatus, restore *rkev1.ETCDSnapshotTestRestore, phase rkev1.ETCDSnapshotPhase) (rkev1.RKEControlPlaneStatus, error) {
+	if status.ETCDSnapshotTestRestorePhase != phase || !equality.Semantic.DeepEqual(status.ETCDSnapshotTestRestore, restore) {
+		status.ETCDSnapshotTestRestorePhase = phase
+		status.ETCDSnapshotTestRestore = restore
+		return status, errWaiting("refreshing etcd test restore state")
+	}
+	return status, nil
+}
+
+func (p *Planner) resetEtcdSnapshotTestRestoreState(status rkev1.RKEControlPlaneStatus) (rkev1.RKEControlPlaneStatus, error) {
+	if status.ETCDSnapshotTestRestore == nil && status.ETCDSnapshotTestRestorePhase == "" {
+		return status, nil
+	}
+	return p.setEtcdSnapshotTestRestoreState(status, nil, "")
+}
+
+func (p *Planner) startOrRestartEtcdSnapshotTestRestore(status rkev1.RKEControlPlaneStatus, restore *rkev1.ETCDSnapshotTestRestore) (rkev1.RKEControlPlaneStatus, error) {
+	if status.ETCDSnapshotTestRestore == nil || !equality.Semantic.DeepEqual(restore, status.ETCDSnapshotTestRestore) {
+		return p.setEtcdSnapshotTestRestoreState(status, restore, rkev1.ETCDSnapshotPhaseStarted)
+	}
+	return status, nil
+}
+
+// testRestoreEtcdSnapshot restores an etcd snapshot into a throwaway etcd data directory on a node of the cluster and
+// records the revision and number of keys of the restored etcd in the status of the control plane. Local snapshots are
+// restored on the node they were taken on, S3 snapshots on a control plane node.
+func (p *Planner) testRestoreEtcdSnapshot(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, tokensSecret plan.Secret, clusterPlan *plan.Plan) (rkev1.RKEControlPlaneStatus, error) {
+	var err error
+	if controlPlane.Spec.ETCDSnapshotTestRestore == nil || controlPlane.Spec.ETCDSnapshotTestRestore.Name == "" {
+		return p.resetEtcdSnapshotTestRestoreState(status)
+	}
+
+	// Don't test restore an etcd snapshot if the cluster is not initialized or bootstrapped.
+	if !status.Initialized || !capr.Bootstrapped.IsTrue(&status) {
+		logrus.Warnf("[planner] rkecluster %s/%s: skipping etcd snapshot test restore as cluster has not yet been initialized or bootstrapped", controlPlane.Namespace, controlPlane.Name)
+		return status, nil
+	}
+
+	restore := controlPlane.Spec.ETCDSnapshotTestRestore
+
+	if status, err = p.startOrRestartEtcdSnapshotTestRestore(status, restore); err != nil {
+		return status, err
+	}
+
+	switch controlPlane.Status.ETCDSnapshotTestRestorePhase {
+	case rkev1.ETCDSnapshotPhaseStarted:
+		result, err := p.runEtcdSnapshotTestRestore(controlPlane, restore, tokensSecret, clusterPlan)
+		if err != nil {
+			return status, err
+		}
+		status.ETCDSnapshotTestRestoreResult = result
+		return p.setEtcdSnapshotTestRestoreState(status, restore, rkev1.ETCDSnapshotPhasePostRestoreNodeCleanup)
+	case rkev1.ETCDSnapshotPhasePostRestoreNodeCleanup:
+		if err = p.runEtcdSnapshotTestRestoreCleanup(controlPlane, tokensSecret, clusterPlan); err != nil {
+			return status, err
+		}
+		if status.ETCDSnapshotTestRestoreResult != nil && status.ETCDSnapshotTestRestoreResult.Succeeded {
+			return p.setEtcdSnapshotTestRestoreState(status, restore, rkev1.ETCDSnapshotPhaseFinished)
+		}
+		return p.setEtcdSnapshotTestRestoreState(status, restore, rkev1.ETCDSnapshotPhaseFailed)
+	case rkev1.ETCDSnapshotPhaseFailed:
+		fallthrough
+	case rkev1.ETCDSnapshotPhaseFinished:
+		return status, nil
+	default:
+		return p.setEtcdSnapshotTestRestoreState(status, restore, rkev1.ETCDSnapshotPhaseStarted)
+	}
+}
+
+// runEtcdSnapshotTestRestore delivers the test restore plan to the node the snapshot is restored on, and returns the
+// result of the test restore once the plan was applied or failed. It returns an errWaiting while the plan is applied.
+func (p *Planner) runEtcdSnapshotTestRestore(controlPlane *rkev1.RKEControlPlane, restore *rkev1.ETCDSnapshotTestRestore, tokensSecret plan.Secret, clusterPlan *plan.Plan) (*rkev1.ETCDSnapshotTestRestoreResult, error) {
+	result := &rkev1.ETCDSnapshotTestRestoreResult{
+		Name:        restore.Name,
+		CompletedAt: &metav1.Time{Time: time.Now()},
+	}
+
+	snapshot, err := p.etcdSnapshotCache.Get(controlPlane.Namespace, restore.Name)
+	if apierrors.IsNotFound(err) {
+		result.Message = fmt.Sprintf("etcd snapshot %s/%s not found", controlPlane.Namespace, restore.Name)
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry, err := etcdSnapshotTestRestoreNode(snapshot, restore, clusterPlan)
+	if err != nil {
+		result.Message = err.Error()
+		return result, nil
+	}
+	if entry.Machine.Status.NodeRef != nil {
+		result.NodeName = entry.Machine.Status.NodeRef.Name
+	}
+
+	testRestorePlan := entry.Plan.Plan
+	joinedServer := entry.Plan.JoinedTo
+	if !hasEtcdSnapshotTestRestoreInstruction(entry, restore) {
+		// the plan is only generated once, as the URL an S3 snapshot is downloaded from changes every time
+		_, joinServer, _, err := p.findInitNode(controlPlane, clusterPlan)
+		if err != nil {
+			return nil, err
+		}
+		testRestorePlan, joinedServer, err = p.generateEtcdSnapshotTestRestorePlan(controlPlane, snapshot, restore, tokensSecret, entry, joinServer)
+		if err != nil {
+			result.Message = err.Error()
+			return result, nil
+		}
+	}
+
+	msg := fmt.Sprintf("etcd snapshot test restore of %s on machine %s/%s", restore.Name, entry.Machine.Namespace, entry.Machine.Name)
+	if err = assignAndCheckPlan(p.store, msg, entry, testRestorePlan, joinedServer, 1, 1); IsErrWaiting(err) {
+		return nil, err
+	} else if err != nil {
+		result.Message = err.Error() + " -- check rancher-system-agent.service logs on node for more information"
+		return result, nil
+	}
+
+	if err := parseEtcdSnapshotTestRestoreOutput(entry.Plan.Output[etcdSnapshotTestRestoreInstructionName], result); err != nil {
+		result.Message = err.Error()
+		return result, nil
+	}
+	result.Succeeded = true
+	logrus.Infof("[planner] rkecluster %s/%s: etcd snapshot %s restored successfully with revision %d and %d keys", controlPlane.Namespace, controlPlane.Name, restore.Name, result.Revision, result.TotalKeys)
+	return result, nil
+}
+
+// etcdSnapshotTestRestoreNode returns the node a snapshot is restored on during a test restore: the node a local
+// snapshot was taken on, or a control plane node for an S3 snapshot. A node already running the test restore is
+// preferred.
+func etcdSnapshotTestRestoreNode(snapshot *rkev1.ETCDSnapshot, restore *rkev1.ETCDSnapshotTestRestore, clusterPlan *plan.Plan) (*planEntry, error) {
+	include := roleAnd(isControlPlane, roleNot(roleOr(isDeleting, windows)))
+	if snapshot.SnapshotFile.S3 == nil {
+		machineID := snapshot.Labels[capr.MachineIDLabel]
+		if machineID == "" {
+			return nil, fmt.Errorf("unable to find machine of etcd snapshot %s/%s as label %s did not exist", snapshot.Namespace, snapshot.Name, capr.MachineIDLabel)
+		}
+		include = func(entry *planEntry) bool {
+			return entry.Machine.Labels[capr.MachineIDLabel] == machineID && !isDeleting(entry)
+		}
+	}
+
+	var candidates []*planEntry
+	for _, entry := range collect(clusterPlan, include) {
+		if entry.Plan == nil || entry.Machine.Status.NodeRef == nil {
+			continue
+		}
+		if hasEtcdSnapshotTestRestoreInstruction(entry, restore) {
+			return entry, nil
+		}
+		candidates = append(candidates, entry)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no node found to test restore etcd snapshot %s/%s on", snapshot.Namespace, snapshot.Name)
+	}
+	return candidates[0], nil
+}
+
+// hasEtcdSnapshotTestRestoreInstruction returns whether the plan of the node contains the instruction of the test
+// restore.
+func hasEtcdSnapshotTestRestoreInstruction(entry *planEntry, restore *rkev1.ETCDSnapshotTestRestore) bool {
+	if entry.Plan == nil {
+		return false
+	}
+	for _, instruction := range entry.Plan.Plan.Instructions {
+		if instruction.Name != etcdSnapshotTestRestoreInstructionName {
+			continue
+		}
+		if restore == nil || slices.Contains(instruction.Env, etcdSnapshotTestRestoreEnv+"="+etcdSnapshotTestRestoreID(restore)) {
+			return true
+		}
+	}
+	return false
+}
+
+func etcdSnapshotTestRestoreID(restore *rkev1.ETCDSnapshotTestRestore) string {
+	return restore.Name + "/" + strconv.Itoa(restore.Generation)
+}
+
+// generateEtcdSnapshotTestRestorePlan generates a plan that restores the etcd snapshot into a temporary etcd data
+// directory. Like the etcd snapshot creation plan, the runtime is installed without being restarted.
+func (p *Planner) generateEtcdSnapshotTestRestorePlan(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot, restore *rkev1.ETCDSnapshotTestRestore, tokensSecret plan.Secret, entry *planEntry, joinServer string) (plan.NodePlan, string, error) {
+	if p.retrievalFunctions.EtcdSnapshotTestRestoreImage == nil || p.retrievalFunctions.EtcdSnapshotTestRestoreImage() == "" {
+		return plan.NodePlan{}, "", fmt.Errorf("no image configured for etcd snapshot test restores")
+	}
+
+	env := []string{
+		etcdSnapshotTestRestoreEnv + "=" + etcdSnapshotTestRestoreID(restore),
+		"DATA_DIR=" + capr.GetDistroDataDir(controlPlane),
+	}
+	var (
+		files        []plan.File
+		instructions []plan.OneTimeInstruction
+	)
+	if snapshot.SnapshotFile.S3 == nil {
+		env = append(env,
+			"SNAPSHOT_NAME="+snapshot.SnapshotFile.Name,
+			"SNAPSHOT_FILE="+strings.TrimPrefix(snapshot.SnapshotFile.Location, "file://"))
+	} else if isEncryptedEtcdSnapshot(snapshot) {
+		// the snapshot is decrypted by the agent, the decrypted file is removed by the test restore
+		decrypted := path.Join(capr.GetDistroDataDir(controlPlane), "etcd-snapshot-test-restore-"+decryptedEtcdSnapshotName(snapshot))
+		instruction, decryptFiles, err := p.generateEtcdSnapshotDecryptInstruction(controlPlane, snapshot, decrypted)
+		if err != nil {
+			return plan.NodePlan{}, "", err
+		}
+		files = append(files, decryptFiles...)
+		instructions = append(instructions, instruction)
+		env = append(env,
+			"SNAPSHOT_NAME="+decryptedEtcdSnapshotName(snapshot),
+			"SNAPSHOT_FILE="+decrypted,
+			"SNAPSHOT_REMOVE=true")
+	} else {
+		env = append(env, "SNAPSHOT_NAME="+snapshot.SnapshotFile.Name)
+		object, err := GetS3Object(p.etcdS3Args.secretCache, snapshot, controlPlane)
+		if err != nil {
+			return plan.NodePlan{}, "", err
+		}
+		url, err := object.Client.PresignedGetObject(p.ctx, object.Bucket, object.Key, etcdSnapshotTestRestoreURLExpiry, nil)
+		if err != nil {
+			return plan.NodePlan{}, "", fmt.Errorf("failed to generate URL of S3 etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+		}
+		env = append(env, "SNAPSHOT_URL="+url.String())
+		if object.SkipSSLVerify {
+			env = append(env, "SNAPSHOT_INSECURE=true")
+		}
+		if object.EndpointCA != "" {
+			filePath := configFile(controlPlane, fmt.Sprintf("s3-endpoint-ca-%s.crt", name.Hex(object.EndpointCA, 5)))
+			files = append(files, plan.File{
+				Content: object.EndpointCA,
+				Path:    filePath,
+			})
+			env = append(env, "SNAPSHOT_CACERT="+filePath)
+		}
+	}
+
+	testRestorePlan, _, joinedServer, err := p.generatePlanWithConfigFiles(controlPlane, tokensSecret, entry, joinServer, true)
+	if err != nil {
+		return testRestorePlan, joinedServer, err
+	}
+	testRestorePlan.Files = append(testRestorePlan.Files, files...)
+	testRestorePlan.Instructions = append(testRestorePlan.Instructions, p.generateInstallInstructionWithSkipStart(controlPlane, entry))
+	testRestorePlan.Instructions = append(testRestorePlan.Instructions, instructions...)
+	testRestorePlan.Instructions = append(testRestorePlan.Instructions,
+		plan.OneTimeInstruction{
+			Name:       etcdSnapshotTestRestoreInstructionName,
+			Image:      p.retrievalFunctions.ImageResolver(p.retrievalFunctions.EtcdSnapshotTestRestoreImage(), controlPlane),
+			Command:    "sh",
+			Args:       []string{"-c", etcdSnapshotTestRestoreScript},
+			Env:        env,
+			SaveOutput: true,
+		})
+	return testRestorePlan, joinedServer, nil
+}
+
+// parseEtcdSnapshotTestRestoreOutput parses the status of the restored etcd database printed by etcdutl into the result
+// of the test restore.
+func parseEtcdSnapshotTestRestoreOutput(output []byte, result *rkev1.ETCDSnapshotTestRestoreResult) error {
+	var snapshotStatus struct {
+		Revision  int64 `json:"revision"`
+		TotalKey  int64 `json:"totalKey"`
+		TotalSize int64 `json:"totalSize"`
+	}
+	if err := json.Unmarshal(output, &snapshotStatus); err != nil {
+		return fmt.Errorf("failed to parse status of restored etcd snapshot: %w", err)
+	}
+	result.Revision = snapshotStatus.Revision
+	result.TotalKeys = snapshotStatus.TotalKey
+	result.TotalSize = snapshotStatus.TotalSize
+	return nil
+}
+
+// runEtcdSnapshotTestRestoreCleanup delivers the desired plan to the nodes that still have a test restore plan.
+func (p *Planner) runEtcdSnapshotTestRestoreCleanup(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret, clusterPlan *plan.Plan) error {
+	_, joinServer, _, err := p.findInitNode(controlPlane, clusterPlan)
+	if err != nil {
+		return err
+	}
+	for _, entry := range collect(clusterPlan, func(entry *planEntry) bool {
+		return hasEtcdSnapshotTestRestoreInstruction(entry, nil)
+	}) {
+		desiredPlan, joinedServer, err := p.desiredPlan(controlPlane, tokensSecret, entry, joinServer)
+		if err != nil {
+			return err
+		}
+		if err = assignAndCheckPlan(p.store, "etcd snapshot test restore cleanup", entry, desiredPlan, joinedServer, 1, -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
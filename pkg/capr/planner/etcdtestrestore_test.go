@@ -0,0 +1,105 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestParseEtcdSnapshotTestRestoreOutput(t *testing.T) {
+	result := &rkev1.ETCDSnapshotTestRestoreResult{}
+	err := parseEtcdSnapshotTestRestoreOutput([]byte(`{"hash":3445218213,"revision":182736,"totalKey":1523,"totalSize":25587712,"version":"3.5.0"}`), result)
+	require.NoError(t, err)
+	assert.Equal(t, int64(182736), result.Revision)
+	assert.Equal(t, int64(1523), result.TotalKeys)
+	assert.Equal(t, int64(25587712), result.TotalSize)
+
+	assert.Error(t, parseEtcdSnapshotTestRestoreOutput([]byte("Error: snapshot file integrity check failed"), result))
+}
+
+func TestEtcdSnapshotTestRestoreNode(t *testing.T) {
+	restore := &rkev1.ETCDSnapshotTestRestore{Name: "snapshot", Generation: 1}
+	clusterPlan := &plan.Plan{
+		Nodes:    map[string]*plan.Node{},
+		Machines: map[string]*capi.Machine{},
+		Metadata: map[string]*plan.Metadata{},
+	}
+	for name, labels := range map[string]map[string]string{
+		"cp-1":   {capr.ControlPlaneRoleLabel: "true"},
+		"cp-2":   {capr.ControlPlaneRoleLabel: "true"},
+		"etcd-1": {capr.EtcdRoleLabel: "true"},
+	} {
+		clusterPlan.Machines[name] = &capi.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{capr.MachineIDLabel: name + "-id"}},
+			Status:     capi.MachineStatus{NodeRef: &corev1.ObjectReference{Name: name}},
+		}
+		clusterPlan.Metadata[name] = &plan.Metadata{Labels: labels}
+		clusterPlan.Nodes[name] = &plan.Node{}
+	}
+
+	local := &rkev1.ETCDSnapshot{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{capr.MachineIDLabel: "etcd-1-id"}}}
+	entry, err := etcdSnapshotTestRestoreNode(local, restore, clusterPlan)
+	require.NoError(t, err)
+	assert.Equal(t, "etcd-1", entry.Machine.Name, "local snapshots must be restored on the node they were taken on")
+
+	_, err = etcdSnapshotTestRestoreNode(&rkev1.ETCDSnapshot{}, restore, clusterPlan)
+	assert.Error(t, err, "local snapshots without machine ID can't be restored")
+
+	s3 := &rkev1.ETCDSnapshot{SnapshotFile: rkev1.ETCDSnapshotFile{S3: &rkev1.ETCDSnapshotS3{Bucket: "snapshots"}}}
+	entry, err = etcdSnapshotTestRestoreNode(s3, restore, clusterPlan)
+	require.NoError(t, err)
+	assert.Equal(t, "cp-1", entry.Machine.Name, "S3 snapshots must be restored on a control plane node")
+
+	clusterPlan.Nodes["cp-2"].Plan.Instructions = []plan.OneTimeInstruction{{
+		Name: etcdSnapshotTestRestoreInstructionName,
+		Env:  []string{etcdSnapshotTestRestoreEnv + "=snapshot/1"},
+	}}
+	entry, err = etcdSnapshotTestRestoreNode(s3, restore, clusterPlan)
+	require.NoError(t, err)
+	assert.Equal(t, "cp-2", entry.Machine.Name, "the node already running the test restore must be preferred")
+
+	entry, err = etcdSnapshotTestRestoreNode(s3, &rkev1.ETCDSnapshotTestRestore{Name: "snapshot", Generation: 2}, clusterPlan)
+	require.NoError(t, err)
+	assert.Equal(t, "cp-1", entry.Machine.Name)
+}
+
+func TestSnapshotVerificationInterval(t *testing.T) {
+	assert.Equal(t, time.Hour, SnapshotVerificationInterval(&rkev1.RKEControlPlane{}))
+	cp := &rkev1.RKEControlPlane{Spec: rkev1.RKEControlPlaneSpec{RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+		ETCD: &rkev1.ETCD{SnapshotVerificationIntervalSeconds: 600},
+	}}}
+	assert.Equal(t, 10*time.Minute, SnapshotVerificationInterval(cp))
+	cp.Spec.ETCD.SnapshotVerificationIntervalSeconds = -1
+	assert.Equal(t, time.Duration(0), SnapshotVerificationInterval(cp))
+}
+
+func TestS3SnapshotVerificationInterval(t *testing.T) {
+	// S3 snapshots are only downloaded to verify them if enabled.
+	assert.Equal(t, time.Duration(0), S3SnapshotVerificationInterval(&rkev1.RKEControlPlane{}))
+	cp := &rkev1.RKEControlPlane{Spec: rkev1.RKEControlPlaneSpec{RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+		ETCD: &rkev1.ETCD{S3SnapshotVerificationIntervalSeconds: 86400},
+	}}}
+	assert.Equal(t, 24*time.Hour, S3SnapshotVerificationInterval(cp))
+}
+
+func TestVerifyEtcdSnapshotChecksum(t *testing.T) {
+	snapshot := &rkev1.ETCDSnapshot{SnapshotFile: rkev1.ETCDSnapshotFile{Checksum: "aaaa"}}
+	now := time.Now()
+
+	verification := VerifyEtcdSnapshotChecksum(snapshot, "aaaa", now)
+	assert.True(t, verification.Valid)
+	assert.Empty(t, verification.Message)
+	assert.Equal(t, now, verification.VerifiedAt.Time)
+
+	verification = VerifyEtcdSnapshotChecksum(snapshot, "bbbb", now)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, "checksum bbbb does not match checksum aaaa recorded when the snapshot was created", verification.Message)
+}
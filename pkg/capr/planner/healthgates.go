@@ -0,0 +1,274 @@
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/wrangler/v3/pkg/name"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	UpgradePausedMessage = "upgrade paused"
+
+	// HealthGatesRetryInterval is how often the health gates of a paused rollout are checked again.
+	HealthGatesRetryInterval = time.Minute
+
+	healthGatesTimeout = 30 * time.Second
+
+	defaultPrometheusNamespace = "cattle-monitoring-system"
+	defaultPrometheusService   = "rancher-monitoring-prometheus"
+	defaultPrometheusPort      = "9090"
+)
+
+// healthGates evaluates the upgrade health gates of a control plane at most once per reconciliation, when a major
+// plan change is about to be rolled out to a machine. A nil healthGates always passes.
+type healthGates struct {
+	ctx         context.Context
+	gates       *rkev1.UpgradeHealthGates
+	clusterPlan *plan.Plan
+	// client returns a client of the downstream cluster.
+	client func() (kubernetes.Interface, error)
+
+	evaluated bool
+	// failure is why the gates failed, it is nil if they passed.
+	failure error
+	// paused is whether a plan change was held because the gates failed.
+	paused bool
+}
+
+// newHealthGates returns the health gates of the control plane, or nil if it has none.
+func (p *Planner) newHealthGates(cp *rkev1.RKEControlPlane, clusterPlan *plan.Plan) *healthGates {
+	if cp.Spec.UpgradeStrategy.HealthGates == nil {
+		return nil
+	}
+	return &healthGates{
+		ctx:         p.ctx,
+		gates:       cp.Spec.UpgradeStrategy.HealthGates,
+		clusterPlan: clusterPlan,
+		client: func() (kubernetes.Interface, error) {
+			return p.downstreamClient(cp)
+		},
+	}
+}
+
+// downstreamClient returns a client of the cluster of the control plane using the kubeconfig generated by Rancher.
+func (p *Planner) downstreamClient(cp *rkev1.RKEControlPlane) (kubernetes.Interface, error) {
+	secret, err := p.secretCache.Get(cp.Namespace, name.SafeConcatName(cp.Spec.ClusterName, "kubeconfig"))
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data["value"])
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = healthGatesTimeout
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// pauseRollout returns why the major plan change of the machine must not be started because a health gate failed, or
+// nil if it can be started. Only changes that would disrupt the machine now are gated; machines that are already
+// disrupted, or wait for other machines to be upgraded first, are not.
+func pauseRollout(r *reconcilable, gates *healthGates, concurrency, unavailable int) error {
+	if gates == nil || !r.change || isDisrupted(r.entry) || (concurrency != 0 && unavailable >= concurrency) {
+		return nil
+	}
+	if err := gates.check(); err != nil {
+		gates.paused = true
+		return err
+	}
+	return nil
+}
+
+// check returns why the health gates failed, or nil if they passed. The gates are only evaluated the first time.
+func (g *healthGates) check() error {
+	if g == nil {
+		return nil
+	}
+	if !g.evaluated {
+		ctx, cancel := context.WithTimeout(g.ctx, healthGatesTimeout)
+		defer cancel()
+		g.failure = g.evaluate(ctx)
+		g.evaluated = true
+	}
+	return g.failure
+}
+
+func (g *healthGates) evaluate(ctx context.Context) error {
+	if g.gates.Etcd {
+		if err := etcdMembersHealthy(g.clusterPlan); err != nil {
+			return err
+		}
+	}
+
+	client, err := g.client()
+	if err != nil {
+		return fmt.Errorf("connecting to cluster: %w", err)
+	}
+
+	if g.gates.Etcd {
+		if _, err := client.Discovery().RESTClient().Get().AbsPath("/readyz/etcd").DoRaw(ctx); err != nil {
+			return fmt.Errorf("API server can't reach etcd quorum: %w", err)
+		}
+	}
+
+	if g.gates.APIServerLatency != nil {
+		start := time.Now()
+		if _, err := client.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx); err != nil {
+			return fmt.Errorf("API server is not ready: %w", err)
+		}
+		if latency := time.Since(start); latency > g.gates.APIServerLatency.Duration {
+			return fmt.Errorf("API server latency %s exceeds %s", latency.Round(time.Millisecond), g.gates.APIServerLatency.Duration)
+		}
+	}
+
+	if g.gates.PodDisruptionBudgets {
+		if err := podDisruptionBudgetsHealthy(ctx, client); err != nil {
+			return err
+		}
+	}
+
+	if g.gates.Prometheus != nil {
+		for _, query := range g.gates.Prometheus.Queries {
+			if err := prometheusQueryPasses(ctx, client, g.gates.Prometheus, query); err != nil {
+				return fmt.Errorf("prometheus health gate %s failed: %w", query.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// etcdMembersHealthy returns an error if the etcd probe of any etcd machine that joined the cluster is unhealthy.
+func etcdMembersHealthy(clusterPlan *plan.Plan) error {
+	var unhealthy []string
+	for _, entry := range collect(clusterPlan, roleAnd(isEtcd, roleNot(isDeleting))) {
+		if entry.Plan == nil || entry.Plan.AppliedPlan == nil {
+			// the machine didn't join etcd yet
+			continue
+		}
+		if !entry.Plan.ProbeStatus["etcd"].Healthy {
+			unhealthy = append(unhealthy, entry.Machine.Name)
+		}
+	}
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("etcd member(s) %s unhealthy", atMostThree(unhealthy))
+	}
+	return nil
+}
+
+// podDisruptionBudgetsHealthy returns an error if any PodDisruptionBudget of the cluster has fewer healthy pods than
+// it requires.
+func podDisruptionBudgetsHealthy(ctx context.Context, client kubernetes.Interface) error {
+	pdbs, err := client.PolicyV1().PodDisruptionBudgets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing PodDisruptionBudgets: %w", err)
+	}
+	var failing []string
+	for _, pdb := range pdbs.Items {
+		if pdb.Status.CurrentHealthy < pdb.Status.DesiredHealthy {
+			failing = append(failing, pdb.Namespace+"/"+pdb.Name)
+		}
+	}
+	if len(failing) > 0 {
+		return fmt.Errorf("PodDisruptionBudget(s) %s not satisfied", atMostThree(failing))
+	}
+	return nil
+}
+
+// prometheusQueryPasses returns an error if the query returns any series, or can't be answered.
+func prometheusQueryPasses(ctx context.Context, client kubernetes.Interface, prometheus *rkev1.PrometheusHealthGates, query rkev1.PrometheusHealthGateQuery) error {
+	namespace, service, port := prometheus.Namespace, prometheus.Service, prometheus.Port
+	if namespace == "" {
+		namespace = defaultPrometheusNamespace
+	}
+	if service == "" {
+		service = defaultPrometheusService
+	}
+	if port == "" {
+		port = defaultPrometheusPort
+	}
+
+	body, err := client.CoreV1().Services(namespace).ProxyGet("http", service, port, "api/v1/query", map[string]string{"query": query.Query}).DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string            `json:"resultType"`
+			Result     []json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	if response.Status != "success" {
+		return errors.New(response.Error)
+	}
+	if response.Data.ResultType != "vector" && response.Data.ResultType != "matrix" {
+		return fmt.Errorf("unsupported result type %s", response.Data.ResultType)
+	}
+	if len(response.Data.Result) > 0 {
+		return fmt.Errorf("query returned %d series", len(response.Data.Result))
+	}
+	return nil
+}
+
+// done sets the UpgradePaused condition of the control plane. If a plan change was held because the health gates
+// failed, it returns an errWaiting that re-enqueues the control plane after HealthGatesRetryInterval, unless err is an
+// actual error.
+func (g *healthGates) done(status *rkev1.RKEControlPlaneStatus, err error) error {
+	if g == nil || !g.paused {
+		if capr.UpgradePaused.GetStatus(status) != "" {
+			capr.UpgradePaused.False(status)
+			capr.UpgradePaused.Message(status, "")
+			capr.UpgradePaused.Reason(status, "")
+		}
+		return err
+	}
+
+	message := UpgradePausedMessage + ": " + g.failure.Error()
+	capr.UpgradePaused.True(status)
+	capr.UpgradePaused.Message(status, message)
+	capr.UpgradePaused.Reason(status, "HealthGateFailed")
+
+	if err != nil && !IsErrWaiting(err) {
+		return err
+	}
+	if err != nil {
+		message = err.Error()
+	}
+	return errHealthGateFailed{errWaiting: errWaiting(message), waiting: err}
+}
+
+// errHealthGateFailed is an errWaiting for the health gates to pass again. It wraps the error the control plane was
+// already waiting for, if any.
+type errHealthGateFailed struct {
+	errWaiting
+	waiting error
+}
+
+func (e errHealthGateFailed) Unwrap() []error {
+	if e.waiting == nil {
+		return []error{e.errWaiting}
+	}
+	return []error{e.errWaiting, e.waiting}
+}
+
+// IsErrHealthGateFailed returns whether the rollout of the control plane is paused because a health gate failed, so
+// that it can be re-enqueued after HealthGatesRetryInterval.
+func IsErrHealthGateFailed(err error) bool {
+	var failed errHealthGateFailed
+	return errors.As(err, &failed)
+}
@@ -0,0 +1,188 @@
+package planner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestHealthGates(t *testing.T) {
+	const (
+		healthyPDBs   = `{"kind":"PodDisruptionBudgetList","apiVersion":"policy/v1","items":[{"metadata":{"name":"web","namespace":"default"},"status":{"currentHealthy":2,"desiredHealthy":2}}]}`
+		unhealthyPDBs = `{"kind":"PodDisruptionBudgetList","apiVersion":"policy/v1","items":[{"metadata":{"name":"web","namespace":"default"},"status":{"currentHealthy":1,"desiredHealthy":2}}]}`
+		noSeries      = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+		series        = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"alertname":"NodeDown"},"value":[1717200000,"1"]}]}}`
+	)
+
+	tests := []struct {
+		name          string
+		gates         rkev1.UpgradeHealthGates
+		etcdHealthy   bool
+		etcdReady     bool
+		pdbs          string
+		queryResponse string
+		wantErr       string
+	}{
+		{
+			name: "all passing",
+			gates: rkev1.UpgradeHealthGates{
+				Etcd:                 true,
+				PodDisruptionBudgets: true,
+				APIServerLatency:     &metav1.Duration{Duration: time.Minute},
+				Prometheus: &rkev1.PrometheusHealthGates{
+					Queries: []rkev1.PrometheusHealthGateQuery{{Name: "alerts", Query: `ALERTS{severity="critical"}`}},
+				},
+			},
+			etcdHealthy:   true,
+			etcdReady:     true,
+			pdbs:          healthyPDBs,
+			queryResponse: noSeries,
+		},
+		{
+			name:        "unhealthy etcd member",
+			gates:       rkev1.UpgradeHealthGates{Etcd: true},
+			etcdHealthy: false,
+			etcdReady:   true,
+			wantErr:     "etcd member(s) etcd-1 unhealthy",
+		},
+		{
+			name:        "etcd quorum lost",
+			gates:       rkev1.UpgradeHealthGates{Etcd: true},
+			etcdHealthy: true,
+			etcdReady:   false,
+			wantErr:     "API server can't reach etcd quorum",
+		},
+		{
+			name:    "API server latency exceeded",
+			gates:   rkev1.UpgradeHealthGates{APIServerLatency: &metav1.Duration{Duration: time.Nanosecond}},
+			wantErr: "API server latency",
+		},
+		{
+			name:    "unhealthy PodDisruptionBudget",
+			gates:   rkev1.UpgradeHealthGates{PodDisruptionBudgets: true},
+			pdbs:    unhealthyPDBs,
+			wantErr: "PodDisruptionBudget(s) default/web not satisfied",
+		},
+		{
+			name: "prometheus query returning series",
+			gates: rkev1.UpgradeHealthGates{
+				Prometheus: &rkev1.PrometheusHealthGates{
+					Queries: []rkev1.PrometheusHealthGateQuery{{Name: "alerts", Query: `ALERTS{severity="critical"}`}},
+				},
+			},
+			queryResponse: series,
+			wantErr:       "prometheus health gate alerts failed: query returned 1 series",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/readyz":
+					time.Sleep(time.Millisecond)
+					rw.Write([]byte("ok"))
+				case "/readyz/etcd":
+					if !tt.etcdReady {
+						rw.WriteHeader(http.StatusInternalServerError)
+					}
+					rw.Write([]byte("ok"))
+				case "/apis/policy/v1/poddisruptionbudgets":
+					rw.Header().Set("Content-Type", "application/json")
+					rw.Write([]byte(tt.pdbs))
+				case "/api/v1/namespaces/cattle-monitoring-system/services/http:rancher-monitoring-prometheus:9090/proxy/api/v1/query":
+					assert.Equal(t, `ALERTS{severity="critical"}`, req.URL.Query().Get("query"))
+					rw.Header().Set("Content-Type", "application/json")
+					rw.Write([]byte(tt.queryResponse))
+				default:
+					rw.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			gates := &healthGates{
+				ctx:         context.Background(),
+				gates:       &tt.gates,
+				clusterPlan: createTestEtcdPlan(tt.etcdHealthy),
+				client: func() (kubernetes.Interface, error) {
+					return kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+				},
+			}
+			err := gates.check()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPauseRollout(t *testing.T) {
+	failure := errors.New("etcd member(s) etcd-1 unhealthy")
+	r := &reconcilable{
+		entry:  &planEntry{Plan: &plan.Node{}, Metadata: &plan.Metadata{}},
+		change: true,
+	}
+
+	assert.NoError(t, pauseRollout(r, nil, 1, 0))
+
+	gates := &healthGates{evaluated: true, failure: failure}
+	assert.NoError(t, pauseRollout(r, gates, 1, 1), "machines waiting for other machines must not be paused")
+	assert.NoError(t, pauseRollout(&reconcilable{entry: r.entry}, gates, 1, 0), "machines without changes must not be paused")
+	r.entry.Plan.Failed = true
+	assert.NoError(t, pauseRollout(r, gates, 1, 0), "disrupted machines must not be paused")
+	assert.False(t, gates.paused)
+
+	r.entry.Plan.Failed = false
+	assert.Equal(t, failure, pauseRollout(r, gates, 1, 0))
+	assert.True(t, gates.paused)
+
+	status := &rkev1.RKEControlPlaneStatus{}
+	err := gates.done(status, errWaiting("pausing upgrade of etcd node(s) etcd-1"))
+	assert.True(t, IsErrWaiting(err))
+	assert.True(t, IsErrHealthGateFailed(err))
+	assert.Equal(t, "pausing upgrade of etcd node(s) etcd-1", err.Error())
+	assert.Equal(t, string(corev1.ConditionTrue), capr.UpgradePaused.GetStatus(status))
+	assert.Equal(t, "upgrade paused: etcd member(s) etcd-1 unhealthy", capr.UpgradePaused.GetMessage(status))
+
+	// Actual errors take precedence over the paused rollout.
+	actual := errors.New("failed")
+	assert.Equal(t, actual, gates.done(status, actual))
+
+	assert.NoError(t, (*healthGates)(nil).done(status, nil))
+	assert.Equal(t, string(corev1.ConditionFalse), capr.UpgradePaused.GetStatus(status))
+}
+
+// createTestEtcdPlan returns a plan of a cluster with a joined etcd machine etcd-1 and an etcd machine etcd-2 that
+// didn't join yet.
+func createTestEtcdPlan(healthy bool) *plan.Plan {
+	clusterPlan := &plan.Plan{
+		Nodes:    map[string]*plan.Node{},
+		Machines: map[string]*capi.Machine{},
+		Metadata: map[string]*plan.Metadata{},
+	}
+	for _, name := range []string{"etcd-1", "etcd-2"} {
+		clusterPlan.Machines[name] = &capi.Machine{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		clusterPlan.Metadata[name] = &plan.Metadata{Labels: map[string]string{capr.EtcdRoleLabel: "true"}}
+	}
+	clusterPlan.Nodes["etcd-1"] = &plan.Node{
+		AppliedPlan: &plan.NodePlan{},
+		ProbeStatus: map[string]plan.ProbeStatus{"etcd": {Healthy: healthy}},
+	}
+	return clusterPlan
+}
@@ -14,6 +14,13 @@
 const (
 	captureAddressInstructionName = "capture-address"
 	etcdNameInstructionName       = "etcd-name"
+
+	// EtcdSnapshotChecksumInstructionName is the name of the instruction that computes the checksum of the local etcd
+	// snapshot a node just created.
+	EtcdSnapshotChecksumInstructionName = "etcd-snapshot-checksum"
+	// EtcdSnapshotChecksumLocalInstructionName is the name of the periodic instruction that computes the checksums of
+	// the local etcd snapshots of a node to verify them.
+	EtcdSnapshotChecksumLocalInstructionName = "etcd-snapshot-checksum-local"
 )
 
 // generateInstallInstruction generates the instruction necessary to install the desired tool.
@@ -176,6 +183,22 @@ func (p *Planner) addEtcdSnapshotListS3PeriodicInstruction(nodePlan plan.NodePla
 	return nodePlan, nil
 }
 
+// addEtcdSnapshotChecksumLocalPeriodicInstruction adds the periodic instruction that computes the checksums of the
+// local etcd snapshots of the node, unless the verification of snapshots is disabled.
+func (p *Planner) addEtcdSnapshotChecksumLocalPeriodicInstruction(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane) (plan.NodePlan, error) {
+	interval := SnapshotVerificationInterval(controlPlane)
+	if interval == 0 {
+		return nodePlan, nil
+	}
+	nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+		Name:          EtcdSnapshotChecksumLocalInstructionName,
+		Command:       "sh",
+		Args:          []string{"-c", etcdSnapshotChecksumScript(controlPlane)},
+		PeriodSeconds: int(interval.Seconds()),
+	})
+	return nodePlan, nil
+}
+
 // generateManifestRemovalInstruction generates a rm -rf command for the manifests of a server. This was created in response to https://github.com/rancher/rancher/issues/41174
 func generateManifestRemovalInstruction(controlPlane *rkev1.RKEControlPlane, entry *planEntry) (bool, plan.OneTimeInstruction) {
 	runtime := capr.GetRuntime(controlPlane.Spec.KubernetesVersion)
@@ -0,0 +1,174 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/robfig/cron"
+)
+
+const WaitingMaintenanceWindowMessage = "waiting for maintenance window"
+
+// maintenanceWindow tracks the disruptive changes held during a reconciliation of a control plane because none of its
+// maintenance windows is open. A nil maintenanceWindow holds nothing.
+type maintenanceWindow struct {
+	// closed is whether disruptive changes must be held.
+	closed bool
+	// next is the start of the next window, it is zero if no window opens again.
+	next time.Time
+	// held are the disruptive changes that were held.
+	held []string
+	// rollingOut is whether disruptive plan changes started within a window are still being rolled out, which are
+	// completed even once the window closed.
+	rollingOut bool
+	// started is whether disruptive plan changes were rolled out during the reconciliation.
+	started bool
+}
+
+// newMaintenanceWindow evaluates the maintenance windows of the control plane at now.
+func newMaintenanceWindow(cp *rkev1.RKEControlPlane, status *rkev1.RKEControlPlaneStatus, now time.Time) (*maintenanceWindow, error) {
+	windows := cp.Spec.MaintenanceWindows
+	if windows == nil || len(windows.Windows) == 0 {
+		return nil, nil
+	}
+
+	w := &maintenanceWindow{closed: true, rollingOut: capr.MaintenanceWindowRollout.IsTrue(status)}
+	for i, window := range windows.Windows {
+		open, next, err := maintenanceWindowOpen(window, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %d: %w", i, err)
+		}
+		if open {
+			w.closed = false
+		} else if !next.IsZero() && (w.next.IsZero() || next.Before(w.next)) {
+			w.next = next
+		}
+	}
+	if windows.OverrideUntil != nil && now.Before(windows.OverrideUntil.Time) {
+		w.closed = false
+	}
+	return w, nil
+}
+
+// maintenanceWindowOpen returns whether the window is open at now, and otherwise when it opens next.
+func maintenanceWindowOpen(window rkev1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("parsing schedule %q: %w", window.Schedule, err)
+	}
+	location := time.UTC
+	if window.TimeZone != "" {
+		if location, err = time.LoadLocation(window.TimeZone); err != nil {
+			return false, time.Time{}, fmt.Errorf("loading time zone %q: %w", window.TimeZone, err)
+		}
+	}
+	if window.Duration.Duration <= 0 {
+		return false, time.Time{}, errors.New("duration must be positive")
+	}
+
+	// The window is open if it started within its duration before now.
+	start := schedule.Next(now.In(location).Add(-window.Duration.Duration))
+	if start.IsZero() {
+		return false, time.Time{}, nil
+	}
+	if !start.After(now) {
+		return true, time.Time{}, nil
+	}
+	return false, start, nil
+}
+
+// hold returns whether the disruptive change must be held, and records it if so.
+func (w *maintenanceWindow) hold(change string) bool {
+	if w == nil || !w.closed {
+		return false
+	}
+	for _, held := range w.held {
+		if held == change {
+			return true
+		}
+	}
+	w.held = append(w.held, change)
+	return true
+}
+
+// holdRollout returns whether the disruptive plan change must be held, and records it if so. Plan changes are never
+// held while a rollout started within a window is in progress, so that the rollout completes.
+func (w *maintenanceWindow) holdRollout(change string) bool {
+	if w != nil && w.rollingOut {
+		return false
+	}
+	return w.hold(change)
+}
+
+// startRollout records that a disruptive plan change is rolled out while the window is open or a rollout is in progress.
+func (w *maintenanceWindow) startRollout() {
+	if w != nil && (!w.closed || w.rollingOut) {
+		w.started = true
+	}
+}
+
+// done sets the MaintenanceWindowRollout and WaitingForMaintenanceWindow conditions of the control plane. The rollout
+// is in progress from the reconciliation disruptive plan changes were rolled out in until a reconciliation succeeds.
+// If disruptive changes were held, it returns an errWaiting that re-enqueues the control plane once the next window
+// opens, unless err is an actual error.
+func (w *maintenanceWindow) done(status *rkev1.RKEControlPlaneStatus, err error) error {
+	if w != nil && w.started {
+		capr.MaintenanceWindowRollout.True(status)
+	} else if (w == nil || err == nil) && capr.MaintenanceWindowRollout.GetStatus(status) != "" {
+		capr.MaintenanceWindowRollout.False(status)
+	}
+
+	if w == nil || len(w.held) == 0 {
+		if capr.WaitingForMaintenanceWindow.GetStatus(status) != "" {
+			capr.WaitingForMaintenanceWindow.False(status)
+			capr.WaitingForMaintenanceWindow.Message(status, "")
+			capr.WaitingForMaintenanceWindow.Reason(status, "")
+		}
+		return err
+	}
+
+	message := WaitingMaintenanceWindowMessage + " to roll out " + strings.Join(w.held, ", ")
+	if !w.next.IsZero() {
+		message += " at " + w.next.UTC().Format(time.RFC3339)
+	}
+	capr.WaitingForMaintenanceWindow.True(status)
+	capr.WaitingForMaintenanceWindow.Message(status, message)
+	capr.WaitingForMaintenanceWindow.Reason(status, "Waiting")
+
+	if err != nil && !IsErrWaiting(err) {
+		return err
+	}
+	if err != nil {
+		message = err.Error()
+	}
+	return errWaitingForMaintenanceWindow{errWaiting: errWaiting(message), next: w.next, waiting: err}
+}
+
+// errWaitingForMaintenanceWindow is an errWaiting for the next maintenance window to open. It wraps the error the
+// control plane was already waiting for, if any.
+type errWaitingForMaintenanceWindow struct {
+	errWaiting
+	next    time.Time
+	waiting error
+}
+
+func (e errWaitingForMaintenanceWindow) Unwrap() []error {
+	if e.waiting == nil {
+		return []error{e.errWaiting}
+	}
+	return []error{e.errWaiting, e.waiting}
+}
+
+// NextMaintenanceWindow returns when the next maintenance window opens if err is waiting for it, so that the control
+// plane can be re-enqueued then.
+func NextMaintenanceWindow(err error) (time.Time, bool) {
+	var waiting errWaitingForMaintenanceWindow
+	if !errors.As(err, &waiting) || waiting.next.IsZero() {
+		return time.Time{}, false
+	}
+	return waiting.next, true
+}
@@ -0,0 +1,192 @@
+package planner
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewMaintenanceWindow(t *testing.T) {
+	// Saturdays from 2 AM to 6 AM in Berlin, which is UTC+2 in June.
+	saturdays := rkev1.MaintenanceWindow{
+		Schedule: "0 2 * * 6",
+		TimeZone: "Europe/Berlin",
+		Duration: metav1.Duration{Duration: 4 * time.Hour},
+	}
+	nextSaturday := time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		windows *rkev1.MaintenanceWindows
+		now     time.Time
+		closed  bool
+		next    time.Time
+		wantErr bool
+	}{
+		{
+			name: "no windows",
+			now:  time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "open",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{saturdays}},
+			now:     time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "closed before start",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{saturdays}},
+			now:     time.Date(2024, 6, 1, 23, 59, 0, 0, time.UTC).AddDate(0, 0, -1),
+			closed:  true,
+			next:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "closed after duration",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{saturdays}},
+			now:     time.Date(2024, 6, 1, 4, 0, 0, 0, time.UTC),
+			closed:  true,
+			next:    nextSaturday,
+		},
+		{
+			name: "earliest next window",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{
+				saturdays,
+				{Schedule: "0 22 * * 3", Duration: metav1.Duration{Duration: time.Hour}},
+			}},
+			now:    time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+			closed: true,
+			next:   time.Date(2024, 6, 5, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "override",
+			windows: &rkev1.MaintenanceWindows{
+				Windows:       []rkev1.MaintenanceWindow{saturdays},
+				OverrideUntil: &metav1.Time{Time: time.Date(2024, 6, 4, 0, 0, 0, 0, time.UTC)},
+			},
+			now:  time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+			next: nextSaturday,
+		},
+		{
+			name: "expired override",
+			windows: &rkev1.MaintenanceWindows{
+				Windows:       []rkev1.MaintenanceWindow{saturdays},
+				OverrideUntil: &metav1.Time{Time: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+			},
+			now:    time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+			closed: true,
+			next:   nextSaturday,
+		},
+		{
+			name:    "invalid schedule",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{{Schedule: "invalid", Duration: saturdays.Duration}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid time zone",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{{Schedule: saturdays.Schedule, TimeZone: "Invalid/Zone", Duration: saturdays.Duration}}},
+			wantErr: true,
+		},
+		{
+			name:    "missing duration",
+			windows: &rkev1.MaintenanceWindows{Windows: []rkev1.MaintenanceWindow{{Schedule: saturdays.Schedule}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &rkev1.RKEControlPlane{Spec: rkev1.RKEControlPlaneSpec{MaintenanceWindows: tt.windows}}
+			w, err := newMaintenanceWindow(cp, &rkev1.RKEControlPlaneStatus{}, tt.now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.windows == nil {
+				assert.Nil(t, w)
+				return
+			}
+			require.NotNil(t, w)
+			assert.Equal(t, tt.closed, w.closed)
+			assert.True(t, tt.next.Equal(w.next), "expected next window at %v, got %v", tt.next, w.next)
+		})
+	}
+}
+
+func TestMaintenanceWindowDone(t *testing.T) {
+	next := time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+	status := &rkev1.RKEControlPlaneStatus{}
+
+	var open *maintenanceWindow
+	assert.False(t, open.hold("certificate rotation"))
+	assert.NoError(t, open.done(status, nil))
+	assert.Equal(t, "", capr.WaitingForMaintenanceWindow.GetStatus(status))
+
+	w := &maintenanceWindow{closed: true, next: next}
+	assert.True(t, w.hold("certificate rotation"))
+	assert.True(t, w.hold("certificate rotation"))
+	assert.Equal(t, []string{"certificate rotation"}, w.held)
+
+	err := w.done(status, nil)
+	assert.True(t, IsErrWaiting(err))
+	waitUntil, ok := NextMaintenanceWindow(err)
+	assert.True(t, ok)
+	assert.Equal(t, next, waitUntil)
+	assert.Equal(t, string(corev1.ConditionTrue), capr.WaitingForMaintenanceWindow.GetStatus(status))
+	assert.Equal(t, "waiting for maintenance window to roll out certificate rotation at 2024-06-08T00:00:00Z", capr.WaitingForMaintenanceWindow.GetMessage(status))
+
+	// Actual errors take precedence over waiting for the window.
+	failed := errors.New("failed")
+	assert.Equal(t, failed, w.done(status, failed))
+
+	assert.NoError(t, (&maintenanceWindow{}).done(status, nil))
+	assert.Equal(t, string(corev1.ConditionFalse), capr.WaitingForMaintenanceWindow.GetStatus(status))
+	assert.Equal(t, "", capr.WaitingForMaintenanceWindow.GetMessage(status))
+}
+
+func TestMaintenanceWindowRollout(t *testing.T) {
+	// Saturdays from 2 AM to 6 AM UTC.
+	cp := &rkev1.RKEControlPlane{Spec: rkev1.RKEControlPlaneSpec{MaintenanceWindows: &rkev1.MaintenanceWindows{
+		Windows: []rkev1.MaintenanceWindow{{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}}},
+	}}}
+	inWindow := time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+	afterWindow := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+	status := &rkev1.RKEControlPlaneStatus{}
+
+	// A rollout started within the window is in progress until a reconciliation succeeds.
+	w, err := newMaintenanceWindow(cp, status, inWindow)
+	require.NoError(t, err)
+	assert.False(t, w.holdRollout("worker plan changes"))
+	w.startRollout()
+	waiting := errWaiting("waiting for plans")
+	assert.Equal(t, waiting, w.done(status, waiting))
+	assert.True(t, capr.MaintenanceWindowRollout.IsTrue(status))
+
+	// The rollout isn't held once the window closed, but rotations are.
+	w, err = newMaintenanceWindow(cp, status, afterWindow)
+	require.NoError(t, err)
+	assert.False(t, w.holdRollout("worker plan changes"))
+	assert.True(t, w.hold("certificate rotation"))
+	w.startRollout()
+	err = w.done(status, waiting)
+	assert.True(t, errors.Is(err, waiting), "expected the held changes to wrap the error the control plane was waiting for")
+	assert.True(t, capr.MaintenanceWindowRollout.IsTrue(status))
+
+	w, err = newMaintenanceWindow(cp, status, afterWindow)
+	require.NoError(t, err)
+	assert.NoError(t, w.done(status, nil))
+	assert.True(t, capr.MaintenanceWindowRollout.IsFalse(status))
+
+	// New rollouts are held once the rollout completed.
+	w, err = newMaintenanceWindow(cp, status, afterWindow)
+	require.NoError(t, err)
+	assert.True(t, w.holdRollout("worker plan changes"))
+	w.startRollout()
+	assert.True(t, IsErrWaiting(w.done(status, nil)))
+	assert.True(t, capr.MaintenanceWindowRollout.IsFalse(status))
+}
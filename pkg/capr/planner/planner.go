@@ -12,6 +12,7 @@
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/moby/locker"
@@ -137,6 +138,10 @@ type InfoFunctions struct {
 	SystemAgentImage        func() string
 	SystemPodLabelSelectors func(plane *rkev1.RKEControlPlane) []string
 	GetBootstrapManifests   func(plane *rkev1.RKEControlPlane) ([]plan.File, error)
+	// EtcdSnapshotTestRestoreImage returns the image containing etcdutl that is used to test restore etcd snapshots.
+	EtcdSnapshotTestRestoreImage func() string
+	// AgentImage returns the image of the agent, which encrypts and decrypts etcd snapshots on the nodes.
+	AgentImage func() string
 }
 
 func New(ctx context.Context, clients *wrangler.Context, functions InfoFunctions) *Planner {
@@ -225,6 +230,19 @@ func (p *Planner) Process(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlan
 		return status, fmt.Errorf("rkecluster %s/%s: error semver parsing kubernetes version %s: %v", cp.Namespace, cp.Name, cp.Spec.KubernetesVersion, err)
 	}
 
+	window, err := newMaintenanceWindow(cp, &status, time.Now())
+	if err != nil {
+		return status, fmt.Errorf("rkecluster %s/%s: %w", cp.Namespace, cp.Name, err)
+	}
+
+	// The maintenance window conditions are set whatever step the reconciliation stopped at, so that the held changes
+	// are reported and the control plane is re-enqueued once the next window opens.
+	status, err = p.process(cp, status, currentVersion, window)
+	return status, window.done(&status, err)
+}
+
+// process reconciles the control plane, holding disruptive changes if the maintenance window is closed.
+func (p *Planner) process(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, currentVersion *semver.Version, window *maintenanceWindow) (rkev1.RKEControlPlaneStatus, error) {
 	releaseData := p.retrievalFunctions.ReleaseData(p.ctx, cp)
 	if releaseData == nil {
 		return status, errWaitingf("%s/%s: KDM release data is empty for %s", cp.Namespace, cp.Name, cp.Spec.KubernetesVersion)
@@ -314,11 +332,20 @@ func (p *Planner) Process(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlan
 		return status, err
 	}
 
-	if status, err = p.rotateCertificates(cp, status, clusterSecretTokens, plan); err != nil {
+	if status, err = p.testRestoreEtcdSnapshot(cp, status, clusterSecretTokens, plan); err != nil {
+		return status, err
+	}
+
+	// certificate and encryption key rotations that were already started are completed outside of maintenance windows
+	if shouldRotate(cp) && !capiannotations.IsPaused(capiCluster, cp) && window.hold("certificate rotation") {
+		logrus.Infof("[planner] rkecluster %s/%s: holding certificate rotation until the next maintenance window", cp.Namespace, cp.Name)
+	} else if status, err = p.rotateCertificates(cp, status, clusterSecretTokens, plan); err != nil {
 		return status, err
 	}
 
-	if status, err = p.rotateEncryptionKeys(cp, status, clusterSecretTokens, plan, releaseData); err != nil {
+	if cp.Spec.RotateEncryptionKeys != nil && canRotateEncryptionKeys(cp) && shouldRestartEncryptionKeyRotation(cp) && window.hold("encryption key rotation") {
+		logrus.Infof("[planner] rkecluster %s/%s: holding encryption key rotation until the next maintenance window", cp.Namespace, cp.Name)
+	} else if status, err = p.rotateEncryptionKeys(cp, status, clusterSecretTokens, plan, releaseData); err != nil {
 		return status, err
 	}
 
@@ -337,10 +364,14 @@ func (p *Planner) Process(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlan
 		return status, errWaiting("rkecontrolplane was already initialized but no etcd machines exist that have plans, indicating the etcd plane has been entirely replaced. Restoration from etcd snapshot is required.")
 	}
 
-	return p.fullReconcile(cp, status, clusterSecretTokens, plan, false)
+	gates := p.newHealthGates(cp, plan)
+	status, err = p.fullReconcile(cp, status, clusterSecretTokens, plan, false, window, gates)
+	return status, gates.done(&status, err)
 }
 
-func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, clusterSecretTokens plan.Secret, plan *plan.Plan, ignoreDrainAndConcurrency bool) (rkev1.RKEControlPlaneStatus, error) {
+// fullReconcile reconciles the plans of all machines of the control plane, holding disruptive plan changes until the
+// maintenance window opens if window is closed, and while any of the health gates fails.
+func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, clusterSecretTokens plan.Secret, plan *plan.Plan, ignoreDrainAndConcurrency bool, window *maintenanceWindow, gates *healthGates) (rkev1.RKEControlPlaneStatus, error) {
 	// on the first run through, electInitNode will return a `generic.ErrSkip` as it is attempting to wait for the cache to catch up.
 	joinServer, err := p.electInitNode(cp, plan, true)
 	if err != nil {
@@ -363,7 +394,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 	// select all etcd and then filter to just initNodes so that unavailable count is correct
 	err = p.reconcile(cp, clusterSecretTokens, plan, true, bootstrapTier, isEtcd, isNotInitNodeOrIsDeleting,
 		"1", "", controlPlaneDrainOptions, -1, 1,
-		false, true)
+		false, true, window, gates)
 	capr.Bootstrapped.True(&status)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
@@ -384,7 +415,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 	// Process all nodes that have the etcd role and are NOT an init node or deleting. Only process 1 node at a time.
 	err = p.reconcile(cp, clusterSecretTokens, plan, true, etcdTier, isEtcd, isInitNodeOrDeleting,
 		"1", joinServer, controlPlaneDrainOptions,
-		-1, 1, false, true)
+		-1, 1, false, true, window, gates)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
@@ -393,7 +424,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 	// Process all nodes that have the controlplane role and are NOT an init node or deleting.
 	err = p.reconcile(cp, clusterSecretTokens, plan, true, controlPlaneTier, isControlPlane, isInitNodeOrDeleting,
 		controlPlaneConcurrency, joinServer, controlPlaneDrainOptions, -1, 1,
-		false, true)
+		false, true, window, gates)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
@@ -413,7 +444,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 	// Process all nodes that are ONLY linux worker nodes.
 	err = p.reconcile(cp, clusterSecretTokens, plan, false, workerTier, isOnlyLinuxWorker, isInitNodeOrDeleting,
 		workerConcurrency, "", workerDrainOptions, -1, 1,
-		false, true)
+		false, true, window, gates)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
@@ -438,7 +469,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 
 	err = p.reconcile(cp, clusterSecretTokens, plan, false, workerTier, isOnlyWindowsWorker, isInitNodeOrDeleting,
 		workerConcurrency, "", workerDrainOptions, windowsMaxFailures,
-		windowsMaxFailureThreshold, resetFailureCountOnRestart, false)
+		windowsMaxFailureThreshold, resetFailureCountOnRestart, false, window, gates)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
@@ -550,6 +581,12 @@ func isInDrain(entry *planEntry) bool {
 		entry.Metadata.Annotations[capr.UnCordonAnnotation] != ""
 }
 
+// isDisrupted returns a boolean indicating whether the machine/node corresponding to the planEntry is already disrupted
+// by a major plan change, meaning it is being drained, its plan failed, or its probes never went healthy.
+func isDisrupted(entry *planEntry) bool {
+	return isInDrain(entry) || entry.Plan.Failed || planAppliedButProbesNeverHealthy(entry)
+}
+
 // planAppliedButWaitingForProbes returns a boolean indicating whether a plan was successfully able to be applied, but
 // the probes have not been successful. This indicates that while the overall plan hasn't completed yet, it's
 // instructions have and can now be overridden if necessary without causing thrashing.
@@ -857,10 +894,10 @@ type reconcilable struct {
 
 func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret, clusterPlan *plan.Plan, required bool, tierName string,
 	include, exclude roleFilter, maxUnavailable, forcedJoinURL string, drainOptions rkev1.DrainOptions,
-	maxFailures, failureThreshold int, resetFailureCountOnSystemAgentRestart, overwriteFailureValues bool) error {
+	maxFailures, failureThreshold int, resetFailureCountOnSystemAgentRestart, overwriteFailureValues bool, window *maintenanceWindow, gates *healthGates) error {
 	var (
-		ready, outOfSync, nonReady, errMachines, draining, uncordoned []string
-		messages                                                      = map[string][]string{}
+		ready, outOfSync, nonReady, errMachines, draining, uncordoned, held, paused []string
+		messages                                                                    = map[string][]string{}
 	)
 
 	entries := collect(clusterPlan, include)
@@ -939,9 +976,18 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret pl
 			if err := p.store.UpdatePlan(r.entry, r.desiredPlan, r.joinedURL, maxFailures, failureThreshold, overwriteFailureValues); err != nil {
 				return err
 			}
+		} else if r.change && holdPlanChange(r, window, tierName) {
+			logrus.Debugf("[planner] rkecluster %s/%s reconcile tier %s - holding major plan change for machine %s/%s until the next maintenance window", controlPlane.Namespace, controlPlane.Name, tierName, r.entry.Machine.Namespace, r.entry.Machine.Name)
+			held = append(held, r.entry.Machine.Name)
+			messages[r.entry.Machine.Name] = append(messages[r.entry.Machine.Name], WaitingMaintenanceWindowMessage)
+		} else if failure := pauseRollout(r, gates, concurrency, unavailable); failure != nil {
+			logrus.Infof("[planner] rkecluster %s/%s reconcile tier %s - pausing major plan change for machine %s/%s as a health gate failed: %v", controlPlane.Namespace, controlPlane.Name, tierName, r.entry.Machine.Namespace, r.entry.Machine.Name, failure)
+			paused = append(paused, r.entry.Machine.Name)
+			messages[r.entry.Machine.Name] = append(messages[r.entry.Machine.Name], UpgradePausedMessage+": "+failure.Error())
 		} else if r.change {
 			logrus.Debugf("[planner] rkecluster %s/%s reconcile tier %s - plan for machine %s/%s did not match, appending to outOfSync", controlPlane.Namespace, controlPlane.Name, tierName, r.entry.Machine.Namespace, r.entry.Machine.Name)
 			outOfSync = append(outOfSync, r.entry.Machine.Name)
+			window.startRollout()
 			// Conditions
 			// 1. If the node is already draining then the plan is out of sync.  There is no harm in updating it if
 			// the node is currently drained.
@@ -1027,6 +1073,15 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret pl
 		firstError = err
 	}
 
+	if err := p.setMachineConditionStatus(clusterPlan, paused, fmt.Sprintf("pausing upgrade of %s node(s) ", tierName), messages); err != nil && firstError == nil {
+		firstError = err
+	}
+
+	// Machines holding disruptive plan changes must not block the reconciliation of the other tiers.
+	if err := p.setMachineConditionStatus(clusterPlan, held, "", messages); err != nil && !IsErrWaiting(err) && firstError == nil {
+		firstError = err
+	}
+
 	// Ensure that the conditions that we control are updated.
 	if err := p.setMachineConditionStatus(clusterPlan, ready, "", nil); err != nil && firstError == nil {
 		firstError = err
@@ -1046,9 +1101,23 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret pl
 		return errIgnore("non-ready " + tierName + " machine(s) " + atMostThree(nonReady) + detailedMessage(nonReady, messages))
 	}
 
+	if len(held) > 0 {
+		return errIgnore(WaitingMaintenanceWindowMessage + " to configure " + tierName + " machine(s) " + atMostThree(held))
+	}
+
 	return nil
 }
 
+// holdPlanChange returns whether the major plan change of the machine must be held until the maintenance window opens.
+// Changes to machines that are already being drained, or whose plan failed, are never held since the machines are
+// already disrupted.
+func holdPlanChange(r *reconcilable, window *maintenanceWindow, tierName string) bool {
+	if isDisrupted(r.entry) {
+		return false
+	}
+	return window.holdRollout(tierName + " plan changes")
+}
+
 // generatePlanWithConfigFiles will generate a node plan with the corresponding config files for the entry in question.
 // Notably, it will discard the existing nodePlan in the given entry. It returns the new node plan, the config that was
 // rendered, the rendered join server ("-" in the case that the plan is generated for an init node), and an error (if one exists).
@@ -1153,12 +1222,20 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, tokensSecret
 		if err != nil {
 			return nodePlan, joinedTo, err
 		}
-		if controlPlane != nil && controlPlane.Spec.ETCD != nil && S3Enabled(controlPlane.Spec.ETCD.S3) && isInitNode(entry) {
+		nodePlan, err = p.addEtcdSnapshotChecksumLocalPeriodicInstruction(nodePlan, controlPlane)
+		if err != nil {
+			return nodePlan, joinedTo, err
+		}
+		if controlPlane != nil && controlPlane.Spec.ETCD != nil && S3Enabled(controlPlane.Spec.ETCD.S3) && !SnapshotEncryptionEnabled(controlPlane) && isInitNode(entry) {
 			nodePlan, err = p.addEtcdSnapshotListS3PeriodicInstruction(nodePlan, controlPlane)
 			if err != nil {
 				return nodePlan, joinedTo, err
 			}
 		}
+		nodePlan, err = p.addEtcdSnapshotEncryptUploadPeriodicInstruction(nodePlan, controlPlane, entry)
+		if err != nil {
+			return nodePlan, joinedTo, err
+		}
 	}
 	return nodePlan, joinedTo, nil
 }
@@ -1,10 +1,16 @@
 package planner
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"path"
 	"strings"
 
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
 	"github.com/rancher/rancher/pkg/controllers/capr/machineprovision"
@@ -89,6 +95,9 @@ func (s *s3Args) ToArgs(s3 *rkev1.ETCDSnapshotS3, controlPlane *rkev1.RKEControl
 	if s3.SkipSSLVerify || s3Cred.SkipSSLVerify {
 		args = append(args, fmt.Sprintf("--%ss3-skip-ssl-verify", prefix))
 	}
+	if s3.Insecure {
+		args = append(args, fmt.Sprintf("--%ss3-insecure", prefix))
+	}
 	if v := first(s3.EndpointCA, s3Cred.EndpointCA); v != "" {
 		// An etcd s3 snapshot object may have its endpoint CA be the filepath that was used to create the snapshot.
 		// If this is the case, search the corresponding cloud credential and controlplane S3 spec for the actual CA data,
@@ -147,6 +156,133 @@ func generateEndpointCAFileIfPathMatches(controlPlane *rkev1.RKEControlPlane, ex
 	return nil
 }
 
+// S3Client is a client of an S3 compatible target of etcd snapshots.
+type S3Client struct {
+	Client *minio.Client
+	Bucket string
+	Folder string
+	// EndpointCA is the base64 encoded CA of the S3 endpoint, if any.
+	EndpointCA    string
+	SkipSSLVerify bool
+	Insecure      bool
+}
+
+// S3Object is an etcd snapshot stored in S3, along with a client to access it.
+type S3Object struct {
+	*S3Client
+	Key string
+}
+
+// GetS3Object returns the S3 object of an etcd snapshot stored in S3. Like ToArgs, settings that are not recorded on the
+// snapshot are taken from its cloud credential, or the cloud credential of the etcd S3 configuration of the control
+// plane.
+func GetS3Object(secretCache corecontrollers.SecretCache, snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane) (*S3Object, error) {
+	if snapshot.SnapshotFile.S3 == nil {
+		return nil, fmt.Errorf("etcd snapshot %s/%s is not stored in S3", snapshot.Namespace, snapshot.Name)
+	}
+	var defaults *rkev1.ETCDSnapshotS3
+	if controlPlane.Spec.ETCD != nil {
+		defaults = controlPlane.Spec.ETCD.S3
+	}
+	client, err := NewS3Client(secretCache, controlPlane.Namespace, snapshot.SnapshotFile.S3, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+	}
+	return &S3Object{
+		S3Client: client,
+		Key:      path.Join(client.Folder, snapshot.SnapshotFile.Name),
+	}, nil
+}
+
+// GetS3TargetObject returns the S3 object of the copy of an etcd snapshot in one of the additional targets of the etcd
+// configuration of the control plane. The copies of the snapshots of a cluster are stored in the folder of the target,
+// under the namespace and name of the cluster.
+func GetS3TargetObject(secretCache corecontrollers.SecretCache, snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane, target rkev1.ETCDSnapshotTarget) (*S3Object, error) {
+	client, err := NewS3Client(secretCache, controlPlane.Namespace, target.S3, nil)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %w", target.Name, err)
+	}
+	return &S3Object{
+		S3Client: client,
+		Key:      path.Join(S3TargetFolder(client.Folder, snapshot.Namespace, snapshot.Spec.ClusterName), snapshot.SnapshotFile.Name),
+	}, nil
+}
+
+// S3TargetFolder returns the folder of an additional target the copies of the etcd snapshots of a cluster are stored in.
+func S3TargetFolder(folder, namespace, clusterName string) string {
+	return path.Join(folder, namespace, clusterName)
+}
+
+// NewS3Client returns a client of an S3 compatible target of etcd snapshots. Settings that are not set on the target
+// are taken from its cloud credential. If the target has no cloud credential, or has the path of a CA file as
+// endpoint CA, the cloud credential and endpoint CA of defaults are used.
+func NewS3Client(secretCache corecontrollers.SecretCache, namespace string, s3 *rkev1.ETCDSnapshotS3, defaults *rkev1.ETCDSnapshotS3) (*S3Client, error) {
+	if defaults == nil {
+		defaults = &rkev1.ETCDSnapshotS3{}
+	}
+
+	s3Cred, err := getS3Credential(secretCache, namespace, first(s3.CloudCredentialName, defaults.CloudCredentialName))
+	if err != nil {
+		return nil, err
+	}
+
+	client := &S3Client{
+		Bucket:        first(s3.Bucket, s3Cred.Bucket),
+		Folder:        first(s3.Folder, s3Cred.Folder),
+		EndpointCA:    first(s3.EndpointCA, s3Cred.EndpointCA),
+		SkipSSLVerify: s3.SkipSSLVerify || s3Cred.SkipSSLVerify,
+		Insecure:      s3.Insecure,
+	}
+	if client.EndpointCA == s3.EndpointCA && strings.HasSuffix(client.EndpointCA, ".crt") {
+		// the endpoint CA is the path of the file that was used to create the snapshot, use the actual CA data
+		client.EndpointCA = first(s3Cred.EndpointCA, defaults.EndpointCA)
+	}
+	if client.EndpointCA != "" {
+		if _, err := base64.StdEncoding.DecodeString(client.EndpointCA); err != nil {
+			// There was an error decoding the endpointCA, indicating that it needs to be encoded.
+			client.EndpointCA = base64.StdEncoding.EncodeToString([]byte(client.EndpointCA))
+		}
+	}
+
+	endpoint := first(first(s3.Endpoint, s3Cred.Endpoint), "s3.amazonaws.com")
+
+	// no access credentials, we assume IAM roles
+	creds := credentials.NewIAM("")
+	if s3Cred.AccessKey != "" && s3Cred.SecretKey != "" {
+		creds = credentials.NewStaticV4(s3Cred.AccessKey, s3Cred.SecretKey, "")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: client.SkipSSLVerify,
+	}
+	if client.EndpointCA != "" {
+		ca, err := base64.StdEncoding.DecodeString(client.EndpointCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse CA of S3 endpoint %s", endpoint)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if strings.Contains(endpoint, "aliyun") {
+		bucketLookup = minio.BucketLookupDNS
+	}
+
+	client.Client, err = minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Region:       first(s3.Region, s3Cred.Region),
+		Secure:       !client.Insecure,
+		BucketLookup: bucketLookup,
+		Transport:    transport,
+	})
+	return client, err
+}
+
 type s3Credential struct {
 	AccessKey     string
 	SecretKey     string
@@ -0,0 +1,57 @@
+package snapshotcrypt
+
+import (
+	"time"
+)
+
+// User metadata of encrypted etcd snapshots in S3. The keys are canonicalized, as returned by S3 clients.
+const (
+	ClusterMetadataKey   = "Rancher-Cluster"
+	NodeMetadataKey      = "Rancher-Node"
+	CreatedAtMetadataKey = "Rancher-Snapshot-Created-At"
+	KeyIDMetadataKey     = "Rancher-Encryption-Key-Id"
+)
+
+// Snapshot is an encrypted etcd snapshot stored in S3, as listed by the agent after uploading the snapshots of a node.
+type Snapshot struct {
+	// Name is the name of the object in the folder of the S3 target, it ends with Extension.
+	Name string `json:"name"`
+	// Location is the URL of the object, e.g. s3://bucket/folder/name.
+	Location  string    `json:"location"`
+	NodeName  string    `json:"nodeName"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	KeyID     string    `json:"keyID"`
+	// Checksum is the SHA-256 checksum of the object. It is only known for the snapshots the agent just uploaded.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Metadata returns the user metadata of the S3 object of the snapshot of the cluster.
+func (s Snapshot) Metadata(cluster string) map[string]string {
+	return map[string]string{
+		ClusterMetadataKey:   cluster,
+		NodeMetadataKey:      s.NodeName,
+		CreatedAtMetadataKey: s.CreatedAt.UTC().Format(time.RFC3339),
+		KeyIDMetadataKey:     s.KeyID,
+	}
+}
+
+// SnapshotFromMetadata returns the snapshot of the S3 object with the given name, location, size and user metadata, and
+// whether the object is an encrypted snapshot of the cluster.
+func SnapshotFromMetadata(name, location string, size int64, lastModified time.Time, metadata map[string]string, cluster string) (Snapshot, bool) {
+	if metadata[ClusterMetadataKey] != cluster || metadata[KeyIDMetadataKey] == "" {
+		return Snapshot{}, false
+	}
+	createdAt, err := time.Parse(time.RFC3339, metadata[CreatedAtMetadataKey])
+	if err != nil {
+		createdAt = lastModified
+	}
+	return Snapshot{
+		Name:      name,
+		Location:  location,
+		NodeName:  metadata[NodeMetadataKey],
+		Size:      size,
+		CreatedAt: createdAt,
+		KeyID:     metadata[KeyIDMetadataKey],
+	}, true
+}
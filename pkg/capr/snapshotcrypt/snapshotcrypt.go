@@ -0,0 +1,338 @@
+// Package snapshotcrypt encrypts etcd snapshots with AES-256-GCM before they are uploaded to S3.
+//
+// An encrypted snapshot starts with a header made of a magic, the ID of the key it is encrypted with and a random nonce.
+// The snapshot is then split into chunks that are sealed individually, so that snapshots can be encrypted and decrypted
+// as streams. The nonce of a chunk is derived from the nonce of the header and the index of the chunk, and the header
+// and whether the chunk is the final one are authenticated along with it, so that chunks can't be reordered, and the
+// snapshot can't be truncated without being detected.
+package snapshotcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// Algorithm is the algorithm etcd snapshots are encrypted with.
+	Algorithm = "aes-256-gcm"
+	// Extension is appended to the name of encrypted etcd snapshots.
+	Extension = ".enc"
+	// KeySize is the size of keys in bytes.
+	KeySize = 32
+
+	magic     = "RKESNAP\x01"
+	keyIDSize = 8
+	nonceSize = 12
+	// headerSize is the size of the header: the magic, the key ID and the nonce.
+	headerSize = len(magic) + keyIDSize + nonceSize
+	// chunkSize is the maximum size of the plaintext of a chunk.
+	chunkSize = 64 * 1024
+	// chunkOverhead is the size a chunk adds to its plaintext: the flags, the size of its ciphertext and the GCM tag.
+	chunkOverhead = 1 + 4 + 16
+
+	chunkFinal byte = 1
+)
+
+var (
+	// ErrNotEncrypted is returned when decrypting data that is not an encrypted etcd snapshot.
+	ErrNotEncrypted = errors.New("not an encrypted etcd snapshot")
+	// ErrTruncated is returned when an encrypted etcd snapshot ends before its final chunk.
+	ErrTruncated = errors.New("encrypted etcd snapshot is truncated")
+)
+
+// UnknownKeyError is returned when an etcd snapshot is encrypted with a key that is not available.
+type UnknownKeyError struct {
+	KeyID string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("etcd snapshot is encrypted with unknown key %s", e.KeyID)
+}
+
+// ParseKey parses a key that is either made of KeySize raw bytes or base64 encoded.
+func ParseKey(data []byte) ([]byte, error) {
+	if len(data) == KeySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key is neither %d bytes nor base64 encoded: %w", KeySize, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// ParseKeyFile parses a key file holding one base64 encoded key per line. The first key is the one snapshots are
+// encrypted with, the others are only used to decrypt snapshots.
+func ParseKeyFile(data []byte) ([][]byte, error) {
+	var keys [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, err := ParseKey([]byte(line))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key file holds no keys")
+	}
+	return keys, scanner.Err()
+}
+
+// KeyFile returns the content of a key file holding the given keys, see ParseKeyFile.
+func KeyFile(keys [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(base64.StdEncoding.EncodeToString(key))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// KeyID returns the ID of a key, which is recorded in the header of the snapshots encrypted with it. The ID doesn't
+// disclose the key.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:keyIDSize])
+}
+
+// EncryptedSize returns the size of an etcd snapshot of the given size once encrypted.
+func EncryptedSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		// the final chunk is written even if empty
+		chunks = 1
+	}
+	return int64(headerSize) + size + chunks*chunkOverhead
+}
+
+// ReadKeyID returns the ID of the key an encrypted etcd snapshot is encrypted with.
+func ReadKeyID(r io.Reader) (string, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(header[len(magic) : len(magic)+keyIDSize]), nil
+}
+
+func readHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, ErrNotEncrypted
+	} else if err != nil {
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+	return header, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of the chunk with the given index.
+func chunkNonce(header []byte, index uint64) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, header[len(magic)+keyIDSize:])
+	counter := binary.BigEndian.Uint64(nonce[nonceSize-8:]) ^ index
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], counter)
+	return nonce
+}
+
+// chunkAdditionalData returns the data that is authenticated along with a chunk.
+func chunkAdditionalData(header []byte, flags byte) []byte {
+	return append(append([]byte{}, header...), flags)
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint64
+	closed bool
+}
+
+// NewWriter returns a writer encrypting an etcd snapshot with the key to w. The writer must be closed to write the final
+// chunk, closing it does not close w.
+func NewWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	id, _ := hex.DecodeString(KeyID(key))
+	header = append(header, id...)
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypted etcd snapshot")
+	}
+	written := 0
+	for len(p) > 0 {
+		// the buffered chunk is only sealed once more data follows, as the final chunk must be flagged
+		if len(w.buf) == chunkSize {
+			if err := w.seal(0); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(chunkFinal)
+}
+
+// seal writes the buffered plaintext as a chunk. A chunk is made of its flags, the size of its ciphertext and the
+// ciphertext.
+func (w *writer) seal(flags byte) error {
+	ciphertext := w.aead.Seal(nil, chunkNonce(w.header, w.index), w.buf, chunkAdditionalData(w.header, flags))
+	prefix := make([]byte, 5)
+	prefix[0] = flags
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(ciphertext)))
+	if _, err := w.w.Write(prefix); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(ciphertext); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	w.index++
+	return nil
+}
+
+type reader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint64
+	done   bool
+}
+
+// NewReader returns a reader decrypting an encrypted etcd snapshot read from r. The snapshot is decrypted with the key
+// whose ID is recorded in its header, an UnknownKeyError is returned if none of the keys match.
+func NewReader(r io.Reader, keys [][]byte) (io.Reader, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	keyID := hex.EncodeToString(header[len(magic) : len(magic)+keyIDSize])
+	for _, key := range keys {
+		if KeyID(key) != keyID {
+			continue
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		return &reader{
+			r:      r,
+			aead:   aead,
+			header: header,
+		}, nil
+	}
+	return nil, &UnknownKeyError{KeyID: keyID}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk.
+func (r *reader) open() error {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r.r, prefix); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	} else if err != nil {
+		return err
+	}
+	flags := prefix[0]
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > chunkSize+uint32(r.aead.Overhead()) {
+		return fmt.Errorf("encrypted etcd snapshot has chunk of invalid size %d", size)
+	}
+	ciphertext := make([]byte, size)
+	if _, err := io.ReadFull(r.r, ciphertext); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	} else if err != nil {
+		return err
+	}
+	plaintext, err := r.aead.Open(nil, chunkNonce(r.header, r.index), ciphertext, chunkAdditionalData(r.header, flags))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt chunk %d of encrypted etcd snapshot: %w", r.index, err)
+	}
+	r.buf = plaintext
+	r.index++
+	if flags&chunkFinal != 0 {
+		r.done = true
+		if n, _ := r.r.Read(make([]byte, 1)); n > 0 {
+			return errors.New("encrypted etcd snapshot has data after its final chunk")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package snapshotcrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func encrypt(t *testing.T, plaintext, key []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	require.NoError(t, err)
+	_, err = w.Write(plaintext)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := newKey(t)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		ciphertext := encrypt(t, plaintext, key)
+		assert.Equal(t, EncryptedSize(int64(size)), int64(len(ciphertext)), "size %d", size)
+		if size >= 32 {
+			assert.False(t, bytes.Contains(ciphertext, plaintext[:32]), "size %d", size)
+		}
+
+		r, err := NewReader(bytes.NewReader(ciphertext), [][]byte{newKey(t), key})
+		require.NoError(t, err)
+		decrypted, err := io.ReadAll(r)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, plaintext, decrypted, "size %d", size)
+	}
+}
+
+func TestReadKeyID(t *testing.T) {
+	key := newKey(t)
+	id, err := ReadKeyID(bytes.NewReader(encrypt(t, []byte("snapshot"), key)))
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(key), id)
+
+	_, err = ReadKeyID(bytes.NewReader([]byte("plaintext etcd snapshot data")))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+}
+
+func TestUnknownKey(t *testing.T) {
+	key := newKey(t)
+	_, err := NewReader(bytes.NewReader(encrypt(t, []byte("snapshot"), key)), [][]byte{newKey(t)})
+	var unknownKey *UnknownKeyError
+	require.True(t, errors.As(err, &unknownKey))
+	assert.Equal(t, KeyID(key), unknownKey.KeyID)
+}
+
+func TestTampering(t *testing.T) {
+	key := newKey(t)
+	plaintext := bytes.Repeat([]byte("etcd"), chunkSize)
+	ciphertext := encrypt(t, plaintext, key)
+
+	decrypt := func(data []byte) error {
+		r, err := NewReader(bytes.NewReader(data), [][]byte{key})
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	modified := bytes.Clone(ciphertext)
+	modified[headerSize+100] ^= 1
+	assert.Error(t, decrypt(modified), "modified chunk must be detected")
+
+	// drop the final chunk
+	finalChunk := headerSize + 2*(5+chunkSize+16)
+	assert.ErrorIs(t, decrypt(ciphertext[:finalChunk]), ErrTruncated)
+
+	// flag the first chunk as final
+	modified = bytes.Clone(ciphertext)
+	modified[headerSize] = chunkFinal
+	assert.Error(t, decrypt(modified), "modified flags must be detected")
+
+	assert.Error(t, decrypt(append(bytes.Clone(ciphertext), 0)), "trailing data must be detected")
+}
+
+func TestParseKeyFile(t *testing.T) {
+	current, previous := newKey(t), newKey(t)
+	keys, err := ParseKeyFile(KeyFile([][]byte{current, previous}))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{current, previous}, keys)
+
+	_, err = ParseKeyFile(nil)
+	assert.Error(t, err)
+
+	_, err = ParseKey([]byte(base64.StdEncoding.EncodeToString([]byte("too short"))))
+	assert.Error(t, err)
+	key, err := ParseKey(current)
+	require.NoError(t, err)
+	assert.Equal(t, current, key)
+}
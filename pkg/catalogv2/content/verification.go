@@ -0,0 +1,216 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/catalogv2"
+	"github.com/rancher/rancher/pkg/catalogv2/git"
+	helmhttp "github.com/rancher/rancher/pkg/catalogv2/http"
+	"github.com/rancher/rancher/pkg/catalogv2/oci"
+	"github.com/rancher/rancher/pkg/catalogv2/verify"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// Verifier returns a verifier trusting the keys of the verification policy of a Helm repository.
+// It returns nil if the repository has no verification policy.
+func Verifier(secrets corecontrollers.SecretCache, repoSpec *v1.RepoSpec) (*verify.Verifier, error) {
+	if repoSpec.Verification == nil {
+		return nil, nil
+	}
+
+	ref := repoSpec.Verification.KeysSecret
+	secret, err := secrets.Get(ref.Namespace, ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the verification keys secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+	return verify.NewVerifier(secret)
+}
+
+// VerifiedChart retrieves a specific Helm chart from a Helm repository like Chart.
+//
+// If the repository has a verification policy, the chart is only returned if it is signed with one of the trusted keys:
+// charts of HTTP and git repositories must have a provenance file holding the digest of the downloaded chart archive,
+// and the manifests of charts of OCI repositories must have a cosign signature.
+func (c *Manager) VerifiedChart(namespace, name, chartName, version string, skipFilter bool) (io.ReadCloser, error) {
+	r, err := c.getRepo(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := Verifier(c.secrets, r.spec)
+	if err != nil {
+		return nil, err
+	}
+	if verifier == nil {
+		return c.Chart(namespace, name, chartName, version, skipFilter)
+	}
+
+	index, err := c.Index(namespace, name, "", skipFilter)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := index.Get(chartName, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(chart.URLs) == 0 {
+		return nil, fmt.Errorf("failed to find chartName %s version %s: %w", chartName, version, validation.NotFound)
+	}
+
+	var secret *corev1.Secret
+	if r.status.Commit == "" {
+		secret, err = catalogv2.GetSecret(c.secrets, r.spec, r.metadata.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		if registry.IsOCI(chart.URLs[0]) {
+			chartReader, err := oci.VerifiedChart(secret, chart, *r.spec, verifier)
+			if err != nil {
+				return nil, verificationError(chart, err)
+			}
+			return chartReader, nil
+		}
+	}
+
+	chartReader, err := c.Chart(namespace, name, chartName, version, skipFilter)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(chartReader)
+	chartReader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := provenance.Digest(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyProvenance(r, secret, chart, verifier, digest, r.status.Commit != ""); err != nil {
+		return nil, verificationError(chart, err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+const (
+	// verificationCacheSize is how many verification results of chart versions are cached.
+	verificationCacheSize = 10000
+	// verificationCacheTTL is how long the verification result of a chart version is cached. Results other than a
+	// successful verification are only cached for failedVerificationCacheTTL, as they may be caused by transient errors
+	// or the provenance file or signature may be published later.
+	verificationCacheTTL       = 24 * time.Hour
+	failedVerificationCacheTTL = time.Hour
+)
+
+// verificationCache caches the verification results of chart versions by the trusted keys and the digest of the chart,
+// so that refreshing the index of a repository only verifies the chart versions that were added or changed.
+var verificationCache = cache.NewLRUExpireCache(verificationCacheSize)
+
+type verificationResult struct {
+	err error
+}
+
+// AnnotateVerification verifies every chart version of the index of a Helm repository and records the results in the
+// verification status annotations of the versions. Charts of HTTP and git repositories are verified against the
+// digests of the index, so that they don't need to be downloaded. Charts of git repositories and charts without digest
+// are marked unverifiable, they are only verified when they are downloaded. If verifier is nil, the annotations are removed.
+func AnnotateVerification(index *repo.IndexFile, verifier *verify.Verifier, secret *corev1.Secret, metadata *metav1.ObjectMeta, repoSpec *v1.RepoSpec, repoStatus *v1.RepoStatus) {
+	r := repoDef{
+		metadata: metadata,
+		spec:     repoSpec,
+		status:   repoStatus,
+	}
+
+	for _, versions := range index.Entries {
+		for _, chart := range versions {
+			if chart.Metadata == nil || len(chart.URLs) == 0 {
+				continue
+			}
+			if verifier == nil {
+				verify.ClearStatus(chart.Annotations)
+				continue
+			}
+
+			var err error
+			switch {
+			case repoSpec.GitRepo != "":
+				err = fmt.Errorf("%w: charts of git repositories are verified when they are installed", verify.ErrUnverifiable)
+			case chart.Digest == "":
+				err = fmt.Errorf("%w: index has no digest for the chart", verify.ErrUnverifiable)
+			default:
+				key := verifier.ID() + "/" + repoStatus.URL + "/" + chart.URLs[0] + "@" + chart.Digest
+				err = cachedVerification(key, func() error {
+					if registry.IsOCI(chart.URLs[0]) {
+						return oci.Verify(secret, chart, *repoSpec, verifier)
+					}
+					return verifyProvenance(r, secret, chart, verifier, chart.Digest, false)
+				})
+			}
+			if err != nil {
+				logrus.Debugf("Chart %s version %s of repository %s failed verification: %v", chart.Name, chart.Version, metadata.Name, err)
+			}
+			chart.Annotations = verify.SetStatus(chart.Annotations, err)
+		}
+	}
+}
+
+// cachedVerification returns the cached verification result for the key if there is one, otherwise it verifies the chart
+// and caches the result.
+func cachedVerification(key string, verifyChart func() error) error {
+	if result, ok := verificationCache.Get(key); ok {
+		return result.(verificationResult).err
+	}
+
+	err := verifyChart()
+	ttl := verificationCacheTTL
+	if err != nil {
+		ttl = failedVerificationCacheTTL
+	}
+	verificationCache.Add(key, verificationResult{err: err}, ttl)
+	return err
+}
+
+// verifyProvenance verifies the provenance file of a chart of an HTTP or git repository against the digest of the chart archive.
+func verifyProvenance(r repoDef, secret *corev1.Secret, chart *repo.ChartVersion, verifier *verify.Verifier, digest string, gitRepo bool) error {
+	var (
+		prov []byte
+		err  error
+	)
+	if gitRepo {
+		prov, err = git.Provenance(r.metadata.Namespace, r.metadata.Name, r.status.URL, chart)
+	} else {
+		prov, err = helmhttp.Provenance(secret, r.status.URL, r.spec.CABundle, r.spec.InsecureSkipTLSverify, r.spec.DisableSameOriginCheck, chart)
+	}
+	if err != nil {
+		return err
+	}
+	return verifier.VerifyProvenance(prov, chartFileName(chart.URLs[0]), digest)
+}
+
+// chartFileName returns the name of the chart archive the chart URL points to, which is the name the provenance file holds the sum for.
+func chartFileName(chartURL string) string {
+	if u, err := url.Parse(chartURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(chartURL)
+}
+
+func verificationError(chart *repo.ChartVersion, err error) error {
+	return apierror.NewAPIError(validation.InvalidState, fmt.Sprintf("chart %s version %s failed signature verification: %v", chart.Name, chart.Version, err))
+}
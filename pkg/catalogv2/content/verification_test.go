@@ -0,0 +1,108 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/catalogv2/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"           //nolint
+	"golang.org/x/crypto/openpgp/armor"     //nolint
+	"golang.org/x/crypto/openpgp/clearsign" //nolint
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnnotateVerification(t *testing.T) {
+	const digest = "4c2ce4a8d1a8d4e6c06a3dd1e4c7bca0a2e09e0f7d6c1a24b1a5ec3f8a9b7e21"
+
+	entity, err := openpgp.NewEntity("Chart Publisher", "", "charts@example.com", nil)
+	require.NoError(t, err)
+	var publicKey bytes.Buffer
+	w, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	var prov bytes.Buffer
+	w, err = clearsign.Encode(&prov, entity.PrivateKey, nil)
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(w, "apiVersion: v2\nname: mychart\nversion: 0.1.0\n\n...\nfiles:\n  mychart-0.1.0.tgz: sha256:%s\n", digest)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/charts/mychart-0.1.0.tgz.prov", "/charts/mychart-0.2.0.tgz.prov":
+			rw.Write(prov.Bytes())
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	verifier, err := verify.NewVerifier(&corev1.Secret{Data: map[string][]byte{"pubring.asc": publicKey.Bytes()}})
+	require.NoError(t, err)
+
+	newVersion := func(version, digest string) *repo.ChartVersion {
+		return &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "mychart", Version: version},
+			URLs:     []string{"charts/mychart-" + version + ".tgz"},
+			Digest:   digest,
+		}
+	}
+	index := &repo.IndexFile{
+		Entries: map[string]repo.ChartVersions{
+			"mychart": {
+				newVersion("0.1.0", digest),
+				// The provenance file of 0.2.0 is the one of 0.1.0.
+				newVersion("0.2.0", digest),
+				newVersion("0.3.0", digest),
+				newVersion("0.4.0", ""),
+			},
+		},
+	}
+
+	spec := &v1.RepoSpec{URL: server.URL, Verification: &v1.RepoVerification{}}
+	status := &v1.RepoStatus{URL: server.URL}
+	AnnotateVerification(index, verifier, nil, &metav1.ObjectMeta{Name: "charts"}, spec, status)
+
+	versions := index.Entries["mychart"]
+	assert.Equal(t, map[string]string{verify.StatusAnnotation: verify.StatusVerified}, versions[0].Annotations)
+	assert.Equal(t, verify.StatusFailed, versions[1].Annotations[verify.StatusAnnotation])
+	assert.Equal(t, "provenance file has no sum for mychart-0.2.0.tgz", versions[1].Annotations[verify.MessageAnnotation])
+	assert.Equal(t, map[string]string{verify.StatusAnnotation: verify.StatusUnsigned}, versions[2].Annotations)
+	assert.Equal(t, verify.StatusUnverifiable, versions[3].Annotations[verify.StatusAnnotation])
+	assert.Equal(t, 3, requests)
+
+	// Verification results are cached by digest, so refreshing the index doesn't fetch the provenance files again.
+	AnnotateVerification(index, verifier, nil, &metav1.ObjectMeta{Name: "charts"}, spec, status)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, map[string]string{verify.StatusAnnotation: verify.StatusVerified}, versions[0].Annotations)
+
+	// Charts of git repositories are only verified when they are installed.
+	gitIndex := &repo.IndexFile{Entries: map[string]repo.ChartVersions{"mychart": {newVersion("0.1.0", digest)}}}
+	AnnotateVerification(gitIndex, verifier, nil, &metav1.ObjectMeta{Name: "charts"}, &v1.RepoSpec{GitRepo: "https://git.example.com/charts"}, status)
+	assert.Equal(t, verify.StatusUnverifiable, gitIndex.Entries["mychart"][0].Annotations[verify.StatusAnnotation])
+	assert.Equal(t, 3, requests)
+
+	// Removing the verification policy removes the annotations.
+	AnnotateVerification(index, nil, nil, &metav1.ObjectMeta{Name: "charts"}, &v1.RepoSpec{URL: server.URL}, status)
+	for _, version := range versions {
+		assert.Empty(t, version.Annotations)
+	}
+}
+
+func TestChartFileName(t *testing.T) {
+	assert.Equal(t, "mychart-0.1.0.tgz", chartFileName("charts/mychart-0.1.0.tgz"))
+	assert.Equal(t, "mychart-0.1.0.tgz", chartFileName("https://charts.example.com/charts/mychart-0.1.0.tgz?token=secret"))
+}
@@ -1,14 +1,17 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/rancher/rancher/pkg/catalogv2/chart"
+	"github.com/rancher/rancher/pkg/catalogv2/verify"
 	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
 	"helm.sh/helm/v3/pkg/repo"
 )
@@ -53,6 +56,27 @@ func Chart(namespace, name, gitURL string, chartVersion *repo.ChartVersion) (io.
 	return archive.Open()
 }
 
+// Provenance returns the Helm provenance file of a chartName version in a local repository, which is expected next to
+// the chart archive. It returns verify.ErrUnsigned if the repository has no provenance file for the chart.
+func Provenance(namespace, name, gitURL string, chartVersion *repo.ChartVersion) ([]byte, error) {
+	dir := RepoDir(namespace, name, gitURL)
+
+	if len(chartVersion.URLs) == 0 {
+		return nil, fmt.Errorf("failed to find chartName %s version %s: %w", chartVersion.Name, chartVersion.Version, validation.NotFound)
+	}
+
+	file, err := relative(dir, gitURL, chartVersion.URLs[0]+".prov")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, verify.ErrUnsigned
+	}
+	return data, err
+}
+
 func relative(base, publicURL, path string) (string, error) {
 	if strings.HasPrefix(path, publicURL) {
 		path = path[len(publicURL):]
@@ -735,7 +735,8 @@ func (s *Operations) enableKustomize(annotations map[string]string, upgrade bool
 // and then creates and return a Command containing the name of the values file, name of the chart file, the chart data
 // and if the command should use kustomize.sh
 func (s *Operations) getChartCommand(namespace, name, chartName, chartVersion string, upgrade bool, annotations map[string]string, values map[string]interface{}) (Command, error) {
-	chart, err := s.contentManager.Chart(namespace, name, chartName, chartVersion, true)
+	// Charts of repositories with a verification policy can only be installed or upgraded to if they are verified.
+	chart, err := s.contentManager.VerifiedChart(namespace, name, chartName, chartVersion, true)
 	if err != nil {
 		return Command{}, err
 	}
@@ -15,12 +15,16 @@
 
 	"sigs.k8s.io/yaml"
 
+	"github.com/rancher/rancher/pkg/catalogv2/verify"
 	"github.com/rancher/rancher/pkg/settings"
 	"github.com/sirupsen/logrus"
 	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// maxProvenanceSize is the maximum size of the provenance files that are downloaded.
+const maxProvenanceSize = 1024 * 1024
+
 func Icon(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, disableSameOriginCheck bool, chart *repo.ChartVersion) (io.ReadCloser, string, error) {
 	if len(chart.URLs) == 0 {
 		return nil, "", fmt.Errorf("failed to find chartName %s version %s: %w", chart.Name, chart.Version, validation.NotFound)
@@ -78,6 +82,60 @@ func Chart(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipT
 	}
 	defer client.CloseIdleConnections()
 
+	u, err := chartURL(repoURL, chart)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return ioutil.NopCloser(bytes.NewBuffer(data)), err
+}
+
+// Provenance returns the Helm provenance file of the chart, which is expected next to the chart archive.
+// It returns verify.ErrUnsigned if the repository has no provenance file for the chart.
+func Provenance(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, disableSameOriginCheck bool, chart *repo.ChartVersion) ([]byte, error) {
+	if len(chart.URLs) == 0 {
+		return nil, fmt.Errorf("failed to find chartName %s version %s: %w", chart.Name, chart.Version, validation.NotFound)
+	}
+
+	client, err := HelmClient(secret, caBundle, insecureSkipTLSVerify, disableSameOriginCheck, repoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	u, err := chartURL(repoURL, chart)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += ".prov"
+	if u.RawPath != "" {
+		u.RawPath += ".prov"
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, verify.ErrUnsigned
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the provenance file of chartName %s version %s: %s", chart.Name, chart.Version, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxProvenanceSize))
+}
+
+// chartURL returns the URL of the chart archive, resolving relative URLs against the repository URL.
+func chartURL(repoURL string, chart *repo.ChartVersion) (*url.URL, error) {
 	u, err := url.Parse(chart.URLs[0])
 	if err != nil {
 		return nil, err
@@ -95,15 +153,7 @@ func Chart(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipT
 		// contain an access credential.
 		u.RawQuery = base.RawQuery
 	}
-
-	resp, err := client.Get(u.String())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
-	return ioutil.NopCloser(bytes.NewBuffer(data)), err
+	return u, nil
 }
 
 func DownloadIndex(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, disableSameOriginCheck bool) (*repo.IndexFile, error) {
@@ -4,12 +4,14 @@
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/hashicorp/go-version"
+	"github.com/opencontainers/go-digest"
 	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"helm.sh/helm/v3/pkg/chart"
@@ -19,14 +21,19 @@
 	"oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/errdef"
 	"oras.land/oras-go/v2/registry/remote"
 
 	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/catalogv2/verify"
 )
 
 // maxHelmRepoIndexSize defines what is the max size of helm repo index file we support.
 var maxHelmRepoIndexSize = 30 * 1024 * 1024 // 30 MiB
 
+// maxSignatureSize defines what is the max size of cosign signature manifests and payloads we support.
+const maxSignatureSize int64 = 1024 * 1024 // 1 MiB
+
 // Chart returns an io.ReadCloser of the chart tar that is requested.
 // It uses oras Go library to download the manifest of the OCI artifact
 // checks if it is a Helm chart and then return the chart tar layer.
@@ -34,23 +41,81 @@ func Chart(credentialSecret *corev1.Secret, chart *repo.ChartVersion, clusterRep
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	orasRepository, tag, err := chartRepository(credentialSecret, chart, clusterRepoSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	chartTar, _, err := fetchChartTar(ctx, orasRepository, tag, chart.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewBuffer(chartTar)), nil
+}
+
+// VerifiedChart returns an io.ReadCloser of the chart tar that is requested like Chart,
+// once it verified that the manifest of the downloaded chart is signed with cosign by one of the keys trusted by the verifier.
+func VerifiedChart(credentialSecret *corev1.Secret, chart *repo.ChartVersion, clusterRepoSpec v1.RepoSpec, verifier *verify.Verifier) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	orasRepository, tag, err := chartRepository(credentialSecret, chart, clusterRepoSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	chartTar, manifest, err := fetchChartTar(ctx, orasRepository, tag, chart.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(ctx, orasRepository, manifest.Digest, verifier); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewBuffer(chartTar)), nil
+}
+
+// Verify verifies that the manifest the tag of the chart version points to
+// is signed with cosign by one of the keys trusted by the verifier, without downloading the chart.
+func Verify(credentialSecret *corev1.Secret, chart *repo.ChartVersion, clusterRepoSpec v1.RepoSpec, verifier *verify.Verifier) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	orasRepository, tag, err := chartRepository(credentialSecret, chart, clusterRepoSpec)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := orasRepository.Resolve(ctx, tag)
+	if err != nil {
+		return fmt.Errorf("unable to resolve the OCI artifact %s: %w", chart.URLs[0], err)
+	}
+	return verifySignature(ctx, orasRepository, manifest.Digest, verifier)
+}
+
+// chartRepository returns the oras repository and the tag of the chart version.
+func chartRepository(credentialSecret *corev1.Secret, chart *repo.ChartVersion, clusterRepoSpec v1.RepoSpec) (*remote.Repository, string, error) {
 	chartURL := chart.URLs[0]
 
 	// Create a new OCIClient
 	ociClient, err := NewClient(chartURL, clusterRepoSpec, credentialSecret)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create an OCI client for url %s: %w", chartURL, err)
+		return nil, "", fmt.Errorf("failed to create an OCI client for url %s: %w", chartURL, err)
 	}
 
 	// Create an oras repository
 	orasRepository, err := ociClient.GetOrasRepository()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create an OCI repository for url %s: %w", chartURL, err)
+		return nil, "", fmt.Errorf("failed to create an OCI repository for url %s: %w", chartURL, err)
 	}
+	return orasRepository, ociClient.tag, nil
+}
 
+// fetchChartTar downloads the OCI artifact the reference points to,
+// checks if it is a Helm chart and then returns the chart tar layer and the descriptor of the manifest.
+func fetchChartTar(ctx context.Context, orasRepository *remote.Repository, reference, chartURL string) ([]byte, ocispecv1.Descriptor, error) {
 	// Download the oci artifact manifest
 	memoryStore := memory.New()
-	manifest, err := oras.Copy(ctx, orasRepository, ociClient.tag, memoryStore, "", oras.CopyOptions{
+	manifest, err := oras.Copy(ctx, orasRepository, reference, memoryStore, "", oras.CopyOptions{
 		CopyGraphOptions: oras.CopyGraphOptions{
 			PreCopy: func(ctx context.Context, desc ocispecv1.Descriptor) error {
 				// Download only helm chart related descriptors.
@@ -70,17 +135,17 @@ func Chart(credentialSecret *corev1.Secret, chart *repo.ChartVersion, clusterRep
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to oras copy the remote OCI artifact %s: %w", chartURL, err)
+		return nil, manifest, fmt.Errorf("unable to oras copy the remote OCI artifact %s: %w", chartURL, err)
 	}
 	// Fetch the manifest blob of the oci artifact
 	manifestBlob, err := content.FetchAll(ctx, memoryStore, manifest)
 	if err != nil {
-		return nil, fmt.Errorf("unable to fetch the manifest blob of %s: %w", chartURL, err)
+		return nil, manifest, fmt.Errorf("unable to fetch the manifest blob of %s: %w", chartURL, err)
 	}
 	var manifestJSON ocispecv1.Manifest
 	err = json.Unmarshal(manifestBlob, &manifestJSON)
 	if err != nil {
-		return nil, fmt.Errorf("unable to unmarshal manifest blob of %s: %w", chartURL, err)
+		return nil, manifest, fmt.Errorf("unable to unmarshal manifest blob of %s: %w", chartURL, err)
 	}
 
 	// Check if the oci artifact is of type helm config ?
@@ -90,15 +155,59 @@ func Chart(credentialSecret *corev1.Secret, chart *repo.ChartVersion, clusterRep
 			if layer.MediaType == registry.ChartLayerMediaType {
 				chartTar, err := content.FetchAll(ctx, memoryStore, layer)
 				if err != nil {
-					return nil, err
+					return nil, manifest, err
 				}
 
-				return io.NopCloser(bytes.NewBuffer(chartTar)), nil
+				return chartTar, manifest, nil
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("unable to find the required chart tar file for %s", chartURL)
+	return nil, manifest, fmt.Errorf("unable to find the required chart tar file for %s", chartURL)
+}
+
+// verifySignature fetches the cosign signatures of the manifest with the given digest, which cosign stores
+// with the tag sha256-<hex>.sig in the same repository, and verifies them with the verifier.
+// The manifest is verified if any of its signatures is valid.
+func verifySignature(ctx context.Context, orasRepository *remote.Repository, manifestDigest digest.Digest, verifier *verify.Verifier) error {
+	signatureTag := strings.Replace(manifestDigest.String(), ":", "-", 1) + ".sig"
+	desc, rc, err := orasRepository.FetchReference(ctx, signatureTag)
+	if errors.Is(err, errdef.ErrNotFound) {
+		return verify.ErrUnsigned
+	} else if err != nil {
+		return fmt.Errorf("unable to fetch the signature %s: %w", signatureTag, err)
+	}
+	defer rc.Close()
+
+	if desc.Size > maxSignatureSize {
+		return fmt.Errorf("the signature %s has size more than %d which is not supported", signatureTag, maxSignatureSize)
+	}
+	manifestBlob, err := content.ReadAll(rc, desc)
+	if err != nil {
+		return fmt.Errorf("unable to read the signature %s: %w", signatureTag, err)
+	}
+	var manifestJSON ocispecv1.Manifest
+	if err := json.Unmarshal(manifestBlob, &manifestJSON); err != nil {
+		return fmt.Errorf("unable to unmarshal the signature %s: %w", signatureTag, err)
+	}
+
+	err = verify.ErrUnsigned
+	for _, layer := range manifestJSON.Layers {
+		if layer.MediaType != verify.CosignPayloadMediaType {
+			continue
+		}
+		if layer.Size > maxSignatureSize {
+			return fmt.Errorf("the signature payload %s has size more than %d which is not supported", layer.Digest, maxSignatureSize)
+		}
+		payload, fetchErr := content.FetchAll(ctx, orasRepository, layer)
+		if fetchErr != nil {
+			return fmt.Errorf("unable to fetch the signature payload %s: %w", layer.Digest, fetchErr)
+		}
+		if err = verifier.VerifyCosign(payload, layer.Annotations[verify.CosignSignatureAnnotation], manifestDigest.String()); err == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 // GenerateIndex creates a Helm repo index from the OCI url provided
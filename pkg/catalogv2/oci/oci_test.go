@@ -1,15 +1,33 @@
 package oci
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	corev1 "k8s.io/api/core/v1"
 
 	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/catalogv2/verify"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
 )
 
@@ -244,3 +262,101 @@ func TestGenerateIndex(t *testing.T) {
 		})
 	}
 }
+
+func spinSignedRegistry(t *testing.T, signer crypto.Signer) *httptest.Server {
+	helmChartTar, err := os.ReadFile("../../../tests/testdata/testingchart-0.1.0.tgz")
+	require.NoError(t, err)
+	configBlob := []byte("config")
+
+	layerDesc := ocispecv1.Descriptor{MediaType: registry.ChartLayerMediaType, Digest: digest.FromBytes(helmChartTar), Size: int64(len(helmChartTar))}
+	manifestJSON, err := json.Marshal(ocispecv1.Manifest{
+		MediaType: ocispecv1.MediaTypeImageManifest,
+		Config:    ocispecv1.Descriptor{MediaType: registry.ConfigMediaType, Digest: digest.FromBytes(configBlob), Size: int64(len(configBlob))},
+		Layers:    []ocispecv1.Descriptor{layerDesc},
+	})
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifestJSON)
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"testingchart"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, manifestDigest))
+	hash := sha256.Sum256(payload)
+	sig, err := signer.Sign(rand.Reader, hash[:], crypto.SHA256)
+	require.NoError(t, err)
+	payloadDesc := ocispecv1.Descriptor{
+		MediaType:   verify.CosignPayloadMediaType,
+		Digest:      digest.FromBytes(payload),
+		Size:        int64(len(payload)),
+		Annotations: map[string]string{verify.CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	}
+	signatureJSON, err := json.Marshal(ocispecv1.Manifest{
+		MediaType: ocispecv1.MediaTypeImageManifest,
+		Config:    ocispecv1.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: digest.FromBytes(configBlob), Size: int64(len(configBlob))},
+		Layers:    []ocispecv1.Descriptor{payloadDesc},
+	})
+	require.NoError(t, err)
+
+	writeManifest := func(w http.ResponseWriter, manifest []byte) {
+		w.Header().Set("Content-Type", ocispecv1.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+		w.Write(manifest)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/testingchart/manifests/0.1.0", "/v2/unsigned/manifests/0.1.0":
+			writeManifest(w, manifestJSON)
+		case "/v2/testingchart/manifests/" + strings.Replace(manifestDigest.String(), ":", "-", 1) + ".sig":
+			writeManifest(w, signatureJSON)
+		case "/v2/testingchart/blobs/" + layerDesc.Digest.String():
+			w.Write(helmChartTar)
+		case "/v2/testingchart/blobs/" + payloadDesc.Digest.String():
+			w.Write(payload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestVerifiedChart(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newVerifier := func(key crypto.PublicKey) *verify.Verifier {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		require.NoError(t, err)
+		verifier, err := verify.NewVerifier(&corev1.Secret{Data: map[string][]byte{
+			"cosign.pub": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		}})
+		require.NoError(t, err)
+		return verifier
+	}
+
+	ts := spinSignedRegistry(t, key)
+	defer ts.Close()
+	repoSpec := v1.RepoSpec{InsecurePlainHTTP: true}
+	chartVersion := func(repository string) *repo.ChartVersion {
+		return &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: repository, Version: "0.1.0"},
+			URLs:     []string{fmt.Sprintf("%s/%s:0.1.0", strings.Replace(ts.URL, "http", "oci", 1), repository)},
+		}
+	}
+
+	t.Run("signed with a trusted key", func(t *testing.T) {
+		chartTar, err := VerifiedChart(nil, chartVersion("testingchart"), repoSpec, newVerifier(key.Public()))
+		require.NoError(t, err)
+		data, err := io.ReadAll(chartTar)
+		require.NoError(t, err)
+		assert.NotEmpty(t, data)
+
+		assert.NoError(t, Verify(nil, chartVersion("testingchart"), repoSpec, newVerifier(key.Public())))
+	})
+
+	t.Run("signed with an untrusted key", func(t *testing.T) {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		_, err = VerifiedChart(nil, chartVersion("testingchart"), repoSpec, newVerifier(other.Public()))
+		assert.ErrorContains(t, err, "signature is invalid")
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		err := Verify(nil, chartVersion("unsigned"), repoSpec, newVerifier(key.Public()))
+		assert.ErrorIs(t, err, verify.ErrUnsigned)
+	})
+}
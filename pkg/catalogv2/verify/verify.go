@@ -0,0 +1,258 @@
+// Package verify verifies the signatures of Helm charts against the trusted keys of a ClusterRepo verification policy.
+// Charts of HTTP and git repositories are verified with their Helm provenance (.prov) files, which are signed with PGP,
+// and charts of OCI repositories are verified with their cosign signatures.
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"           //nolint
+	"golang.org/x/crypto/openpgp/clearsign" //nolint
+	"helm.sh/helm/v3/pkg/provenance"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// StatusAnnotation is set on the chart versions of the index of repositories with a verification policy and
+	// holds the verification status of the version.
+	StatusAnnotation = "catalog.cattle.io/verification"
+	// MessageAnnotation holds why a chart version failed verification.
+	MessageAnnotation = "catalog.cattle.io/verification-message"
+
+	// StatusVerified is the status of chart versions signed with one of the trusted keys.
+	StatusVerified = "verified"
+	// StatusUnsigned is the status of chart versions without a provenance file or signature.
+	StatusUnsigned = "unsigned"
+	// StatusFailed is the status of chart versions whose signature couldn't be verified.
+	StatusFailed = "failed"
+	// StatusUnverifiable is the status of chart versions that can only be verified when they are downloaded, e.g.
+	// because the index holds no digest for them. They are still verified before they are installed.
+	StatusUnverifiable = "unverifiable"
+
+	// CosignSignatureAnnotation is the annotation of cosign signature layers holding the base64 encoded signature.
+	CosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// CosignPayloadMediaType is the media type of cosign signature layers.
+	CosignPayloadMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+)
+
+var (
+	// ErrUnsigned is returned when a chart has no provenance file or signature.
+	ErrUnsigned = errors.New("chart is not signed")
+	// ErrUnverifiable is returned when a chart can't be verified without downloading it.
+	ErrUnverifiable = errors.New("chart can only be verified when it is downloaded")
+)
+
+// Verifier verifies chart signatures against a set of trusted keys.
+type Verifier struct {
+	id         string
+	keyring    openpgp.EntityList
+	cosignKeys []crypto.PublicKey
+}
+
+// NewVerifier returns a Verifier trusting the keys of the secret. Every entry of the secret must hold either a PGP
+// public keyring, armored or binary, or PEM encoded cosign public keys.
+func NewVerifier(secret *corev1.Secret) (*Verifier, error) {
+	v := &Verifier{}
+
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		if err := v.addKeys(secret.Data[key]); err != nil {
+			return nil, fmt.Errorf("failed to read the keys of %s in secret %s/%s: %w", key, secret.Namespace, secret.Name, err)
+		}
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+	if len(v.keyring) == 0 && len(v.cosignKeys) == 0 {
+		return nil, fmt.Errorf("secret %s/%s holds no keys", secret.Namespace, secret.Name)
+	}
+	v.id = hex.EncodeToString(hash.Sum(nil))
+	return v, nil
+}
+
+// ID identifies the trusted keys of the verifier. Verifiers trusting the same keys have the same ID.
+func (v *Verifier) ID() string {
+	return v.id
+}
+
+func (v *Verifier) addKeys(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("-----BEGIN PGP")) {
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		v.keyring = append(v.keyring, keyring...)
+		return nil
+	}
+
+	if block, rest := pem.Decode(data); block != nil {
+		for block != nil {
+			if block.Type != "PUBLIC KEY" {
+				return fmt.Errorf("unsupported PEM block %s", block.Type)
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+			v.cosignKeys = append(v.cosignKeys, key)
+			block, rest = pem.Decode(rest)
+		}
+		return nil
+	}
+
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	v.keyring = append(v.keyring, keyring...)
+	return nil
+}
+
+// VerifyProvenance verifies that the Helm provenance file prov is signed with a trusted key and holds the sha256
+// digest of the chart archive fileName. digest is the hex encoded sha256 digest of the archive.
+func (v *Verifier) VerifyProvenance(prov []byte, fileName, digest string) error {
+	if len(prov) == 0 {
+		return ErrUnsigned
+	}
+	if len(v.keyring) == 0 {
+		return errors.New("no PGP keys are trusted")
+	}
+
+	block, _ := clearsign.Decode(prov)
+	if block == nil {
+		return errors.New("provenance file is not a signed message")
+	}
+	if _, err := openpgp.CheckDetachedSignature(v.keyring, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body); err != nil {
+		return fmt.Errorf("provenance signature is invalid: %w", err)
+	}
+
+	// The signed message is the chart metadata followed by the sums of the chart files, separated by a YAML document end marker.
+	parts := bytes.Split(block.Plaintext, []byte("\n...\n"))
+	if len(parts) < 2 {
+		return errors.New("provenance file has no file sums")
+	}
+	sums := &provenance.SumCollection{}
+	if err := yaml.Unmarshal(parts[1], sums); err != nil {
+		return fmt.Errorf("failed to parse the file sums of the provenance file: %w", err)
+	}
+	sum, ok := sums.Files[fileName]
+	if !ok {
+		return fmt.Errorf("provenance file has no sum for %s", fileName)
+	}
+	if sum != "sha256:"+digest {
+		return fmt.Errorf("sha256 digest of %s doesn't match its provenance file", fileName)
+	}
+	return nil
+}
+
+// cosignPayload is the part of the cosign simple signing payload identifying the signed image.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// VerifyCosign verifies that the cosign payload is signed with a trusted key and is for the manifest with the given
+// digest. signature is the base64 encoded signature of the payload.
+func (v *Verifier) VerifyCosign(payload []byte, signature, manifestDigest string) error {
+	if len(payload) == 0 || signature == "" {
+		return ErrUnsigned
+	}
+	if len(v.cosignKeys) == 0 {
+		return errors.New("no cosign keys are trusted")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode the signature: %w", err)
+	}
+	if !v.cosignSigned(payload, sig) {
+		return errors.New("signature is invalid")
+	}
+
+	var p cosignPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to parse the signature payload: %w", err)
+	}
+	if p.Critical.Image.DockerManifestDigest != manifestDigest {
+		return fmt.Errorf("signature is for %s and not for %s", p.Critical.Image.DockerManifestDigest, manifestDigest)
+	}
+	return nil
+}
+
+func (v *Verifier) cosignSigned(payload, sig []byte) bool {
+	hash := sha256.Sum256(payload)
+	for _, key := range v.cosignKeys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, hash[:], sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Status returns the verification status matching the result of a verification.
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return StatusVerified
+	case errors.Is(err, ErrUnsigned):
+		return StatusUnsigned
+	case errors.Is(err, ErrUnverifiable):
+		return StatusUnverifiable
+	default:
+		return StatusFailed
+	}
+}
+
+// SetStatus sets the verification status annotations of a chart version from the result of its verification.
+func SetStatus(annotations map[string]string, err error) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	ClearStatus(annotations)
+	annotations[StatusAnnotation] = Status(err)
+	if err != nil && !errors.Is(err, ErrUnsigned) {
+		annotations[MessageAnnotation] = strings.TrimSpace(err.Error())
+	}
+	return annotations
+}
+
+// ClearStatus removes the verification status annotations of a chart version.
+func ClearStatus(annotations map[string]string) {
+	delete(annotations, StatusAnnotation)
+	delete(annotations, MessageAnnotation)
+}
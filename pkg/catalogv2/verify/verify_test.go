@@ -0,0 +1,190 @@
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"           //nolint
+	"golang.org/x/crypto/openpgp/armor"     //nolint
+	"golang.org/x/crypto/openpgp/clearsign" //nolint
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const digest = "4c2ce4a8d1a8d4e6c06a3dd1e4c7bca0a2e09e0f7d6c1a24b1a5ec3f8a9b7e21"
+
+func newPGPKey(t *testing.T) (*openpgp.Entity, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Chart Publisher", "", "charts@example.com", nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	return entity, buf.Bytes()
+}
+
+func signProvenance(t *testing.T, entity *openpgp.Entity, fileName, digest string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, entity.PrivateKey, nil)
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(w, "apiVersion: v2\nname: mychart\nversion: 0.1.0\n\n...\nfiles:\n  %s: sha256:%s\n", fileName, digest)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func newCosignKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func signCosign(t *testing.T, key crypto.Signer, manifestDigest string) ([]byte, string) {
+	t.Helper()
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"registry.example.com/charts/mychart"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, manifestDigest))
+	hash := sha256.Sum256(payload)
+	sig, err := key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	require.NoError(t, err)
+	return payload, base64.StdEncoding.EncodeToString(sig)
+}
+
+func newSecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "cattle-system"},
+		Data:       data,
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, pgpKey := newPGPKey(t)
+	_, cosignKey := newCosignKey(t)
+
+	v, err := NewVerifier(newSecret(map[string][]byte{"pubring.asc": pgpKey, "cosign.pub": cosignKey}))
+	require.NoError(t, err)
+	assert.Len(t, v.keyring, 1)
+	assert.Len(t, v.cosignKeys, 1)
+
+	same, err := NewVerifier(newSecret(map[string][]byte{"pubring.asc": pgpKey, "cosign.pub": cosignKey}))
+	require.NoError(t, err)
+	assert.Equal(t, v.ID(), same.ID(), "expected verifiers trusting the same keys to have the same ID")
+	pgpOnly, err := NewVerifier(newSecret(map[string][]byte{"pubring.asc": pgpKey}))
+	require.NoError(t, err)
+	assert.NotEqual(t, v.ID(), pgpOnly.ID())
+
+	_, err = NewVerifier(newSecret(nil))
+	assert.ErrorContains(t, err, "holds no keys")
+
+	_, err = NewVerifier(newSecret(map[string][]byte{"cosign.key": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")})}))
+	assert.ErrorContains(t, err, "unsupported PEM block PRIVATE KEY")
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	entity, pgpKey := newPGPKey(t)
+	other, _ := newPGPKey(t)
+	v, err := NewVerifier(newSecret(map[string][]byte{"pubring.asc": pgpKey}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		prov    []byte
+		wantErr string
+	}{
+		{
+			name: "signed by a trusted key",
+			prov: signProvenance(t, entity, "mychart-0.1.0.tgz", digest),
+		},
+		{
+			name:    "no provenance file",
+			wantErr: ErrUnsigned.Error(),
+		},
+		{
+			name:    "signed by an untrusted key",
+			prov:    signProvenance(t, other, "mychart-0.1.0.tgz", digest),
+			wantErr: "provenance signature is invalid",
+		},
+		{
+			name:    "different digest",
+			prov:    signProvenance(t, entity, "mychart-0.1.0.tgz", "0000"),
+			wantErr: "sha256 digest of mychart-0.1.0.tgz doesn't match its provenance file",
+		},
+		{
+			name:    "different chart",
+			prov:    signProvenance(t, entity, "other-0.1.0.tgz", digest),
+			wantErr: "provenance file has no sum for mychart-0.1.0.tgz",
+		},
+		{
+			name:    "tampered",
+			prov:    bytes.Replace(signProvenance(t, entity, "mychart-0.1.0.tgz", digest), []byte("version: 0.1.0"), []byte("version: 0.2.0"), 1),
+			wantErr: "provenance signature is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.VerifyProvenance(tt.prov, "mychart-0.1.0.tgz", digest)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestVerifyCosign(t *testing.T) {
+	manifestDigest := "sha256:" + digest
+	key, cosignKey := newCosignKey(t)
+	other, _ := newCosignKey(t)
+	v, err := NewVerifier(newSecret(map[string][]byte{"cosign.pub": cosignKey}))
+	require.NoError(t, err)
+
+	payload, sig := signCosign(t, key, manifestDigest)
+	assert.NoError(t, v.VerifyCosign(payload, sig, manifestDigest))
+
+	assert.ErrorIs(t, v.VerifyCosign(nil, "", manifestDigest), ErrUnsigned)
+
+	assert.ErrorContains(t, v.VerifyCosign(payload, sig, "sha256:0000"), "signature is for "+manifestDigest)
+
+	otherPayload, otherSig := signCosign(t, other, manifestDigest)
+	assert.ErrorContains(t, v.VerifyCosign(otherPayload, otherSig, manifestDigest), "signature is invalid")
+
+	_, pgpKey := newPGPKey(t)
+	pgpOnly, err := NewVerifier(newSecret(map[string][]byte{"pubring.asc": pgpKey}))
+	require.NoError(t, err)
+	assert.ErrorContains(t, pgpOnly.VerifyCosign(payload, sig, manifestDigest), "no cosign keys are trusted")
+}
+
+func TestSetStatus(t *testing.T) {
+	annotations := SetStatus(nil, nil)
+	assert.Equal(t, map[string]string{StatusAnnotation: StatusVerified}, annotations)
+
+	annotations = SetStatus(annotations, fmt.Errorf("provenance signature is invalid"))
+	assert.Equal(t, StatusFailed, annotations[StatusAnnotation])
+	assert.Equal(t, "provenance signature is invalid", annotations[MessageAnnotation])
+
+	annotations = SetStatus(annotations, fmt.Errorf("fetching: %w", ErrUnsigned))
+	assert.Equal(t, map[string]string{StatusAnnotation: StatusUnsigned}, annotations)
+
+	annotations = SetStatus(annotations, fmt.Errorf("%w: index has no digest for the chart", ErrUnverifiable))
+	assert.Equal(t, StatusUnverifiable, annotations[StatusAnnotation])
+
+	ClearStatus(annotations)
+	assert.Empty(t, annotations)
+}
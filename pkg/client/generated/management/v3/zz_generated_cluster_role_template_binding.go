@@ -10,6 +10,8 @@
 	ClusterRoleTemplateBindingFieldClusterID        = "clusterId"
 	ClusterRoleTemplateBindingFieldCreated          = "created"
 	ClusterRoleTemplateBindingFieldCreatorID        = "creatorId"
+	ClusterRoleTemplateBindingFieldExpiresAt        = "expiresAt"
+	ClusterRoleTemplateBindingFieldExpiresIn        = "expiresIn"
 	ClusterRoleTemplateBindingFieldGroupID          = "groupId"
 	ClusterRoleTemplateBindingFieldGroupPrincipalID = "groupPrincipalId"
 	ClusterRoleTemplateBindingFieldLabels           = "labels"
@@ -29,6 +31,8 @@ type ClusterRoleTemplateBinding struct {
 	ClusterID        string            `json:"clusterId,omitempty" yaml:"clusterId,omitempty"`
 	Created          string            `json:"created,omitempty" yaml:"created,omitempty"`
 	CreatorID        string            `json:"creatorId,omitempty" yaml:"creatorId,omitempty"`
+	ExpiresAt        string            `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	ExpiresIn        string            `json:"expiresIn,omitempty" yaml:"expiresIn,omitempty"`
 	GroupID          string            `json:"groupId,omitempty" yaml:"groupId,omitempty"`
 	GroupPrincipalID string            `json:"groupPrincipalId,omitempty" yaml:"groupPrincipalId,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
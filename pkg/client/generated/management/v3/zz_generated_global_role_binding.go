@@ -9,6 +9,8 @@
 	GlobalRoleBindingFieldAnnotations      = "annotations"
 	GlobalRoleBindingFieldCreated          = "created"
 	GlobalRoleBindingFieldCreatorID        = "creatorId"
+	GlobalRoleBindingFieldExpiresAt        = "expiresAt"
+	GlobalRoleBindingFieldExpiresIn        = "expiresIn"
 	GlobalRoleBindingFieldGlobalRoleID     = "globalRoleId"
 	GlobalRoleBindingFieldGroupPrincipalID = "groupPrincipalId"
 	GlobalRoleBindingFieldLabels           = "labels"
@@ -24,6 +26,8 @@ type GlobalRoleBinding struct {
 	Annotations      map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 	Created          string            `json:"created,omitempty" yaml:"created,omitempty"`
 	CreatorID        string            `json:"creatorId,omitempty" yaml:"creatorId,omitempty"`
+	ExpiresAt        string            `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	ExpiresIn        string            `json:"expiresIn,omitempty" yaml:"expiresIn,omitempty"`
 	GlobalRoleID     string            `json:"globalRoleId,omitempty" yaml:"globalRoleId,omitempty"`
 	GroupPrincipalID string            `json:"groupPrincipalId,omitempty" yaml:"groupPrincipalId,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
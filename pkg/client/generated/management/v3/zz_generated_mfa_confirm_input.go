@@ -0,0 +1,10 @@
+package client
+
+const (
+	MFAConfirmInputType         = "mfaConfirmInput"
+	MFAConfirmInputFieldMFACode = "mfaCode"
+)
+
+type MFAConfirmInput struct {
+	MFACode string `json:"mfaCode,omitempty" yaml:"mfaCode,omitempty"`
+}
@@ -0,0 +1,10 @@
+package client
+
+const (
+	MFAConfirmOutputType               = "mfaConfirmOutput"
+	MFAConfirmOutputFieldRecoveryCodes = "recoveryCodes"
+)
+
+type MFAConfirmOutput struct {
+	RecoveryCodes []string `json:"recoveryCodes,omitempty" yaml:"recoveryCodes,omitempty"`
+}
@@ -0,0 +1,10 @@
+package client
+
+const (
+	MFADisableInputType         = "mfaDisableInput"
+	MFADisableInputFieldMFACode = "mfaCode"
+)
+
+type MFADisableInput struct {
+	MFACode string `json:"mfaCode,omitempty" yaml:"mfaCode,omitempty"`
+}
@@ -0,0 +1,12 @@
+package client
+
+const (
+	MFAEnrollOutputType                     = "mfaEnrollOutput"
+	MFAEnrollOutputFieldTOTPProvisioningURI = "totpProvisioningUri"
+	MFAEnrollOutputFieldTOTPSecret          = "totpSecret"
+)
+
+type MFAEnrollOutput struct {
+	TOTPProvisioningURI string `json:"totpProvisioningUri,omitempty" yaml:"totpProvisioningUri,omitempty"`
+	TOTPSecret          string `json:"totpSecret,omitempty" yaml:"totpSecret,omitempty"`
+}
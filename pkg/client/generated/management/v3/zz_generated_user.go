@@ -71,10 +71,20 @@ type UserOperations interface {
 
 	ActionRefreshauthprovideraccess(resource *User) error
 
+	ActionResetmfa(resource *User) (*User, error)
+
 	ActionSetpassword(resource *User, input *SetPasswordInput) (*User, error)
 
+	ActionUnlock(resource *User) (*User, error)
+
 	CollectionActionChangepassword(resource *UserCollection, input *ChangePasswordInput) error
 
+	CollectionActionConfirmmfa(resource *UserCollection, input *MFAConfirmInput) (*MFAConfirmOutput, error)
+
+	CollectionActionDisablemfa(resource *UserCollection, input *MFADisableInput) error
+
+	CollectionActionEnrollmfa(resource *UserCollection) (*MFAEnrollOutput, error)
+
 	CollectionActionRefreshauthprovideraccess(resource *UserCollection) error
 }
 
@@ -152,17 +162,46 @@ func (c *UserClient) ActionRefreshauthprovideraccess(resource *User) error {
 	return err
 }
 
+func (c *UserClient) ActionResetmfa(resource *User) (*User, error) {
+	resp := &User{}
+	err := c.apiClient.Ops.DoAction(UserType, "resetmfa", &resource.Resource, nil, resp)
+	return resp, err
+}
+
 func (c *UserClient) ActionSetpassword(resource *User, input *SetPasswordInput) (*User, error) {
 	resp := &User{}
 	err := c.apiClient.Ops.DoAction(UserType, "setpassword", &resource.Resource, input, resp)
 	return resp, err
 }
 
+func (c *UserClient) ActionUnlock(resource *User) (*User, error) {
+	resp := &User{}
+	err := c.apiClient.Ops.DoAction(UserType, "unlock", &resource.Resource, nil, resp)
+	return resp, err
+}
+
 func (c *UserClient) CollectionActionChangepassword(resource *UserCollection, input *ChangePasswordInput) error {
 	err := c.apiClient.Ops.DoCollectionAction(UserType, "changepassword", &resource.Collection, input, nil)
 	return err
 }
 
+func (c *UserClient) CollectionActionConfirmmfa(resource *UserCollection, input *MFAConfirmInput) (*MFAConfirmOutput, error) {
+	resp := &MFAConfirmOutput{}
+	err := c.apiClient.Ops.DoCollectionAction(UserType, "confirmmfa", &resource.Collection, input, resp)
+	return resp, err
+}
+
+func (c *UserClient) CollectionActionDisablemfa(resource *UserCollection, input *MFADisableInput) error {
+	err := c.apiClient.Ops.DoCollectionAction(UserType, "disablemfa", &resource.Collection, input, nil)
+	return err
+}
+
+func (c *UserClient) CollectionActionEnrollmfa(resource *UserCollection) (*MFAEnrollOutput, error) {
+	resp := &MFAEnrollOutput{}
+	err := c.apiClient.Ops.DoCollectionAction(UserType, "enrollmfa", &resource.Collection, nil, resp)
+	return resp, err
+}
+
 func (c *UserClient) CollectionActionRefreshauthprovideraccess(resource *UserCollection) error {
 	err := c.apiClient.Ops.DoCollectionAction(UserType, "refreshauthprovideraccess", &resource.Collection, nil, nil)
 	return err
@@ -61,6 +61,7 @@ type record struct {
 	cluster       *config.UserContext
 	accessControl types.AccessControl
 	started       bool
+	running       bool
 	owner         bool
 	ctx           context.Context
 	cancel        context.CancelFunc
@@ -101,6 +102,23 @@ func (m *Manager) Start(ctx context.Context, cluster *apimgmtv3.Cluster, cluster
 	return err
 }
 
+// ControllerCounts returns the number of clusters whose controllers run in this process,
+// and the number of clusters whose controllers are still starting.
+func (m *Manager) ControllerCounts() (running, starting int) {
+	m.controllers.Range(func(_, obj any) bool {
+		r := obj.(*record)
+		r.Lock()
+		defer r.Unlock()
+		if r.running {
+			running++
+		} else if r.started {
+			starting++
+		}
+		return true
+	})
+	return running, starting
+}
+
 func (m *Manager) RESTConfig(cluster *apimgmtv3.Cluster) (rest.Config, error) {
 	obj, ok := m.controllers.Load(cluster.UID)
 	if !ok {
@@ -192,6 +210,9 @@ func (m *Manager) doStart(rec *record, clusterOwner bool) (exit error) {
 	defer func() {
 		if exit == nil {
 			logrus.Infof("Starting cluster agent for %s [owner=%v]", rec.cluster.ClusterName, clusterOwner)
+			rec.Lock()
+			rec.running = true
+			rec.Unlock()
 		}
 	}()
 
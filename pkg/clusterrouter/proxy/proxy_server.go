@@ -18,6 +18,7 @@
 	dialer2 "github.com/rancher/rancher/pkg/dialer"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/impersonation"
+	"github.com/rancher/rancher/pkg/tracing"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/rancher/rancher/pkg/types/config/dialer"
 	"github.com/rancher/wrangler/v3/pkg/schemas/validation"
@@ -306,7 +307,7 @@ func (r *RemoteService) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	httpProxy := proxy.NewUpgradeAwareHandler(&u, transport, true, false, er)
+	httpProxy := proxy.NewUpgradeAwareHandler(&u, tracing.Transport(transport, r.cluster.Name), true, false, er)
 	httpProxy.ServeHTTP(rw, req)
 }
 
@@ -7,6 +7,7 @@
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/rancher/pkg/clusterrouter/proxy"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/tracing"
 	"github.com/rancher/rancher/pkg/types/config/dialer"
 	"k8s.io/client-go/rest"
 )
@@ -23,7 +24,9 @@ func New(localConfig *rest.Config, lookup ClusterLookup, dialer dialer.Factory,
 }
 
 func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ctx, span := tracing.Start(req.Context(), "route cluster")
 	c, handler, err := r.serverFactory.get(req)
+	defer func() { tracing.End(span, err) }()
 	if err != nil {
 		e, ok := err.(*httperror.APIError)
 		if ok {
@@ -39,7 +42,8 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	handler.ServeHTTP(rw, req)
+	span.SetAttributes(tracing.ClusterKey.String(c.Name))
+	handler.ServeHTTP(rw, req.WithContext(ctx))
 }
 
 func response(rw http.ResponseWriter, code httperror.ErrorCode, message string) {
@@ -7,6 +7,9 @@
 	"github.com/rancher/rancher/pkg/capr/planner"
 	"github.com/rancher/rancher/pkg/controllers/capr/bootstrap"
 	"github.com/rancher/rancher/pkg/controllers/capr/dynamicschema"
+	"github.com/rancher/rancher/pkg/controllers/capr/etcdsnapshotencryption"
+	"github.com/rancher/rancher/pkg/controllers/capr/etcdsnapshottarget"
+	"github.com/rancher/rancher/pkg/controllers/capr/etcdsnapshotverify"
 	"github.com/rancher/rancher/pkg/controllers/capr/machinedrain"
 	"github.com/rancher/rancher/pkg/controllers/capr/machinenodelookup"
 	"github.com/rancher/rancher/pkg/controllers/capr/machineprovision"
@@ -27,11 +30,13 @@
 
 func Register(ctx context.Context, clients *wrangler.Context, kubeconfigManager *kubeconfig.Manager) {
 	rkePlanner := planner.New(ctx, clients, planner.InfoFunctions{
-		ImageResolver:           image.ResolveWithControlPlane,
-		ReleaseData:             capr.GetKDMReleaseData,
-		SystemAgentImage:        settings.SystemAgentInstallerImage.Get,
-		SystemPodLabelSelectors: systeminfo.NewRetriever(clients).GetSystemPodLabelSelectors,
-		GetBootstrapManifests:   prebootstrap.NewRetriever(clients).GeneratePreBootstrapClusterAgentManifest,
+		ImageResolver:                image.ResolveWithControlPlane,
+		ReleaseData:                  capr.GetKDMReleaseData,
+		SystemAgentImage:             settings.SystemAgentInstallerImage.Get,
+		SystemPodLabelSelectors:      systeminfo.NewRetriever(clients).GetSystemPodLabelSelectors,
+		GetBootstrapManifests:        prebootstrap.NewRetriever(clients).GeneratePreBootstrapClusterAgentManifest,
+		EtcdSnapshotTestRestoreImage: settings.EtcdSnapshotTestRestoreImage.Get,
+		AgentImage:                   settings.AgentImage.Get,
 	})
 	if features.MCM.Enabled() {
 		dynamicschema.Register(ctx, clients)
@@ -42,6 +47,9 @@ func Register(ctx context.Context, clients *wrangler.Context, kubeconfigManager
 	machinenodelookup.Register(ctx, clients, kubeconfigManager)
 	plannercontroller.Register(ctx, clients, rkePlanner)
 	plansecret.Register(ctx, clients)
+	etcdsnapshotverify.Register(ctx, clients)
+	etcdsnapshottarget.Register(ctx, clients)
+	etcdsnapshotencryption.Register(ctx, clients)
 	unmanaged.Register(ctx, clients, kubeconfigManager)
 	rkecontrolplane.Register(ctx, clients)
 	managesystemagent.Register(ctx, clients)
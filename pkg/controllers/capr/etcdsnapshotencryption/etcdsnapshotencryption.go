@@ -0,0 +1,238 @@
+package etcdsnapshotencryption
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/rancher/pkg/capr/planner"
+	"github.com/rancher/rancher/pkg/capr/snapshotcrypt"
+	rkev1controllers "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/wrangler"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/relatedresource"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// transferTimeout is how long re-encrypting an etcd snapshot may take.
+const transferTimeout = 30 * time.Minute
+
+// handler re-encrypts the encrypted S3 etcd snapshots of a cluster and their copies in the additional targets with the
+// current key of its etcd snapshot encryption once the key was rotated, so that previous keys can be removed from the
+// secret.
+type handler struct {
+	ctx               context.Context
+	etcdSnapshots     rkev1controllers.ETCDSnapshotClient
+	etcdSnapshotCache rkev1controllers.ETCDSnapshotCache
+	controlPlaneCache rkev1controllers.RKEControlPlaneCache
+	secretCache       corecontrollers.SecretCache
+}
+
+func Register(ctx context.Context, clients *wrangler.Context) {
+	h := &handler{
+		ctx:               ctx,
+		etcdSnapshots:     clients.RKE.ETCDSnapshot(),
+		etcdSnapshotCache: clients.RKE.ETCDSnapshot().Cache(),
+		controlPlaneCache: clients.RKE.RKEControlPlane().Cache(),
+		secretCache:       clients.Core.Secret().Cache(),
+	}
+	clients.RKE.ETCDSnapshot().OnChange(ctx, "etcd-snapshot-encryption", h.OnChange)
+	relatedresource.Watch(ctx, "etcd-snapshot-encryption-trigger", h.resolve, clients.RKE.ETCDSnapshot(), clients.RKE.RKEControlPlane(), clients.Core.Secret())
+}
+
+// resolve enqueues the encrypted etcd snapshots of the clusters whose control plane or encryption secret changed.
+func (h *handler) resolve(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
+	var controlPlanes []*rkev1.RKEControlPlane
+	switch obj.(type) {
+	case *rkev1.RKEControlPlane:
+		controlPlane, err := h.controlPlaneCache.Get(namespace, name)
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		controlPlanes = append(controlPlanes, controlPlane)
+	case *corev1.Secret:
+		all, err := h.controlPlaneCache.List(namespace, labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, controlPlane := range all {
+			if planner.SnapshotEncryptionEnabled(controlPlane) && controlPlane.Spec.ETCD.SnapshotEncryption.SecretName == name {
+				controlPlanes = append(controlPlanes, controlPlane)
+			}
+		}
+	default:
+		return nil, nil
+	}
+
+	var keys []relatedresource.Key
+	for _, controlPlane := range controlPlanes {
+		if !planner.SnapshotEncryptionEnabled(controlPlane) {
+			continue
+		}
+		snapshots, err := h.etcdSnapshotCache.List(controlPlane.Namespace, labels.SelectorFromSet(map[string]string{
+			capr.ClusterNameLabel: controlPlane.Spec.ClusterName,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.SnapshotFile.EncryptionKeyID != "" {
+				keys = append(keys, relatedresource.Key{Namespace: snapshot.Namespace, Name: snapshot.Name})
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (h *handler) OnChange(_ string, snapshot *rkev1.ETCDSnapshot) (*rkev1.ETCDSnapshot, error) {
+	if snapshot == nil || snapshot.DeletionTimestamp != nil || snapshot.SnapshotFile.S3 == nil ||
+		snapshot.SnapshotFile.EncryptionKeyID == "" || snapshot.Status.Missing {
+		return snapshot, nil
+	}
+
+	controlPlane, err := h.controlPlaneCache.Get(snapshot.Namespace, snapshot.Spec.ClusterName)
+	if apierrors.IsNotFound(err) {
+		return snapshot, nil
+	} else if err != nil {
+		return snapshot, err
+	}
+	if !planner.SnapshotEncryptionEnabled(controlPlane) {
+		return snapshot, nil
+	}
+
+	keys, err := planner.SnapshotEncryptionKeys(h.secretCache, controlPlane)
+	if err != nil {
+		return snapshot, err
+	}
+	keyID := snapshotcrypt.KeyID(keys[0])
+	if snapshot.SnapshotFile.EncryptionKeyID == keyID {
+		return snapshot, nil
+	}
+
+	// the copies are re-encrypted first, as the etcdsnapshot object only records the key of the snapshot in the S3 target
+	for _, target := range replicatedTargets(snapshot, controlPlane) {
+		object, err := planner.GetS3TargetObject(h.secretCache, snapshot, controlPlane, target)
+		if err != nil {
+			return snapshot, fmt.Errorf("re-encrypting etcd snapshot %s/%s in target %s: %w", snapshot.Namespace, snapshot.Name, target.Name, err)
+		}
+		if id, err := h.keyID(object); minio.ToErrorResponse(err).Code == "NoSuchKey" || id == keyID {
+			// removed by the retention of the target, or already re-encrypted
+			continue
+		} else if err != nil {
+			return snapshot, fmt.Errorf("re-encrypting etcd snapshot %s/%s in target %s: %w", snapshot.Namespace, snapshot.Name, target.Name, err)
+		}
+		if _, err := h.reencrypt(object, keys); err != nil {
+			return snapshot, fmt.Errorf("re-encrypting etcd snapshot %s/%s in target %s: %w", snapshot.Namespace, snapshot.Name, target.Name, err)
+		}
+		logrus.Infof("[etcdsnapshotencryption] re-encrypted etcd snapshot %s/%s in target %s with key %s", snapshot.Namespace, snapshot.Name, target.Name, keyID)
+	}
+
+	object, err := planner.GetS3Object(h.secretCache, snapshot, controlPlane)
+	if err != nil {
+		return snapshot, fmt.Errorf("re-encrypting etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+	}
+	checksum, err := h.reencrypt(object, keys)
+	if err != nil {
+		return snapshot, fmt.Errorf("re-encrypting etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+	}
+	logrus.Infof("[etcdsnapshotencryption] re-encrypted etcd snapshot %s/%s with key %s", snapshot.Namespace, snapshot.Name, keyID)
+
+	snapshot = snapshot.DeepCopy()
+	snapshot.SnapshotFile.EncryptionKeyID = keyID
+	snapshot.SnapshotFile.Checksum = checksum
+	return h.etcdSnapshots.Update(snapshot)
+}
+
+// replicatedTargets returns the additional targets the etcd snapshot was replicated to and not removed from yet.
+func replicatedTargets(snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane) []rkev1.ETCDSnapshotTarget {
+	var targets []rkev1.ETCDSnapshotTarget
+	for _, target := range controlPlane.Spec.ETCD.Targets {
+		if target.Name == "" || target.S3 == nil {
+			continue
+		}
+		for _, status := range snapshot.Status.Targets {
+			if status.Name == target.Name && status.Replicated && !status.Pruned {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// keyID returns the ID of the key the S3 object of an encrypted etcd snapshot is encrypted with. Only the header of the
+// snapshot is downloaded.
+func (h *handler) keyID(s3 *planner.S3Object) (string, error) {
+	ctx, cancel := context.WithTimeout(h.ctx, transferTimeout)
+	defer cancel()
+
+	object, err := s3.Client.GetObject(ctx, s3.Bucket, s3.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+	return snapshotcrypt.ReadKeyID(object)
+}
+
+// reencrypt decrypts the S3 object of an etcd snapshot with whichever of the keys it is encrypted with, and replaces it
+// with the snapshot encrypted with the current key. The user metadata of the object is kept, apart from the key ID. It
+// returns the SHA-256 checksum of the re-encrypted snapshot.
+func (h *handler) reencrypt(s3 *planner.S3Object, keys [][]byte) (string, error) {
+	ctx, cancel := context.WithTimeout(h.ctx, transferTimeout)
+	defer cancel()
+
+	object, err := s3.Client.GetObject(ctx, s3.Bucket, s3.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := snapshotcrypt.NewReader(object, keys)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := map[string]string{}
+	for k, v := range info.UserMetadata {
+		metadata[k] = v
+	}
+	metadata[snapshotcrypt.KeyIDMetadataKey] = snapshotcrypt.KeyID(keys[0])
+
+	// the object is read in full before it is replaced, as the upload only completes once all of the re-encrypted
+	// snapshot was read from the pipe. The re-encrypted snapshot has the size of the object, as the plaintext is the
+	// same, and is hashed before it is written to the pipe.
+	hash := sha256.New()
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := snapshotcrypt.NewWriter(io.MultiWriter(hash, pw), keys[0])
+		if err == nil {
+			_, err = io.Copy(w, plaintext)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	_, err = s3.Client.PutObject(ctx, s3.Bucket, s3.Key, pr, info.Size, minio.PutObjectOptions{UserMetadata: metadata})
+	pr.CloseWithError(err)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
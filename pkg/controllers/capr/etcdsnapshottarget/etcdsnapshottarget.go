@@ -0,0 +1,344 @@
+package etcdsnapshottarget
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/rancher/pkg/capr/planner"
+	sb "github.com/rancher/rancher/pkg/controllers/managementuser/snapshotbackpopulate"
+	rkev1controllers "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/wrangler"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/v3/pkg/merr"
+	"github.com/rancher/wrangler/v3/pkg/name"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// transferTimeout is how long replicating an etcd snapshot to a target may take.
+	transferTimeout = 30 * time.Minute
+
+	// maxCopySize is the size of the largest object S3 copies at once, larger objects are copied in parts.
+	maxCopySize = 5 * 1024 * 1024 * 1024
+)
+
+// handler replicates the etcd snapshots stored in the S3 target of a cluster to the additional targets of its etcd
+// configuration, and applies the retention of each target whenever a snapshot was replicated to it. If the etcd
+// configuration has an S3 retention, it is applied to the S3 target whenever a snapshot was added.
+type handler struct {
+	ctx               context.Context
+	etcdSnapshots     rkev1controllers.ETCDSnapshotClient
+	etcdSnapshotCache rkev1controllers.ETCDSnapshotCache
+	controlPlaneCache rkev1controllers.RKEControlPlaneCache
+	secretCache       corecontrollers.SecretCache
+}
+
+func Register(ctx context.Context, clients *wrangler.Context) {
+	h := &handler{
+		ctx:               ctx,
+		etcdSnapshots:     clients.RKE.ETCDSnapshot(),
+		etcdSnapshotCache: clients.RKE.ETCDSnapshot().Cache(),
+		controlPlaneCache: clients.RKE.RKEControlPlane().Cache(),
+		secretCache:       clients.Core.Secret().Cache(),
+	}
+	clients.RKE.ETCDSnapshot().OnChange(ctx, "etcd-snapshot-target", h.OnChange)
+}
+
+func (h *handler) OnChange(_ string, snapshot *rkev1.ETCDSnapshot) (*rkev1.ETCDSnapshot, error) {
+	if snapshot == nil || snapshot.DeletionTimestamp != nil || snapshot.SnapshotFile.S3 == nil || snapshot.Status.Missing {
+		return snapshot, nil
+	}
+
+	controlPlane, err := h.controlPlaneCache.Get(snapshot.Namespace, snapshot.Spec.ClusterName)
+	if apierrors.IsNotFound(err) {
+		return snapshot, nil
+	} else if err != nil {
+		return snapshot, err
+	}
+	if controlPlane.Spec.ETCD == nil || (len(controlPlane.Spec.ETCD.Targets) == 0 && controlPlane.Spec.ETCD.S3Retention == nil) {
+		return snapshot, nil
+	}
+
+	var (
+		errs     []error
+		prune    []rkev1.ETCDSnapshotTarget
+		statuses = snapshot.DeepCopy().Status.Targets
+	)
+	for _, target := range controlPlane.Spec.ETCD.Targets {
+		if target.Name == "" || target.S3 == nil {
+			continue
+		}
+		if status := targetStatus(statuses, target.Name); status != nil && (status.Replicated || status.Pruned) {
+			continue
+		}
+
+		status := rkev1.ETCDSnapshotTargetStatus{Name: target.Name}
+		if err := h.replicate(snapshot, controlPlane, target); err != nil {
+			status.Message = err.Error()
+			errs = append(errs, fmt.Errorf("replicating etcd snapshot %s/%s to target %s: %w", snapshot.Namespace, snapshot.Name, target.Name, err))
+		} else {
+			logrus.Infof("[etcdsnapshottarget] replicated etcd snapshot %s/%s to target %s", snapshot.Namespace, snapshot.Name, target.Name)
+			status.Replicated = true
+			status.ReplicatedAt = &metav1.Time{Time: time.Now()}
+			prune = append(prune, target)
+		}
+		statuses = setTargetStatus(statuses, status)
+	}
+
+	if !equality.Semantic.DeepEqual(snapshot.Status.Targets, statuses) {
+		snapshot = snapshot.DeepCopy()
+		snapshot.Status.Targets = statuses
+		if snapshot, err = h.etcdSnapshots.UpdateStatus(snapshot); err != nil {
+			return snapshot, err
+		}
+	}
+
+	for _, target := range prune {
+		if err := h.prune(snapshot.Namespace, snapshot.Spec.ClusterName, controlPlane, target); err != nil {
+			errs = append(errs, fmt.Errorf("applying retention of target %s: %w", target.Name, err))
+		}
+	}
+
+	if controlPlane.Spec.ETCD.S3Retention != nil {
+		if err := h.pruneS3(snapshot, controlPlane); err != nil {
+			errs = append(errs, fmt.Errorf("applying retention of the S3 target: %w", err))
+		}
+	}
+
+	return snapshot, merr.NewErrors(errs...)
+}
+
+// replicate copies the etcd snapshot from the S3 target of the cluster to the target. If both are on the same endpoint,
+// the snapshot is copied by the S3 server. Otherwise, or if that fails, e.g. as the credentials of the target can't read
+// the snapshot, it is transferred through Rancher.
+func (h *handler) replicate(snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane, target rkev1.ETCDSnapshotTarget) error {
+	source, err := planner.GetS3Object(h.secretCache, snapshot, controlPlane)
+	if err != nil {
+		return err
+	}
+	destination, err := planner.GetS3TargetObject(h.secretCache, snapshot, controlPlane, target)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, transferTimeout)
+	defer cancel()
+
+	if source.Client.EndpointURL().String() == destination.Client.EndpointURL().String() {
+		err := copyObject(ctx, source, destination)
+		if err == nil {
+			return nil
+		}
+		logrus.Debugf("[etcdsnapshottarget] copying etcd snapshot %s/%s to target %s failed, transferring it instead: %v", snapshot.Namespace, snapshot.Name, target.Name, err)
+	}
+
+	object, err := source.Client.GetObject(ctx, source.Bucket, source.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = destination.Client.PutObject(ctx, destination.Bucket, destination.Key, object, info.Size, minio.PutObjectOptions{})
+	return err
+}
+
+// copyObject copies the etcd snapshot to the target on the S3 server, using the credentials of the target.
+func copyObject(ctx context.Context, source *planner.S3Object, destination *planner.S3Object) error {
+	src := minio.CopySrcOptions{Bucket: source.Bucket, Object: source.Key}
+	dst := minio.CopyDestOptions{Bucket: destination.Bucket, Object: destination.Key}
+
+	info, err := destination.Client.StatObject(ctx, source.Bucket, source.Key, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if info.Size > maxCopySize {
+		_, err = destination.Client.ComposeObject(ctx, dst, src)
+		return err
+	}
+	_, err = destination.Client.CopyObject(ctx, dst, src)
+	return err
+}
+
+// prune removes the snapshots of the cluster from the target that are not kept by its retention. Snapshots are dated by
+// when they were created if their etcdsnapshot object still exists, as the copies are rewritten when they are
+// re-encrypted with a rotated key, or by when they were replicated to the target otherwise.
+func (h *handler) prune(namespace, clusterName string, controlPlane *rkev1.RKEControlPlane, target rkev1.ETCDSnapshotTarget) error {
+	if target.Retention == nil {
+		return nil
+	}
+
+	destination, err := planner.NewS3Client(h.secretCache, controlPlane.Namespace, target.S3, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, transferTimeout)
+	defer cancel()
+
+	snapshots, err := h.etcdSnapshotCache.List(namespace, labels.SelectorFromSet(map[string]string{
+		capr.ClusterNameLabel: clusterName,
+	}))
+	if err != nil {
+		return err
+	}
+	folder := planner.S3TargetFolder(destination.Folder, namespace, clusterName)
+	createdAt := map[string]time.Time{}
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotFile.S3 != nil {
+			createdAt[path.Join(folder, snapshot.SnapshotFile.Name)] = snapshotCreatedAt(snapshot)
+		}
+	}
+
+	var objects []snapshotObject
+	for info := range destination.Client.ListObjects(ctx, destination.Bucket, minio.ListObjectsOptions{Prefix: folder + "/"}) {
+		if info.Err != nil {
+			return info.Err
+		}
+		object := snapshotObject{Key: info.Key, CreatedAt: info.LastModified}
+		if t, ok := createdAt[info.Key]; ok {
+			object.CreatedAt = t
+		}
+		objects = append(objects, object)
+	}
+
+	keep := retained(objects, target.Retention, time.Now())
+	for _, object := range objects {
+		if keep[object.Key] {
+			continue
+		}
+		logrus.Infof("[etcdsnapshottarget] removing etcd snapshot %s of cluster %s/%s from target %s by its retention", object.Key, namespace, clusterName, target.Name)
+		if err := destination.Client.RemoveObject(ctx, destination.Bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+		if err := h.setPruned(namespace, clusterName, path.Base(object.Key), target.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneS3 removes the snapshots of the cluster from its S3 target that are not kept by the S3 retention. It only applies
+// the retention if the snapshot is the most recent one of the cluster, i.e. when a snapshot was added. Snapshots are
+// only removed once they were replicated to all targets. Their etcdsnapshot objects are removed once the nodes notice
+// the snapshots are gone from S3.
+func (h *handler) pruneS3(snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane) error {
+	snapshots, err := h.etcdSnapshotCache.List(snapshot.Namespace, labels.SelectorFromSet(map[string]string{
+		capr.ClusterNameLabel: snapshot.Spec.ClusterName,
+	}))
+	if err != nil {
+		return err
+	}
+
+	var (
+		objects   []snapshotObject
+		byName    = map[string]*rkev1.ETCDSnapshot{}
+		createdAt = snapshotCreatedAt(snapshot)
+	)
+	for _, s3Snapshot := range snapshots {
+		if s3Snapshot.DeletionTimestamp != nil || s3Snapshot.SnapshotFile.S3 == nil || s3Snapshot.Status.Missing {
+			continue
+		}
+		if snapshotCreatedAt(s3Snapshot).After(createdAt) {
+			return nil
+		}
+		objects = append(objects, snapshotObject{Key: s3Snapshot.Name, CreatedAt: snapshotCreatedAt(s3Snapshot)})
+		byName[s3Snapshot.Name] = s3Snapshot
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, transferTimeout)
+	defer cancel()
+
+	keep := retained(objects, controlPlane.Spec.ETCD.S3Retention, time.Now())
+	for _, object := range objects {
+		s3Snapshot := byName[object.Key]
+		if keep[object.Key] || !replicatedToTargets(s3Snapshot, controlPlane) {
+			continue
+		}
+		source, err := planner.GetS3Object(h.secretCache, s3Snapshot, controlPlane)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("[etcdsnapshottarget] removing etcd snapshot %s/%s from the S3 target by its retention", s3Snapshot.Namespace, s3Snapshot.Name)
+		if err := source.Client.RemoveObject(ctx, source.Bucket, source.Key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicatedToTargets returns whether the snapshot was replicated to, or already removed from, all targets.
+func replicatedToTargets(snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane) bool {
+	for _, target := range controlPlane.Spec.ETCD.Targets {
+		if target.Name == "" || target.S3 == nil {
+			continue
+		}
+		if status := targetStatus(snapshot.Status.Targets, target.Name); status == nil || !(status.Replicated || status.Pruned) {
+			return false
+		}
+	}
+	return true
+}
+
+func snapshotCreatedAt(snapshot *rkev1.ETCDSnapshot) time.Time {
+	if snapshot.SnapshotFile.CreatedAt != nil {
+		return snapshot.SnapshotFile.CreatedAt.Time
+	}
+	return snapshot.CreationTimestamp.Time
+}
+
+// setPruned records on the etcdsnapshot object of the S3 snapshot, if it still exists, that it was removed from the
+// target.
+func (h *handler) setPruned(namespace, clusterName, snapshotName, targetName string) error {
+	snapshotName = strings.ToLower(sb.InvalidKeyChars.ReplaceAllString(snapshotName, "-"))
+	snapshot, err := h.etcdSnapshots.Get(namespace, name.SafeConcatName(clusterName, snapshotName, sb.StorageS3), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	status := targetStatus(snapshot.Status.Targets, targetName)
+	if status == nil {
+		status = &rkev1.ETCDSnapshotTargetStatus{Name: targetName}
+	}
+	status.Pruned = true
+	status.Message = "removed from target by its retention"
+	snapshot.Status.Targets = setTargetStatus(snapshot.Status.Targets, *status)
+	_, err = h.etcdSnapshots.UpdateStatus(snapshot)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func targetStatus(statuses []rkev1.ETCDSnapshotTargetStatus, name string) *rkev1.ETCDSnapshotTargetStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+func setTargetStatus(statuses []rkev1.ETCDSnapshotTargetStatus, status rkev1.ETCDSnapshotTargetStatus) []rkev1.ETCDSnapshotTargetStatus {
+	for i := range statuses {
+		if statuses[i].Name == status.Name {
+			statuses[i] = status
+			return statuses
+		}
+	}
+	return append(statuses, status)
+}
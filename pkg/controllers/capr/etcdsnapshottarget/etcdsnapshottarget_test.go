@@ -0,0 +1,55 @@
+package etcdsnapshottarget
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicatedToTargets(t *testing.T) {
+	controlPlane := &rkev1.RKEControlPlane{
+		Spec: rkev1.RKEControlPlaneSpec{
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{
+					Targets: []rkev1.ETCDSnapshotTarget{
+						{Name: "offsite", S3: &rkev1.ETCDSnapshotS3{Bucket: "offsite"}},
+						{Name: "archive", S3: &rkev1.ETCDSnapshotS3{Bucket: "archive"}},
+						{Name: "incomplete"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		statuses []rkev1.ETCDSnapshotTargetStatus
+		expected bool
+	}{
+		{
+			name: "not replicated",
+		},
+		{
+			name: "replicated to some targets",
+			statuses: []rkev1.ETCDSnapshotTargetStatus{
+				{Name: "offsite", Replicated: true},
+				{Name: "archive", Message: "access denied"},
+			},
+		},
+		{
+			name: "replicated to or removed from all targets",
+			statuses: []rkev1.ETCDSnapshotTargetStatus{
+				{Name: "offsite", Replicated: true},
+				{Name: "archive", Pruned: true},
+			},
+			expected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := &rkev1.ETCDSnapshot{Status: rkev1.ETCDSnapshotStatus{Targets: tt.statuses}}
+			assert.Equal(t, tt.expected, replicatedToTargets(snapshot, controlPlane))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package etcdsnapshottarget
+
+import (
+	"sort"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+)
+
+// snapshotObject is an etcd snapshot stored in a target.
+type snapshotObject struct {
+	Key       string
+	CreatedAt time.Time
+}
+
+// retained returns the keys of the snapshots that are kept by the retention. All snapshots are kept if the retention
+// has no rules, and the newest snapshot is always kept, even if it is older than the periods of the retention, e.g. once
+// snapshots stopped.
+func retained(objects []snapshotObject, retention *rkev1.ETCDSnapshotRetention, now time.Time) map[string]bool {
+	keep := map[string]bool{}
+	if retention == nil || (retention.Count <= 0 && retention.Daily <= 0 && retention.Weekly <= 0) {
+		for _, object := range objects {
+			keep[object.Key] = true
+		}
+		return keep
+	}
+
+	sorted := make([]snapshotObject, len(objects))
+	copy(sorted, objects)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	if len(sorted) > 0 {
+		keep[sorted[0].Key] = true
+	}
+	for i := 0; i < retention.Count && i < len(sorted); i++ {
+		keep[sorted[i].Key] = true
+	}
+	if retention.Daily > 0 {
+		keepNewestPerPeriod(sorted, keep, startOfDay(now).AddDate(0, 0, -(retention.Daily-1)), startOfDay)
+	}
+	if retention.Weekly > 0 {
+		keepNewestPerPeriod(sorted, keep, startOfWeek(now).AddDate(0, 0, -7*(retention.Weekly-1)), startOfWeek)
+	}
+	return keep
+}
+
+// keepNewestPerPeriod keeps the newest of the sorted snapshots of every period that starts at or after oldest.
+func keepNewestPerPeriod(sorted []snapshotObject, keep map[string]bool, oldest time.Time, periodStart func(time.Time) time.Time) {
+	seen := map[time.Time]bool{}
+	for _, object := range sorted {
+		period := periodStart(object.CreatedAt)
+		if period.Before(oldest) || seen[period] {
+			continue
+		}
+		seen[period] = true
+		keep[object.Key] = true
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// startOfWeek returns the start of the week of t, weeks start on Monday.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
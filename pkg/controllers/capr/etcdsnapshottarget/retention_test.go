@@ -0,0 +1,86 @@
+package etcdsnapshottarget
+
+import (
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetained(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	objects := []snapshotObject{
+		{Key: "wed-1000", CreatedAt: time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)},
+		{Key: "wed-0500", CreatedAt: time.Date(2024, 5, 15, 5, 0, 0, 0, time.UTC)},
+		{Key: "tue-2200", CreatedAt: time.Date(2024, 5, 14, 22, 0, 0, 0, time.UTC)},
+		{Key: "tue-0100", CreatedAt: time.Date(2024, 5, 14, 1, 0, 0, 0, time.UTC)},
+		{Key: "mon-1200", CreatedAt: time.Date(2024, 5, 13, 12, 0, 0, 0, time.UTC)},
+		{Key: "sun-1200", CreatedAt: time.Date(2024, 5, 12, 12, 0, 0, 0, time.UTC)},
+		{Key: "prev-mon", CreatedAt: time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)},
+		{Key: "old", CreatedAt: time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		name      string
+		retention *rkev1.ETCDSnapshotRetention
+		expected  []string
+	}{
+		{
+			name:     "no retention keeps all",
+			expected: []string{"wed-1000", "wed-0500", "tue-2200", "tue-0100", "mon-1200", "sun-1200", "prev-mon", "old"},
+		},
+		{
+			name:      "empty retention keeps all",
+			retention: &rkev1.ETCDSnapshotRetention{},
+			expected:  []string{"wed-1000", "wed-0500", "tue-2200", "tue-0100", "mon-1200", "sun-1200", "prev-mon", "old"},
+		},
+		{
+			name:      "count",
+			retention: &rkev1.ETCDSnapshotRetention{Count: 3},
+			expected:  []string{"wed-1000", "wed-0500", "tue-2200"},
+		},
+		{
+			name:      "daily",
+			retention: &rkev1.ETCDSnapshotRetention{Daily: 3},
+			expected:  []string{"wed-1000", "tue-2200", "mon-1200"},
+		},
+		{
+			name:      "weekly",
+			retention: &rkev1.ETCDSnapshotRetention{Weekly: 2},
+			expected:  []string{"wed-1000", "sun-1200"},
+		},
+		{
+			name:      "combined",
+			retention: &rkev1.ETCDSnapshotRetention{Count: 1, Daily: 2, Weekly: 3},
+			expected:  []string{"wed-1000", "tue-2200", "sun-1200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep := retained(objects, tt.retention, now)
+			var kept []string
+			for _, object := range objects {
+				if keep[object.Key] {
+					kept = append(kept, object.Key)
+				}
+			}
+			assert.Equal(t, tt.expected, kept)
+		})
+	}
+}
+
+func TestRetainedKeepsNewest(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	objects := []snapshotObject{
+		{Key: "older", CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{Key: "newest", CreatedAt: time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	// all snapshots are outside of the periods of the retention, as snapshots stopped
+	keep := retained(objects, &rkev1.ETCDSnapshotRetention{Daily: 3, Weekly: 2}, now)
+	assert.Equal(t, map[string]bool{"newest": true}, keep)
+
+	assert.Empty(t, retained(nil, &rkev1.ETCDSnapshotRetention{Daily: 3}, now))
+}
@@ -0,0 +1,115 @@
+package etcdsnapshotverify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr/planner"
+	rkev1controllers "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/wrangler"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// downloadTimeout is how long downloading an etcd snapshot from S3 to verify it may take.
+const downloadTimeout = 30 * time.Minute
+
+// handler periodically verifies the etcd snapshots stored in S3 against the checksums recorded when they were created,
+// if enabled for the cluster, as it downloads every snapshot. Local snapshots are verified by the nodes they are stored
+// on, see the plansecret controller.
+type handler struct {
+	ctx               context.Context
+	etcdSnapshots     rkev1controllers.ETCDSnapshotController
+	controlPlaneCache rkev1controllers.RKEControlPlaneCache
+	secretCache       corecontrollers.SecretCache
+}
+
+func Register(ctx context.Context, clients *wrangler.Context) {
+	h := &handler{
+		ctx:               ctx,
+		etcdSnapshots:     clients.RKE.ETCDSnapshot(),
+		controlPlaneCache: clients.RKE.RKEControlPlane().Cache(),
+		secretCache:       clients.Core.Secret().Cache(),
+	}
+	clients.RKE.ETCDSnapshot().OnChange(ctx, "etcd-snapshot-verify", h.OnChange)
+}
+
+func (h *handler) OnChange(_ string, snapshot *rkev1.ETCDSnapshot) (*rkev1.ETCDSnapshot, error) {
+	if snapshot == nil || snapshot.DeletionTimestamp != nil || snapshot.SnapshotFile.S3 == nil ||
+		snapshot.SnapshotFile.Checksum == "" || snapshot.Status.Missing {
+		return snapshot, nil
+	}
+
+	controlPlane, err := h.controlPlaneCache.Get(snapshot.Namespace, snapshot.Spec.ClusterName)
+	if apierrors.IsNotFound(err) {
+		return snapshot, nil
+	} else if err != nil {
+		return snapshot, err
+	}
+
+	interval := planner.S3SnapshotVerificationInterval(controlPlane)
+	if interval == 0 {
+		return snapshot, nil
+	}
+
+	if v := snapshot.Status.Verification; v != nil && v.VerifiedAt != nil {
+		if next := time.Until(v.VerifiedAt.Add(interval)); next > 0 {
+			h.etcdSnapshots.EnqueueAfter(snapshot.Namespace, snapshot.Name, next)
+			return snapshot, nil
+		}
+	}
+
+	logrus.Debugf("[etcdsnapshotverify] verifying etcd snapshot %s/%s", snapshot.Namespace, snapshot.Name)
+	var verification *rkev1.ETCDSnapshotVerification
+	if checksum, err := h.checksum(snapshot, controlPlane); err != nil {
+		verification = &rkev1.ETCDSnapshotVerification{
+			VerifiedAt: &metav1.Time{Time: time.Now()},
+			Message:    fmt.Sprintf("failed to download snapshot from S3: %v", err),
+		}
+	} else {
+		verification = planner.VerifyEtcdSnapshotChecksum(snapshot, checksum, time.Now())
+	}
+	if !verification.Valid {
+		logrus.Warnf("[etcdsnapshotverify] etcd snapshot %s/%s failed verification: %s", snapshot.Namespace, snapshot.Name, verification.Message)
+	}
+
+	snapshot = snapshot.DeepCopy()
+	snapshot.Status.Verification = verification
+	snapshot, err = h.etcdSnapshots.UpdateStatus(snapshot)
+	if err != nil {
+		return snapshot, err
+	}
+	h.etcdSnapshots.EnqueueAfter(snapshot.Namespace, snapshot.Name, interval)
+	return snapshot, nil
+}
+
+// checksum downloads the etcd snapshot from S3 and returns its SHA-256 checksum.
+func (h *handler) checksum(snapshot *rkev1.ETCDSnapshot, controlPlane *rkev1.RKEControlPlane) (string, error) {
+	object, err := planner.GetS3Object(h.secretCache, snapshot, controlPlane)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, downloadTimeout)
+	defer cancel()
+
+	reader, err := object.Client.GetObject(ctx, object.Bucket, object.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
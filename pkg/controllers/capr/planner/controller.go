@@ -10,6 +10,7 @@
 	"github.com/rancher/rancher/pkg/capr"
 	caprplanner "github.com/rancher/rancher/pkg/capr/planner"
 	v1 "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	"github.com/rancher/rancher/pkg/wrangler"
 	"github.com/rancher/wrangler/v3/pkg/generic"
 	"github.com/rancher/wrangler/v3/pkg/relatedresource"
@@ -89,7 +90,9 @@ func (h *handler) OnChange(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPla
 	status.ObservedGeneration = cp.Generation
 
 	logrus.Debugf("[planner] rkecluster %s/%s: calling planner process", cp.Namespace, cp.Name)
+	start := time.Now()
 	status, err := h.planner.Process(cp, status)
+	collectors.ObservePlannerReconcile(cp.Spec.ManagementClusterName, reconcileResult(err), time.Since(start))
 	if err != nil {
 		// planner.Process can encounter 3 types of errors:
 		// * planner.errWaiting - This is an error that indicates we are waiting for something, and will not re-enqueue the object
@@ -97,6 +100,11 @@ func (h *handler) OnChange(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPla
 		// * error - All other errors. This should be an actual error during planner processing.
 		if caprplanner.IsErrWaiting(err) {
 			logrus.Infof("[planner] rkecluster %s/%s: %v", cp.Namespace, cp.Name, err)
+			if next, ok := caprplanner.NextMaintenanceWindow(err); ok {
+				h.controlPlanes.EnqueueAfter(cp.Namespace, cp.Name, time.Until(next))
+			} else if caprplanner.IsErrHealthGateFailed(err) {
+				h.controlPlanes.EnqueueAfter(cp.Namespace, cp.Name, caprplanner.HealthGatesRetryInterval)
+			}
 			capr.Ready.SetStatus(&status, "Unknown")
 			capr.Ready.Message(&status, err.Error())
 			capr.Ready.Reason(&status, "Waiting")
@@ -134,3 +142,17 @@ func (h *handler) OnChange(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPla
 	capr.Reconciled.Reason(&status, "")
 	return status, nil
 }
+
+// reconcileResult returns the result of a reconciliation of the planner recorded in metrics.
+func reconcileResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case caprplanner.IsErrWaiting(err):
+		return "waiting"
+	case errors.Is(err, generic.ErrSkip):
+		return "skipped"
+	default:
+		return "error"
+	}
+}
@@ -4,13 +4,16 @@
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"path"
 	"strings"
 	"time"
 
 	v1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/capr"
 	"github.com/rancher/rancher/pkg/capr/planner"
+	"github.com/rancher/rancher/pkg/capr/snapshotcrypt"
 	sb "github.com/rancher/rancher/pkg/controllers/managementuser/snapshotbackpopulate"
 	capicontrollers "github.com/rancher/rancher/pkg/generated/controllers/cluster.x-k8s.io/v1beta1"
 	rkev1controllers "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
@@ -26,12 +29,17 @@
 	"sigs.k8s.io/cluster-api/util/conditions"
 )
 
+// etcdSnapshotChecksumRequeueDelay is how long to wait before recording the checksum of an etcd snapshot whose
+// etcdsnapshot object is not in the cache yet.
+const etcdSnapshotChecksumRequeueDelay = 10 * time.Second
+
 type handler struct {
-	secrets             corecontrollers.SecretClient
+	secrets             corecontrollers.SecretController
 	machinesCache       capicontrollers.MachineCache
 	machinesClient      capicontrollers.MachineClient
 	etcdSnapshotsClient rkev1controllers.ETCDSnapshotClient
 	etcdSnapshotsCache  rkev1controllers.ETCDSnapshotCache
+	controlPlaneCache   rkev1controllers.RKEControlPlaneCache
 }
 
 func Register(ctx context.Context, clients *wrangler.Context) {
@@ -41,6 +49,7 @@ func Register(ctx context.Context, clients *wrangler.Context) {
 		machinesClient:      clients.CAPI.Machine(),
 		etcdSnapshotsClient: clients.RKE.ETCDSnapshot(),
 		etcdSnapshotsCache:  clients.RKE.ETCDSnapshot().Cache(),
+		controlPlaneCache:   clients.RKE.RKEControlPlane().Cache(),
 	}
 	clients.Core.Secret().OnChange(ctx, "plan-secret", h.OnChange)
 }
@@ -69,6 +78,37 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 		}
 	}
 
+	if v, ok := node.PeriodicOutput[planner.EtcdSnapshotEncryptUploadInstructionName]; ok && v.ExitCode == 0 && len(v.Stdout) > 0 && secret.Labels[capr.InitNodeLabel] == "true" {
+		if err := h.reconcileEncryptedEtcdSnapshots(secret, v.Stdout, true); err != nil {
+			logrus.Errorf("[plansecret] error reconciling encrypted S3 snapshot list for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	if v, ok := node.Output[planner.EtcdSnapshotEncryptUploadInstructionName]; ok && len(v) > 0 {
+		if err := h.reconcileEncryptedEtcdSnapshots(secret, v, false); err != nil {
+			logrus.Errorf("[plansecret] error reconciling encrypted S3 snapshot list for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	if v, ok := node.Output[planner.EtcdSnapshotChecksumInstructionName]; ok && len(v) > 0 {
+		if missing, err := h.reconcileEtcdSnapshotChecksums(secret, v, nil); err != nil {
+			logrus.Errorf("[plansecret] error reconciling etcd snapshot checksums for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		} else if listedEtcdSnapshot(node.PeriodicOutput["etcd-snapshot-list-local"].Stdout, missing) {
+			// The etcdsnapshot object of a listed snapshot was just created, the checksum would be lost as the output of
+			// the instruction doesn't change anymore.
+			logrus.Debugf("[plansecret] waiting for etcd snapshots %v of secret %s/%s to record their checksums", missing, secret.Namespace, secret.Name)
+			h.secrets.EnqueueAfter(secret.Namespace, secret.Name, etcdSnapshotChecksumRequeueDelay)
+		}
+	}
+
+	if v, ok := node.PeriodicOutput[planner.EtcdSnapshotChecksumLocalInstructionName]; ok && v.ExitCode == 0 && len(v.Stdout) > 0 {
+		if verifiedAt, err := time.Parse(time.UnixDate, v.LastSuccessfulRunTime); err != nil {
+			logrus.Errorf("[plansecret] error parsing last successful run time of etcd snapshot checksums for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		} else if _, err := h.reconcileEtcdSnapshotChecksums(secret, v.Stdout, &verifiedAt); err != nil {
+			logrus.Errorf("[plansecret] error verifying local etcd snapshots for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
 	appliedChecksum := string(secret.Data["applied-checksum"])
 	failedChecksum := string(secret.Data["failed-checksum"])
 	plan := secret.Data["plan"]
@@ -337,3 +377,226 @@ func generateEtcdSnapshotFromListOutput(input string) (*snapshot, error) {
 	}
 	return nil, fmt.Errorf("input (%s) did not have 3 or 4 fields", input)
 }
+
+// reconcileEtcdSnapshotChecksums records the checksum of the local etcd snapshot a node just created on the
+// etcdsnapshot objects of the local snapshot and its S3 copy, if they don't have a checksum yet, and returns the names
+// of the snapshots that have no etcdsnapshot object yet. If verifiedAt is set, the checksums are the periodic
+// verification of the local snapshots, and the status of their etcdsnapshot objects is updated with the result.
+// Scheduled snapshots are not created through a plan, so their checksums are recorded by the first verification after
+// they were created. The checksums of older snapshots are never recorded, as the snapshots may have been corrupted
+// since they were created, and their local snapshots are reported as unverifiable.
+func (h *handler) reconcileEtcdSnapshotChecksums(secret *corev1.Secret, output []byte, verifiedAt *time.Time) ([]string, error) {
+	cnl := secret.Labels[capr.ClusterNameLabel]
+	if len(cnl) == 0 {
+		return nil, fmt.Errorf("node secret did not have label %s", capr.ClusterNameLabel)
+	}
+
+	var interval time.Duration
+	if verifiedAt != nil {
+		controlPlane, err := h.controlPlaneCache.Get(secret.Namespace, cnl)
+		if err != nil {
+			return nil, err
+		}
+		interval = planner.SnapshotVerificationInterval(controlPlane)
+	}
+
+	var missing []string
+	for snapshotName, checksum := range outputToEtcdSnapshotChecksums(output) {
+		found := false
+		for _, storage := range []string{sb.StorageLocal, sb.StorageS3} {
+			snapshot, err := h.etcdSnapshotsCache.Get(secret.Namespace, name.SafeConcatName(cnl, snapshotName, storage))
+			if apierrors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			found = true
+
+			if snapshot.SnapshotFile.Checksum == "" && (verifiedAt == nil || createdSince(snapshot, verifiedAt.Add(-2*interval))) {
+				logrus.Debugf("[plansecret] recording checksum %s of etcd snapshot %s/%s", checksum, snapshot.Namespace, snapshot.Name)
+				snapshot = snapshot.DeepCopy()
+				snapshot.SnapshotFile.Checksum = checksum
+				if _, err = h.etcdSnapshotsClient.Update(snapshot); err != nil && !apierrors.IsNotFound(err) {
+					return nil, fmt.Errorf("error while recording checksum of etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+				}
+				continue
+			}
+
+			// S3 snapshots are verified by the etcdsnapshotverify controller
+			if storage != sb.StorageLocal || verifiedAt == nil {
+				continue
+			}
+			if v := snapshot.Status.Verification; v != nil && v.VerifiedAt != nil && !verifiedAt.After(v.VerifiedAt.Time) {
+				continue
+			}
+			verification := planner.VerifyEtcdSnapshotChecksum(snapshot, checksum, *verifiedAt)
+			if snapshot.SnapshotFile.Checksum == "" {
+				if v := snapshot.Status.Verification; v != nil && !v.Valid {
+					// already reported as unverifiable
+					continue
+				}
+				verification.Message = "no checksum was recorded when the snapshot was created, it can't be verified"
+			}
+			snapshot = snapshot.DeepCopy()
+			snapshot.Status.Verification = verification
+			if !snapshot.Status.Verification.Valid {
+				logrus.Warnf("[plansecret] etcd snapshot %s/%s failed verification: %s", snapshot.Namespace, snapshot.Name, snapshot.Status.Verification.Message)
+			}
+			if _, err = h.etcdSnapshotsClient.UpdateStatus(snapshot); err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("error while updating verification of etcd snapshot %s/%s: %w", snapshot.Namespace, snapshot.Name, err)
+			}
+		}
+		if !found {
+			missing = append(missing, snapshotName)
+		}
+	}
+	return missing, nil
+}
+
+// createdSince returns whether the etcd snapshot was created after t. Local etcdsnapshot objects may not record the
+// creation of their snapshot, they are created shortly after it.
+func createdSince(snapshot *v1.ETCDSnapshot, t time.Time) bool {
+	if snapshot.SnapshotFile.CreatedAt != nil {
+		return snapshot.SnapshotFile.CreatedAt.After(t)
+	}
+	return snapshot.CreationTimestamp.After(t)
+}
+
+// listedEtcdSnapshot returns whether one of the snapshots is in the output of etcd-snapshot list.
+func listedEtcdSnapshot(listOutput []byte, snapshotNames []string) bool {
+	if len(snapshotNames) == 0 {
+		return false
+	}
+	listed := map[string]bool{}
+	for _, s := range outputToEtcdSnapshots("", listOutput) {
+		listed[s.Name] = true
+	}
+	for _, snapshotName := range snapshotNames {
+		if listed[snapshotName] {
+			return true
+		}
+	}
+	return false
+}
+
+// outputToEtcdSnapshotChecksums parses the output of sha256sum into a map of the sanitized names of the snapshot files
+// to their checksums.
+func outputToEtcdSnapshotChecksums(output []byte) map[string]string {
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	checksums := map[string]string{}
+	for scanner.Scan() {
+		s := strings.Fields(scanner.Text())
+		if len(s) != 2 || len(s[0]) != 64 {
+			continue
+		}
+		snapshotName := strings.ToLower(sb.InvalidKeyChars.ReplaceAllString(path.Base(s[1]), "-"))
+		checksums[snapshotName] = strings.ToLower(s[0])
+	}
+	return checksums
+}
+
+// reconcileEncryptedEtcdSnapshots creates the etcdsnapshot objects of the encrypted S3 etcd snapshots listed by the agent
+// after uploading the snapshots of a node, and updates the key they are encrypted with. If prune is set, the objects of
+// encrypted snapshots that are not listed anymore are deleted. As the snapshots are uploaded by the agent rather than the
+// runtime, the snapshotbackpopulate controller doesn't know about them.
+func (h *handler) reconcileEncryptedEtcdSnapshots(secret *corev1.Secret, output []byte, prune bool) error {
+	cnl := secret.Labels[capr.ClusterNameLabel]
+	if len(cnl) == 0 {
+		return fmt.Errorf("node secret did not have label %s", capr.ClusterNameLabel)
+	}
+
+	var encryptedSnapshots []snapshotcrypt.Snapshot
+	if err := json.Unmarshal(output, &encryptedSnapshots); err != nil {
+		return fmt.Errorf("error parsing encrypted etcd snapshot list: %w", err)
+	}
+
+	controlPlane, err := h.controlPlaneCache.Get(secret.Namespace, cnl)
+	if err != nil {
+		return err
+	}
+	if !planner.SnapshotEncryptionEnabled(controlPlane) {
+		return nil
+	}
+
+	etcdSnapshots, err := h.etcdSnapshotsCache.List(secret.Namespace, labels.SelectorFromSet(map[string]string{
+		capr.ClusterNameLabel: cnl,
+		capr.NodeNameLabel:    sb.StorageS3,
+	}))
+	if err != nil {
+		return err
+	}
+	indexedEtcdSnapshots := map[string]*v1.ETCDSnapshot{}
+	for _, v := range etcdSnapshots {
+		indexedEtcdSnapshots[v.Name] = v
+	}
+
+	listed := map[string]bool{}
+	for _, v := range encryptedSnapshots {
+		snapshotName := name.SafeConcatName(cnl, strings.ToLower(sb.InvalidKeyChars.ReplaceAllString(v.Name, "-")), sb.StorageS3)
+		listed[snapshotName] = true
+
+		if existing, ok := indexedEtcdSnapshots[snapshotName]; ok {
+			// the checksum is only listed right after the snapshot was uploaded, it is recorded if the object was
+			// created from an earlier listing. A checksum recorded for another key is of another ciphertext.
+			if existing.SnapshotFile.EncryptionKeyID != v.KeyID || (existing.SnapshotFile.Checksum == "" && v.Checksum != "") {
+				existing = existing.DeepCopy()
+				existing.SnapshotFile.EncryptionKeyID = v.KeyID
+				existing.SnapshotFile.Checksum = v.Checksum
+				if _, err := h.etcdSnapshotsClient.Update(existing); err != nil && !apierrors.IsNotFound(err) {
+					return fmt.Errorf("error while updating etcd snapshot %s/%s: %w", existing.Namespace, existing.Name, err)
+				}
+			}
+			continue
+		}
+
+		snapshot := v1.ETCDSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      snapshotName,
+				Namespace: secret.Namespace,
+				Labels: map[string]string{
+					capr.ClusterNameLabel: cnl,
+					capr.NodeNameLabel:    sb.StorageS3,
+				},
+				Annotations: map[string]string{
+					sb.SnapshotNameKey:      v.Name,
+					sb.StorageAnnotationKey: sb.StorageS3,
+				},
+			},
+			Spec: v1.ETCDSnapshotSpec{
+				ClusterName: cnl,
+			},
+			SnapshotFile: v1.ETCDSnapshotFile{
+				Name:            v.Name,
+				NodeName:        sb.StorageS3,
+				Location:        v.Location,
+				CreatedAt:       &metav1.Time{Time: v.CreatedAt},
+				Size:            v.Size,
+				S3:              controlPlane.Spec.ETCD.S3.DeepCopy(),
+				Status:          "successful",
+				EncryptionKeyID: v.KeyID,
+				Checksum:        v.Checksum,
+			},
+		}
+		if owner := metav1.GetControllerOf(controlPlane); owner != nil {
+			snapshot.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		logrus.Debugf("[plansecret] creating encrypted etcd snapshot %s/%s for cluster %s", snapshot.Namespace, snapshot.Name, cnl)
+		if _, err := h.etcdSnapshotsClient.Create(&snapshot); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error while creating encrypted etcd snapshot: %w", err)
+		}
+	}
+
+	if !prune {
+		return nil
+	}
+	for _, v := range etcdSnapshots {
+		if v.SnapshotFile.EncryptionKeyID == "" || listed[v.Name] {
+			continue
+		}
+		logrus.Infof("[plansecret] Deleting encrypted etcd snapshot %s/%s as it is not in S3 anymore", v.Namespace, v.Name)
+		if err := h.etcdSnapshotsClient.Delete(v.Namespace, v.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
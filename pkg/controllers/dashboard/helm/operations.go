@@ -6,6 +6,7 @@
 
 	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/v3/pkg/kstatus"
 	"github.com/rancher/wrangler/v3/pkg/relatedresource"
@@ -82,6 +83,10 @@ func (o *operationHandler) onOperationChange(operation *catalog.Operation, statu
 			status.PodCreated = true
 			kstatus.SetTransitioning(&status, "running operation")
 		} else if container.State.Terminated != nil {
+			if !completed(operation) {
+				collectors.ObserveHelmOperation(status.Action, container.State.Terminated.FinishedAt.Sub(operation.CreationTimestamp.Time),
+					container.State.Terminated.ExitCode == 0)
+			}
 			status.PodCreated = true
 			if container.State.Terminated.ExitCode == 0 {
 				kstatus.SetActive(&status)
@@ -104,6 +109,11 @@ func (o *operationHandler) onOperationChange(operation *catalog.Operation, statu
 	return status, nil
 }
 
+// completed returns whether the status of the operation already reflects the completion of its pod.
+func completed(operation *catalog.Operation) bool {
+	return operation.Status.PodCreated && kstatus.Reconciling.IsFalse(operation)
+}
+
 func (o *operationHandler) cleanup(pod *corev1.Pod) error {
 	running := false
 	success := false
@@ -13,9 +13,11 @@
 
 	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/catalogv2"
+	"github.com/rancher/rancher/pkg/catalogv2/content"
 	"github.com/rancher/rancher/pkg/catalogv2/git"
 	helmhttp "github.com/rancher/rancher/pkg/catalogv2/http"
 	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	namespaces "github.com/rancher/rancher/pkg/namespace"
 	"github.com/rancher/wrangler/v3/pkg/apply"
 	"github.com/rancher/wrangler/v3/pkg/condition"
@@ -275,7 +277,9 @@ func (r *repoHandler) download(repository *catalog.ClusterRepo, newStatus *catal
 		} else {
 			newStatus.URL = repoSpec.GitRepo
 			newStatus.Branch = repoSpec.GitBranch
-			if newStatus.Commit == commit {
+			// The index is rebuilt when the spec changed as its verification policy might have.
+			if newStatus.Commit == commit && newStatus.ObservedGeneration == repository.Generation {
+				collectors.ObserveRepoDownload(repository.Name, "git", time.Since(downloadTime.Time), nil)
 				newStatus.DownloadTime = downloadTime
 				return setErrorCondition(repository, err, newStatus, interval, repoCondition, r.clusterRepos)
 			}
@@ -289,6 +293,7 @@ func (r *repoHandler) download(repository *catalog.ClusterRepo, newStatus *catal
 	} else {
 		return setErrorCondition(repository, err, newStatus, interval, repoCondition, r.clusterRepos)
 	}
+	collectors.ObserveRepoDownload(repository.Name, repoType(repoSpec), time.Since(downloadTime.Time), err)
 	if retriable && err != nil {
 		newStatus.NumberOfRetries++
 		if newStatus.NumberOfRetries > retryPolicy.MaxRetry {
@@ -303,6 +308,14 @@ func (r *repoHandler) download(repository *catalog.ClusterRepo, newStatus *catal
 		return setErrorCondition(repository, err, newStatus, interval, repoCondition, r.clusterRepos)
 	}
 
+	if repoSpec.Verification != nil {
+		verifier, err := content.Verifier(r.secrets, &repoSpec)
+		if err != nil {
+			return setErrorCondition(repository, err, newStatus, interval, repoCondition, r.clusterRepos)
+		}
+		content.AnnotateVerification(index, verifier, secret, &metadata, &repoSpec, newStatus)
+	}
+
 	index.SortEntries()
 	cm, err := createOrUpdateMap(metadata.Namespace, index, owner, r.apply)
 	if err != nil {
@@ -317,6 +330,14 @@ func (r *repoHandler) download(repository *catalog.ClusterRepo, newStatus *catal
 	return setErrorCondition(repository, nil, newStatus, interval, repoCondition, r.clusterRepos)
 }
 
+// repoType returns the type of the ClusterRepo recorded in metrics.
+func repoType(repoSpec catalog.RepoSpec) string {
+	if repoSpec.GitRepo != "" {
+		return "git"
+	}
+	return "http"
+}
+
 func ensureIndexConfigMap(status *catalog.RepoStatus, configMap corev1controllers.ConfigMapClient) error {
 	// Charts from the clusterRepo will be unavailable if the IndexConfigMap recorded in the status does not exist.
 	// By resetting the value of IndexConfigMapName, IndexConfigMapNamespace, IndexConfigMapResourceVersion to "",
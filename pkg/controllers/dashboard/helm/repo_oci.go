@@ -16,11 +16,13 @@
 
 	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/catalogv2"
+	"github.com/rancher/rancher/pkg/catalogv2/content"
 	"github.com/rancher/rancher/pkg/catalogv2/oci"
 	"github.com/rancher/rancher/pkg/catalogv2/oci/capturewindowclient"
 	"github.com/rancher/rancher/pkg/catalogv2/roundtripper"
 	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
 	corev1 "github.com/rancher/rancher/pkg/generated/norman/core/v1"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	"github.com/rancher/wrangler/v3/pkg/apply"
 	corev1controllers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
 	"github.com/sirupsen/logrus"
@@ -158,7 +160,9 @@ func (o *OCIRepohandler) onClusterRepoChange(key string, clusterRepo *catalog.Cl
 		return nil, fmt.Errorf("failed to create an OCI client for url %s: %w", clusterRepo.Spec.URL, err)
 	}
 
+	start := time.Now()
 	index, err = oci.GenerateIndex(ociClient, clusterRepo.Spec.URL, secret, clusterRepo.Spec, *newStatus, index)
+	collectors.ObserveRepoDownload(clusterRepo.Name, "oci", time.Since(start), err)
 	// If there is 401 or 403 error code, then we don't reconcile further and wait for 24 hours interval
 	var errResp *errcode.ErrorResponse
 	// If there is 429 error code and max retry is reached, then we don't reconcile further and wait for 24 hours interval,
@@ -206,6 +210,12 @@ func (o *OCIRepohandler) onClusterRepoChange(key string, clusterRepo *catalog.Cl
 		return setErrorCondition(clusterRepo, err, newStatus, ociInterval, ociCondition, o.clusterRepoController)
 	}
 
+	verifier, err := content.Verifier(o.secretCacheController, &clusterRepo.Spec)
+	if err != nil {
+		return setErrorCondition(clusterRepo, err, newStatus, ociInterval, ociCondition, o.clusterRepoController)
+	}
+	content.AnnotateVerification(index, verifier, secret, &clusterRepo.ObjectMeta, &clusterRepo.Spec, newStatus)
+
 	newIndexBytes, err := json.Marshal(index)
 	if err != nil {
 		logrus.Errorf("Error while marshalling indexfile for cluster repo %s: %v", clusterRepo.Name, err)
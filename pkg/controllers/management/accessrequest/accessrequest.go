@@ -0,0 +1,279 @@
+// Package accessrequest grants the access requested by approved AccessRequests for the requested duration.
+package accessrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/util"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/ref"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/wrangler"
+	rbaccontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/rbac/v1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	controllerName = "mgmt-access-request-controller"
+
+	// AccessRequestLabel is set on the bindings created for approved access requests and holds the name of the request.
+	AccessRequestLabel = "management.cattle.io/access-request"
+)
+
+type handler struct {
+	accessRequests mgmtcontrollers.AccessRequestController
+	users          mgmtcontrollers.UserCache
+	roleTemplates  mgmtcontrollers.RoleTemplateCache
+	clusters       mgmtcontrollers.ClusterCache
+	projects       mgmtcontrollers.ProjectCache
+	crtbs          mgmtcontrollers.ClusterRoleTemplateBindingClient
+	prtbs          mgmtcontrollers.ProjectRoleTemplateBindingClient
+	grbs           mgmtcontrollers.GlobalRoleBindingCache
+
+	clusterRoles            rbaccontrollers.ClusterRoleClient
+	clusterRoleCache        rbaccontrollers.ClusterRoleCache
+	clusterRoleBindings     rbaccontrollers.ClusterRoleBindingClient
+	clusterRoleBindingCache rbaccontrollers.ClusterRoleBindingCache
+
+	now func() time.Time
+}
+
+// Register registers the controller granting and expiring the access of AccessRequests.
+func Register(ctx context.Context, wContext *wrangler.Context) {
+	h := &handler{
+		accessRequests: wContext.Mgmt.AccessRequest(),
+		users:          wContext.Mgmt.User().Cache(),
+		roleTemplates:  wContext.Mgmt.RoleTemplate().Cache(),
+		clusters:       wContext.Mgmt.Cluster().Cache(),
+		projects:       wContext.Mgmt.Project().Cache(),
+		crtbs:          wContext.Mgmt.ClusterRoleTemplateBinding(),
+		prtbs:          wContext.Mgmt.ProjectRoleTemplateBinding(),
+		grbs:           wContext.Mgmt.GlobalRoleBinding().Cache(),
+
+		clusterRoles:            wContext.RBAC.ClusterRole(),
+		clusterRoleCache:        wContext.RBAC.ClusterRole().Cache(),
+		clusterRoleBindings:     wContext.RBAC.ClusterRoleBinding(),
+		clusterRoleBindingCache: wContext.RBAC.ClusterRoleBinding().Cache(),
+
+		now: time.Now,
+	}
+	wContext.Mgmt.AccessRequest().OnChange(ctx, controllerName, h.sync)
+	wContext.Mgmt.GlobalRoleBinding().OnChange(ctx, controllerName+"-approvers", func(_ string, grb *v3.GlobalRoleBinding) (*v3.GlobalRoleBinding, error) {
+		return grb, h.syncApprovers()
+	})
+	wContext.Mgmt.Setting().OnChange(ctx, controllerName+"-approver-settings", func(_ string, setting *v3.Setting) (*v3.Setting, error) {
+		if setting == nil || (setting.Name != settings.AccessRequestApproverGlobalRoles.Name && setting.Name != settings.AccessRequestApproverGroups.Name) {
+			return setting, nil
+		}
+		return setting, h.syncApprovers()
+	})
+}
+
+// ValidateSpec validates the fields of an access request that don't depend on other resources.
+func ValidateSpec(spec *v3.AccessRequestSpec) error {
+	if spec.UserName == "" {
+		return fmt.Errorf("userName is required")
+	}
+	if spec.RoleTemplateName == "" {
+		return fmt.Errorf("roleTemplateName is required")
+	}
+	if (spec.ClusterName == "") == (spec.ProjectName == "") {
+		return fmt.Errorf("exactly one of clusterName and projectName must be set")
+	}
+	if spec.ProjectName != "" {
+		if clusterName, projectName := ref.Parse(spec.ProjectName); clusterName == "" || projectName == "" {
+			return fmt.Errorf("projectName %q must be in the format clusterName:projectName", spec.ProjectName)
+		}
+	}
+	if strings.TrimSpace(spec.Justification) == "" {
+		return fmt.Errorf("justification is required")
+	}
+	if spec.Duration.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if maxMinutes := settings.AccessRequestMaxDurationMinutes.GetInt(); maxMinutes > 0 {
+		if maxDuration := time.Duration(maxMinutes) * time.Minute; spec.Duration.Duration > maxDuration {
+			return fmt.Errorf("duration %s exceeds the maximum of %s", spec.Duration.Duration, maxDuration)
+		}
+	}
+	return nil
+}
+
+func (h *handler) sync(_ string, obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+	if obj == nil || obj.DeletionTimestamp != nil {
+		return obj, nil
+	}
+	if err := h.ensureRequesterAccess(obj); err != nil {
+		return obj, err
+	}
+
+	switch obj.Status.State {
+	case "":
+		return h.validate(obj)
+	case v3.AccessRequestStateApproved:
+		return h.grant(obj)
+	case v3.AccessRequestStateActive:
+		return h.expire(obj)
+	}
+	return obj, nil
+}
+
+// validate moves new requests to the pending state, or to the failed state if they can't be granted.
+func (h *handler) validate(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+	invalid, err := h.invalidReason(obj)
+	if err != nil {
+		return obj, err
+	}
+	if invalid != "" {
+		return h.setState(obj, v3.AccessRequestStateFailed, invalid)
+	}
+	return h.setState(obj, v3.AccessRequestStatePending, "Waiting for approval")
+}
+
+// invalidReason returns why the request can't be granted, or an empty string if it can.
+func (h *handler) invalidReason(obj *v3.AccessRequest) (string, error) {
+	if err := ValidateSpec(&obj.Spec); err != nil {
+		return err.Error(), nil
+	}
+
+	if _, err := h.users.Get(obj.Spec.UserName); err != nil {
+		return notFoundReason(err, "user %s not found", obj.Spec.UserName)
+	}
+
+	roleTemplate, err := h.roleTemplates.Get(obj.Spec.RoleTemplateName)
+	if err != nil {
+		return notFoundReason(err, "role template %s not found", obj.Spec.RoleTemplateName)
+	}
+	if roleTemplate.Locked {
+		return fmt.Sprintf("role template %s is locked", roleTemplate.Name), nil
+	}
+
+	if obj.Spec.ClusterName != "" {
+		if roleTemplate.Context != "cluster" {
+			return fmt.Sprintf("role template %s can't be used for a cluster", roleTemplate.Name), nil
+		}
+		if _, err := h.clusters.Get(obj.Spec.ClusterName); err != nil {
+			return notFoundReason(err, "cluster %s not found", obj.Spec.ClusterName)
+		}
+		return "", nil
+	}
+
+	if roleTemplate.Context != "project" {
+		return fmt.Sprintf("role template %s can't be used for a project", roleTemplate.Name), nil
+	}
+	clusterName, projectName := ref.Parse(obj.Spec.ProjectName)
+	if _, err := h.projects.Get(clusterName, projectName); err != nil {
+		return notFoundReason(err, "project %s not found", obj.Spec.ProjectName)
+	}
+	return "", nil
+}
+
+// grant creates the binding granting the access of an approved request.
+func (h *handler) grant(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+	reviewedAt := h.now()
+	if obj.Status.ReviewedAt != nil {
+		reviewedAt = obj.Status.ReviewedAt.Time
+	}
+	expiresAt := metav1.NewTime(reviewedAt.Add(obj.Spec.Duration.Duration))
+
+	meta := metav1.ObjectMeta{
+		Name:   obj.Name,
+		Labels: map[string]string{AccessRequestLabel: obj.Name},
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: v3.SchemeGroupVersion.String(),
+			Kind:       "AccessRequest",
+			Name:       obj.Name,
+			UID:        obj.UID,
+		}},
+	}
+
+	var uri string
+	if obj.Spec.ClusterName != "" {
+		meta.Namespace = obj.Spec.ClusterName
+		_, err := h.crtbs.Create(&v3.ClusterRoleTemplateBinding{
+			ObjectMeta:       meta,
+			ClusterName:      obj.Spec.ClusterName,
+			UserName:         obj.Spec.UserName,
+			RoleTemplateName: obj.Spec.RoleTemplateName,
+			ExpiresAt:        &expiresAt,
+		})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return obj, err
+		}
+		uri = "/apis/management.cattle.io/v3/namespaces/" + meta.Namespace + "/clusterroletemplatebindings/" + meta.Name
+	} else {
+		clusterName, projectName := ref.Parse(obj.Spec.ProjectName)
+		project, err := h.projects.Get(clusterName, projectName)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return h.setState(obj, v3.AccessRequestStateFailed, fmt.Sprintf("project %s not found", obj.Spec.ProjectName))
+			}
+			return obj, err
+		}
+		meta.Namespace = project.Name
+		if project.Status.BackingNamespace != "" {
+			meta.Namespace = project.Status.BackingNamespace
+		}
+		_, err = h.prtbs.Create(&v3.ProjectRoleTemplateBinding{
+			ObjectMeta:       meta,
+			ProjectName:      obj.Spec.ProjectName,
+			UserName:         obj.Spec.UserName,
+			RoleTemplateName: obj.Spec.RoleTemplateName,
+			ExpiresAt:        &expiresAt,
+		})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return obj, err
+		}
+		uri = "/apis/management.cattle.io/v3/namespaces/" + meta.Namespace + "/projectroletemplatebindings/" + meta.Name
+	}
+
+	logrus.Infof("[%s] Granted role template %s to user %s until %s for access request %s", controllerName,
+		obj.Spec.RoleTemplateName, obj.Spec.UserName, expiresAt.UTC().Format(time.RFC3339), obj.Name)
+	util.AuditSystemAction(http.MethodPost, uri, map[string]string{AccessRequestLabel: obj.Name})
+
+	obj = obj.DeepCopy()
+	obj.Status.State = v3.AccessRequestStateActive
+	obj.Status.Message = "Access granted until " + expiresAt.UTC().Format(time.RFC3339)
+	obj.Status.BindingName = meta.Namespace + ":" + meta.Name
+	obj.Status.ExpiresAt = &expiresAt
+	obj, err := h.accessRequests.UpdateStatus(obj)
+	if err != nil {
+		return obj, err
+	}
+	return h.expire(obj)
+}
+
+// expire moves active requests to the expired state once their access window has closed.
+// The binding itself is deleted when it expires.
+func (h *handler) expire(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+	if obj.Status.ExpiresAt == nil {
+		return obj, nil
+	}
+	if remaining := obj.Status.ExpiresAt.Sub(h.now()); remaining > 0 {
+		h.accessRequests.EnqueueAfter(obj.Name, remaining)
+		return obj, nil
+	}
+	return h.setState(obj, v3.AccessRequestStateExpired, "Access expired at "+obj.Status.ExpiresAt.UTC().Format(time.RFC3339))
+}
+
+func (h *handler) setState(obj *v3.AccessRequest, state, message string) (*v3.AccessRequest, error) {
+	obj = obj.DeepCopy()
+	obj.Status.State = state
+	obj.Status.Message = message
+	return h.accessRequests.UpdateStatus(obj)
+}
+
+// notFoundReason returns the formatted reason if err is a not found error and err otherwise.
+func notFoundReason(err error, format string, args ...any) (string, error) {
+	if apierrors.IsNotFound(err) {
+		return fmt.Sprintf(format, args...), nil
+	}
+	return "", err
+}
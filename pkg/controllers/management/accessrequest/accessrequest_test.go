@@ -0,0 +1,300 @@
+package accessrequest
+
+import (
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type mocks struct {
+	accessRequests *fake.MockNonNamespacedControllerInterface[*v3.AccessRequest, *v3.AccessRequestList]
+	users          *fake.MockNonNamespacedCacheInterface[*v3.User]
+	roleTemplates  *fake.MockNonNamespacedCacheInterface[*v3.RoleTemplate]
+	clusters       *fake.MockNonNamespacedCacheInterface[*v3.Cluster]
+	projects       *fake.MockCacheInterface[*v3.Project]
+	crtbs          *fake.MockClientInterface[*v3.ClusterRoleTemplateBinding, *v3.ClusterRoleTemplateBindingList]
+	prtbs          *fake.MockClientInterface[*v3.ProjectRoleTemplateBinding, *v3.ProjectRoleTemplateBindingList]
+	grbs           *fake.MockNonNamespacedCacheInterface[*v3.GlobalRoleBinding]
+
+	clusterRoles            *fake.MockNonNamespacedClientInterface[*rbacv1.ClusterRole, *rbacv1.ClusterRoleList]
+	clusterRoleCache        *fake.MockNonNamespacedCacheInterface[*rbacv1.ClusterRole]
+	clusterRoleBindings     *fake.MockNonNamespacedClientInterface[*rbacv1.ClusterRoleBinding, *rbacv1.ClusterRoleBindingList]
+	clusterRoleBindingCache *fake.MockNonNamespacedCacheInterface[*rbacv1.ClusterRoleBinding]
+}
+
+func newHandler(t *testing.T, now time.Time) (*handler, *mocks) {
+	ctrl := gomock.NewController(t)
+	m := &mocks{
+		accessRequests: fake.NewMockNonNamespacedControllerInterface[*v3.AccessRequest, *v3.AccessRequestList](ctrl),
+		users:          fake.NewMockNonNamespacedCacheInterface[*v3.User](ctrl),
+		roleTemplates:  fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl),
+		clusters:       fake.NewMockNonNamespacedCacheInterface[*v3.Cluster](ctrl),
+		projects:       fake.NewMockCacheInterface[*v3.Project](ctrl),
+		crtbs:          fake.NewMockClientInterface[*v3.ClusterRoleTemplateBinding, *v3.ClusterRoleTemplateBindingList](ctrl),
+		prtbs:          fake.NewMockClientInterface[*v3.ProjectRoleTemplateBinding, *v3.ProjectRoleTemplateBindingList](ctrl),
+		grbs:           fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRoleBinding](ctrl),
+
+		clusterRoles:            fake.NewMockNonNamespacedClientInterface[*rbacv1.ClusterRole, *rbacv1.ClusterRoleList](ctrl),
+		clusterRoleCache:        fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl),
+		clusterRoleBindings:     fake.NewMockNonNamespacedClientInterface[*rbacv1.ClusterRoleBinding, *rbacv1.ClusterRoleBindingList](ctrl),
+		clusterRoleBindingCache: fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRoleBinding](ctrl),
+	}
+	m.accessRequests.EXPECT().UpdateStatus(gomock.Any()).DoAndReturn(func(obj *v3.AccessRequest) (*v3.AccessRequest, error) {
+		return obj, nil
+	}).AnyTimes()
+	m.clusterRoleCache.EXPECT().Get("access-request-ar-abcde").Return(&rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "access-request-ar-abcde"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"management.cattle.io"}, Resources: []string{"accessrequests"}, ResourceNames: []string{"ar-abcde"}, Verbs: []string{"get", "list", "watch"}}},
+	}, nil).AnyTimes()
+	m.clusterRoleBindingCache.EXPECT().Get("access-request-ar-abcde").Return(&rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "access-request-ar-abcde"},
+		Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: "User", Name: "u-alice"}},
+	}, nil).AnyTimes()
+	return &handler{
+		accessRequests: m.accessRequests,
+		users:          m.users,
+		roleTemplates:  m.roleTemplates,
+		clusters:       m.clusters,
+		projects:       m.projects,
+		crtbs:          m.crtbs,
+		prtbs:          m.prtbs,
+		grbs:           m.grbs,
+
+		clusterRoles:            m.clusterRoles,
+		clusterRoleCache:        m.clusterRoleCache,
+		clusterRoleBindings:     m.clusterRoleBindings,
+		clusterRoleBindingCache: m.clusterRoleBindingCache,
+
+		now: func() time.Time { return now },
+	}, m
+}
+
+func newAccessRequest() *v3.AccessRequest {
+	return &v3.AccessRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "ar-abcde", UID: "ar-uid"},
+		Spec: v3.AccessRequestSpec{
+			UserName:         "u-alice",
+			RoleTemplateName: "cluster-owner",
+			ClusterName:      "c-12345",
+			Justification:    "incident 42",
+			Duration:         metav1.Duration{Duration: 2 * time.Hour},
+		},
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(spec *v3.AccessRequestSpec)
+		wantErr string
+	}{
+		{
+			name:   "valid cluster request",
+			modify: func(spec *v3.AccessRequestSpec) {},
+		},
+		{
+			name: "valid project request",
+			modify: func(spec *v3.AccessRequestSpec) {
+				spec.ClusterName = ""
+				spec.ProjectName = "c-12345:p-12345"
+			},
+		},
+		{
+			name: "cluster and project",
+			modify: func(spec *v3.AccessRequestSpec) {
+				spec.ProjectName = "c-12345:p-12345"
+			},
+			wantErr: "exactly one of clusterName and projectName must be set",
+		},
+		{
+			name: "malformed project",
+			modify: func(spec *v3.AccessRequestSpec) {
+				spec.ClusterName = ""
+				spec.ProjectName = "p-12345"
+			},
+			wantErr: "must be in the format clusterName:projectName",
+		},
+		{
+			name:    "missing justification",
+			modify:  func(spec *v3.AccessRequestSpec) { spec.Justification = " " },
+			wantErr: "justification is required",
+		},
+		{
+			name:    "duration above the maximum",
+			modify:  func(spec *v3.AccessRequestSpec) { spec.Duration.Duration = 9 * time.Hour },
+			wantErr: "exceeds the maximum of 8h0m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newAccessRequest().Spec
+			tt.modify(&spec)
+			err := ValidateSpec(&spec)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSyncValidates(t *testing.T) {
+	h, m := newHandler(t, time.Now())
+	m.users.EXPECT().Get("u-alice").Return(&v3.User{}, nil).AnyTimes()
+	m.clusters.EXPECT().Get("c-12345").Return(&v3.Cluster{}, nil).AnyTimes()
+
+	m.roleTemplates.EXPECT().Get("cluster-owner").Return(&v3.RoleTemplate{Context: "cluster"}, nil)
+	obj, err := h.sync("", newAccessRequest())
+	require.NoError(t, err)
+	assert.Equal(t, v3.AccessRequestStatePending, obj.Status.State)
+
+	m.roleTemplates.EXPECT().Get("cluster-owner").Return(&v3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "cluster-owner"}, Context: "project"}, nil)
+	obj, err = h.sync("", newAccessRequest())
+	require.NoError(t, err)
+	assert.Equal(t, v3.AccessRequestStateFailed, obj.Status.State)
+	assert.Equal(t, "role template cluster-owner can't be used for a cluster", obj.Status.Message)
+
+	m.roleTemplates.EXPECT().Get("cluster-owner").Return(nil, apierrors.NewNotFound(schema.GroupResource{}, "cluster-owner"))
+	obj, err = h.sync("", newAccessRequest())
+	require.NoError(t, err)
+	assert.Equal(t, v3.AccessRequestStateFailed, obj.Status.State)
+	assert.Equal(t, "role template cluster-owner not found", obj.Status.Message)
+}
+
+func TestSyncGrantsAndExpires(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	h, m := newHandler(t, now)
+
+	request := newAccessRequest()
+	request.Status.State = v3.AccessRequestStateApproved
+	request.Status.ReviewedAt = &metav1.Time{Time: now.Add(-time.Minute)}
+
+	var created *v3.ClusterRoleTemplateBinding
+	m.crtbs.EXPECT().Create(gomock.Any()).DoAndReturn(func(crtb *v3.ClusterRoleTemplateBinding) (*v3.ClusterRoleTemplateBinding, error) {
+		created = crtb
+		return crtb, nil
+	})
+	m.accessRequests.EXPECT().EnqueueAfter("ar-abcde", 2*time.Hour-time.Minute)
+
+	obj, err := h.sync("", request)
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.Equal(t, "c-12345", created.Namespace)
+	assert.Equal(t, "ar-abcde", created.Name)
+	assert.Equal(t, "u-alice", created.UserName)
+	assert.Equal(t, "cluster-owner", created.RoleTemplateName)
+	assert.Equal(t, "ar-abcde", created.Labels[AccessRequestLabel])
+	assert.Equal(t, request.UID, created.OwnerReferences[0].UID)
+	assert.True(t, now.Add(2*time.Hour-time.Minute).Equal(created.ExpiresAt.Time))
+
+	assert.Equal(t, v3.AccessRequestStateActive, obj.Status.State)
+	assert.Equal(t, "c-12345:ar-abcde", obj.Status.BindingName)
+
+	// Once the window has closed, the request expires.
+	h.now = func() time.Time { return now.Add(3 * time.Hour) }
+	obj, err = h.sync("", obj)
+	require.NoError(t, err)
+	assert.Equal(t, v3.AccessRequestStateExpired, obj.Status.State)
+}
+
+func TestSyncGrantsProjectAccess(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	h, m := newHandler(t, now)
+
+	request := newAccessRequest()
+	request.Spec.ClusterName = ""
+	request.Spec.ProjectName = "c-12345:p-12345"
+	request.Status.State = v3.AccessRequestStateApproved
+	request.Status.ReviewedAt = &metav1.Time{Time: now}
+
+	m.projects.EXPECT().Get("c-12345", "p-12345").Return(&v3.Project{
+		ObjectMeta: metav1.ObjectMeta{Name: "p-12345", Namespace: "c-12345"},
+		Status:     v3.ProjectStatus{BackingNamespace: "c-12345-p-12345"},
+	}, nil)
+	var created *v3.ProjectRoleTemplateBinding
+	m.prtbs.EXPECT().Create(gomock.Any()).DoAndReturn(func(prtb *v3.ProjectRoleTemplateBinding) (*v3.ProjectRoleTemplateBinding, error) {
+		created = prtb
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{}, prtb.Name)
+	})
+	m.accessRequests.EXPECT().EnqueueAfter("ar-abcde", 2*time.Hour)
+
+	obj, err := h.sync("", request)
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.Equal(t, "c-12345-p-12345", created.Namespace)
+	assert.Equal(t, "c-12345:p-12345", created.ProjectName)
+	assert.Equal(t, v3.AccessRequestStateActive, obj.Status.State)
+	assert.Equal(t, "c-12345-p-12345:ar-abcde", obj.Status.BindingName)
+}
+
+func TestEnsureRequesterAccess(t *testing.T) {
+	h, m := newHandler(t, time.Now())
+
+	request := newAccessRequest()
+	request.Name = "ar-fghij"
+	m.clusterRoleCache.EXPECT().Get("access-request-ar-fghij").Return(nil, apierrors.NewNotFound(schema.GroupResource{}, "access-request-ar-fghij"))
+	m.clusterRoleBindingCache.EXPECT().Get("access-request-ar-fghij").Return(nil, apierrors.NewNotFound(schema.GroupResource{}, "access-request-ar-fghij"))
+
+	var role *rbacv1.ClusterRole
+	m.clusterRoles.EXPECT().Create(gomock.Any()).DoAndReturn(func(obj *rbacv1.ClusterRole) (*rbacv1.ClusterRole, error) {
+		role = obj
+		return obj, nil
+	})
+	var binding *rbacv1.ClusterRoleBinding
+	m.clusterRoleBindings.EXPECT().Create(gomock.Any()).DoAndReturn(func(obj *rbacv1.ClusterRoleBinding) (*rbacv1.ClusterRoleBinding, error) {
+		binding = obj
+		return obj, nil
+	})
+
+	require.NoError(t, h.ensureRequesterAccess(request))
+	require.NotNil(t, role)
+	assert.Equal(t, []string{"ar-fghij"}, role.Rules[0].ResourceNames, "expected the requester to only see its own request")
+	assert.Equal(t, request.UID, role.OwnerReferences[0].UID)
+	require.NotNil(t, binding)
+	assert.Equal(t, "access-request-ar-fghij", binding.RoleRef.Name)
+	assert.Equal(t, []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: "User", Name: "u-alice"}}, binding.Subjects)
+}
+
+func TestSyncApprovers(t *testing.T) {
+	settings.AccessRequestApproverGroups.Set("github_team://42")
+	defer settings.AccessRequestApproverGroups.Set(settings.AccessRequestApproverGroups.Default)
+
+	h, m := newHandler(t, time.Now())
+	m.grbs.EXPECT().List(gomock.Any()).Return([]*v3.GlobalRoleBinding{
+		{UserName: "u-admin", GlobalRoleName: "admin"},
+		{UserName: "u-bob", GlobalRoleName: "user"},
+		{GroupPrincipalName: "okta_group://admins", GlobalRoleName: "admin"},
+	}, nil)
+	m.clusterRoleCache.EXPECT().Get(approverRoleName).Return(&rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: approverRoleName},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"management.cattle.io"}, Resources: []string{"accessrequests"}, Verbs: []string{"get", "list", "watch"}}},
+	}, nil)
+	m.clusterRoleBindingCache.EXPECT().Get(approverRoleName).Return(&rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: approverRoleName},
+		Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: "User", Name: "u-former-admin"}},
+	}, nil)
+	var binding *rbacv1.ClusterRoleBinding
+	m.clusterRoleBindings.EXPECT().Update(gomock.Any()).DoAndReturn(func(obj *rbacv1.ClusterRoleBinding) (*rbacv1.ClusterRoleBinding, error) {
+		binding = obj
+		return obj, nil
+	})
+
+	require.NoError(t, h.syncApprovers())
+	require.NotNil(t, binding)
+	assert.Equal(t, []rbacv1.Subject{
+		{APIGroup: rbacv1.GroupName, Kind: "Group", Name: "github_team://42"},
+		{APIGroup: rbacv1.GroupName, Kind: "Group", Name: "okta_group://admins"},
+		{APIGroup: rbacv1.GroupName, Kind: "User", Name: "u-admin"},
+	}, binding.Subjects)
+}
@@ -0,0 +1,164 @@
+package accessrequest
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/rbac"
+	"github.com/rancher/rancher/pkg/settings"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// approverRoleName is the name of the ClusterRole and ClusterRoleBinding allowing approvers to see all access requests.
+	approverRoleName = "access-request-approver"
+
+	accessRequestsResource = "accessrequests"
+)
+
+var readVerbs = []string{"get", "list", "watch"}
+
+// requesterRoleName returns the name of the ClusterRole and ClusterRoleBinding allowing the requester to see an access request.
+func requesterRoleName(obj *v3.AccessRequest) string {
+	return "access-request-" + obj.Name
+}
+
+// ensureRequesterAccess allows the requester to see its access request. Users can only see their own requests,
+// the ClusterRole and ClusterRoleBinding are deleted along with the request.
+func (h *handler) ensureRequesterAccess(obj *v3.AccessRequest) error {
+	meta := metav1.ObjectMeta{
+		Name:   requesterRoleName(obj),
+		Labels: map[string]string{AccessRequestLabel: obj.Name},
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: v3.SchemeGroupVersion.String(),
+			Kind:       "AccessRequest",
+			Name:       obj.Name,
+			UID:        obj.UID,
+		}},
+	}
+	if err := h.ensureClusterRole(&rbacv1.ClusterRole{
+		ObjectMeta: meta,
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{v3.SchemeGroupVersion.Group},
+			Resources:     []string{accessRequestsResource},
+			ResourceNames: []string{obj.Name},
+			Verbs:         readVerbs,
+		}},
+	}); err != nil {
+		return err
+	}
+	return h.ensureClusterRoleBinding(&rbacv1.ClusterRoleBinding{
+		ObjectMeta: meta,
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: meta.Name},
+		Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: "User", Name: obj.Spec.UserName}},
+	})
+}
+
+// syncApprovers allows the users bound to an approver global role and the members of an approver group
+// to see all access requests.
+func (h *handler) syncApprovers() error {
+	seen := map[rbacv1.Subject]bool{}
+	var subjects []rbacv1.Subject
+	add := func(subject rbacv1.Subject) {
+		if !seen[subject] {
+			seen[subject] = true
+			subjects = append(subjects, subject)
+		}
+	}
+
+	for _, group := range splitSetting(settings.AccessRequestApproverGroups.Get()) {
+		add(rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: "Group", Name: group})
+	}
+	roles := map[string]bool{}
+	for _, role := range splitSetting(settings.AccessRequestApproverGlobalRoles.Get()) {
+		roles[role] = true
+	}
+	if len(roles) > 0 {
+		grbs, err := h.grbs.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, grb := range grbs {
+			if roles[grb.GlobalRoleName] && grb.DeletionTimestamp == nil {
+				add(rbac.GetGRBSubject(grb))
+			}
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].Kind != subjects[j].Kind {
+			return subjects[i].Kind < subjects[j].Kind
+		}
+		return subjects[i].Name < subjects[j].Name
+	})
+
+	if err := h.ensureClusterRole(&rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: approverRoleName},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{v3.SchemeGroupVersion.Group},
+			Resources: []string{accessRequestsResource},
+			Verbs:     readVerbs,
+		}},
+	}); err != nil {
+		return err
+	}
+	return h.ensureClusterRoleBinding(&rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: approverRoleName},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: approverRoleName},
+		Subjects:   subjects,
+	})
+}
+
+func (h *handler) ensureClusterRole(role *rbacv1.ClusterRole) error {
+	existing, err := h.clusterRoleCache.Get(role.Name)
+	if apierrors.IsNotFound(err) {
+		_, err = h.clusterRoles.Create(role)
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(existing.Rules, role.Rules) {
+		return nil
+	}
+	existing = existing.DeepCopy()
+	existing.Rules = role.Rules
+	_, err = h.clusterRoles.Update(existing)
+	return err
+}
+
+func (h *handler) ensureClusterRoleBinding(binding *rbacv1.ClusterRoleBinding) error {
+	existing, err := h.clusterRoleBindingCache.Get(binding.Name)
+	if apierrors.IsNotFound(err) {
+		_, err = h.clusterRoleBindings.Create(binding)
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(existing.Subjects, binding.Subjects) || (len(existing.Subjects) == 0 && len(binding.Subjects) == 0) {
+		return nil
+	}
+	existing = existing.DeepCopy()
+	existing.Subjects = binding.Subjects
+	_, err = h.clusterRoleBindings.Update(existing)
+	return err
+}
+
+func splitSetting(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
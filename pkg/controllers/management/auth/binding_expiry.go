@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rancher/rancher/pkg/auth/util"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/types/config"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	bindingExpiryControllerName = "mgmt-auth-binding-expiry-controller"
+
+	// BindingExpiredReason is the reason of the events emitted when an expired binding is deleted.
+	BindingExpiredReason = "BindingExpired"
+	// bindingExpiredAuditAnnotation is added to the audit entry of the deletion and holds the expiry time.
+	bindingExpiredAuditAnnotation = "management.cattle.io/binding-expired-at"
+)
+
+// bindingExpiryController deletes ClusterRoleTemplateBindings, ProjectRoleTemplateBindings and GlobalRoleBindings
+// once their expiry time has passed. The RBAC they grant is removed by the controllers handling their removal.
+type bindingExpiryController struct {
+	crtbs    v3.ClusterRoleTemplateBindingInterface
+	prtbs    v3.ProjectRoleTemplateBindingInterface
+	grbs     v3.GlobalRoleBindingInterface
+	recorder record.EventRecorder
+	now      func() time.Time
+}
+
+func newBindingExpiryController(mgmt *config.ManagementContext) *bindingExpiryController {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: mgmt.K8sClient.CoreV1().Events("")})
+
+	return &bindingExpiryController{
+		crtbs:    mgmt.Management.ClusterRoleTemplateBindings(""),
+		prtbs:    mgmt.Management.ProjectRoleTemplateBindings(""),
+		grbs:     mgmt.Management.GlobalRoleBindings(""),
+		recorder: broadcaster.NewRecorder(mgmt.Scheme, v1.EventSource{Component: bindingExpiryControllerName}),
+		now:      time.Now,
+	}
+}
+
+func (c *bindingExpiryController) syncCRTB(key string, obj *v3.ClusterRoleTemplateBinding) (runtime.Object, error) {
+	if obj == nil || obj.DeletionTimestamp != nil || obj.ExpiresAt == nil {
+		return obj, nil
+	}
+	if remaining := obj.ExpiresAt.Sub(c.now()); remaining > 0 {
+		c.crtbs.Controller().EnqueueAfter(obj.Namespace, obj.Name, remaining)
+		return obj, nil
+	}
+
+	if err := c.crtbs.DeleteNamespaced(obj.Namespace, obj.Name, deleteWithUID(obj.UID)); err != nil {
+		return obj, ignoreDeleted(err)
+	}
+	c.recordExpiry(obj, obj.ExpiresAt, "/apis/management.cattle.io/v3/namespaces/"+obj.Namespace+"/clusterroletemplatebindings/"+obj.Name)
+	return obj, nil
+}
+
+func (c *bindingExpiryController) syncPRTB(key string, obj *v3.ProjectRoleTemplateBinding) (runtime.Object, error) {
+	if obj == nil || obj.DeletionTimestamp != nil || obj.ExpiresAt == nil {
+		return obj, nil
+	}
+	if remaining := obj.ExpiresAt.Sub(c.now()); remaining > 0 {
+		c.prtbs.Controller().EnqueueAfter(obj.Namespace, obj.Name, remaining)
+		return obj, nil
+	}
+
+	if err := c.prtbs.DeleteNamespaced(obj.Namespace, obj.Name, deleteWithUID(obj.UID)); err != nil {
+		return obj, ignoreDeleted(err)
+	}
+	c.recordExpiry(obj, obj.ExpiresAt, "/apis/management.cattle.io/v3/namespaces/"+obj.Namespace+"/projectroletemplatebindings/"+obj.Name)
+	return obj, nil
+}
+
+func (c *bindingExpiryController) syncGRB(key string, obj *v3.GlobalRoleBinding) (runtime.Object, error) {
+	if obj == nil || obj.DeletionTimestamp != nil || obj.ExpiresAt == nil {
+		return obj, nil
+	}
+	if remaining := obj.ExpiresAt.Sub(c.now()); remaining > 0 {
+		c.grbs.Controller().EnqueueAfter("", obj.Name, remaining)
+		return obj, nil
+	}
+
+	if err := c.grbs.Delete(obj.Name, deleteWithUID(obj.UID)); err != nil {
+		return obj, ignoreDeleted(err)
+	}
+	c.recordExpiry(obj, obj.ExpiresAt, "/apis/management.cattle.io/v3/globalrolebindings/"+obj.Name)
+	return obj, nil
+}
+
+// recordExpiry emits an event and writes an audit entry for the deletion of an expired binding.
+func (c *bindingExpiryController) recordExpiry(obj runtime.Object, expiresAt *metav1.Time, uri string) {
+	expiredAt := expiresAt.UTC().Format(time.RFC3339)
+	logrus.Infof("[%s] Deleted binding %s which expired at %s", bindingExpiryControllerName, uri, expiredAt)
+	c.recorder.Eventf(obj, v1.EventTypeNormal, BindingExpiredReason, "Binding expired at %s and was deleted", expiredAt)
+	util.AuditSystemAction(http.MethodDelete, uri, map[string]string{bindingExpiredAuditAnnotation: expiredAt})
+}
+
+// ignoreDeleted ignores the errors of deleting a binding that was already deleted or recreated meanwhile.
+func ignoreDeleted(err error) error {
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// deleteWithUID returns delete options that prevent deleting a binding recreated with the same name.
+func deleteWithUID(uid k8stypes.UID) *metav1.DeleteOptions {
+	return &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestBindingExpirySyncCRTB(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var enqueuedAfter time.Duration
+	var deleted []string
+	crtbs := &fakes.ClusterRoleTemplateBindingInterfaceMock{
+		ControllerFunc: func() v3.ClusterRoleTemplateBindingController {
+			return &fakes.ClusterRoleTemplateBindingControllerMock{
+				EnqueueAfterFunc: func(namespace string, name string, after time.Duration) {
+					enqueuedAfter = after
+				},
+			}
+		},
+		DeleteNamespacedFunc: func(namespace string, name string, options *metav1.DeleteOptions) error {
+			require.NotNil(t, options.Preconditions)
+			assert.Equal(t, "crtb-uid", string(*options.Preconditions.UID))
+			deleted = append(deleted, namespace+"/"+name)
+			return nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := &bindingExpiryController{crtbs: crtbs, recorder: recorder, now: func() time.Time { return now }}
+
+	crtb := &v3.ClusterRoleTemplateBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "crtb-1", Namespace: "c-12345", UID: "crtb-uid"},
+		ExpiresAt:  &metav1.Time{Time: now.Add(time.Hour)},
+	}
+
+	// A binding that hasn't expired yet is requeued for its expiry time.
+	_, err := c.syncCRTB("", crtb)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, enqueuedAfter)
+	assert.Empty(t, deleted)
+
+	// A binding without an expiry time is left alone.
+	enqueuedAfter = 0
+	_, err = c.syncCRTB("", &v3.ClusterRoleTemplateBinding{ObjectMeta: metav1.ObjectMeta{Name: "crtb-2"}})
+	require.NoError(t, err)
+	assert.Zero(t, enqueuedAfter)
+	assert.Empty(t, deleted)
+
+	// An expired binding is deleted.
+	now = now.Add(2 * time.Hour)
+	_, err = c.syncCRTB("", crtb)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-12345/crtb-1"}, deleted)
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.Contains(event, BindingExpiredReason), "unexpected event %q", event)
+}
+
+func TestBindingExpirySyncGRB(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var deleteErr error = apierrors.NewConflict(schema.GroupResource{Resource: "globalrolebindings"}, "grb-1", nil)
+	grbs := &fakes.GlobalRoleBindingInterfaceMock{
+		DeleteFunc: func(name string, options *metav1.DeleteOptions) error {
+			return deleteErr
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := &bindingExpiryController{grbs: grbs, recorder: recorder, now: func() time.Time { return now }}
+
+	grb := &v3.GlobalRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "grb-1", UID: "grb-uid"},
+		ExpiresAt:  &metav1.Time{Time: now.Add(-time.Minute)},
+	}
+
+	// The binding was recreated with the same name meanwhile, there is nothing to delete.
+	_, err := c.syncGRB("", grb)
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	deleteErr = nil
+	_, err = c.syncGRB("", grb)
+	require.NoError(t, err)
+	assert.Len(t, recorder.Events, 1)
+	assert.Len(t, grbs.DeleteCalls(), 2)
+
+	// Other errors are retried.
+	deleteErr = apierrors.NewInternalError(assert.AnError)
+	_, err = c.syncGRB("", grb)
+	assert.Error(t, err)
+}
@@ -70,6 +70,7 @@ func RegisterEarly(ctx context.Context, management *config.ManagementContext, cl
 	grbLegacy := newLegacyGRBCleaner(management)
 	rtLegacy := newLegacyRTCleaner(management)
 	prtbServiceAccountFinder := newPRTBServiceAccountController(management)
+	bindingExpiry := newBindingExpiryController(management)
 
 	management.Management.ClusterRoleTemplateBindings("").AddLifecycle(ctx, ctrbMGMTController, crtb)
 	management.Management.ProjectRoleTemplateBindings("").AddLifecycle(ctx, ptrbMGMTController, prtb)
@@ -85,6 +86,9 @@ func RegisterEarly(ctx context.Context, management *config.ManagementContext, cl
 	management.Management.Settings("").AddHandler(ctx, authSettingController, s.sync)
 	management.Management.GlobalRoleBindings("").AddHandler(ctx, "legacy-grb-cleaner", grbLegacy.sync)
 	management.Management.RoleTemplates("").AddHandler(ctx, "legacy-rt-cleaner", rtLegacy.sync)
+	management.Management.ClusterRoleTemplateBindings("").AddHandler(ctx, bindingExpiryControllerName, bindingExpiry.syncCRTB)
+	management.Management.ProjectRoleTemplateBindings("").AddHandler(ctx, bindingExpiryControllerName, bindingExpiry.syncPRTB)
+	management.Management.GlobalRoleBindings("").AddHandler(ctx, bindingExpiryControllerName, bindingExpiry.syncGRB)
 	globalroles.Register(ctx, management, clusterManager)
 }
 
@@ -2,9 +2,12 @@
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/rancher/rancher/pkg/auth/accessreview"
 	"github.com/rancher/rancher/pkg/auth/providerrefresh"
 	"github.com/rancher/rancher/pkg/auth/providers/azure"
+	"github.com/rancher/rancher/pkg/auth/providers/common"
 	"github.com/rancher/rancher/pkg/auth/userretention"
 	"github.com/rancher/rancher/pkg/crondaemon"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
@@ -19,16 +22,21 @@
 type SettingController struct {
 	ensureUserRetentionLabels func() error
 	scheduleUserRetention     func(string) error
+	scheduleAccessReview      func(string) error
+	setPasswordDescription    func(string) error
 }
 
 func newAuthSettingController(ctx context.Context, mgmt *config.ManagementContext) *SettingController {
 	userRetention := userretention.New(mgmt.Wrangler)
 	userRetentionDaemon := crondaemon.New(ctx, "userretention", userRetention.Run)
 	userRetentionLabeler := userretention.NewUserLabeler(ctx, mgmt.Wrangler)
+	accessReviewDaemon := crondaemon.New(ctx, "accessreview", accessreview.New(mgmt.Wrangler).Run)
 
 	return &SettingController{
 		ensureUserRetentionLabels: userRetentionLabeler.EnsureForAll,
 		scheduleUserRetention:     userRetentionDaemon.Schedule,
+		scheduleAccessReview:      accessReviewDaemon.Schedule,
+		setPasswordDescription:    settings.AuthPasswordRequirementsDescription.Set,
 	}
 }
 
@@ -49,12 +57,27 @@ func (c *SettingController) sync(key string, obj *v3.Setting) (runtime.Object, e
 		if err := c.scheduleUserRetention(obj.Value); err != nil {
 			logrus.Errorf("error scheduling user retention daemon: %v", err)
 		}
+	case settings.AccessReviewCron.Name:
+		if err := c.scheduleAccessReview(obj.Value); err != nil {
+			logrus.Errorf("error scheduling access review daemon: %v", err)
+		}
 	case settings.DisableInactiveUserAfter.Name,
 		settings.DeleteInactiveUserAfter.Name,
 		settings.UserLastLoginDefault.Name:
 		if err := c.ensureUserRetentionLabels(); err != nil {
 			logrus.Errorf("error updating retention labels for users: %v", err)
 		}
+	case settings.PasswordMinLength.Name,
+		settings.PasswordRequiredCharacterClasses.Name,
+		settings.PasswordDenyCommon.Name,
+		settings.PasswordHistorySize.Name,
+		settings.PasswordMaxAgeDays.Name:
+		description := common.GetPasswordPolicy().Description()
+		if description != settings.AuthPasswordRequirementsDescription.Get() {
+			if err := c.setPasswordDescription(description); err != nil {
+				return nil, fmt.Errorf("error updating %s: %w", settings.AuthPasswordRequirementsDescription.Name, err)
+			}
+		}
 	}
 	return nil, nil
 }
@@ -3,6 +3,7 @@
 import (
 	"testing"
 
+	"github.com/rancher/rancher/pkg/auth/providers/common"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -60,3 +61,49 @@ func TestSettingsSyncScheduleUserRetention(t *testing.T) {
 		t.Fatalf("Expected scheduleRetentionCalledTimes: %d got %d", want, got)
 	}
 }
+
+func TestSettingsSyncScheduleAccessReview(t *testing.T) {
+	var schedule string
+	controller := &SettingController{
+		scheduleAccessReview: func(value string) error {
+			schedule = value
+			return nil
+		},
+	}
+
+	name := settings.AccessReviewCron.Name
+	_, err := controller.sync(name, &v3.Setting{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Value:      "0 0 1 */3 *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "0 0 1 */3 *", schedule; want != got {
+		t.Fatalf("Expected schedule %q got %q", want, got)
+	}
+}
+
+func TestSettingsSyncPasswordRequirementsDescription(t *testing.T) {
+	var description string
+	controller := &SettingController{
+		setPasswordDescription: func(value string) error {
+			description = value
+			return nil
+		},
+	}
+
+	name := settings.PasswordMinLength.Name
+	_, err := controller.sync(name, &v3.Setting{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Value:      "12",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := common.GetPasswordPolicy().Description(), description; want != got {
+		t.Errorf("Expected description %q got %q", want, got)
+	}
+}
@@ -3,11 +3,11 @@
 import (
 	"context"
 	"reflect"
-	"time"
 
 	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"k8s.io/client-go/kubernetes"
 
+	usercertsexpiration "github.com/rancher/rancher/pkg/controllers/managementuser/certsexpiration"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/rkecerts"
 	"github.com/rancher/rancher/pkg/types/config"
@@ -17,18 +17,21 @@
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
-// This controller handles cert expiration for local cluster only
+// This controller handles cert expiration for the local cluster provisioned by RKE only, the certificates of RKE2 and
+// K3s clusters are tracked by the managementuser controller.
 func Register(ctx context.Context, management *config.ManagementContext) {
 	c := &certsExpiration{
-		clusters:  management.Management.Clusters(""),
-		k8sClient: management.K8sClient,
+		clusters:      management.Management.Clusters(""),
+		notifications: management.Management.RancherUserNotifications(""),
+		k8sClient:     management.K8sClient,
 	}
 	management.Management.Clusters("").AddHandler(ctx, "certificate-expiration", c.sync)
 }
 
 type certsExpiration struct {
-	clusters  v3.ClusterInterface
-	k8sClient kubernetes.Interface
+	clusters      v3.ClusterInterface
+	notifications v3.RancherUserNotificationInterface
+	k8sClient     kubernetes.Interface
 }
 
 func (c *certsExpiration) sync(key string, cluster *v3.Cluster) (runtime.Object, error) {
@@ -57,29 +60,15 @@ func (c *certsExpiration) sync(key string, cluster *v3.Cluster) (runtime.Object,
 			continue
 		}
 		certsExpInfo[certName] = info
-		err = logCertExpirationWarning(certName, info)
-		if err != nil {
-			logrus.Warnf("certificate [%s] from local cluster has or will expire and date is corrupted: %v", certName, err)
-			continue
-		}
 	}
 	// Update certExpiration on cluster obj in order for it to display in API, and the UI if expiring
 	if !reflect.DeepEqual(cluster.Status.CertificatesExpiration, certsExpInfo) {
 		cluster.Status.CertificatesExpiration = certsExpInfo
-		return c.clusters.Update(cluster)
-	}
-	return cluster, nil
-}
-
-func logCertExpirationWarning(name string, certExp v32.CertExpiration) error {
-	date, err := time.Parse(time.RFC3339, certExp.ExpirationDate)
-	if err != nil {
-		return err
-	}
-	if time.Now().UTC().After(date) { // warn if expired
-		logrus.Warnf("Certificate from local cluster has expired: %s", name)
-	} else if time.Now().UTC().AddDate(0, 1, 0).After(date) { // warn if within a month
-		logrus.Warnf("Certificate from local cluster will expire soon: %s", name)
+		updated, err := c.clusters.Update(cluster)
+		if err != nil {
+			return updated, err
+		}
+		cluster = updated
 	}
-	return nil
+	return cluster, usercertsexpiration.Report(c.notifications, cluster, certsExpInfo)
 }
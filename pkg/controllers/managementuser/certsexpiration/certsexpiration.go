@@ -52,6 +52,8 @@ func Register(ctx context.Context, userContext *config.UserContext) {
 		}
 		return obj, nil
 	})
+
+	registerRKE2(ctx, userContext)
 }
 
 func registerDeferred(ctx context.Context, userContext *config.UserContext) {
@@ -0,0 +1,147 @@
+package certsexpiration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	notificationComponent = "certificate-expiration"
+
+	severityExpired  = "expired"
+	severityCritical = "critical"
+	severityWarning  = "warning"
+)
+
+// expiringCertificate is a certificate of a cluster that expired or expires within the warning threshold.
+type expiringCertificate struct {
+	name     string
+	date     time.Time
+	severity string
+}
+
+// Report raises a RancherUserNotification listing the certificates of the cluster that expired or expire within the
+// thresholds of the certs-expiration-warning-days and certs-expiration-critical-days settings, or removes it if none
+// do. The expiration dates are exported as metrics.
+func Report(notifications v3.RancherUserNotificationInterface, cluster *v3.Cluster, certs map[string]v32.CertExpiration) error {
+	expirations := map[string]time.Time{}
+	for name, info := range certs {
+		date, err := time.Parse(time.RFC3339, info.ExpirationDate)
+		if err != nil {
+			logrus.Debugf("failed to parse expiration date of certificate [%s] for cluster [%s]: %v", name, cluster.Name, err)
+			continue
+		}
+		expirations[name] = date
+	}
+
+	expiring := expiringCertificates(expirations, time.Now().UTC())
+	counts := map[string]int{severityExpired: 0, severityCritical: 0, severityWarning: 0}
+	for _, cert := range expiring {
+		counts[cert.severity]++
+	}
+	collectors.SetCertificatesExpiration(cluster.Name, expirations, counts)
+
+	name := notificationName(cluster.Name)
+	existing, err := notifications.Get(name, metav1.GetOptions{})
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return err
+	}
+	if len(expiring) == 0 {
+		if notFound {
+			return nil
+		}
+		if err := notifications.Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	message := notificationMessage(cluster, expiring)
+	if notFound {
+		logrus.Warnf("[certificate-expiration] %s", message)
+		_, err = notifications.Create(&v3.RancherUserNotification{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "management.cattle.io/v3",
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				}},
+			},
+			ComponentName: notificationComponent,
+			Message:       message,
+		})
+		return err
+	}
+	if existing.Message == message {
+		return nil
+	}
+	logrus.Warnf("[certificate-expiration] %s", message)
+	existing = existing.DeepCopy()
+	existing.Message = message
+	_, err = notifications.Update(existing)
+	return err
+}
+
+// expiringCertificates returns the certificates that expired or expire within the warning threshold at now, sorted
+// by expiration date.
+func expiringCertificates(expirations map[string]time.Time, now time.Time) []expiringCertificate {
+	warning := settings.CertsExpirationWarningDays.GetInt()
+	critical := settings.CertsExpirationCriticalDays.GetInt()
+
+	var result []expiringCertificate
+	for name, date := range expirations {
+		var severity string
+		switch {
+		case !now.Before(date):
+			severity = severityExpired
+		case now.AddDate(0, 0, critical).After(date):
+			severity = severityCritical
+		case now.AddDate(0, 0, warning).After(date):
+			severity = severityWarning
+		default:
+			continue
+		}
+		result = append(result, expiringCertificate{name: name, date: date, severity: severity})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].date.Equal(result[j].date) {
+			return result[i].name < result[j].name
+		}
+		return result[i].date.Before(result[j].date)
+	})
+	return result
+}
+
+func notificationMessage(cluster *v3.Cluster, expiring []expiringCertificate) string {
+	clusterName := cluster.Spec.DisplayName
+	if clusterName == "" {
+		clusterName = cluster.Name
+	}
+	certs := make([]string, 0, len(expiring))
+	for _, cert := range expiring {
+		date := cert.date.Format(time.RFC3339)
+		if cert.severity == severityExpired {
+			certs = append(certs, fmt.Sprintf("%s expired on %s", cert.name, date))
+		} else {
+			certs = append(certs, fmt.Sprintf("%s expires on %s (%s)", cert.name, date, cert.severity))
+		}
+	}
+	return fmt.Sprintf("Certificates of cluster %s expired or will expire soon: %s", clusterName, strings.Join(certs, ", "))
+}
+
+func notificationName(clusterName string) string {
+	return notificationComponent + "-" + clusterName
+}
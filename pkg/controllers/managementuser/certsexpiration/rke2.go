@@ -0,0 +1,189 @@
+package certsexpiration
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/namespace"
+	"github.com/rancher/rancher/pkg/rkecerts"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/types/config"
+	"github.com/rancher/wrangler/v3/pkg/ticker"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	rke2SyncInterval = time.Hour
+
+	// Names of the certificates of RKE2 and K3s clusters in Cluster.Status.CertificatesExpiration.
+	apiServerServingCert = "kube-apiserver-serving"
+	clientCACert         = "client-ca"
+	requestHeaderCACert  = "requestheader-client-ca"
+	agentCACert          = "rancher-agent-ca"
+	cacertsCert          = "cacerts"
+
+	authenticationConfigMap = "extension-apiserver-authentication"
+	agentCASecret           = "stv-aggregation"
+)
+
+// RKE2Controller tracks the expiration of the certificates of RKE2 and K3s clusters. Unlike for RKE clusters, Rancher
+// doesn't store them, so they are read from the cluster: the serving certificate of the API server, the serving
+// certificate of the supervisor, the CAs of the client certificates, the CA the Rancher agent trusts and the cacerts
+// setting. The client certificates of the nodes aren't visible through the API of the cluster, the CAs that sign them
+// are tracked instead.
+type RKE2Controller struct {
+	ClusterName   string
+	ClusterLister v3.ClusterLister
+	ClusterClient v3.ClusterInterface
+	Notifications v3.RancherUserNotificationInterface
+	K8s           kubernetes.Interface
+	RESTConfig    *rest.Config
+}
+
+func registerRKE2(ctx context.Context, userContext *config.UserContext) {
+	c := &RKE2Controller{
+		ClusterName:   userContext.ClusterName,
+		ClusterLister: userContext.Management.Management.Clusters("").Controller().Lister(),
+		ClusterClient: userContext.Management.Management.Clusters(""),
+		Notifications: userContext.Management.Management.RancherUserNotifications(""),
+		K8s:           userContext.K8sClient,
+		RESTConfig:    &userContext.RESTConfig,
+	}
+
+	go func() {
+		for range ticker.Context(ctx, rke2SyncInterval) {
+			if err := c.sync(ctx); err != nil {
+				logrus.Errorf("[certificate-expiration] failed to check certificates of cluster [%s]: %v", c.ClusterName, err)
+			}
+		}
+	}()
+}
+
+func (c *RKE2Controller) sync(ctx context.Context) error {
+	cluster, err := c.ClusterLister.Get("", c.ClusterName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cluster.DeletionTimestamp != nil ||
+		(cluster.Status.Driver != v32.ClusterDriverRke2 && cluster.Status.Driver != v32.ClusterDriverK3s) {
+		return nil
+	}
+
+	certsExpInfo, err := c.getCertificatesExpiration(ctx, cluster.Status.Driver)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(cluster.Status.CertificatesExpiration, certsExpInfo) {
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			toUpdate, err := c.ClusterClient.Get(c.ClusterName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			toUpdate.Status.CertificatesExpiration = certsExpInfo
+			cluster, err = c.ClusterClient.Update(toUpdate)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return Report(c.Notifications, cluster, certsExpInfo)
+}
+
+// getCertificatesExpiration returns the expiration dates of the certificates of the cluster of the given driver, rke2
+// or k3s. Certificates that don't exist in the cluster are omitted.
+func (c *RKE2Controller) getCertificatesExpiration(ctx context.Context, driver string) (map[string]v32.CertExpiration, error) {
+	certsExpInfo := map[string]v32.CertExpiration{}
+
+	serving, err := c.getServingCertificate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting serving certificate of the API server: %w", err)
+	}
+	if serving != nil {
+		certsExpInfo[apiServerServingCert] = v32.CertExpiration{
+			ExpirationDate: serving.NotAfter.UTC().Format(time.RFC3339),
+		}
+	}
+
+	supervisorSecret := driver + "-serving"
+	secret, err := c.K8s.CoreV1().Secrets(metav1.NamespaceSystem).Get(ctx, supervisorSecret, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("getting secret [%s]: %w", supervisorSecret, err)
+	} else if err == nil {
+		c.addCertExpiration(certsExpInfo, supervisorSecret, string(secret.Data[corev1.TLSCertKey]))
+	}
+
+	configMap, err := c.K8s.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, authenticationConfigMap, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("getting configmap [%s]: %w", authenticationConfigMap, err)
+	} else if err == nil {
+		c.addCertExpiration(certsExpInfo, clientCACert, configMap.Data["client-ca-file"])
+		c.addCertExpiration(certsExpInfo, requestHeaderCACert, configMap.Data["requestheader-client-ca-file"])
+	}
+
+	secret, err = c.K8s.CoreV1().Secrets(namespace.System).Get(ctx, agentCASecret, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("getting secret [%s]: %w", agentCASecret, err)
+	} else if err == nil {
+		c.addCertExpiration(certsExpInfo, agentCACert, string(secret.Data["ca.crt"]))
+	}
+
+	c.addCertExpiration(certsExpInfo, cacertsCert, settings.CACerts.Get())
+
+	return certsExpInfo, nil
+}
+
+// getServingCertificate returns the certificate the API server of the cluster serves, or nil if it isn't served over
+// TLS.
+func (c *RKE2Controller) getServingCertificate(ctx context.Context) (*x509.Certificate, error) {
+	transport, err := rest.TransportFor(c.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	u, _, err := rest.DefaultServerUrlFor(c.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/version"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	return resp.TLS.PeerCertificates[0], nil
+}
+
+func (c *RKE2Controller) addCertExpiration(certsExpInfo map[string]v32.CertExpiration, certName, certPEM string) {
+	if certPEM == "" {
+		return
+	}
+	info, err := rkecerts.GetCertExpiration(certPEM)
+	if err != nil {
+		logrus.Debugf("failed to get expiration date for certificate [%s] for cluster [%s]: %v", certName, c.ClusterName, err)
+		return
+	}
+	certsExpInfo[certName] = info
+}
@@ -0,0 +1,134 @@
+package certsexpiration
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestGetCertificatesExpiration(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"major":"1","minor":"30"}`))
+	}))
+	defer server.Close()
+
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	expiration := v32.CertExpiration{ExpirationDate: server.Certificate().NotAfter.UTC().Format(time.RFC3339)}
+
+	c := &RKE2Controller{
+		ClusterName: "c-m-abcde",
+		K8s: fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "rke2-serving", Namespace: metav1.NamespaceSystem},
+				Data:       map[string][]byte{corev1.TLSCertKey: []byte(certPEM)},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: authenticationConfigMap, Namespace: metav1.NamespaceSystem},
+				Data:       map[string]string{"client-ca-file": certPEM, "requestheader-client-ca-file": "invalid"},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: agentCASecret, Namespace: "cattle-system"},
+				Data:       map[string][]byte{"ca.crt": []byte(certPEM)},
+			},
+		),
+		RESTConfig: &rest.Config{
+			Host:            server.URL,
+			TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+		},
+	}
+
+	certs, err := c.getCertificatesExpiration(context.Background(), v32.ClusterDriverRke2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]v32.CertExpiration{
+		apiServerServingCert: expiration,
+		"rke2-serving":       expiration,
+		clientCACert:         expiration,
+		agentCACert:          expiration,
+	}, certs)
+
+	// A cluster that can't be reached must not clear the certificates.
+	server.Close()
+	_, err = c.getCertificatesExpiration(context.Background(), v32.ClusterDriverRke2)
+	assert.Error(t, err)
+}
+
+func TestExpiringCertificates(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	expiring := expiringCertificates(map[string]time.Time{
+		"valid":    now.AddDate(1, 0, 0),
+		"warning":  now.AddDate(0, 0, 20),
+		"critical": now.AddDate(0, 0, 3),
+		"expired":  now.AddDate(0, 0, -1),
+	}, now)
+
+	assert.Equal(t, []expiringCertificate{
+		{name: "expired", date: now.AddDate(0, 0, -1), severity: severityExpired},
+		{name: "critical", date: now.AddDate(0, 0, 3), severity: severityCritical},
+		{name: "warning", date: now.AddDate(0, 0, 20), severity: severityWarning},
+	}, expiring)
+}
+
+func TestReport(t *testing.T) {
+	var stored *v3.RancherUserNotification
+	notifications := &fakes.RancherUserNotificationInterfaceMock{
+		GetFunc: func(name string, opts metav1.GetOptions) (*v3.RancherUserNotification, error) {
+			if stored == nil || stored.Name != name {
+				return nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+			}
+			return stored, nil
+		},
+		CreateFunc: func(obj *v3.RancherUserNotification) (*v3.RancherUserNotification, error) {
+			stored = obj
+			return obj, nil
+		},
+		UpdateFunc: func(obj *v3.RancherUserNotification) (*v3.RancherUserNotification, error) {
+			stored = obj
+			return obj, nil
+		},
+		DeleteFunc: func(name string, options *metav1.DeleteOptions) error {
+			stored = nil
+			return nil
+		},
+	}
+	cluster := &v3.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c-m-abcde"},
+		Spec:       v32.ClusterSpec{DisplayName: "downstream"},
+	}
+	expiresIn := func(days int) v32.CertExpiration {
+		return v32.CertExpiration{ExpirationDate: time.Now().UTC().AddDate(0, 0, days).Format(time.RFC3339)}
+	}
+
+	require.NoError(t, Report(notifications, cluster, map[string]v32.CertExpiration{"rke2-serving": expiresIn(365)}))
+	assert.Nil(t, stored)
+
+	require.NoError(t, Report(notifications, cluster, map[string]v32.CertExpiration{"rke2-serving": expiresIn(10)}))
+	require.NotNil(t, stored)
+	assert.Equal(t, "certificate-expiration-c-m-abcde", stored.Name)
+	assert.Equal(t, "c-m-abcde", stored.OwnerReferences[0].Name)
+	assert.Equal(t, notificationComponent, stored.ComponentName)
+	assert.Contains(t, stored.Message, "Certificates of cluster downstream")
+	assert.Contains(t, stored.Message, "rke2-serving expires on")
+	assert.Contains(t, stored.Message, "(warning)")
+
+	require.NoError(t, Report(notifications, cluster, map[string]v32.CertExpiration{"rke2-serving": expiresIn(-1)}))
+	assert.Contains(t, stored.Message, "rke2-serving expired on")
+	assert.Len(t, notifications.UpdateCalls(), 1)
+
+	require.NoError(t, Report(notifications, cluster, map[string]v32.CertExpiration{"rke2-serving": expiresIn(365)}))
+	assert.Nil(t, stored)
+}
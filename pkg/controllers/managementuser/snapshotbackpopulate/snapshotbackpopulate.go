@@ -125,6 +125,11 @@ func (h *handler) OnChange(key string, configMap *corev1.ConfigMap) (runtime.Obj
 	// and no machine can be found for it, go ahead and delete it.
 	// if the snapshot object is found in the configmap, add it to the currentEtcdSnapshotsToKeep for reconciliation
 	for _, existingSnapshotCR := range currentEtcdSnapshots {
+		if existingSnapshotCR.SnapshotFile.EncryptionKeyID != "" {
+			// encrypted snapshots are uploaded by the agent rather than the runtime, so they are never in the configmap.
+			// they are reconciled by the plansecret controller instead.
+			continue
+		}
 		storageLocation, ok := existingSnapshotCR.GetAnnotations()[StorageAnnotationKey]
 		if !ok {
 			storageLocation = StorageLocal
@@ -193,6 +198,9 @@ func (h *handler) OnChange(key string, configMap *corev1.ConfigMap) (runtime.Obj
 				if originalSnapshotFile.Message != "" && snapshot.SnapshotFile.Message == "" {
 					snapshot.SnapshotFile.Message = originalSnapshotFile.Message
 				}
+				if originalSnapshotFile.Checksum != "" && snapshot.SnapshotFile.Checksum == "" {
+					snapshot.SnapshotFile.Checksum = originalSnapshotFile.Checksum
+				}
 				if !equality.Semantic.DeepEqual(snapshot.SnapshotFile, originalSnapshotFile) {
 					updated = true
 					logrus.Debugf("[snapshotbackpopulate] rkecluster %s/%s: snapshot %s/%s SnapshotFile contents were different, triggering update", cluster.Namespace, cluster.Name, snapshot.Namespace, snapshot.Name)
@@ -307,6 +315,7 @@ func (h *handler) configMapToSnapshots(configMap *corev1.ConfigMap, cluster *pro
 				Endpoint:      file.S3.Endpoint,
 				EndpointCA:    file.S3.EndpointCA,
 				SkipSSLVerify: file.S3.SkipSSLVerify,
+				Insecure:      file.S3.Insecure,
 				Bucket:        file.S3.Bucket,
 				Region:        file.S3.Region,
 				Folder:        file.S3.Folder,
@@ -340,6 +349,7 @@ type s3Config struct {
 	Endpoint      string `json:"endpoint,omitempty"`
 	EndpointCA    string `json:"endpointCA,omitempty"`
 	SkipSSLVerify bool   `json:"skipSSLVerify,omitempty"`
+	Insecure      bool   `json:"insecure,omitempty"`
 	Bucket        string `json:"bucket,omitempty"`
 	Region        string `json:"region,omitempty"`
 	Folder        string `json:"folder,omitempty"`
@@ -525,8 +525,10 @@ func rkeControlPlane(cluster *rancherv1.Cluster) (*rkev1.RKEControlPlane, error)
 	// set the corresponding specification for various operations to nil as these cause unnecessary reconciliation.
 	filteredClusterSpec.RKEConfig.ETCDSnapshotRestore = nil
 	filteredClusterSpec.RKEConfig.ETCDSnapshotCreate = nil
+	filteredClusterSpec.RKEConfig.ETCDSnapshotTestRestore = nil
 	filteredClusterSpec.RKEConfig.RotateEncryptionKeys = nil
 	filteredClusterSpec.RKEConfig.RotateCertificates = nil
+	filteredClusterSpec.MaintenanceWindows = nil
 	b64GZCluster, err := capr.CompressInterface(filteredClusterSpec)
 	if err != nil {
 		logrus.Errorf("cluster: %s/%s : error while gz/b64 encoding cluster specification: %v", cluster.Namespace, cluster.Name, err)
@@ -549,8 +551,10 @@ func rkeControlPlane(cluster *rancherv1.Cluster) (*rkev1.RKEControlPlane, error)
 			LocalClusterAuthEndpoint: *cluster.Spec.LocalClusterAuthEndpoint.DeepCopy(),
 			ETCDSnapshotRestore:      rkeConfig.ETCDSnapshotRestore,
 			ETCDSnapshotCreate:       rkeConfig.ETCDSnapshotCreate,
+			ETCDSnapshotTestRestore:  rkeConfig.ETCDSnapshotTestRestore,
 			RotateCertificates:       rkeConfig.RotateCertificates,
 			RotateEncryptionKeys:     rkeConfig.RotateEncryptionKeys,
+			MaintenanceWindows:       cluster.Spec.MaintenanceWindows.DeepCopy(),
 			KubernetesVersion:        cluster.Spec.KubernetesVersion,
 			ManagementClusterName:    cluster.Status.ClusterName, // management cluster
 			AgentEnvVars:             cluster.Spec.AgentEnvVars,
@@ -45,6 +45,7 @@ func BasicCRDs() []string {
 		"podsecurityadmissionconfigurationtemplates.management.cattle.io",
 		"preferences.management.cattle.io",
 		"settings.management.cattle.io",
+		"shellrecordings.management.cattle.io",
 		"navlinks.ui.cattle.io",
 	}
 }
@@ -120,6 +121,8 @@ func ClusterAuthCRDs() []string {
 // MCMCRDs returns a list of CRD names needed for Multi CLuster Management.
 func MCMCRDs() []string {
 	return []string{
+		"accessrequests.management.cattle.io",
+		"accessreviewreports.management.cattle.io",
 		"authconfigs.management.cattle.io",
 		"catalogs.management.cattle.io",
 		"catalogtemplates.management.cattle.io",
@@ -187,6 +190,8 @@ func UIPluginsCRD() []string {
 
 // MigratedResources map list of resource that have been migrated after all resource have a CRD this can be removed.
 var MigratedResources = map[string]bool{
+	"accessrequests.management.cattle.io":                             true,
+	"accessreviewreports.management.cattle.io":                        true,
 	"activedirectoryproviders.management.cattle.io":                   false,
 	"apiservices.management.cattle.io":                                false,
 	"apprevisions.project.cattle.io":                                  false,
@@ -280,6 +285,7 @@ func UIPluginsCRD() []string {
 	"samltokens.management.cattle.io":                                 false,
 	"serviceaccounttokens.project.cattle.io":                          false,
 	"settings.management.cattle.io":                                   false,
+	"shellrecordings.management.cattle.io":                            true,
 	"sshauths.project.cattle.io":                                      false,
 	"templatecontents.management.cattle.io":                           false,
 	"templates.management.cattle.io":                                  false,
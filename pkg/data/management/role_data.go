@@ -81,6 +81,8 @@ func addRoles(wrangler *wrangler.Context, management *config.ManagementContext)
 		addRule().apiGroups("management.cattle.io").resources("clustertemplaterevisions").verbs("create")
 	rb.addRole("View Rancher Metrics", "view-rancher-metrics").
 		addRule().apiGroups("management.cattle.io").resources("ranchermetrics").verbs("get")
+	rb.addRole("View Access Review Reports", "accessreviewreports-view").
+		addRule().apiGroups("management.cattle.io").resources("accessreviewreports").verbs("get", "list", "watch")
 
 	rb.addRole("Admin", "admin").
 		addRule().apiGroups("*").resources("*").verbs("*").
@@ -120,6 +122,9 @@ func addRoles(wrangler *wrangler.Context, management *config.ManagementContext)
 
 	rb.addRole("User Base", "user-base").
 		addRule().apiGroups("management.cattle.io").resources("preferences").verbs("*").
+		addRule().apiGroups("ext.cattle.io").resources("tokens").verbs("*").
+		addRule().apiGroups("ext.cattle.io").resources("permissionreviews").verbs("create").
+		addRule().apiGroups("ext.cattle.io").resources("sessions").verbs("get", "list", "watch", "delete").
 		addRule().apiGroups("management.cattle.io").resources("settings").verbs("get", "list", "watch").
 		addRule().apiGroups("management.cattle.io").resources("features").verbs("get", "list", "watch").
 		addRule().apiGroups("project.cattle.io").resources("sourcecodecredentials").verbs("*").
@@ -464,6 +469,9 @@ func addUserRules(role *roleBuilder) *roleBuilder {
 	role.
 		addRule().apiGroups("management.cattle.io").resources("principals", "roletemplates").verbs("get", "list", "watch").
 		addRule().apiGroups("management.cattle.io").resources("preferences").verbs("*").
+		addRule().apiGroups("ext.cattle.io").resources("tokens").verbs("*").
+		addRule().apiGroups("ext.cattle.io").resources("permissionreviews").verbs("create").
+		addRule().apiGroups("ext.cattle.io").resources("sessions").verbs("get", "list", "watch", "delete").
 		addRule().apiGroups("management.cattle.io").resources("settings").verbs("get", "list", "watch").
 		addRule().apiGroups("management.cattle.io").resources("features").verbs("get", "list", "watch").
 		addRule().apiGroups("management.cattle.io").resources("templates", "templateversions", "catalogs").verbs("get", "list", "watch").
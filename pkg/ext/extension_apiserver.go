@@ -10,6 +10,7 @@
 
 	extstores "github.com/rancher/rancher/pkg/ext/stores"
 	"github.com/rancher/rancher/pkg/features"
+	generatedopenapi "github.com/rancher/rancher/pkg/generated/openapi"
 	"github.com/rancher/rancher/pkg/wrangler"
 	steveext "github.com/rancher/steve/pkg/ext"
 	steveserver "github.com/rancher/steve/pkg/server"
@@ -44,7 +45,7 @@ func NewExtensionAPIServer(wranglerContext *wrangler.Context) (steveserver.Exten
 	aslAuthorizer := steveext.NewAccessSetAuthorizer(wranglerContext.ASL)
 	extOpts := steveext.ExtensionAPIServerOptions{
 		Listener:              ln,
-		GetOpenAPIDefinitions: getOpenAPIDefinitions,
+		GetOpenAPIDefinitions: generatedopenapi.GetOpenAPIDefinitions,
 		OpenAPIDefinitionNameReplacements: map[string]string{
 			// The OpenAPI spec generated from the types in pkg/apis/ext.cattle.io/v1
 			// ends up with the form "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1.<Type>".
@@ -103,7 +104,7 @@ func NewExtensionAPIServer(wranglerContext *wrangler.Context) (steveserver.Exten
 		return nil, fmt.Errorf("new extension API server: %w", err)
 	}
 
-	if err = extstores.InstallStores(extensionAPIServer, scheme); err != nil {
+	if err = extstores.InstallStores(extensionAPIServer, wranglerContext, scheme); err != nil {
 		return nil, fmt.Errorf("install stores: %w", err)
 	}
 
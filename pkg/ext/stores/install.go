@@ -1,24 +1,37 @@
 package stores
 
 import (
+	"fmt"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/ext/stores/permissionreviews"
+	"github.com/rancher/rancher/pkg/ext/stores/sessions"
+	"github.com/rancher/rancher/pkg/ext/stores/tokens"
+	"github.com/rancher/rancher/pkg/wrangler"
 	steveext "github.com/rancher/steve/pkg/ext"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
-func InstallStores(server *steveext.ExtensionAPIServer, scheme *runtime.Scheme) error {
+func InstallStores(server *steveext.ExtensionAPIServer, wranglerContext *wrangler.Context, scheme *runtime.Scheme) error {
 	steveext.AddToScheme(scheme)
+	if err := extv1.AddToScheme(scheme); err != nil {
+		return fmt.Errorf("unable to add ext.cattle.io types to the scheme: %w", err)
+	}
+
+	err := steveext.InstallStore(server, &extv1.Token{}, &extv1.TokenList{}, extv1.TokenResourceName, tokens.SingularName, extv1.SchemeGroupVersion.WithKind("Token"), tokens.New(wranglerContext))
+	if err != nil {
+		return fmt.Errorf("unable to install token store: %w", err)
+	}
+
+	err = steveext.InstallStore(server, &extv1.PermissionReview{}, &extv1.PermissionReviewList{}, extv1.PermissionReviewResourceName, permissionreviews.SingularName, extv1.SchemeGroupVersion.WithKind("PermissionReview"), permissionreviews.New(wranglerContext))
+	if err != nil {
+		return fmt.Errorf("unable to install permission review store: %w", err)
+	}
 
-	// To add a store to the extensionAPIServer, simply call add the types to the *runtime.Scheme and
-	// call InstallStore with the required fields.
-	//
-	// Here's an example:
-	//
-	//	extv1.AddToScheme(scheme)
-	//	store := newMapStore()
-	//	err := steveext.InstallStore(server, &extv1.TestType{}, &extv1.TestTypeList{}, "testtypes", "testtype", extv1.SchemeGroupVersion.WithKind("TestType"), store)
-	//	if err != nil {
-	//		return fmt.Errorf("unable to install mapStore: %w", err)
-	//	}
+	err = steveext.InstallStore(server, &extv1.Session{}, &extv1.SessionList{}, extv1.SessionResourceName, sessions.SingularName, extv1.SchemeGroupVersion.WithKind("Session"), sessions.New(wranglerContext))
+	if err != nil {
+		return fmt.Errorf("unable to install session store: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,531 @@
+// Package permissionreviews implements the ext.cattle.io PermissionReview store, which answers who can do what,
+// where, by resolving the GlobalRoleBindings, ClusterRoleTemplateBindings and ProjectRoleTemplateBindings of Rancher
+// and the role templates they grant.
+package permissionreviews
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/rbac"
+	"github.com/rancher/rancher/pkg/ref"
+	"github.com/rancher/rancher/pkg/wrangler"
+	steveext "github.com/rancher/steve/pkg/ext"
+	rbacv1controllers "github.com/rancher/wrangler/v3/pkg/generated/controllers/rbac/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	rbacv1helpers "k8s.io/kubernetes/pkg/apis/rbac/v1"
+)
+
+const (
+	// SingularName is the singular name of the resource served by the store.
+	SingularName = "permissionreview"
+
+	localCluster = "local"
+)
+
+// Store creates PermissionReviews. Users can review their own permissions. Reviewing the permissions of other
+// principals and the principals allowed to perform an action requires being allowed to list all role bindings.
+type Store struct {
+	userCache          mgmtcontrollers.UserCache
+	userAttributeCache mgmtcontrollers.UserAttributeCache
+	grCache            mgmtcontrollers.GlobalRoleCache
+	grbCache           mgmtcontrollers.GlobalRoleBindingCache
+	rtCache            mgmtcontrollers.RoleTemplateCache
+	crtbCache          mgmtcontrollers.ClusterRoleTemplateBindingCache
+	prtbCache          mgmtcontrollers.ProjectRoleTemplateBindingCache
+	clusterRoleCache   rbacv1controllers.ClusterRoleCache
+}
+
+// New returns a PermissionReview store resolving permissions from the caches of the wrangler context.
+func New(wranglerContext *wrangler.Context) *Store {
+	return &Store{
+		userCache:          wranglerContext.Mgmt.User().Cache(),
+		userAttributeCache: wranglerContext.Mgmt.UserAttribute().Cache(),
+		grCache:            wranglerContext.Mgmt.GlobalRole().Cache(),
+		grbCache:           wranglerContext.Mgmt.GlobalRoleBinding().Cache(),
+		rtCache:            wranglerContext.Mgmt.RoleTemplate().Cache(),
+		crtbCache:          wranglerContext.Mgmt.ClusterRoleTemplateBinding().Cache(),
+		prtbCache:          wranglerContext.Mgmt.ProjectRoleTemplateBinding().Cache(),
+		clusterRoleCache:   wranglerContext.RBAC.ClusterRole().Cache(),
+	}
+}
+
+// Create reviews the spec of the PermissionReview and returns it with the result of the review in its status.
+func (s *Store) Create(ctx steveext.Context, obj *extv1.PermissionReview, opts *metav1.CreateOptions) (*extv1.PermissionReview, error) {
+	if err := validate(obj); err != nil {
+		return nil, err
+	}
+
+	if obj.Spec.User != ctx.User.GetName() {
+		if ok, err := s.canReviewAll(ctx); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, apierrors.NewForbidden(ctx.GroupVersionResource.GroupResource(), obj.Name,
+				fmt.Errorf("can only review the permissions of user %s", ctx.User.GetName()))
+		}
+	}
+
+	var (
+		status extv1.PermissionReviewStatus
+		err    error
+	)
+	if obj.Spec.ResourceAttributes != nil {
+		status, err = s.reviewResourceAttributes(&obj.Spec)
+	} else {
+		status, err = s.reviewPrincipal(&obj.Spec)
+	}
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	result := obj.DeepCopy()
+	result.Status = status
+	result.APIVersion, result.Kind = extv1.SchemeGroupVersion.WithKind("PermissionReview").ToAPIVersionAndKind()
+	return result, nil
+}
+
+// Update isn't supported as PermissionReviews aren't stored.
+func (s *Store) Update(ctx steveext.Context, obj *extv1.PermissionReview, opts *metav1.UpdateOptions) (*extv1.PermissionReview, error) {
+	return nil, apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "update")
+}
+
+// Get isn't supported as PermissionReviews aren't stored.
+func (s *Store) Get(ctx steveext.Context, name string, opts *metav1.GetOptions) (*extv1.PermissionReview, error) {
+	return nil, apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "get")
+}
+
+// List isn't supported as PermissionReviews aren't stored.
+func (s *Store) List(ctx steveext.Context, opts *metav1.ListOptions) (*extv1.PermissionReviewList, error) {
+	return nil, apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "list")
+}
+
+// Watch isn't supported as PermissionReviews aren't stored.
+func (s *Store) Watch(ctx steveext.Context, opts *metav1.ListOptions) (<-chan steveext.WatchEvent[*extv1.PermissionReview], error) {
+	return nil, apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "watch")
+}
+
+// Delete isn't supported as PermissionReviews aren't stored.
+func (s *Store) Delete(ctx steveext.Context, name string, opts *metav1.DeleteOptions) error {
+	return apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "delete")
+}
+
+func validate(obj *extv1.PermissionReview) error {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	spec := obj.Spec
+
+	set := 0
+	for _, v := range []bool{spec.User != "", spec.GroupPrincipal != "", spec.ResourceAttributes != nil} {
+		if v {
+			set++
+		}
+	}
+	if set != 1 {
+		errs = append(errs, field.Invalid(specPath, spec, "exactly one of user, groupPrincipal and resourceAttributes must be set"))
+	}
+
+	if attrs := spec.ResourceAttributes; attrs != nil {
+		attrsPath := specPath.Child("resourceAttributes")
+		if spec.ClusterName == "" {
+			errs = append(errs, field.Required(specPath.Child("clusterName"), "required to review resource attributes"))
+		}
+		if attrs.Verb == "" {
+			errs = append(errs, field.Required(attrsPath.Child("verb"), ""))
+		}
+		if attrs.Resource == "" {
+			errs = append(errs, field.Required(attrsPath.Child("resource"), ""))
+		}
+	}
+
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(extv1.Kind("PermissionReview"), obj.Name, errs)
+	}
+	return nil
+}
+
+// canReviewAll returns true if the requesting user can list all the role bindings of Rancher.
+func (s *Store) canReviewAll(ctx steveext.Context) (bool, error) {
+	for _, resource := range []string{"globalrolebindings", "clusterroletemplatebindings", "projectroletemplatebindings"} {
+		decision, _, err := ctx.Authorizer.Authorize(ctx, authorizer.AttributesRecord{
+			User:            ctx.User,
+			Verb:            "list",
+			APIGroup:        apimgmtv3.SchemeGroupVersion.Group,
+			APIVersion:      apimgmtv3.SchemeGroupVersion.Version,
+			Resource:        resource,
+			ResourceRequest: true,
+		})
+		if err != nil {
+			return false, apierrors.NewInternalError(fmt.Errorf("failed to authorize user %s: %w", ctx.User.GetName(), err))
+		}
+		if decision != authorizer.DecisionAllow {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// subjects are the principals whose permissions are reviewed.
+type subjects struct {
+	userName       string
+	userPrincipals map[string]bool
+	groups         map[string]bool
+}
+
+// principals returns the principals whose permissions are reviewed: either a group principal, or a user
+// along with the group principals the user is a member of.
+func (s *Store) principals(spec *extv1.PermissionReviewSpec) (*subjects, error) {
+	if spec.GroupPrincipal != "" {
+		return &subjects{groups: map[string]bool{spec.GroupPrincipal: true}}, nil
+	}
+
+	result := &subjects{
+		userName:       spec.User,
+		userPrincipals: map[string]bool{},
+		groups:         map[string]bool{},
+	}
+	user, err := s.userCache.Get(spec.User)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if user != nil {
+		for _, principalID := range user.PrincipalIDs {
+			result.userPrincipals[principalID] = true
+		}
+	}
+
+	attribs, err := s.userAttributeCache.Get(spec.User)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if attribs != nil {
+		for _, principals := range attribs.GroupPrincipals {
+			for _, principal := range principals.Items {
+				result.groups[principal.Name] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+// match returns the subject of a binding if it is one of the reviewed principals.
+func (p *subjects) match(userName, userPrincipalName, groupPrincipalName string) (string, bool) {
+	switch {
+	case userName != "" && userName == p.userName:
+		return userName, true
+	case userName == "" && userPrincipalName != "" && p.userPrincipals[userPrincipalName]:
+		return userPrincipalName, true
+	case groupPrincipalName != "" && p.groups[groupPrincipalName]:
+		return groupPrincipalName, true
+	}
+	return "", false
+}
+
+// reviewPrincipal returns the effective global roles, role templates and rules of a user or group principal.
+func (s *Store) reviewPrincipal(spec *extv1.PermissionReviewSpec) (extv1.PermissionReviewStatus, error) {
+	var status extv1.PermissionReviewStatus
+	principals, err := s.principals(spec)
+	if err != nil {
+		return status, err
+	}
+
+	grbs, err := s.grbCache.List(labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	sort.Slice(grbs, func(i, j int) bool { return grbs[i].Name < grbs[j].Name })
+	for _, grb := range grbs {
+		subject, ok := principals.match(grb.UserName, "", grb.GroupPrincipalName)
+		if !ok || grb.DeletionTimestamp != nil {
+			continue
+		}
+		gr, err := s.grCache.Get(grb.GlobalRoleName)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return status, err
+		}
+		status.GlobalRoles = append(status.GlobalRoles, extv1.GlobalRolePermissions{
+			Name:                  gr.Name,
+			Binding:               grb.Name,
+			Subject:               subject,
+			Admin:                 rbac.IsAdminGlobalRole(gr),
+			Rules:                 gr.Rules,
+			InheritedClusterRoles: gr.InheritedClusterRoles,
+		})
+	}
+
+	clusters := map[string]*extv1.ClusterPermissions{}
+	cluster := func(name string) *extv1.ClusterPermissions {
+		if c, ok := clusters[name]; ok {
+			return c
+		}
+		c := &extv1.ClusterPermissions{ClusterName: name}
+		clusters[name] = c
+		return c
+	}
+
+	crtbs, err := s.crtbCache.List("", labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	sort.Slice(crtbs, func(i, j int) bool { return crtbs[i].Namespace+crtbs[i].Name < crtbs[j].Namespace+crtbs[j].Name })
+	for _, crtb := range crtbs {
+		if crtb.DeletionTimestamp != nil || (spec.ClusterName != "" && crtb.ClusterName != spec.ClusterName) {
+			continue
+		}
+		subject, ok := principals.match(crtb.UserName, crtb.UserPrincipalName, crtb.GroupPrincipalName)
+		if !ok {
+			continue
+		}
+		grant, rules, err := s.grant(crtb.RoleTemplateName, crtb.Namespace+"/"+crtb.Name, subject)
+		if err != nil {
+			return status, err
+		}
+		if grant == nil {
+			continue
+		}
+		c := cluster(crtb.ClusterName)
+		c.RoleTemplates = append(c.RoleTemplates, *grant)
+		c.Rules = appendRules(c.Rules, rules)
+	}
+
+	prtbs, err := s.prtbCache.List("", labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	sort.Slice(prtbs, func(i, j int) bool { return prtbs[i].Namespace+prtbs[i].Name < prtbs[j].Namespace+prtbs[j].Name })
+	for _, prtb := range prtbs {
+		clusterName, projectName := ref.Parse(prtb.ProjectName)
+		if prtb.DeletionTimestamp != nil || (spec.ClusterName != "" && clusterName != spec.ClusterName) {
+			continue
+		}
+		subject, ok := principals.match(prtb.UserName, prtb.UserPrincipalName, prtb.GroupPrincipalName)
+		if !ok {
+			continue
+		}
+		grant, rules, err := s.grant(prtb.RoleTemplateName, prtb.Namespace+"/"+prtb.Name, subject)
+		if err != nil {
+			return status, err
+		}
+		if grant == nil {
+			continue
+		}
+		c := cluster(clusterName)
+		index := -1
+		for i := range c.Projects {
+			if c.Projects[i].ProjectName == projectName {
+				index = i
+			}
+		}
+		if index < 0 {
+			c.Projects = append(c.Projects, extv1.ProjectPermissions{ProjectName: projectName})
+			index = len(c.Projects) - 1
+		}
+		c.Projects[index].RoleTemplates = append(c.Projects[index].RoleTemplates, *grant)
+		c.Projects[index].Rules = appendRules(c.Projects[index].Rules, rules)
+	}
+
+	for _, c := range clusters {
+		sort.Slice(c.Projects, func(i, j int) bool { return c.Projects[i].ProjectName < c.Projects[j].ProjectName })
+		status.Clusters = append(status.Clusters, *c)
+	}
+	sort.Slice(status.Clusters, func(i, j int) bool { return status.Clusters[i].ClusterName < status.Clusters[j].ClusterName })
+	return status, nil
+}
+
+// grant returns a role template granted by a binding along with the rules it grants. It returns nil if the role template doesn't exist.
+func (s *Store) grant(roleTemplateName, binding, subject string) (*extv1.RoleTemplatePermissions, []rbacv1.PolicyRule, error) {
+	rt, err := s.rtCache.Get(roleTemplateName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	inherited, err := rbac.InheritedRoleTemplates(s.rtCache, rt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve the role templates inherited by %s: %w", rt.Name, err)
+	}
+	rules, err := rbac.RulesFromTemplate(s.clusterRoleCache, s.rtCache, rt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve the rules of role template %s: %w", rt.Name, err)
+	}
+	return &extv1.RoleTemplatePermissions{
+		Name:                   rt.Name,
+		Binding:                binding,
+		Subject:                subject,
+		InheritedRoleTemplates: inherited,
+	}, rules, nil
+}
+
+// reviewResourceAttributes returns the principals allowed to perform an action on a resource of a cluster.
+func (s *Store) reviewResourceAttributes(spec *extv1.PermissionReviewSpec) (extv1.PermissionReviewStatus, error) {
+	var status extv1.PermissionReviewStatus
+	attrs := spec.ResourceAttributes
+
+	principals := map[string]*extv1.PrincipalPermissions{}
+	allow := func(kind, name, binding string) {
+		if name == "" {
+			return
+		}
+		key := kind + "/" + name
+		p, ok := principals[key]
+		if !ok {
+			p = &extv1.PrincipalPermissions{Kind: kind, Name: name}
+			principals[key] = p
+		}
+		p.Bindings = append(p.Bindings, binding)
+	}
+
+	grbs, err := s.grbCache.List(labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	for _, grb := range grbs {
+		if grb.DeletionTimestamp != nil {
+			continue
+		}
+		gr, err := s.grCache.Get(grb.GlobalRoleName)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return status, err
+		}
+		// Admins have full access to every cluster, and global roles grant their rules in the local cluster.
+		// The role templates global roles grant in downstream clusters are granted by ClusterRoleTemplateBindings.
+		if !rbac.IsAdminGlobalRole(gr) && (spec.ClusterName != localCluster || !rulesAllow(gr.Rules, attrs)) {
+			continue
+		}
+		kind, name := subjectOf(grb.UserName, "", grb.GroupPrincipalName, "")
+		allow(kind, name, "GlobalRoleBinding/"+grb.Name)
+	}
+
+	crtbs, err := s.crtbCache.List(spec.ClusterName, labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	for _, crtb := range crtbs {
+		if crtb.DeletionTimestamp != nil || crtb.ClusterName != spec.ClusterName {
+			continue
+		}
+		ok, err := s.roleTemplateAllows(crtb.RoleTemplateName, attrs)
+		if err != nil {
+			return status, err
+		}
+		if ok {
+			kind, name := subjectOf(crtb.UserName, crtb.UserPrincipalName, crtb.GroupPrincipalName, crtb.GroupName)
+			allow(kind, name, "ClusterRoleTemplateBinding/"+crtb.Namespace+"/"+crtb.Name)
+		}
+	}
+
+	if attrs.ProjectName != "" {
+		prtbs, err := s.prtbCache.List("", labels.Everything())
+		if err != nil {
+			return status, err
+		}
+		projectName := spec.ClusterName + ":" + attrs.ProjectName
+		for _, prtb := range prtbs {
+			if prtb.DeletionTimestamp != nil || prtb.ProjectName != projectName {
+				continue
+			}
+			ok, err := s.roleTemplateAllows(prtb.RoleTemplateName, attrs)
+			if err != nil {
+				return status, err
+			}
+			if !ok {
+				continue
+			}
+			if prtb.ServiceAccount != "" {
+				allow("ServiceAccount", prtb.ServiceAccount, "ProjectRoleTemplateBinding/"+prtb.Namespace+"/"+prtb.Name)
+				continue
+			}
+			kind, name := subjectOf(prtb.UserName, prtb.UserPrincipalName, prtb.GroupPrincipalName, prtb.GroupName)
+			allow(kind, name, "ProjectRoleTemplateBinding/"+prtb.Namespace+"/"+prtb.Name)
+		}
+	}
+
+	for _, p := range principals {
+		sort.Strings(p.Bindings)
+		status.Principals = append(status.Principals, *p)
+	}
+	sort.Slice(status.Principals, func(i, j int) bool {
+		if status.Principals[i].Kind != status.Principals[j].Kind {
+			return status.Principals[i].Kind < status.Principals[j].Kind
+		}
+		return status.Principals[i].Name < status.Principals[j].Name
+	})
+	return status, nil
+}
+
+func (s *Store) roleTemplateAllows(roleTemplateName string, attrs *extv1.PermissionReviewResourceAttributes) (bool, error) {
+	rt, err := s.rtCache.Get(roleTemplateName)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	rules, err := rbac.RulesFromTemplate(s.clusterRoleCache, s.rtCache, rt)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve the rules of role template %s: %w", rt.Name, err)
+	}
+	return rulesAllow(rules, attrs), nil
+}
+
+// subjectOf returns the kind and name of the subject of a binding.
+func subjectOf(userName, userPrincipalName, groupPrincipalName, groupName string) (string, string) {
+	switch {
+	case userName != "":
+		return "User", userName
+	case userPrincipalName != "":
+		return "User", userPrincipalName
+	case groupPrincipalName != "":
+		return "Group", groupPrincipalName
+	default:
+		return "Group", groupName
+	}
+}
+
+// rulesAllow returns true if one of the rules allows the action, the same way the Kubernetes RBAC authorizer does.
+func rulesAllow(rules []rbacv1.PolicyRule, attrs *extv1.PermissionReviewResourceAttributes) bool {
+	resource := attrs.Resource
+	if attrs.Subresource != "" {
+		resource += "/" + attrs.Subresource
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if rbacv1helpers.VerbMatches(rule, strings.ToLower(attrs.Verb)) &&
+			rbacv1helpers.APIGroupMatches(rule, attrs.APIGroup) &&
+			rbacv1helpers.ResourceMatches(rule, resource, attrs.Subresource) &&
+			rbacv1helpers.ResourceNameMatches(rule, attrs.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendRules appends the rules that aren't already in the list.
+func appendRules(rules, added []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	for _, rule := range added {
+		found := false
+		for _, existing := range rules {
+			if equality.Semantic.DeepEqual(existing, rule) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,291 @@
+package permissionreviews
+
+import (
+	"context"
+	"testing"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	steveext "github.com/rancher/steve/pkg/ext"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+var (
+	podReader = rbacv1.PolicyRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	podWriter = rbacv1.PolicyRule{Verbs: []string{"create", "delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	nodeAdmin = rbacv1.PolicyRule{Verbs: []string{"*"}, APIGroups: []string{""}, Resources: []string{"nodes"}}
+)
+
+func newContext(userName string, admin bool) steveext.Context {
+	return steveext.Context{
+		Context: context.Background(),
+		User:    &user.DefaultInfo{Name: userName},
+		Authorizer: authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if admin && a.GetAPIGroup() == "management.cattle.io" && a.GetVerb() == "list" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionDeny, "", nil
+		}),
+		GroupVersionResource: extv1.SchemeGroupVersion.WithResource(extv1.PermissionReviewResourceName),
+	}
+}
+
+func get[T any](resource string, objs map[string]T) func(string) (T, error) {
+	return func(name string) (T, error) {
+		obj, ok := objs[name]
+		if !ok {
+			return obj, apierrors.NewNotFound(schema.GroupResource{Resource: resource}, name)
+		}
+		return obj, nil
+	}
+}
+
+func newStore(t *testing.T) *Store {
+	ctrl := gomock.NewController(t)
+
+	users := fake.NewMockNonNamespacedCacheInterface[*apimgmtv3.User](ctrl)
+	users.EXPECT().Get(gomock.Any()).DoAndReturn(get("users", map[string]*apimgmtv3.User{
+		"u-alice": {ObjectMeta: metav1.ObjectMeta{Name: "u-alice"}, PrincipalIDs: []string{"local://u-alice", "github_user://1"}},
+	})).AnyTimes()
+
+	userAttributes := fake.NewMockNonNamespacedCacheInterface[*apimgmtv3.UserAttribute](ctrl)
+	userAttributes.EXPECT().Get(gomock.Any()).DoAndReturn(get("userattributes", map[string]*apimgmtv3.UserAttribute{
+		"u-alice": {
+			ObjectMeta: metav1.ObjectMeta{Name: "u-alice"},
+			GroupPrincipals: map[string]apimgmtv3.Principals{
+				"github": {Items: []apimgmtv3.Principal{{ObjectMeta: metav1.ObjectMeta{Name: "github_org://devs"}}}},
+			},
+		},
+	})).AnyTimes()
+
+	globalRoles := fake.NewMockNonNamespacedCacheInterface[*apimgmtv3.GlobalRole](ctrl)
+	globalRoles.EXPECT().Get(gomock.Any()).DoAndReturn(get("globalroles", map[string]*apimgmtv3.GlobalRole{
+		"admin": {ObjectMeta: metav1.ObjectMeta{Name: "admin"}, Builtin: true},
+		"pod-reader": {
+			ObjectMeta:            metav1.ObjectMeta{Name: "pod-reader"},
+			Rules:                 []rbacv1.PolicyRule{podReader},
+			InheritedClusterRoles: []string{"cluster-member"},
+		},
+	})).AnyTimes()
+
+	globalRoleBindings := fake.NewMockNonNamespacedCacheInterface[*apimgmtv3.GlobalRoleBinding](ctrl)
+	globalRoleBindings.EXPECT().List(gomock.Any()).Return([]*apimgmtv3.GlobalRoleBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "grb-admin"}, UserName: "u-admin", GlobalRoleName: "admin"},
+		{ObjectMeta: metav1.ObjectMeta{Name: "grb-devs"}, GroupPrincipalName: "github_org://devs", GlobalRoleName: "pod-reader"},
+	}, nil).AnyTimes()
+
+	roleTemplates := fake.NewMockNonNamespacedCacheInterface[*apimgmtv3.RoleTemplate](ctrl)
+	roleTemplates.EXPECT().Get(gomock.Any()).DoAndReturn(get("roletemplates", map[string]*apimgmtv3.RoleTemplate{
+		"pod-reader":   {ObjectMeta: metav1.ObjectMeta{Name: "pod-reader"}, Rules: []rbacv1.PolicyRule{podReader}},
+		"pod-writer":   {ObjectMeta: metav1.ObjectMeta{Name: "pod-writer"}, Rules: []rbacv1.PolicyRule{podWriter}, RoleTemplateNames: []string{"pod-reader"}},
+		"node-admin":   {ObjectMeta: metav1.ObjectMeta{Name: "node-admin"}, External: true, Context: "cluster"},
+		"project-dev":  {ObjectMeta: metav1.ObjectMeta{Name: "project-dev"}, RoleTemplateNames: []string{"pod-writer"}},
+		"cluster-user": {ObjectMeta: metav1.ObjectMeta{Name: "cluster-user"}, RoleTemplateNames: []string{"pod-reader"}},
+	})).AnyTimes()
+
+	clusterRoles := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
+	clusterRoles.EXPECT().Get(gomock.Any()).DoAndReturn(get("clusterroles", map[string]*rbacv1.ClusterRole{
+		"node-admin": {ObjectMeta: metav1.ObjectMeta{Name: "node-admin"}, Rules: []rbacv1.PolicyRule{nodeAdmin}},
+	})).AnyTimes()
+
+	crtbs := fake.NewMockCacheInterface[*apimgmtv3.ClusterRoleTemplateBinding](ctrl)
+	crtbs.EXPECT().List(gomock.Any(), gomock.Any()).DoAndReturn(func(namespace string, _ any) ([]*apimgmtv3.ClusterRoleTemplateBinding, error) {
+		var result []*apimgmtv3.ClusterRoleTemplateBinding
+		for _, crtb := range []*apimgmtv3.ClusterRoleTemplateBinding{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "c-1", Name: "crtb-alice"}, ClusterName: "c-1", UserName: "u-alice", RoleTemplateName: "cluster-user"},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "c-1", Name: "crtb-devs"}, ClusterName: "c-1", GroupPrincipalName: "github_org://devs", RoleTemplateName: "node-admin"},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "c-2", Name: "crtb-principal"}, ClusterName: "c-2", UserPrincipalName: "github_user://1", RoleTemplateName: "pod-writer"},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "c-2", Name: "crtb-bob"}, ClusterName: "c-2", UserName: "u-bob", RoleTemplateName: "pod-reader"},
+		} {
+			if namespace == "" || crtb.Namespace == namespace {
+				result = append(result, crtb)
+			}
+		}
+		return result, nil
+	}).AnyTimes()
+
+	prtbs := fake.NewMockCacheInterface[*apimgmtv3.ProjectRoleTemplateBinding](ctrl)
+	prtbs.EXPECT().List(gomock.Any(), gomock.Any()).Return([]*apimgmtv3.ProjectRoleTemplateBinding{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "p-1", Name: "prtb-alice"}, ProjectName: "c-1:p-1", UserName: "u-alice", RoleTemplateName: "project-dev"},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "p-1", Name: "prtb-sa"}, ProjectName: "c-1:p-1", ServiceAccount: "ns:deployer", RoleTemplateName: "pod-writer"},
+	}, nil).AnyTimes()
+
+	return &Store{
+		userCache:          users,
+		userAttributeCache: userAttributes,
+		grCache:            globalRoles,
+		grbCache:           globalRoleBindings,
+		rtCache:            roleTemplates,
+		crtbCache:          crtbs,
+		prtbCache:          prtbs,
+		clusterRoleCache:   clusterRoles,
+	}
+}
+
+func TestReviewUser(t *testing.T) {
+	store := newStore(t)
+
+	result, err := store.Create(newContext("u-alice", false), &extv1.PermissionReview{
+		Spec: extv1.PermissionReviewSpec{User: "u-alice"},
+	}, &metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []extv1.GlobalRolePermissions{{
+		Name:                  "pod-reader",
+		Binding:               "grb-devs",
+		Subject:               "github_org://devs",
+		Rules:                 []rbacv1.PolicyRule{podReader},
+		InheritedClusterRoles: []string{"cluster-member"},
+	}}, result.Status.GlobalRoles)
+
+	require.Len(t, result.Status.Clusters, 2)
+	c1 := result.Status.Clusters[0]
+	assert.Equal(t, "c-1", c1.ClusterName)
+	assert.Equal(t, []extv1.RoleTemplatePermissions{
+		{Name: "cluster-user", Binding: "c-1/crtb-alice", Subject: "u-alice", InheritedRoleTemplates: []string{"pod-reader"}},
+		{Name: "node-admin", Binding: "c-1/crtb-devs", Subject: "github_org://devs"},
+	}, c1.RoleTemplates)
+	assert.Equal(t, []rbacv1.PolicyRule{podReader, nodeAdmin}, c1.Rules)
+	require.Len(t, c1.Projects, 1)
+	assert.Equal(t, "p-1", c1.Projects[0].ProjectName)
+	assert.Equal(t, []extv1.RoleTemplatePermissions{
+		{Name: "project-dev", Binding: "p-1/prtb-alice", Subject: "u-alice", InheritedRoleTemplates: []string{"pod-writer", "pod-reader"}},
+	}, c1.Projects[0].RoleTemplates)
+	assert.Equal(t, []rbacv1.PolicyRule{podWriter, podReader}, c1.Projects[0].Rules)
+
+	c2 := result.Status.Clusters[1]
+	assert.Equal(t, "c-2", c2.ClusterName)
+	assert.Equal(t, []extv1.RoleTemplatePermissions{
+		{Name: "pod-writer", Binding: "c-2/crtb-principal", Subject: "github_user://1", InheritedRoleTemplates: []string{"pod-reader"}},
+	}, c2.RoleTemplates, "expected bindings to the principal of the user")
+	assert.Empty(t, c2.Projects)
+
+	// Reviews can be scoped to a cluster.
+	result, err = store.Create(newContext("u-alice", false), &extv1.PermissionReview{
+		Spec: extv1.PermissionReviewSpec{User: "u-alice", ClusterName: "c-2"},
+	}, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Status.Clusters, 1)
+	assert.Equal(t, "c-2", result.Status.Clusters[0].ClusterName)
+}
+
+func TestReviewGroup(t *testing.T) {
+	store := newStore(t)
+
+	result, err := store.Create(newContext("u-admin", true), &extv1.PermissionReview{
+		Spec: extv1.PermissionReviewSpec{GroupPrincipal: "github_org://devs"},
+	}, &metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, result.Status.GlobalRoles, 1)
+	assert.Equal(t, "grb-devs", result.Status.GlobalRoles[0].Binding)
+	require.Len(t, result.Status.Clusters, 1)
+	assert.Equal(t, "c-1", result.Status.Clusters[0].ClusterName)
+	assert.Equal(t, []rbacv1.PolicyRule{nodeAdmin}, result.Status.Clusters[0].Rules)
+}
+
+func TestReviewResourceAttributes(t *testing.T) {
+	store := newStore(t)
+
+	review := func(clusterName string, attrs extv1.PermissionReviewResourceAttributes) []extv1.PrincipalPermissions {
+		t.Helper()
+		result, err := store.Create(newContext("u-admin", true), &extv1.PermissionReview{
+			Spec: extv1.PermissionReviewSpec{ClusterName: clusterName, ResourceAttributes: &attrs},
+		}, &metav1.CreateOptions{})
+		require.NoError(t, err)
+		return result.Status.Principals
+	}
+
+	assert.Equal(t, []extv1.PrincipalPermissions{
+		{Kind: "Group", Name: "github_org://devs", Bindings: []string{"ClusterRoleTemplateBinding/c-1/crtb-devs"}},
+		{Kind: "User", Name: "u-admin", Bindings: []string{"GlobalRoleBinding/grb-admin"}},
+	}, review("c-1", extv1.PermissionReviewResourceAttributes{Verb: "delete", Resource: "nodes"}))
+
+	assert.Equal(t, []extv1.PrincipalPermissions{
+		{Kind: "User", Name: "u-admin", Bindings: []string{"GlobalRoleBinding/grb-admin"}},
+		{Kind: "User", Name: "u-alice", Bindings: []string{"ClusterRoleTemplateBinding/c-1/crtb-alice"}},
+	}, review("c-1", extv1.PermissionReviewResourceAttributes{Verb: "get", Resource: "pods"}))
+
+	assert.Equal(t, []extv1.PrincipalPermissions{
+		{Kind: "ServiceAccount", Name: "ns:deployer", Bindings: []string{"ProjectRoleTemplateBinding/p-1/prtb-sa"}},
+		{Kind: "User", Name: "u-admin", Bindings: []string{"GlobalRoleBinding/grb-admin"}},
+		{Kind: "User", Name: "u-alice", Bindings: []string{"ProjectRoleTemplateBinding/p-1/prtb-alice"}},
+	}, review("c-1", extv1.PermissionReviewResourceAttributes{Verb: "create", Resource: "pods", ProjectName: "p-1"}))
+
+	assert.Equal(t, []extv1.PrincipalPermissions{
+		{Kind: "User", Name: "github_user://1", Bindings: []string{"ClusterRoleTemplateBinding/c-2/crtb-principal"}},
+		{Kind: "User", Name: "u-admin", Bindings: []string{"GlobalRoleBinding/grb-admin"}},
+	}, review("c-2", extv1.PermissionReviewResourceAttributes{Verb: "delete", Resource: "pods"}))
+
+	// Global roles grant their rules in the local cluster.
+	assert.Equal(t, []extv1.PrincipalPermissions{
+		{Kind: "Group", Name: "github_org://devs", Bindings: []string{"GlobalRoleBinding/grb-devs"}},
+		{Kind: "User", Name: "u-admin", Bindings: []string{"GlobalRoleBinding/grb-admin"}},
+	}, review("local", extv1.PermissionReviewResourceAttributes{Verb: "list", Resource: "pods"}))
+
+	// Subresources must be granted explicitly.
+	assert.Equal(t, []extv1.PrincipalPermissions{
+		{Kind: "User", Name: "u-admin", Bindings: []string{"GlobalRoleBinding/grb-admin"}},
+	}, review("c-1", extv1.PermissionReviewResourceAttributes{Verb: "get", Resource: "pods", Subresource: "log"}))
+}
+
+func TestCreateAuthorization(t *testing.T) {
+	store := newStore(t)
+
+	_, err := store.Create(newContext("u-bob", false), &extv1.PermissionReview{
+		Spec: extv1.PermissionReviewSpec{User: "u-alice"},
+	}, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+
+	_, err = store.Create(newContext("u-bob", false), &extv1.PermissionReview{
+		Spec: extv1.PermissionReviewSpec{GroupPrincipal: "github_org://devs"},
+	}, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+
+	_, err = store.Create(newContext("u-bob", false), &extv1.PermissionReview{
+		Spec: extv1.PermissionReviewSpec{ClusterName: "c-1", ResourceAttributes: &extv1.PermissionReviewResourceAttributes{Verb: "get", Resource: "pods"}},
+	}, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+}
+
+func TestCreateValidation(t *testing.T) {
+	store := newStore(t)
+
+	for name, spec := range map[string]extv1.PermissionReviewSpec{
+		"empty":              {},
+		"user and group":     {User: "u-alice", GroupPrincipal: "github_org://devs"},
+		"missing cluster":    {ResourceAttributes: &extv1.PermissionReviewResourceAttributes{Verb: "get", Resource: "pods"}},
+		"missing verb":       {ClusterName: "c-1", ResourceAttributes: &extv1.PermissionReviewResourceAttributes{Resource: "pods"}},
+		"missing resource":   {ClusterName: "c-1", ResourceAttributes: &extv1.PermissionReviewResourceAttributes{Verb: "get"}},
+		"user and attribute": {User: "u-admin", ClusterName: "c-1", ResourceAttributes: &extv1.PermissionReviewResourceAttributes{Verb: "get", Resource: "pods"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Create(newContext("u-admin", true), &extv1.PermissionReview{Spec: spec}, &metav1.CreateOptions{})
+			assert.True(t, apierrors.IsInvalid(err), "expected invalid, got %v", err)
+		})
+	}
+}
+
+func TestUnsupportedVerbs(t *testing.T) {
+	store := newStore(t)
+	ctx := newContext("u-admin", true)
+
+	_, err := store.Get(ctx, "review", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsMethodNotSupported(err))
+	_, err = store.List(ctx, &metav1.ListOptions{})
+	assert.True(t, apierrors.IsMethodNotSupported(err))
+	_, err = store.Watch(ctx, &metav1.ListOptions{})
+	assert.True(t, apierrors.IsMethodNotSupported(err))
+	_, err = store.Update(ctx, &extv1.PermissionReview{}, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsMethodNotSupported(err))
+	assert.True(t, apierrors.IsMethodNotSupported(store.Delete(ctx, "review", &metav1.DeleteOptions{})))
+}
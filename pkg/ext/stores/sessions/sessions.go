@@ -0,0 +1,257 @@
+// Package sessions implements the ext.cattle.io Session store, which exposes the active login sessions of
+// Rancher users so that they can be listed and logged out of.
+package sessions
+
+import (
+	"fmt"
+	"time"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	authtokens "github.com/rancher/rancher/pkg/auth/tokens"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/wrangler"
+	steveext "github.com/rancher/steve/pkg/ext"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	// SingularName is the singular name of the resource served by the store.
+	SingularName = "session"
+
+	watchBufferSize = 100
+)
+
+// Store serves ext.cattle.io Sessions from the management.cattle.io login tokens backing them.
+// Users can only see and log out of their own sessions, unless they are allowed to manage
+// management.cattle.io tokens, which is generally only the case for admins.
+type Store struct {
+	tokenClient mgmtcontrollers.TokenClient
+}
+
+// New returns a session store backed by the management.cattle.io clients of the wrangler context.
+func New(wranglerContext *wrangler.Context) *Store {
+	return &Store{
+		tokenClient: wranglerContext.Mgmt.Token(),
+	}
+}
+
+// Create isn't supported as sessions are created by logging in.
+func (s *Store) Create(ctx steveext.Context, obj *extv1.Session, opts *metav1.CreateOptions) (*extv1.Session, error) {
+	return nil, apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "create")
+}
+
+// Update isn't supported as sessions are read-only.
+func (s *Store) Update(ctx steveext.Context, obj *extv1.Session, opts *metav1.UpdateOptions) (*extv1.Session, error) {
+	return nil, apierrors.NewMethodNotSupported(ctx.GroupVersionResource.GroupResource(), "update")
+}
+
+// Get returns the session with the given name if the requesting user can see it.
+func (s *Store) Get(ctx steveext.Context, name string, opts *metav1.GetOptions) (*extv1.Session, error) {
+	token, err := s.get(ctx, name, "get")
+	if err != nil {
+		return nil, err
+	}
+	return toSession(token), nil
+}
+
+// List returns the active sessions the requesting user can see. Sessions that have expired,
+// or have been idle for too long, but haven't been purged yet are left out.
+func (s *Store) List(ctx steveext.Context, opts *metav1.ListOptions) (*extv1.SessionList, error) {
+	listOpts, err := s.scopedListOptions(ctx, opts, "list")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.tokenClient.List(listOpts)
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to list sessions: %w", err))
+	}
+
+	list := &extv1.SessionList{
+		ListMeta: tokens.ListMeta,
+		Items:    make([]extv1.Session, 0, len(tokens.Items)),
+	}
+	for i := range tokens.Items {
+		token := &tokens.Items[i]
+		if authtokens.IsExpired(*token) || authtokens.IsIdle(*token) {
+			continue
+		}
+		list.Items = append(list.Items, *toSession(token))
+	}
+	return list, nil
+}
+
+// Watch sends the changes to the sessions the requesting user can see until the request is done.
+func (s *Store) Watch(ctx steveext.Context, opts *metav1.ListOptions) (<-chan steveext.WatchEvent[*extv1.Session], error) {
+	listOpts, err := s.scopedListOptions(ctx, opts, "watch")
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := s.tokenClient.Watch(listOpts)
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to watch sessions: %w", err))
+	}
+
+	events := make(chan steveext.WatchEvent[*extv1.Session], watchBufferSize)
+	go func() {
+		defer close(events)
+		defer watcher.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				token, ok := event.Object.(*apimgmtv3.Token)
+				if !ok {
+					logrus.Debugf("[ext sessions] Ignoring watch event %s of type %T", event.Type, event.Object)
+					continue
+				}
+				select {
+				case events <- steveext.WatchEvent[*extv1.Session]{Event: event.Type, Object: toSession(token)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Delete logs out of the session with the given name if the requesting user can see it.
+// The logout callbacks of the auth provider of the session are invoked before its token is deleted.
+func (s *Store) Delete(ctx steveext.Context, name string, opts *metav1.DeleteOptions) error {
+	token, err := s.get(ctx, name, "delete")
+	if err != nil {
+		return err
+	}
+
+	if err := authtokens.RevokeSession(s.tokenClient, token, false); err != nil {
+		return s.translateError(ctx, name, err)
+	}
+	return nil
+}
+
+// get returns the login token backing the session with the given name. Tokens that aren't login
+// sessions are reported as not found, as are the sessions of other users to users who can't manage
+// all tokens, so that their names aren't disclosed.
+func (s *Store) get(ctx steveext.Context, name, verb string) (*apimgmtv3.Token, error) {
+	token, err := s.tokenClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, s.translateError(ctx, name, err)
+	}
+	if !authtokens.IsSession(token) {
+		return nil, apierrors.NewNotFound(ctx.GroupVersionResource.GroupResource(), name)
+	}
+	if token.UserID == ctx.User.GetName() {
+		return token, nil
+	}
+
+	ok, err := s.canManageAllTokens(ctx, verb)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apierrors.NewNotFound(ctx.GroupVersionResource.GroupResource(), name)
+	}
+	return token, nil
+}
+
+// scopedListOptions restricts the list options to login tokens, and to the tokens of the requesting
+// user unless the user can manage all tokens.
+func (s *Store) scopedListOptions(ctx steveext.Context, opts *metav1.ListOptions, verb string) (metav1.ListOptions, error) {
+	listOpts := metav1.ListOptions{}
+	if opts != nil {
+		listOpts = *opts
+	}
+
+	selector := authtokens.TokenKindLabel + "=" + authtokens.SessionTokenKind
+	ok, err := s.canManageAllTokens(ctx, verb)
+	if err != nil {
+		return listOpts, err
+	}
+	if !ok {
+		selector += "," + authtokens.UserIDLabel + "=" + ctx.User.GetName()
+	}
+
+	if listOpts.LabelSelector == "" {
+		listOpts.LabelSelector = selector
+	} else {
+		listOpts.LabelSelector += "," + selector
+	}
+	return listOpts, nil
+}
+
+// canManageAllTokens returns true if the requesting user can perform verb on the
+// management.cattle.io tokens of all users.
+func (s *Store) canManageAllTokens(ctx steveext.Context, verb string) (bool, error) {
+	decision, _, err := ctx.Authorizer.Authorize(ctx, authorizer.AttributesRecord{
+		User:            ctx.User,
+		Verb:            verb,
+		APIGroup:        apimgmtv3.SchemeGroupVersion.Group,
+		APIVersion:      apimgmtv3.SchemeGroupVersion.Version,
+		Resource:        apimgmtv3.TokenResourceName,
+		ResourceRequest: true,
+	})
+	if err != nil {
+		return false, apierrors.NewInternalError(fmt.Errorf("failed to authorize user %s: %w", ctx.User.GetName(), err))
+	}
+	return decision == authorizer.DecisionAllow, nil
+}
+
+// translateError returns errors about the backing tokens as errors about the sessions.
+func (s *Store) translateError(ctx steveext.Context, name string, err error) error {
+	switch {
+	case apierrors.IsNotFound(err):
+		return apierrors.NewNotFound(ctx.GroupVersionResource.GroupResource(), name)
+	case apierrors.IsConflict(err):
+		return apierrors.NewConflict(ctx.GroupVersionResource.GroupResource(), name, err)
+	case apierrors.IsForbidden(err):
+		return err
+	}
+	return apierrors.NewInternalError(err)
+}
+
+func toSession(token *apimgmtv3.Token) *extv1.Session {
+	token = token.DeepCopy()
+	if token.ExpiresAt == "" {
+		authtokens.SetTokenExpiresAt(token)
+	}
+
+	var idleExpiresAt string
+	if at := authtokens.IdleExpiresAt(token); !at.IsZero() {
+		idleExpiresAt = at.UTC().Format(time.RFC3339)
+	}
+
+	result := &extv1.Session{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              token.Name,
+			UID:               token.UID,
+			ResourceVersion:   token.ResourceVersion,
+			CreationTimestamp: token.CreationTimestamp,
+			DeletionTimestamp: token.DeletionTimestamp,
+			Labels:            token.Labels,
+		},
+		Status: extv1.SessionStatus{
+			UserID:        token.UserID,
+			UserPrincipal: token.UserPrincipal.Name,
+			AuthProvider:  token.AuthProvider,
+			ClientIP:      token.Annotations[authtokens.ClientIPAnnotation],
+			UserAgent:     token.Annotations[authtokens.UserAgentAnnotation],
+			LastUsedAt:    token.LastUsedAt,
+			ExpiresAt:     token.ExpiresAt,
+			IdleExpiresAt: idleExpiresAt,
+		},
+	}
+	result.APIVersion, result.Kind = extv1.SchemeGroupVersion.WithKind("Session").ToAPIVersionAndKind()
+	return result
+}
@@ -0,0 +1,127 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	authtokens "github.com/rancher/rancher/pkg/auth/tokens"
+	steveext "github.com/rancher/steve/pkg/ext"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const sessionSelector = authtokens.TokenKindLabel + "=" + authtokens.SessionTokenKind
+
+func newContext(userName string, admin bool) steveext.Context {
+	return steveext.Context{
+		Context: context.Background(),
+		User:    &user.DefaultInfo{Name: userName},
+		Authorizer: authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if admin && a.GetAPIGroup() == "management.cattle.io" && a.GetResource() == "tokens" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionDeny, "", nil
+		}),
+		GroupVersionResource: extv1.SchemeGroupVersion.WithResource(extv1.SessionResourceName),
+	}
+}
+
+func newStore(ctrl *gomock.Controller) (*Store, *fake.MockNonNamespacedClientInterface[*apimgmtv3.Token, *apimgmtv3.TokenList]) {
+	tokenClient := fake.NewMockNonNamespacedClientInterface[*apimgmtv3.Token, *apimgmtv3.TokenList](ctrl)
+	return &Store{tokenClient: tokenClient}, tokenClient
+}
+
+func newSessionToken(name, userID string, created time.Time) apimgmtv3.Token {
+	return apimgmtv3.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels: map[string]string{
+				authtokens.TokenKindLabel: authtokens.SessionTokenKind,
+				authtokens.UserIDLabel:    userID,
+			},
+			Annotations: map[string]string{
+				authtokens.ClientIPAnnotation:  "192.0.2.10",
+				authtokens.UserAgentAnnotation: "Mozilla/5.0",
+			},
+		},
+		UserID:       userID,
+		AuthProvider: "local",
+		TTLMillis:    time.Hour.Milliseconds(),
+	}
+}
+
+func TestList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient := newStore(ctrl)
+
+	expired := newSessionToken("token-expired", "u-alice", time.Now().Add(-2*time.Hour))
+	active := newSessionToken("token-active", "u-alice", time.Now())
+	tokenClient.EXPECT().List(metav1.ListOptions{LabelSelector: sessionSelector + "," + authtokens.UserIDLabel + "=u-alice"}).Return(&apimgmtv3.TokenList{
+		Items: []apimgmtv3.Token{expired, active},
+	}, nil)
+
+	list, err := store.List(newContext("u-alice", false), &metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1, "expected expired sessions to be left out")
+	session := list.Items[0]
+	assert.Equal(t, "token-active", session.Name)
+	assert.Equal(t, "u-alice", session.Status.UserID)
+	assert.Equal(t, "192.0.2.10", session.Status.ClientIP)
+	assert.Equal(t, "Mozilla/5.0", session.Status.UserAgent)
+	assert.NotEmpty(t, session.Status.ExpiresAt)
+	assert.Empty(t, session.Status.IdleExpiresAt)
+	assert.Empty(t, session.Annotations)
+
+	tokenClient.EXPECT().List(metav1.ListOptions{LabelSelector: "env=ci," + sessionSelector}).Return(&apimgmtv3.TokenList{}, nil)
+	_, err = store.List(newContext("u-admin", true), &metav1.ListOptions{LabelSelector: "env=ci"})
+	require.NoError(t, err)
+}
+
+func TestGetAndDeleteScoping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient := newStore(ctrl)
+
+	session := newSessionToken("token-alice", "u-alice", time.Now())
+	tokenClient.EXPECT().Get("token-alice", gomock.Any()).Return(&session, nil).AnyTimes()
+	tokenClient.EXPECT().Get("token-derived", gomock.Any()).Return(&apimgmtv3.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-derived"},
+		UserID:     "u-alice",
+		IsDerived:  true,
+	}, nil).AnyTimes()
+
+	_, err := store.Get(newContext("u-alice", false), "token-alice", &metav1.GetOptions{})
+	require.NoError(t, err)
+
+	_, err = store.Get(newContext("u-alice", false), "token-derived", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "expected tokens other than sessions to be hidden, got %v", err)
+
+	_, err = store.Get(newContext("u-bob", false), "token-alice", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "expected sessions of other users to be hidden, got %v", err)
+
+	err = store.Delete(newContext("u-bob", false), "token-alice", &metav1.DeleteOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "expected sessions of other users to be hidden, got %v", err)
+
+	tokenClient.EXPECT().Delete("token-alice", gomock.Any()).Return(nil)
+	assert.NoError(t, store.Delete(newContext("u-admin", true), "token-alice", &metav1.DeleteOptions{}))
+}
+
+func TestCreateAndUpdateNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, _ := newStore(ctrl)
+
+	_, err := store.Create(newContext("u-alice", false), &extv1.Session{}, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsMethodNotSupported(err), "expected method not supported, got %v", err)
+
+	_, err = store.Update(newContext("u-alice", false), &extv1.Session{}, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsMethodNotSupported(err), "expected method not supported, got %v", err)
+}
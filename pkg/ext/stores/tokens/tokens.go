@@ -0,0 +1,422 @@
+// Package tokens implements the ext.cattle.io Token store, which exposes the management.cattle.io
+// tokens of Rancher as a Kubernetes-native resource of the extension API server.
+package tokens
+
+import (
+	"fmt"
+	"time"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/providers/common"
+	authtokens "github.com/rancher/rancher/pkg/auth/tokens"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/wrangler"
+	steveext "github.com/rancher/steve/pkg/ext"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// SingularName is the singular name of the resource served by the store.
+	SingularName = "token"
+
+	// DisabledByAnnotation records the name of the user who disabled a token. Tokens disabled by
+	// someone who can manage all tokens can't be enabled again by their owner.
+	DisabledByAnnotation = "ext.cattle.io/token-disabled-by"
+
+	watchBufferSize = 100
+)
+
+// Store serves ext.cattle.io Tokens from the management.cattle.io Tokens backing them.
+// Users can only see and manage their own tokens, unless they are allowed to manage
+// management.cattle.io tokens, which is generally only the case for admins.
+type Store struct {
+	tokenClient mgmtcontrollers.TokenClient
+	userCache   mgmtcontrollers.UserCache
+}
+
+// New returns a token store backed by the management.cattle.io clients of the wrangler context.
+func New(wranglerContext *wrangler.Context) *Store {
+	return &Store{
+		tokenClient: wranglerContext.Mgmt.Token(),
+		userCache:   wranglerContext.Mgmt.User().Cache(),
+	}
+}
+
+// Create creates a derived token for the user of the token, which defaults to the requesting user.
+// The bearer value of the token is only returned in the status of the created token.
+func (s *Store) Create(ctx steveext.Context, obj *extv1.Token, opts *metav1.CreateOptions) (*extv1.Token, error) {
+	userID := obj.Spec.UserID
+	if userID == "" {
+		userID = ctx.User.GetName()
+	}
+	if userID != ctx.User.GetName() {
+		if ok, err := s.canManageAllTokens(ctx, "create"); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, apierrors.NewForbidden(ctx.GroupVersionResource.GroupResource(), obj.Name,
+				fmt.Errorf("can't create tokens for user %s", userID))
+		}
+	}
+
+	user, err := s.userCache.Get(userID)
+	if apierrors.IsNotFound(err) {
+		return nil, apierrors.NewInvalid(extv1.Kind("Token"), obj.Name, field.ErrorList{
+			field.NotFound(field.NewPath("spec", "userID"), userID),
+		})
+	} else if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to get user %s: %w", userID, err))
+	}
+
+	if obj.Spec.TTL < 0 {
+		return nil, apierrors.NewInvalid(extv1.Kind("Token"), obj.Name, field.ErrorList{
+			field.Invalid(field.NewPath("spec", "ttl"), obj.Spec.TTL, "must not be negative"),
+		})
+	}
+	ttl, err := authtokens.ClampToMaxTTL(time.Duration(obj.Spec.TTL) * time.Millisecond)
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to validate the ttl: %w", err))
+	}
+
+	principalID := s.userPrincipalID(ctx, user)
+	token := &apimgmtv3.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      obj.Labels,
+			Annotations: obj.Annotations,
+		},
+		UserPrincipal: apimgmtv3.Principal{
+			ObjectMeta:    metav1.ObjectMeta{Name: principalID},
+			DisplayName:   user.DisplayName,
+			LoginName:     user.Username,
+			PrincipalType: "user",
+			Me:            true,
+			Provider:      authtokens.GetAuthProviderName(principalID),
+		},
+		IsDerived:    true,
+		TTLMillis:    ttl.Milliseconds(),
+		UserID:       userID,
+		AuthProvider: authtokens.GetAuthProviderName(principalID),
+		Description:  obj.Spec.Description,
+		ClusterName:  obj.Spec.ClusterName,
+		Enabled:      obj.Spec.Enabled,
+	}
+	if len(token.Annotations) > 0 {
+		token.Annotations = make(map[string]string, len(obj.Annotations))
+		for k, v := range obj.Annotations {
+			token.Annotations[k] = v
+		}
+		delete(token.Annotations, DisabledByAnnotation)
+	}
+	if obj.Spec.Enabled != nil && !*obj.Spec.Enabled {
+		if token.Annotations == nil {
+			token.Annotations = map[string]string{}
+		}
+		token.Annotations[DisabledByAnnotation] = ctx.User.GetName()
+	}
+	key, err := authtokens.PrepareToken(token)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	token.Name = obj.Name
+
+	created, err := s.tokenClient.Create(token)
+	if err != nil {
+		return nil, s.translateError(ctx, obj.Name, err)
+	}
+
+	result := toExtToken(created)
+	result.Status.Value = created.Name + ":" + key
+	return result, nil
+}
+
+// Update changes the description and enabled state of a token. All other fields are immutable.
+func (s *Store) Update(ctx steveext.Context, obj *extv1.Token, opts *metav1.UpdateOptions) (*extv1.Token, error) {
+	current, err := s.get(ctx, obj.Name, "update")
+	if err != nil {
+		return nil, err
+	}
+
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if obj.Spec.UserID != "" && obj.Spec.UserID != current.UserID {
+		errs = append(errs, field.Forbidden(specPath.Child("userID"), "field is immutable"))
+	}
+	if obj.Spec.TTL != current.TTLMillis {
+		errs = append(errs, field.Forbidden(specPath.Child("ttl"), "field is immutable"))
+	}
+	if obj.Spec.ClusterName != current.ClusterName {
+		errs = append(errs, field.Forbidden(specPath.Child("clusterName"), "field is immutable"))
+	}
+	if len(errs) > 0 {
+		return nil, apierrors.NewInvalid(extv1.Kind("Token"), obj.Name, errs)
+	}
+
+	wasEnabled := current.Enabled == nil || *current.Enabled
+	enabled := obj.Spec.Enabled == nil || *obj.Spec.Enabled
+	disabledBy := current.Annotations[DisabledByAnnotation]
+	if enabled && !wasEnabled && disabledBy != "" && disabledBy != ctx.User.GetName() {
+		if ok, err := s.canManageAllTokens(ctx, "update"); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, apierrors.NewForbidden(ctx.GroupVersionResource.GroupResource(), obj.Name,
+				fmt.Errorf("token was disabled by %s and can only be enabled by an administrator", disabledBy))
+		}
+	}
+
+	token := current.DeepCopy()
+	token.Labels = obj.Labels
+	token.Annotations = map[string]string{}
+	for k, v := range obj.Annotations {
+		token.Annotations[k] = v
+	}
+	delete(token.Annotations, DisabledByAnnotation)
+	if hashed, ok := current.Annotations[authtokens.TokenHashed]; ok {
+		token.Annotations[authtokens.TokenHashed] = hashed
+	}
+	switch {
+	case !enabled && wasEnabled:
+		token.Annotations[DisabledByAnnotation] = ctx.User.GetName()
+	case !enabled && disabledBy != "":
+		token.Annotations[DisabledByAnnotation] = disabledBy
+	}
+	if token.Labels == nil {
+		token.Labels = map[string]string{}
+	}
+	token.Labels[authtokens.UserIDLabel] = current.UserID
+	token.Description = obj.Spec.Description
+	token.Enabled = obj.Spec.Enabled
+	if obj.ResourceVersion != "" {
+		token.ResourceVersion = obj.ResourceVersion
+	}
+
+	updated, err := s.tokenClient.Update(token)
+	if err != nil {
+		return nil, s.translateError(ctx, obj.Name, err)
+	}
+	return toExtToken(updated), nil
+}
+
+// Get returns the token with the given name if the requesting user can see it.
+func (s *Store) Get(ctx steveext.Context, name string, opts *metav1.GetOptions) (*extv1.Token, error) {
+	token, err := s.get(ctx, name, "get")
+	if err != nil {
+		return nil, err
+	}
+	return toExtToken(token), nil
+}
+
+// List returns the tokens the requesting user can see.
+func (s *Store) List(ctx steveext.Context, opts *metav1.ListOptions) (*extv1.TokenList, error) {
+	listOpts, err := s.scopedListOptions(ctx, opts, "list")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.tokenClient.List(listOpts)
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to list tokens: %w", err))
+	}
+
+	list := &extv1.TokenList{
+		ListMeta: tokens.ListMeta,
+		Items:    make([]extv1.Token, 0, len(tokens.Items)),
+	}
+	for i := range tokens.Items {
+		list.Items = append(list.Items, *toExtToken(&tokens.Items[i]))
+	}
+	return list, nil
+}
+
+// Watch sends the changes to the tokens the requesting user can see until the request is done.
+func (s *Store) Watch(ctx steveext.Context, opts *metav1.ListOptions) (<-chan steveext.WatchEvent[*extv1.Token], error) {
+	listOpts, err := s.scopedListOptions(ctx, opts, "watch")
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := s.tokenClient.Watch(listOpts)
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to watch tokens: %w", err))
+	}
+
+	events := make(chan steveext.WatchEvent[*extv1.Token], watchBufferSize)
+	go func() {
+		defer close(events)
+		defer watcher.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				token, ok := event.Object.(*apimgmtv3.Token)
+				if !ok {
+					logrus.Debugf("[ext tokens] Ignoring watch event %s of type %T", event.Type, event.Object)
+					continue
+				}
+				select {
+				case events <- steveext.WatchEvent[*extv1.Token]{Event: event.Type, Object: toExtToken(token)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Delete deletes the token with the given name if the requesting user can see it.
+func (s *Store) Delete(ctx steveext.Context, name string, opts *metav1.DeleteOptions) error {
+	if _, err := s.get(ctx, name, "delete"); err != nil {
+		return err
+	}
+
+	deleteOpts := metav1.DeleteOptions{}
+	if opts != nil {
+		deleteOpts = *opts
+	}
+	if err := s.tokenClient.Delete(name, &deleteOpts); err != nil {
+		return s.translateError(ctx, name, err)
+	}
+	return nil
+}
+
+// get returns the backing token with the given name. Tokens of other users are reported as not
+// found to users who can't manage all tokens, so that their names aren't disclosed.
+func (s *Store) get(ctx steveext.Context, name, verb string) (*apimgmtv3.Token, error) {
+	token, err := s.tokenClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, s.translateError(ctx, name, err)
+	}
+	if token.UserID == ctx.User.GetName() {
+		return token, nil
+	}
+
+	ok, err := s.canManageAllTokens(ctx, verb)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apierrors.NewNotFound(ctx.GroupVersionResource.GroupResource(), name)
+	}
+	return token, nil
+}
+
+// scopedListOptions restricts the list options to the tokens of the requesting user unless the
+// user can manage all tokens.
+func (s *Store) scopedListOptions(ctx steveext.Context, opts *metav1.ListOptions, verb string) (metav1.ListOptions, error) {
+	listOpts := metav1.ListOptions{}
+	if opts != nil {
+		listOpts = *opts
+	}
+
+	ok, err := s.canManageAllTokens(ctx, verb)
+	if err != nil {
+		return listOpts, err
+	}
+	if ok {
+		return listOpts, nil
+	}
+
+	userSelector := authtokens.UserIDLabel + "=" + ctx.User.GetName()
+	if listOpts.LabelSelector == "" {
+		listOpts.LabelSelector = userSelector
+	} else {
+		listOpts.LabelSelector += "," + userSelector
+	}
+	return listOpts, nil
+}
+
+// canManageAllTokens returns true if the requesting user can perform verb on the
+// management.cattle.io tokens of all users.
+func (s *Store) canManageAllTokens(ctx steveext.Context, verb string) (bool, error) {
+	decision, _, err := ctx.Authorizer.Authorize(ctx, authorizer.AttributesRecord{
+		User:            ctx.User,
+		Verb:            verb,
+		APIGroup:        apimgmtv3.SchemeGroupVersion.Group,
+		APIVersion:      apimgmtv3.SchemeGroupVersion.Version,
+		Resource:        apimgmtv3.TokenResourceName,
+		ResourceRequest: true,
+	})
+	if err != nil {
+		return false, apierrors.NewInternalError(fmt.Errorf("failed to authorize user %s: %w", ctx.User.GetName(), err))
+	}
+	return decision == authorizer.DecisionAllow, nil
+}
+
+// userPrincipalID returns the principal the tokens of the user are created for. The principal the
+// requesting user authenticated with is preferred, otherwise the first external principal of the user
+// is used, falling back to its local principal.
+func (s *Store) userPrincipalID(ctx steveext.Context, user *apimgmtv3.User) string {
+	if user.Name == ctx.User.GetName() {
+		if ids := ctx.User.GetExtra()[common.UserAttributePrincipalID]; len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+
+	localPrincipalID := "local://" + user.Name
+	for _, id := range user.PrincipalIDs {
+		if id != localPrincipalID {
+			return id
+		}
+	}
+	return localPrincipalID
+}
+
+// translateError returns errors about the backing tokens as errors about the ext.cattle.io tokens.
+func (s *Store) translateError(ctx steveext.Context, name string, err error) error {
+	switch {
+	case apierrors.IsNotFound(err):
+		return apierrors.NewNotFound(ctx.GroupVersionResource.GroupResource(), name)
+	case apierrors.IsAlreadyExists(err):
+		return apierrors.NewAlreadyExists(ctx.GroupVersionResource.GroupResource(), name)
+	case apierrors.IsConflict(err):
+		return apierrors.NewConflict(ctx.GroupVersionResource.GroupResource(), name, err)
+	case apierrors.IsInvalid(err), apierrors.IsForbidden(err):
+		return err
+	}
+	return apierrors.NewInternalError(err)
+}
+
+func toExtToken(token *apimgmtv3.Token) *extv1.Token {
+	token = token.DeepCopy()
+	if token.ExpiresAt == "" {
+		authtokens.SetTokenExpiresAt(token)
+	}
+
+	enabled := token.Enabled
+	if enabled == nil {
+		enabled = pointer.Bool(true)
+	}
+
+	result := &extv1.Token{
+		ObjectMeta: token.ObjectMeta,
+		Spec: extv1.TokenSpec{
+			UserID:      token.UserID,
+			Description: token.Description,
+			TTL:         token.TTLMillis,
+			ClusterName: token.ClusterName,
+			Enabled:     enabled,
+		},
+		Status: extv1.TokenStatus{
+			AuthProvider:  token.AuthProvider,
+			UserPrincipal: token.UserPrincipal.Name,
+			IsDerived:     token.IsDerived,
+			Expired:       token.Expired || authtokens.IsExpired(*token),
+			ExpiresAt:     token.ExpiresAt,
+			LastUsedAt:    token.LastUsedAt,
+		},
+	}
+	result.APIVersion, result.Kind = extv1.SchemeGroupVersion.WithKind("Token").ToAPIVersionAndKind()
+	result.ManagedFields = nil
+	return result
+}
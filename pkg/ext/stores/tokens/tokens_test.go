@@ -0,0 +1,259 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+
+	extv1 "github.com/rancher/rancher/pkg/apis/ext.cattle.io/v1"
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	authtokens "github.com/rancher/rancher/pkg/auth/tokens"
+	steveext "github.com/rancher/steve/pkg/ext"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func newContext(userName string, admin bool) steveext.Context {
+	return steveext.Context{
+		Context: context.Background(),
+		User: &user.DefaultInfo{
+			Name:  userName,
+			Extra: map[string][]string{"principalid": {"github_user://1234"}},
+		},
+		Authorizer: authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if admin && a.GetAPIGroup() == "management.cattle.io" && a.GetResource() == "tokens" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionDeny, "", nil
+		}),
+		GroupVersionResource: extv1.SchemeGroupVersion.WithResource(extv1.TokenResourceName),
+	}
+}
+
+func newStore(ctrl *gomock.Controller) (*Store, *fake.MockNonNamespacedClientInterface[*apimgmtv3.Token, *apimgmtv3.TokenList], *fake.MockNonNamespacedCacheInterface[*apimgmtv3.User]) {
+	tokenClient := fake.NewMockNonNamespacedClientInterface[*apimgmtv3.Token, *apimgmtv3.TokenList](ctrl)
+	userCache := fake.NewMockNonNamespacedCacheInterface[*apimgmtv3.User](ctrl)
+	return &Store{tokenClient: tokenClient, userCache: userCache}, tokenClient, userCache
+}
+
+func TestCreate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient, userCache := newStore(ctrl)
+
+	userCache.EXPECT().Get("u-alice").Return(&apimgmtv3.User{
+		ObjectMeta:   metav1.ObjectMeta{Name: "u-alice"},
+		Username:     "alice",
+		PrincipalIDs: []string{"local://u-alice", "github_user://1234"},
+	}, nil).AnyTimes()
+
+	var created *apimgmtv3.Token
+	tokenClient.EXPECT().Create(gomock.Any()).DoAndReturn(func(token *apimgmtv3.Token) (*apimgmtv3.Token, error) {
+		created = token.DeepCopy()
+		created.Name = "token-abcde"
+		return created, nil
+	})
+
+	result, err := store.Create(newContext("u-alice", false), &extv1.Token{
+		Spec: extv1.TokenSpec{Description: "ci", ClusterName: "c-12345"},
+	}, &metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.NotNil(t, created)
+	assert.Equal(t, "u-alice", created.UserID)
+	assert.Equal(t, "u-alice", created.Labels[authtokens.UserIDLabel])
+	assert.Equal(t, "github_user://1234", created.UserPrincipal.Name)
+	assert.Equal(t, "github", created.AuthProvider)
+	assert.True(t, created.IsDerived)
+
+	assert.Equal(t, "token-abcde", result.Name)
+	assert.Equal(t, "u-alice", result.Spec.UserID)
+	assert.Equal(t, "c-12345", result.Spec.ClusterName)
+	assert.True(t, *result.Spec.Enabled)
+	require.Contains(t, result.Status.Value, "token-abcde:")
+	_, key := authtokens.SplitTokenParts(result.Status.Value)
+	assert.NotEmpty(t, key)
+
+	// Regular users can't create tokens for other users.
+	_, err = store.Create(newContext("u-bob", false), &extv1.Token{Spec: extv1.TokenSpec{UserID: "u-alice"}}, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+
+	_, err = store.Create(newContext("u-alice", false), &extv1.Token{Spec: extv1.TokenSpec{TTL: -1}}, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsInvalid(err), "expected invalid, got %v", err)
+}
+
+func TestCreateForOtherUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient, userCache := newStore(ctrl)
+
+	userCache.EXPECT().Get("u-alice").Return(&apimgmtv3.User{
+		ObjectMeta:   metav1.ObjectMeta{Name: "u-alice"},
+		PrincipalIDs: []string{"local://u-alice"},
+	}, nil)
+	tokenClient.EXPECT().Create(gomock.Any()).DoAndReturn(func(token *apimgmtv3.Token) (*apimgmtv3.Token, error) {
+		return token, nil
+	})
+
+	result, err := store.Create(newContext("u-admin", true), &extv1.Token{Spec: extv1.TokenSpec{UserID: "u-alice"}}, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "u-alice", result.Spec.UserID)
+	assert.Equal(t, "local://u-alice", result.Status.UserPrincipal, "expected the principal of the user rather than the requester")
+	assert.Equal(t, "local", result.Status.AuthProvider)
+}
+
+func TestGetAndDeleteScoping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient, _ := newStore(ctrl)
+
+	tokenClient.EXPECT().Get("token-alice", gomock.Any()).Return(&apimgmtv3.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-alice"},
+		UserID:     "u-alice",
+		Token:      "hashed",
+	}, nil).AnyTimes()
+
+	token, err := store.Get(newContext("u-alice", false), "token-alice", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, token.Status.Value, "expected the token value to never be returned after creation")
+
+	_, err = store.Get(newContext("u-bob", false), "token-alice", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "expected tokens of other users to be hidden, got %v", err)
+
+	_, err = store.Get(newContext("u-admin", true), "token-alice", &metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	err = store.Delete(newContext("u-bob", false), "token-alice", &metav1.DeleteOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "expected tokens of other users to be hidden, got %v", err)
+
+	tokenClient.EXPECT().Delete("token-alice", gomock.Any()).Return(nil)
+	assert.NoError(t, store.Delete(newContext("u-alice", false), "token-alice", &metav1.DeleteOptions{}))
+}
+
+func TestUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient, _ := newStore(ctrl)
+
+	tokenClient.EXPECT().Get("token-alice", gomock.Any()).Return(&apimgmtv3.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "token-alice",
+			Labels:      map[string]string{authtokens.UserIDLabel: "u-alice"},
+			Annotations: map[string]string{authtokens.TokenHashed: "true"},
+		},
+		UserID:    "u-alice",
+		TTLMillis: 1000,
+	}, nil).AnyTimes()
+
+	_, err := store.Update(newContext("u-alice", false), &extv1.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-alice"},
+		Spec:       extv1.TokenSpec{TTL: 5000},
+	}, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsInvalid(err), "expected the ttl to be immutable, got %v", err)
+
+	var updated *apimgmtv3.Token
+	tokenClient.EXPECT().Update(gomock.Any()).DoAndReturn(func(token *apimgmtv3.Token) (*apimgmtv3.Token, error) {
+		updated = token
+		return token, nil
+	})
+	enabled := false
+	_, err = store.Update(newContext("u-alice", false), &extv1.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-alice"},
+		Spec:       extv1.TokenSpec{TTL: 1000, Description: "disabled", Enabled: &enabled},
+	}, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "disabled", updated.Description)
+	assert.False(t, *updated.Enabled)
+	assert.Equal(t, "u-alice", updated.Labels[authtokens.UserIDLabel], "expected the user label to be kept")
+	assert.Equal(t, "true", updated.Annotations[authtokens.TokenHashed], "expected the hashed annotation to be kept")
+}
+
+func TestListAndWatchScoping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient, _ := newStore(ctrl)
+
+	tokenClient.EXPECT().List(metav1.ListOptions{LabelSelector: "env=ci," + authtokens.UserIDLabel + "=u-alice"}).Return(&apimgmtv3.TokenList{
+		Items: []apimgmtv3.Token{{ObjectMeta: metav1.ObjectMeta{Name: "token-alice"}, UserID: "u-alice"}},
+	}, nil)
+	list, err := store.List(newContext("u-alice", false), &metav1.ListOptions{LabelSelector: "env=ci"})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "token-alice", list.Items[0].Name)
+
+	tokenClient.EXPECT().List(metav1.ListOptions{}).Return(&apimgmtv3.TokenList{}, nil)
+	_, err = store.List(newContext("u-admin", true), &metav1.ListOptions{})
+	require.NoError(t, err)
+
+	watcher := watch.NewFake()
+	tokenClient.EXPECT().Watch(metav1.ListOptions{LabelSelector: authtokens.UserIDLabel + "=u-alice"}).Return(watcher, nil)
+	ctx := newContext("u-alice", false)
+	watchCtx, cancel := context.WithCancel(ctx.Context)
+	ctx.Context = watchCtx
+	events, err := store.Watch(ctx, &metav1.ListOptions{})
+	require.NoError(t, err)
+
+	go watcher.Add(&apimgmtv3.Token{ObjectMeta: metav1.ObjectMeta{Name: "token-alice"}, UserID: "u-alice"})
+	event := <-events
+	assert.Equal(t, watch.Added, event.Event)
+	assert.Equal(t, "token-alice", event.Object.Name)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestUpdateEnableDisabledByAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store, tokenClient, _ := newStore(ctrl)
+
+	disabled := false
+	current := &apimgmtv3.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "token-alice",
+			Labels: map[string]string{authtokens.UserIDLabel: "u-alice"},
+		},
+		UserID:  "u-alice",
+		Enabled: &disabled,
+	}
+	tokenClient.EXPECT().Get("token-alice", gomock.Any()).DoAndReturn(func(string, metav1.GetOptions) (*apimgmtv3.Token, error) {
+		return current.DeepCopy(), nil
+	}).AnyTimes()
+	tokenClient.EXPECT().Update(gomock.Any()).DoAndReturn(func(token *apimgmtv3.Token) (*apimgmtv3.Token, error) {
+		current = token
+		return token, nil
+	}).AnyTimes()
+
+	current.Enabled = nil
+	_, err := store.Update(newContext("u-admin", true), &extv1.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-alice"},
+		Spec:       extv1.TokenSpec{Enabled: &disabled},
+	}, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "u-admin", current.Annotations[DisabledByAnnotation])
+
+	enabled := true
+	_, err = store.Update(newContext("u-alice", false), &extv1.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "token-alice",
+			Annotations: map[string]string{DisabledByAnnotation: "u-alice"},
+		},
+		Spec: extv1.TokenSpec{Enabled: &enabled},
+	}, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "expected the owner not to be able to enable the token, got %v", err)
+
+	_, err = store.Update(newContext("u-alice", false), &extv1.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-alice"},
+		Spec:       extv1.TokenSpec{Description: "still disabled", Enabled: &disabled},
+	}, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "u-admin", current.Annotations[DisabledByAnnotation], "expected the annotation to be kept while the token is disabled")
+
+	_, err = store.Update(newContext("u-admin", true), &extv1.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-alice"},
+		Spec:       extv1.TokenSpec{Enabled: &enabled},
+	}, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, current.Annotations, DisabledByAnnotation)
+}
@@ -32,6 +32,8 @@ func init() {
 
 type Interface interface {
 	APIService() APIServiceController
+	AccessRequest() AccessRequestController
+	AccessReviewReport() AccessReviewReportController
 	ActiveDirectoryProvider() ActiveDirectoryProviderController
 	AuthConfig() AuthConfigController
 	AuthProvider() AuthProviderController
@@ -89,6 +91,7 @@ type Interface interface {
 	SamlProvider() SamlProviderController
 	SamlToken() SamlTokenController
 	Setting() SettingController
+	ShellRecording() ShellRecordingController
 	Template() TemplateController
 	TemplateContent() TemplateContentController
 	TemplateVersion() TemplateVersionController
@@ -111,6 +114,14 @@ func (v *version) APIService() APIServiceController {
 	return generic.NewNonNamespacedController[*v3.APIService, *v3.APIServiceList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "APIService"}, "apiservices", v.controllerFactory)
 }
 
+func (v *version) AccessRequest() AccessRequestController {
+	return generic.NewNonNamespacedController[*v3.AccessRequest, *v3.AccessRequestList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "AccessRequest"}, "accessrequests", v.controllerFactory)
+}
+
+func (v *version) AccessReviewReport() AccessReviewReportController {
+	return generic.NewNonNamespacedController[*v3.AccessReviewReport, *v3.AccessReviewReportList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "AccessReviewReport"}, "accessreviewreports", v.controllerFactory)
+}
+
 func (v *version) ActiveDirectoryProvider() ActiveDirectoryProviderController {
 	return generic.NewNonNamespacedController[*v3.ActiveDirectoryProvider, *v3.ActiveDirectoryProviderList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "ActiveDirectoryProvider"}, "activedirectoryproviders", v.controllerFactory)
 }
@@ -339,6 +350,10 @@ func (v *version) Setting() SettingController {
 	return generic.NewNonNamespacedController[*v3.Setting, *v3.SettingList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "Setting"}, "settings", v.controllerFactory)
 }
 
+func (v *version) ShellRecording() ShellRecordingController {
+	return generic.NewNonNamespacedController[*v3.ShellRecording, *v3.ShellRecordingList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "ShellRecording"}, "shellrecordings", v.controllerFactory)
+}
+
 func (v *version) Template() TemplateController {
 	return generic.NewNonNamespacedController[*v3.Template, *v3.TemplateList](schema.GroupVersionKind{Group: "management.cattle.io", Version: "v3", Kind: "Template"}, "templates", v.controllerFactory)
 }
@@ -0,0 +1,237 @@
+// Package collectors defines the Prometheus metrics recorded by the management plane of Rancher. It doesn't depend
+// on other Rancher packages so that any of them can record metrics, the metrics package registers the collectors.
+package collectors
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// OutcomeSuccess is the outcome of an operation that succeeded.
+	OutcomeSuccess = "success"
+	// OutcomeFailure is the outcome of an operation that failed.
+	OutcomeFailure = "failure"
+)
+
+var prometheusMetrics atomic.Bool
+
+var (
+	LoginAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "auth",
+			Name:      "login_attempts_total",
+			Help:      "Total number of login attempts per auth provider",
+		},
+		[]string{"provider"},
+	)
+
+	LoginFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "auth",
+			Name:      "login_failures_total",
+			Help:      "Total number of failed login attempts per auth provider",
+		},
+		[]string{"provider"},
+	)
+
+	TokenCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: "auth",
+			Name:      "token_cache_hits_total",
+			Help:      "Total number of tokens authenticating requests that were found in the cache",
+		},
+	)
+
+	TokenCacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: "auth",
+			Name:      "token_cache_misses_total",
+			Help:      "Total number of tokens authenticating requests that had to be retrieved from the API server",
+		},
+	)
+
+	TunnelSessions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "tunnel",
+			Name:      "sessions",
+			Help:      "Number of remotedialer sessions of agents of a cluster connected to this Rancher server",
+		},
+		[]string{"cluster"},
+	)
+
+	TunnelReconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "tunnel",
+			Name:      "reconnects_total",
+			Help:      "Total number of remotedialer sessions of agents of a cluster that reconnected to this Rancher server",
+		},
+		[]string{"cluster"},
+	)
+
+	HelmOperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: "catalog",
+			Name:      "helm_operation_duration_seconds",
+			Help:      "Duration of Helm operations from their creation until their pod completed",
+			Buckets:   prometheus.ExponentialBuckets(5, 2, 9),
+		},
+		[]string{"action", "outcome"},
+	)
+
+	RepoDownloadDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: "catalog",
+			Name:      "repo_download_duration_seconds",
+			Help:      "Duration of the downloads of the index of ClusterRepos",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+		},
+		[]string{"repo", "type"},
+	)
+
+	RepoDownloadErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "catalog",
+			Name:      "repo_download_errors_total",
+			Help:      "Total number of failed downloads of the index of ClusterRepos",
+		},
+		[]string{"repo", "type"},
+	)
+
+	PlannerReconcileDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: "capr",
+			Name:      "planner_reconcile_duration_seconds",
+			Help:      "Duration of the reconciliations of the plans of the machines of an RKEControlPlane",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"cluster", "result"},
+	)
+
+	CertificateExpiration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "cluster",
+			Name:      "certificate_expiration_timestamp_seconds",
+			Help:      "Expiration date of the certificates of a cluster as a Unix timestamp",
+		},
+		[]string{"cluster", "certificate"},
+	)
+
+	CertificatesExpiring = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "cluster",
+			Name:      "certificates_expiring",
+			Help:      "Number of certificates of a cluster that expired or expire within the threshold of the severity",
+		},
+		[]string{"cluster", "severity"},
+	)
+)
+
+// Register registers the collectors and enables recording metrics.
+func Register() {
+	prometheusMetrics.Store(true)
+
+	prometheus.MustRegister(LoginAttempts)
+	prometheus.MustRegister(LoginFailures)
+	prometheus.MustRegister(TokenCacheHits)
+	prometheus.MustRegister(TokenCacheMisses)
+	prometheus.MustRegister(TunnelSessions)
+	prometheus.MustRegister(TunnelReconnects)
+	prometheus.MustRegister(HelmOperationDuration)
+	prometheus.MustRegister(RepoDownloadDuration)
+	prometheus.MustRegister(RepoDownloadErrors)
+	prometheus.MustRegister(PlannerReconcileDuration)
+	prometheus.MustRegister(CertificateExpiration)
+	prometheus.MustRegister(CertificatesExpiring)
+}
+
+// ObserveLogin records a login attempt with the given provider, which failed if err isn't nil.
+func ObserveLogin(provider string, err error) {
+	if !prometheusMetrics.Load() {
+		return
+	}
+	LoginAttempts.WithLabelValues(provider).Inc()
+	if err != nil {
+		LoginFailures.WithLabelValues(provider).Inc()
+	}
+}
+
+// ObserveTokenCache records whether a token was found in the cache.
+func ObserveTokenCache(hit bool) {
+	if !prometheusMetrics.Load() {
+		return
+	}
+	if hit {
+		TokenCacheHits.Inc()
+	} else {
+		TokenCacheMisses.Inc()
+	}
+}
+
+// AddTunnelSession records that a session of an agent of the cluster connected, and whether it reconnected. It returns
+// whether the session was recorded, only then must RemoveTunnelSession be called once it disconnects.
+func AddTunnelSession(cluster string, reconnect bool) bool {
+	if !prometheusMetrics.Load() {
+		return false
+	}
+	TunnelSessions.WithLabelValues(cluster).Inc()
+	if reconnect {
+		TunnelReconnects.WithLabelValues(cluster).Inc()
+	}
+	return true
+}
+
+// RemoveTunnelSession records that a session of an agent of the cluster, recorded by AddTunnelSession, disconnected.
+func RemoveTunnelSession(cluster string) {
+	TunnelSessions.WithLabelValues(cluster).Dec()
+}
+
+// ObserveHelmOperation records a completed Helm operation of the given action, e.g. install.
+func ObserveHelmOperation(action string, duration time.Duration, succeeded bool) {
+	if !prometheusMetrics.Load() {
+		return
+	}
+	outcome := OutcomeSuccess
+	if !succeeded {
+		outcome = OutcomeFailure
+	}
+	HelmOperationDuration.WithLabelValues(action, outcome).Observe(duration.Seconds())
+}
+
+// ObserveRepoDownload records a download of the index of a ClusterRepo of the given type, e.g. git,
+// which failed if err isn't nil.
+func ObserveRepoDownload(repo, repoType string, duration time.Duration, err error) {
+	if !prometheusMetrics.Load() {
+		return
+	}
+	RepoDownloadDuration.WithLabelValues(repo, repoType).Observe(duration.Seconds())
+	if err != nil {
+		RepoDownloadErrors.WithLabelValues(repo, repoType).Inc()
+	}
+}
+
+// ObservePlannerReconcile records a reconciliation of the RKEControlPlane of the cluster with the given result,
+// e.g. waiting.
+func ObservePlannerReconcile(cluster, result string, duration time.Duration) {
+	if !prometheusMetrics.Load() {
+		return
+	}
+	PlannerReconcileDuration.WithLabelValues(cluster, result).Observe(duration.Seconds())
+}
+
+// SetCertificatesExpiration records the expiration dates of the certificates of the cluster, and the number of them
+// that expire soon per severity, e.g. critical, replacing the ones recorded previously.
+func SetCertificatesExpiration(cluster string, expirations map[string]time.Time, expiring map[string]int) {
+	if !prometheusMetrics.Load() {
+		return
+	}
+	CertificateExpiration.DeletePartialMatch(prometheus.Labels{"cluster": cluster})
+	for certificate, date := range expirations {
+		CertificateExpiration.WithLabelValues(cluster, certificate).Set(float64(date.Unix()))
+	}
+	for severity, count := range expiring {
+		CertificatesExpiring.WithLabelValues(cluster, severity).Set(float64(count))
+	}
+}
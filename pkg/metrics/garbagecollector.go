@@ -6,8 +6,10 @@
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
 	v1 "github.com/rancher/rancher/pkg/generated/norman/core/v1"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	"github.com/rancher/rancher/pkg/settings"
 	rm "github.com/rancher/remotedialer/metrics"
 	"github.com/sirupsen/logrus"
@@ -23,12 +25,22 @@
 	targetMetricsByIPForPeer = []interface{}{
 		rm.TotalAddPeerAttempt, rm.TotalPeerConnected, rm.TotalPeerDisConnected,
 	}
+
+	targetMetricsByCluster = []interface{}{
+		collectors.TunnelSessions, collectors.TunnelReconnects, collectors.PlannerReconcileDuration,
+		collectors.CertificateExpiration, collectors.CertificatesExpiring,
+	}
+
+	targetMetricsByRepo = []interface{}{
+		collectors.RepoDownloadDuration, collectors.RepoDownloadErrors,
+	}
 )
 
 type metricGarbageCollector struct {
-	clusterLister  v3.ClusterLister
-	nodeLister     v3.NodeLister
-	endpointLister v1.EndpointsLister
+	clusterLister    v3.ClusterLister
+	nodeLister       v3.NodeLister
+	endpointLister   v1.EndpointsLister
+	clusterRepoCache catalogcontrollers.ClusterRepoCache
 }
 
 func (gc *metricGarbageCollector) metricGarbageCollection() {
@@ -85,12 +97,32 @@ func (gc *metricGarbageCollector) metricGarbageCollection() {
 	buildObservedLabelMaps(targetMetricsByNameForClientKey, "clientkey", observedLabelsMap)
 	buildObservedLabelMaps(targetMetricsByIPForPeer, "peer", observedLabelsMap)
 	buildObservedLabelMaps([]interface{}{clusterOwner}, "cluster", observedLabelsMap)
+	buildObservedLabelMaps(targetMetricsByCluster, "cluster", observedLabelsMap)
 
 	removedCount := removeMetricsForDeletedResource(observedLabelsMap, observedResourceNames)
+	removedCount += gc.repoMetricGarbageCollection()
 
 	logrus.Debugf("[metrics-garbage-collector] Finished - removed %d items", removedCount)
 }
 
+// repoMetricGarbageCollection removes the metrics of deleted ClusterRepos. ClusterRepos are observed separately from
+// the other resources, as their names may be the same as the names of clusters.
+func (gc *metricGarbageCollector) repoMetricGarbageCollection() int {
+	repos, err := gc.clusterRepoCache.List(labels.Everything())
+	if err != nil {
+		logrus.Errorf("[metrics-garbage-collector] failed to list cluster repos: %s", err)
+		return 0
+	}
+	observedRepoNames := map[string]bool{}
+	for _, repo := range repos {
+		observedRepoNames[repo.Name] = true
+	}
+
+	observedLabelsMap := map[string]map[interface{}][]map[string]string{}
+	buildObservedLabelMaps(targetMetricsByRepo, "repo", observedLabelsMap)
+	return removeMetricsForDeletedResource(observedLabelsMap, observedRepoNames)
+}
+
 func buildObservedLabelMaps(collectors []interface{}, targetLabel string, observedLabels map[string]map[interface{}][]map[string]string) int {
 	// Example of the map structure of observedLabels:
 	// {
@@ -152,6 +184,12 @@ func removeMetricsForDeletedResource(observedMetrics map[string]map[interface{}]
 					} else {
 						logrus.Errorf("[metrics-garbage-collector] failed to delete %T metrics related to %s: %v", v, m, label)
 					}
+				case *prometheus.HistogramVec:
+					if v.Delete(label) {
+						removedCount++
+					} else {
+						logrus.Errorf("[metrics-garbage-collector] failed to delete %T metrics related to %s: %v", v, m, label)
+					}
 				default:
 					logrus.Errorf("[metrics-garbage-collector] saw unknown Metric definition %T", v)
 				}
@@ -11,6 +11,7 @@
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/rancher/rancher/pkg/auth/requests/sar"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
 	"github.com/rancher/rancher/pkg/settings"
 	"github.com/rancher/rancher/pkg/types/config"
 )
@@ -49,10 +50,14 @@ func Register(ctx context.Context, scaledContext *config.ScaledContext) {
 	prometheus.MustRegister(numNodes)
 	prometheus.MustRegister(numCores)
 
+	// management plane metrics
+	collectors.Register()
+
 	gc := metricGarbageCollector{
-		clusterLister:  scaledContext.Management.Clusters("").Controller().Lister(),
-		nodeLister:     scaledContext.Management.Nodes("").Controller().Lister(),
-		endpointLister: scaledContext.Core.Endpoints(settings.Namespace.Get()).Controller().Lister(),
+		clusterLister:    scaledContext.Management.Clusters("").Controller().Lister(),
+		nodeLister:       scaledContext.Management.Nodes("").Controller().Lister(),
+		endpointLister:   scaledContext.Core.Endpoints(settings.Namespace.Get()).Controller().Lister(),
+		clusterRepoCache: scaledContext.Wrangler.Catalog.ClusterRepo().Cache(),
 	}
 
 	nm := &nodeMetrics{
@@ -14,6 +14,7 @@
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/rancher/rancher/pkg/api/steve/health"
 	"github.com/rancher/rancher/pkg/auth/providerrefresh"
 	"github.com/rancher/rancher/pkg/auth/providers/common"
 	"github.com/rancher/rancher/pkg/auth/tokens"
@@ -119,6 +120,8 @@ func newMCM(ctx context.Context, wranglerContext *wrangler.Context, cfg *Options
 		metrics.Register(ctx, scaledContext)
 	}
 
+	health.AddReadyzChecks(health.ClusterControllersCheck(clusterManager.ControllerCounts))
+
 	mcm := &mcm{
 		router:              router,
 		ScaledContext:       scaledContext,
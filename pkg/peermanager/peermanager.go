@@ -9,6 +9,8 @@ type Peers struct {
 
 type PeerManager interface {
 	IsLeader() bool
+	// Peers returns the current state of the peers of this replica.
+	Peers() Peers
 	Leader()
 	AddListener(l chan<- Peers)
 	RemoveListener(l chan<- Peers)
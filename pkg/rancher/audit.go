@@ -0,0 +1,93 @@
+package rancher
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/rancher/rancher/pkg/auth/audit"
+	"github.com/rancher/rancher/pkg/namespace"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const auditLogSigningKeySize = 32
+
+// newAuditLogWriter creates the audit log writer for the local log file and any additional sinks enabled in opts.
+func newAuditLogWriter(opts *Options, secrets corecontrollers.SecretClient) (*audit.LogWriter, error) {
+	var sinks []audit.Sink
+
+	if opts.AuditLogStdoutLevel > 0 {
+		sinks = append(sinks, audit.NewWriterSink("stdout", audit.Level(opts.AuditLogStdoutLevel), os.Stdout))
+	}
+
+	if opts.AuditLogSyslogAddress != "" && opts.AuditLogSyslogLevel > 0 {
+		var tlsConfig *tls.Config
+		if opts.AuditLogSyslogTLS {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			if opts.AuditLogSyslogCAFile != "" {
+				ca, err := os.ReadFile(opts.AuditLogSyslogCAFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read audit log syslog CA file: %w", err)
+				}
+				pool := x509.NewCertPool()
+				if !pool.AppendCertsFromPEM(ca) {
+					return nil, fmt.Errorf("no certificates found in audit log syslog CA file %s", opts.AuditLogSyslogCAFile)
+				}
+				tlsConfig.RootCAs = pool
+			}
+		}
+		sinks = append(sinks, audit.NewSyslogSink(opts.AuditLogSyslogAddress, audit.Level(opts.AuditLogSyslogLevel), tlsConfig))
+	}
+
+	if opts.AuditLogWebhookURL != "" && opts.AuditLogWebhookLevel > 0 {
+		sinks = append(sinks, audit.NewWebhookSink(opts.AuditLogWebhookURL, audit.Level(opts.AuditLogWebhookLevel), nil, audit.DefaultWebhookBatchSize, opts.AuditLogWebhookSpoolPath))
+	}
+
+	writer := audit.NewLogWriter(opts.AuditLogPath, audit.Level(opts.AuditLevel), opts.AuditLogMaxage, opts.AuditLogMaxbackup, opts.AuditLogMaxsize, sinks...)
+
+	if writer != nil && opts.AuditLogSigningSecret != "" {
+		key, err := auditLogSigningKey(secrets, opts.AuditLogSigningSecret)
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.EnableHashChain(key, opts.AuditLogSigningInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	return writer, nil
+}
+
+// auditLogSigningKey returns the audit log signing key from the named secret, creating the secret with a random key if it doesn't exist.
+func auditLogSigningKey(secrets corecontrollers.SecretClient, name string) ([]byte, error) {
+	secret, err := secrets.Get(namespace.System, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		key := make([]byte, auditLogSigningKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate audit log signing key: %w", err)
+		}
+		secret, err = secrets.Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace.System,
+			},
+			Data: map[string][]byte{
+				audit.SigningKeySecretField: key,
+			},
+		})
+		if apierrors.IsAlreadyExists(err) {
+			// Another replica created the secret first.
+			secret, err = secrets.Get(namespace.System, name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log signing key secret %s/%s: %w", namespace.System, name, err)
+	}
+
+	return audit.SigningKeyFromSecret(secret)
+}
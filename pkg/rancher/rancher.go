@@ -20,6 +20,7 @@
 	"github.com/rancher/rancher/pkg/auth"
 	"github.com/rancher/rancher/pkg/auth/audit"
 	"github.com/rancher/rancher/pkg/auth/requests"
+	authutil "github.com/rancher/rancher/pkg/auth/util"
 	"github.com/rancher/rancher/pkg/controllers/dashboard"
 	"github.com/rancher/rancher/pkg/controllers/dashboard/apiservice"
 	"github.com/rancher/rancher/pkg/controllers/dashboard/plugin"
@@ -37,7 +38,9 @@
 	"github.com/rancher/rancher/pkg/multiclustermanager"
 	"github.com/rancher/rancher/pkg/namespace"
 	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/shellrecording"
 	"github.com/rancher/rancher/pkg/tls"
+	"github.com/rancher/rancher/pkg/tracing"
 	"github.com/rancher/rancher/pkg/ui"
 	"github.com/rancher/rancher/pkg/websocket"
 	"github.com/rancher/rancher/pkg/wrangler"
@@ -83,6 +86,20 @@ type Options struct {
 	AuditLevel        int
 	Features          string
 	ClusterRegistry   string
+
+	AuditLogStdoutLevel      int
+	AuditLogSyslogAddress    string
+	AuditLogSyslogLevel      int
+	AuditLogSyslogTLS        bool
+	AuditLogSyslogCAFile     string
+	AuditLogWebhookURL       string
+	AuditLogWebhookLevel     int
+	AuditLogWebhookSpoolPath string
+	AuditLogSigningSecret    string
+	AuditLogSigningInterval  int
+
+	TracingEndpoint      string
+	TracingSamplingRatio float64
 }
 
 type Rancher struct {
@@ -105,6 +122,10 @@ func New(ctx context.Context, clientConfg clientcmd.ClientConfig, opts *Options)
 		opts = &Options{}
 	}
 
+	if err := tracing.Setup(ctx, opts.TracingEndpoint, opts.TracingSamplingRatio); err != nil {
+		return nil, err
+	}
+
 	restConfig, err := clientConfg.ClientConfig()
 	if err != nil {
 		return nil, err
@@ -221,6 +242,7 @@ func New(ctx context.Context, clientConfg clientcmd.ClientConfig, opts *Options)
 		wranglerContext.Mgmt.Cluster().Cache(),
 		localClusterEnabled(opts),
 		steve,
+		shellrecording.NewRecorder(wranglerContext),
 	)
 	if err != nil {
 		return nil, err
@@ -232,8 +254,12 @@ func New(ctx context.Context, clientConfg clientcmd.ClientConfig, opts *Options)
 		return nil, err
 	}
 
-	auditLogWriter := audit.NewLogWriter(opts.AuditLogPath, audit.Level(opts.AuditLevel), opts.AuditLogMaxage, opts.AuditLogMaxbackup, opts.AuditLogMaxsize)
-	auditFilter, err := audit.NewAuditLogMiddleware(auditLogWriter)
+	auditLogWriter, err := newAuditLogWriter(opts, wranglerContext.Core.Secret())
+	if err != nil {
+		return nil, err
+	}
+	authutil.SetSystemAuditFunc(auditLogWriter.WriteSystemAction)
+	auditFilter, err := audit.NewAuditLogMiddleware(auditLogWriter, settings.AuditLogPolicy.Get)
 	if err != nil {
 		return nil, err
 	}
@@ -318,7 +344,7 @@ func (r *Rancher) ListenAndServe(ctx context.Context) error {
 	r.startAggregation(ctx)
 	go r.Steve.StartAggregation(ctx)
 	if err := tls.ListenAndServe(ctx, r.Wrangler.RESTConfig,
-		r.Auth(r.Handler),
+		tracing.NewHandler(r.Auth(r.Handler)),
 		r.opts.BindHost,
 		r.opts.HTTPSListenPort,
 		r.opts.HTTPListenPort,
@@ -7,6 +7,7 @@
 
 	"github.com/pkg/errors"
 	"github.com/rancher/norman/types"
+	"github.com/rancher/norman/types/slice"
 	mgmt "github.com/rancher/rancher/pkg/apis/management.cattle.io"
 	provv1 "github.com/rancher/rancher/pkg/apis/provisioning.cattle.io/v1"
 	v32 "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
@@ -267,6 +268,53 @@ func gatherRules(clusterRoles k8srbacv1.ClusterRoleCache, roleTemplates v32.Role
 	return rules, nil
 }
 
+// InheritedRoleTemplates returns the names of the role templates a role template inherits from, recursively.
+func InheritedRoleTemplates(roleTemplates v32.RoleTemplateCache, rt *v3.RoleTemplate) ([]string, error) {
+	var names []string
+	seen := map[string]bool{rt.Name: true}
+	pending := append([]string{}, rt.RoleTemplateNames...)
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+
+		next, err := roleTemplates.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, next.RoleTemplateNames...)
+	}
+	return names, nil
+}
+
+// IsAdminGlobalRole returns true if a global role grants full access to everything, in which case its
+// subjects are bound to the cluster-admin role of every downstream cluster.
+func IsAdminGlobalRole(gr *v3.GlobalRole) bool {
+	// global role is builtin admin role
+	if gr.Builtin && gr.Name == GlobalAdmin {
+		return true
+	}
+
+	var hasResourceRule, hasNonResourceRule bool
+	for _, rule := range gr.Rules {
+		if slice.ContainsString(rule.Resources, "*") && slice.ContainsString(rule.APIGroups, "*") && slice.ContainsString(rule.Verbs, "*") {
+			hasResourceRule = true
+			continue
+		}
+		if slice.ContainsString(rule.NonResourceURLs, "*") && slice.ContainsString(rule.Verbs, "*") {
+			hasNonResourceRule = true
+			continue
+		}
+	}
+
+	// global role has an admin resource rule, and admin nonResourceURLs rule
+	return hasResourceRule && hasNonResourceRule
+}
+
 func ProvisioningClusterAdminName(cluster *provv1.Cluster) string {
 	return wranglerName.SafeConcatName("crt", cluster.Name, "cluster-owner")
 }
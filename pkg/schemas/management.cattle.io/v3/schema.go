@@ -302,7 +302,10 @@ func authzTypes(schemas *types.Schemas) *types.Schemas {
 		AddMapperForType(&Version, v3.RoleTemplate{}, m.DisplayName{}).
 		AddMapperForType(&Version, v3.ProjectRoleTemplateBinding{},
 			&mapper.NamespaceIDMapper{},
+			mapper.ExpiresIn{Field: "expiresAt"},
 		).
+		AddMapperForType(&Version, v3.ClusterRoleTemplateBinding{}, mapper.ExpiresIn{Field: "expiresAt"}).
+		AddMapperForType(&Version, v3.GlobalRoleBinding{}, mapper.ExpiresIn{Field: "expiresAt"}).
 		MustImport(&Version, v3.ImportYamlOutput{}).
 		MustImportAndCustomize(&Version, v3.Project{}, func(schema *types.Schema) {
 			schema.ResourceActions = map[string]types.Action{
@@ -435,6 +438,10 @@ func authnTypes(schemas *types.Schemas) *types.Schemas {
 		MustImport(&Version, v3.SearchPrincipalsInput{}).
 		MustImport(&Version, v3.ChangePasswordInput{}).
 		MustImport(&Version, v3.SetPasswordInput{}).
+		MustImport(&Version, v3.MFAEnrollOutput{}).
+		MustImport(&Version, v3.MFAConfirmInput{}).
+		MustImport(&Version, v3.MFAConfirmOutput{}).
+		MustImport(&Version, v3.MFADisableInput{}).
 		MustImportAndCustomize(&Version, v3.User{}, func(schema *types.Schema) {
 			schema.ResourceActions = map[string]types.Action{
 				"setpassword": {
@@ -442,11 +449,27 @@ func authnTypes(schemas *types.Schemas) *types.Schemas {
 					Output: "user",
 				},
 				"refreshauthprovideraccess": {},
+				"unlock": {
+					Output: "user",
+				},
+				"resetmfa": {
+					Output: "user",
+				},
 			}
 			schema.CollectionActions = map[string]types.Action{
 				"changepassword": {
 					Input: "changePasswordInput",
 				},
+				"enrollmfa": {
+					Output: "mfaEnrollOutput",
+				},
+				"confirmmfa": {
+					Input:  "mfaConfirmInput",
+					Output: "mfaConfirmOutput",
+				},
+				"disablemfa": {
+					Input: "mfaDisableInput",
+				},
 				"refreshauthprovideraccess": {},
 			}
 		}).
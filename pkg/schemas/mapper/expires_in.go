@@ -0,0 +1,51 @@
+package mapper
+
+import (
+	"time"
+
+	"github.com/rancher/norman/types"
+	"github.com/rancher/norman/types/convert"
+)
+
+// ExpiresIn adds a read-only field with the time remaining until the time held by the Field of the resource,
+// e.g. "1h30m0s". It is "0s" once that time has passed and unset if the resource doesn't expire.
+type ExpiresIn struct {
+	Field string
+	now   func() time.Time
+}
+
+func (e ExpiresIn) FromInternal(data map[string]interface{}) {
+	if data == nil {
+		return
+	}
+	expiresAt, err := time.Parse(time.RFC3339, convert.ToString(data[e.Field]))
+	if err != nil {
+		return
+	}
+
+	now := time.Now
+	if e.now != nil {
+		now = e.now
+	}
+	remaining := expiresAt.Sub(now()).Truncate(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	data["expiresIn"] = remaining.String()
+}
+
+func (e ExpiresIn) ToInternal(data map[string]interface{}) error {
+	if data != nil {
+		delete(data, "expiresIn")
+	}
+	return nil
+}
+
+func (e ExpiresIn) ModifySchema(schema *types.Schema, schemas *types.Schemas) error {
+	schema.ResourceFields["expiresIn"] = types.Field{
+		Type:   "string",
+		Create: false,
+		Update: false,
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiresIn(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mapper := ExpiresIn{Field: "expiresAt", now: func() time.Time { return now }}
+
+	data := map[string]interface{}{"expiresAt": "2024-01-01T13:30:00Z"}
+	mapper.FromInternal(data)
+	assert.Equal(t, "1h30m0s", data["expiresIn"])
+
+	data = map[string]interface{}{"expiresAt": "2024-01-01T11:00:00Z"}
+	mapper.FromInternal(data)
+	assert.Equal(t, "0s", data["expiresIn"], "expected no time to remain after expiry")
+
+	data = map[string]interface{}{}
+	mapper.FromInternal(data)
+	assert.NotContains(t, data, "expiresIn", "expected bindings without expiry to have no remaining time")
+
+	data = map[string]interface{}{"expiresAt": "2024-01-01T13:30:00Z", "expiresIn": "1h"}
+	assert.NoError(t, mapper.ToInternal(data))
+	assert.NotContains(t, data, "expiresIn")
+}
@@ -93,6 +93,15 @@
 	MachineVersion                      = NewSetting("machine-version", "dev")
 	Namespace                           = NewSetting("namespace", os.Getenv("CATTLE_NAMESPACE"))
 	PasswordMinLength                   = NewSetting("password-min-length", "12")
+	PasswordRequiredCharacterClasses    = NewSetting("password-required-character-classes", "")     // comma separated list of upper, lower, digit and symbol
+	PasswordDenyCommon                  = NewSetting("password-deny-common", "false")               // reject new passwords from the list of commonly used passwords, existing passwords are not affected
+	PasswordHistorySize                 = NewSetting("password-history-size", "0")                  // number of previous passwords of a local user that can't be reused
+	PasswordMaxAgeDays                  = NewSetting("password-max-age-days", "0")                  // local users must change their password on the next login once it is older, 0 disables expiry
+	AuthLocalLockoutMaxAttempts         = NewSetting("auth-local-lockout-max-attempts", "10")       // consecutive failed local logins per username, or per source IP if auth-trusted-proxies is set, before a lockout, 0 disables lockouts
+	AuthLocalLockoutDuration            = NewSetting("auth-local-lockout-duration", "15m")          // how long a lockout lasts, expressed as a time.Duration
+	AuthLocalLockoutReset               = NewSetting("auth-local-lockout-reset", "")                // RFC3339 time, lockouts of source IPs and unknown usernames that started before it are lifted on every server
+	AuthTrustedProxies                  = NewSetting("auth-trusted-proxies", "")                    // comma separated IPs or CIDRs of proxies whose X-Forwarded-For and X-Real-Ip headers identify the client IP, logins are only locked out and rate limited per client IP if set
+	AuthLocalMFARequiredForAdmins       = NewSetting("auth-local-mfa-required-for-admins", "false") // local users bound to the admin or restricted-admin global roles must enroll in multi-factor authentication, until then their logins only allow the enrollment
 	PeerServices                        = NewSetting("peer-service", os.Getenv("CATTLE_PEER_SERVICE"))
 	RkeVersion                          = NewSetting("rke-version", "")
 	RkeMetadataConfig                   = NewSetting("rke-metadata-config", getMetadataConfig())
@@ -118,6 +127,8 @@
 	AuthUserInfoResyncCron              = NewSetting("auth-user-info-resync-cron", "0 0 * * *")
 	APIUIVersion                        = NewSetting("api-ui-version", "1.1.11")              // Please update the CATTLE_API_UI_VERSION in package/Dockerfile when updating the version here.
 	RotateCertsIfExpiringInDays         = NewSetting("rotate-certs-if-expiring-in-days", "7") // 7 days
+	CertsExpirationWarningDays          = NewSetting("certs-expiration-warning-days", "30")   // 30 days
+	CertsExpirationCriticalDays         = NewSetting("certs-expiration-critical-days", "7")   // 7 days
 	ClusterTemplateEnforcement          = NewSetting("cluster-template-enforcement", "false")
 	InitialDockerRootDir                = NewSetting("initial-docker-root-dir", "/var/lib/docker")
 	SystemCatalog                       = NewSetting("system-catalog", "external") // Options are 'external' or 'bundled'
@@ -134,6 +145,7 @@
 	GKEUpstreamRefresh                  = NewSetting("gke-refresh", "300")
 	HideLocalCluster                    = NewSetting("hide-local-cluster", "false")
 	MachineProvisionImage               = NewSetting("machine-provision-image", "rancher/machine:v0.15.0-rancher121")
+	EtcdSnapshotTestRestoreImage        = NewSetting("etcd-snapshot-test-restore-image", "rancher/hardened-etcd:v3.5.16-k3s1-build20241106") // image containing etcdutl used to test restore etcd snapshots of provisioned clusters
 	SystemFeatureChartRefreshSeconds    = NewSetting("system-feature-chart-refresh-seconds", "21600")
 	ClusterAgentDefaultAffinity         = NewSetting("cluster-agent-default-affinity", ClusterAgentAffinity)
 	FleetAgentDefaultAffinity           = NewSetting("fleet-agent-default-affinity", FleetAgentAffinity)
@@ -151,6 +163,15 @@
 	// AuthUserSessionTTLMinutes represents the time to live for tokens used for login sessions in minutes.
 	AuthUserSessionTTLMinutes = NewSetting("auth-user-session-ttl-minutes", "960") // 16 hours
 
+	// AuthUserSessionIdleTimeoutMinutes is the time in minutes a login session can go unused before it expires,
+	// regardless of its time to live. A zero value means sessions don't expire due to inactivity.
+	AuthUserSessionIdleTimeoutMinutes = NewSetting("auth-user-session-idle-timeout-minutes", "0")
+
+	// AuditLogPolicy is a JSON encoded audit policy with ordered rules that select the audit level per request,
+	// e.g. {"rules":[{"level":"None","methods":["GET"],"uriPrefixes":["/v1/counts"]}]}.
+	// Requests not matched by any rule are audited at the configured levels. An empty string disables the policy.
+	AuditLogPolicy = NewSetting("audit-log-policy", "")
+
 	// ChartDefaultURL represents the default URL for the system charts repo. It should only be set for test or
 	// debug purposes.
 	ChartDefaultURL = NewSetting("chart-default-url", "https://git.rancher.io/")
@@ -211,6 +232,10 @@
 	// If set to false the kubeconfig will contain a command to login to Rancher.
 	KubeconfigGenerateToken = NewSetting("kubeconfig-generate-token", "true")
 
+	// KubeconfigExecTokenTTLMinutes is the time to live of the kubeconfig tokens obtained through a device code login,
+	// see the devicecode package. Clients are expected to cache them locally and log in again once they expire.
+	KubeconfigExecTokenTTLMinutes = NewSetting("kubeconfig-exec-token-ttl-minutes", "960") // 16 hours
+
 	// PartnerChartDefaultBranch represents the default branch for the partner charts repo.
 	PartnerChartDefaultBranch = NewSetting("partner-chart-default-branch", "main")
 
@@ -336,13 +361,71 @@
 	_ = NewSetting("ui-theme", "")
 	_ = NewSetting("cli-version", "")
 	_ = NewSetting("has-support", "")
-	_ = NewSetting("auth-password-requirements-description", "")
 	_ = NewSetting("api-host", "")
 	_ = NewSetting("telemetry-uid", "")
 
+	// AuthPasswordRequirementsDescription describes the password policy for local users, it is shown by the UI
+	// and kept up to date by Rancher whenever a password policy setting changes.
+	AuthPasswordRequirementsDescription = NewSetting("auth-password-requirements-description", "")
+
 	// UnprivilegedJailUser controls whether jailed commands execute under a separate (unprivileged/non-root) user
 	// account. Setting it to false is only recommended for testing and development environments.
 	UnprivilegedJailUser = NewSetting("unprivileged-jail-user", "true")
+
+	// AccessRequestApproverGlobalRoles is a comma separated list of global roles whose users can approve or deny access requests.
+	AccessRequestApproverGlobalRoles = NewSetting("access-request-approver-global-roles", "admin")
+
+	// AccessRequestApproverGroups is a comma separated list of group principal IDs whose members can approve or deny access requests.
+	AccessRequestApproverGroups = NewSetting("access-request-approver-groups", "")
+
+	// AccessRequestMaxDurationMinutes is the longest duration access can be requested for. 0 removes the limit.
+	AccessRequestMaxDurationMinutes = NewSetting("access-request-max-duration-minutes", "480") // 8 hours
+
+	// SCIMAuthProvider is the name of the auth provider users provisioned through the SCIM endpoint log in with,
+	// e.g. okta or azuread. The SCIM endpoint is disabled when empty.
+	SCIMAuthProvider = NewSetting("scim-auth-provider", "")
+
+	// SCIMUserPrincipalAttribute is the SCIM attribute of provisioned users, userName or externalId,
+	// that holds the ID the auth provider uses in user principal IDs.
+	SCIMUserPrincipalAttribute = NewSetting("scim-user-principal-attribute", "userName")
+
+	// SCIMGroupPrincipalAttribute is the SCIM attribute of provisioned groups, displayName or externalId,
+	// that holds the ID the auth provider uses in group principal IDs.
+	SCIMGroupPrincipalAttribute = NewSetting("scim-group-principal-attribute", "displayName")
+
+	// AccessReviewCron determines how often an access review report is created.
+	// The value should be a valid cron expression e.g. "0 0 1 */3 *" (quarterly)
+	AccessReviewCron = NewSetting("access-review-cron", "")
+
+	// AccessReviewReportRetention is the number of access review reports kept. Older reports are deleted
+	// when a report is created. 0 keeps all reports.
+	AccessReviewReportRetention = NewSetting("access-review-report-retention", "8")
+
+	// ShellRecordingBackend determines where cluster shell and machine SSH sessions are recorded, "pvc" for the
+	// directory set by shell-recording-path or "s3" for the bucket set by the shell-recording-s3 settings.
+	// Sessions aren't recorded if it's empty. Shells are refused while recording is enabled but can't be started.
+	ShellRecordingBackend = NewSetting("shell-recording-backend", "")
+
+	// ShellRecordingPath is the directory recordings are written to by the "pvc" backend, typically the mount path
+	// of a persistent volume shared by the Rancher replicas.
+	ShellRecordingPath = NewSetting("shell-recording-path", "/var/lib/rancher/shell-recordings")
+
+	// ShellRecordingS3Endpoint is the endpoint of the S3-compatible storage used by the "s3" backend.
+	// Prefix it with http:// to connect without TLS.
+	ShellRecordingS3Endpoint = NewSetting("shell-recording-s3-endpoint", "s3.amazonaws.com")
+
+	// ShellRecordingS3Region is the region of the bucket recordings are written to by the "s3" backend.
+	ShellRecordingS3Region = NewSetting("shell-recording-s3-region", "")
+
+	// ShellRecordingS3Bucket is the bucket recordings are written to by the "s3" backend.
+	ShellRecordingS3Bucket = NewSetting("shell-recording-s3-bucket", "")
+
+	// ShellRecordingS3Folder is the folder of the bucket recordings are written to by the "s3" backend.
+	ShellRecordingS3Folder = NewSetting("shell-recording-s3-folder", "")
+
+	// ShellRecordingS3CredentialSecret is the secret, as namespace:name, holding the accessKey and secretKey used by
+	// the "s3" backend. IAM roles are used if it's empty.
+	ShellRecordingS3CredentialSecret = NewSetting("shell-recording-s3-credential-secret", "")
 )
 
 // FullShellImage returns the full private registry name of the rancher shell image.
@@ -0,0 +1,177 @@
+package shellrecording
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rancher/rancher/pkg/settings"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+)
+
+const (
+	// PVCBackend stores recordings in the directory set by the shell-recording-path setting.
+	PVCBackend = "pvc"
+	// S3Backend stores recordings in the S3-compatible bucket set by the shell-recording-s3 settings.
+	S3Backend = "s3"
+
+	contentType = "application/x-asciicast"
+
+	// uploadTimeout is how long uploading a recording to S3 may take.
+	uploadTimeout = 30 * time.Minute
+)
+
+// Backend stores recordings.
+type Backend interface {
+	// Create returns a writer storing the recording with the given key, along with its location.
+	// The recording is complete once the writer is closed, Close returns an error if it couldn't be stored.
+	Create(key string) (io.WriteCloser, string, error)
+	// Open returns a reader of the recording at location.
+	Open(ctx context.Context, location string) (io.ReadCloser, error)
+}
+
+// NewBackend returns the backend with the given name, configured by the current settings.
+func NewBackend(name string, secrets corecontrollers.SecretCache) (Backend, error) {
+	switch name {
+	case PVCBackend:
+		return &pvcBackend{dir: settings.ShellRecordingPath.Get()}, nil
+	case S3Backend:
+		return newS3Backend(secrets)
+	default:
+		return nil, fmt.Errorf("unsupported shell recording backend %q", name)
+	}
+}
+
+type pvcBackend struct {
+	dir string
+}
+
+func (b *pvcBackend) Create(key string) (io.WriteCloser, string, error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return nil, "", err
+	}
+	location := filepath.Join(b.dir, key)
+	file, err := os.OpenFile(location, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, "", err
+	}
+	return file, location, nil
+}
+
+// Open opens the recording at location, which must be in the recording directory.
+func (b *pvcBackend) Open(_ context.Context, location string) (io.ReadCloser, error) {
+	dir := filepath.Clean(b.dir) + string(filepath.Separator)
+	if !strings.HasPrefix(filepath.Clean(location), dir) {
+		return nil, fmt.Errorf("recording %s is not in the recording directory %s", location, b.dir)
+	}
+	return os.Open(location)
+}
+
+type s3Backend struct {
+	client *minio.Client
+	bucket string
+	folder string
+}
+
+func newS3Backend(secrets corecontrollers.SecretCache) (*s3Backend, error) {
+	bucket := settings.ShellRecordingS3Bucket.Get()
+	if bucket == "" {
+		return nil, fmt.Errorf("the %s setting is required by the s3 shell recording backend", settings.ShellRecordingS3Bucket.Name)
+	}
+
+	// no access credentials, we assume IAM roles
+	creds := credentials.NewIAM("")
+	if secretName := settings.ShellRecordingS3CredentialSecret.Get(); secretName != "" {
+		namespace, name, ok := strings.Cut(secretName, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s setting %q, expected namespace:name", settings.ShellRecordingS3CredentialSecret.Name, secretName)
+		}
+		secret, err := secrets.Get(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewStatic(string(secret.Data["accessKey"]), string(secret.Data["secretKey"]), "", credentials.SignatureDefault)
+	}
+
+	endpoint := settings.ShellRecordingS3Endpoint.Get()
+	secure := !strings.HasPrefix(endpoint, "http://")
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Region:       settings.ShellRecordingS3Region.Get(),
+		Secure:       secure,
+		BucketLookup: minio.BucketLookupAuto,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Backend{
+		client: client,
+		bucket: bucket,
+		folder: settings.ShellRecordingS3Folder.Get(),
+	}, nil
+}
+
+// Create spools the recording to a temporary file, which is uploaded to the bucket once the recording is closed. Writes
+// to the recording don't wait on S3 and the size of the object is known when it's uploaded, so that the client doesn't
+// buffer parts sized for the maximum object size.
+func (b *s3Backend) Create(key string) (io.WriteCloser, string, error) {
+	location := path.Join(b.folder, key)
+	file, err := os.CreateTemp("", "shell-recording-*.cast")
+	if err != nil {
+		return nil, "", err
+	}
+	return &s3Upload{File: file, backend: b, location: location}, location, nil
+}
+
+func (b *s3Backend) Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	object, err := b.client.GetObject(ctx, b.bucket, location, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, stat the object so that missing recordings are reported before the reader is used.
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
+
+type s3Upload struct {
+	*os.File
+	backend  *s3Backend
+	location string
+}
+
+// Close ends the recording and uploads it. The upload isn't tied to the request of the session so that it completes
+// after the client disconnects.
+func (u *s3Upload) Close() error {
+	defer u.remove()
+	info, err := u.File.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := u.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	if _, err := u.backend.client.PutObject(ctx, u.backend.bucket, u.location, u.File, info.Size(), minio.PutObjectOptions{ContentType: contentType}); err != nil {
+		return fmt.Errorf("failed to upload shell recording %s: %w", u.location, err)
+	}
+	return nil
+}
+
+// remove closes and removes the temporary file of the recording.
+func (u *s3Upload) remove() {
+	u.File.Close()
+	os.Remove(u.File.Name())
+}
@@ -0,0 +1,254 @@
+package shellrecording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Channels of the Kubernetes exec websocket protocols.
+const (
+	stdinChannel  = 0
+	stdoutChannel = 1
+	stderrChannel = 2
+	resizeChannel = 4
+
+	maxResponseHeaderLength = 64 * 1024
+	maxMessageLength        = 1024 * 1024
+)
+
+// RecordExec returns a response writer recording the terminal streams of a Kubernetes exec websocket proxied
+// through rw, e.g. by an httputil.ReverseProxy, to the session. It returns rw if the session is nil.
+func RecordExec(rw http.ResponseWriter, session *Session) http.ResponseWriter {
+	if session == nil {
+		return rw
+	}
+	return &execRecorder{ResponseWriter: rw, session: session}
+}
+
+type execRecorder struct {
+	http.ResponseWriter
+	session *Session
+}
+
+func (e *execRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := e.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("upstream ResponseWriter of type %v does not implement http.Hijacker", reflect.TypeOf(e.ResponseWriter))
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	stream := newExecStream(e.session)
+	recorded := &execConn{Conn: conn, stream: stream}
+	// The proxy writes the upgrade response through rw and then copies the websocket frames through the conn,
+	// both are recorded.
+	return recorded, bufio.NewReadWriter(rw.Reader, bufio.NewWriter(recorded)), nil
+}
+
+func (e *execRecorder) Flush() {
+	if flusher, ok := e.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// execConn records the data read from the client and written to it.
+type execConn struct {
+	net.Conn
+	stream *execStream
+}
+
+func (c *execConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.stream.fromClient(p[:n])
+	return n, err
+}
+
+func (c *execConn) Write(p []byte) (int, error) {
+	c.stream.fromServer(p)
+	return c.Conn.Write(p)
+}
+
+// execStream decodes the websocket messages of the exec protocols negotiated by the upgrade response,
+// channel.k8s.io and its base64 variant.
+type execStream struct {
+	lock    sync.Mutex
+	session *Session
+	header  []byte
+	upgrade bool
+	failed  bool
+	base64  bool
+	client  *frameReader
+	server  *frameReader
+}
+
+func newExecStream(session *Session) *execStream {
+	s := &execStream{session: session}
+	s.client = &frameReader{onMessage: s.message}
+	s.server = &frameReader{onMessage: s.message}
+	return s
+}
+
+func (s *execStream) fromClient(p []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.upgrade && !s.failed {
+		s.client.write(p)
+	}
+}
+
+func (s *execStream) fromServer(p []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failed {
+		return
+	}
+	if s.upgrade {
+		s.server.write(p)
+		return
+	}
+
+	s.header = append(s.header, p...)
+	end := bytes.Index(s.header, []byte("\r\n\r\n"))
+	if end < 0 {
+		s.failed = len(s.header) > maxResponseHeaderLength
+		return
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(s.header[:end+4])), nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		s.failed = true
+		return
+	}
+	s.upgrade = true
+	s.base64 = strings.Contains(resp.Header.Get("Sec-Websocket-Protocol"), "base64")
+	s.server.write(s.header[end+4:])
+	s.header = nil
+}
+
+func (s *execStream) message(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	channel, payload := data[0], data[1:]
+	if s.base64 {
+		channel -= '0'
+		decoded, err := base64.StdEncoding.DecodeString(string(payload))
+		if err != nil {
+			return
+		}
+		payload = decoded
+	}
+
+	switch channel {
+	case stdinChannel:
+		s.session.Input(payload)
+	case stdoutChannel, stderrChannel:
+		s.session.Output(payload)
+	case resizeChannel:
+		size := struct {
+			Width  int
+			Height int
+		}{}
+		if err := json.Unmarshal(payload, &size); err == nil {
+			s.session.Resize(size.Width, size.Height)
+		}
+	}
+}
+
+// frameReader decodes the websocket frames written to it, in either direction, and reassembles fragmented messages.
+// Control frames are ignored. It stops decoding if a message exceeds maxMessageLength.
+type frameReader struct {
+	buf       []byte
+	message   []byte
+	failed    bool
+	onMessage func([]byte)
+}
+
+func (f *frameReader) write(p []byte) {
+	if f.failed {
+		return
+	}
+	f.buf = append(f.buf, p...)
+	for !f.failed {
+		n := f.next()
+		if n == 0 {
+			break
+		}
+		f.buf = f.buf[n:]
+	}
+	if len(f.buf) == 0 {
+		f.buf = nil
+	}
+}
+
+// next decodes the frame at the start of the buffer and returns its length, or 0 if the frame is incomplete.
+func (f *frameReader) next() int {
+	if len(f.buf) < 2 {
+		return 0
+	}
+	fin := f.buf[0]&0x80 != 0
+	opcode := f.buf[0] & 0x0f
+	masked := f.buf[1]&0x80 != 0
+	length := uint64(f.buf[1] & 0x7f)
+	offset := 2
+
+	switch length {
+	case 126:
+		if len(f.buf) < 4 {
+			return 0
+		}
+		length = uint64(binary.BigEndian.Uint16(f.buf[2:]))
+		offset = 4
+	case 127:
+		if len(f.buf) < 10 {
+			return 0
+		}
+		length = binary.BigEndian.Uint64(f.buf[2:])
+		offset = 10
+	}
+	if length+uint64(len(f.message)) > maxMessageLength {
+		f.failed = true
+		return 0
+	}
+
+	var mask []byte
+	if masked {
+		if len(f.buf) < offset+4 {
+			return 0
+		}
+		mask = f.buf[offset : offset+4]
+		offset += 4
+	}
+	end := offset + int(length)
+	if len(f.buf) < end {
+		return 0
+	}
+
+	payload := f.buf[offset:end]
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	if opcode >= 0x8 {
+		return end
+	}
+	if opcode != 0x0 {
+		f.message = f.message[:0]
+	}
+	f.message = append(f.message, payload...)
+	if fin {
+		f.onMessage(f.message)
+		f.message = f.message[:0]
+	}
+	return end
+}
@@ -0,0 +1,123 @@
+package shellrecording
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// frame encodes a websocket frame, masked like frames sent by clients if mask is set.
+func frame(fin bool, opcode byte, payload []byte, mask bool) []byte {
+	var b bytes.Buffer
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	b.WriteByte(first)
+
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		b.WriteByte(maskBit | byte(len(payload)))
+	case len(payload) <= 0xffff:
+		b.WriteByte(maskBit | 126)
+		_ = binary.Write(&b, binary.BigEndian, uint16(len(payload)))
+	default:
+		b.WriteByte(maskBit | 127)
+		_ = binary.Write(&b, binary.BigEndian, uint64(len(payload)))
+	}
+
+	if !mask {
+		b.Write(payload)
+		return b.Bytes()
+	}
+	key := []byte{0x12, 0x34, 0x56, 0x78}
+	b.Write(key)
+	for i, c := range payload {
+		b.WriteByte(c ^ key[i%4])
+	}
+	return b.Bytes()
+}
+
+func base64Message(channel byte, data string) []byte {
+	return append([]byte{'0' + channel}, base64.StdEncoding.EncodeToString([]byte(data))...)
+}
+
+func newTestSession() (*Session, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	return &Session{
+		name:    "shell-abcde",
+		writer:  nopWriteCloser{buf},
+		start:   time.Now(),
+		pending: map[string][]byte{},
+	}, buf
+}
+
+func TestExecStreamBase64(t *testing.T) {
+	session, buf := newTestSession()
+	stream := newExecStream(session)
+
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-Websocket-Protocol: base64.channel.k8s.io\r\n\r\n"
+	output := frame(true, 0x1, base64Message(stdoutChannel, "$ "), false)
+	// The response and the first frame are split at arbitrary points.
+	data := append([]byte(response), output...)
+	stream.fromServer(data[:20])
+	stream.fromServer(data[20 : len(data)-3])
+	stream.fromServer(data[len(data)-3:])
+
+	stream.fromClient(frame(true, 0x1, base64Message(stdinChannel, "ls\r"), true))
+	stream.fromClient(frame(true, 0x9, []byte("ping"), true))
+	stream.fromClient(frame(true, 0x1, base64Message(resizeChannel, `{"Width":132,"Height":43}`), true))
+
+	// A message fragmented in two frames.
+	message := base64Message(stderrChannel, "error: not found\r\n")
+	stream.fromServer(append(frame(false, 0x1, message[:5], false), frame(true, 0x0, message[5:], false)...))
+
+	long := string(bytes.Repeat([]byte("x"), 300))
+	stream.fromServer(frame(true, 0x1, base64Message(stdoutChannel, long), false))
+
+	_, events := readRecording(t, bytes.NewReader(append([]byte("{}\n"), buf.Bytes()...)))
+	require.Len(t, events, 5)
+	assert.Equal(t, []any{"o", "$ "}, events[0][1:])
+	assert.Equal(t, []any{"i", "ls\r"}, events[1][1:])
+	assert.Equal(t, []any{"r", "132x43"}, events[2][1:])
+	assert.Equal(t, []any{"o", "error: not found\r\n"}, events[3][1:])
+	assert.Equal(t, []any{"o", long}, events[4][1:])
+}
+
+func TestExecStreamBinary(t *testing.T) {
+	session, buf := newTestSession()
+	stream := newExecStream(session)
+
+	stream.fromServer([]byte("HTTP/1.1 101 Switching Protocols\r\nSec-Websocket-Protocol: v4.channel.k8s.io\r\n\r\n"))
+	stream.fromClient(frame(true, 0x2, append([]byte{stdinChannel}, "exit\r"...), true))
+	stream.fromServer(frame(true, 0x2, append([]byte{stdoutChannel}, "bye\r\n"...), false))
+
+	_, events := readRecording(t, bytes.NewReader(append([]byte("{}\n"), buf.Bytes()...)))
+	require.Len(t, events, 2)
+	assert.Equal(t, []any{"i", "exit\r"}, events[0][1:])
+	assert.Equal(t, []any{"o", "bye\r\n"}, events[1][1:])
+}
+
+func TestExecStreamNotUpgraded(t *testing.T) {
+	session, buf := newTestSession()
+	stream := newExecStream(session)
+
+	stream.fromServer([]byte("HTTP/1.1 403 Forbidden\r\nContent-Length: 9\r\n\r\nforbidden"))
+	stream.fromClient(frame(true, 0x1, base64Message(stdinChannel, "ls\r"), true))
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,288 @@
+// Package shellrecording records interactive shell sessions, cluster shells and SSH sessions to machines, in
+// asciicast v2 format (https://docs.asciinema.org/manual/asciicast/v2/). Recordings are written to the backend
+// selected by the shell-recording-backend setting and indexed by ShellRecording resources.
+package shellrecording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/util"
+	mgmtcontrollers "github.com/rancher/rancher/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/wrangler"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// AuditAnnotation is the annotation of the audit log entry of a request naming the ShellRecording of its session.
+	AuditAnnotation = "shell.cattle.io/recording"
+
+	eventInput  = "i"
+	eventOutput = "o"
+	eventResize = "r"
+)
+
+// Options describe the session being recorded.
+type Options struct {
+	// Type is the type of the session, v3.ShellRecordingTypeClusterShell or v3.ShellRecordingTypeMachineSSH.
+	Type string
+	// ClusterName is the name of the cluster the session is opened on.
+	ClusterName string
+	// Target is the namespace/name of the machine of SSH sessions.
+	Target string
+	// Width and Height are the initial size of the terminal, 80x24 if unset.
+	Width, Height int
+}
+
+// Recorder starts the recordings of sessions.
+type Recorder struct {
+	recordings mgmtcontrollers.ShellRecordingClient
+	newBackend func(name string) (Backend, error)
+}
+
+// NewRecorder returns a Recorder.
+func NewRecorder(wContext *wrangler.Context) *Recorder {
+	secrets := wContext.Core.Secret().Cache()
+	return &Recorder{
+		recordings: wContext.Mgmt.ShellRecording(),
+		newBackend: func(name string) (Backend, error) {
+			return NewBackend(name, secrets)
+		},
+	}
+}
+
+// Open returns a reader of the recording of the given ShellRecording.
+func Open(ctx context.Context, secrets corecontrollers.SecretCache, recording *v3.ShellRecording) (io.ReadCloser, error) {
+	backend, err := NewBackend(recording.Backend, secrets)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Open(ctx, recording.Location)
+}
+
+// Start starts recording the session opened by req by creating its ShellRecording. It returns a nil Session, which
+// records nothing, if recording is disabled. The audit log entry of req is annotated with the name of the recording.
+func (r *Recorder) Start(req *http.Request, opts Options) (*Session, error) {
+	backendName := settings.ShellRecordingBackend.Get()
+	if r == nil || backendName == "" {
+		return nil, nil
+	}
+
+	ctx := req.Context()
+	user, ok := request.UserFrom(ctx)
+	if !ok {
+		return nil, fmt.Errorf("failed to start shell recording: no user in the request")
+	}
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = 80, 24
+	}
+
+	backend, err := r.newBackend(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start shell recording: %w", err)
+	}
+	name := names.SimpleNameGenerator.GenerateName("shell-")
+	writer, location, err := backend.Create(name + ".cast")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start shell recording: %w", err)
+	}
+
+	now := time.Now()
+	recording, err := r.recordings.Create(&v3.ShellRecording{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Type:        opts.Type,
+		UserID:      user.GetName(),
+		AuditID:     util.AuditIDFrom(ctx),
+		ClusterName: opts.ClusterName,
+		Target:      opts.Target,
+		Backend:     backendName,
+		Location:    location,
+		StartedAt:   metav1.NewTime(now),
+	})
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to start shell recording: %w", err)
+	}
+	util.AddAuditAnnotation(ctx, AuditAnnotation, recording.Name)
+
+	s := &Session{
+		name:       recording.Name,
+		recordings: r.recordings,
+		writer:     writer,
+		start:      now,
+		pending:    map[string][]byte{},
+	}
+	s.writeHeader(opts, user.GetName(), now)
+	return s, nil
+}
+
+// Session is the recording of a session. A nil Session records nothing.
+type Session struct {
+	name       string
+	recordings mgmtcontrollers.ShellRecordingClient
+	start      time.Time
+
+	lock    sync.Mutex
+	writer  io.WriteCloser
+	size    int64
+	err     error
+	closed  bool
+	pending map[string][]byte
+}
+
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func (s *Session) writeHeader(opts Options, userID string, now time.Time) {
+	title := opts.Type + " " + opts.ClusterName
+	if opts.Target != "" {
+		title += " " + opts.Target
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writeLine(header{
+		Version:   2,
+		Width:     opts.Width,
+		Height:    opts.Height,
+		Timestamp: now.Unix(),
+		Title:     title + " (" + userID + ")",
+		Env:       map[string]string{"TERM": "xterm"},
+	})
+}
+
+// Input records data typed in the terminal.
+func (s *Session) Input(data []byte) {
+	s.event(eventInput, data)
+}
+
+// Output records data printed to the terminal.
+func (s *Session) Output(data []byte) {
+	s.event(eventOutput, data)
+}
+
+// Resize records a change of the size of the terminal.
+func (s *Session) Resize(width, height int) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writeEvent(eventResize, strconv.Itoa(width)+"x"+strconv.Itoa(height))
+}
+
+func (s *Session) event(code string, data []byte) {
+	if s == nil || len(data) == 0 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Streams are chunked regardless of characters, hold back incomplete UTF-8 sequences until the rest arrives
+	// since events are JSON strings.
+	data = append(s.pending[code], data...)
+	data, s.pending[code] = splitIncompleteRune(data)
+	if len(data) > 0 {
+		s.writeEvent(code, string(data))
+	}
+}
+
+func (s *Session) writeEvent(code, data string) {
+	elapsed := math.Round(time.Since(s.start).Seconds()*1e6) / 1e6
+	s.writeLine([]any{elapsed, code, data})
+}
+
+// writeLine writes a line of the recording. Recording stops at the first error, which doesn't interrupt the session.
+func (s *Session) writeLine(v any) {
+	if s.err != nil || s.closed {
+		return
+	}
+	line, err := json.Marshal(v)
+	if err == nil {
+		var n int
+		n, err = s.writer.Write(append(line, '\n'))
+		s.size += int64(n)
+	}
+	if err != nil {
+		s.err = err
+		logrus.Warnf("Failed to write shell recording %s, the rest of the session is not recorded: %v", s.name, err)
+	}
+}
+
+// Close ends the recording and records the end of the session on its ShellRecording, along with the error that kept
+// the recording from being stored in full, if any.
+func (s *Session) Close() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	for code, data := range s.pending {
+		if len(data) > 0 {
+			s.writeEvent(code, string(data))
+		}
+	}
+	s.closed = true
+	if err := s.writer.Close(); err != nil {
+		logrus.Warnf("Failed to write shell recording %s: %v", s.name, err)
+		if s.err == nil {
+			s.err = err
+		}
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		recording, err := s.recordings.Get(s.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		ended := metav1.Now()
+		recording.EndedAt = &ended
+		recording.Size = s.size
+		if s.err != nil {
+			recording.Error = s.err.Error()
+		}
+		_, err = s.recordings.Update(recording)
+		return err
+	})
+	if err != nil {
+		logrus.Warnf("Failed to record the end of shell recording %s: %v", s.name, err)
+	}
+}
+
+// splitIncompleteRune splits data before the UTF-8 sequence it ends with if that sequence is incomplete.
+func splitIncompleteRune(data []byte) ([]byte, []byte) {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		start := len(data) - i
+		if !utf8.RuneStart(data[start]) {
+			continue
+		}
+		if utf8.FullRune(data[start:]) {
+			break
+		}
+		return data[:start], data[start:]
+	}
+	return data, nil
+}
@@ -0,0 +1,243 @@
+package shellrecording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/util"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func setBackend(t *testing.T, value string) {
+	t.Helper()
+	require.NoError(t, settings.ShellRecordingBackend.Set(value))
+	t.Cleanup(func() {
+		_ = settings.ShellRecordingBackend.Set(settings.ShellRecordingBackend.Default)
+	})
+}
+
+func newRequest(t *testing.T) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "https://rancher.example.com/v1/management.cattle.io.clusters/local?link=shell", nil)
+	require.NoError(t, err)
+	ctx := request.WithUser(context.Background(), &user.DefaultInfo{Name: "u-alice"})
+	return req.WithContext(util.WithAuditID(ctx, "3fa2b7c4-audit"))
+}
+
+// readRecording returns the header and events of a recording.
+func readRecording(t *testing.T, r io.Reader) (map[string]any, [][]any) {
+	t.Helper()
+	scanner := bufio.NewScanner(r)
+	require.True(t, scanner.Scan(), "expected a header")
+	header := map[string]any{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &header))
+
+	var events [][]any
+	for scanner.Scan() {
+		var event []any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.Len(t, event, 3)
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	return header, events
+}
+
+func TestStartDisabled(t *testing.T) {
+	setBackend(t, "")
+
+	recorder := &Recorder{}
+	recording, err := recorder.Start(newRequest(t), Options{Type: v3.ShellRecordingTypeClusterShell})
+	require.NoError(t, err)
+	assert.Nil(t, recording)
+
+	// A nil session records nothing.
+	recording.Output([]byte("ignored"))
+	recording.Resize(100, 40)
+	recording.Close()
+
+	recording, err = (*Recorder)(nil).Start(newRequest(t), Options{})
+	require.NoError(t, err)
+	assert.Nil(t, recording)
+}
+
+func TestRecordSession(t *testing.T) {
+	setBackend(t, PVCBackend)
+	dir := t.TempDir()
+
+	ctrl := gomock.NewController(t)
+	recordings := fake.NewMockNonNamespacedClientInterface[*v3.ShellRecording, *v3.ShellRecordingList](ctrl)
+	recorder := &Recorder{
+		recordings: recordings,
+		newBackend: func(name string) (Backend, error) {
+			require.Equal(t, PVCBackend, name)
+			return &pvcBackend{dir: dir}, nil
+		},
+	}
+
+	var created *v3.ShellRecording
+	recordings.EXPECT().Create(gomock.Any()).DoAndReturn(func(recording *v3.ShellRecording) (*v3.ShellRecording, error) {
+		created = recording.DeepCopy()
+		return recording, nil
+	})
+
+	req := newRequest(t)
+	ctx, annotations := util.WithAuditAnnotations(req.Context())
+	req = req.WithContext(ctx)
+
+	recording, err := recorder.Start(req, Options{
+		Type:        v3.ShellRecordingTypeMachineSSH,
+		ClusterName: "c-m-abcdef",
+		Target:      "fleet-default/machine-1",
+		Width:       120,
+		Height:      30,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, recording)
+
+	assert.Equal(t, v3.ShellRecordingTypeMachineSSH, created.Type)
+	assert.Equal(t, "u-alice", created.UserID)
+	assert.Equal(t, "3fa2b7c4-audit", created.AuditID)
+	assert.Equal(t, "c-m-abcdef", created.ClusterName)
+	assert.Equal(t, "fleet-default/machine-1", created.Target)
+	assert.Equal(t, PVCBackend, created.Backend)
+	assert.Equal(t, filepath.Join(dir, created.Name+".cast"), created.Location)
+	assert.Equal(t, created.Name, annotations.Get()[AuditAnnotation])
+
+	recording.Input([]byte("echo caf\xc3"))
+	recording.Input([]byte("\xa9\r"))
+	recording.Output([]byte("café\r\n"))
+	recording.Resize(100, 40)
+
+	recordings.EXPECT().Get(created.Name, gomock.Any()).Return(created.DeepCopy(), nil)
+	recordings.EXPECT().Update(gomock.Any()).DoAndReturn(func(recording *v3.ShellRecording) (*v3.ShellRecording, error) {
+		assert.NotNil(t, recording.EndedAt)
+		info, err := os.Stat(created.Location)
+		require.NoError(t, err)
+		assert.Equal(t, info.Size(), recording.Size)
+		return recording, nil
+	})
+	recording.Close()
+	recording.Close()
+
+	file, err := os.Open(created.Location)
+	require.NoError(t, err)
+	defer file.Close()
+
+	header, events := readRecording(t, file)
+	assert.EqualValues(t, 2, header["version"])
+	assert.EqualValues(t, 120, header["width"])
+	assert.EqualValues(t, 30, header["height"])
+	assert.Equal(t, "MachineSSH c-m-abcdef fleet-default/machine-1 (u-alice)", header["title"])
+
+	require.Len(t, events, 4)
+	assert.Equal(t, []any{"i", "echo caf"}, events[0][1:])
+	assert.Equal(t, []any{"i", "é\r"}, events[1][1:], "expected the split character to be held back")
+	assert.Equal(t, []any{"o", "café\r\n"}, events[2][1:])
+	assert.Equal(t, []any{"r", "100x40"}, events[3][1:])
+}
+
+// failingBackend stores nothing, closing its writers fails.
+type failingBackend struct{}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (failingWriter) Close() error                { return errors.New("upload failed") }
+
+func (failingBackend) Create(key string) (io.WriteCloser, string, error) {
+	return failingWriter{}, key, nil
+}
+
+func (failingBackend) Open(context.Context, string) (io.ReadCloser, error) {
+	return nil, errors.New("not found")
+}
+
+func TestRecordSessionStoreFailed(t *testing.T) {
+	setBackend(t, S3Backend)
+
+	ctrl := gomock.NewController(t)
+	recordings := fake.NewMockNonNamespacedClientInterface[*v3.ShellRecording, *v3.ShellRecordingList](ctrl)
+	recorder := &Recorder{
+		recordings: recordings,
+		newBackend: func(string) (Backend, error) {
+			return failingBackend{}, nil
+		},
+	}
+
+	var created *v3.ShellRecording
+	recordings.EXPECT().Create(gomock.Any()).DoAndReturn(func(recording *v3.ShellRecording) (*v3.ShellRecording, error) {
+		created = recording.DeepCopy()
+		return recording, nil
+	})
+	recording, err := recorder.Start(newRequest(t), Options{Type: v3.ShellRecordingTypeClusterShell, ClusterName: "c-abcde"})
+	require.NoError(t, err)
+	recording.Output([]byte("ls\r\n"))
+
+	recordings.EXPECT().Get(created.Name, gomock.Any()).Return(created.DeepCopy(), nil)
+	recordings.EXPECT().Update(gomock.Any()).DoAndReturn(func(recording *v3.ShellRecording) (*v3.ShellRecording, error) {
+		assert.NotNil(t, recording.EndedAt)
+		assert.Equal(t, "upload failed", recording.Error)
+		return recording, nil
+	})
+	recording.Close()
+}
+
+func TestPVCBackendOpen(t *testing.T) {
+	dir := t.TempDir()
+	backend := &pvcBackend{dir: dir}
+
+	writer, location, err := backend.Create("shell-abcde.cast")
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("recording"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	_, _, err = backend.Create("shell-abcde.cast")
+	assert.Error(t, err, "expected existing recordings not to be overwritten")
+
+	reader, err := backend.Open(context.Background(), location)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "recording", string(data))
+	require.NoError(t, reader.Close())
+
+	_, err = backend.Open(context.Background(), filepath.Join(dir, "..", "secret"))
+	assert.Error(t, err, "expected locations outside of the recording directory to be rejected")
+}
+
+func TestSplitIncompleteRune(t *testing.T) {
+	tests := []struct {
+		data     string
+		complete string
+		rest     string
+	}{
+		{data: "abc", complete: "abc"},
+		{data: "", complete: ""},
+		{data: "ab\xc3", complete: "ab", rest: "\xc3"},
+		{data: "ab\xe2\x82", complete: "ab", rest: "\xe2\x82"},
+		{data: "ab\xe2\x82\xac", complete: "ab€"},
+		{data: "\xf0\x9f\x98", complete: "", rest: "\xf0\x9f\x98"},
+		{data: "ab\x80", complete: "ab\x80"},
+	}
+	for _, tt := range tests {
+		complete, rest := splitIncompleteRune([]byte(tt.data))
+		assert.Equal(t, tt.complete, string(complete), "complete part of %q", tt.data)
+		assert.Equal(t, tt.rest, string(rest), "rest of %q", tt.data)
+	}
+}
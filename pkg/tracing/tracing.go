@@ -0,0 +1,145 @@
+// Package tracing exports OpenTelemetry traces of the requests served by Rancher to an OTLP collector. Spans are only
+// recorded once Setup is called with a collector endpoint, otherwise the helpers of this package are no-ops.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rancher/rancher/pkg/version"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/rancher/rancher"
+	serviceName         = "rancher"
+	shutdownTimeout     = 5 * time.Second
+)
+
+// Attributes of the spans recorded by Rancher.
+const (
+	AuditIDKey = attribute.Key("rancher.audit_id")
+	ClusterKey = attribute.Key("rancher.cluster")
+	UserKey    = attribute.Key("rancher.user")
+)
+
+var enabled bool
+
+// Setup exports traces to the OTLP gRPC collector at endpoint, e.g. http://localhost:4317, sampling the given ratio
+// of the requests that aren't part of a trace yet. The scheme of the endpoint selects whether TLS is used. Traces
+// are flushed once ctx is done. Tracing is disabled if endpoint is empty.
+func Setup(ctx context.Context, endpoint string, samplingRatio float64) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid tracing endpoint %q: expected an http or https URL", endpoint)
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(samplingRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			logrus.Warnf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	logrus.Infof("Exporting traces to %s with a sampling ratio of %v", endpoint, samplingRatio)
+	return nil
+}
+
+// Start starts a span as a child of the span of ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if err isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetAttributes adds attributes to the span of ctx, if any.
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// NewHandler wraps the handler of the server to start a span for each request, continuing the trace of the client
+// if the request carries its context.
+func NewHandler(next http.Handler) http.Handler {
+	if !enabled {
+		return next
+	}
+	return otelhttp.NewHandler(next, serviceName, otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+		return "HTTP " + req.Method
+	}))
+}
+
+// Transport wraps the transport of requests proxied to the cluster to record them as client spans, and to propagate
+// the trace to the cluster. The wrapped transport is still reachable to dial upgraded connections.
+func Transport(next http.RoundTripper, cluster string) http.RoundTripper {
+	if !enabled {
+		return next
+	}
+	return &transport{
+		next: next,
+		traced: otelhttp.NewTransport(next,
+			otelhttp.WithSpanOptions(trace.WithAttributes(ClusterKey.String(cluster))),
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return "proxy " + req.Method
+			})),
+	}
+}
+
+type transport struct {
+	next   http.RoundTripper
+	traced http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.traced.RoundTrip(req)
+}
+
+// WrappedRoundTripper implements k8s.io/apimachinery/pkg/util/net.RoundTripperWrapper.
+func (t *transport) WrappedRoundTripper() http.RoundTripper {
+	return t.next
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+func TestTransport(t *testing.T) {
+	next := &http.Transport{}
+
+	enabled = false
+	assert.Same(t, http.RoundTripper(next), Transport(next, "c-abcde"))
+
+	enabled = true
+	t.Cleanup(func() { enabled = false })
+	traced := Transport(next, "c-abcde")
+	assert.NotSame(t, http.RoundTripper(next), traced)
+
+	// The upgrade aware proxy dials upgraded connections through the wrapped transport.
+	wrapper, ok := traced.(utilnet.RoundTripperWrapper)
+	if assert.True(t, ok) {
+		assert.Same(t, http.RoundTripper(next), wrapper.WrappedRoundTripper())
+	}
+}
+
+func TestSetupInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4317", "grpc://localhost:4317", "http://"} {
+		assert.Error(t, Setup(context.Background(), endpoint, 1), endpoint)
+	}
+	assert.NoError(t, Setup(context.Background(), "", 1))
+	assert.False(t, enabled)
+}
@@ -36,6 +36,9 @@ func (a *Authorizers) Authorize(req *http.Request) (clientKey string, authed boo
 			}
 			continue
 		}
+		if s, ok := req.Context().Value(sessionContextKey{}).(*session); ok {
+			s.start(key)
+		}
 		return key, authed, err
 	}
 
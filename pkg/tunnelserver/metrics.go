@@ -0,0 +1,56 @@
+package tunnelserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/rancher/rancher/pkg/metrics/collectors"
+)
+
+type sessionContextKey struct{}
+
+// sessionMetrics records the sessions of the agents connected to the tunnel server per cluster.
+type sessionMetrics struct {
+	next        http.Handler
+	clusterName func(clientKey string) string
+	// clientKeys holds the client keys that had a session, to count reconnects.
+	clientKeys sync.Map
+}
+
+// session is the session of a request to the tunnel server, started once its client is authorized by the chain.
+type session struct {
+	metrics *sessionMetrics
+	// cluster is the cluster the session was recorded for.
+	cluster string
+}
+
+// NewSessionMetricsHandler wraps the handler of the tunnel server to record the number of sessions of agents and
+// their reconnects, per cluster as returned by clusterName for the client key of the session. Sessions are only
+// counted if authorized by Authorizers, and only while the handler serves them, which remotedialer does for their
+// whole lifetime.
+func NewSessionMetricsHandler(next http.Handler, clusterName func(clientKey string) string) http.Handler {
+	return &sessionMetrics{
+		next:        next,
+		clusterName: clusterName,
+	}
+}
+
+func (m *sessionMetrics) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s := &session{metrics: m}
+	m.next.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), sessionContextKey{}, s)))
+	if s.cluster != "" {
+		collectors.RemoveTunnelSession(s.cluster)
+	}
+}
+
+func (s *session) start(clientKey string) {
+	cluster := s.metrics.clusterName(clientKey)
+	if cluster == "" {
+		return
+	}
+	_, reconnect := s.metrics.clientKeys.LoadOrStore(clientKey, struct{}{})
+	if collectors.AddTunnelSession(cluster, reconnect) {
+		s.cluster = cluster
+	}
+}
@@ -0,0 +1,51 @@
+package tunnelserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rancher/rancher/pkg/metrics/collectors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionMetricsHandler(t *testing.T) {
+	collectors.Register()
+
+	authorizers := &Authorizers{}
+	authorizers.Add(func(req *http.Request) (string, bool, error) {
+		key := req.Header.Get("X-Client-Key")
+		return key, key != "", nil
+	})
+
+	var sessions float64
+	tunnel := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if _, authed, _ := authorizers.Authorize(req); !authed {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The session is served until the handler returns.
+		sessions = testutil.ToFloat64(collectors.TunnelSessions.WithLabelValues("c-abcde"))
+	})
+	handler := NewSessionMetricsHandler(tunnel, func(clientKey string) string {
+		cluster, _, _ := strings.Cut(clientKey, ":")
+		return cluster
+	})
+
+	connect := func(clientKey string) {
+		req := httptest.NewRequest(http.MethodGet, "/v3/connect", nil)
+		req.Header.Set("X-Client-Key", clientKey)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	connect("c-abcde")
+	assert.Equal(t, float64(1), sessions)
+	connect("c-abcde:m-12345")
+	connect("c-abcde")
+	connect("")
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(collectors.TunnelSessions.WithLabelValues("c-abcde")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collectors.TunnelReconnects.WithLabelValues("c-abcde")))
+}
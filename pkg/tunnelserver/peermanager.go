@@ -180,6 +180,13 @@ func (p *peerManager) addRemovePeers(endpoints *v1.Endpoints) {
 }
 
 func (p *peerManager) notify() {
+	peers := p.currentPeers()
+	for c := range p.listeners {
+		c <- peers
+	}
+}
+
+func (p *peerManager) currentPeers() peermanager.Peers {
 	peers := peermanager.Peers{
 		Leader: p.leader,
 		Ready:  p.ready,
@@ -189,10 +196,13 @@ func (p *peerManager) notify() {
 	for id := range p.peers {
 		peers.IDs = append(peers.IDs, id)
 	}
+	return peers
+}
 
-	for c := range p.listeners {
-		c <- peers
-	}
+func (p *peerManager) Peers() peermanager.Peers {
+	p.Lock()
+	defer p.Unlock()
+	return p.currentPeers()
 }
 
 func (p *peerManager) AddListener(c chan<- peermanager.Peers) {